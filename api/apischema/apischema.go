@@ -0,0 +1,77 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package apischema defines the documents served by the image server API endpoints.
+// It is shared by the server which writes them and the clients in pkg/client which read them.
+package apischema
+
+import (
+	"time"
+
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+)
+
+// Summary is the fleet summary served by the summary endpoint
+type Summary struct {
+	// Total is the number of ClusterConfigs summarized
+	Total int `json:"total"`
+	// Phases counts the ClusterConfigs in each phase
+	Phases map[relocationv1alpha1.ClusterConfigPhase]int `json:"phases"`
+	// TopErrorReasons are the most common problems reported by the ClusterConfig conditions, most common first
+	TopErrorReasons []ReasonCount `json:"topErrorReasons"`
+}
+
+// ReasonCount is the number of ClusterConfigs reporting a problem with the same condition and reason
+type ReasonCount struct {
+	Condition string `json:"condition"`
+	Reason    string `json:"reason"`
+	Count     int    `json:"count"`
+}
+
+// ConsoleLog describes the host console output captured during a relocation attempt
+type ConsoleLog struct {
+	// Name identifies the log, it is the consoleLog of the attempt in the ClusterConfig status
+	Name string `json:"name"`
+	// Size is the number of bytes captured
+	Size int64 `json:"size"`
+	// LastCaptured is when the output was last captured
+	LastCaptured time.Time `json:"lastCaptured"`
+}
+
+// EventType identifies a relocation lifecycle event
+type EventType string
+
+const (
+	// ImageBuilt is published when an image is built for a ClusterConfig
+	ImageBuilt EventType = "ImageBuilt"
+	// ImageDownloaded is published when an image has been sent to a client
+	ImageDownloaded EventType = "ImageDownloaded"
+	// ImageAttached is published when the image is attached to the referenced BareMetalHost
+	ImageAttached EventType = "ImageAttached"
+	// RelocationCompleted is published when the relocated cluster reports success
+	RelocationCompleted EventType = "RelocationCompleted"
+	// RelocationAborted is published when the relocation is aborted
+	RelocationAborted EventType = "RelocationAborted"
+)
+
+// Event is a single relocation lifecycle event for a ClusterConfig streamed by the events endpoint
+type Event struct {
+	Type      EventType `json:"type"`
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	Time      time.Time `json:"time"`
+	Message   string    `json:"message,omitempty"`
+}
@@ -0,0 +1,297 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package isoschema defines the layout of the configuration content placed on relocation ISOs.
+// It is shared by the service which writes the content and the on-host agent which reads it.
+package isoschema
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// V1 is the first version of the ISO content layout
+	V1 = "v1"
+
+	// CurrentVersion is the version written by this package
+	CurrentVersion = V1
+)
+
+const (
+	// VolumeLabel is the default label of the ISO volume the on-host agent searches for
+	// Manifests with a VolumeLabel of their own are served on a volume with that label instead
+	VolumeLabel = "relocation-config"
+
+	// MaxVolumeLabelLength is the longest volume label an ISO 9660 volume descriptor holds
+	MaxVolumeLabelLength = 32
+
+	// ManifestFileName is the name of the manifest file at the root of the content
+	ManifestFileName = "manifest.json"
+
+	// BuildInfoFileName is the name of the file at the root of the content describing what produced it
+	// It isn't listed in the manifest
+	BuildInfoFileName = "build-info.json"
+)
+
+// FileType identifies the kind of content stored in a file
+type FileType string
+
+const (
+	// ClusterRelocationFileType files contain a JSON ClusterRelocation object
+	ClusterRelocationFileType FileType = "ClusterRelocation"
+	// APICertSecretFileType files contain a JSON Secret with the API server certificate
+	APICertSecretFileType FileType = "APICertSecret"
+	// IngressCertSecretFileType files contain a JSON Secret with the ingress certificate
+	IngressCertSecretFileType FileType = "IngressCertSecret"
+	// PullSecretFileType files contain a JSON Secret with the cluster-wide pull secret
+	PullSecretFileType FileType = "PullSecret"
+	// ImageTagMirrorSetFileType files contain a JSON ImageTagMirrorSet with tag based mirror configuration
+	ImageTagMirrorSetFileType FileType = "ImageTagMirrorSet"
+	// AgentConfigFileType files contain a JSON ConfigMap with the agent-based installer configuration
+	// under the AgentConfigKey key
+	AgentConfigFileType FileType = "AgentConfig"
+	// ClusterNetworkFileType files contain a JSON ConfigMap with a JSON ClusterNetwork under the ClusterNetworkKey key
+	ClusterNetworkFileType FileType = "ClusterNetwork"
+	// LocalizationFileType files contain a JSON ConfigMap with a JSON Localization under the LocalizationKey key
+	LocalizationFileType FileType = "Localization"
+	// ImageContentSourcePolicyFileType files contain a JSON ImageContentSourcePolicy with the digest mirror
+	// configuration for clusters which don't support ImageDigestMirrorSets
+	ImageContentSourcePolicyFileType FileType = "ImageContentSourcePolicy"
+	// IgnitionConfigOverrideFileType files contain a JSON ConfigMap with an Ignition config under the
+	// IgnitionConfigOverrideKey key which is merged into the host's firstboot configuration
+	IgnitionConfigOverrideFileType FileType = "IgnitionConfigOverride"
+	// AdditionalTrustBundleFileType files contain a JSON ConfigMap with PEM encoded CA certificates under the
+	// AdditionalTrustBundleKey key which the relocated cluster adds to its trusted CAs
+	AdditionalTrustBundleFileType FileType = "AdditionalTrustBundle"
+	// DiskEncryptionFileType files contain a JSON ConfigMap with a JSON DiskEncryption under the DiskEncryptionKey key
+	DiskEncryptionFileType FileType = "DiskEncryption"
+	// NetworkConfigFileType files contain a JSON ConfigMap with an nmstate network configuration file under each key
+	NetworkConfigFileType FileType = "NetworkConfig"
+	// ExtraManifestsFileType files contain a JSON ConfigMap with a Kubernetes manifest under each key
+	// The relocation on the host doesn't read them, they're left for other tooling to apply
+	ExtraManifestsFileType FileType = "ExtraManifests"
+	// SecureBootCertsFileType files contain a JSON ConfigMap with an X.509 certificate under each key, PEM encoded
+	// in data or DER encoded in binaryData, which the host enrolls as Machine Owner Keys for custom-signed drivers
+	SecureBootCertsFileType FileType = "SecureBootCerts"
+	// PluginFileType files are added by rendering plugins on the hub. There may be several, each identified by its Path,
+	// and their content is site-specific
+	PluginFileType FileType = "Plugin"
+)
+
+// RegenerateClusterIdentityAnnotation is set to "true" on the ClusterRelocation when the on-host tooling should
+// generate new cluster and infrastructure IDs rather than keep those of the seed cluster
+const RegenerateClusterIdentityAnnotation = "relocation.openshift.io/regenerate-cluster-identity"
+
+// AgentConfigKey is the key of the agent-based installer configuration in AgentConfigFileType config maps
+const AgentConfigKey = "agent-config.yaml"
+
+// ClusterNetworkKey is the key of the ClusterNetwork in ClusterNetworkFileType config maps
+const ClusterNetworkKey = "cluster-network.json"
+
+// ClusterNetwork is the networking identity of a multi-node cluster used to rewrite its load balancer configuration
+type ClusterNetwork struct {
+	// APIVIPs are the virtual IPs of the API server, one per IP family
+	APIVIPs []string `json:"apiVIPs,omitempty"`
+	// IngressVIPs are the virtual IPs of the default ingress controller, one per IP family
+	IngressVIPs []string `json:"ingressVIPs,omitempty"`
+	// MachineNetworks are the CIDRs of the networks the cluster nodes are on
+	MachineNetworks []string `json:"machineNetworks,omitempty"`
+}
+
+// LocalizationKey is the key of the Localization in LocalizationFileType config maps
+const LocalizationKey = "localization.json"
+
+// Localization is the time zone and locale the relocated cluster's hosts are set to
+type Localization struct {
+	// Timezone is the IANA name of the time zone, empty if it should not be changed
+	Timezone string `json:"timezone,omitempty"`
+	// Locale is the system locale, empty if it should not be changed
+	Locale string `json:"locale,omitempty"`
+}
+
+// IgnitionConfigOverrideKey is the key of the Ignition config in IgnitionConfigOverrideFileType config maps
+const IgnitionConfigOverrideKey = "ignition-config-override.ign"
+
+// AdditionalTrustBundleKey is the key of the CA certificates in AdditionalTrustBundleFileType config maps
+// It matches the key used by the OpenShift trusted CA config maps
+const AdditionalTrustBundleKey = "ca-bundle.crt"
+
+// DiskEncryptionKey is the key of the DiskEncryption in DiskEncryptionFileType config maps
+const DiskEncryptionKey = "disk-encryption.json"
+
+// DiskEncryption is how the relocated host binds its LUKS encrypted disks after the move
+type DiskEncryption struct {
+	// Mode is either tpm2 or tang
+	Mode string `json:"mode"`
+	// TangServers are the servers the disks are bound to in tang mode
+	TangServers []TangServer `json:"tangServers,omitempty"`
+}
+
+// TangServer is a Tang server used to unlock encrypted disks
+type TangServer struct {
+	// URL is the address of the server
+	URL string `json:"url"`
+	// Thumbprint is the thumbprint of the server's signing key
+	Thumbprint string `json:"thumbprint"`
+}
+
+// fileNames is the path relative to the content root for each file type
+var fileNames = map[FileType]string{
+	ClusterRelocationFileType:        "cluster-relocation.json",
+	APICertSecretFileType:            "api-cert-secret.json",
+	IngressCertSecretFileType:        "ingress-cert-secret.json",
+	PullSecretFileType:               "pull-secret-secret.json",
+	ImageTagMirrorSetFileType:        "image-tag-mirror-set.json",
+	AgentConfigFileType:              "agent-config-configmap.json",
+	ClusterNetworkFileType:           "cluster-network-configmap.json",
+	LocalizationFileType:             "localization-configmap.json",
+	ImageContentSourcePolicyFileType: "image-content-source-policy.json",
+	IgnitionConfigOverrideFileType:   "ignition-config-override-configmap.json",
+	AdditionalTrustBundleFileType:    "additional-trust-bundle-configmap.json",
+	DiskEncryptionFileType:           "disk-encryption-configmap.json",
+	NetworkConfigFileType:            "network-config-configmap.json",
+	ExtraManifestsFileType:           "extra-manifests-configmap.json",
+	SecureBootCertsFileType:          "secure-boot-certs-configmap.json",
+}
+
+// FileName returns the path relative to the content root where files of the given type are stored
+func FileName(t FileType) string {
+	return fileNames[t]
+}
+
+// Manifest describes the content present on an ISO
+type Manifest struct {
+	// Version is the layout version used to write the content
+	Version string `json:"version"`
+
+	// Files lists the files present in the content
+	Files []File `json:"files"`
+
+	// Release is the release the seed image on the host must match, nil if the release isn't pinned
+	Release *Release `json:"release,omitempty"`
+
+	// VolumeLabel is the label of the ISO volume the content is served on, VolumeLabel if it is empty
+	VolumeLabel string `json:"volumeLabel,omitempty"`
+
+	// Metadata identifies the content when a host has several attached media with the same label
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Label returns the label of the ISO volume the content is served on
+func (m *Manifest) Label() string {
+	if m.VolumeLabel != "" {
+		return m.VolumeLabel
+	}
+	return VolumeLabel
+}
+
+// volume is the part of the manifest describing the ISO volume which is included in the content hash
+type volume struct {
+	Label    string            `json:"label,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Release pins the release the seed image must have been built from
+// The on-host agent calls Verify before reconfiguring the host
+type Release struct {
+	// Image is the release image pull spec by digest, empty if only the version is checked
+	Image string `json:"image,omitempty"`
+
+	// AllowedVersions are the release versions the seed may report, empty if any version is allowed
+	AllowedVersions []string `json:"allowedVersions,omitempty"`
+}
+
+// Verify returns an error if the seed release image or version doesn't match the pinned release
+func (r *Release) Verify(seedImage, seedVersion string) error {
+	if r == nil {
+		return nil
+	}
+	if r.Image != "" && !sameDigest(r.Image, seedImage) {
+		return fmt.Errorf("the seed release image %s doesn't match the expected release image %s", seedImage, r.Image)
+	}
+	if len(r.AllowedVersions) == 0 {
+		return nil
+	}
+	for _, v := range r.AllowedVersions {
+		if v == seedVersion {
+			return nil
+		}
+	}
+	return fmt.Errorf("the seed release version %s isn't one of the allowed versions %s", seedVersion, strings.Join(r.AllowedVersions, ", "))
+}
+
+// sameDigest compares the digests of two pull specs as mirrored releases are pulled from other repositories
+func sameDigest(a, b string) bool {
+	_, digestA, okA := strings.Cut(a, "@")
+	_, digestB, okB := strings.Cut(b, "@")
+	if !okA || !okB {
+		return a == b
+	}
+	return digestA == digestB
+}
+
+// BuildInfo records which service build rendered the content and the objects it was rendered from
+type BuildInfo struct {
+	// Version is the version of the service
+	Version string `json:"version"`
+
+	// GitCommit is the commit the service was built from, empty if it isn't known
+	GitCommit string `json:"gitCommit,omitempty"`
+
+	// BuildTime is when the content was rendered
+	BuildTime time.Time `json:"buildTime"`
+
+	// PayloadHash is the hash of the content described
+	PayloadHash string `json:"payloadHash"`
+
+	// Sources are the objects the content was rendered from
+	Sources []Source `json:"sources,omitempty"`
+}
+
+// Source identifies the version of an object content was rendered from
+type Source struct {
+	Kind            string `json:"kind"`
+	Namespace       string `json:"namespace"`
+	Name            string `json:"name"`
+	ResourceVersion string `json:"resourceVersion"`
+}
+
+// File describes a single file in the content
+type File struct {
+	// Type is the kind of content stored in the file
+	Type FileType `json:"type"`
+
+	// Path is the location of the file relative to the content root
+	Path string `json:"path"`
+
+	// Size is the size of the file in bytes
+	Size int64 `json:"size,omitempty"`
+
+	// Checksum is the hex encoded sha256 of the file content
+	Checksum string `json:"checksum,omitempty"`
+}
+
+// Lookup returns the file entry with the given type if it is present in the manifest
+func (m *Manifest) Lookup(t FileType) (File, bool) {
+	for _, f := range m.Files {
+		if f.Type == t {
+			return f, true
+		}
+	}
+	return File{}, false
+}
@@ -0,0 +1,323 @@
+package isoschema
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestISOSchema(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "ISO Schema Suite")
+}
+
+var _ = Describe("Writer and Reader", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "isoschema_test")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	It("round trips written objects", func() {
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "pull-secret", Namespace: "ns"},
+			Data:       map[string][]byte{".dockerconfigjson": []byte("{}")},
+		}
+
+		w := NewWriter(dir)
+		Expect(w.WriteObject(PullSecretFileType, secret)).To(Succeed())
+		Expect(w.WriteManifest()).To(Succeed())
+
+		r, err := NewReader(os.DirFS(dir))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Manifest().Version).To(Equal(CurrentVersion))
+		Expect(r.Manifest().Files).To(HaveLen(1))
+		Expect(r.Manifest().Files[0].Type).To(Equal(PullSecretFileType))
+		Expect(r.Manifest().Files[0].Path).To(Equal("pull-secret-secret.json"))
+		Expect(r.Manifest().Files[0].Size).To(BeNumerically(">", 0))
+		Expect(r.Manifest().Files[0].Checksum).To(HaveLen(64))
+		Expect(w.Size()).To(Equal(r.Manifest().Files[0].Size))
+
+		read := &corev1.Secret{}
+		found, err := r.ReadObject(PullSecretFileType, read)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found).To(BeTrue())
+		Expect(read.Data).To(Equal(secret.Data))
+
+		found, err = r.ReadObject(APICertSecretFileType, &corev1.Secret{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found).To(BeFalse())
+	})
+
+	It("replaces existing files instead of writing through hard links", func() {
+		path := filepath.Join(dir, FileName(PullSecretFileType))
+		Expect(os.WriteFile(path, []byte("{}"), 0644)).To(Succeed())
+		shared := filepath.Join(dir, "shared")
+		Expect(os.Link(path, shared)).To(Succeed())
+
+		w := NewWriter(dir)
+		Expect(w.WriteObject(PullSecretFileType, &corev1.Secret{})).To(Succeed())
+
+		content, err := os.ReadFile(shared)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(content)).To(Equal("{}"))
+		entries, err := os.ReadDir(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(2))
+	})
+
+	It("hashes the written content", func() {
+		write := func(data map[string][]byte) string {
+			w := NewWriter(dir)
+			Expect(w.WriteObject(PullSecretFileType, &corev1.Secret{Data: data})).To(Succeed())
+			Expect(w.WriteManifest()).To(Succeed())
+			return w.Hash()
+		}
+
+		first := write(map[string][]byte{"a": []byte("1")})
+		Expect(write(map[string][]byte{"a": []byte("1")})).To(Equal(first))
+		Expect(write(map[string][]byte{"a": []byte("2")})).NotTo(Equal(first))
+	})
+
+	It("does not rewrite unchanged files", func() {
+		write := func(data map[string][]byte) {
+			w := NewWriter(dir)
+			Expect(w.WriteObject(PullSecretFileType, &corev1.Secret{Data: data})).To(Succeed())
+			Expect(w.WriteManifest()).To(Succeed())
+		}
+		stat := func(name string) os.FileInfo {
+			info, err := os.Stat(filepath.Join(dir, name))
+			Expect(err).NotTo(HaveOccurred())
+			return info
+		}
+
+		write(map[string][]byte{"a": []byte("1")})
+		file := stat(FileName(PullSecretFileType))
+		manifest := stat(ManifestFileName)
+
+		write(map[string][]byte{"a": []byte("1")})
+		Expect(os.SameFile(file, stat(FileName(PullSecretFileType)))).To(BeTrue())
+		Expect(os.SameFile(manifest, stat(ManifestFileName))).To(BeTrue())
+
+		write(map[string][]byte{"a": []byte("2")})
+		Expect(os.SameFile(file, stat(FileName(PullSecretFileType)))).To(BeFalse())
+		Expect(os.SameFile(manifest, stat(ManifestFileName))).To(BeFalse())
+
+		// content missing from disk is written even if the manifest says it's unchanged
+		Expect(os.Remove(filepath.Join(dir, FileName(PullSecretFileType)))).To(Succeed())
+		write(map[string][]byte{"a": []byte("2")})
+		Expect(filepath.Join(dir, FileName(PullSecretFileType))).To(BeAnExistingFile())
+	})
+
+	It("removes files for unset content", func() {
+		path := filepath.Join(dir, FileName(APICertSecretFileType))
+		Expect(os.WriteFile(path, []byte("{}"), 0644)).To(Succeed())
+
+		w := NewWriter(dir)
+		Expect(w.Remove(APICertSecretFileType)).To(Succeed())
+		Expect(path).NotTo(BeAnExistingFile())
+		Expect(w.Remove(APICertSecretFileType)).To(Succeed())
+	})
+
+	It("writes files at arbitrary paths and removes them once they aren't written", func() {
+		w := NewWriter(dir)
+		Expect(w.WriteObject(PullSecretFileType, &corev1.Secret{})).To(Succeed())
+		Expect(w.WriteFile(PluginFileType, "site/motd", []byte("welcome"))).To(Succeed())
+		Expect(w.WriteManifest()).To(Succeed())
+		first := w.Hash()
+
+		data, err := os.ReadFile(filepath.Join(dir, "site", "motd"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(Equal("welcome"))
+		Expect(w.Files()).To(HaveLen(2))
+		Expect(w.Files()[1]).To(Equal(File{Type: PluginFileType, Path: "site/motd", Size: 7, Checksum: w.Files()[1].Checksum}))
+
+		// writing a path again replaces its entry
+		w = NewWriter(dir)
+		Expect(w.WriteObject(PullSecretFileType, &corev1.Secret{})).To(Succeed())
+		Expect(w.WriteFile(PullSecretFileType, FileName(PullSecretFileType), []byte("{}"))).To(Succeed())
+		Expect(w.WriteManifest()).To(Succeed())
+		Expect(w.Files()).To(HaveLen(1))
+		Expect(w.Files()[0].Size).To(Equal(int64(2)))
+		Expect(w.Hash()).NotTo(Equal(first))
+		Expect(filepath.Join(dir, "site", "motd")).NotTo(BeAnExistingFile())
+	})
+
+	It("rejects paths outside of the content", func() {
+		w := NewWriter(dir)
+		Expect(w.WriteFile(PluginFileType, "../escape", nil)).NotTo(Succeed())
+		Expect(w.WriteFile(PluginFileType, "/etc/passwd", nil)).NotTo(Succeed())
+		Expect(w.WriteFile(PluginFileType, ManifestFileName, nil)).NotTo(Succeed())
+		Expect(w.WriteFile(PluginFileType, BuildInfoFileName, nil)).NotTo(Succeed())
+	})
+
+	It("writes build info outside of the manifest and hash", func() {
+		info, err := ReadBuildInfo(os.DirFS(dir))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info).To(BeNil())
+
+		w := NewWriter(dir)
+		Expect(w.WriteObject(PullSecretFileType, &corev1.Secret{})).To(Succeed())
+		hash := w.Hash()
+		written := &BuildInfo{
+			Version:     "1.2.3",
+			BuildTime:   time.Date(2023, time.June, 1, 12, 0, 0, 0, time.UTC),
+			PayloadHash: hash,
+			Sources:     []Source{{Kind: "Secret", Namespace: "ns", Name: "pull", ResourceVersion: "42"}},
+		}
+		Expect(w.WriteBuildInfo(written)).To(Succeed())
+		Expect(w.WriteManifest()).To(Succeed())
+		Expect(w.Hash()).To(Equal(hash))
+		Expect(w.Files()).To(HaveLen(1))
+
+		info, err = ReadBuildInfo(os.DirFS(dir))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info).To(Equal(written))
+	})
+
+	It("records the pinned release in the manifest and hash", func() {
+		write := func(release *Release) string {
+			w := NewWriter(dir)
+			Expect(w.WriteObject(PullSecretFileType, &corev1.Secret{})).To(Succeed())
+			Expect(w.SetRelease(release)).To(Succeed())
+			Expect(w.WriteManifest()).To(Succeed())
+			return w.Hash()
+		}
+
+		unpinned := write(nil)
+		pinned := write(&Release{Image: "quay.io/openshift-release-dev/ocp-release@sha256:1234", AllowedVersions: []string{"4.14.3"}})
+		Expect(pinned).NotTo(Equal(unpinned))
+
+		r, err := NewReader(os.DirFS(dir))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Manifest().Release).To(Equal(&Release{Image: "quay.io/openshift-release-dev/ocp-release@sha256:1234", AllowedVersions: []string{"4.14.3"}}))
+	})
+
+	It("verifies written content and returns its hash", func() {
+		w := NewWriter(dir)
+		Expect(w.WriteObject(PullSecretFileType, &corev1.Secret{})).To(Succeed())
+		Expect(w.WriteFile(PluginFileType, "extra/data.txt", []byte("extra"))).To(Succeed())
+		Expect(w.SetRelease(&Release{AllowedVersions: []string{"4.14.3"}})).To(Succeed())
+		Expect(w.WriteManifest()).To(Succeed())
+
+		r, err := NewReader(os.DirFS(dir))
+		Expect(err).NotTo(HaveOccurred())
+		hash, err := r.Verify()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hash).To(Equal(w.Hash()))
+
+		Expect(os.WriteFile(filepath.Join(dir, "extra", "data.txt"), []byte("EXTRA"), 0644)).To(Succeed())
+		_, err = r.Verify()
+		Expect(err).To(MatchError(ContainSubstring("extra/data.txt has checksum")))
+
+		Expect(os.Remove(filepath.Join(dir, "extra", "data.txt"))).To(Succeed())
+		_, err = r.Verify()
+		Expect(err).To(MatchError(ContainSubstring("failed to read extra/data.txt")))
+	})
+
+	It("rejects unlisted files and symbolic links", func() {
+		w := NewWriter(dir)
+		Expect(w.WriteObject(PullSecretFileType, &corev1.Secret{})).To(Succeed())
+		Expect(w.WriteManifest()).To(Succeed())
+		r, err := NewReader(os.DirFS(dir))
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(os.WriteFile(filepath.Join(dir, "unlisted.txt"), []byte("extra"), 0644)).To(Succeed())
+		_, err = r.Verify()
+		Expect(err).To(MatchError(ContainSubstring("unlisted.txt is not listed")))
+		Expect(os.Remove(filepath.Join(dir, "unlisted.txt"))).To(Succeed())
+
+		Expect(os.Symlink("/etc/passwd", filepath.Join(dir, "link"))).To(Succeed())
+		_, err = r.Verify()
+		Expect(err).To(MatchError(ContainSubstring("link is not a regular file")))
+		Expect(os.Remove(filepath.Join(dir, "link"))).To(Succeed())
+
+		// a listed file replaced by a link is rejected too
+		path := filepath.Join(dir, FileName(PullSecretFileType))
+		Expect(os.Rename(path, filepath.Join(dir, "target.json"))).To(Succeed())
+		Expect(os.Symlink("target.json", path)).To(Succeed())
+		_, err = r.Verify()
+		Expect(err).To(MatchError(ContainSubstring(FileName(PullSecretFileType) + " is not a regular file")))
+	})
+
+	It("records the volume in the manifest and hash", func() {
+		write := func(label string, metadata map[string]string) string {
+			w := NewWriter(dir)
+			Expect(w.WriteObject(PullSecretFileType, &corev1.Secret{})).To(Succeed())
+			Expect(w.SetVolume(label, metadata)).To(Succeed())
+			Expect(w.WriteManifest()).To(Succeed())
+			return w.Hash()
+		}
+
+		defaultVolume := write("", nil)
+		r, err := NewReader(os.DirFS(dir))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Manifest().Label()).To(Equal(VolumeLabel))
+
+		custom := write("site-1-config", map[string]string{"site": "site-1"})
+		Expect(custom).NotTo(Equal(defaultVolume))
+		Expect(write("site-1-config", map[string]string{"site": "site-2"})).NotTo(Equal(custom))
+		Expect(write("site-1-config", map[string]string{"site": "site-1"})).To(Equal(custom))
+
+		r, err = NewReader(os.DirFS(dir))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Manifest().Label()).To(Equal("site-1-config"))
+		Expect(r.Manifest().Metadata).To(Equal(map[string]string{"site": "site-1"}))
+		hash, err := r.Verify()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hash).To(Equal(custom))
+
+		Expect(NewWriter(dir).SetVolume(strings.Repeat("a", MaxVolumeLabelLength+1), nil)).NotTo(Succeed())
+	})
+
+	It("rejects unknown file types", func() {
+		w := NewWriter(dir)
+		Expect(w.WriteObject(FileType("Unknown"), "thing")).NotTo(Succeed())
+	})
+
+	It("rejects unsupported versions", func() {
+		Expect(os.WriteFile(filepath.Join(dir, ManifestFileName), []byte(`{"version": "v100"}`), 0644)).To(Succeed())
+		_, err := NewReader(os.DirFS(dir))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("fails without a manifest", func() {
+		_, err := NewReader(os.DirFS(dir))
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("Release", func() {
+	release := &Release{
+		Image:           "quay.io/openshift-release-dev/ocp-release@sha256:1234",
+		AllowedVersions: []string{"4.14.3", "4.14.4"},
+	}
+
+	It("accepts a matching seed", func() {
+		Expect(release.Verify("quay.io/openshift-release-dev/ocp-release@sha256:1234", "4.14.4")).To(Succeed())
+		Expect(release.Verify("mirror.example.com/ocp/release@sha256:1234", "4.14.3")).To(Succeed())
+		Expect((*Release)(nil).Verify("quay.io/other@sha256:5678", "4.12.0")).To(Succeed())
+	})
+
+	It("rejects another release image", func() {
+		Expect(release.Verify("quay.io/openshift-release-dev/ocp-release@sha256:5678", "4.14.3")).To(MatchError(ContainSubstring("release image")))
+	})
+
+	It("rejects versions which aren't allowed", func() {
+		Expect(release.Verify("quay.io/openshift-release-dev/ocp-release@sha256:1234", "4.14.5")).To(MatchError(ContainSubstring("allowed versions")))
+		Expect((&Release{AllowedVersions: []string{"4.14.3"}}).Verify("quay.io/other@sha256:5678", "4.14.3")).To(Succeed())
+	})
+})
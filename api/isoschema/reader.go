@@ -0,0 +1,170 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package isoschema
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+)
+
+// Reader reads ISO content from a filesystem such as os.DirFS of the mounted ISO
+type Reader struct {
+	fsys     fs.FS
+	manifest *Manifest
+}
+
+// NewReader reads and validates the manifest in fsys
+func NewReader(fsys fs.FS) (*Reader, error) {
+	data, err := fs.ReadFile(fsys, ManifestFileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	m := &Manifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal manifest: %w", err)
+	}
+	if m.Version != V1 {
+		return nil, fmt.Errorf("unsupported content version %q", m.Version)
+	}
+
+	return &Reader{fsys: fsys, manifest: m}, nil
+}
+
+// Manifest returns the manifest describing the content
+func (r *Reader) Manifest() *Manifest {
+	return r.manifest
+}
+
+// ReadObject unmarshals the file of the given type into obj
+// It returns false if the content does not contain a file of that type
+func (r *Reader) ReadObject(t FileType, obj interface{}) (bool, error) {
+	data, found, err := r.ReadFile(t)
+	if err != nil || !found {
+		return false, err
+	}
+	if err := json.Unmarshal(data, obj); err != nil {
+		return false, fmt.Errorf("failed to unmarshal %s: %w", t, err)
+	}
+
+	return true, nil
+}
+
+// ReadFile returns the raw content of the file of the given type
+// It returns false if the content does not contain a file of that type
+func (r *Reader) ReadFile(t FileType) ([]byte, bool, error) {
+	f, ok := r.manifest.Lookup(t)
+	if !ok {
+		return nil, false, nil
+	}
+
+	data, err := fs.ReadFile(r.fsys, f.Path)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read %s: %w", t, err)
+	}
+	return data, true, nil
+}
+
+// Verify checks every file in the manifest is present with the recorded size and checksum, and that the content
+// has no other files and nothing but regular files and directories, so nothing unverified ends up in the image
+// It returns the hash of the content, which matches the Writer hash of content written in manifest order
+func (r *Reader) Verify() (string, error) {
+	if err := r.verifyEntries(); err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	for _, f := range r.manifest.Files {
+		if !fs.ValidPath(f.Path) || f.Path == ManifestFileName || f.Path == BuildInfoFileName {
+			return "", fmt.Errorf("invalid file path %q", f.Path)
+		}
+		data, err := fs.ReadFile(r.fsys, f.Path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", f.Path, err)
+		}
+		if int64(len(data)) != f.Size {
+			return "", fmt.Errorf("%s is %d bytes but the manifest records %d", f.Path, len(data), f.Size)
+		}
+		sum := sha256.Sum256(data)
+		if checksum := hex.EncodeToString(sum[:]); checksum != f.Checksum {
+			return "", fmt.Errorf("%s has checksum %s but the manifest records %q", f.Path, checksum, f.Checksum)
+		}
+		fmt.Fprintf(h, "%s\n%d\n", f.Path, len(data))
+		h.Write(data)
+	}
+	if r.manifest.Release != nil {
+		data, err := json.Marshal(r.manifest.Release)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal release: %w", err)
+		}
+		fmt.Fprintf(h, "release\n%d\n", len(data))
+		h.Write(data)
+	}
+	if r.manifest.VolumeLabel != "" || len(r.manifest.Metadata) > 0 {
+		data, err := json.Marshal(volume{Label: r.manifest.VolumeLabel, Metadata: r.manifest.Metadata})
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal volume: %w", err)
+		}
+		fmt.Fprintf(h, "volume\n%d\n", len(data))
+		h.Write(data)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// verifyEntries checks every entry of the content is a directory or a regular file listed in the manifest
+// Symbolic links are rejected as they could point outside of the content
+func (r *Reader) verifyEntries() error {
+	listed := map[string]bool{ManifestFileName: true, BuildInfoFileName: true}
+	for _, f := range r.manifest.Files {
+		listed[f.Path] = true
+	}
+	return fs.WalkDir(r.fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return fmt.Errorf("%s is not a regular file", path)
+		}
+		if !listed[path] {
+			return fmt.Errorf("%s is not listed in the manifest", path)
+		}
+		return nil
+	})
+}
+
+// ReadBuildInfo returns the build info of the content
+// It returns nil if the content was written without it
+func ReadBuildInfo(fsys fs.FS) (*BuildInfo, error) {
+	data, err := fs.ReadFile(fsys, BuildInfoFileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read build info: %w", err)
+	}
+	info := &BuildInfo{}
+	if err := json.Unmarshal(data, info); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal build info: %w", err)
+	}
+	return info, nil
+}
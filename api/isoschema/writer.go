@@ -0,0 +1,311 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package isoschema
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Files replaces and removes files in a content directory by slash separated paths relative to it
+// Files must be replaced rather than written through so content shared with hard links is never modified
+type Files interface {
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+	Remove(name string) error
+	ReadFile(name string) ([]byte, error)
+}
+
+// dirFiles changes the files in a directory directly
+type dirFiles string
+
+func (d dirFiles) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	path := filepath.Join(string(d), filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func (d dirFiles) Remove(name string) error {
+	return os.Remove(filepath.Join(string(d), filepath.FromSlash(name)))
+}
+
+func (d dirFiles) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(string(d), filepath.FromSlash(name)))
+}
+
+// Writer writes ISO content to a directory
+// WriteManifest must be called once all files are written
+// Files with the same content as the previous manifest in the directory are not rewritten
+type Writer struct {
+	dir      string
+	files    Files
+	manifest Manifest
+	hash     hash.Hash
+	previous map[string]string
+}
+
+// NewWriter returns a writer for content rooted at dir
+func NewWriter(dir string) *Writer {
+	return NewWriterTo(dir, dirFiles(dir))
+}
+
+// NewWriterTo returns a writer for content rooted at dir which makes its changes with files, for example
+// to apply them together. The existing content is still read from dir
+func NewWriterTo(dir string, files Files) *Writer {
+	return &Writer{
+		dir:      dir,
+		files:    files,
+		manifest: Manifest{Version: CurrentVersion},
+		hash:     sha256.New(),
+		previous: previousChecksums(dir),
+	}
+}
+
+// previousChecksums returns the checksum of each file in the existing manifest in dir by path
+// Any problem reading the manifest results in all files being rewritten
+func previousChecksums(dir string) map[string]string {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFileName))
+	if err != nil {
+		return nil
+	}
+	m := &Manifest{}
+	if err := json.Unmarshal(data, m); err != nil || m.Version != CurrentVersion {
+		return nil
+	}
+	sums := make(map[string]string, len(m.Files))
+	for _, f := range m.Files {
+		if f.Checksum != "" {
+			sums[f.Path] = f.Checksum
+		}
+	}
+	return sums
+}
+
+// WriteObject marshals obj as JSON into the file for the given type and records it in the manifest
+func (w *Writer) WriteObject(t FileType, obj interface{}) error {
+	name := FileName(t)
+	if name == "" {
+		return fmt.Errorf("unknown file type %s", t)
+	}
+
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", t, err)
+	}
+	sum := sha256.Sum256(data)
+	checksum := hex.EncodeToString(sum[:])
+	if !w.unchanged(name, checksum, int64(len(data))) {
+		if err := w.writeFile(name, data); err != nil {
+			return fmt.Errorf("failed to write %s: %w", t, err)
+		}
+	}
+
+	w.manifest.Files = append(w.manifest.Files, File{Type: t, Path: name, Size: int64(len(data)), Checksum: checksum})
+	fmt.Fprintf(w.hash, "%s\n%d\n", name, len(data))
+	w.hash.Write(data)
+	return nil
+}
+
+// WriteFile writes data to path relative to the content root and records it in the manifest with the given type
+// It is used for content without a fixed file name, an existing manifest entry for path is replaced
+func (w *Writer) WriteFile(t FileType, path string, data []byte) error {
+	if !fs.ValidPath(path) || path == "." || path == ManifestFileName || path == BuildInfoFileName {
+		return fmt.Errorf("invalid file path %q", path)
+	}
+
+	sum := sha256.Sum256(data)
+	checksum := hex.EncodeToString(sum[:])
+	if !w.unchanged(path, checksum, int64(len(data))) {
+		if err := w.writeFile(path, data); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+	}
+
+	entry := File{Type: t, Path: path, Size: int64(len(data)), Checksum: checksum}
+	replaced := false
+	for i := range w.manifest.Files {
+		if w.manifest.Files[i].Path == path {
+			w.manifest.Files[i] = entry
+			replaced = true
+		}
+	}
+	if !replaced {
+		w.manifest.Files = append(w.manifest.Files, entry)
+	}
+	fmt.Fprintf(w.hash, "%s\n%d\n", path, len(data))
+	w.hash.Write(data)
+	return nil
+}
+
+// WriteBuildInfo writes info to the BuildInfoFileName
+// It isn't recorded in the manifest or hash so a new build time alone doesn't change the content
+func (w *Writer) WriteBuildInfo(info *BuildInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return fmt.Errorf("failed to marshal build info: %w", err)
+	}
+	if err := w.writeFile(BuildInfoFileName, data); err != nil {
+		return fmt.Errorf("failed to write build info: %w", err)
+	}
+	return nil
+}
+
+// SetRelease records the pinned release in the manifest, nil leaves the release unpinned
+func (w *Writer) SetRelease(release *Release) error {
+	w.manifest.Release = release
+	if release == nil {
+		return nil
+	}
+	data, err := json.Marshal(release)
+	if err != nil {
+		return fmt.Errorf("failed to marshal release: %w", err)
+	}
+	fmt.Fprintf(w.hash, "release\n%d\n", len(data))
+	w.hash.Write(data)
+	return nil
+}
+
+// SetVolume records the ISO volume label and metadata in the manifest and hash
+// An empty label serves the content on the default VolumeLabel
+func (w *Writer) SetVolume(label string, metadata map[string]string) error {
+	if len(label) > MaxVolumeLabelLength {
+		return fmt.Errorf("volume label %q is longer than %d characters", label, MaxVolumeLabelLength)
+	}
+	w.manifest.VolumeLabel = label
+	w.manifest.Metadata = metadata
+	if label == "" && len(metadata) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(volume{Label: label, Metadata: metadata})
+	if err != nil {
+		return fmt.Errorf("failed to marshal volume: %w", err)
+	}
+	fmt.Fprintf(w.hash, "volume\n%d\n", len(data))
+	w.hash.Write(data)
+	return nil
+}
+
+// Remove deletes any existing file for the given type so stale content is not left behind
+func (w *Writer) Remove(t FileType) error {
+	name := FileName(t)
+	if name == "" {
+		return fmt.Errorf("unknown file type %s", t)
+	}
+	if err := w.files.Remove(name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// WriteManifest writes the manifest describing all files written so far
+// Files in the previous manifest which weren't written again are removed
+func (w *Writer) WriteManifest() error {
+	data, err := json.Marshal(w.manifest)
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	if err := w.removeStale(); err != nil {
+		return err
+	}
+	if existing, err := os.ReadFile(filepath.Join(w.dir, ManifestFileName)); err == nil && bytes.Equal(existing, data) {
+		return nil
+	}
+	if err := w.writeFile(ManifestFileName, data); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+// Files returns the entries for all files written so far
+func (w *Writer) Files() []File {
+	return w.manifest.Files
+}
+
+// Size returns the total size in bytes of all files written so far
+func (w *Writer) Size() int64 {
+	var size int64
+	for _, f := range w.manifest.Files {
+		size += f.Size
+	}
+	return size
+}
+
+// Hash returns a hash of all the content written so far which changes whenever the content does
+func (w *Writer) Hash() string {
+	return hex.EncodeToString(w.hash.Sum(nil))
+}
+
+// removeStale deletes the files of the previous manifest which aren't in the current one
+func (w *Writer) removeStale() error {
+	current := make(map[string]bool, len(w.manifest.Files))
+	for _, f := range w.manifest.Files {
+		current[f.Path] = true
+	}
+	for path := range w.previous {
+		if current[path] || !fs.ValidPath(path) || path == ManifestFileName {
+			continue
+		}
+		if err := w.files.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// unchanged returns true if the file at name was written with the same content previously and is still present
+func (w *Writer) unchanged(name, checksum string, size int64) bool {
+	if w.previous[name] != checksum {
+		return false
+	}
+	info, err := os.Stat(filepath.Join(w.dir, name))
+	return err == nil && info.Mode().IsRegular() && info.Size() == size
+}
+
+// ReadFile returns the content written to path relative to the content root
+func (w *Writer) ReadFile(path string) ([]byte, error) {
+	return w.files.ReadFile(path)
+}
+
+// writeFile replaces the file at name
+func (w *Writer) writeFile(name string, data []byte) error {
+	return w.files.WriteFile(name, data, 0644)
+}
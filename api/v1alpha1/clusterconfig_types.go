@@ -18,11 +18,21 @@ package v1alpha1
 
 import (
 	cro "github.com/RHsyseng/cluster-relocation-operator/api/v1beta1"
+	bmh_v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	configv1 "github.com/openshift/api/config/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // ClusterConfigSpec defines the desired state of ClusterConfig
+// +kubebuilder:validation:XValidation:rule="!has(self.domain) || size(self.domain) == 0 || (size(self.domain) <= 245 && self.domain.matches('^[a-z0-9]([-a-z0-9]*[a-z0-9])?([.][a-z0-9]([-a-z0-9]*[a-z0-9])?)*$'))",message="domain must be a lower case DNS name of at most 245 characters"
+// +kubebuilder:validation:XValidation:rule="!has(self.additionalPullSecretRefs) || size(self.additionalPullSecretRefs) == 0 || has(self.pullSecretRef)",message="pullSecretRef must be set when additionalPullSecretRefs is set"
+// +kubebuilder:validation:XValidation:rule="!has(self.adoptExistingData) || !self.adoptExistingData || !has(self.externalImageURL) || size(self.externalImageURL) == 0",message="adoptExistingData can't be set when externalImageURL is set"
+// +kubebuilder:validation:XValidation:rule="!has(self.imageTagMirrors) || size(self.imageTagMirrors) == 0 || !has(self.mirrorOutput) || self.mirrorOutput != 'ImageContentSourcePolicy'",message="imageTagMirrors can't be used with the ImageContentSourcePolicy mirror output"
+// +kubebuilder:validation:XValidation:rule="has(self.bareMetalHostRef) || (!has(self.preflight) && !has(self.hardwareRequirements) && (!has(self.interfaceNamesFromHost) || !self.interfaceNamesFromHost))",message="bareMetalHostRef must be set when preflight, hardwareRequirements or interfaceNamesFromHost is set"
+// +kubebuilder:validation:XValidation:rule="!has(self.bareMetalHostRef) || !has(self.bareMetalHostRef.diskFormat) || self.bareMetalHostRef.diskFormat == 'live-iso' || (has(self.externalImageURL) && size(self.externalImageURL) > 0)",message="bareMetalHostRef.diskFormat must be live-iso unless externalImageURL is set"
 type ClusterConfigSpec struct {
 	cro.ClusterRelocationSpec `json:",inline"`
 
@@ -33,21 +43,943 @@ type ClusterConfigSpec struct {
 	// NetworkConfigRef is the reference to a config map containing network configuration files if necessary
 	// +optional
 	NetworkConfigRef *corev1.LocalObjectReference `json:"networkConfigRef,omitempty"`
+
+	// InterfaceNamesFromHost sets the name of each interface in the network config which has a mac-address but no
+	// name to the name of the NIC with that MAC address found when the BareMetalHost was inspected
+	// +optional
+	InterfaceNamesFromHost bool `json:"interfaceNamesFromHost,omitempty"`
+
+	// ExtraManifestsRef is the reference to a config map containing a Kubernetes manifest under each key which is
+	// written to the image. The relocation on the host doesn't apply them, they're left for other tooling to apply
+	// +optional
+	ExtraManifestsRef *corev1.LocalObjectReference `json:"extraManifestsRef,omitempty"`
+
+	// AdditionalPullSecretRefs reference secrets with .dockerconfigjson keys which are merged into the secret
+	// referenced by PullSecretRef when the configuration is rendered. Credentials for a registry in a later secret
+	// replace those for the same registry in the pull secret and earlier secrets
+	// +optional
+	AdditionalPullSecretRefs []corev1.SecretReference `json:"additionalPullSecretRefs,omitempty"`
+
+	// AdditionalTrustBundleRef is the reference to a config map in the ClusterConfig namespace containing PEM encoded
+	// CA certificates under the ca-bundle.crt key which the relocated cluster adds to its trusted CAs
+	// +optional
+	AdditionalTrustBundleRef *corev1.LocalObjectReference `json:"additionalTrustBundleRef,omitempty"`
+
+	// SecureBootCertsRef is the reference to a config map in the ClusterConfig namespace containing an X.509
+	// certificate under each key, PEM encoded in data or DER encoded in binaryData, which the relocated host enrolls
+	// as Machine Owner Keys so drivers signed with them load with secure boot enabled
+	// +optional
+	SecureBootCertsRef *corev1.LocalObjectReference `json:"secureBootCertsRef,omitempty"`
+
+	// AgentConfigRef is the reference to a config map in the ClusterConfig namespace containing an agent-config.yaml
+	// for installing additional nodes with the agent-based installer
+	// +optional
+	AgentConfigRef *corev1.LocalObjectReference `json:"agentConfigRef,omitempty"`
+
+	// ImageTagMirrors is used to configure tag based mirroring on the cluster
+	// +optional
+	ImageTagMirrors []configv1.ImageTagMirrors `json:"imageTagMirrors,omitempty"`
+
+	// RepositoryDigestMirrors holds legacy ImageContentSourcePolicy style mirror configuration.
+	// These are converted and added to ImageDigestMirrors when the configuration is rendered
+	// +optional
+	RepositoryDigestMirrors []RepositoryDigestMirrors `json:"repositoryDigestMirrors,omitempty"`
+
+	// TargetVersion is the OpenShift version of the relocated cluster in major.minor form, for example 4.12.
+	// It selects the kind of resource digest mirrors are rendered as when MirrorOutput is not set
+	// +kubebuilder:validation:Pattern=`^[0-9]+\.[0-9]+$`
+	// +optional
+	TargetVersion string `json:"targetVersion,omitempty"`
+
+	// ReleaseImage is the pull spec, by digest, of the release the seed image on the host must have been built from.
+	// It is recorded in the payload manifest so the on-host agent refuses to reconfigure a host booted from another release
+	// +kubebuilder:validation:Pattern=`^[^@\s]+@sha256:[a-f0-9]{64}$`
+	// +optional
+	ReleaseImage string `json:"releaseImage,omitempty"`
+
+	// AllowedReleaseVersions are the release versions, for example 4.14.3, the seed image may report.
+	// Any version is allowed if it is empty
+	// +optional
+	AllowedReleaseVersions []string `json:"allowedReleaseVersions,omitempty"`
+
+	// MirrorOutput is the kind of resource digest mirrors are rendered as. It defaults to ImageContentSourcePolicy
+	// for TargetVersions before 4.13, which don't support ImageDigestMirrorSets, and ImageDigestMirrorSet otherwise.
+	// Both renders the mirrors as each kind so they are applied whichever version the relocated cluster runs
+	// +kubebuilder:validation:Enum=ImageDigestMirrorSet;ImageContentSourcePolicy;Both
+	// +optional
+	MirrorOutput MirrorOutput `json:"mirrorOutput,omitempty"`
+
+	// CleanupPolicy determines what happens once the relocated cluster reports success
+	// +kubebuilder:validation:Enum=None;DetachImage;DeleteClusterConfig
+	// +kubebuilder:default=None
+	// +optional
+	CleanupPolicy CleanupPolicy `json:"cleanupPolicy,omitempty"`
+
+	// ReattachOnChange adds a version derived from the rendered configuration to the image URL
+	// so the virtual media is re-attached to the BareMetalHost whenever the configuration changes
+	// +optional
+	ReattachOnChange bool `json:"reattachOnChange,omitempty"`
+
+	// AllowInsecureImageURL allows pull secrets and certificate keys to be embedded in an image served over plain
+	// HTTP. Without it the configuration isn't rendered unless the image URL uses HTTPS
+	// +optional
+	AllowInsecureImageURL bool `json:"allowInsecureImageURL,omitempty"`
+
+	// RebootMode is how the BareMetalHost is rebooted when the configuration changes after the image was first
+	// attached, none leaves it running until it restarts. Defaults to none
+	// +kubebuilder:validation:Enum=hard;soft;none
+	// +optional
+	RebootMode RebootMode `json:"rebootMode,omitempty"`
+
+	// MaintenanceWindow restricts when the image is attached to the BareMetalHost.
+	// The image is rendered and served at any time, but the host is only modified while the window is open
+	// +optional
+	MaintenanceWindow *MaintenanceWindow `json:"maintenanceWindow,omitempty"`
+
+	// Network is the networking identity of a compact or multi-node cluster.
+	// It is used to rewrite the load balancer configuration which SNO clusters don't use
+	// +optional
+	Network *ClusterNetwork `json:"network,omitempty"`
+
+	// Timezone is the IANA name of the time zone the relocated cluster's hosts are set to, for example America/Chicago.
+	// Hosts keep their existing time zone if this is not set
+	// +optional
+	Timezone string `json:"timezone,omitempty"`
+
+	// Locale is the system locale the relocated cluster's hosts are set to, for example en_US.UTF-8.
+	// Hosts keep their existing locale if this is not set
+	// +kubebuilder:validation:Pattern=`^(C|POSIX|[a-zA-Z]{2,3}(_[a-zA-Z]{2})?)(\.[a-zA-Z0-9-]+)?(@[a-zA-Z0-9]+)?$`
+	// +optional
+	Locale string `json:"locale,omitempty"`
+
+	// IgnitionConfigOverride is a JSON Ignition config of version 3.x merged into the relocated host's firstboot
+	// configuration to add systemd units, files or kernel arguments without building a custom base image
+	// +optional
+	IgnitionConfigOverride string `json:"ignitionConfigOverride,omitempty"`
+
+	// DiskEncryption configures how the relocated host binds its LUKS encrypted disks after the move,
+	// to the local TPM or to Tang servers at the new site. Disk encryption is left unchanged if it is not set
+	// +optional
+	DiskEncryption *DiskEncryption `json:"diskEncryption,omitempty"`
+
+	// RegenerateClusterIdentity requests new cluster and infrastructure IDs for the relocated cluster instead of
+	// keeping those of the seed. This is needed when one seed image is relocated to many sites which must be
+	// distinct in ACM and telemetry
+	// +optional
+	RegenerateClusterIdentity bool `json:"regenerateClusterIdentity,omitempty"`
+
+	// Preflight enables checks of the BareMetalHost and referenced configuration before the image is attached.
+	// No checks are run if it is not set
+	// +optional
+	Preflight *PreflightChecks `json:"preflight,omitempty"`
+
+	// HardwareRequirements is the minimum hardware the BareMetalHost must have to run the relocated cluster.
+	// The image is not attached while the inspected hardware is below it, even if preflight checks are skipped
+	// +optional
+	HardwareRequirements *HardwareRequirements `json:"hardwareRequirements,omitempty"`
+
+	// ExternalImageURL is the URL of an image built outside of the service. When it is set the configuration is not
+	// rendered and no image is served, the URL is attached to the BareMetalHost and only its status is managed
+	// +optional
+	ExternalImageURL string `json:"externalImageURL,omitempty"`
+
+	// AdoptExistingData serves the payload already present in the ClusterConfig data directory, such as one rendered
+	// in a lab and copied to the hub, rather than rendering the configuration. The files must match the checksums in
+	// the payload manifest
+	// +optional
+	AdoptExistingData bool `json:"adoptExistingData,omitempty"`
+
+	// ImageVolume customizes the ISO volume the configuration is served on
+	// +optional
+	ImageVolume *ImageVolume `json:"imageVolume,omitempty"`
+
+	// MaxRetries is the number of times the image is attached again after the BareMetalHost reports a
+	// provisioning or inspection error. The ClusterConfig fails once they are used up, and host errors are
+	// not retried if it is not set. Changing the spec resets the retries
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxRetries *int32 `json:"maxRetries,omitempty"`
+
+	// CertRenewalWindow holds the image back from the BareMetalHost while the API or ingress certificate expires
+	// within the given duration, so hosts aren't relocated with certificates that are about to expire.
+	// The image is attached again with RebootMode once renewed certificates are rendered.
+	// Certificate expiry is still recorded in the status if it is not set
+	// +optional
+	CertRenewalWindow *metav1.Duration `json:"certRenewalWindow,omitempty"`
+
+	// CertWarningWindow reports certificates which expire within the given duration in the ConfigurationWarnings
+	// condition without holding the image back. It defaults to 30 days, zero only reports expired certificates
+	// +optional
+	CertWarningWindow *metav1.Duration `json:"certWarningWindow,omitempty"`
+
+	// MinRebuildInterval is the shortest time between changes to the rendered configuration, which each rebuild
+	// the image. Changes made sooner are rendered together once the interval has passed. Setting the
+	// relocation.openshift.io/force-rebuild annotation renders the configuration immediately
+	// +optional
+	MinRebuildInterval *metav1.Duration `json:"minRebuildInterval,omitempty"`
+
+	// PostCompletionHooks are Jobs created in the ClusterConfig namespace once the relocation reports success,
+	// for example to update an inventory or notify a ticketing system. Each hook is only run once
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	PostCompletionHooks []CompletionHook `json:"postCompletionHooks,omitempty"`
+}
+
+// CompletionHook is a Job run on the hub once the relocation completes
+type CompletionHook struct {
+	// Name identifies the hook. The Job is named <ClusterConfig name>-<hook name>
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	Name string `json:"name"`
+
+	// Template is the Job to create. CLUSTER_CONFIG_NAME and CLUSTER_CONFIG_NAMESPACE are added to the
+	// environment of each container. The Job isn't owned by the ClusterConfig so it isn't removed with it,
+	// set ttlSecondsAfterFinished to clean it up. Its pods run as the relocation-completion-hook service account
+	// and can't be privileged or use host namespaces or paths
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:validation:Type=object
+	// +kubebuilder:pruning:PreserveUnknownFields
+	Template batchv1.JobTemplateSpec `json:"template"`
+}
+
+// HardwareRequirements is compared with the inspected BareMetalHost hardware, unset fields are not checked
+type HardwareRequirements struct {
+	// MinDiskSize is the smallest root disk the host may have
+	// The root disk is the one named by the device name hint, or the largest disk if there isn't one
+	// +optional
+	MinDiskSize *resource.Quantity `json:"minDiskSize,omitempty"`
+
+	// MinMemory is the least memory the host may have
+	// +optional
+	MinMemory *resource.Quantity `json:"minMemory,omitempty"`
+
+	// MinNICs is the least number of network interfaces the host may have
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MinNICs int `json:"minNICs,omitempty"`
+}
+
+// PreflightChecks configures the checks run before the image is attached
+type PreflightChecks struct {
+	// MinDiskSize is the smallest root disk the host may have. The disk size is not checked if it is not set
+	// Deprecated: set HardwareRequirements.MinDiskSize instead, which checks the same disk but can't be skipped
+	// +optional
+	MinDiskSize *resource.Quantity `json:"minDiskSize,omitempty"`
+
+	// Skip attaches the image even if checks fail. The results are still recorded in the status
+	// +optional
+	Skip bool `json:"skip,omitempty"`
 }
 
+// ClusterNetwork holds the virtual IPs and machine networks of a relocated cluster
+type ClusterNetwork struct {
+	// APIVIPs are the virtual IPs of the API server, one per IP family
+	// +kubebuilder:validation:MaxItems=2
+	// +optional
+	APIVIPs []string `json:"apiVIPs,omitempty"`
+
+	// IngressVIPs are the virtual IPs of the default ingress controller, one per IP family
+	// +kubebuilder:validation:MaxItems=2
+	// +optional
+	IngressVIPs []string `json:"ingressVIPs,omitempty"`
+
+	// MachineNetworks are the CIDRs of the networks the cluster nodes are on
+	// +optional
+	MachineNetworks []string `json:"machineNetworks,omitempty"`
+}
+
+// DiskEncryption configures the clevis binding of the relocated host's encrypted disks
+// +kubebuilder:validation:XValidation:rule="self.mode == 'tang' ? has(self.tangServers) && size(self.tangServers) > 0 : !has(self.tangServers) || size(self.tangServers) == 0",message="tangServers are required in tang mode and can only be set in tang mode"
+type DiskEncryption struct {
+	// Mode is how the disks are unlocked, tpm2 binds them to the host's TPM and tang to the TangServers
+	// +kubebuilder:validation:Enum=tpm2;tang
+	Mode DiskEncryptionMode `json:"mode"`
+
+	// TangServers are the servers the disks are bound to, they are required in tang mode
+	// +optional
+	TangServers []TangServer `json:"tangServers,omitempty"`
+}
+
+// TangServer is a Tang server used to unlock encrypted disks
+type TangServer struct {
+	// URL is the address of the server, for example http://tang.example.com:7500
+	URL string `json:"url"`
+
+	// Thumbprint is the thumbprint of the server's signing key, as printed by tang-show-keys
+	Thumbprint string `json:"thumbprint"`
+}
+
+// DiskEncryptionMode is the way encrypted disks are unlocked
+type DiskEncryptionMode string
+
+const (
+	// DiskEncryptionModeTPM2 binds the disks to the host's TPM
+	DiskEncryptionModeTPM2 DiskEncryptionMode = "tpm2"
+	// DiskEncryptionModeTang binds the disks to Tang servers
+	DiskEncryptionModeTang DiskEncryptionMode = "tang"
+)
+
+// MaintenanceWindow is a recurring period of time during which a host may be provisioned
+type MaintenanceWindow struct {
+	// Start is the time of day the window opens in 24 hour HH:MM format
+	// +kubebuilder:validation:Pattern=`^([01][0-9]|2[0-3]):[0-5][0-9]$`
+	Start string `json:"start"`
+
+	// Duration is how long the window stays open once it starts
+	Duration metav1.Duration `json:"duration"`
+
+	// Days limits the window to start on the given days of the week, defaulting to every day
+	// +optional
+	Days []Weekday `json:"days,omitempty"`
+
+	// TimeZone is the IANA name of the time zone Start is in, defaulting to UTC
+	// +optional
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+// Weekday is a day of the week
+// +kubebuilder:validation:Enum=Sunday;Monday;Tuesday;Wednesday;Thursday;Friday;Saturday
+type Weekday string
+
+// RebootMode is the way the BareMetalHost is rebooted
+type RebootMode string
+
+const (
+	// RebootModeHard power cycles the host
+	RebootModeHard RebootMode = "hard"
+	// RebootModeSoft requests a graceful shutdown before powering the host back on
+	RebootModeSoft RebootMode = "soft"
+	// RebootModeNone doesn't reboot the host
+	RebootModeNone RebootMode = "none"
+)
+
+// LiveISODiskFormat is the disk format of the images built by the service
+const LiveISODiskFormat = "live-iso"
+
+// MirrorOutput is the kind of resource digest mirrors are rendered as
+type MirrorOutput string
+
+const (
+	// MirrorOutputImageDigestMirrorSet adds the mirrors to the ClusterRelocation which creates an ImageDigestMirrorSet
+	MirrorOutputImageDigestMirrorSet MirrorOutput = "ImageDigestMirrorSet"
+	// MirrorOutputImageContentSourcePolicy renders the mirrors as an ImageContentSourcePolicy
+	MirrorOutputImageContentSourcePolicy MirrorOutput = "ImageContentSourcePolicy"
+	// MirrorOutputBoth renders the mirrors as both kinds
+	MirrorOutputBoth MirrorOutput = "Both"
+)
+
+// CleanupPolicy describes the action taken once a relocation completes
+type CleanupPolicy string
+
+const (
+	// CleanupPolicyNone leaves the image attached and all data in place
+	CleanupPolicyNone CleanupPolicy = "None"
+	// CleanupPolicyDetachImage removes the image from the BareMetalHost and removes the rendered data
+	CleanupPolicyDetachImage CleanupPolicy = "DetachImage"
+	// CleanupPolicyDeleteClusterConfig deletes the ClusterConfig which also removes the rendered data
+	CleanupPolicyDeleteClusterConfig CleanupPolicy = "DeleteClusterConfig"
+)
+
 // ClusterConfigStatus defines the observed state of ClusterConfig
 type ClusterConfigStatus struct {
+	// Conditions represent the latest available observations of the ClusterConfig's state
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// Phase is a high level summary of where the ClusterConfig is in the relocation process
+	// +optional
+	Phase ClusterConfigPhase `json:"phase,omitempty"`
+
+	// PhaseTransitionTime is the last time the phase changed
+	// +optional
+	PhaseTransitionTime *metav1.Time `json:"phaseTransitionTime,omitempty"`
+
+	// PayloadHash is a hash of the rendered configuration, it changes whenever the image content does
+	// +optional
+	PayloadHash string `json:"payloadHash,omitempty"`
+
+	// ImageURL is the URL the configuration image is served from
+	// +optional
+	ImageURL string `json:"imageURL,omitempty"`
+
+	// CachedImageURL is the URL of the image in the cache of the ClusterConfig zone, set when the zone has a cache
+	// The BareMetalHost downloads the image from it rather than from ImageURL
+	// +optional
+	CachedImageURL string `json:"cachedImageURL,omitempty"`
+
+	// AdminKubeconfigRef references a secret in the ClusterConfig namespace containing the relocated cluster's
+	// admin kubeconfig under the kubeconfig key. It is set through the status subresource once the cluster reports it.
+	// +optional
+	AdminKubeconfigRef *corev1.LocalObjectReference `json:"adminKubeconfigRef,omitempty"`
+
+	// Attempts records the most recent times the image was attached to the BareMetalHost, oldest first
+	// +optional
+	Attempts []RelocationAttempt `json:"attempts,omitempty"`
+
+	// PayloadDiff describes how the most recently rendered payload differs from the one served before it
+	// +optional
+	PayloadDiff *PayloadDiff `json:"payloadDiff,omitempty"`
+
+	// Preflight holds the results of the most recent preflight checks
+	// +optional
+	Preflight *PreflightStatus `json:"preflight,omitempty"`
+
+	// HostRetries is the number of times the image has been attached again after a BareMetalHost error
+	// +optional
+	HostRetries int32 `json:"hostRetries,omitempty"`
+
+	// LastHostRetryTime is when the most recent BareMetalHost error was retried
+	// +optional
+	LastHostRetryTime *metav1.Time `json:"lastHostRetryTime,omitempty"`
+
+	// APICertExpiry is when the certificate in the referenced API cert secret expires
+	// +optional
+	APICertExpiry *metav1.Time `json:"apiCertExpiry,omitempty"`
+
+	// IngressCertExpiry is when the certificate in the referenced ingress cert secret expires
+	// +optional
+	IngressCertExpiry *metav1.Time `json:"ingressCertExpiry,omitempty"`
+
+	// CompletionHooks records the Jobs created for the PostCompletionHooks
+	// +optional
+	CompletionHooks []CompletionHookStatus `json:"completionHooks,omitempty"`
+
+	// BuildInfo describes what produced the rendered payload, the image contains the same information in build-info.json
+	// +optional
+	BuildInfo *BuildInfo `json:"buildInfo,omitempty"`
+
+	// HostHardware holds hardware facts copied from the inspection data of the referenced BareMetalHost
+	// +optional
+	HostHardware *HostHardware `json:"hostHardware,omitempty"`
+
+	// ConsoleURL is the URL of the web console of the relocated cluster, computed from the domain
+	// +optional
+	ConsoleURL string `json:"consoleURL,omitempty"`
+
+	// APIURL is the URL of the API server of the relocated cluster, computed from the domain
+	// +optional
+	APIURL string `json:"apiURL,omitempty"`
+
+	// ImageBuild describes the most recent build of the image, set by whichever of the image server or the zone
+	// cache upload built it. Images served from the image cache aren't built again so don't update it
+	// +optional
+	ImageBuild *ImageBuildStatus `json:"imageBuild,omitempty"`
+}
+
+// HostHardware is the subset of BareMetalHost inspection data needed to identify the host and write its network config
+type HostHardware struct {
+	// Manufacturer is the system manufacturer
+	// +optional
+	Manufacturer string `json:"manufacturer,omitempty"`
+
+	// ProductName is the system product name
+	// +optional
+	ProductName string `json:"productName,omitempty"`
+
+	// SerialNumber is the system serial number
+	// +optional
+	SerialNumber string `json:"serialNumber,omitempty"`
+
+	// NICs are the network interfaces of the host
+	// +optional
+	NICs []HostNIC `json:"nics,omitempty"`
+}
+
+// HostNIC is a network interface found when the BareMetalHost was inspected
+type HostNIC struct {
+	// Name is the name of the interface, such as eno1
+	Name string `json:"name"`
+
+	// MAC is the MAC address of the interface
+	MAC string `json:"mac"`
+}
+
+// BuildInfo records which service build rendered a payload and the objects it was rendered from
+type BuildInfo struct {
+	// Version is the version of the service which rendered the payload
+	Version string `json:"version"`
+
+	// GitCommit is the commit the service was built from
+	// +optional
+	GitCommit string `json:"gitCommit,omitempty"`
+
+	// BuildTime is when the payload was rendered
+	BuildTime metav1.Time `json:"buildTime"`
+
+	// PayloadHash is the hash of the rendered payload
+	PayloadHash string `json:"payloadHash"`
+
+	// Sources are the objects the payload was rendered from at the time it was rendered
+	// +optional
+	Sources []BuildSource `json:"sources,omitempty"`
+}
+
+// ImageBuildStatus describes a build of the image served for a ClusterConfig
+type ImageBuildStatus struct {
+	// Time is when the image was built
+	Time metav1.Time `json:"time"`
+
+	// SizeBytes is the size of the image in bytes
+	SizeBytes int64 `json:"sizeBytes"`
+
+	// Duration is how long the image took to build, or to lay out when images are streamed
+	Duration metav1.Duration `json:"duration"`
+
+	// FileCount is the number of payload files in the image
+	FileCount int32 `json:"fileCount"`
+}
+
+// BuildSource identifies the version of an object a payload was rendered from
+type BuildSource struct {
+	Kind            string `json:"kind"`
+	Namespace       string `json:"namespace"`
+	Name            string `json:"name"`
+	ResourceVersion string `json:"resourceVersion"`
+}
+
+// CompletionHookStatus records the Job created for a completion hook
+type CompletionHookStatus struct {
+	// Name is the name of the hook
+	Name string `json:"name"`
+
+	// JobName is the name of the Job created for the hook in the ClusterConfig namespace
+	JobName string `json:"jobName"`
+
+	// StartTime is when the Job was created
+	StartTime metav1.Time `json:"startTime"`
+}
+
+// PreflightStatus is the outcome of the preflight checks
+type PreflightStatus struct {
+	// Passed is true if every check passed
+	Passed bool `json:"passed"`
+
+	// Time is when the results last changed
+	Time metav1.Time `json:"time"`
+
+	// Checks are the results of the individual checks
+	// +optional
+	Checks []PreflightCheckResult `json:"checks,omitempty"`
+}
+
+// PreflightCheckResult is the outcome of a single preflight check
+type PreflightCheckResult struct {
+	// Name identifies the check
+	Name PreflightCheckName `json:"name"`
+
+	// Passed is true if the check passed
+	Passed bool `json:"passed"`
+
+	// Message describes the result
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// PreflightCheckName identifies a preflight check
+type PreflightCheckName string
+
+const (
+	// PreflightCheckBMCReachable checks the BareMetalHost BMC credentials have been verified
+	PreflightCheckBMCReachable PreflightCheckName = "BMCReachable"
+	// PreflightCheckHostInspected checks the BareMetalHost hardware details have been collected
+	PreflightCheckHostInspected PreflightCheckName = "HostInspected"
+	// PreflightCheckDiskSize checks the BareMetalHost root disk is at least the configured minimum size
+	PreflightCheckDiskSize PreflightCheckName = "DiskSize"
+	// PreflightCheckNetworkConfig checks the referenced network configuration can be parsed
+	PreflightCheckNetworkConfig PreflightCheckName = "NetworkConfig"
+)
+
+// PayloadDiff lists the changes between two rendered payloads
+// Values from secrets are never included
+type PayloadDiff struct {
+	// PayloadHash is the hash of the payload the changes produced
+	PayloadHash string `json:"payloadHash"`
+
+	// Time is when the changed payload was rendered
+	Time metav1.Time `json:"time"`
+
+	// Changes lists the changed fields, ordered by file and field path
+	// +optional
+	Changes []PayloadChange `json:"changes,omitempty"`
+
+	// Truncated is set when there were more changes than are listed
+	// +optional
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// PayloadChange describes a single changed field of a payload file
+type PayloadChange struct {
+	// FileType is the type of the changed payload file
+	FileType string `json:"fileType"`
+
+	// Path is the changed field within the file, empty when the whole file was added or removed
+	// +optional
+	Path string `json:"path,omitempty"`
+
+	// Operation is how the field changed
+	Operation PayloadChangeOperation `json:"operation"`
+
+	// Old is the previous value of the field
+	// +optional
+	Old string `json:"old,omitempty"`
+
+	// New is the rendered value of the field
+	// +optional
+	New string `json:"new,omitempty"`
+
+	// Redacted is set when the values are omitted because the file contains secret data
+	// +optional
+	Redacted bool `json:"redacted,omitempty"`
+}
+
+// PayloadChangeOperation is how a payload field changed
+type PayloadChangeOperation string
+
+const (
+	// PayloadChangeAdded means the field or file is only present in the rendered payload
+	PayloadChangeAdded PayloadChangeOperation = "Added"
+	// PayloadChangeRemoved means the field or file is only present in the previous payload
+	PayloadChangeRemoved PayloadChangeOperation = "Removed"
+	// PayloadChangeModified means the field has a different value in the rendered payload
+	PayloadChangeModified PayloadChangeOperation = "Modified"
+)
+
+// RelocationAttempt describes a single attach and boot cycle of a BareMetalHost
+type RelocationAttempt struct {
+	// PayloadHash is the hash of the configuration attached to the host
+	PayloadHash string `json:"payloadHash"`
+
+	// StartTime is when the image was attached to the host
+	StartTime metav1.Time `json:"startTime"`
+
+	// CompletionTime is when the attempt succeeded or was replaced by a new attempt
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// Outcome is the result of the attempt
+	Outcome RelocationAttemptOutcome `json:"outcome"`
+
+	// ConsoleLog is the name of the host console output captured during the attempt, served by the image
+	// server API from /api/v1/clusterconfigs/<namespace>/<name>/consolelogs/<consoleLog>
+	// +optional
+	ConsoleLog string `json:"consoleLog,omitempty"`
+}
+
+// RelocationAttemptOutcome is the result of a relocation attempt
+type RelocationAttemptOutcome string
+
+const (
+	// RelocationAttemptInProgress means the host has not reported success yet
+	RelocationAttemptInProgress RelocationAttemptOutcome = "InProgress"
+	// RelocationAttemptSucceeded means the relocated cluster reported success
+	RelocationAttemptSucceeded RelocationAttemptOutcome = "Succeeded"
+	// RelocationAttemptSuperseded means a changed configuration was attached before the attempt succeeded
+	RelocationAttemptSuperseded RelocationAttemptOutcome = "Superseded"
+	// RelocationAttemptAborted means the relocation was aborted before the attempt succeeded
+	RelocationAttemptAborted RelocationAttemptOutcome = "Aborted"
+)
+
+// ClusterConfigAnnotation is set on a BareMetalHost to the namespace/name of the ClusterConfig attaching images to it
+// when the manager is configured to link hosts back to their ClusterConfig.
+// It is also set on the network data secrets copied to the BareMetalHost namespace
+const ClusterConfigAnnotation = "relocation.openshift.io/cluster-config"
+
+// AbortAnnotation aborts an in-progress relocation. The image is detached from the BareMetalHost, which is also
+// powered off if the value is AbortPowerOff, and isn't attached again until the annotation is removed
+const AbortAnnotation = "relocation.openshift.io/abort"
+
+// AbortPowerOff is the AbortAnnotation value which also powers the BareMetalHost off
+const AbortPowerOff = "power-off"
+
+// ForceRebuildAnnotation renders the ClusterConfig immediately even if its MinRebuildInterval hasn't passed
+// It is removed once the configuration has been rendered
+const ForceRebuildAnnotation = "relocation.openshift.io/force-rebuild"
+
+// ForceCleanupAnnotation is set to "true" on a deleted ClusterConfig to remove its finalizer even if its data or the
+// objects it changed can't be cleaned up, leaving them behind. It is an escape hatch for deletions which can't complete
+const ForceCleanupAnnotation = "relocation.openshift.io/force-cleanup"
+
+// TemplateAnnotation is set to "true" on the network config and extra manifests config maps to render each of their
+// values as a Go template with the ClusterConfig and its BareMetalHost inspection data when the payload is rendered
+const TemplateAnnotation = "relocation.openshift.io/template"
+
+// CompletionHookClusterConfigLabel is set on completion hook Jobs to the name of the ClusterConfig they were created for
+const CompletionHookClusterConfigLabel = "relocation.openshift.io/cluster-config-name"
+
+// CompletionHookServiceAccount is the service account completion hook Jobs run as in the ClusterConfig namespace.
+// It isn't created by the controller, namespace admins create it with the permissions their hooks need
+const CompletionHookServiceAccount = "relocation-completion-hook"
+
+const (
+	// PhaseLabel is set to the phase of the ClusterConfig when console annotations are enabled so console views can
+	// select ClusterConfigs by phase
+	PhaseLabel = "relocation.openshift.io/phase"
+	// ProgressPercentAnnotation is an estimate from 0 to 100 of how far through the relocation the ClusterConfig is
+	ProgressPercentAnnotation = "relocation.openshift.io/progress-percent"
+	// ProgressMessageAnnotation describes the current step of the relocation
+	ProgressMessageAnnotation = "relocation.openshift.io/progress-message"
+	// ConsoleLogsURLAnnotation links to the logs of the relocation when the manager is configured with a logs URL
+	ConsoleLogsURLAnnotation = "relocation.openshift.io/logs-url"
+)
+
+// ZoneLabel selects the network zone of a ClusterConfig's BareMetalHost
+// The image URL uses the service URL configured for the zone so BMCs in segmented management networks can reach it
+const ZoneLabel = "relocation.openshift.io/zone"
+
+// ReferencedBareMetalHostLabel is set to "true" on BareMetalHosts referenced by a ClusterConfig
+// The manager only caches labeled hosts so hubs with many hosts don't hold all of them in memory
+const ReferencedBareMetalHostLabel = "relocation.openshift.io/referenced"
+
+// NetworkDataKey is the key of the network data in the secret referenced by NetworkDataRef
+const NetworkDataKey = "networkData"
+
+// AdminKubeconfigKey is the key of the kubeconfig in the secret referenced by AdminKubeconfigRef
+const AdminKubeconfigKey = "kubeconfig"
+
+const (
+	// ImageCredentialsSecretName is the name of the secret in each ClusterConfig namespace holding the basic auth
+	// credentials for the namespace's images when the image server requires them.
+	// It is generated if it doesn't exist
+	ImageCredentialsSecretName = "clusterconfig-image-credentials"
+	// ImageCredentialsUsernameKey is the key of the username in the image credentials secret
+	ImageCredentialsUsernameKey = "username"
+	// ImageCredentialsPasswordKey is the key of the password in the image credentials secret
+	ImageCredentialsPasswordKey = "password"
+)
+
+// ClusterConfigPhase summarizes the progress of a ClusterConfig
+type ClusterConfigPhase string
+
+const (
+	// ClusterConfigPhasePending means the configuration has not yet been rendered
+	ClusterConfigPhasePending ClusterConfigPhase = "Pending"
+	// ClusterConfigPhaseImageReady means the configuration has been rendered and the image can be served
+	ClusterConfigPhaseImageReady ClusterConfigPhase = "ImageReady"
+	// ClusterConfigPhaseImageAttached means the image has been attached to the referenced BareMetalHost
+	// The phase lasts while the host boots the image and runs the relocation as neither is reported
+	ClusterConfigPhaseImageAttached ClusterConfigPhase = "ImageAttached"
+	// ClusterConfigPhaseCompleted means the relocated cluster has reported success
+	ClusterConfigPhaseCompleted ClusterConfigPhase = "Completed"
+	// ClusterConfigPhaseFailed means the BareMetalHost still reported an error after the configured retries
+	ClusterConfigPhaseFailed ClusterConfigPhase = "Failed"
+	// ClusterConfigPhaseAborted means the relocation was aborted with the AbortAnnotation and the image is detached
+	ClusterConfigPhaseAborted ClusterConfigPhase = "Aborted"
+)
+
+const (
+	// RelocationCompletedCondition is true once the relocated cluster has reported success.
+	// It is set through the status subresource by the spoke or automation acting on its behalf.
+	RelocationCompletedCondition = "RelocationCompleted"
+
+	// PayloadWithinSizeLimitCondition is false when the image built from the rendered payload is larger than the
+	// configured maximum.
+	// No image is served for the ClusterConfig while it is false.
+	PayloadWithinSizeLimitCondition = "PayloadWithinSizeLimit"
+
+	// ImageReachableCondition is false when the hub provisioning configuration prevents Ironic from reaching the image.
+	// The image is not attached to the BareMetalHost while it is false.
+	ImageReachableCondition = "ImageReachable"
+
+	// ReconciledCondition is false when the payload can't be rendered from the spec.
+	// It uses the same type and reasons as the ClusterRelocation Reconciled condition where an equivalent exists
+	// so tooling which understands ClusterRelocations can reuse its logic
+	ReconciledCondition = cro.ConditionTypeReconciled
+
+	// HostProvisioningFailedCondition is true once the BareMetalHost errors have used up the configured retries
+	// and false with the error while they are being retried
+	HostProvisioningFailedCondition = "HostProvisioningFailed"
+
+	// HostErrorCondition is true while the referenced BareMetalHost reports an error,
+	// the message includes the error type and a summary of the error message
+	HostErrorCondition = "HostError"
+
+	// CertificatesValidCondition is false when the API or ingress certificate expires within the CertRenewalWindow
+	// or can't be parsed. The image is not attached to the BareMetalHost while it is false.
+	CertificatesValidCondition = "CertificatesValid"
+
+	// ConsistentCondition is set by the periodic audit and is false when the rendered files are missing from the
+	// data directory or the referenced BareMetalHost doesn't have the expected image attached.
+	ConsistentCondition = "Consistent"
+
+	// ConfigurationWarningsCondition is true when a rendered certificate expires within the CertWarningWindow or
+	// uses a weak key or signature, or an SSH key uses a weak algorithm. It doesn't prevent the image being attached
+	ConfigurationWarningsCondition = "ConfigurationWarnings"
+
+	// AbortedCondition is true while the AbortAnnotation is set.
+	// The image is detached from the BareMetalHost and isn't attached again until the annotation is removed.
+	AbortedCondition = "Aborted"
+
+	// RebuildThrottledCondition is true while the rendered payload changed less than MinRebuildInterval ago.
+	// Changes made while it is true are rendered once the interval has passed.
+	RebuildThrottledCondition = "RebuildThrottled"
+
+	// WaitingForHostCondition is true while the referenced BareMetalHost doesn't exist.
+	// The image is attached as soon as the host is created.
+	WaitingForHostCondition = "WaitingForHost"
+
+	// HardwareInsufficientCondition is true when the inspected BareMetalHost hardware is below the
+	// HardwareRequirements and unknown until the host has been inspected. The image is not attached unless it is false.
+	HardwareInsufficientCondition = "HardwareInsufficient"
+
+	// ReattachHeldCondition is true while changes to the shared inputs of the payload aren't rendered or attached
+	// because their canaries haven't succeeded yet. Changes to the ClusterConfig and its other inputs are held with
+	// them as the payload is rendered as a whole. It is only set when the manager is configured with canaries
+	ReattachHeldCondition = "ReattachHeld"
+
+	// DNSRecordsPublishedCondition is true once a DNSEndpoint with records for the domain of the relocated cluster
+	// has been created. It is only set when the manager is configured to create DNS records, once the relocation has
+	// completed
+	DNSRecordsPublishedCondition = "DNSRecordsPublished"
+
+	// MaintenanceWindowOpenCondition is false while the MaintenanceWindow is closed or can't be parsed. Changes to
+	// the BareMetalHost are deferred until it is true. It is only set when a MaintenanceWindow is configured
+	MaintenanceWindowOpenCondition = "MaintenanceWindowOpen"
+)
+
+const (
+	// PayloadWithinSizeLimitReason is used when the payload is not larger than the configured maximum
+	PayloadWithinSizeLimitReason = "WithinLimit"
+	// PayloadTooLargeReason is used when the payload is larger than the configured maximum
+	PayloadTooLargeReason = "PayloadTooLarge"
+	// ImageReachableReason is used when Ironic is expected to be able to reach the image
+	ImageReachableReason = "Reachable"
+	// ProvisioningNetworkUnreachableReason is used when virtual media is served over a provisioning network that can't reach the image
+	ProvisioningNetworkUnreachableReason = "ProvisioningNetworkUnreachable"
+	// InsecureImageURLReason is used when credentials would be embedded in an image served over plain HTTP
+	InsecureImageURLReason = "InsecureImageURL"
+	// ReconciliationFailedReason is used when rendering fails for a reason without a ClusterRelocation equivalent
+	ReconciliationFailedReason = "ReconciliationFailed"
+	// HostErrorRetryingReason is used when a BareMetalHost error is being retried
+	HostErrorRetryingReason = "Retrying"
+	// HostRetriesExhaustedReason is used when a BareMetalHost error persists after the configured retries
+	HostRetriesExhaustedReason = "RetriesExhausted"
+	// HostErrorReportedReason is used when the BareMetalHost reports an error
+	HostErrorReportedReason = "ErrorReported"
+	// NoHostErrorReason is used when the BareMetalHost doesn't report an error
+	NoHostErrorReason = "NoError"
+	// HostNotFoundReason is used when the referenced BareMetalHost doesn't exist yet
+	HostNotFoundReason = "HostNotFound"
+	// HostFoundReason is used once the referenced BareMetalHost exists
+	HostFoundReason = "HostFound"
+	// CertificatesValidReason is used when the certificates don't expire within the renewal window
+	CertificatesValidReason = "Valid"
+	// CertificateExpiringReason is used when a certificate expires within the renewal window
+	CertificateExpiringReason = "Expiring"
+	// CertificateInvalidReason is used when a certificate can't be parsed
+	CertificateInvalidReason = "Invalid"
+	// MinRebuildIntervalReason is used while rendering is deferred until the MinRebuildInterval has passed
+	MinRebuildIntervalReason = "MinRebuildInterval"
+	// WarningsFoundReason is used when the configuration has warnings
+	WarningsFoundReason = "WarningsFound"
+	// NoWarningsReason is used when no problems were found with the configuration
+	NoWarningsReason = "NoWarnings"
+	// ConsistentReason is used when the audit found no discrepancies
+	ConsistentReason = "Consistent"
+	// MissingFilesReason is used when the rendered files for the image are missing from the data directory
+	MissingFilesReason = "MissingFiles"
+	// ImageURLMismatchReason is used when the referenced BareMetalHost doesn't have the expected image attached
+	ImageURLMismatchReason = "ImageURLMismatch"
+	// AbortRequestedReason is used when the relocation was aborted with the AbortAnnotation
+	AbortRequestedReason = "AbortRequested"
+	// RebuildAllowedReason is used when the configuration is rendered as soon as it changes
+	RebuildAllowedReason = "RebuildAllowed"
+	// HardwareBelowMinimumReason is used when the BareMetalHost hardware doesn't meet the HardwareRequirements
+	HardwareBelowMinimumReason = "BelowMinimum"
+	// HardwareSufficientReason is used when the BareMetalHost hardware meets the HardwareRequirements
+	HardwareSufficientReason = "Sufficient"
+	// HardwareDetailsUnavailableReason is used until the BareMetalHost has been inspected
+	HardwareDetailsUnavailableReason = "HardwareDetailsUnavailable"
+	// CanariesInProgressReason is used while the canaries for a changed shared input haven't all succeeded
+	CanariesInProgressReason = "CanariesInProgress"
+	// CanaryFailedReason is used when a canary for a changed shared input failed, the rollout pauses until it is fixed
+	CanaryFailedReason = "CanaryFailed"
+	// ReattachAllowedReason is used when a changed payload is attached without waiting for canaries
+	ReattachAllowedReason = "ReattachAllowed"
+	// DNSEndpointCreatedReason is used when a DNSEndpoint holds the records of the relocated cluster
+	DNSEndpointCreatedReason = "DNSEndpointCreated"
+	// DNSEndpointUnavailableReason is used when DNS records are enabled but the DNSEndpoint CRD isn't installed
+	DNSEndpointUnavailableReason = "DNSEndpointUnavailable"
+	// NoDNSRecordsReason is used when the ClusterConfig has no domain or virtual IPs to publish records for
+	NoDNSRecordsReason = "NoRecords"
+	// MaintenanceWindowOpenReason is used while the maintenance window is open
+	MaintenanceWindowOpenReason = "Open"
+	// MaintenanceWindowClosedReason is used while the maintenance window is closed
+	MaintenanceWindowClosedReason = "Closed"
+	// MaintenanceWindowInvalidReason is used when the maintenance window can't be parsed
+	MaintenanceWindowInvalidReason = "InvalidWindow"
+)
+
+// RepositoryDigestMirrors holds cluster-wide information about how to handle mirrors in the registries config
+// in the same format as an ImageContentSourcePolicy
+type RepositoryDigestMirrors struct {
+	// Source is the repository that users refer to, e.g. in image pull specifications
+	Source string `json:"source"`
+	// Mirrors is one or more repositories that may also contain the same images
+	// +optional
+	Mirrors []string `json:"mirrors,omitempty"`
+}
+
+// ImageVolume customizes the ISO volume the configuration is served on
+type ImageVolume struct {
+	// Label is the label of the ISO volume. The on-host agent finds the configuration by its label so it must be
+	// configured to search for this label when it isn't the default relocation-config
+	// +kubebuilder:validation:MaxLength=32
+	// +kubebuilder:validation:Pattern=`^[A-Za-z0-9_.-]+$`
+	// +optional
+	Label string `json:"label,omitempty"`
+
+	// Metadata is recorded in the payload manifest so a host with several attached media can tell which one
+	// holds its configuration
+	// +kubebuilder:validation:MaxProperties=32
+	// +optional
+	Metadata map[string]string `json:"metadata,omitempty"`
 }
 
 type BareMetalHostReference struct {
 	// Name identifies the BareMetalHost within a namespace
 	Name string `json:"name"`
 	// Namespace identifies the namespace containing the referenced BareMetalHost
-	Namespace string `json:"namespace"`
+	// Defaults to the namespace of the ClusterConfig
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// BootMode, if set, is applied to the BareMetalHost when the image is attached
+	// +optional
+	BootMode bmh_v1alpha1.BootMode `json:"bootMode,omitempty"`
+
+	// RootDeviceHints, if set, are applied to the BareMetalHost when the image is attached
+	// +optional
+	RootDeviceHints *bmh_v1alpha1.RootDeviceHints `json:"rootDeviceHints,omitempty"`
+
+	// AutomatedCleaningMode, if set, is applied to the BareMetalHost when the image is attached
+	// +optional
+	AutomatedCleaningMode bmh_v1alpha1.AutomatedCleaningMode `json:"automatedCleaningMode,omitempty"`
+
+	// DiskFormat is the format the image is attached to the BareMetalHost with. Images built by the service are
+	// live-iso, other formats can only be used with an externalImageURL. Defaults to live-iso
+	// +kubebuilder:validation:Enum=live-iso;raw;qcow2;vdi;vmdk
+	// +optional
+	DiskFormat string `json:"diskFormat,omitempty"`
+
+	// NetworkDataRef references a secret in the ClusterConfig namespace containing the network configuration of the
+	// OS provisioned on the host under the networkData key. It is copied to the BareMetalHost namespace and set as
+	// the host's networkData, which is written to the config drive, when the image is attached
+	// +optional
+	NetworkDataRef *corev1.LocalObjectReference `json:"networkDataRef,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:resource:categories=relocation
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+//+kubebuilder:printcolumn:name="BMH",type=string,JSONPath=`.spec.bareMetalHostRef.name`
+//+kubebuilder:printcolumn:name="Image URL",type=string,JSONPath=`.status.imageURL`,priority=1
+//+kubebuilder:printcolumn:name="Console",type=string,JSONPath=`.status.consoleURL`,priority=1
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+//+kubebuilder:validation:XValidation:rule="size(self.metadata.name) <= 63 && self.metadata.name.matches('^[a-z0-9]([-a-z0-9]*[a-z0-9])?$')",message="metadata.name must be a DNS label of at most 63 characters"
+//+operator-sdk:csv:customresourcedefinitions:displayName="Cluster Config",resources={{BareMetalHost,v1alpha1,""},{Secret,v1,""},{ConfigMap,v1,""}}
 
 // ClusterConfig is the Schema for the clusterconfigs API
 type ClusterConfig struct {
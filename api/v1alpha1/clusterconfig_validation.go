@@ -0,0 +1,435 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/idna"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	// MaxNameLength is the longest ClusterConfig name accepted
+	// Names are used as the ClusterRelocation name on the spoke and in image paths so they're kept to a DNS label
+	MaxNameLength = validation.DNS1123LabelMaxLength
+
+	// longestDomainPrefix is the longest name the relocated cluster adds to the base domain
+	longestDomainPrefix = "api-int."
+
+	// wildcardCommonNamePrefix is added to the base domain to create the common name of the generated ingress certificate
+	wildcardCommonNamePrefix = "*.apps."
+	// maxCommonNameLength is the upper bound on the x509 common name attribute
+	maxCommonNameLength = 64
+)
+
+// NormalizeDomain converts domain into the lower case ASCII form used in DNS and certificates.
+// Internationalized domains are converted to punycode and any trailing dot is removed.
+func NormalizeDomain(domain string) (string, error) {
+	domain = strings.TrimSuffix(strings.TrimSpace(domain), ".")
+	return idna.Lookup.ToASCII(domain)
+}
+
+// imageDigestMirrorSetMinorVersion is the first 4.y release supporting ImageDigestMirrorSets and ImageTagMirrorSets
+const imageDigestMirrorSetMinorVersion = 13
+
+// EffectiveMirrorOutput returns the kind of resource digest mirrors are rendered as for spec
+func EffectiveMirrorOutput(spec *ClusterConfigSpec) MirrorOutput {
+	if spec.MirrorOutput != "" {
+		return spec.MirrorOutput
+	}
+	major, minor, ok := strings.Cut(spec.TargetVersion, ".")
+	if !ok {
+		return MirrorOutputImageDigestMirrorSet
+	}
+	majorVersion, majorErr := strconv.Atoi(major)
+	minorVersion, minorErr := strconv.Atoi(minor)
+	if majorErr != nil || minorErr != nil {
+		return MirrorOutputImageDigestMirrorSet
+	}
+	if majorVersion < 4 || (majorVersion == 4 && minorVersion < imageDigestMirrorSetMinorVersion) {
+		return MirrorOutputImageContentSourcePolicy
+	}
+	return MirrorOutputImageDigestMirrorSet
+}
+
+// validateName checks the ClusterConfig name can be used everywhere the service uses it
+func validateName(name string) field.ErrorList {
+	path := field.NewPath("metadata", "name")
+	if len(name) > MaxNameLength {
+		return field.ErrorList{field.TooLongMaxLength(path, name, MaxNameLength)}
+	}
+
+	var errs field.ErrorList
+	for _, msg := range validation.IsDNS1123Label(name) {
+		errs = append(errs, field.Invalid(path, name, msg))
+	}
+	return errs
+}
+
+// validateDomain checks domain is a normalized DNS name which the relocated cluster can build its names from
+// Warnings are returned for domains which are valid but are likely to cause problems
+func validateDomain(domain string) (field.ErrorList, []string) {
+	path := field.NewPath("spec", "domain")
+	if domain == "" {
+		return nil, nil
+	}
+
+	normalized, err := NormalizeDomain(domain)
+	if err != nil {
+		return field.ErrorList{field.Invalid(path, domain, fmt.Sprintf("not a valid domain name: %s", err))}, nil
+	}
+	if normalized != domain {
+		return field.ErrorList{field.Invalid(path, domain, fmt.Sprintf("must be in lower case ASCII form, use %q instead", normalized))}, nil
+	}
+
+	var errs field.ErrorList
+	for _, msg := range validation.IsDNS1123Subdomain(domain) {
+		errs = append(errs, field.Invalid(path, domain, msg))
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if len(label) > validation.DNS1123LabelMaxLength {
+			errs = append(errs, field.Invalid(path, domain, fmt.Sprintf("label %q must be no more than %d characters", label, validation.DNS1123LabelMaxLength)))
+		}
+	}
+	if maxLen := validation.DNS1123SubdomainMaxLength - len(longestDomainPrefix); len(domain) > maxLen {
+		errs = append(errs, field.Invalid(path, domain, fmt.Sprintf("must be no more than %d characters so that %s%s is a valid name", maxLen, longestDomainPrefix, domain)))
+	}
+	if len(errs) > 0 {
+		return errs, nil
+	}
+
+	var warnings []string
+	if cn := wildcardCommonNamePrefix + domain; len(cn) > maxCommonNameLength {
+		warnings = append(warnings, fmt.Sprintf("spec.domain: the ingress certificate common name %q is longer than %d characters, a certificate will not be generated for it unless spec.ingressCertRef is set", cn, maxCommonNameLength))
+	}
+	return nil, warnings
+}
+
+// validateNetwork checks the VIPs and machine networks are well formed and consistent with each other
+func validateNetwork(network *ClusterNetwork) field.ErrorList {
+	if network == nil {
+		return nil
+	}
+	path := field.NewPath("spec", "network")
+
+	var errs field.ErrorList
+	var cidrs []*net.IPNet
+	for i, cidr := range network.MachineNetworks {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			errs = append(errs, field.Invalid(path.Child("machineNetworks").Index(i), cidr, "must be a valid CIDR"))
+			continue
+		}
+		cidrs = append(cidrs, ipNet)
+	}
+
+	validateVIPs := func(name string, vips []string) {
+		families := map[bool]bool{}
+		for i, vip := range vips {
+			vipPath := path.Child(name).Index(i)
+			ip := net.ParseIP(vip)
+			if ip == nil {
+				errs = append(errs, field.Invalid(vipPath, vip, "must be a valid IP address"))
+				continue
+			}
+			v4 := ip.To4() != nil
+			if families[v4] {
+				errs = append(errs, field.Invalid(vipPath, vip, "only one address per IP family is allowed"))
+			}
+			families[v4] = true
+			if len(cidrs) > 0 && !containedIn(ip, cidrs) {
+				errs = append(errs, field.Invalid(vipPath, vip, "must be in one of the machine networks"))
+			}
+		}
+	}
+	validateVIPs("apiVIPs", network.APIVIPs)
+	validateVIPs("ingressVIPs", network.IngressVIPs)
+
+	return errs
+}
+
+func containedIn(ip net.IP, cidrs []*net.IPNet) bool {
+	for _, c := range cidrs {
+		if c.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateMaintenanceWindow checks window can be parsed by the controller, the schema only checks the format of the fields
+func validateMaintenanceWindow(window *MaintenanceWindow) field.ErrorList {
+	if window == nil {
+		return nil
+	}
+	path := field.NewPath("spec", "maintenanceWindow")
+	var errs field.ErrorList
+	if _, err := time.Parse("15:04", window.Start); err != nil {
+		errs = append(errs, field.Invalid(path.Child("start"), window.Start, "must be a time of day in HH:MM format"))
+	}
+	if window.Duration.Duration <= 0 {
+		errs = append(errs, field.Invalid(path.Child("duration"), window.Duration.String(), "must be positive"))
+	}
+	if window.TimeZone == "Local" {
+		errs = append(errs, field.Invalid(path.Child("timeZone"), window.TimeZone, "must be an IANA time zone name"))
+	} else if window.TimeZone != "" {
+		if _, err := time.LoadLocation(window.TimeZone); err != nil {
+			errs = append(errs, field.Invalid(path.Child("timeZone"), window.TimeZone, fmt.Sprintf("must be an IANA time zone name: %s", err)))
+		}
+	}
+	for i, day := range window.Days {
+		if _, err := time.Parse("Monday", string(day)); err != nil {
+			errs = append(errs, field.NotSupported(path.Child("days").Index(i), day, []string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"}))
+		}
+	}
+	return errs
+}
+
+// validateTimezone checks timezone is a time zone name the relocated cluster's hosts can be set to
+func validateTimezone(timezone string) field.ErrorList {
+	path := field.NewPath("spec", "timezone")
+	if timezone == "" {
+		return nil
+	}
+	// Local refers to the time zone of the webhook rather than a named zone
+	if timezone == "Local" {
+		return field.ErrorList{field.Invalid(path, timezone, "must be an IANA time zone name")}
+	}
+	if _, err := time.LoadLocation(timezone); err != nil {
+		return field.ErrorList{field.Invalid(path, timezone, fmt.Sprintf("must be an IANA time zone name: %s", err))}
+	}
+	return nil
+}
+
+// validateAdditionalPullSecrets checks the additional pull secrets have a pull secret to be merged into
+func validateAdditionalPullSecrets(spec *ClusterConfigSpec) field.ErrorList {
+	if len(spec.AdditionalPullSecretRefs) > 0 && spec.PullSecretRef == nil {
+		return field.ErrorList{field.Required(field.NewPath("spec", "pullSecretRef"), "must be set when additionalPullSecretRefs is set")}
+	}
+	return nil
+}
+
+// validateExternalImageURL checks the external image URL can be downloaded by Ironic
+func validateExternalImageURL(imageURL string) field.ErrorList {
+	path := field.NewPath("spec", "externalImageURL")
+	if imageURL == "" {
+		return nil
+	}
+	u, err := url.Parse(imageURL)
+	if err != nil {
+		return field.ErrorList{field.Invalid(path, imageURL, fmt.Sprintf("must be a valid URL: %s", err))}
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return field.ErrorList{field.Invalid(path, imageURL, "must be an absolute http or https URL")}
+	}
+	return nil
+}
+
+// validateAdoptExistingData checks existing data isn't adopted for an image which isn't served by the service
+func validateAdoptExistingData(spec *ClusterConfigSpec) field.ErrorList {
+	if spec.AdoptExistingData && spec.ExternalImageURL != "" {
+		return field.ErrorList{field.Forbidden(field.NewPath("spec", "adoptExistingData"), "can't be set when externalImageURL is set")}
+	}
+	return nil
+}
+
+// validateDiskFormat checks images built by the service are attached as ISOs
+func validateDiskFormat(spec *ClusterConfigSpec) field.ErrorList {
+	ref := spec.BareMetalHostRef
+	if ref == nil || ref.DiskFormat == "" || ref.DiskFormat == LiveISODiskFormat || spec.ExternalImageURL != "" {
+		return nil
+	}
+	return field.ErrorList{field.Forbidden(field.NewPath("spec", "bareMetalHostRef", "diskFormat"), "must be live-iso unless externalImageURL is set")}
+}
+
+// validateHostChecks checks a BareMetalHost is referenced when checks of the host are configured
+func validateHostChecks(spec *ClusterConfigSpec) field.ErrorList {
+	if spec.BareMetalHostRef != nil {
+		return nil
+	}
+	var errs field.ErrorList
+	if spec.Preflight != nil {
+		errs = append(errs, field.Forbidden(field.NewPath("spec", "preflight"), "can't be set without bareMetalHostRef"))
+	}
+	if spec.HardwareRequirements != nil {
+		errs = append(errs, field.Forbidden(field.NewPath("spec", "hardwareRequirements"), "can't be set without bareMetalHostRef"))
+	}
+	if spec.InterfaceNamesFromHost {
+		errs = append(errs, field.Forbidden(field.NewPath("spec", "interfaceNamesFromHost"), "can't be set without bareMetalHostRef"))
+	}
+	return errs
+}
+
+// deprecationWarnings returns a warning for each deprecated field set in spec
+func deprecationWarnings(spec *ClusterConfigSpec) []string {
+	var warnings []string
+	if spec.Preflight != nil && spec.Preflight.MinDiskSize != nil {
+		warnings = append(warnings, "spec.preflight.minDiskSize is deprecated, set spec.hardwareRequirements.minDiskSize instead")
+	}
+	return warnings
+}
+
+// validateMirrorOutput checks tag mirrors aren't configured for clusters which can only use ImageContentSourcePolicies
+func validateMirrorOutput(spec *ClusterConfigSpec) field.ErrorList {
+	if len(spec.ImageTagMirrors) > 0 && EffectiveMirrorOutput(spec) == MirrorOutputImageContentSourcePolicy {
+		return field.ErrorList{field.Forbidden(field.NewPath("spec", "imageTagMirrors"),
+			"tag mirrors can't be used with an ImageContentSourcePolicy mirror output, they require ImageTagMirrorSets which are supported from 4.13")}
+	}
+	return nil
+}
+
+// validateCompletionHooks checks each completion hook Job can be named after the ClusterConfig and only runs pods
+// the controller can safely create on behalf of the requester
+func validateCompletionHooks(name string, hooks []CompletionHook) field.ErrorList {
+	var errs field.ErrorList
+	for i, hook := range hooks {
+		path := field.NewPath("spec", "postCompletionHooks").Index(i)
+		jobName := name + "-" + hook.Name
+		// the Job name is also used as a label value on its pods
+		if len(jobName) > validation.DNS1123LabelMaxLength {
+			errs = append(errs, field.Invalid(path.Child("name"), hook.Name,
+				fmt.Sprintf("the Job name %s must be no more than %d characters", jobName, validation.DNS1123LabelMaxLength)))
+		}
+		errs = append(errs, ValidateCompletionHookPod(path.Child("template", "spec", "template", "spec"), &hook.Template.Spec.Template.Spec)...)
+	}
+	return errs
+}
+
+// ValidateCompletionHookPod rejects completion hook pods which could use more than the privileges of the
+// CompletionHookServiceAccount, as the controller creates them with its own permissions
+func ValidateCompletionHookPod(path *field.Path, spec *corev1.PodSpec) field.ErrorList {
+	var errs field.ErrorList
+	if spec.ServiceAccountName != "" && spec.ServiceAccountName != CompletionHookServiceAccount {
+		errs = append(errs, field.NotSupported(path.Child("serviceAccountName"), spec.ServiceAccountName, []string{CompletionHookServiceAccount}))
+	}
+	if spec.DeprecatedServiceAccount != "" && spec.DeprecatedServiceAccount != CompletionHookServiceAccount {
+		errs = append(errs, field.NotSupported(path.Child("serviceAccount"), spec.DeprecatedServiceAccount, []string{CompletionHookServiceAccount}))
+	}
+	if spec.HostNetwork {
+		errs = append(errs, field.Forbidden(path.Child("hostNetwork"), "completion hooks can't use the host network"))
+	}
+	if spec.HostPID {
+		errs = append(errs, field.Forbidden(path.Child("hostPID"), "completion hooks can't use the host PID namespace"))
+	}
+	if spec.HostIPC {
+		errs = append(errs, field.Forbidden(path.Child("hostIPC"), "completion hooks can't use the host IPC namespace"))
+	}
+	for i, v := range spec.Volumes {
+		if v.HostPath != nil {
+			errs = append(errs, field.Forbidden(path.Child("volumes").Index(i).Child("hostPath"), "completion hooks can't mount host paths"))
+		}
+	}
+	privileged := func(path *field.Path, sc *corev1.SecurityContext) {
+		if sc != nil && sc.Privileged != nil && *sc.Privileged {
+			errs = append(errs, field.Forbidden(path.Child("securityContext", "privileged"), "completion hooks can't run privileged containers"))
+		}
+	}
+	for i := range spec.InitContainers {
+		privileged(path.Child("initContainers").Index(i), spec.InitContainers[i].SecurityContext)
+	}
+	for i := range spec.Containers {
+		privileged(path.Child("containers").Index(i), spec.Containers[i].SecurityContext)
+	}
+	for i := range spec.EphemeralContainers {
+		privileged(path.Child("ephemeralContainers").Index(i), spec.EphemeralContainers[i].SecurityContext)
+	}
+	return errs
+}
+
+// validateIgnitionConfigOverride checks the override is an Ignition config the relocated host can merge
+func validateIgnitionConfigOverride(override string) field.ErrorList {
+	path := field.NewPath("spec", "ignitionConfigOverride")
+	if override == "" {
+		return nil
+	}
+	config := struct {
+		Ignition struct {
+			Version string `json:"version"`
+		} `json:"ignition"`
+	}{}
+	if err := json.Unmarshal([]byte(override), &config); err != nil {
+		return field.ErrorList{field.Invalid(path, override, fmt.Sprintf("must be a JSON Ignition config: %s", err))}
+	}
+	if !strings.HasPrefix(config.Ignition.Version, "3.") {
+		return field.ErrorList{field.Invalid(path, override,
+			fmt.Sprintf("ignition.version must be a 3.x version but is %q", config.Ignition.Version))}
+	}
+	return nil
+}
+
+// validateDiskEncryption checks a tang configuration has servers the host can reach and tpm2 doesn't have any
+func validateDiskEncryption(encryption *DiskEncryption) field.ErrorList {
+	path := field.NewPath("spec", "diskEncryption")
+	if encryption == nil {
+		return nil
+	}
+	if encryption.Mode != DiskEncryptionModeTang {
+		if len(encryption.TangServers) > 0 {
+			return field.ErrorList{field.Forbidden(path.Child("tangServers"), "tang servers can only be set in tang mode")}
+		}
+		return nil
+	}
+	if len(encryption.TangServers) == 0 {
+		return field.ErrorList{field.Required(path.Child("tangServers"), "at least one tang server is required in tang mode")}
+	}
+
+	var errs field.ErrorList
+	for i, server := range encryption.TangServers {
+		serverPath := path.Child("tangServers").Index(i)
+		u, err := url.Parse(server.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, field.Invalid(serverPath.Child("url"), server.URL, "must be an absolute http or https URL"))
+		}
+		if server.Thumbprint == "" {
+			errs = append(errs, field.Required(serverPath.Child("thumbprint"), "the server key thumbprint is required"))
+		}
+	}
+	return errs
+}
+
+var (
+	// releaseDigestRegexp matches pull specs referencing an image by sha256 digest
+	releaseDigestRegexp = regexp.MustCompile(`^[^@\s]+@sha256:[a-f0-9]{64}$`)
+	// releaseVersionRegexp matches release versions such as 4.14.3 or 4.15.0-rc.1
+	releaseVersionRegexp = regexp.MustCompile(`^[0-9]+\.[0-9]+\.[0-9]+(-[0-9A-Za-z.-]+)?$`)
+)
+
+// validateRelease checks the release is pinned by digest and the allowed versions are release versions
+func validateRelease(spec *ClusterConfigSpec) field.ErrorList {
+	var errs field.ErrorList
+	if spec.ReleaseImage != "" && !releaseDigestRegexp.MatchString(spec.ReleaseImage) {
+		errs = append(errs, field.Invalid(field.NewPath("spec", "releaseImage"), spec.ReleaseImage,
+			"must reference the release by digest, for example quay.io/openshift-release-dev/ocp-release@sha256:<digest>"))
+	}
+	for i, v := range spec.AllowedReleaseVersions {
+		if !releaseVersionRegexp.MatchString(v) {
+			errs = append(errs, field.Invalid(field.NewPath("spec", "allowedReleaseVersions").Index(i), v,
+				"must be a release version such as 4.14.3"))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,306 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// log is for logging in this package.
+var clusterconfiglog = logf.Log.WithName("clusterconfig-resource")
+
+// SetupWebhookWithManager registers the ClusterConfig webhooks
+// maxPerNamespace limits the number of ClusterConfigs in a single namespace, zero means no limit
+func (r *ClusterConfig) SetupWebhookWithManager(mgr ctrl.Manager, maxPerNamespace int) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		WithValidator(&ClusterConfigValidator{Reader: mgr.GetClient(), Client: mgr.GetClient(), MaxPerNamespace: maxPerNamespace}).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-relocation-openshift-io-v1alpha1-clusterconfig,mutating=true,failurePolicy=fail,sideEffects=None,groups=relocation.openshift.io,resources=clusterconfigs,verbs=create;update,versions=v1alpha1,name=mclusterconfig.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Defaulter = &ClusterConfig{}
+
+// Default implements webhook.Defaulter so a webhook will be registered for the type
+func (r *ClusterConfig) Default() {
+	clusterconfiglog.Info("default", "name", r.Name, "namespace", r.Namespace)
+
+	if ref := r.Spec.BareMetalHostRef; ref != nil {
+		if ref.Namespace == "" {
+			ref.Namespace = r.Namespace
+		}
+		if ref.DiskFormat == "" {
+			ref.DiskFormat = LiveISODiskFormat
+		}
+	}
+	if r.Spec.RebootMode == "" {
+		r.Spec.RebootMode = RebootModeNone
+	}
+
+	// invalid domains are left as they are so validation can report them
+	if domain, err := NormalizeDomain(r.Spec.Domain); err == nil {
+		r.Spec.Domain = domain
+	}
+}
+
+//+kubebuilder:webhook:path=/validate-relocation-openshift-io-v1alpha1-clusterconfig,mutating=false,failurePolicy=fail,sideEffects=None,groups=relocation.openshift.io,resources=clusterconfigs,verbs=create;update,versions=v1alpha1,name=vclusterconfig.kb.io,admissionReviewVersions=v1
+
+// ClusterConfigValidator validates ClusterConfigs against state outside the object itself
+// +kubebuilder:object:generate=false
+type ClusterConfigValidator struct {
+	Reader client.Reader
+	// Client reviews whether the requester adding completion hooks may create the Jobs the controller creates for them
+	Client client.Client
+	// MaxPerNamespace limits the number of ClusterConfigs in a single namespace so one tenant
+	// can't exhaust the shared data volume, zero means no limit
+	MaxPerNamespace int
+}
+
+var _ admission.CustomValidator = &ClusterConfigValidator{}
+
+// ValidateCreate implements admission.CustomValidator
+func (v *ClusterConfigValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	config, ok := obj.(*ClusterConfig)
+	if !ok {
+		return nil, fmt.Errorf("expected a ClusterConfig but got a %T", obj)
+	}
+	clusterconfiglog.Info("validate create", "name", config.Name, "namespace", config.Namespace)
+
+	errs := validateName(config.Name)
+	domainErrs, warnings := validateDomain(config.Spec.Domain)
+	errs = append(errs, domainErrs...)
+	warnings = append(warnings, deprecationWarnings(&config.Spec)...)
+	errs = append(errs, validateNetwork(config.Spec.Network)...)
+	errs = append(errs, validateTimezone(config.Spec.Timezone)...)
+	errs = append(errs, validateMaintenanceWindow(config.Spec.MaintenanceWindow)...)
+	errs = append(errs, validateAdditionalPullSecrets(&config.Spec)...)
+	errs = append(errs, validateExternalImageURL(config.Spec.ExternalImageURL)...)
+	errs = append(errs, validateAdoptExistingData(&config.Spec)...)
+	errs = append(errs, validateHostChecks(&config.Spec)...)
+	errs = append(errs, validateDiskFormat(&config.Spec)...)
+	errs = append(errs, validateMirrorOutput(&config.Spec)...)
+	errs = append(errs, validateCompletionHooks(config.Name, config.Spec.PostCompletionHooks)...)
+	errs = append(errs, validateIgnitionConfigOverride(config.Spec.IgnitionConfigOverride)...)
+	errs = append(errs, validateDiskEncryption(config.Spec.DiskEncryption)...)
+	errs = append(errs, validateRelease(&config.Spec)...)
+	if len(errs) > 0 {
+		return warnings, apierrors.NewInvalid(GroupVersion.WithKind("ClusterConfig").GroupKind(), config.Name, errs)
+	}
+
+	if err := v.validateQuota(ctx, config); err != nil {
+		return warnings, err
+	}
+	if err := v.validateHostDeprovision(ctx, config); err != nil {
+		return warnings, err
+	}
+	if len(config.Spec.PostCompletionHooks) > 0 {
+		return warnings, v.validateHookAccess(ctx, config)
+	}
+	return warnings, nil
+}
+
+// ValidateUpdate implements admission.CustomValidator
+func (v *ClusterConfigValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	oldConfig, ok := oldObj.(*ClusterConfig)
+	if !ok {
+		return nil, fmt.Errorf("expected a ClusterConfig but got a %T", oldObj)
+	}
+	config, ok := newObj.(*ClusterConfig)
+	if !ok {
+		return nil, fmt.Errorf("expected a ClusterConfig but got a %T", newObj)
+	}
+
+	// only check changed fields so existing configs can still be updated and deleted
+	var errs field.ErrorList
+	var warnings []string
+	if config.Spec.Domain != oldConfig.Spec.Domain {
+		errs, warnings = validateDomain(config.Spec.Domain)
+	}
+	if !reflect.DeepEqual(config.Spec.Preflight, oldConfig.Spec.Preflight) {
+		warnings = append(warnings, deprecationWarnings(&config.Spec)...)
+	}
+	if !reflect.DeepEqual(config.Spec.Network, oldConfig.Spec.Network) {
+		errs = append(errs, validateNetwork(config.Spec.Network)...)
+	}
+	if config.Spec.Timezone != oldConfig.Spec.Timezone {
+		errs = append(errs, validateTimezone(config.Spec.Timezone)...)
+	}
+	if !reflect.DeepEqual(config.Spec.MaintenanceWindow, oldConfig.Spec.MaintenanceWindow) {
+		errs = append(errs, validateMaintenanceWindow(config.Spec.MaintenanceWindow)...)
+	}
+	if !reflect.DeepEqual(config.Spec.PullSecretRef, oldConfig.Spec.PullSecretRef) ||
+		!reflect.DeepEqual(config.Spec.AdditionalPullSecretRefs, oldConfig.Spec.AdditionalPullSecretRefs) {
+		errs = append(errs, validateAdditionalPullSecrets(&config.Spec)...)
+	}
+	if config.Spec.ExternalImageURL != oldConfig.Spec.ExternalImageURL {
+		errs = append(errs, validateExternalImageURL(config.Spec.ExternalImageURL)...)
+	}
+	if config.Spec.AdoptExistingData != oldConfig.Spec.AdoptExistingData || config.Spec.ExternalImageURL != oldConfig.Spec.ExternalImageURL {
+		errs = append(errs, validateAdoptExistingData(&config.Spec)...)
+	}
+	if !reflect.DeepEqual(config.Spec.BareMetalHostRef, oldConfig.Spec.BareMetalHostRef) ||
+		!reflect.DeepEqual(config.Spec.Preflight, oldConfig.Spec.Preflight) ||
+		!reflect.DeepEqual(config.Spec.HardwareRequirements, oldConfig.Spec.HardwareRequirements) ||
+		config.Spec.InterfaceNamesFromHost != oldConfig.Spec.InterfaceNamesFromHost {
+		errs = append(errs, validateHostChecks(&config.Spec)...)
+	}
+	if !reflect.DeepEqual(config.Spec.BareMetalHostRef, oldConfig.Spec.BareMetalHostRef) || config.Spec.ExternalImageURL != oldConfig.Spec.ExternalImageURL {
+		errs = append(errs, validateDiskFormat(&config.Spec)...)
+	}
+	if config.Spec.TargetVersion != oldConfig.Spec.TargetVersion || config.Spec.MirrorOutput != oldConfig.Spec.MirrorOutput ||
+		!reflect.DeepEqual(config.Spec.ImageTagMirrors, oldConfig.Spec.ImageTagMirrors) {
+		errs = append(errs, validateMirrorOutput(&config.Spec)...)
+	}
+	if !reflect.DeepEqual(config.Spec.PostCompletionHooks, oldConfig.Spec.PostCompletionHooks) {
+		errs = append(errs, validateCompletionHooks(config.Name, config.Spec.PostCompletionHooks)...)
+	}
+	if config.Spec.IgnitionConfigOverride != oldConfig.Spec.IgnitionConfigOverride {
+		errs = append(errs, validateIgnitionConfigOverride(config.Spec.IgnitionConfigOverride)...)
+	}
+	if !reflect.DeepEqual(config.Spec.DiskEncryption, oldConfig.Spec.DiskEncryption) {
+		errs = append(errs, validateDiskEncryption(config.Spec.DiskEncryption)...)
+	}
+	if config.Spec.ReleaseImage != oldConfig.Spec.ReleaseImage ||
+		!reflect.DeepEqual(config.Spec.AllowedReleaseVersions, oldConfig.Spec.AllowedReleaseVersions) {
+		errs = append(errs, validateRelease(&config.Spec)...)
+	}
+	if len(errs) > 0 {
+		return warnings, apierrors.NewInvalid(GroupVersion.WithKind("ClusterConfig").GroupKind(), config.Name, errs)
+	}
+	if !reflect.DeepEqual(config.Spec.BareMetalHostRef, oldConfig.Spec.BareMetalHostRef) {
+		if err := v.validateHostDeprovision(ctx, config); err != nil {
+			return warnings, err
+		}
+	}
+	if len(config.Spec.PostCompletionHooks) > 0 && !reflect.DeepEqual(config.Spec.PostCompletionHooks, oldConfig.Spec.PostCompletionHooks) {
+		return warnings, v.validateHookAccess(ctx, config)
+	}
+	return warnings, nil
+}
+
+// ValidateDelete implements admission.CustomValidator
+func (v *ClusterConfigValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+//+kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+
+// validateHookAccess ensures the requester may create Jobs in the config namespace, as the controller creates the
+// completion hook Jobs with its own permissions
+func (v *ClusterConfigValidator) validateHookAccess(ctx context.Context, config *ClusterConfig) error {
+	req, err := admission.RequestFromContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get the admission request: %w", err)
+	}
+	user := req.UserInfo
+	extra := make(map[string]authorizationv1.ExtraValue, len(user.Extra))
+	for k, v := range user.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+	sar := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: config.Namespace,
+				Verb:      "create",
+				Group:     batchv1.GroupName,
+				Resource:  "jobs",
+			},
+			User:   user.Username,
+			Groups: user.Groups,
+			UID:    user.UID,
+			Extra:  extra,
+		},
+	}
+	if err := v.Client.Create(ctx, sar); err != nil {
+		return fmt.Errorf("failed to review access to create completion hook Jobs: %w", err)
+	}
+	if !sar.Status.Allowed {
+		return apierrors.NewForbidden(GroupVersion.WithResource("clusterconfigs").GroupResource(), config.Name,
+			fmt.Errorf("user %q cannot create Jobs in namespace %s so can't set completion hooks", user.Username, config.Namespace))
+	}
+	return nil
+}
+
+// validateHostDeprovision ensures the host config references isn't being deprovisioned, as the image would be
+// attached to a host the baremetal-operator is cleaning
+func (v *ClusterConfigValidator) validateHostDeprovision(ctx context.Context, config *ClusterConfig) error {
+	if v.Reader == nil || config.Spec.BareMetalHostRef == nil {
+		return nil
+	}
+	namespace := config.Spec.BareMetalHostRef.Namespace
+	if namespace == "" {
+		namespace = config.Namespace
+	}
+
+	// ClusterDeprovisions only deprovision hosts of their own namespace
+	deprovisions := &ClusterDeprovisionList{}
+	if err := v.Reader.List(ctx, deprovisions, client.InNamespace(namespace)); err != nil {
+		return fmt.Errorf("failed to list ClusterDeprovisions: %w", err)
+	}
+	for _, d := range deprovisions.Items {
+		ref := d.Spec.BareMetalHostRef
+		if ref == nil || ref.Name != config.Spec.BareMetalHostRef.Name || (ref.Namespace != "" && ref.Namespace != namespace) {
+			continue
+		}
+		if d.DeletionTimestamp.IsZero() {
+			return apierrors.NewForbidden(GroupVersion.WithResource("clusterconfigs").GroupResource(), config.Name,
+				fmt.Errorf("BareMetalHost %s/%s is being deprovisioned by ClusterDeprovision %s", namespace, ref.Name, d.Name))
+		}
+	}
+	return nil
+}
+
+// validateQuota ensures creating config won't exceed the per-namespace limit
+// Concurrent creates may briefly exceed the limit as the check is not atomic
+func (v *ClusterConfigValidator) validateQuota(ctx context.Context, config *ClusterConfig) error {
+	if v.MaxPerNamespace <= 0 {
+		return nil
+	}
+
+	configs := &ClusterConfigList{}
+	if err := v.Reader.List(ctx, configs, client.InNamespace(config.Namespace)); err != nil {
+		return fmt.Errorf("failed to list ClusterConfigs: %w", err)
+	}
+
+	active := 0
+	for _, c := range configs.Items {
+		// configs being deleted are on their way out and shouldn't block new ones
+		if c.Name != config.Name && c.DeletionTimestamp.IsZero() {
+			active++
+		}
+	}
+	if active >= v.MaxPerNamespace {
+		return apierrors.NewForbidden(GroupVersion.WithResource("clusterconfigs").GroupResource(), config.Name,
+			fmt.Errorf("namespace %s already contains the maximum of %d ClusterConfigs", config.Namespace, v.MaxPerNamespace))
+	}
+
+	return nil
+}
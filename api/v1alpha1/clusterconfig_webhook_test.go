@@ -0,0 +1,791 @@
+package v1alpha1
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	configv1 "github.com/openshift/api/config/v1"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestWebhooks(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Webhook Suite")
+}
+
+var _ = Describe("Default", func() {
+	It("defaults the BareMetalHost namespace to the config namespace", func() {
+		config := &ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "site-1"},
+			Spec: ClusterConfigSpec{
+				BareMetalHostRef: &BareMetalHostReference{Name: "host"},
+			},
+		}
+		config.Default()
+		Expect(config.Spec.BareMetalHostRef.Namespace).To(Equal("site-1"))
+	})
+
+	It("does not override a set BareMetalHost namespace", func() {
+		config := &ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "site-1"},
+			Spec: ClusterConfigSpec{
+				BareMetalHostRef: &BareMetalHostReference{Name: "host", Namespace: "hosts"},
+			},
+		}
+		config.Default()
+		Expect(config.Spec.BareMetalHostRef.Namespace).To(Equal("hosts"))
+	})
+
+	It("defaults the disk format and reboot mode", func() {
+		config := &ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "site-1"},
+			Spec: ClusterConfigSpec{
+				BareMetalHostRef: &BareMetalHostReference{Name: "host"},
+			},
+		}
+		config.Default()
+		Expect(config.Spec.BareMetalHostRef.DiskFormat).To(Equal("live-iso"))
+		Expect(config.Spec.RebootMode).To(Equal(RebootModeNone))
+
+		config.Spec.BareMetalHostRef.DiskFormat = "raw"
+		config.Spec.RebootMode = RebootModeSoft
+		config.Default()
+		Expect(config.Spec.BareMetalHostRef.DiskFormat).To(Equal("raw"))
+		Expect(config.Spec.RebootMode).To(Equal(RebootModeSoft))
+	})
+
+	It("normalizes the domain", func() {
+		config := &ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "site-1"},
+		}
+		config.Spec.Domain = "Bücher.Example.com."
+		config.Default()
+		Expect(config.Spec.Domain).To(Equal("xn--bcher-kva.example.com"))
+	})
+
+	It("succeeds without a BareMetalHost reference", func() {
+		config := &ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "site-1"},
+		}
+		config.Default()
+		Expect(config.Spec.BareMetalHostRef).To(BeNil())
+	})
+})
+
+var _ = Describe("ClusterConfigValidator", func() {
+	var (
+		c   client.Client
+		v   *ClusterConfigValidator
+		ctx = context.Background()
+	)
+
+	newConfig := func(namespace, name string) *ClusterConfig {
+		return &ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		}
+	}
+
+	BeforeEach(func() {
+		s := runtime.NewScheme()
+		Expect(AddToScheme(s)).To(Succeed())
+		c = fakeclient.NewClientBuilder().WithScheme(s).Build()
+		v = &ClusterConfigValidator{Reader: c, MaxPerNamespace: 2}
+	})
+
+	It("allows configs up to the namespace limit", func() {
+		Expect(c.Create(ctx, newConfig("site-1", "one"))).To(Succeed())
+		Expect(c.Create(ctx, newConfig("site-2", "other"))).To(Succeed())
+		Expect(c.Create(ctx, newConfig("site-2", "another"))).To(Succeed())
+
+		_, err := v.ValidateCreate(ctx, newConfig("site-1", "two"))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("rejects configs beyond the namespace limit", func() {
+		Expect(c.Create(ctx, newConfig("site-1", "one"))).To(Succeed())
+		Expect(c.Create(ctx, newConfig("site-1", "two"))).To(Succeed())
+
+		_, err := v.ValidateCreate(ctx, newConfig("site-1", "three"))
+		Expect(apierrors.IsForbidden(err)).To(BeTrue())
+	})
+
+	It("does not count configs being deleted", func() {
+		Expect(c.Create(ctx, newConfig("site-1", "one"))).To(Succeed())
+		deleting := newConfig("site-1", "two")
+		deleting.Finalizers = []string{"test"}
+		Expect(c.Create(ctx, deleting)).To(Succeed())
+		Expect(c.Delete(ctx, deleting)).To(Succeed())
+
+		_, err := v.ValidateCreate(ctx, newConfig("site-1", "three"))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("allows any number of configs without a limit", func() {
+		v.MaxPerNamespace = 0
+		Expect(c.Create(ctx, newConfig("site-1", "one"))).To(Succeed())
+		Expect(c.Create(ctx, newConfig("site-1", "two"))).To(Succeed())
+
+		_, err := v.ValidateCreate(ctx, newConfig("site-1", "three"))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("rejects configs referencing a host being deprovisioned", func() {
+		Expect(c.Create(ctx, &ClusterDeprovision{
+			ObjectMeta: metav1.ObjectMeta{Name: "wipe", Namespace: "hosts"},
+			Spec:       ClusterDeprovisionSpec{BareMetalHostRef: &BareMetalHostReference{Name: "host"}},
+		})).To(Succeed())
+
+		config := newConfig("site-1", "one")
+		config.Spec.BareMetalHostRef = &BareMetalHostReference{Name: "host", Namespace: "hosts"}
+		_, err := v.ValidateCreate(ctx, config)
+		Expect(apierrors.IsForbidden(err)).To(BeTrue())
+
+		config.Spec.BareMetalHostRef.Name = "other"
+		_, err = v.ValidateCreate(ctx, config)
+		Expect(err).NotTo(HaveOccurred())
+
+		updated := config.DeepCopy()
+		updated.Spec.BareMetalHostRef.Name = "host"
+		_, err = v.ValidateUpdate(ctx, config, updated)
+		Expect(apierrors.IsForbidden(err)).To(BeTrue())
+	})
+
+	It("allows configs referencing a host whose deprovision is being deleted", func() {
+		deprovision := &ClusterDeprovision{
+			ObjectMeta: metav1.ObjectMeta{Name: "wipe", Namespace: "site-1", Finalizers: []string{"test"}},
+			Spec:       ClusterDeprovisionSpec{BareMetalHostRef: &BareMetalHostReference{Name: "host"}},
+		}
+		Expect(c.Create(ctx, deprovision)).To(Succeed())
+		Expect(c.Delete(ctx, deprovision)).To(Succeed())
+
+		config := newConfig("site-1", "one")
+		config.Spec.BareMetalHostRef = &BareMetalHostReference{Name: "host"}
+		_, err := v.ValidateCreate(ctx, config)
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
+
+var _ = Describe("ClusterConfig name and domain validation", func() {
+	var v *ClusterConfigValidator
+
+	BeforeEach(func() {
+		v = &ClusterConfigValidator{}
+	})
+
+	newConfig := func(name, domain string) *ClusterConfig {
+		config := &ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "site-1"},
+		}
+		config.Spec.Domain = domain
+		return config
+	}
+
+	expectInvalid := func(config *ClusterConfig, message string) {
+		_, err := v.ValidateCreate(context.Background(), config)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue(), "expected invalid but got %v", err)
+		Expect(err.Error()).To(ContainSubstring(message))
+	}
+
+	It("accepts a valid name and domain", func() {
+		warnings, err := v.ValidateCreate(context.Background(), newConfig("site-1", "site-1.example.com"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(warnings).To(BeEmpty())
+	})
+
+	It("rejects long names", func() {
+		expectInvalid(newConfig(strings.Repeat("a", MaxNameLength+1), "example.com"), "metadata.name")
+	})
+
+	It("rejects names that aren't DNS labels", func() {
+		expectInvalid(newConfig("site.one", "example.com"), "metadata.name")
+	})
+
+	It("rejects domains that aren't normalized", func() {
+		expectInvalid(newConfig("site", "Bücher.example.com"), `use "xn--bcher-kva.example.com" instead`)
+		expectInvalid(newConfig("site", "Example.com"), `use "example.com" instead`)
+	})
+
+	It("rejects invalid domains", func() {
+		expectInvalid(newConfig("site", "under_score.example.com"), "spec.domain")
+		expectInvalid(newConfig("site", strings.Repeat("a", 64)+".example.com"), "spec.domain")
+	})
+
+	It("rejects domains too long for the cluster names", func() {
+		long := strings.Repeat(strings.Repeat("a", 60)+".", 4) + "com"
+		expectInvalid(newConfig("site", long), "api-int.")
+	})
+
+	It("warns about domains too long for a generated ingress certificate", func() {
+		warnings, err := v.ValidateCreate(context.Background(), newConfig("site", strings.Repeat("a", 50)+".example.com"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(warnings).To(ContainElement(ContainSubstring("ingressCertRef")))
+	})
+
+	It("only validates changed domains on update", func() {
+		old := newConfig("site", "Example.com")
+		updated := old.DeepCopy()
+		updated.Labels = map[string]string{"changed": "true"}
+		_, err := v.ValidateUpdate(context.Background(), old, updated)
+		Expect(err).NotTo(HaveOccurred())
+
+		updated.Spec.Domain = "Other.com"
+		_, err = v.ValidateUpdate(context.Background(), old, updated)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+	})
+})
+
+var _ = Describe("ClusterConfig network validation", func() {
+	var v *ClusterConfigValidator
+
+	BeforeEach(func() {
+		v = &ClusterConfigValidator{}
+	})
+
+	newConfig := func(network *ClusterNetwork) *ClusterConfig {
+		config := &ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "site", Namespace: "site-1"},
+		}
+		config.Spec.Domain = "site.example.com"
+		config.Spec.Network = network
+		return config
+	}
+
+	expectInvalid := func(network *ClusterNetwork, message string) {
+		_, err := v.ValidateCreate(context.Background(), newConfig(network))
+		Expect(apierrors.IsInvalid(err)).To(BeTrue(), "expected invalid but got %v", err)
+		Expect(err.Error()).To(ContainSubstring(message))
+	}
+
+	It("accepts dual stack VIPs in the machine networks", func() {
+		_, err := v.ValidateCreate(context.Background(), newConfig(&ClusterNetwork{
+			APIVIPs:         []string{"192.168.111.5", "fd2e:6f44:5dd8::5"},
+			IngressVIPs:     []string{"192.168.111.4", "fd2e:6f44:5dd8::4"},
+			MachineNetworks: []string{"192.168.111.0/24", "fd2e:6f44:5dd8::/64"},
+		}))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("accepts VIPs without machine networks", func() {
+		_, err := v.ValidateCreate(context.Background(), newConfig(&ClusterNetwork{APIVIPs: []string{"10.0.0.5"}}))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("rejects invalid addresses", func() {
+		expectInvalid(&ClusterNetwork{APIVIPs: []string{"not-an-ip"}}, "spec.network.apiVIPs[0]")
+		expectInvalid(&ClusterNetwork{MachineNetworks: []string{"10.0.0.0"}}, "spec.network.machineNetworks[0]")
+	})
+
+	It("rejects multiple VIPs of the same family", func() {
+		expectInvalid(&ClusterNetwork{IngressVIPs: []string{"10.0.0.4", "10.0.0.5"}}, "spec.network.ingressVIPs[1]")
+	})
+
+	It("rejects VIPs outside the machine networks", func() {
+		expectInvalid(&ClusterNetwork{
+			APIVIPs:         []string{"10.0.0.5"},
+			MachineNetworks: []string{"192.168.111.0/24"},
+		}, "must be in one of the machine networks")
+	})
+
+	It("only validates a changed network on update", func() {
+		old := newConfig(&ClusterNetwork{APIVIPs: []string{"not-an-ip"}})
+		updated := old.DeepCopy()
+		updated.Labels = map[string]string{"changed": "true"}
+		_, err := v.ValidateUpdate(context.Background(), old, updated)
+		Expect(err).NotTo(HaveOccurred())
+
+		updated.Spec.Network.IngressVIPs = []string{"10.0.0.4"}
+		_, err = v.ValidateUpdate(context.Background(), old, updated)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+	})
+})
+
+var _ = Describe("ClusterConfig time zone validation", func() {
+	var v *ClusterConfigValidator
+
+	BeforeEach(func() {
+		v = &ClusterConfigValidator{}
+	})
+
+	newConfig := func(timezone string) *ClusterConfig {
+		config := &ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "site", Namespace: "site-1"},
+		}
+		config.Spec.Domain = "site.example.com"
+		config.Spec.Timezone = timezone
+		return config
+	}
+
+	It("accepts IANA time zone names", func() {
+		for _, tz := range []string{"", "UTC", "America/Chicago", "Europe/Berlin"} {
+			_, err := v.ValidateCreate(context.Background(), newConfig(tz))
+			Expect(err).NotTo(HaveOccurred(), tz)
+		}
+	})
+
+	It("rejects unknown time zones", func() {
+		for _, tz := range []string{"Local", "America/Nowhere", "../etc/passwd"} {
+			_, err := v.ValidateCreate(context.Background(), newConfig(tz))
+			Expect(apierrors.IsInvalid(err)).To(BeTrue(), "expected %q to be invalid but got %v", tz, err)
+			Expect(err.Error()).To(ContainSubstring("spec.timezone"))
+		}
+	})
+
+	It("only validates a changed time zone on update", func() {
+		old := newConfig("America/Nowhere")
+		updated := old.DeepCopy()
+		updated.Labels = map[string]string{"changed": "true"}
+		_, err := v.ValidateUpdate(context.Background(), old, updated)
+		Expect(err).NotTo(HaveOccurred())
+
+		updated.Spec.Timezone = "Mars/Olympus_Mons"
+		_, err = v.ValidateUpdate(context.Background(), old, updated)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+	})
+})
+
+var _ = Describe("ClusterConfig maintenance window validation", func() {
+	var v *ClusterConfigValidator
+
+	BeforeEach(func() {
+		v = &ClusterConfigValidator{}
+	})
+
+	newConfig := func(window *MaintenanceWindow) *ClusterConfig {
+		config := &ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "site", Namespace: "site-1"},
+		}
+		config.Spec.Domain = "site.example.com"
+		config.Spec.MaintenanceWindow = window
+		return config
+	}
+
+	It("accepts valid windows", func() {
+		for _, window := range []*MaintenanceWindow{
+			nil,
+			{Start: "22:00", Duration: metav1.Duration{Duration: 4 * time.Hour}},
+			{Start: "02:30", Duration: metav1.Duration{Duration: time.Hour}, Days: []Weekday{"Saturday", "Sunday"}, TimeZone: "Europe/Berlin"},
+		} {
+			_, err := v.ValidateCreate(context.Background(), newConfig(window))
+			Expect(err).NotTo(HaveOccurred())
+		}
+	})
+
+	It("rejects windows the controller can't parse", func() {
+		for field, window := range map[string]*MaintenanceWindow{
+			"spec.maintenanceWindow.start":    {Start: "25:00", Duration: metav1.Duration{Duration: time.Hour}},
+			"spec.maintenanceWindow.duration": {Start: "22:00"},
+			"spec.maintenanceWindow.timeZone": {Start: "22:00", Duration: metav1.Duration{Duration: time.Hour}, TimeZone: "Local"},
+			"spec.maintenanceWindow.days[0]":  {Start: "22:00", Duration: metav1.Duration{Duration: time.Hour}, Days: []Weekday{"Someday"}},
+		} {
+			_, err := v.ValidateCreate(context.Background(), newConfig(window))
+			Expect(apierrors.IsInvalid(err)).To(BeTrue(), "expected %s to be invalid but got %v", field, err)
+			Expect(err.Error()).To(ContainSubstring(field))
+		}
+	})
+
+	It("only validates a changed window on update", func() {
+		old := newConfig(&MaintenanceWindow{Start: "22:00"})
+		updated := old.DeepCopy()
+		updated.Labels = map[string]string{"changed": "true"}
+		_, err := v.ValidateUpdate(context.Background(), old, updated)
+		Expect(err).NotTo(HaveOccurred())
+
+		updated.Spec.MaintenanceWindow.Start = "23:00"
+		_, err = v.ValidateUpdate(context.Background(), old, updated)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+	})
+})
+
+var _ = Describe("ClusterConfig additional pull secret validation", func() {
+	var v *ClusterConfigValidator
+
+	BeforeEach(func() {
+		v = &ClusterConfigValidator{}
+	})
+
+	newConfig := func() *ClusterConfig {
+		config := &ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "site", Namespace: "site-1"},
+		}
+		config.Spec.Domain = "site.example.com"
+		config.Spec.PullSecretRef = &corev1.SecretReference{Name: "pull-secret", Namespace: "site-1"}
+		config.Spec.AdditionalPullSecretRefs = []corev1.SecretReference{{Name: "site-registry", Namespace: "site-1"}}
+		return config
+	}
+
+	It("accepts additional pull secrets with a pull secret", func() {
+		_, err := v.ValidateCreate(context.Background(), newConfig())
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("rejects additional pull secrets without a pull secret", func() {
+		config := newConfig()
+		config.Spec.PullSecretRef = nil
+		_, err := v.ValidateCreate(context.Background(), config)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.pullSecretRef"))
+
+		old := newConfig()
+		_, err = v.ValidateUpdate(context.Background(), old, config)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+	})
+})
+
+var _ = Describe("ClusterConfig external image validation", func() {
+	var v *ClusterConfigValidator
+
+	BeforeEach(func() {
+		v = &ClusterConfigValidator{}
+	})
+
+	newConfig := func(imageURL string) *ClusterConfig {
+		config := &ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "site", Namespace: "site-1"},
+		}
+		config.Spec.Domain = "site.example.com"
+		config.Spec.ExternalImageURL = imageURL
+		return config
+	}
+
+	It("accepts absolute http and https URLs", func() {
+		for _, u := range []string{"", "http://images.example.com/site.iso", "https://images.example.com:8443/isos/site.iso?version=2"} {
+			_, err := v.ValidateCreate(context.Background(), newConfig(u))
+			Expect(err).NotTo(HaveOccurred(), u)
+		}
+	})
+
+	It("rejects other URLs", func() {
+		for _, u := range []string{"images.example.com/site.iso", "file:///isos/site.iso", "https://", "http://%zz"} {
+			_, err := v.ValidateCreate(context.Background(), newConfig(u))
+			Expect(apierrors.IsInvalid(err)).To(BeTrue(), "expected %q to be invalid but got %v", u, err)
+			Expect(err.Error()).To(ContainSubstring("spec.externalImageURL"))
+		}
+	})
+
+	It("rejects adopting existing data for an external image", func() {
+		config := newConfig("https://images.example.com/site.iso")
+		config.Spec.AdoptExistingData = true
+		_, err := v.ValidateCreate(context.Background(), config)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.adoptExistingData"))
+
+		old := newConfig("")
+		old.Spec.AdoptExistingData = true
+		_, err = v.ValidateUpdate(context.Background(), old, config)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+	})
+
+	It("only allows other disk formats for an external image", func() {
+		config := newConfig("https://images.example.com/site.qcow2")
+		config.Spec.BareMetalHostRef = &BareMetalHostReference{Name: "host", DiskFormat: "qcow2"}
+		_, err := v.ValidateCreate(context.Background(), config)
+		Expect(err).NotTo(HaveOccurred())
+
+		served := newConfig("")
+		served.Spec.BareMetalHostRef = config.Spec.BareMetalHostRef
+		_, err = v.ValidateUpdate(context.Background(), config, served)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.bareMetalHostRef.diskFormat"))
+	})
+})
+
+var _ = Describe("ClusterConfig host check validation", func() {
+	var v *ClusterConfigValidator
+
+	BeforeEach(func() {
+		v = &ClusterConfigValidator{}
+	})
+
+	newConfig := func() *ClusterConfig {
+		return &ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "site", Namespace: "sites"},
+			Spec: ClusterConfigSpec{
+				Preflight:              &PreflightChecks{},
+				HardwareRequirements:   &HardwareRequirements{MinNICs: 1},
+				InterfaceNamesFromHost: true,
+			},
+		}
+	}
+
+	It("requires a BareMetalHost for host checks", func() {
+		config := newConfig()
+		_, err := v.ValidateCreate(context.Background(), config)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.preflight"))
+		Expect(err.Error()).To(ContainSubstring("spec.hardwareRequirements"))
+		Expect(err.Error()).To(ContainSubstring("spec.interfaceNamesFromHost"))
+
+		config.Spec.BareMetalHostRef = &BareMetalHostReference{Name: "host", Namespace: "hosts"}
+		_, err = v.ValidateCreate(context.Background(), config)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("rejects removing the BareMetalHost of a config with host checks", func() {
+		old := newConfig()
+		old.Spec.BareMetalHostRef = &BareMetalHostReference{Name: "host", Namespace: "hosts"}
+		_, err := v.ValidateUpdate(context.Background(), old, newConfig())
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+	})
+
+	It("warns about the deprecated preflight disk size", func() {
+		config := newConfig()
+		config.Spec.BareMetalHostRef = &BareMetalHostReference{Name: "host", Namespace: "hosts"}
+		minSize := resource.MustParse("100Gi")
+		config.Spec.Preflight.MinDiskSize = &minSize
+		warnings, err := v.ValidateCreate(context.Background(), config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(warnings).To(ContainElement(ContainSubstring("spec.hardwareRequirements.minDiskSize")))
+	})
+})
+
+var _ = Describe("ClusterConfig mirror output validation", func() {
+	var v *ClusterConfigValidator
+
+	BeforeEach(func() {
+		v = &ClusterConfigValidator{}
+	})
+
+	It("defaults the mirror output from the target version", func() {
+		for version, output := range map[string]MirrorOutput{
+			"":     MirrorOutputImageDigestMirrorSet,
+			"4.10": MirrorOutputImageContentSourcePolicy,
+			"4.12": MirrorOutputImageContentSourcePolicy,
+			"4.13": MirrorOutputImageDigestMirrorSet,
+			"4.14": MirrorOutputImageDigestMirrorSet,
+			"5.0":  MirrorOutputImageDigestMirrorSet,
+		} {
+			Expect(EffectiveMirrorOutput(&ClusterConfigSpec{TargetVersion: version})).To(Equal(output), version)
+		}
+		Expect(EffectiveMirrorOutput(&ClusterConfigSpec{TargetVersion: "4.12", MirrorOutput: MirrorOutputBoth})).To(Equal(MirrorOutputBoth))
+	})
+
+	It("rejects tag mirrors for clusters without ImageTagMirrorSets", func() {
+		config := &ClusterConfig{ObjectMeta: metav1.ObjectMeta{Name: "site", Namespace: "site-1"}}
+		config.Spec.Domain = "site.example.com"
+		config.Spec.ImageTagMirrors = []configv1.ImageTagMirrors{{Source: "quay.io/example", Mirrors: []configv1.ImageMirror{"mirror.example.com/example"}}}
+		_, err := v.ValidateCreate(context.Background(), config)
+		Expect(err).NotTo(HaveOccurred())
+
+		updated := config.DeepCopy()
+		updated.Spec.TargetVersion = "4.12"
+		_, err = v.ValidateCreate(context.Background(), updated)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.imageTagMirrors"))
+		_, err = v.ValidateUpdate(context.Background(), config, updated)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+	})
+})
+
+var _ = Describe("ClusterConfig completion hook validation", func() {
+	var (
+		v       *ClusterConfigValidator
+		ctx     context.Context
+		lastSAR *authorizationv1.SubjectAccessReview
+		allowed bool
+	)
+
+	BeforeEach(func() {
+		allowed = true
+		lastSAR = nil
+		c := interceptor.NewClient(fakeclient.NewClientBuilder().Build(), interceptor.Funcs{
+			Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+				if sar, ok := obj.(*authorizationv1.SubjectAccessReview); ok {
+					lastSAR = sar
+					sar.Status.Allowed = allowed
+					return nil
+				}
+				return c.Create(ctx, obj, opts...)
+			},
+		})
+		v = &ClusterConfigValidator{Client: c}
+		ctx = admission.NewContextWithRequest(context.Background(), admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+			UserInfo: authenticationv1.UserInfo{Username: "site-admin", Groups: []string{"site-admins"}},
+		}})
+	})
+
+	newConfig := func(pod corev1.PodSpec) *ClusterConfig {
+		config := &ClusterConfig{ObjectMeta: metav1.ObjectMeta{Name: "site", Namespace: "site-1"}}
+		config.Spec.PostCompletionHooks = []CompletionHook{{Name: "inventory"}}
+		config.Spec.PostCompletionHooks[0].Template.Spec.Template.Spec = pod
+		return config
+	}
+
+	It("rejects hooks whose Job name is too long", func() {
+		config := newConfig(corev1.PodSpec{})
+		_, err := v.ValidateCreate(ctx, config)
+		Expect(err).NotTo(HaveOccurred())
+
+		updated := config.DeepCopy()
+		updated.Spec.PostCompletionHooks = append(updated.Spec.PostCompletionHooks, CompletionHook{Name: strings.Repeat("a", 60)})
+		_, err = v.ValidateUpdate(ctx, config, updated)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.postCompletionHooks[1].name"))
+	})
+
+	It("checks the requester can create Jobs in the config namespace", func() {
+		_, err := v.ValidateCreate(ctx, newConfig(corev1.PodSpec{}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lastSAR.Spec.User).To(Equal("site-admin"))
+		Expect(lastSAR.Spec.Groups).To(ConsistOf("site-admins"))
+		Expect(*lastSAR.Spec.ResourceAttributes).To(Equal(authorizationv1.ResourceAttributes{
+			Namespace: "site-1",
+			Verb:      "create",
+			Group:     "batch",
+			Resource:  "jobs",
+		}))
+
+		allowed = false
+		_, err = v.ValidateCreate(ctx, newConfig(corev1.PodSpec{}))
+		Expect(apierrors.IsForbidden(err)).To(BeTrue())
+	})
+
+	It("only reviews access when the hooks change", func() {
+		allowed = false
+		config := newConfig(corev1.PodSpec{})
+		updated := config.DeepCopy()
+		updated.Spec.Timezone = "UTC"
+		_, err := v.ValidateUpdate(ctx, config, updated)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lastSAR).To(BeNil())
+
+		_, err = v.ValidateCreate(ctx, &ClusterConfig{ObjectMeta: metav1.ObjectMeta{Name: "site", Namespace: "site-1"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lastSAR).To(BeNil())
+	})
+
+	It("rejects pods which could escalate privileges", func() {
+		privileged := true
+		_, err := v.ValidateCreate(ctx, newConfig(corev1.PodSpec{
+			ServiceAccountName: "cluster-admin",
+			HostNetwork:        true,
+			Volumes:            []corev1.Volume{{Name: "root", VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: "/"}}}},
+			Containers:         []corev1.Container{{Name: "update", SecurityContext: &corev1.SecurityContext{Privileged: &privileged}}},
+		}))
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		path := "spec.postCompletionHooks[0].template.spec.template.spec."
+		Expect(err.Error()).To(ContainSubstring(path + "serviceAccountName"))
+		Expect(err.Error()).To(ContainSubstring(path + "hostNetwork"))
+		Expect(err.Error()).To(ContainSubstring(path + "volumes[0].hostPath"))
+		Expect(err.Error()).To(ContainSubstring(path + "containers[0].securityContext.privileged"))
+	})
+
+	It("allows the completion hook service account", func() {
+		_, err := v.ValidateCreate(ctx, newConfig(corev1.PodSpec{ServiceAccountName: CompletionHookServiceAccount}))
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
+
+var _ = Describe("ClusterConfig ignition config override validation", func() {
+	var v *ClusterConfigValidator
+
+	BeforeEach(func() {
+		v = &ClusterConfigValidator{}
+	})
+
+	validate := func(override string) error {
+		config := &ClusterConfig{ObjectMeta: metav1.ObjectMeta{Name: "site", Namespace: "site-1"}}
+		config.Spec.IgnitionConfigOverride = override
+		_, err := v.ValidateCreate(context.Background(), config)
+		return err
+	}
+
+	It("accepts version 3 configs", func() {
+		Expect(validate(`{"ignition":{"version":"3.2.0"},"storage":{"files":[{"path":"/etc/motd","contents":{"source":"data:,hello"}}]}}`)).To(Succeed())
+	})
+
+	It("rejects invalid JSON", func() {
+		err := validate(`{"ignition":`)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.ignitionConfigOverride"))
+	})
+
+	It("rejects configs without a version 3 ignition version", func() {
+		Expect(apierrors.IsInvalid(validate(`{"storage":{}}`))).To(BeTrue())
+		Expect(apierrors.IsInvalid(validate(`{"ignition":{"version":"2.2.0"}}`))).To(BeTrue())
+	})
+
+	It("only validates a changed override on update", func() {
+		config := &ClusterConfig{ObjectMeta: metav1.ObjectMeta{Name: "site", Namespace: "site-1"}}
+		config.Spec.IgnitionConfigOverride = `{"ignition":{"version":"2.2.0"}}`
+		updated := config.DeepCopy()
+		updated.Spec.Timezone = "UTC"
+		_, err := v.ValidateUpdate(context.Background(), config, updated)
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
+
+var _ = Describe("ClusterConfig disk encryption validation", func() {
+	validate := func(encryption *DiskEncryption) error {
+		config := &ClusterConfig{ObjectMeta: metav1.ObjectMeta{Name: "site", Namespace: "site-1"}}
+		config.Spec.DiskEncryption = encryption
+		_, err := (&ClusterConfigValidator{}).ValidateCreate(context.Background(), config)
+		return err
+	}
+	tang := TangServer{URL: "http://tang.example.com:7500", Thumbprint: "PLjNyRdGw03zlRoGjQYMahSZGu9"}
+
+	It("accepts valid configurations", func() {
+		Expect(validate(&DiskEncryption{Mode: DiskEncryptionModeTPM2})).To(Succeed())
+		Expect(validate(&DiskEncryption{Mode: DiskEncryptionModeTang, TangServers: []TangServer{tang}})).To(Succeed())
+	})
+
+	It("requires tang servers in tang mode", func() {
+		err := validate(&DiskEncryption{Mode: DiskEncryptionModeTang})
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.diskEncryption.tangServers"))
+	})
+
+	It("rejects tang servers in tpm2 mode", func() {
+		Expect(apierrors.IsInvalid(validate(&DiskEncryption{Mode: DiskEncryptionModeTPM2, TangServers: []TangServer{tang}}))).To(BeTrue())
+	})
+
+	It("rejects invalid tang servers", func() {
+		err := validate(&DiskEncryption{Mode: DiskEncryptionModeTang, TangServers: []TangServer{{URL: "tang.example.com"}}})
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.diskEncryption.tangServers[0].url"))
+		Expect(err.Error()).To(ContainSubstring("spec.diskEncryption.tangServers[0].thumbprint"))
+	})
+})
+
+var _ = Describe("ClusterConfig release validation", func() {
+	validate := func(image string, versions ...string) error {
+		config := &ClusterConfig{ObjectMeta: metav1.ObjectMeta{Name: "site", Namespace: "site-1"}}
+		config.Spec.ReleaseImage = image
+		config.Spec.AllowedReleaseVersions = versions
+		_, err := (&ClusterConfigValidator{}).ValidateCreate(context.Background(), config)
+		return err
+	}
+	digest := "quay.io/openshift-release-dev/ocp-release@sha256:" + strings.Repeat("a", 64)
+
+	It("accepts releases pinned by digest", func() {
+		Expect(validate(digest)).To(Succeed())
+		Expect(validate(digest, "4.14.3", "4.15.0-rc.1")).To(Succeed())
+		Expect(validate("", "4.14.3")).To(Succeed())
+	})
+
+	It("rejects release images referenced by tag", func() {
+		err := validate("quay.io/openshift-release-dev/ocp-release:4.14.3-x86_64")
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.releaseImage"))
+	})
+
+	It("rejects invalid versions", func() {
+		err := validate(digest, "4.14")
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.allowedReleaseVersions[0]"))
+	})
+})
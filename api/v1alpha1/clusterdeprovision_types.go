@@ -0,0 +1,112 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ErasePolicy is how the disks of a decommissioned host are wiped
+// +kubebuilder:validation:Enum=Metadata
+type ErasePolicy string
+
+const (
+	// ErasePolicyMetadata removes partition tables and filesystem signatures with the automated cleaning of the
+	// baremetal-operator, which is quick but leaves data recoverable
+	ErasePolicyMetadata ErasePolicy = "Metadata"
+)
+
+// ClusterDeprovisionSpec defines the desired state of ClusterDeprovision
+type ClusterDeprovisionSpec struct {
+	// BareMetalHostRef identifies the host of the site to wipe, it must be in the ClusterDeprovision namespace
+	// NetworkDataRef isn't used as nothing is provisioned on the host
+	BareMetalHostRef *BareMetalHostReference `json:"bareMetalHostRef"`
+
+	// ErasePolicy is how the disks of the host are wiped
+	// +kubebuilder:default=Metadata
+	// +optional
+	ErasePolicy ErasePolicy `json:"erasePolicy,omitempty"`
+
+	// PowerOff powers the host off once its disks are wiped instead of leaving it running
+	// +optional
+	PowerOff bool `json:"powerOff,omitempty"`
+}
+
+// ClusterDeprovisionStatus defines the observed state of ClusterDeprovision
+type ClusterDeprovisionStatus struct {
+	// ObservedGeneration is the generation of the spec the conditions were set for
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions contains the HostDeprovisioned condition
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+const (
+	// HostDeprovisionedCondition is true once the baremetal-operator has deprovisioned and cleaned the host
+	HostDeprovisionedCondition = "HostDeprovisioned"
+)
+
+const (
+	// HostDeprovisionedReason is used once the host has been deprovisioned and its disks cleaned
+	HostDeprovisionedReason = "Deprovisioned"
+	// DeprovisioningReason is used while the baremetal-operator deprovisions and cleans the host
+	DeprovisioningReason = "Deprovisioning"
+	// HostInUseReason is used while a ClusterConfig still references the host
+	HostInUseReason = "HostInUse"
+	// DeprovisionFailedReason is used when the host can't be deprovisioned
+	DeprovisionFailedReason = "DeprovisionFailed"
+)
+
+// ClusterDeprovisionAnnotation is set on a BareMetalHost to the namespace/name of the ClusterDeprovision wiping it.
+// ClusterConfigs can't attach images to the host while it is set
+const ClusterDeprovisionAnnotation = "relocation.openshift.io/cluster-deprovision"
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:categories=relocation
+//+kubebuilder:printcolumn:name="BMH",type=string,JSONPath=`.spec.bareMetalHostRef.name`
+//+kubebuilder:printcolumn:name="Erase Policy",type=string,JSONPath=`.spec.erasePolicy`
+//+kubebuilder:printcolumn:name="Deprovisioned",type=string,JSONPath=`.status.conditions[?(@.type=="HostDeprovisioned")].status`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+//+kubebuilder:validation:XValidation:rule="size(self.metadata.name) <= 63 && self.metadata.name.matches('^[a-z0-9]([-a-z0-9]*[a-z0-9])?$')",message="metadata.name must be a DNS label of at most 63 characters"
+//+operator-sdk:csv:customresourcedefinitions:displayName="Cluster Deprovision",resources={{BareMetalHost,v1alpha1,""}}
+
+// ClusterDeprovision deprovisions the host of a decommissioned site with the baremetal-operator, which wipes its disks
+type ClusterDeprovision struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ClusterDeprovisionSpec   `json:"spec,omitempty"`
+	Status ClusterDeprovisionStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ClusterDeprovisionList contains a list of ClusterDeprovision
+type ClusterDeprovisionList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterDeprovision `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterDeprovision{}, &ClusterDeprovisionList{})
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RelocationServiceConfigName is the name of the only RelocationServiceConfig the manager reads
+const RelocationServiceConfigName = "cluster"
+
+const (
+	// DefaultConsoleLogInterval is how often console output is captured when a console log source is set
+	DefaultConsoleLogInterval = "1m"
+	// DefaultConsoleLogMaxSize is the number of bytes of console output kept for each attempt
+	DefaultConsoleLogMaxSize = 65536
+)
+
+// RelocationServiceConfigSpec overrides the environment configuration of the manager
+// Fields which aren't set keep the value from the manager environment
+type RelocationServiceConfigSpec struct {
+	// ServiceScheme is the scheme hosts download images from the image service with
+	// +kubebuilder:validation:Enum=http;https
+	// +optional
+	ServiceScheme string `json:"serviceScheme,omitempty"`
+
+	// ImageBasicAuth adds the basic auth credentials of the ClusterConfig namespace to image URLs, the image
+	// service must then be served over https
+	// +optional
+	ImageBasicAuth *bool `json:"imageBasicAuth,omitempty"`
+
+	// Endpoint configures the image Service, Route and NetworkPolicy created by the manager
+	// +optional
+	Endpoint *EndpointConfig `json:"endpoint,omitempty"`
+
+	// ZoneServiceURLs maps each network zone to the URL the image service is reachable at from it
+	// +optional
+	ZoneServiceURLs map[string]string `json:"zoneServiceURLs,omitempty"`
+
+	// ZoneCacheURLs maps each network zone to an HTTP cache images are uploaded to for hosts in that zone
+	// +optional
+	ZoneCacheURLs map[string]string `json:"zoneCacheURLs,omitempty"`
+
+	// ConsoleLog configures capturing host console output during relocation attempts
+	// +optional
+	ConsoleLog *ConsoleLogConfig `json:"consoleLog,omitempty"`
+
+	// ResyncPeriod is how often each ClusterConfig is reconciled without any change to correct drift, zero disables it
+	// +optional
+	ResyncPeriod *metav1.Duration `json:"resyncPeriod,omitempty"`
+
+	// NotifyWindow is how long a repeated problem isn't reported again, zero reports every time
+	// +optional
+	NotifyWindow *metav1.Duration `json:"notifyWindow,omitempty"`
+
+	// MaxClusterConfigsPerNamespace limits the number of ClusterConfigs admitted in a single namespace, zero means no limit
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxClusterConfigsPerNamespace *int32 `json:"maxClusterConfigsPerNamespace,omitempty"`
+}
+
+// EndpointConfig configures the image server endpoint managed by the manager
+type EndpointConfig struct {
+	// Manage creates the image Service at startup instead of relying on the install manifests
+	Manage bool `json:"manage"`
+
+	// Route exposes the image Service with a reencrypt Route, it requires the https service scheme
+	// +optional
+	Route bool `json:"route,omitempty"`
+
+	// RouteHost is the host of the Route, OpenShift generates one if it is empty
+	// +optional
+	RouteHost string `json:"routeHost,omitempty"`
+
+	// AllowedCIDRs are the networks allowed to reach the image server, other traffic is refused by a NetworkPolicy
+	// +optional
+	AllowedCIDRs []string `json:"allowedCIDRs,omitempty"`
+}
+
+// ConsoleLogConfig configures capturing host console output
+type ConsoleLogConfig struct {
+	// SourceURL is fetched for the console output of a host. {namespace} and {name} are replaced with those of
+	// the BareMetalHost and {bmc} with the host of its BMC address
+	SourceURL string `json:"sourceURL"`
+
+	// Interval is how often console output is captured while an attempt is in progress
+	// +kubebuilder:default="1m"
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+
+	// MaxSize is the number of bytes at the end of the console output kept for each attempt
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=65536
+	// +optional
+	MaxSize *int64 `json:"maxSize,omitempty"`
+}
+
+// RelocationServiceConfigStatus reports whether the manager is running with the spec
+type RelocationServiceConfigStatus struct {
+	// ObservedGeneration is the generation of the spec the conditions were set for
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions are the Valid and Applied conditions
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+const (
+	// ServiceConfigValidCondition is false when the spec contains invalid or conflicting options
+	ServiceConfigValidCondition = "Valid"
+	// ServiceConfigAppliedCondition is true when the running manager uses the current spec
+	ServiceConfigAppliedCondition = "Applied"
+)
+
+const (
+	// ServiceConfigValidReason is used when the spec has no errors
+	ServiceConfigValidReason = "Valid"
+	// ServiceConfigInvalidReason is used when the spec has errors, the manager then only uses its environment
+	ServiceConfigInvalidReason = "InvalidConfiguration"
+	// ServiceConfigAppliedReason is used when the running manager uses the current spec
+	ServiceConfigAppliedReason = "Applied"
+	// ServiceConfigRestartRequiredReason is used when the spec changed after the manager started
+	ServiceConfigRestartRequiredReason = "RestartRequired"
+)
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:scope=Cluster,categories=relocation
+//+kubebuilder:printcolumn:name="Valid",type=string,JSONPath=`.status.conditions[?(@.type=="Valid")].status`
+//+kubebuilder:printcolumn:name="Applied",type=string,JSONPath=`.status.conditions[?(@.type=="Applied")].status`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+//+kubebuilder:validation:XValidation:rule="self.metadata.name == 'cluster'",message="the RelocationServiceConfig must be named cluster"
+//+operator-sdk:csv:customresourcedefinitions:displayName="Relocation Service Config"
+
+// RelocationServiceConfig is the configuration of the relocation service manager
+type RelocationServiceConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   RelocationServiceConfigSpec   `json:"spec,omitempty"`
+	Status RelocationServiceConfigStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// RelocationServiceConfigList contains a list of RelocationServiceConfig
+type RelocationServiceConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []RelocationServiceConfig `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&RelocationServiceConfig{}, &RelocationServiceConfigList{})
+}
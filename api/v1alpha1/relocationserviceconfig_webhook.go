@@ -0,0 +1,224 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// log is for logging in this package.
+var relocationserviceconfiglog = logf.Log.WithName("relocationserviceconfig-resource")
+
+// SetupWebhookWithManager registers the RelocationServiceConfig webhooks
+// serviceScheme is the SERVICE_SCHEME of the manager environment, used when the spec doesn't set one
+func (r *RelocationServiceConfig) SetupWebhookWithManager(mgr ctrl.Manager, serviceScheme string) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		WithValidator(&RelocationServiceConfigValidator{ServiceScheme: serviceScheme}).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-relocation-openshift-io-v1alpha1-relocationserviceconfig,mutating=true,failurePolicy=fail,sideEffects=None,groups=relocation.openshift.io,resources=relocationserviceconfigs,verbs=create;update,versions=v1alpha1,name=mrelocationserviceconfig.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Defaulter = &RelocationServiceConfig{}
+
+// Default implements webhook.Defaulter so a webhook will be registered for the type
+func (r *RelocationServiceConfig) Default() {
+	relocationserviceconfiglog.Info("default", "name", r.Name)
+
+	if c := r.Spec.ConsoleLog; c != nil {
+		if c.Interval == nil {
+			interval, _ := time.ParseDuration(DefaultConsoleLogInterval)
+			c.Interval = &metav1.Duration{Duration: interval}
+		}
+		if c.MaxSize == nil {
+			maxSize := int64(DefaultConsoleLogMaxSize)
+			c.MaxSize = &maxSize
+		}
+	}
+	if r.Spec.Endpoint != nil {
+		r.Spec.Endpoint.RouteHost = strings.ToLower(r.Spec.Endpoint.RouteHost)
+	}
+}
+
+//+kubebuilder:webhook:path=/validate-relocation-openshift-io-v1alpha1-relocationserviceconfig,mutating=false,failurePolicy=fail,sideEffects=None,groups=relocation.openshift.io,resources=relocationserviceconfigs,verbs=create;update,versions=v1alpha1,name=vrelocationserviceconfig.kb.io,admissionReviewVersions=v1
+
+// RelocationServiceConfigValidator rejects RelocationServiceConfigs with invalid or conflicting options
+// +kubebuilder:object:generate=false
+type RelocationServiceConfigValidator struct {
+	// ServiceScheme is the scheme from the manager environment, used when the spec doesn't set one
+	ServiceScheme string
+}
+
+var _ admission.CustomValidator = &RelocationServiceConfigValidator{}
+
+// ValidateCreate implements admission.CustomValidator
+func (v *RelocationServiceConfigValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return v.validate(obj)
+}
+
+// ValidateUpdate implements admission.CustomValidator
+// The whole spec is checked as the manager ignores an invalid spec entirely
+func (v *RelocationServiceConfigValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	return v.validate(newObj)
+}
+
+// ValidateDelete implements admission.CustomValidator
+func (v *RelocationServiceConfigValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *RelocationServiceConfigValidator) validate(obj runtime.Object) (admission.Warnings, error) {
+	config, ok := obj.(*RelocationServiceConfig)
+	if !ok {
+		return nil, fmt.Errorf("expected a RelocationServiceConfig but got a %T", obj)
+	}
+	relocationserviceconfiglog.Info("validate", "name", config.Name)
+
+	if errs := ValidateServiceConfig(config, v.ServiceScheme); len(errs) > 0 {
+		return nil, apierrors.NewInvalid(GroupVersion.WithKind("RelocationServiceConfig").GroupKind(), config.Name, errs)
+	}
+	return admission.Warnings{"changes to the RelocationServiceConfig are applied when the manager restarts"}, nil
+}
+
+// ValidateServiceConfig returns the invalid and conflicting options of config
+// serviceScheme is the scheme from the manager environment, used when the spec doesn't set one
+func ValidateServiceConfig(config *RelocationServiceConfig, serviceScheme string) field.ErrorList {
+	var errs field.ErrorList
+	if config.Name != RelocationServiceConfigName {
+		errs = append(errs, field.Invalid(field.NewPath("metadata", "name"), config.Name, fmt.Sprintf("must be %s", RelocationServiceConfigName)))
+	}
+
+	spec := &config.Spec
+	specPath := field.NewPath("spec")
+	if spec.ServiceScheme != "" {
+		serviceScheme = spec.ServiceScheme
+		if serviceScheme != "http" && serviceScheme != "https" {
+			errs = append(errs, field.NotSupported(specPath.Child("serviceScheme"), serviceScheme, []string{"http", "https"}))
+		}
+	}
+	// credentials must not be sent in clear text
+	if spec.ImageBasicAuth != nil && *spec.ImageBasicAuth && serviceScheme != "https" {
+		errs = append(errs, field.Forbidden(specPath.Child("imageBasicAuth"), "requires the https service scheme"))
+	}
+	errs = append(errs, validateEndpoint(spec.Endpoint, serviceScheme, specPath.Child("endpoint"))...)
+	errs = append(errs, validateZoneURLs(spec.ZoneServiceURLs, specPath.Child("zoneServiceURLs"))...)
+	errs = append(errs, validateZoneURLs(spec.ZoneCacheURLs, specPath.Child("zoneCacheURLs"))...)
+	errs = append(errs, validateConsoleLog(spec.ConsoleLog, specPath.Child("consoleLog"))...)
+	errs = append(errs, validateNonNegative(spec.ResyncPeriod, specPath.Child("resyncPeriod"))...)
+	errs = append(errs, validateNonNegative(spec.NotifyWindow, specPath.Child("notifyWindow"))...)
+	if spec.MaxClusterConfigsPerNamespace != nil && *spec.MaxClusterConfigsPerNamespace < 0 {
+		errs = append(errs, field.Invalid(specPath.Child("maxClusterConfigsPerNamespace"), *spec.MaxClusterConfigsPerNamespace, "can't be negative"))
+	}
+	return errs
+}
+
+// validateEndpoint checks the endpoint options only used together are set together
+func validateEndpoint(endpoint *EndpointConfig, serviceScheme string, path *field.Path) field.ErrorList {
+	if endpoint == nil {
+		return nil
+	}
+	var errs field.ErrorList
+	if endpoint.Route {
+		if !endpoint.Manage {
+			errs = append(errs, field.Forbidden(path.Child("route"), "requires manage to be set"))
+		}
+		// the Route reencrypts to the serving certificate of the Service
+		if serviceScheme != "https" {
+			errs = append(errs, field.Forbidden(path.Child("route"), "requires the https service scheme"))
+		}
+	} else if endpoint.RouteHost != "" {
+		errs = append(errs, field.Forbidden(path.Child("routeHost"), "requires route to be set"))
+	}
+	if len(endpoint.AllowedCIDRs) > 0 && !endpoint.Manage {
+		errs = append(errs, field.Forbidden(path.Child("allowedCIDRs"), "requires manage to be set"))
+	}
+	for i, cidr := range endpoint.AllowedCIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			errs = append(errs, field.Invalid(path.Child("allowedCIDRs").Index(i), cidr, "must be a valid CIDR"))
+		}
+	}
+	return errs
+}
+
+// validateZoneURLs checks each zone maps to an absolute http or https URL
+func validateZoneURLs(zones map[string]string, path *field.Path) field.ErrorList {
+	names := make([]string, 0, len(zones))
+	for zone := range zones {
+		names = append(names, zone)
+	}
+	sort.Strings(names)
+
+	var errs field.ErrorList
+	for _, zone := range names {
+		if zone == "" || strings.Contains(zone, ",") {
+			errs = append(errs, field.Invalid(path, zone, "zone names must be non-empty and can't contain commas"))
+			continue
+		}
+		if !isAbsoluteHTTPURL(zones[zone]) {
+			// cache URLs may contain credentials so the value isn't included
+			errs = append(errs, field.Invalid(path.Key(zone), "", "must be an absolute http or https URL"))
+		}
+	}
+	return errs
+}
+
+// validateConsoleLog checks console output can be fetched from the source URL
+func validateConsoleLog(consoleLog *ConsoleLogConfig, path *field.Path) field.ErrorList {
+	if consoleLog == nil {
+		return nil
+	}
+	var errs field.ErrorList
+	source := strings.NewReplacer("{bmc}", "bmc", "{namespace}", "namespace", "{name}", "name").Replace(consoleLog.SourceURL)
+	if !isAbsoluteHTTPURL(source) {
+		errs = append(errs, field.Invalid(path.Child("sourceURL"), consoleLog.SourceURL, "must be an absolute http or https URL"))
+	}
+	if consoleLog.Interval != nil && consoleLog.Interval.Duration <= 0 {
+		errs = append(errs, field.Invalid(path.Child("interval"), consoleLog.Interval.Duration.String(), "must be positive"))
+	}
+	if consoleLog.MaxSize != nil && *consoleLog.MaxSize <= 0 {
+		errs = append(errs, field.Invalid(path.Child("maxSize"), *consoleLog.MaxSize, "must be positive"))
+	}
+	return errs
+}
+
+func validateNonNegative(d *metav1.Duration, path *field.Path) field.ErrorList {
+	if d != nil && d.Duration < 0 {
+		return field.ErrorList{field.Invalid(path, d.Duration.String(), "can't be negative")}
+	}
+	return nil
+}
+
+func isAbsoluteHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -22,13 +22,26 @@ limitations under the License.
 package v1alpha1
 
 import (
+	metal3_iov1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	configv1 "github.com/openshift/api/config/v1"
 	"k8s.io/api/core/v1"
-	runtime "k8s.io/apimachinery/pkg/runtime"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *BareMetalHostReference) DeepCopyInto(out *BareMetalHostReference) {
 	*out = *in
+	if in.RootDeviceHints != nil {
+		in, out := &in.RootDeviceHints, &out.RootDeviceHints
+		*out = new(metal3_iov1alpha1.RootDeviceHints)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NetworkDataRef != nil {
+		in, out := &in.NetworkDataRef, &out.NetworkDataRef
+		*out = new(v1.LocalObjectReference)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BareMetalHostReference.
@@ -41,13 +54,49 @@ func (in *BareMetalHostReference) DeepCopy() *BareMetalHostReference {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BuildInfo) DeepCopyInto(out *BuildInfo) {
+	*out = *in
+	in.BuildTime.DeepCopyInto(&out.BuildTime)
+	if in.Sources != nil {
+		in, out := &in.Sources, &out.Sources
+		*out = make([]BuildSource, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BuildInfo.
+func (in *BuildInfo) DeepCopy() *BuildInfo {
+	if in == nil {
+		return nil
+	}
+	out := new(BuildInfo)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BuildSource) DeepCopyInto(out *BuildSource) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BuildSource.
+func (in *BuildSource) DeepCopy() *BuildSource {
+	if in == nil {
+		return nil
+	}
+	out := new(BuildSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterConfig) DeepCopyInto(out *ClusterConfig) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterConfig.
@@ -107,13 +156,114 @@ func (in *ClusterConfigSpec) DeepCopyInto(out *ClusterConfigSpec) {
 	if in.BareMetalHostRef != nil {
 		in, out := &in.BareMetalHostRef, &out.BareMetalHostRef
 		*out = new(BareMetalHostReference)
-		**out = **in
+		(*in).DeepCopyInto(*out)
 	}
 	if in.NetworkConfigRef != nil {
 		in, out := &in.NetworkConfigRef, &out.NetworkConfigRef
 		*out = new(v1.LocalObjectReference)
 		**out = **in
 	}
+	if in.ExtraManifestsRef != nil {
+		in, out := &in.ExtraManifestsRef, &out.ExtraManifestsRef
+		*out = new(v1.LocalObjectReference)
+		**out = **in
+	}
+	if in.AdditionalPullSecretRefs != nil {
+		in, out := &in.AdditionalPullSecretRefs, &out.AdditionalPullSecretRefs
+		*out = make([]v1.SecretReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.AdditionalTrustBundleRef != nil {
+		in, out := &in.AdditionalTrustBundleRef, &out.AdditionalTrustBundleRef
+		*out = new(v1.LocalObjectReference)
+		**out = **in
+	}
+	if in.SecureBootCertsRef != nil {
+		in, out := &in.SecureBootCertsRef, &out.SecureBootCertsRef
+		*out = new(v1.LocalObjectReference)
+		**out = **in
+	}
+	if in.AgentConfigRef != nil {
+		in, out := &in.AgentConfigRef, &out.AgentConfigRef
+		*out = new(v1.LocalObjectReference)
+		**out = **in
+	}
+	if in.ImageTagMirrors != nil {
+		in, out := &in.ImageTagMirrors, &out.ImageTagMirrors
+		*out = make([]configv1.ImageTagMirrors, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.RepositoryDigestMirrors != nil {
+		in, out := &in.RepositoryDigestMirrors, &out.RepositoryDigestMirrors
+		*out = make([]RepositoryDigestMirrors, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.AllowedReleaseVersions != nil {
+		in, out := &in.AllowedReleaseVersions, &out.AllowedReleaseVersions
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.MaintenanceWindow != nil {
+		in, out := &in.MaintenanceWindow, &out.MaintenanceWindow
+		*out = new(MaintenanceWindow)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Network != nil {
+		in, out := &in.Network, &out.Network
+		*out = new(ClusterNetwork)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DiskEncryption != nil {
+		in, out := &in.DiskEncryption, &out.DiskEncryption
+		*out = new(DiskEncryption)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Preflight != nil {
+		in, out := &in.Preflight, &out.Preflight
+		*out = new(PreflightChecks)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.HardwareRequirements != nil {
+		in, out := &in.HardwareRequirements, &out.HardwareRequirements
+		*out = new(HardwareRequirements)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ImageVolume != nil {
+		in, out := &in.ImageVolume, &out.ImageVolume
+		*out = new(ImageVolume)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.MaxRetries != nil {
+		in, out := &in.MaxRetries, &out.MaxRetries
+		*out = new(int32)
+		**out = **in
+	}
+	if in.CertRenewalWindow != nil {
+		in, out := &in.CertRenewalWindow, &out.CertRenewalWindow
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.CertWarningWindow != nil {
+		in, out := &in.CertWarningWindow, &out.CertWarningWindow
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.MinRebuildInterval != nil {
+		in, out := &in.MinRebuildInterval, &out.MinRebuildInterval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.PostCompletionHooks != nil {
+		in, out := &in.PostCompletionHooks, &out.PostCompletionHooks
+		*out = make([]CompletionHook, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterConfigSpec.
@@ -129,6 +279,73 @@ func (in *ClusterConfigSpec) DeepCopy() *ClusterConfigSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterConfigStatus) DeepCopyInto(out *ClusterConfigStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.PhaseTransitionTime != nil {
+		in, out := &in.PhaseTransitionTime, &out.PhaseTransitionTime
+		*out = (*in).DeepCopy()
+	}
+	if in.AdminKubeconfigRef != nil {
+		in, out := &in.AdminKubeconfigRef, &out.AdminKubeconfigRef
+		*out = new(v1.LocalObjectReference)
+		**out = **in
+	}
+	if in.Attempts != nil {
+		in, out := &in.Attempts, &out.Attempts
+		*out = make([]RelocationAttempt, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.PayloadDiff != nil {
+		in, out := &in.PayloadDiff, &out.PayloadDiff
+		*out = new(PayloadDiff)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Preflight != nil {
+		in, out := &in.Preflight, &out.Preflight
+		*out = new(PreflightStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LastHostRetryTime != nil {
+		in, out := &in.LastHostRetryTime, &out.LastHostRetryTime
+		*out = (*in).DeepCopy()
+	}
+	if in.APICertExpiry != nil {
+		in, out := &in.APICertExpiry, &out.APICertExpiry
+		*out = (*in).DeepCopy()
+	}
+	if in.IngressCertExpiry != nil {
+		in, out := &in.IngressCertExpiry, &out.IngressCertExpiry
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionHooks != nil {
+		in, out := &in.CompletionHooks, &out.CompletionHooks
+		*out = make([]CompletionHookStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.BuildInfo != nil {
+		in, out := &in.BuildInfo, &out.BuildInfo
+		*out = new(BuildInfo)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.HostHardware != nil {
+		in, out := &in.HostHardware, &out.HostHardware
+		*out = new(HostHardware)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ImageBuild != nil {
+		in, out := &in.ImageBuild, &out.ImageBuild
+		*out = new(ImageBuildStatus)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterConfigStatus.
@@ -140,3 +357,638 @@ func (in *ClusterConfigStatus) DeepCopy() *ClusterConfigStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterDeprovision) DeepCopyInto(out *ClusterDeprovision) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterDeprovision.
+func (in *ClusterDeprovision) DeepCopy() *ClusterDeprovision {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterDeprovision)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterDeprovision) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterDeprovisionList) DeepCopyInto(out *ClusterDeprovisionList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ClusterDeprovision, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterDeprovisionList.
+func (in *ClusterDeprovisionList) DeepCopy() *ClusterDeprovisionList {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterDeprovisionList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterDeprovisionList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterDeprovisionSpec) DeepCopyInto(out *ClusterDeprovisionSpec) {
+	*out = *in
+	if in.BareMetalHostRef != nil {
+		in, out := &in.BareMetalHostRef, &out.BareMetalHostRef
+		*out = new(BareMetalHostReference)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterDeprovisionSpec.
+func (in *ClusterDeprovisionSpec) DeepCopy() *ClusterDeprovisionSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterDeprovisionSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterDeprovisionStatus) DeepCopyInto(out *ClusterDeprovisionStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterDeprovisionStatus.
+func (in *ClusterDeprovisionStatus) DeepCopy() *ClusterDeprovisionStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterDeprovisionStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterNetwork) DeepCopyInto(out *ClusterNetwork) {
+	*out = *in
+	if in.APIVIPs != nil {
+		in, out := &in.APIVIPs, &out.APIVIPs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.IngressVIPs != nil {
+		in, out := &in.IngressVIPs, &out.IngressVIPs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.MachineNetworks != nil {
+		in, out := &in.MachineNetworks, &out.MachineNetworks
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterNetwork.
+func (in *ClusterNetwork) DeepCopy() *ClusterNetwork {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterNetwork)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CompletionHook) DeepCopyInto(out *CompletionHook) {
+	*out = *in
+	in.Template.DeepCopyInto(&out.Template)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CompletionHook.
+func (in *CompletionHook) DeepCopy() *CompletionHook {
+	if in == nil {
+		return nil
+	}
+	out := new(CompletionHook)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CompletionHookStatus) DeepCopyInto(out *CompletionHookStatus) {
+	*out = *in
+	in.StartTime.DeepCopyInto(&out.StartTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CompletionHookStatus.
+func (in *CompletionHookStatus) DeepCopy() *CompletionHookStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CompletionHookStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConsoleLogConfig) DeepCopyInto(out *ConsoleLogConfig) {
+	*out = *in
+	if in.Interval != nil {
+		in, out := &in.Interval, &out.Interval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.MaxSize != nil {
+		in, out := &in.MaxSize, &out.MaxSize
+		*out = new(int64)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConsoleLogConfig.
+func (in *ConsoleLogConfig) DeepCopy() *ConsoleLogConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(ConsoleLogConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DiskEncryption) DeepCopyInto(out *DiskEncryption) {
+	*out = *in
+	if in.TangServers != nil {
+		in, out := &in.TangServers, &out.TangServers
+		*out = make([]TangServer, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DiskEncryption.
+func (in *DiskEncryption) DeepCopy() *DiskEncryption {
+	if in == nil {
+		return nil
+	}
+	out := new(DiskEncryption)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EndpointConfig) DeepCopyInto(out *EndpointConfig) {
+	*out = *in
+	if in.AllowedCIDRs != nil {
+		in, out := &in.AllowedCIDRs, &out.AllowedCIDRs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EndpointConfig.
+func (in *EndpointConfig) DeepCopy() *EndpointConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(EndpointConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HardwareRequirements) DeepCopyInto(out *HardwareRequirements) {
+	*out = *in
+	if in.MinDiskSize != nil {
+		in, out := &in.MinDiskSize, &out.MinDiskSize
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.MinMemory != nil {
+		in, out := &in.MinMemory, &out.MinMemory
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HardwareRequirements.
+func (in *HardwareRequirements) DeepCopy() *HardwareRequirements {
+	if in == nil {
+		return nil
+	}
+	out := new(HardwareRequirements)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HostHardware) DeepCopyInto(out *HostHardware) {
+	*out = *in
+	if in.NICs != nil {
+		in, out := &in.NICs, &out.NICs
+		*out = make([]HostNIC, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HostHardware.
+func (in *HostHardware) DeepCopy() *HostHardware {
+	if in == nil {
+		return nil
+	}
+	out := new(HostHardware)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HostNIC) DeepCopyInto(out *HostNIC) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HostNIC.
+func (in *HostNIC) DeepCopy() *HostNIC {
+	if in == nil {
+		return nil
+	}
+	out := new(HostNIC)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ImageBuildStatus) DeepCopyInto(out *ImageBuildStatus) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+	out.Duration = in.Duration
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImageBuildStatus.
+func (in *ImageBuildStatus) DeepCopy() *ImageBuildStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ImageBuildStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ImageVolume) DeepCopyInto(out *ImageVolume) {
+	*out = *in
+	if in.Metadata != nil {
+		in, out := &in.Metadata, &out.Metadata
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImageVolume.
+func (in *ImageVolume) DeepCopy() *ImageVolume {
+	if in == nil {
+		return nil
+	}
+	out := new(ImageVolume)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MaintenanceWindow) DeepCopyInto(out *MaintenanceWindow) {
+	*out = *in
+	out.Duration = in.Duration
+	if in.Days != nil {
+		in, out := &in.Days, &out.Days
+		*out = make([]Weekday, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MaintenanceWindow.
+func (in *MaintenanceWindow) DeepCopy() *MaintenanceWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(MaintenanceWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PayloadChange) DeepCopyInto(out *PayloadChange) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PayloadChange.
+func (in *PayloadChange) DeepCopy() *PayloadChange {
+	if in == nil {
+		return nil
+	}
+	out := new(PayloadChange)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PayloadDiff) DeepCopyInto(out *PayloadDiff) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+	if in.Changes != nil {
+		in, out := &in.Changes, &out.Changes
+		*out = make([]PayloadChange, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PayloadDiff.
+func (in *PayloadDiff) DeepCopy() *PayloadDiff {
+	if in == nil {
+		return nil
+	}
+	out := new(PayloadDiff)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PreflightCheckResult) DeepCopyInto(out *PreflightCheckResult) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PreflightCheckResult.
+func (in *PreflightCheckResult) DeepCopy() *PreflightCheckResult {
+	if in == nil {
+		return nil
+	}
+	out := new(PreflightCheckResult)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PreflightChecks) DeepCopyInto(out *PreflightChecks) {
+	*out = *in
+	if in.MinDiskSize != nil {
+		in, out := &in.MinDiskSize, &out.MinDiskSize
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PreflightChecks.
+func (in *PreflightChecks) DeepCopy() *PreflightChecks {
+	if in == nil {
+		return nil
+	}
+	out := new(PreflightChecks)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PreflightStatus) DeepCopyInto(out *PreflightStatus) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+	if in.Checks != nil {
+		in, out := &in.Checks, &out.Checks
+		*out = make([]PreflightCheckResult, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PreflightStatus.
+func (in *PreflightStatus) DeepCopy() *PreflightStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PreflightStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RelocationAttempt) DeepCopyInto(out *RelocationAttempt) {
+	*out = *in
+	in.StartTime.DeepCopyInto(&out.StartTime)
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RelocationAttempt.
+func (in *RelocationAttempt) DeepCopy() *RelocationAttempt {
+	if in == nil {
+		return nil
+	}
+	out := new(RelocationAttempt)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RelocationServiceConfig) DeepCopyInto(out *RelocationServiceConfig) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RelocationServiceConfig.
+func (in *RelocationServiceConfig) DeepCopy() *RelocationServiceConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(RelocationServiceConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *RelocationServiceConfig) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RelocationServiceConfigList) DeepCopyInto(out *RelocationServiceConfigList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]RelocationServiceConfig, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RelocationServiceConfigList.
+func (in *RelocationServiceConfigList) DeepCopy() *RelocationServiceConfigList {
+	if in == nil {
+		return nil
+	}
+	out := new(RelocationServiceConfigList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *RelocationServiceConfigList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RelocationServiceConfigSpec) DeepCopyInto(out *RelocationServiceConfigSpec) {
+	*out = *in
+	if in.ImageBasicAuth != nil {
+		in, out := &in.ImageBasicAuth, &out.ImageBasicAuth
+		*out = new(bool)
+		**out = **in
+	}
+	if in.Endpoint != nil {
+		in, out := &in.Endpoint, &out.Endpoint
+		*out = new(EndpointConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ZoneServiceURLs != nil {
+		in, out := &in.ZoneServiceURLs, &out.ZoneServiceURLs
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.ZoneCacheURLs != nil {
+		in, out := &in.ZoneCacheURLs, &out.ZoneCacheURLs
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.ConsoleLog != nil {
+		in, out := &in.ConsoleLog, &out.ConsoleLog
+		*out = new(ConsoleLogConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ResyncPeriod != nil {
+		in, out := &in.ResyncPeriod, &out.ResyncPeriod
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.NotifyWindow != nil {
+		in, out := &in.NotifyWindow, &out.NotifyWindow
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.MaxClusterConfigsPerNamespace != nil {
+		in, out := &in.MaxClusterConfigsPerNamespace, &out.MaxClusterConfigsPerNamespace
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RelocationServiceConfigSpec.
+func (in *RelocationServiceConfigSpec) DeepCopy() *RelocationServiceConfigSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(RelocationServiceConfigSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RelocationServiceConfigStatus) DeepCopyInto(out *RelocationServiceConfigStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RelocationServiceConfigStatus.
+func (in *RelocationServiceConfigStatus) DeepCopy() *RelocationServiceConfigStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(RelocationServiceConfigStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RepositoryDigestMirrors) DeepCopyInto(out *RepositoryDigestMirrors) {
+	*out = *in
+	if in.Mirrors != nil {
+		in, out := &in.Mirrors, &out.Mirrors
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RepositoryDigestMirrors.
+func (in *RepositoryDigestMirrors) DeepCopy() *RepositoryDigestMirrors {
+	if in == nil {
+		return nil
+	}
+	out := new(RepositoryDigestMirrors)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TangServer) DeepCopyInto(out *TangServer) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TangServer.
+func (in *TangServer) DeepCopy() *TangServer {
+	if in == nil {
+		return nil
+	}
+	out := new(TangServer)
+	in.DeepCopyInto(out)
+	return out
+}
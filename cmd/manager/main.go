@@ -17,8 +17,13 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 	"os"
+	"path/filepath"
+	"time"
+	// maintenance window time zones must resolve even if the image has no zoneinfo
+	_ "time/tzdata"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -28,14 +33,29 @@ import (
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
 
 	cro "github.com/RHsyseng/cluster-relocation-operator/api/v1beta1"
 	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
 	"github.com/carbonin/cluster-relocation-service/controllers"
+	"github.com/carbonin/cluster-relocation-service/internal/dedup"
+	"github.com/carbonin/cluster-relocation-service/internal/filelock"
+	"github.com/carbonin/cluster-relocation-service/internal/httpclient"
+	"github.com/carbonin/cluster-relocation-service/internal/imageserver"
+	"github.com/carbonin/cluster-relocation-service/internal/metrics"
+	"github.com/carbonin/cluster-relocation-service/internal/ratelimit"
+	"github.com/carbonin/cluster-relocation-service/internal/redact"
+	"github.com/carbonin/cluster-relocation-service/internal/report"
+	"github.com/carbonin/cluster-relocation-service/internal/tracing"
 	"github.com/kelseyhightower/envconfig"
 	bmh_v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	configv1 "github.com/openshift/api/config/v1"
+	operatorv1alpha1 "github.com/openshift/api/operator/v1alpha1"
+	routev1 "github.com/openshift/api/route/v1"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 	//+kubebuilder:scaffold:imports
 )
@@ -45,12 +65,18 @@ var (
 	setupLog = ctrl.Log.WithName("setup")
 )
 
+// leaseCheckInterval is how often the leader checks it still holds the data dir lease
+const leaseCheckInterval = 10 * time.Second
+
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(relocationv1alpha1.AddToScheme(scheme))
 	utilruntime.Must(bmh_v1alpha1.AddToScheme(scheme))
 	utilruntime.Must(cro.AddToScheme(scheme))
+	utilruntime.Must(configv1.AddToScheme(scheme))
+	utilruntime.Must(operatorv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(routev1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
@@ -78,6 +104,8 @@ func main() {
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "e21b2704.openshift.io",
+		Cache:                  controllers.CacheOptions(),
+		Client:                 client.Options{Cache: &client.CacheOptions{DisableFor: controllers.UncachedObjects()}},
 		// LeaderElectionReleaseOnCancel defines if the leader should step down voluntarily
 		// when the Manager ends. This requires the binary to immediately end when the
 		// Manager is stopped, otherwise, this setting is unsafe. Setting this significantly
@@ -97,6 +125,18 @@ func main() {
 
 	logger := logrus.New()
 	logger.SetReportCaller(true)
+	logger.AddHook(redact.Hook{})
+
+	shutdownTracing, err := tracing.Setup(context.Background(), "cluster-relocation-service")
+	if err != nil {
+		setupLog.Error(err, "unable to set up tracing")
+		os.Exit(1)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			logger.WithError(err).Error("failed to shut down tracing")
+		}
+	}()
 
 	controllerOptions := &controllers.ClusterConfigReconcilerOptions{}
 	if err := envconfig.Process("cluster-relocation-service", controllerOptions); err != nil {
@@ -104,15 +144,211 @@ func main() {
 		os.Exit(1)
 	}
 
-	if err = (&controllers.ClusterConfigReconciler{
+	// the cache doesn't run until the manager starts so startup objects are read and created with a direct client
+	directClient, err := client.New(mgr.GetConfig(), client.Options{Scheme: mgr.GetScheme()})
+	if err != nil {
+		setupLog.Error(err, "unable to create direct client")
+		os.Exit(1)
+	}
+	// an invalid RelocationServiceConfig is reported in its conditions rather than stopping the manager
+	envServiceScheme := controllerOptions.ServiceScheme
+	serviceConfigGeneration, err := controllers.LoadServiceConfig(context.Background(), directClient, controllerOptions)
+	if err != nil {
+		setupLog.Error(err, "ignoring RelocationServiceConfig, using the environment configuration")
+	}
+
+	// writes to the data dir are fenced until the lease is taken over from any previous instance once this one is
+	// elected leader (e.g. during a rolling upgrade). nothing is written in read-only mode so the lease is left with
+	// its current holder
+	var lease *filelock.Lease
+	if controllerOptions.ReadOnly {
+		setupLog.Info("running in read-only mode, the data dir will not be modified")
+	} else {
+		holder, err := os.Hostname()
+		if err != nil {
+			setupLog.Error(err, "unable to determine hostname")
+			os.Exit(1)
+		}
+		if err := os.MkdirAll(controllerOptions.DataDir, 0700); err != nil {
+			setupLog.Error(err, "unable to create data dir")
+			os.Exit(1)
+		}
+		lease = filelock.NewLease(controllerOptions.DataDir, holder)
+		if err := mgr.Add(&controllers.LeaseKeeper{Lease: lease, Log: logger, Interval: leaseCheckInterval}); err != nil {
+			setupLog.Error(err, "unable to add data dir lease keeper")
+			os.Exit(1)
+		}
+	}
+
+	collector := metrics.NewClusterConfigCollector(controllerOptions.MetricsMaxClusterConfigs)
+	collector.Log = logger
+	if err := ctrlmetrics.Registry.Register(collector); err != nil {
+		setupLog.Error(err, "unable to register cluster config metrics")
+		os.Exit(1)
+	}
+
+	for _, c := range []prometheus.Collector{metrics.AuditDiscrepancies, metrics.AuditLastRun} {
+		if err := ctrlmetrics.Registry.Register(c); err != nil {
+			setupLog.Error(err, "unable to register audit metrics")
+			os.Exit(1)
+		}
+	}
+
+	// images are built here when they're uploaded to zone caches
+	for _, c := range []prometheus.Collector{metrics.ImageBuildSize, metrics.ImageBuildDuration, metrics.ImageBuildFiles} {
+		if err := ctrlmetrics.Registry.Register(c); err != nil {
+			setupLog.Error(err, "unable to register image build metrics")
+			os.Exit(1)
+		}
+	}
+
+	if err := ctrlmetrics.Registry.Register(metrics.DeletionCleanups); err != nil {
+		setupLog.Error(err, "unable to register deletion metrics")
+		os.Exit(1)
+	}
+
+	if err := ctrlmetrics.Registry.Register(filelock.WaitSeconds); err != nil {
+		setupLog.Error(err, "unable to register file lock metrics")
+		os.Exit(1)
+	}
+
+	bmhPatches := ratelimit.NewKeyedLimiter(controllerOptions.BMHPatchQPS, controllerOptions.BMHPatchBurst)
+	if err := ctrlmetrics.Registry.Register(bmhPatches); err != nil {
+		setupLog.Error(err, "unable to register BareMetalHost patch metrics")
+		os.Exit(1)
+	}
+
+	blobs := &dedup.Store{Dir: filepath.Join(controllerOptions.DataDir, "blobs")}
+
+	reconciler := &controllers.ClusterConfigReconciler{
 		Client:  mgr.GetClient(),
 		Log:     logger,
 		Scheme:  mgr.GetScheme(),
 		Options: controllerOptions,
-	}).SetupWithManager(mgr); err != nil {
+		// the proxy and trust bundle aren't otherwise watched so read them directly
+		HTTPClients: &httpclient.Factory{Reader: mgr.GetAPIReader()},
+		Lease:       lease,
+		Metrics:     collector,
+		Blobs:       blobs,
+		BMHPatches:  bmhPatches,
+		APIReader:   mgr.GetAPIReader(),
+		Builds:      &imageserver.BuildRecorder{Client: mgr.GetClient(), Log: logger},
+		Notifier: &report.Notifier{
+			Log:      logger,
+			Recorder: mgr.GetEventRecorderFor("cluster-relocation-service"),
+			Window:   controllerOptions.NotifyWindow,
+		},
+	}
+	if controllerOptions.ManageEndpoint {
+		reconciler.BaseURL, err = controllers.EnsureEndpoint(context.Background(), directClient, controllerOptions)
+		if err != nil {
+			setupLog.Error(err, "unable to ensure image server endpoint")
+			os.Exit(1)
+		}
+		setupLog.Info("managing image server endpoint", "url", reconciler.BaseURL)
+		if err := mgr.Add(&controllers.EndpointKeeper{
+			Client:   directClient,
+			Log:      logger,
+			Options:  controllerOptions,
+			URL:      reconciler.BaseURL,
+			Interval: controllerOptions.ResyncPeriod,
+		}); err != nil {
+			setupLog.Error(err, "unable to add image server endpoint keeper")
+			os.Exit(1)
+		}
+	}
+	if controllerOptions.ImageCAFile != "" {
+		// the Proxy isn't otherwise read through the cache so use the direct client rather than start an informer
+		if err := mgr.Add(&controllers.TrustedCAPublisher{
+			Client:   directClient,
+			Log:      logger,
+			Options:  controllerOptions,
+			Interval: controllerOptions.ResyncPeriod,
+		}); err != nil {
+			setupLog.Error(err, "unable to add trusted CA publisher")
+			os.Exit(1)
+		}
+	}
+	if controllerOptions.DeletionConcurrency > 0 {
+		reconciler.Deletions = controllers.NewDeletionQueue(reconciler, controllerOptions.DeletionConcurrency)
+		if err := mgr.Add(reconciler.Deletions); err != nil {
+			setupLog.Error(err, "unable to add deletion queue")
+			os.Exit(1)
+		}
+	}
+	if controllerOptions.PrestageConcurrency > 0 {
+		reconciler.Prestages = controllers.NewPrestageQueue(reconciler, controllerOptions.PrestageConcurrency)
+		if err := mgr.Add(reconciler.Prestages); err != nil {
+			setupLog.Error(err, "unable to add prestage queue")
+			os.Exit(1)
+		}
+	}
+	if err = reconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "ClusterConfig")
 		os.Exit(1)
 	}
+	if err = (&controllers.ClusterDeprovisionReconciler{
+		Client:  mgr.GetClient(),
+		Log:     logger,
+		Configs: reconciler,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ClusterDeprovision")
+		os.Exit(1)
+	}
+
+	if err = (&controllers.ServiceConfigReconciler{
+		Client:            mgr.GetClient(),
+		Log:               logger,
+		ServiceScheme:     envServiceScheme,
+		AppliedGeneration: serviceConfigGeneration,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "RelocationServiceConfig")
+		os.Exit(1)
+	}
+
+	if controllerOptions.AuditInterval > 0 {
+		if err := mgr.Add(&controllers.ConsistencyAuditor{
+			Reconciler: reconciler,
+			Notifier:   &report.Notifier{Log: logger, Recorder: mgr.GetEventRecorderFor("cluster-relocation-audit")},
+			Interval:   controllerOptions.AuditInterval,
+		}); err != nil {
+			setupLog.Error(err, "unable to add consistency auditor")
+			os.Exit(1)
+		}
+	}
+
+	if !controllerOptions.ReadOnly {
+		sweepers := []*controllers.DataDirSweeper{{
+			Log:      logger,
+			DataDir:  controllerOptions.DataDir,
+			Interval: controllerOptions.CleanupInterval,
+			Blobs:    blobs,
+		}}
+		for _, dir := range controllerOptions.DataDirShards {
+			sweepers = append(sweepers, &controllers.DataDirSweeper{
+				Log:      logger.WithField("shard", dir),
+				DataDir:  dir,
+				Interval: controllerOptions.CleanupInterval,
+				Blobs:    &dedup.Store{Dir: filepath.Join(dir, "blobs")},
+			})
+		}
+		for _, s := range sweepers {
+			if err := mgr.Add(s); err != nil {
+				setupLog.Error(err, "unable to add data dir sweeper")
+				os.Exit(1)
+			}
+		}
+	}
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = (&relocationv1alpha1.ClusterConfig{}).SetupWebhookWithManager(mgr, controllerOptions.MaxClusterConfigsPerNamespace); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "ClusterConfig")
+			os.Exit(1)
+		}
+		if err = (&relocationv1alpha1.RelocationServiceConfig{}).SetupWebhookWithManager(mgr, envServiceScheme); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "RelocationServiceConfig")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
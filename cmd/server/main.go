@@ -2,57 +2,290 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"syscall"
+	"time"
 
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+	"github.com/carbonin/cluster-relocation-service/internal/accesslog"
+	"github.com/carbonin/cluster-relocation-service/internal/apiauth"
+	"github.com/carbonin/cluster-relocation-service/internal/apiserver"
+	"github.com/carbonin/cluster-relocation-service/internal/deadline"
+	"github.com/carbonin/cluster-relocation-service/internal/events"
+	"github.com/carbonin/cluster-relocation-service/internal/filelock"
 	"github.com/carbonin/cluster-relocation-service/internal/imageserver"
+	"github.com/carbonin/cluster-relocation-service/internal/metrics"
+	"github.com/carbonin/cluster-relocation-service/internal/redact"
+	"github.com/carbonin/cluster-relocation-service/internal/tracing"
 	"github.com/kelseyhightower/envconfig"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/net/netutil"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 var Options struct {
-	DataDir       string `envconfig:"DATA_DIR" default:"/data"`
-	Port          string `envconfig:"PORT" default:"8000"`
-	HTTPSKeyFile  string `envconfig:"HTTPS_KEY_FILE"`
-	HTTPSCertFile string `envconfig:"HTTPS_CERT_FILE"`
+	DataDir string `envconfig:"DATA_DIR" default:"/data"`
+	// DataDirShards is the comma separated list of data dir shards used by the manager, in the same order
+	DataDirShards []string `envconfig:"DATA_DIR_SHARDS"`
+	Port          string   `envconfig:"PORT" default:"8000"`
+	HTTPSKeyFile  string   `envconfig:"HTTPS_KEY_FILE"`
+	HTTPSCertFile string   `envconfig:"HTTPS_CERT_FILE"`
+	// TenantDomain serves the images of each namespace on <namespace>.<TenantDomain>, requests to those hostnames
+	// can only download images of that namespace
+	TenantDomain string `envconfig:"TENANT_DOMAIN"`
+	// TenantCertsDir holds a <namespace>/tls.crt and tls.key serving certificate for each tenant hostname,
+	// selected by SNI. Tenants without one are served with the HTTPS certificate
+	TenantCertsDir string `envconfig:"TENANT_CERTS_DIR"`
+	// MetricsMaxClusterConfigs limits the number of ClusterConfigs with per-config metric samples
+	MetricsMaxClusterConfigs int `envconfig:"METRICS_MAX_CLUSTER_CONFIGS" default:"10000"`
+	// MetricsPruneInterval is how often samples of deleted ClusterConfigs are removed
+	MetricsPruneInterval time.Duration `envconfig:"METRICS_PRUNE_INTERVAL" default:"5m"`
+
+	// Timeouts for client connections, zero disables the corresponding timeout
+	// WriteTimeout bounds the time to send a whole image so it must allow for slow BMC downloads
+	ReadHeaderTimeout time.Duration `envconfig:"READ_HEADER_TIMEOUT" default:"10s"`
+	ReadTimeout       time.Duration `envconfig:"READ_TIMEOUT" default:"30s"`
+	WriteTimeout      time.Duration `envconfig:"WRITE_TIMEOUT" default:"30m"`
+	IdleTimeout       time.Duration `envconfig:"IDLE_TIMEOUT" default:"2m"`
+	// MaxConnections limits the number of concurrently open client connections, zero means no limit
+	MaxConnections int `envconfig:"MAX_CONNECTIONS" default:"100"`
+	// CORSAllowedOrigins is a comma separated list of origins allowed to make cross-origin requests, "*" allows any origin
+	CORSAllowedOrigins []string `envconfig:"CORS_ALLOWED_ORIGINS"`
+	// SelfTest serves the self test endpoint with the API endpoints, for users allowed to create clusterconfigs/selftest
+	SelfTest bool `envconfig:"SELFTEST" default:"false"`
+	// ReadOnly builds images outside of the data directory so it can be migrated while images are still served
+	ReadOnly bool `envconfig:"READ_ONLY" default:"false"`
+	// LockTimeout is how long a request waits for the manager to finish writing a config
+	LockTimeout time.Duration `envconfig:"LOCK_TIMEOUT" default:"30s"`
+	// ISOCacheMaxSize is the total size in bytes of built images kept for reuse, zero disables the cache
+	ISOCacheMaxSize int64 `envconfig:"ISO_CACHE_MAX_SIZE" default:"10737418240"`
+	// ISOStreaming generates images directly into responses instead of building them on disk, the cache isn't used
+	ISOStreaming bool `envconfig:"ISO_STREAMING" default:"false"`
+	// BasicAuth requires image requests to use the image credentials secret of the ClusterConfig namespace
+	BasicAuth bool `envconfig:"BASIC_AUTH" default:"false"`
+	// APIEnabled serves the ClusterConfig API endpoints which authorize requests against the kubernetes API
+	APIEnabled bool `envconfig:"API_ENABLED" default:"false"`
+	// EventsMaxSubscribers limits the number of open event streams, zero means no limit
+	EventsMaxSubscribers int `envconfig:"EVENTS_MAX_SUBSCRIBERS" default:"10"`
+	// ImageBuildStatus records the size, duration, and file count of each image built in the ClusterConfig status
+	ImageBuildStatus bool `envconfig:"IMAGE_BUILD_STATUS" default:"false"`
+	// AccessLog is the file each request is written to once served, "-" writes to stdout and empty disables the access log
+	AccessLog string `envconfig:"ACCESS_LOG"`
+	// AccessLogFormat is "clf" for the Common Log Format or "json"
+	AccessLogFormat string `envconfig:"ACCESS_LOG_FORMAT" default:"clf"`
+	// AccessLogMaxSize is the size in bytes at which the access log file is rotated, zero disables rotation
+	AccessLogMaxSize int64 `envconfig:"ACCESS_LOG_MAX_SIZE" default:"104857600"`
+	// AccessLogMaxBackups is the number of rotated access log files kept
+	AccessLogMaxBackups int `envconfig:"ACCESS_LOG_MAX_BACKUPS" default:"5"`
 }
 
 func main() {
 	log := logrus.New()
 	log.SetReportCaller(true)
+	log.AddHook(redact.Hook{})
 
 	err := envconfig.Process("fileserver", &Options)
 	if err != nil {
 		log.Fatalf("Failed to process config: %s", err)
 	}
 
+	shutdownTracing, err := tracing.Setup(context.Background(), "cluster-relocation-image-server")
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %s", err)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			log.WithError(err).Error("failed to shut down tracing")
+		}
+	}()
+
 	workDir := filepath.Join(Options.DataDir, "iso-workdir")
+	if Options.ReadOnly {
+		log.Info("running in read-only mode, images will be built outside of the data dir")
+		workDir = filepath.Join(os.TempDir(), "iso-workdir")
+	}
 	if err := os.MkdirAll(workDir, 0700); err != nil {
 		log.Fatalf("Failed to create work dir: %s", err)
 	}
 
+	collector := metrics.NewClusterConfigCollector(Options.MetricsMaxClusterConfigs)
+	collector.Log = log
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector, filelock.WaitSeconds, metrics.ImageBuildSize, metrics.ImageBuildDuration, metrics.ImageBuildFiles)
+
+	broker := events.NewBroker()
 	s := &imageserver.Handler{
-		Log:        log,
-		WorkDir:    workDir,
-		ConfigsDir: filepath.Join(Options.DataDir, "namespaces"),
+		Log:         log,
+		WorkDir:     workDir,
+		ConfigsDir:  filepath.Join(Options.DataDir, "namespaces"),
+		Metrics:     collector,
+		LockTimeout: Options.LockTimeout,
+		Events:      broker,
+		Stream:      Options.ISOStreaming,
+	}
+	for _, dir := range Options.DataDirShards {
+		s.ConfigsDirShards = append(s.ConfigsDirShards, filepath.Join(dir, "namespaces"))
+	}
+	// cached images are written to the data dir so they survive restarts
+	if Options.ISOCacheMaxSize > 0 && !Options.ReadOnly && !Options.ISOStreaming {
+		s.Cache = &imageserver.ISOCache{
+			Log:     log,
+			Dir:     filepath.Join(Options.DataDir, "iso-cache"),
+			MaxSize: Options.ISOCacheMaxSize,
+		}
+	}
+	var cfg *rest.Config
+	var c client.Client
+	if Options.APIEnabled || Options.BasicAuth || Options.ImageBuildStatus {
+		cfg, err = ctrl.GetConfig()
+		if err != nil {
+			log.Fatalf("Failed to get kubernetes config: %s", err)
+		}
+		c, err = client.New(cfg, client.Options{Scheme: scheme})
+		if err != nil {
+			log.Fatalf("Failed to create kubernetes client: %s", err)
+		}
+	}
+	// build metrics are recorded either way, the client is only set to record them in the status
+	s.Builds = &imageserver.BuildRecorder{Log: log}
+	if Options.ImageBuildStatus {
+		s.Builds.Client = c
 	}
 	http.Handle("/images/", s)
+	http.Handle("/networkconfig/", &imageserver.NetworkConfigHandler{Handler: s})
+	http.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.PruneMetrics(ctx, Options.MetricsPruneInterval)
+	if Options.BasicAuth {
+		// every image request is authorized so the credentials are read from a watch rather than the API
+		credentials, err := watchImageCredentials(ctx, cfg)
+		if err != nil {
+			log.Fatalf("Failed to watch image credentials: %s", err)
+		}
+		s.Auth = &imageserver.BasicAuth{Client: credentials}
+	}
+	if Options.APIEnabled {
+		configs, err := watchPhases(ctx, cfg, broker)
+		if err != nil {
+			log.Fatalf("Failed to watch ClusterConfigs: %s", err)
+		}
+
+		api := http.NewServeMux()
+		api.Handle("/api/v1/clusterconfigs/", &apiserver.ConsoleLogHandler{
+			Log:              log,
+			ConfigsDir:       s.ConfigsDir,
+			ConfigsDirShards: s.ConfigsDirShards,
+			Next: &apiserver.KubeconfigHandler{
+				Log:        log,
+				Client:     c,
+				Authorizer: &apiauth.Authorizer{Client: c},
+			},
+		})
+		api.Handle("/api/v1/events", &apiserver.EventsHandler{
+			Log:            log,
+			Broker:         broker,
+			MaxSubscribers: Options.EventsMaxSubscribers,
+		})
+		// the summary is built from the watch cache so fleets with many configs don't list them on every request
+		api.Handle("/api/v1/summary", &apiserver.SummaryHandler{
+			Log:    log,
+			Client: configs,
+		})
+		if Options.SelfTest {
+			api.Handle("/api/v1/selftest", &imageserver.SelfTest{Handler: s})
+		}
+		// every API request is authorized against the ClusterConfigs it exposes before reaching a handler
+		http.Handle("/api/", &apiauth.Middleware{
+			Log:        log,
+			Authorizer: &apiauth.Authorizer{Client: c},
+			Routes:     apiserver.Routes,
+			Next:       api,
+		})
+	}
+	// the write timeout is applied per request rather than by the server so event streams can lift it
+	var handler http.Handler = &deadline.WriteTimeout{Timeout: Options.WriteTimeout, Next: http.DefaultServeMux}
+	if Options.TenantDomain != "" {
+		handler = &imageserver.TenantHosts{Domain: Options.TenantDomain, Next: handler}
+	}
+	if len(Options.CORSAllowedOrigins) > 0 {
+		handler = &imageserver.CORS{AllowedOrigins: Options.CORSAllowedOrigins, Next: handler}
+	}
+	// the access log wraps everything else so rejected requests are recorded too
+	if Options.AccessLog != "" {
+		format, err := accesslog.ParseFormat(Options.AccessLogFormat)
+		if err != nil {
+			log.Fatalf("Invalid access log configuration: %s", err)
+		}
+		var out io.Writer = os.Stdout
+		if Options.AccessLog != "-" {
+			f := &accesslog.RotatingFile{
+				Path:       Options.AccessLog,
+				MaxSize:    Options.AccessLogMaxSize,
+				MaxBackups: Options.AccessLogMaxBackups,
+			}
+			defer f.Close()
+			out = f
+		}
+		handler = &accesslog.Handler{Format: format, Out: out, Log: log, Next: handler}
+	}
 	server := &http.Server{
-		Addr: fmt.Sprintf(":%s", Options.Port),
+		Addr:              fmt.Sprintf(":%s", Options.Port),
+		Handler:           handler,
+		ReadHeaderTimeout: Options.ReadHeaderTimeout,
+		ReadTimeout:       Options.ReadTimeout,
+		IdleTimeout:       Options.IdleTimeout,
+		ConnContext:       deadline.ConnContext,
+	}
+	https := Options.HTTPSKeyFile != "" && Options.HTTPSCertFile != ""
+	if https && Options.TenantDomain != "" && Options.TenantCertsDir != "" {
+		cert, err := tls.LoadX509KeyPair(Options.HTTPSCertFile, Options.HTTPSKeyFile)
+		if err != nil {
+			log.Fatalf("Failed to load HTTPS certificate: %s", err)
+		}
+		certs := &imageserver.TenantCertificates{Domain: Options.TenantDomain, Dir: Options.TenantCertsDir, Default: &cert}
+		server.TLSConfig = &tls.Config{GetCertificate: certs.GetCertificate, MinVersion: tls.VersionTLS12}
+	}
+	// event streams stay open until the client leaves so end them when shutting down
+	server.RegisterOnShutdown(broker.Close)
+
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		log.Fatalf("Failed to listen on %s: %s", server.Addr, err)
+	}
+	// a host holding connections open shouldn't be able to exhaust the sockets available to other hosts
+	if Options.MaxConnections > 0 {
+		listener = netutil.LimitListener(listener, Options.MaxConnections)
 	}
 
 	go func() {
 		var err error
-		if Options.HTTPSKeyFile != "" && Options.HTTPSCertFile != "" {
+		if server.TLSConfig != nil {
+			log.Infof("Starting https handler with tenant certificates on %s...", server.Addr)
+			err = server.ServeTLS(listener, "", "")
+		} else if https {
 			log.Infof("Starting https handler on %s...", server.Addr)
-			err = server.ListenAndServeTLS(Options.HTTPSCertFile, Options.HTTPSKeyFile)
+			err = server.ServeTLS(listener, Options.HTTPSCertFile, Options.HTTPSKeyFile)
 		} else {
 			log.Infof("Starting http handler on %s...", server.Addr)
-			err = server.ListenAndServe()
+			err = server.Serve(listener)
 		}
 
 		if err != http.ErrServerClosed {
@@ -73,3 +306,54 @@ func main() {
 		log.Info("server terminated gracefully")
 	}
 }
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(relocationv1alpha1.AddToScheme(scheme))
+}
+
+// watchPhases publishes ClusterConfig phase changes to broker until ctx is done
+// It returns the cache of ClusterConfigs the changes are read from
+func watchPhases(ctx context.Context, cfg *rest.Config, broker *events.Broker) (client.Reader, error) {
+	c, err := cache.New(cfg, cache.Options{Scheme: scheme})
+	if err != nil {
+		return nil, err
+	}
+	informer, err := c.GetInformer(ctx, &relocationv1alpha1.ClusterConfig{})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := informer.AddEventHandler(apiserver.PhaseEventHandler(broker)); err != nil {
+		return nil, err
+	}
+	go func() {
+		if err := c.Start(ctx); err != nil {
+			logrus.WithError(err).Error("ClusterConfig cache stopped")
+		}
+	}()
+	return c, nil
+}
+
+// watchImageCredentials starts a cache of the image credentials secrets of every namespace
+func watchImageCredentials(ctx context.Context, cfg *rest.Config) (client.Reader, error) {
+	c, err := cache.New(cfg, cache.Options{
+		Scheme: scheme,
+		ByObject: map[client.Object]cache.ByObject{
+			&corev1.Secret{}: {Field: fields.OneTermEqualSelector("metadata.name", relocationv1alpha1.ImageCredentialsSecretName)},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.GetInformer(ctx, &corev1.Secret{}); err != nil {
+		return nil, err
+	}
+	go func() {
+		if err := c.Start(ctx); err != nil {
+			logrus.WithError(err).Error("image credentials cache stopped")
+		}
+	}()
+	return c, nil
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	bmh_v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+)
+
+// handleAbort detaches the image from the host, powering it off if requested, and records the abort in the status
+// Nothing is attached again until the abort annotation is removed
+func (r *ClusterConfigReconciler) handleAbort(ctx context.Context, log logrus.FieldLogger, config *relocationv1alpha1.ClusterConfig) (ctrl.Result, error) {
+	if bmhRef := configBMHRef(config); bmhRef != nil {
+		powerOff := config.Annotations[relocationv1alpha1.AbortAnnotation] == relocationv1alpha1.AbortPowerOff
+		if err := r.abortBMH(ctx, bmhRef, powerOff); err != nil {
+			log.WithError(err).Error("failed to detach BareMetalHost image")
+			return ctrl.Result{}, err
+		}
+	}
+	if err := r.setAborted(ctx, config); err != nil {
+		log.WithError(err).Error("failed to set aborted condition")
+		return ctrl.Result{}, err
+	}
+	if err := r.setPhase(ctx, config, relocationv1alpha1.ClusterConfigPhaseAborted); err != nil {
+		log.WithError(err).Error("failed to set phase")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// abortBMH detaches the image from the referenced host and powers it off if powerOff is set
+func (r *ClusterConfigReconciler) abortBMH(ctx context.Context, bmhRef *relocationv1alpha1.BareMetalHostReference, powerOff bool) error {
+	bmh := &bmh_v1alpha1.BareMetalHost{}
+	key := types.NamespacedName{Name: bmhRef.Name, Namespace: bmhRef.Namespace}
+	if err := r.Get(ctx, key, bmh); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if bmh.Spec.Image == nil && (!powerOff || !bmh.Spec.Online) {
+		return nil
+	}
+
+	patch := client.MergeFrom(bmh.DeepCopy())
+	bmh.Spec.Image = nil
+	if powerOff {
+		bmh.Spec.Online = false
+	}
+	return r.Patch(ctx, bmh, patch)
+}
+
+// setAborted sets the Aborted condition and marks the attempt in progress as aborted
+func (r *ClusterConfigReconciler) setAborted(ctx context.Context, config *relocationv1alpha1.ClusterConfig) error {
+	patch := client.MergeFrom(config.DeepCopy())
+	changed := false
+	if !meta.IsStatusConditionTrue(config.Status.Conditions, relocationv1alpha1.AbortedCondition) {
+		meta.SetStatusCondition(&config.Status.Conditions, metav1.Condition{
+			Type:               relocationv1alpha1.AbortedCondition,
+			Status:             metav1.ConditionTrue,
+			Reason:             relocationv1alpha1.AbortRequestedReason,
+			Message:            "the relocation was aborted, remove the " + relocationv1alpha1.AbortAnnotation + " annotation to attach the image again",
+			ObservedGeneration: config.Generation,
+		})
+		changed = true
+	}
+	if n := len(config.Status.Attempts); n > 0 && config.Status.Attempts[n-1].Outcome == relocationv1alpha1.RelocationAttemptInProgress {
+		now := metav1.Now()
+		config.Status.Attempts[n-1].Outcome = relocationv1alpha1.RelocationAttemptAborted
+		config.Status.Attempts[n-1].CompletionTime = &now
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return r.Status().Patch(ctx, config, patch)
+}
+
+// clearAbort removes the Aborted condition once the abort annotation is removed so the relocation starts over
+func (r *ClusterConfigReconciler) clearAbort(ctx context.Context, config *relocationv1alpha1.ClusterConfig) error {
+	if meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.AbortedCondition) == nil {
+		return nil
+	}
+	patch := client.MergeFrom(config.DeepCopy())
+	meta.RemoveStatusCondition(&config.Status.Conditions, relocationv1alpha1.AbortedCondition)
+	if err := r.Status().Patch(ctx, config, patch); err != nil {
+		return err
+	}
+	return r.setPhase(ctx, config, relocationv1alpha1.ClusterConfigPhasePending)
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/carbonin/cluster-relocation-service/api/isoschema"
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+	"github.com/carbonin/cluster-relocation-service/internal/filelock"
+	"github.com/carbonin/cluster-relocation-service/internal/tracing"
+)
+
+// adoptExistingData serves the payload already in the config data dir rather than rendering config
+// The files are verified against the payload manifest and the returned hash is computed from them
+func (r *ClusterConfigReconciler) adoptExistingData(ctx context.Context, config *relocationv1alpha1.ClusterConfig) (payloadHash string, diff *relocationv1alpha1.PayloadDiff, requeue bool, err error) {
+	ctx, span := tracing.Start(ctx, "adoptExistingData", tracing.ClusterConfigAttributes(config.Namespace, config.Name)...)
+	defer func() { tracing.End(span, err) }()
+
+	configDir := r.configDir(config)
+	filesDir := filepath.Join(configDir, "files")
+	if _, err := r.fs().Stat(filesDir); err != nil {
+		return "", nil, false, fmt.Errorf("no existing data to adopt: %w", err)
+	}
+
+	lockCtx, cancel := r.lockContext(ctx)
+	defer cancel()
+	locked, err := filelock.WithReadLockContext(lockCtx, configDir, func() error {
+		reader, err := isoschema.NewReader(os.DirFS(filesDir))
+		if err != nil {
+			return err
+		}
+		payloadHash, err = reader.Verify()
+		return err
+	})
+	if err != nil {
+		return "", nil, false, fmt.Errorf("failed to adopt existing data: %w", err)
+	}
+	if !locked {
+		return "", nil, true, nil
+	}
+
+	return payloadHash, nil, false, nil
+}
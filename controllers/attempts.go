@@ -0,0 +1,83 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+)
+
+// maxRelocationAttempts bounds the attempt history kept in the status
+const maxRelocationAttempts = 10
+
+// recordAttempt starts a new attempt if payloadHash hasn't been attached before
+// Any attempt still in progress is marked as superseded
+func (r *ClusterConfigReconciler) recordAttempt(ctx context.Context, config *relocationv1alpha1.ClusterConfig, payloadHash string) error {
+	attempts := config.Status.Attempts
+	// attaching the same payload again after an abort is a new attempt
+	if len(attempts) > 0 && attempts[len(attempts)-1].PayloadHash == payloadHash &&
+		attempts[len(attempts)-1].Outcome != relocationv1alpha1.RelocationAttemptAborted {
+		return nil
+	}
+
+	patch := client.MergeFrom(config.DeepCopy())
+	now := metav1.Now()
+	if len(attempts) > 0 && attempts[len(attempts)-1].Outcome == relocationv1alpha1.RelocationAttemptInProgress {
+		attempts[len(attempts)-1].Outcome = relocationv1alpha1.RelocationAttemptSuperseded
+		attempts[len(attempts)-1].CompletionTime = &now
+	}
+	attempts = append(attempts, relocationv1alpha1.RelocationAttempt{
+		PayloadHash: payloadHash,
+		StartTime:   now,
+		Outcome:     relocationv1alpha1.RelocationAttemptInProgress,
+	})
+	if len(attempts) > maxRelocationAttempts {
+		attempts = attempts[len(attempts)-maxRelocationAttempts:]
+	}
+	config.Status.Attempts = attempts
+
+	return r.Status().Patch(ctx, config, patch)
+}
+
+// completeAttempt marks the attempt in progress as succeeded at the time the relocation reported completion
+func (r *ClusterConfigReconciler) completeAttempt(ctx context.Context, config *relocationv1alpha1.ClusterConfig) error {
+	attempts := config.Status.Attempts
+	if len(attempts) == 0 || attempts[len(attempts)-1].Outcome != relocationv1alpha1.RelocationAttemptInProgress {
+		return nil
+	}
+
+	completed := metav1.Now()
+	if cond := meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.RelocationCompletedCondition); cond != nil {
+		completed = cond.LastTransitionTime
+	}
+	last := &config.Status.Attempts[len(attempts)-1]
+	// the completion was reported for a configuration attached before this attempt
+	if completed.Before(&last.StartTime) {
+		return nil
+	}
+
+	patch := client.MergeFrom(config.DeepCopy())
+	last.Outcome = relocationv1alpha1.RelocationAttemptSucceeded
+	last.CompletionTime = &completed
+
+	return r.Status().Patch(ctx, config, patch)
+}
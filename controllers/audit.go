@@ -0,0 +1,245 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	bmh_v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/carbonin/cluster-relocation-service/api/isoschema"
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+	"github.com/carbonin/cluster-relocation-service/internal/metrics"
+	"github.com/carbonin/cluster-relocation-service/internal/report"
+)
+
+// orphanedImageReason is the event reason for a BareMetalHost with an image served for a ClusterConfig which
+// doesn't reference it
+const orphanedImageReason = "OrphanedImage"
+
+// ConsistencyAuditor periodically cross-checks ClusterConfigs against their rendered files and BareMetalHosts
+// Discrepancies are reported in the Consistent condition, as events, and in the audit metrics, nothing is repaired
+type ConsistencyAuditor struct {
+	Reconciler *ClusterConfigReconciler
+	// Notifier logs and records an event for each discrepancy, nil disables both
+	Notifier *report.Notifier
+	Interval time.Duration
+}
+
+// Start runs the audit every Interval until the context is cancelled
+func (a *ConsistencyAuditor) Start(ctx context.Context) error {
+	wait.UntilWithContext(ctx, a.audit, a.Interval)
+	return nil
+}
+
+func (a *ConsistencyAuditor) audit(ctx context.Context) {
+	r := a.Reconciler
+	configs := &relocationv1alpha1.ClusterConfigList{}
+	if err := r.List(ctx, configs); err != nil {
+		r.Log.WithError(err).Error("failed to list cluster configs for audit")
+		return
+	}
+	hosts, err := a.listAttachedHosts(ctx)
+	if err != nil {
+		r.Log.WithError(err).Error("failed to list BareMetalHosts for audit")
+		return
+	}
+
+	discrepancies := map[string]int{
+		relocationv1alpha1.MissingFilesReason:     0,
+		relocationv1alpha1.ImageURLMismatchReason: 0,
+		orphanedImageReason:                       0,
+	}
+	referencedBy := map[types.NamespacedName]types.NamespacedName{}
+	for i := range configs.Items {
+		config := &configs.Items[i]
+		log := r.Log.WithFields(logrus.Fields{"name": config.Name, "namespace": config.Namespace})
+		if ref := configBMHRef(config); ref != nil {
+			referencedBy[types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}] = client.ObjectKeyFromObject(config)
+		}
+
+		reason, message, err := a.check(config, hosts)
+		if err != nil {
+			log.WithError(err).Error("failed to audit cluster config")
+			continue
+		}
+		if reason != relocationv1alpha1.ConsistentReason {
+			discrepancies[reason]++
+			a.Notifier.Warningf(config, reason, "%s", message)
+		}
+		if err := a.setConsistent(ctx, config, reason, message); err != nil {
+			log.WithError(err).Error("failed to set consistent condition")
+		}
+	}
+
+	for key, host := range hosts {
+		owner, ok := a.servedFor(host.Spec.Image.URL)
+		if !ok || referencedBy[key] == owner {
+			continue
+		}
+		discrepancies[orphanedImageReason]++
+		message := fmt.Sprintf("the image for ClusterConfig %s is attached but the ClusterConfig doesn't reference this BareMetalHost", owner)
+		a.Notifier.Warningf(host, orphanedImageReason, "%s", message)
+	}
+
+	for reason, count := range discrepancies {
+		metrics.AuditDiscrepancies.WithLabelValues(reason).Set(float64(count))
+	}
+	metrics.AuditLastRun.SetToCurrentTime()
+}
+
+// auditPageSize is the number of BareMetalHosts read from the API server per request
+const auditPageSize = 500
+
+// listAttachedHosts returns the BareMetalHosts with an image attached, keeping only their names and image
+// Hosts which aren't referenced aren't cached, and those are the ones which may carry an orphaned image, so they're
+// read from the API server a page at a time rather than holding every host on the hub in memory at once
+func (a *ConsistencyAuditor) listAttachedHosts(ctx context.Context) (map[types.NamespacedName]*bmh_v1alpha1.BareMetalHost, error) {
+	r := a.Reconciler
+	var reader client.Reader = r.Client
+	opts := &client.ListOptions{}
+	// the cache doesn't support continuing a list, it returns the first page only
+	if r.APIReader != nil {
+		reader = r.APIReader
+		opts.Limit = auditPageSize
+	}
+
+	hosts := map[types.NamespacedName]*bmh_v1alpha1.BareMetalHost{}
+	for {
+		page := &bmh_v1alpha1.BareMetalHostList{}
+		if err := reader.List(ctx, page, opts); err != nil {
+			return nil, err
+		}
+		for i := range page.Items {
+			host := &page.Items[i]
+			if host.Spec.Image == nil {
+				continue
+			}
+			hosts[client.ObjectKeyFromObject(host)] = &bmh_v1alpha1.BareMetalHost{
+				ObjectMeta: metav1.ObjectMeta{Namespace: host.Namespace, Name: host.Name, UID: host.UID},
+				Spec:       bmh_v1alpha1.BareMetalHostSpec{Image: host.Spec.Image},
+			}
+		}
+		if page.Continue == "" {
+			return hosts, nil
+		}
+		opts.Continue = page.Continue
+	}
+}
+
+// check returns the Consistent condition reason and message for config
+// The rendered files are checked once a payload has been written, the image isn't as it's built from them on request
+func (a *ConsistencyAuditor) check(config *relocationv1alpha1.ClusterConfig, hosts map[types.NamespacedName]*bmh_v1alpha1.BareMetalHost) (string, string, error) {
+	r := a.Reconciler
+	finished := config.Status.Phase == relocationv1alpha1.ClusterConfigPhaseCompleted
+	if config.Spec.ExternalImageURL == "" && config.Status.PayloadHash != "" && !finished {
+		manifest := filepath.Join(r.configDir(config), "files", isoschema.ManifestFileName)
+		if _, err := r.fs().Stat(manifest); err != nil {
+			if !os.IsNotExist(err) {
+				return "", "", err
+			}
+			return relocationv1alpha1.MissingFilesReason, "the rendered files for the image are missing from the data directory", nil
+		}
+	}
+
+	ref := configBMHRef(config)
+	if ref != nil && config.Status.Phase == relocationv1alpha1.ClusterConfigPhaseImageAttached {
+		expected := config.Status.CachedImageURL
+		if expected == "" {
+			var err error
+			if expected, err = r.imageURL(config); err != nil {
+				return "", "", err
+			}
+		}
+		host := hosts[types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}]
+		if host == nil || host.Spec.Image == nil || withoutCredentials(host.Spec.Image.URL) != expected {
+			return relocationv1alpha1.ImageURLMismatchReason, fmt.Sprintf("BareMetalHost %s/%s doesn't have the image %s attached", ref.Namespace, ref.Name, expected), nil
+		}
+	}
+
+	return relocationv1alpha1.ConsistentReason, "the rendered files and BareMetalHost image match the ClusterConfig", nil
+}
+
+// servedFor returns the ClusterConfig an image URL is served for if it points at the image service
+func (a *ConsistencyAuditor) servedFor(imageURL string) (types.NamespacedName, bool) {
+	r := a.Reconciler
+	bases := []string{r.baseURL()}
+	for _, u := range r.Options.ZoneServiceURLs {
+		bases = append(bases, u)
+	}
+
+	u, err := url.Parse(imageURL)
+	if err != nil {
+		return types.NamespacedName{}, false
+	}
+	u.User = nil
+	u.RawQuery = ""
+	if domain := r.Options.TenantDomain; domain != "" && strings.HasSuffix(u.Hostname(), "."+domain) {
+		bases = append(bases, r.tenantURL(strings.TrimSuffix(u.Hostname(), "."+domain)))
+	}
+	for _, base := range bases {
+		prefix, err := url.JoinPath(base, "images")
+		if err != nil || !strings.HasPrefix(u.String(), prefix+"/") {
+			continue
+		}
+		parts := strings.Split(strings.TrimPrefix(u.String(), prefix+"/"), "/")
+		if len(parts) != 2 || !strings.HasSuffix(parts[1], ".iso") {
+			continue
+		}
+		return types.NamespacedName{Namespace: parts[0], Name: strings.TrimSuffix(parts[1], ".iso")}, true
+	}
+	return types.NamespacedName{}, false
+}
+
+// withoutCredentials removes the basic auth credentials added to image URLs with ImageBasicAuth
+func withoutCredentials(imageURL string) string {
+	u, err := url.Parse(imageURL)
+	if err != nil {
+		return imageURL
+	}
+	u.User = nil
+	return u.String()
+}
+
+func (a *ConsistencyAuditor) setConsistent(ctx context.Context, config *relocationv1alpha1.ClusterConfig, reason, message string) error {
+	status := metav1.ConditionTrue
+	if reason != relocationv1alpha1.ConsistentReason {
+		status = metav1.ConditionFalse
+	}
+	patch := client.MergeFrom(config.DeepCopy())
+	if !report.SetCondition(&config.Status.Conditions, metav1.Condition{
+		Type:               relocationv1alpha1.ConsistentCondition,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: config.Generation,
+	}) {
+		return nil
+	}
+	return a.Reconciler.Status().Patch(ctx, config, patch)
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+
+	bmh_v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+)
+
+// bmhOwner returns the ClusterConfigAnnotation value for config, or an empty string if the annotation is disabled
+func (r *ClusterConfigReconciler) bmhOwner(config *relocationv1alpha1.ClusterConfig) string {
+	if !r.Options.BMHOwnerAnnotation {
+		return ""
+	}
+	return types.NamespacedName{Namespace: config.Namespace, Name: config.Name}.String()
+}
+
+// annotatedOwner returns a request for the ClusterConfig named by the ClusterConfigAnnotation on bmh
+// It returns false if there is no annotation or the ClusterConfig no longer references bmh
+func (r *ClusterConfigReconciler) annotatedOwner(ctx context.Context, bmh client.Object) (reconcile.Request, bool) {
+	namespace, name, ok := strings.Cut(bmh.GetAnnotations()[relocationv1alpha1.ClusterConfigAnnotation], "/")
+	if !ok {
+		return reconcile.Request{}, false
+	}
+
+	key := types.NamespacedName{Namespace: namespace, Name: name}
+	config := &relocationv1alpha1.ClusterConfig{}
+	if err := r.Get(ctx, key, config); err != nil {
+		return reconcile.Request{}, false
+	}
+	ref := configBMHRef(config)
+	if ref == nil || ref.Name != bmh.GetName() || ref.Namespace != bmh.GetNamespace() {
+		return reconcile.Request{}, false
+	}
+	return reconcile.Request{NamespacedName: key}, true
+}
+
+// removeBMHOwner removes the ClusterConfigAnnotation from the host referenced by config if it names config
+func (r *ClusterConfigReconciler) removeBMHOwner(ctx context.Context, config *relocationv1alpha1.ClusterConfig) error {
+	ref := configBMHRef(config)
+	if ref == nil {
+		return nil
+	}
+	bmh := &bmh_v1alpha1.BareMetalHost{}
+	key := types.NamespacedName{Name: ref.Name, Namespace: ref.Namespace}
+	if err := r.Get(ctx, key, bmh); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	owner := types.NamespacedName{Namespace: config.Namespace, Name: config.Name}.String()
+	if bmh.Annotations[relocationv1alpha1.ClusterConfigAnnotation] != owner {
+		return nil
+	}
+
+	// the host may be deleted along with its namespace in the meantime
+	patch := client.MergeFrom(bmh.DeepCopy())
+	delete(bmh.Annotations, relocationv1alpha1.ClusterConfigAnnotation)
+	return client.IgnoreNotFound(r.Patch(ctx, bmh, patch))
+}
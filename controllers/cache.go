@@ -0,0 +1,176 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	bmh_v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+)
+
+// bmhRefIndex indexes ClusterConfigs by the namespace/name of their BareMetalHostRef
+const bmhRefIndex = "spec.bareMetalHostRef"
+
+// bmhRefIndexValue returns the bmhRefIndex values for a ClusterConfig
+func bmhRefIndexValue(obj client.Object) []string {
+	config, ok := obj.(*relocationv1alpha1.ClusterConfig)
+	if !ok || config.Spec.BareMetalHostRef == nil {
+		return nil
+	}
+	ref := configBMHRef(config)
+	return []string{types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}.String()}
+}
+
+// inputRefIndex indexes ClusterConfigs by the Secrets and ConfigMaps their payload is rendered from
+const inputRefIndex = "spec.inputRefs"
+
+// inputRefIndexValue returns the inputRefIndex values for a ClusterConfig
+func inputRefIndexValue(obj client.Object) []string {
+	config, ok := obj.(*relocationv1alpha1.ClusterConfig)
+	if !ok {
+		return nil
+	}
+	var values []string
+	for _, pr := range payloadRenderers {
+		if pr.Inputs == nil {
+			continue
+		}
+		for _, in := range pr.Inputs(config) {
+			values = append(values, inputRefKey(in.Kind, types.NamespacedName{Namespace: in.Namespace, Name: in.Name}))
+		}
+	}
+	return values
+}
+
+// inputRefKey returns the inputRefIndex value of the object of kind with key
+func inputRefKey(kind string, key types.NamespacedName) string {
+	return kind + "/" + key.String()
+}
+
+// inputMetadata returns the metadata only object used to watch payload inputs of kind
+func inputMetadata(kind string) *metav1.PartialObjectMetadata {
+	return &metav1.PartialObjectMetadata{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: kind}}
+}
+
+// lastAppliedAnnotation is set by kubectl apply and holds a copy of the object
+const lastAppliedAnnotation = corev1.LastAppliedConfigAnnotation
+
+// CacheOptions returns the manager cache options limiting the objects and fields held in memory.
+// Only BareMetalHosts with the ReferencedBareMetalHostLabel are cached, and fields the controller never reads are
+// removed, so cached BareMetalHosts must only be patched as an update would remove the fields.
+// Only the labels and names of Secrets and ConfigMaps are cached to watch payload inputs
+func CacheOptions() cache.Options {
+	return cache.Options{
+		ByObject: map[client.Object]cache.ByObject{
+			&bmh_v1alpha1.BareMetalHost{}: {
+				Label:     labels.SelectorFromSet(labels.Set{relocationv1alpha1.ReferencedBareMetalHostLabel: "true"}),
+				Transform: stripBMH,
+			},
+			&relocationv1alpha1.ClusterConfig{}: {
+				Transform: stripManagedFields,
+			},
+			inputMetadata("Secret"): {
+				Transform: stripInputMetadata,
+			},
+			inputMetadata("ConfigMap"): {
+				Transform: stripInputMetadata,
+			},
+		},
+	}
+}
+
+// UncachedObjects are read directly from the API server rather than caching every one on the hub
+// Only objects referenced by ClusterConfigs are read, changes to them are watched through their metadata
+func UncachedObjects() []client.Object {
+	return []client.Object{&corev1.Secret{}, &corev1.ConfigMap{}}
+}
+
+// stripManagedFields removes the managed fields from cached objects
+// The API server keeps the existing managed fields when an update doesn't include them
+func stripManagedFields(obj interface{}) (interface{}, error) {
+	if o, ok := obj.(client.Object); ok {
+		o.SetManagedFields(nil)
+	}
+	return obj, nil
+}
+
+// stripInputMetadata removes the managed fields and annotations from cached Secret and ConfigMap metadata
+// Annotations such as the last applied configuration can be as large as the object itself
+func stripInputMetadata(obj interface{}) (interface{}, error) {
+	if o, ok := obj.(client.Object); ok {
+		o.SetManagedFields(nil)
+		o.SetAnnotations(nil)
+	}
+	return obj, nil
+}
+
+// stripBMH removes the managed fields, copies of the status and hardware details kept in annotations,
+// and the CPU flags from cached BareMetalHosts
+func stripBMH(obj interface{}) (interface{}, error) {
+	bmh, ok := obj.(*bmh_v1alpha1.BareMetalHost)
+	if !ok {
+		return obj, nil
+	}
+	bmh.SetManagedFields(nil)
+	for _, a := range []string{lastAppliedAnnotation, bmh_v1alpha1.StatusAnnotation, bmh_v1alpha1.HardwareDetailsAnnotation} {
+		delete(bmh.Annotations, a)
+	}
+	if bmh.Status.HardwareDetails != nil {
+		bmh.Status.HardwareDetails.CPU.Flags = nil
+	}
+	return bmh, nil
+}
+
+// ensureBMHCached adds the ReferencedBareMetalHostLabel to the referenced host so it's included in the cache
+// It returns false if the host exists but isn't in the cache yet, the BareMetalHost watch reconciles again once it is
+func (r *ClusterConfigReconciler) ensureBMHCached(ctx context.Context, bmhRef *relocationv1alpha1.BareMetalHostReference) (bool, error) {
+	key := types.NamespacedName{Name: bmhRef.Name, Namespace: bmhRef.Namespace}
+	bmh := &bmh_v1alpha1.BareMetalHost{}
+	cached := true
+	if err := r.Get(ctx, key, bmh); err != nil {
+		if !errors.IsNotFound(err) {
+			return false, err
+		}
+		// a missing host is handled by the caller
+		if r.APIReader == nil {
+			return true, nil
+		}
+		if err := r.APIReader.Get(ctx, key, bmh); err != nil {
+			return errors.IsNotFound(err), client.IgnoreNotFound(err)
+		}
+		cached = false
+	}
+	if bmh.Labels[relocationv1alpha1.ReferencedBareMetalHostLabel] == "true" {
+		return cached, nil
+	}
+
+	patch := client.MergeFrom(bmh.DeepCopy())
+	if bmh.Labels == nil {
+		bmh.Labels = map[string]string{}
+	}
+	bmh.Labels[relocationv1alpha1.ReferencedBareMetalHostLabel] = "true"
+	return cached, r.Patch(ctx, bmh, patch)
+}
@@ -0,0 +1,205 @@
+package controllers
+
+import (
+	"context"
+
+	cro "github.com/RHsyseng/cluster-relocation-operator/api/v1beta1"
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+	bmh_v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("ensureBMHCached", func() {
+	var (
+		ctx       = context.Background()
+		apiServer client.WithWatch
+		r         *ClusterConfigReconciler
+		ref       = &relocationv1alpha1.BareMetalHostReference{Name: "host", Namespace: "hosts"}
+		key       = types.NamespacedName{Name: "host", Namespace: "hosts"}
+		synced    bool
+	)
+
+	BeforeEach(func() {
+		apiServer = fakeclient.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		synced = false
+		// the cache only returns labeled hosts once they have been synced
+		cached := interceptor.NewClient(apiServer, interceptor.Funcs{
+			Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+				if err := c.Get(ctx, key, obj, opts...); err != nil {
+					return err
+				}
+				if _, ok := obj.(*bmh_v1alpha1.BareMetalHost); ok && (!synced || obj.GetLabels()[relocationv1alpha1.ReferencedBareMetalHostLabel] != "true") {
+					return apierrors.NewNotFound(bmh_v1alpha1.GroupVersion.WithResource("baremetalhosts").GroupResource(), key.Name)
+				}
+				return nil
+			},
+		})
+		r = &ClusterConfigReconciler{Client: cached, APIReader: apiServer}
+	})
+
+	It("labels a host which isn't cached and waits for it to be synced", func() {
+		Expect(apiServer.Create(ctx, &bmh_v1alpha1.BareMetalHost{ObjectMeta: metav1.ObjectMeta{Name: ref.Name, Namespace: ref.Namespace}})).To(Succeed())
+
+		cached, err := r.ensureBMHCached(ctx, ref)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cached).To(BeFalse())
+		bmh := &bmh_v1alpha1.BareMetalHost{}
+		Expect(apiServer.Get(ctx, key, bmh)).To(Succeed())
+		Expect(bmh.Labels).To(HaveKeyWithValue(relocationv1alpha1.ReferencedBareMetalHostLabel, "true"))
+
+		synced = true
+		cached, err = r.ensureBMHCached(ctx, ref)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cached).To(BeTrue())
+	})
+
+	It("labels hosts read from an unfiltered cache", func() {
+		Expect(apiServer.Create(ctx, &bmh_v1alpha1.BareMetalHost{ObjectMeta: metav1.ObjectMeta{Name: ref.Name, Namespace: ref.Namespace}})).To(Succeed())
+		r.Client = apiServer
+
+		cached, err := r.ensureBMHCached(ctx, ref)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cached).To(BeTrue())
+		bmh := &bmh_v1alpha1.BareMetalHost{}
+		Expect(apiServer.Get(ctx, key, bmh)).To(Succeed())
+		Expect(bmh.Labels).To(HaveKeyWithValue(relocationv1alpha1.ReferencedBareMetalHostLabel, "true"))
+	})
+
+	It("leaves missing hosts to the caller", func() {
+		cached, err := r.ensureBMHCached(ctx, ref)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cached).To(BeTrue())
+	})
+})
+
+var _ = Describe("cache transforms", func() {
+	It("strips fields the controller doesn't read from BareMetalHosts", func() {
+		bmh := &bmh_v1alpha1.BareMetalHost{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{
+					corev1.LastAppliedConfigAnnotation:         "{}",
+					bmh_v1alpha1.StatusAnnotation:              "{}",
+					bmh_v1alpha1.HardwareDetailsAnnotation:     "{}",
+					relocationv1alpha1.ClusterConfigAnnotation: "ns/name",
+				},
+				ManagedFields: []metav1.ManagedFieldsEntry{{Manager: "kubectl"}},
+			},
+			Status: bmh_v1alpha1.BareMetalHostStatus{
+				HardwareDetails: &bmh_v1alpha1.HardwareDetails{
+					CPU:     bmh_v1alpha1.CPU{Count: 8, Flags: []string{"avx", "sse4_2"}},
+					NIC:     []bmh_v1alpha1.NIC{{Name: "eno1", MAC: "00:11:22:33:44:55"}},
+					Storage: []bmh_v1alpha1.Storage{{Name: "/dev/sda"}},
+				},
+			},
+		}
+
+		obj, err := stripBMH(bmh)
+		Expect(err).NotTo(HaveOccurred())
+		stripped := obj.(*bmh_v1alpha1.BareMetalHost)
+		Expect(stripped.Annotations).To(Equal(map[string]string{relocationv1alpha1.ClusterConfigAnnotation: "ns/name"}))
+		Expect(stripped.ManagedFields).To(BeNil())
+		Expect(stripped.Status.HardwareDetails.CPU.Flags).To(BeNil())
+		Expect(stripped.Status.HardwareDetails.CPU.Count).To(Equal(8))
+		Expect(stripped.Status.HardwareDetails.NIC).To(HaveLen(1))
+		Expect(stripped.Status.HardwareDetails.Storage).To(HaveLen(1))
+	})
+
+	It("strips managed fields from ClusterConfigs", func() {
+		config := &relocationv1alpha1.ClusterConfig{ObjectMeta: metav1.ObjectMeta{
+			ManagedFields: []metav1.ManagedFieldsEntry{{Manager: "kubectl"}},
+			Annotations:   map[string]string{corev1.LastAppliedConfigAnnotation: "{}"},
+		}}
+		obj, err := stripManagedFields(config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(obj.(*relocationv1alpha1.ClusterConfig).ManagedFields).To(BeNil())
+		Expect(obj.(*relocationv1alpha1.ClusterConfig).Annotations).To(HaveKey(corev1.LastAppliedConfigAnnotation))
+	})
+
+	It("only keeps the names and labels of payload inputs", func() {
+		secret := inputMetadata("Secret")
+		secret.ObjectMeta = metav1.ObjectMeta{
+			Name:          "pull-secret",
+			Namespace:     "shared",
+			Labels:        map[string]string{"app": "relocation"},
+			Annotations:   map[string]string{corev1.LastAppliedConfigAnnotation: "{}"},
+			ManagedFields: []metav1.ManagedFieldsEntry{{Manager: "kubectl"}},
+		}
+		obj, err := stripInputMetadata(secret)
+		Expect(err).NotTo(HaveOccurred())
+		stripped := obj.(*metav1.PartialObjectMetadata)
+		Expect(stripped.Name).To(Equal("pull-secret"))
+		Expect(stripped.Labels).To(HaveKey("app"))
+		Expect(stripped.Annotations).To(BeNil())
+		Expect(stripped.ManagedFields).To(BeNil())
+	})
+})
+
+var _ = Describe("mapInputToCC", func() {
+	var (
+		c   client.Client
+		r   *ClusterConfigReconciler
+		ctx = context.Background()
+	)
+
+	BeforeEach(func() {
+		c = fakeclient.NewClientBuilder().
+			WithScheme(scheme.Scheme).
+			WithIndex(&relocationv1alpha1.ClusterConfig{}, inputRefIndex, inputRefIndexValue).
+			Build()
+		r = &ClusterConfigReconciler{Client: c, Scheme: scheme.Scheme}
+	})
+
+	input := func(kind, namespace, name string) *metav1.PartialObjectMetadata {
+		obj := inputMetadata(kind)
+		obj.Namespace = namespace
+		obj.Name = name
+		return obj
+	}
+
+	It("returns requests for the ClusterConfigs rendered from the input", func() {
+		shared := &relocationv1alpha1.ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "site-1", Namespace: "site-1"},
+			Spec: relocationv1alpha1.ClusterConfigSpec{
+				ClusterRelocationSpec: cro.ClusterRelocationSpec{
+					PullSecretRef: &corev1.SecretReference{Name: "pull-secret", Namespace: "shared"},
+				},
+			},
+		}
+		additional := &relocationv1alpha1.ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "site-2", Namespace: "site-2"},
+			Spec: relocationv1alpha1.ClusterConfigSpec{
+				ClusterRelocationSpec: cro.ClusterRelocationSpec{
+					PullSecretRef: &corev1.SecretReference{Name: "site-pull-secret", Namespace: "site-2"},
+				},
+				AdditionalPullSecretRefs: []corev1.SecretReference{{Name: "pull-secret", Namespace: "shared"}},
+				AdditionalTrustBundleRef: &corev1.LocalObjectReference{Name: "ca-bundle"},
+			},
+		}
+		other := &relocationv1alpha1.ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "site-3", Namespace: "site-3"},
+		}
+		for _, config := range []*relocationv1alpha1.ClusterConfig{shared, additional, other} {
+			Expect(c.Create(ctx, config)).To(Succeed())
+		}
+
+		Expect(r.mapInputToCC(ctx, input("Secret", "shared", "pull-secret"))).To(ConsistOf(
+			reconcile.Request{NamespacedName: client.ObjectKeyFromObject(shared)},
+			reconcile.Request{NamespacedName: client.ObjectKeyFromObject(additional)},
+		))
+		Expect(r.mapInputToCC(ctx, input("ConfigMap", "site-2", "ca-bundle"))).To(ConsistOf(
+			reconcile.Request{NamespacedName: client.ObjectKeyFromObject(additional)},
+		))
+		Expect(r.mapInputToCC(ctx, input("ConfigMap", "shared", "pull-secret"))).To(BeEmpty())
+		Expect(r.mapInputToCC(ctx, input("Secret", "site-3", "unrelated"))).To(BeEmpty())
+	})
+})
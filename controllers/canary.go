@@ -0,0 +1,258 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+	"github.com/carbonin/cluster-relocation-service/internal/report"
+)
+
+// canaryRecheckInterval is how often a held re-attach checks the canaries again as other ClusterConfigs aren't watched
+const canaryRecheckInterval = time.Minute
+
+// canaryHold is why changes to the shared inputs of a payload aren't rendered yet
+type canaryHold struct {
+	Reason  string
+	Message string
+}
+
+// isShared returns true if s is an input of config outside its namespace
+// Sites usually have a namespace each so a change to one of these inputs affects many ClusterConfigs
+func isShared(config *relocationv1alpha1.ClusterConfig, s relocationv1alpha1.BuildSource) bool {
+	return s.Kind != "ClusterConfig" && s.Namespace != config.Namespace
+}
+
+// sharedSources returns the shared inputs of the rendered payload of config
+func sharedSources(config *relocationv1alpha1.ClusterConfig) []relocationv1alpha1.BuildSource {
+	if config.Status.BuildInfo == nil {
+		return nil
+	}
+	var shared []relocationv1alpha1.BuildSource
+	for _, s := range config.Status.BuildInfo.Sources {
+		if isShared(config, s) {
+			shared = append(shared, s)
+		}
+	}
+	return shared
+}
+
+// changedSharedSources returns the current versions of the shared inputs of config which differ from the versions
+// its rendered payload was built from
+func (r *ClusterConfigReconciler) changedSharedSources(ctx context.Context, config *relocationv1alpha1.ClusterConfig) ([]relocationv1alpha1.BuildSource, error) {
+	sources, err := r.payloadSources(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payload inputs: %w", err)
+	}
+	var changed []relocationv1alpha1.BuildSource
+	for _, s := range sources {
+		source := relocationv1alpha1.BuildSource(s)
+		if !isShared(config, source) {
+			continue
+		}
+		if rendered, ok := findSource(config, source); !ok || rendered.ResourceVersion != source.ResourceVersion {
+			changed = append(changed, source)
+		}
+	}
+	return changed, nil
+}
+
+// findSource returns the source of the rendered payload of config with the kind, namespace and name of s
+func findSource(config *relocationv1alpha1.ClusterConfig, s relocationv1alpha1.BuildSource) (relocationv1alpha1.BuildSource, bool) {
+	if config.Status.BuildInfo == nil {
+		return relocationv1alpha1.BuildSource{}, false
+	}
+	for _, other := range config.Status.BuildInfo.Sources {
+		if other.Kind == s.Kind && other.Namespace == s.Namespace && other.Name == s.Name {
+			return other, true
+		}
+	}
+	return relocationv1alpha1.BuildSource{}, false
+}
+
+// canaries returns the members of a rollout of s which are re-attached first
+// Members are ordered by a hash of the source and their name so the choice is stable while spreading the canaries
+// of different inputs across the fleet. At least one member is a canary
+func canaries(members []relocationv1alpha1.ClusterConfig, s relocationv1alpha1.BuildSource, percent int) []relocationv1alpha1.ClusterConfig {
+	rank := func(config *relocationv1alpha1.ClusterConfig) uint32 {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(fmt.Sprintf("%s/%s/%s/%s/%s", s.Kind, s.Namespace, s.Name, config.Namespace, config.Name)))
+		return h.Sum32()
+	}
+	sorted := append([]relocationv1alpha1.ClusterConfig{}, members...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ri, rj := rank(&sorted[i]), rank(&sorted[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return client.ObjectKeyFromObject(&sorted[i]).String() < client.ObjectKeyFromObject(&sorted[j]).String()
+	})
+	n := (len(sorted)*percent + 99) / 100
+	if n < 1 {
+		n = 1
+	}
+	if n > len(sorted) {
+		n = len(sorted)
+	}
+	return sorted[:n]
+}
+
+// containsConfig returns true if configs includes config
+func containsConfig(configs []relocationv1alpha1.ClusterConfig, config *relocationv1alpha1.ClusterConfig) bool {
+	for i := range configs {
+		if configs[i].Namespace == config.Namespace && configs[i].Name == config.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// canaryFailed returns true if the host of config failed after the current payload was attached
+func canaryFailed(config *relocationv1alpha1.ClusterConfig) bool {
+	if config.Status.Phase == relocationv1alpha1.ClusterConfigPhaseFailed {
+		return true
+	}
+	return meta.IsStatusConditionTrue(config.Status.Conditions, relocationv1alpha1.HostErrorCondition)
+}
+
+// checkCanaries returns why rendering the changes to the shared inputs of config is held for their canaries, nil if
+// they may be rendered. It is checked before rendering so neither the host nor anyone downloading the image gets a
+// change before the canaries have succeeded with it. Only hosts which have attached an image before are held
+func (r *ClusterConfigReconciler) checkCanaries(ctx context.Context, config *relocationv1alpha1.ClusterConfig) (*canaryHold, error) {
+	if r.Options.CanaryPercent <= 0 || config.Spec.BareMetalHostRef == nil || len(config.Status.Attempts) == 0 {
+		return nil, nil
+	}
+	// images built elsewhere and adopted payloads aren't rendered here
+	if config.Spec.ExternalImageURL != "" || config.Spec.AdoptExistingData || config.Status.BuildInfo == nil {
+		return nil, nil
+	}
+	changed, err := r.changedSharedSources(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	return r.checkRollouts(ctx, config, changed)
+}
+
+// checkRollouts returns why config is held for the canaries of the shared input versions in changed, nil if it may
+// render them. The ClusterConfigs rendered from each shared input form a rollout in which the canaries render and
+// attach the current version of the input first. The others are held until every canary has attached it and
+// succeeded, and the rollout pauses if any of them fails
+func (r *ClusterConfigReconciler) checkRollouts(ctx context.Context, config *relocationv1alpha1.ClusterConfig, changed []relocationv1alpha1.BuildSource) (*canaryHold, error) {
+	if r.Options.CanaryPercent <= 0 || len(changed) == 0 {
+		return nil, nil
+	}
+
+	configs := &relocationv1alpha1.ClusterConfigList{}
+	if err := r.List(ctx, configs); err != nil {
+		return nil, fmt.Errorf("failed to list ClusterConfigs: %w", err)
+	}
+
+	for _, s := range changed {
+		// only configs which have attached an image before are re-attached
+		var members []relocationv1alpha1.ClusterConfig
+		for _, other := range configs.Items {
+			if other.Spec.BareMetalHostRef == nil || len(other.Status.Attempts) == 0 {
+				continue
+			}
+			if _, ok := findSource(&other, s); ok {
+				members = append(members, other)
+			}
+		}
+
+		selected := canaries(members, s, r.Options.CanaryPercent)
+		if containsConfig(selected, config) {
+			continue
+		}
+		var pending []string
+		for i := range selected {
+			canary := &selected[i]
+			key := client.ObjectKeyFromObject(canary).String()
+
+			// a canary has attached the change once its last attempt is for a payload rendered from the same version
+			source, _ := findSource(canary, s)
+			last := canary.Status.Attempts[len(canary.Status.Attempts)-1]
+			if source.ResourceVersion != s.ResourceVersion || last.PayloadHash != canary.Status.BuildInfo.PayloadHash {
+				pending = append(pending, key)
+				continue
+			}
+			if canaryFailed(canary) {
+				return &canaryHold{
+					Reason: relocationv1alpha1.CanaryFailedReason,
+					Message: fmt.Sprintf("canary %s failed after attaching the change to %s %s/%s, the rollout is paused until it is fixed",
+						key, s.Kind, s.Namespace, s.Name),
+				}, nil
+			}
+			if last.Outcome != relocationv1alpha1.RelocationAttemptSucceeded {
+				pending = append(pending, key)
+			}
+		}
+		if len(pending) > 0 {
+			return &canaryHold{
+				Reason: relocationv1alpha1.CanariesInProgressReason,
+				Message: fmt.Sprintf("waiting for canaries %v to succeed with the change to %s %s/%s",
+					pending, s.Kind, s.Namespace, s.Name),
+			}, nil
+		}
+	}
+	return nil, nil
+}
+
+// keepRenderedPayload leaves the rendered payload in place while changes to its shared inputs are held
+// Changes to the other inputs aren't rendered either as the previous versions of the shared inputs aren't kept
+// It has the same signature as writeInputData and returns the hash of the rendered payload
+func (r *ClusterConfigReconciler) keepRenderedPayload(_ context.Context, config *relocationv1alpha1.ClusterConfig) (string, *relocationv1alpha1.PayloadDiff, bool, error) {
+	return config.Status.BuildInfo.PayloadHash, nil, false, nil
+}
+
+// setReattachHeld records whether rendering the changed shared inputs is held in the ReattachHeld condition
+// The condition is only added once a change is held and then kept up to date
+func (r *ClusterConfigReconciler) setReattachHeld(ctx context.Context, config *relocationv1alpha1.ClusterConfig, hold *canaryHold) error {
+	if hold == nil && meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.ReattachHeldCondition) == nil {
+		return nil
+	}
+
+	cond := metav1.Condition{
+		Type:               relocationv1alpha1.ReattachHeldCondition,
+		Status:             metav1.ConditionFalse,
+		Reason:             relocationv1alpha1.ReattachAllowedReason,
+		Message:            "the canaries for the changed shared inputs succeeded",
+		ObservedGeneration: config.Generation,
+	}
+	if hold != nil {
+		// the payload is rendered from all of its inputs at once so nothing else is rendered either
+		cond.Status = metav1.ConditionTrue
+		cond.Reason = hold.Reason
+		cond.Message = hold.Message + ", changes to the ClusterConfig and the inputs in its namespace are held until then too"
+	}
+	patch := client.MergeFrom(config.DeepCopy())
+	if !report.SetCondition(&config.Status.Conditions, cond) {
+		return nil
+	}
+	if hold != nil && hold.Reason == relocationv1alpha1.CanaryFailedReason {
+		r.Notifier.Warningf(config, hold.Reason, "%s", hold.Message)
+	}
+	return r.Status().Patch(ctx, config, patch)
+}
@@ -0,0 +1,305 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	cro "github.com/RHsyseng/cluster-relocation-operator/api/v1beta1"
+	bmh_v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+	"github.com/carbonin/cluster-relocation-service/internal/imageserver"
+)
+
+var _ = Describe("canary re-attach", func() {
+	var (
+		ctx    = context.Background()
+		c      client.Client
+		r      *ClusterConfigReconciler
+		shared = relocationv1alpha1.BuildSource{Kind: "Secret", Namespace: "shared", Name: "registry-ca"}
+	)
+
+	// createSite creates an attached config in its own namespace rendered with the given version of the shared secret
+	// whose last attempt is for the rendered payload if attached is set
+	createSite := func(name, version string, attached bool, outcome relocationv1alpha1.RelocationAttemptOutcome) *relocationv1alpha1.ClusterConfig {
+		config := &relocationv1alpha1.ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: name},
+			Spec: relocationv1alpha1.ClusterConfigSpec{
+				BareMetalHostRef: &relocationv1alpha1.BareMetalHostReference{Name: name, Namespace: "hosts"},
+			},
+		}
+		ExpectWithOffset(1, c.Create(ctx, config)).To(Succeed())
+		source := shared
+		source.ResourceVersion = version
+		hash := "payload-" + name + "-" + version
+		attemptHash := hash
+		if !attached {
+			attemptHash = "payload-" + name + "-old"
+		}
+		config.Status = relocationv1alpha1.ClusterConfigStatus{
+			Phase:       relocationv1alpha1.ClusterConfigPhaseImageAttached,
+			PayloadHash: hash,
+			BuildInfo: &relocationv1alpha1.BuildInfo{
+				PayloadHash: hash,
+				Sources: []relocationv1alpha1.BuildSource{
+					{Kind: "ClusterConfig", Namespace: name, Name: name, ResourceVersion: "1"},
+					source,
+				},
+			},
+			Attempts: []relocationv1alpha1.RelocationAttempt{{PayloadHash: attemptHash, StartTime: metav1.Now(), Outcome: outcome}},
+		}
+		ExpectWithOffset(1, c.Status().Update(ctx, config)).To(Succeed())
+		return config
+	}
+
+	// createFleet creates ten sites rendered with the first version of the shared secret and returns the canaries
+	createFleet := func() []relocationv1alpha1.ClusterConfig {
+		var fleet []relocationv1alpha1.ClusterConfig
+		for i := 0; i < 10; i++ {
+			fleet = append(fleet, *createSite(fmt.Sprintf("site-%d", i), "1", true, relocationv1alpha1.RelocationAttemptSucceeded))
+		}
+		return canaries(fleet, shared, r.Options.CanaryPercent)
+	}
+
+	// updateSite renders the second version of the shared secret for the config and attaches it if attached is set
+	updateSite := func(name string, attached bool, outcome relocationv1alpha1.RelocationAttemptOutcome) *relocationv1alpha1.ClusterConfig {
+		config := &relocationv1alpha1.ClusterConfig{}
+		ExpectWithOffset(1, c.Get(ctx, client.ObjectKey{Namespace: name, Name: name}, config)).To(Succeed())
+		ExpectWithOffset(1, c.Delete(ctx, config)).To(Succeed())
+		return createSite(name, "2", attached, outcome)
+	}
+
+	// nonCanary returns a site of the fleet which isn't one of the canaries
+	nonCanary := func(canaries []relocationv1alpha1.ClusterConfig) string {
+		for i := 0; i < 10; i++ {
+			name := fmt.Sprintf("site-%d", i)
+			if !containsConfig(canaries, &relocationv1alpha1.ClusterConfig{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: name}}) {
+				return name
+			}
+		}
+		Fail("every site is a canary")
+		return ""
+	}
+
+	BeforeEach(func() {
+		c = fakeclient.NewClientBuilder().
+			WithScheme(scheme.Scheme).
+			WithStatusSubresource(&relocationv1alpha1.ClusterConfig{}).
+			Build()
+		r = &ClusterConfigReconciler{
+			Client:  c,
+			Log:     logrus.New(),
+			Options: &ClusterConfigReconcilerOptions{CanaryPercent: 20},
+		}
+	})
+
+	It("picks a stable share of the fleet with at least one canary", func() {
+		selected := createFleet()
+		Expect(selected).To(HaveLen(2))
+		configs := &relocationv1alpha1.ClusterConfigList{}
+		Expect(c.List(ctx, configs)).To(Succeed())
+		Expect(canaries(configs.Items, shared, 20)).To(Equal(selected))
+		Expect(canaries(configs.Items[:3], shared, 1)).To(HaveLen(1))
+	})
+
+	It("attaches the change to canaries immediately", func() {
+		selected := createFleet()
+		config := updateSite(selected[0].Name, false, relocationv1alpha1.RelocationAttemptSucceeded)
+		Expect(r.checkRollouts(ctx, config, sharedSources(config))).To(BeNil())
+	})
+
+	It("holds other sites until every canary has attached the change and succeeded", func() {
+		selected := createFleet()
+		config := updateSite(nonCanary(selected), false, relocationv1alpha1.RelocationAttemptSucceeded)
+
+		hold, err := r.checkRollouts(ctx, config, sharedSources(config))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hold).NotTo(BeNil())
+		Expect(hold.Reason).To(Equal(relocationv1alpha1.CanariesInProgressReason))
+		Expect(hold.Message).To(ContainSubstring(selected[0].Name))
+
+		// attached but still in progress
+		updateSite(selected[0].Name, true, relocationv1alpha1.RelocationAttemptInProgress)
+		updateSite(selected[1].Name, true, relocationv1alpha1.RelocationAttemptSucceeded)
+		hold, err = r.checkRollouts(ctx, config, sharedSources(config))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hold).NotTo(BeNil())
+		Expect(hold.Message).NotTo(ContainSubstring(selected[1].Name))
+
+		updateSite(selected[0].Name, true, relocationv1alpha1.RelocationAttemptSucceeded)
+		Expect(r.checkRollouts(ctx, config, sharedSources(config))).To(BeNil())
+	})
+
+	It("pauses the rollout when a canary fails", func() {
+		selected := createFleet()
+		config := updateSite(nonCanary(selected), false, relocationv1alpha1.RelocationAttemptSucceeded)
+		updateSite(selected[0].Name, true, relocationv1alpha1.RelocationAttemptSucceeded)
+		failed := updateSite(selected[1].Name, true, relocationv1alpha1.RelocationAttemptInProgress)
+		meta.SetStatusCondition(&failed.Status.Conditions, metav1.Condition{
+			Type:   relocationv1alpha1.HostErrorCondition,
+			Status: metav1.ConditionTrue,
+			Reason: relocationv1alpha1.HostErrorReportedReason,
+		})
+		Expect(c.Status().Update(ctx, failed)).To(Succeed())
+
+		hold, err := r.checkRollouts(ctx, config, sharedSources(config))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hold).NotTo(BeNil())
+		Expect(hold.Reason).To(Equal(relocationv1alpha1.CanaryFailedReason))
+		Expect(hold.Message).To(ContainSubstring(selected[1].Name))
+	})
+
+	It("doesn't hold changes without canaries or shared inputs", func() {
+		selected := createFleet()
+		config := updateSite(nonCanary(selected), false, relocationv1alpha1.RelocationAttemptSucceeded)
+
+		r.Options.CanaryPercent = 0
+		Expect(r.checkRollouts(ctx, config, sharedSources(config))).To(BeNil())
+
+		// inputs in the namespace of the config only affect it
+		r.Options.CanaryPercent = 20
+		config.Status.BuildInfo.Sources[1].Namespace = config.Namespace
+		Expect(r.checkRollouts(ctx, config, sharedSources(config))).To(BeNil())
+	})
+
+	It("only sets the ReattachHeld condition once a change has been held", func() {
+		config := createSite("site-0", "1", true, relocationv1alpha1.RelocationAttemptSucceeded)
+		Expect(r.setReattachHeld(ctx, config, nil)).To(Succeed())
+		Expect(config.Status.Conditions).To(BeEmpty())
+
+		hold := &canaryHold{Reason: relocationv1alpha1.CanariesInProgressReason, Message: "waiting"}
+		Expect(r.setReattachHeld(ctx, config, hold)).To(Succeed())
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(config), config)).To(Succeed())
+		cond := meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.ReattachHeldCondition)
+		Expect(cond).NotTo(BeNil())
+		Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+		Expect(cond.Reason).To(Equal(relocationv1alpha1.CanariesInProgressReason))
+		Expect(cond.Message).To(HavePrefix("waiting"))
+		Expect(cond.Message).To(ContainSubstring("changes to the ClusterConfig"))
+
+		Expect(r.setReattachHeld(ctx, config, nil)).To(Succeed())
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(config), config)).To(Succeed())
+		cond = meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.ReattachHeldCondition)
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Reason).To(Equal(relocationv1alpha1.ReattachAllowedReason))
+	})
+
+	Context("reconciling", func() {
+		var dataDir string
+
+		BeforeEach(func() {
+			c = fakeclient.NewClientBuilder().
+				WithScheme(scheme.Scheme).
+				WithStatusSubresource(&relocationv1alpha1.ClusterConfig{}).
+				WithIndex(&relocationv1alpha1.ClusterConfig{}, bmhRefIndex, bmhRefIndexValue).
+				Build()
+			var err error
+			dataDir, err = os.MkdirTemp("", "canary_test_data")
+			Expect(err).NotTo(HaveOccurred())
+			r = &ClusterConfigReconciler{
+				Client:  c,
+				Scheme:  scheme.Scheme,
+				Log:     logrus.New(),
+				BaseURL: "https://service.namespace",
+				Options: &ClusterConfigReconcilerOptions{DataDir: dataDir, CanaryPercent: 50},
+			}
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(dataDir)).To(Succeed())
+		})
+
+		reconcile := func(name string) *relocationv1alpha1.ClusterConfig {
+			key := client.ObjectKey{Namespace: name, Name: name}
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			ExpectWithOffset(1, err).NotTo(HaveOccurred())
+			config := &relocationv1alpha1.ClusterConfig{}
+			ExpectWithOffset(1, c.Get(ctx, key, config)).To(Succeed())
+			return config
+		}
+
+		// downloadImage returns the image the image server serves for the config
+		downloadImage := func(name string) []byte {
+			h := &imageserver.Handler{
+				Log:         logrus.New(),
+				WorkDir:     dataDir,
+				ConfigsDir:  filepath.Join(dataDir, "namespaces"),
+				LockTimeout: time.Second,
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/images/%s/%s.iso", name, name), nil))
+			ExpectWithOffset(1, rec.Code).To(Equal(http.StatusOK))
+			return rec.Body.Bytes()
+		}
+
+		It("keeps serving the last rendered payload to held sites", func() {
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "pull-secret", Namespace: "shared"},
+				Data:       map[string][]byte{".dockerconfigjson": []byte(`{"auths":{"old":{}}}`)},
+			}
+			Expect(c.Create(ctx, secret)).To(Succeed())
+			var sites []relocationv1alpha1.ClusterConfig
+			for _, name := range []string{"site-0", "site-1"} {
+				Expect(c.Create(ctx, &bmh_v1alpha1.BareMetalHost{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "hosts"}})).To(Succeed())
+				Expect(c.Create(ctx, &relocationv1alpha1.ClusterConfig{
+					ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: name},
+					Spec: relocationv1alpha1.ClusterConfigSpec{
+						ClusterRelocationSpec: cro.ClusterRelocationSpec{
+							Domain:        name + ".example.com",
+							PullSecretRef: &corev1.SecretReference{Name: "pull-secret", Namespace: "shared"},
+						},
+						BareMetalHostRef: &relocationv1alpha1.BareMetalHostReference{Name: name, Namespace: "hosts"},
+					},
+				})).To(Succeed())
+				sites = append(sites, *reconcile(name))
+				Expect(sites[len(sites)-1].Status.Attempts).To(HaveLen(1))
+			}
+			selected := canaries(sites, relocationv1alpha1.BuildSource{Kind: "Secret", Namespace: "shared", Name: "pull-secret"}, 50)
+			Expect(selected).To(HaveLen(1))
+			canary := selected[0].Name
+			held := sites[0].Name
+			if held == canary {
+				held = sites[1].Name
+			}
+
+			secret.Data[".dockerconfigjson"] = []byte(`{"auths":{"new":{}}}`)
+			Expect(c.Update(ctx, secret)).To(Succeed())
+			oldContent := []byte(base64.StdEncoding.EncodeToString([]byte(`{"auths":{"old":{}}}`)))
+			newContent := []byte(base64.StdEncoding.EncodeToString(secret.Data[".dockerconfigjson"]))
+
+			config := reconcile(held)
+			Expect(meta.IsStatusConditionTrue(config.Status.Conditions, relocationv1alpha1.ReattachHeldCondition)).To(BeTrue())
+			image := downloadImage(held)
+			Expect(bytes.Contains(image, oldContent)).To(BeTrue())
+			Expect(bytes.Contains(image, newContent)).To(BeFalse())
+
+			// the canary renders and attaches the change right away
+			config = reconcile(canary)
+			Expect(bytes.Contains(downloadImage(canary), newContent)).To(BeTrue())
+			Expect(config.Status.Attempts).To(HaveLen(2))
+			config.Status.Attempts[1].Outcome = relocationv1alpha1.RelocationAttemptSucceeded
+			Expect(c.Status().Update(ctx, config)).To(Succeed())
+
+			config = reconcile(held)
+			Expect(meta.IsStatusConditionFalse(config.Status.Conditions, relocationv1alpha1.ReattachHeldCondition)).To(BeTrue())
+			Expect(bytes.Contains(downloadImage(held), newContent)).To(BeTrue())
+		})
+	})
+})
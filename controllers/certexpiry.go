@@ -0,0 +1,156 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+	"github.com/carbonin/cluster-relocation-service/internal/report"
+)
+
+// certRecheckInterval is how often certificates in the renewal window are checked again
+// The cert secrets are not watched so renewed certificates are only noticed on the next reconcile
+const certRecheckInterval = 10 * time.Minute
+
+// checkCertificates records when the API and ingress certificates expire and checks them against the renewal window
+// It returns false if the image must not be attached, and otherwise how long until a certificate enters the window
+// or zero if none will
+func (r *ClusterConfigReconciler) checkCertificates(ctx context.Context, config *relocationv1alpha1.ClusterConfig) (bool, time.Duration, error) {
+	window := config.Spec.CertRenewalWindow
+	if config.Spec.ExternalImageURL != "" || meta.IsStatusConditionTrue(config.Status.Conditions, relocationv1alpha1.RelocationCompletedCondition) {
+		// the certificates aren't in external images and don't matter once the host is relocated
+		window = nil
+	}
+
+	patch := client.MergeFrom(config.DeepCopy())
+	changed := false
+	certs := []struct {
+		name   string
+		ref    *corev1.SecretReference
+		expiry **metav1.Time
+	}{
+		{"API", config.Spec.APICertRef, &config.Status.APICertExpiry},
+		{"ingress", config.Spec.IngressCertRef, &config.Status.IngressCertExpiry},
+	}
+
+	now := time.Now()
+	var renewIn time.Duration
+	var problems []string
+	reason := relocationv1alpha1.CertificateExpiringReason
+	for _, c := range certs {
+		var expiry *metav1.Time
+		var parseErr error
+		if c.ref != nil {
+			s := &corev1.Secret{}
+			if err := r.Get(ctx, types.NamespacedName{Name: c.ref.Name, Namespace: c.ref.Namespace}, s); err != nil {
+				return false, 0, err
+			}
+			notAfter, err := parseCertExpiry(s.Data[corev1.TLSCertKey])
+			if err != nil {
+				parseErr = err
+			} else {
+				t := metav1.NewTime(notAfter)
+				expiry = &t
+			}
+		}
+		if !(*c.expiry).Equal(expiry) {
+			*c.expiry = expiry
+			changed = true
+		}
+
+		if window == nil || c.ref == nil {
+			continue
+		}
+		if parseErr != nil {
+			reason = relocationv1alpha1.CertificateInvalidReason
+			problems = append(problems, fmt.Sprintf("the %s certificate can't be parsed: %s", c.name, parseErr))
+			continue
+		}
+		renewAt := expiry.Add(-window.Duration)
+		if !now.Before(renewAt) {
+			problems = append(problems, fmt.Sprintf("the %s certificate expires at %s which is within the renewal window of %s",
+				c.name, expiry.UTC().Format(time.RFC3339), window.Duration))
+			continue
+		}
+		if d := renewAt.Sub(now); renewIn == 0 || d < renewIn {
+			renewIn = d
+		}
+	}
+
+	if window != nil {
+		cond := metav1.Condition{
+			Type:               relocationv1alpha1.CertificatesValidCondition,
+			Status:             metav1.ConditionTrue,
+			Reason:             relocationv1alpha1.CertificatesValidReason,
+			Message:            fmt.Sprintf("the certificates don't expire within the renewal window of %s", window.Duration),
+			ObservedGeneration: config.Generation,
+		}
+		if len(problems) > 0 {
+			cond.Status = metav1.ConditionFalse
+			cond.Reason = reason
+			cond.Message = strings.Join(problems, ", ")
+		}
+		if report.SetCondition(&config.Status.Conditions, cond) {
+			changed = true
+		}
+	} else if meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.CertificatesValidCondition) != nil {
+		meta.RemoveStatusCondition(&config.Status.Conditions, relocationv1alpha1.CertificatesValidCondition)
+		changed = true
+	}
+
+	if changed {
+		if err := r.Status().Patch(ctx, config, patch); err != nil {
+			return false, 0, err
+		}
+	}
+	if len(problems) > 0 {
+		return false, 0, nil
+	}
+	return true, renewIn, nil
+}
+
+// parseCertExpiry returns when the first certificate in the PEM encoded data expires
+// This is the serving certificate, any following certificates are the chain
+func parseCertExpiry(data []byte) (time.Time, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return time.Time{}, fmt.Errorf("no certificate found in %s", corev1.TLSCertKey)
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return cert.NotAfter, nil
+	}
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/carbonin/cluster-relocation-service/internal/dedup"
+	"github.com/carbonin/cluster-relocation-service/internal/filelock"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// removeConfigData removes the data directory for a config and the containing namespace directory if it is left empty
+// It returns a bool indicating whether the lock on the config directory was acquired
+func removeConfigData(ctx context.Context, fsys FileSystem, configDir string, lease *filelock.Lease) (bool, error) {
+	if _, err := fsys.Stat(configDir); err != nil {
+		if !os.IsNotExist(err) {
+			return false, err
+		}
+	} else {
+		locked, err := filelock.WithFencedWriteLockContext(ctx, configDir, lease, func() error {
+			return fsys.RemoveAll(configDir)
+		})
+		if err != nil || !locked {
+			return locked, err
+		}
+	}
+
+	return true, removeIfEmpty(fsys, filepath.Dir(configDir))
+}
+
+// removeIfEmpty removes dir if it exists and contains no entries
+func removeIfEmpty(fsys FileSystem, dir string) error {
+	entries, err := fsys.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if len(entries) != 0 {
+		return nil
+	}
+
+	// something may have been created in the meantime, that's fine as we only want to remove empty dirs
+	if err := fsys.Remove(dir); err != nil && !os.IsNotExist(err) && !errors.Is(err, syscall.ENOTEMPTY) && !errors.Is(err, syscall.EEXIST) {
+		return err
+	}
+	return nil
+}
+
+// DataDirSweeper periodically removes empty namespace directories from the data directory
+// and shared files which are no longer used by any config
+type DataDirSweeper struct {
+	Log      logrus.FieldLogger
+	DataDir  string
+	Interval time.Duration
+	Blobs    *dedup.Store
+}
+
+// Start runs the sweep every Interval until the context is cancelled
+func (s *DataDirSweeper) Start(ctx context.Context) error {
+	wait.UntilWithContext(ctx, s.sweep, s.Interval)
+	return nil
+}
+
+func (s *DataDirSweeper) sweep(_ context.Context) {
+	if s.Blobs != nil {
+		if removed, err := s.Blobs.Prune(); err != nil {
+			s.Log.WithError(err).Error("failed to prune shared files")
+		} else if removed > 0 {
+			s.Log.Infof("pruned %d unused shared files", removed)
+		}
+	}
+
+	namespacesDir := filepath.Join(s.DataDir, "namespaces")
+	entries, err := os.ReadDir(namespacesDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			s.Log.WithError(err).Error("failed to read namespaces dir")
+		}
+		return
+	}
+
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		if err := removeIfEmpty(osFileSystem{}, filepath.Join(namespacesDir, e.Name())); err != nil {
+			s.Log.WithError(err).Errorf("failed to remove empty namespace dir %s", e.Name())
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/carbonin/cluster-relocation-service/internal/dedup"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+)
+
+var _ = Describe("removeConfigData", func() {
+	var dataDir string
+
+	BeforeEach(func() {
+		var err error
+		dataDir, err = os.MkdirTemp("", "cleanup_test_data")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dataDir)).To(Succeed())
+	})
+
+	It("removes the namespace dir when it is left empty", func() {
+		configDir := filepath.Join(dataDir, "namespaces", "ns", "config")
+		Expect(os.MkdirAll(filepath.Join(configDir, "files"), 0700)).To(Succeed())
+
+		locked, err := removeConfigData(context.Background(), osFileSystem{}, configDir, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(locked).To(BeTrue())
+		Expect(filepath.Join(dataDir, "namespaces", "ns")).NotTo(BeADirectory())
+	})
+
+	It("keeps the namespace dir when other configs exist", func() {
+		configDir := filepath.Join(dataDir, "namespaces", "ns", "config")
+		otherDir := filepath.Join(dataDir, "namespaces", "ns", "other")
+		Expect(os.MkdirAll(filepath.Join(configDir, "files"), 0700)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(otherDir, "files"), 0700)).To(Succeed())
+
+		locked, err := removeConfigData(context.Background(), osFileSystem{}, configDir, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(locked).To(BeTrue())
+		Expect(configDir).NotTo(BeADirectory())
+		Expect(otherDir).To(BeADirectory())
+	})
+
+	It("succeeds when the config dir does not exist", func() {
+		locked, err := removeConfigData(context.Background(), osFileSystem{}, filepath.Join(dataDir, "namespaces", "ns", "config"), nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(locked).To(BeTrue())
+	})
+})
+
+var _ = Describe("DataDirSweeper", func() {
+	var dataDir string
+
+	BeforeEach(func() {
+		var err error
+		dataDir, err = os.MkdirTemp("", "cleanup_test_data")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dataDir)).To(Succeed())
+	})
+
+	It("removes only empty namespace dirs", func() {
+		emptyDir := filepath.Join(dataDir, "namespaces", "empty")
+		usedDir := filepath.Join(dataDir, "namespaces", "used")
+		Expect(os.MkdirAll(emptyDir, 0700)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(usedDir, "config"), 0700)).To(Succeed())
+
+		s := &DataDirSweeper{Log: logrus.New(), DataDir: dataDir}
+		s.sweep(context.Background())
+
+		Expect(emptyDir).NotTo(BeADirectory())
+		Expect(usedDir).To(BeADirectory())
+	})
+
+	It("prunes unused shared files", func() {
+		blobs := &dedup.Store{Dir: filepath.Join(dataDir, "blobs")}
+		filesDir := filepath.Join(dataDir, "namespaces", "used", "config", "files")
+		Expect(os.MkdirAll(filesDir, 0700)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(filesDir, "used.json"), []byte("used"), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(filesDir, "unused.json"), []byte("unused"), 0644)).To(Succeed())
+		Expect(blobs.LinkDir(filesDir)).To(Succeed())
+		Expect(os.Remove(filepath.Join(filesDir, "unused.json"))).To(Succeed())
+
+		s := &DataDirSweeper{Log: logrus.New(), DataDir: dataDir, Blobs: blobs}
+		s.sweep(context.Background())
+
+		entries, err := os.ReadDir(blobs.Dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+	})
+
+	It("tolerates a missing namespaces dir", func() {
+		s := &DataDirSweeper{Log: logrus.New(), DataDir: dataDir}
+		s.sweep(context.Background())
+	})
+})
@@ -19,27 +19,42 @@ package controllers
 import (
 	"context"
 	"encoding/json"
+	goerrors "errors"
 	"fmt"
 	"net/url"
-	"os"
 	"path/filepath"
 	"time"
 
+	cro "github.com/RHsyseng/cluster-relocation-operator/api/v1beta1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
-	cro "github.com/RHsyseng/cluster-relocation-operator/api/v1beta1"
+	"github.com/carbonin/cluster-relocation-service/api/isoschema"
 	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+	"github.com/carbonin/cluster-relocation-service/internal/datadir"
+	"github.com/carbonin/cluster-relocation-service/internal/dedup"
 	"github.com/carbonin/cluster-relocation-service/internal/filelock"
+	"github.com/carbonin/cluster-relocation-service/internal/httpclient"
+	"github.com/carbonin/cluster-relocation-service/internal/imageserver"
+	"github.com/carbonin/cluster-relocation-service/internal/metrics"
+	"github.com/carbonin/cluster-relocation-service/internal/ratelimit"
+	"github.com/carbonin/cluster-relocation-service/internal/report"
+	"github.com/carbonin/cluster-relocation-service/internal/tracing"
+	"github.com/carbonin/cluster-relocation-service/internal/txfs"
 	bmh_v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type ClusterConfigReconcilerOptions struct {
@@ -47,70 +62,783 @@ type ClusterConfigReconcilerOptions struct {
 	ServiceNamespace string `envconfig:"SERVICE_NAMESPACE"`
 	ServicePort      string `envconfig:"SERVICE_PORT"`
 	ServiceScheme    string `envconfig:"SERVICE_SCHEME"`
-	DataDir          string `envconfig:"DATA_DIR" default:"/data"`
+	// ImageBasicAuth adds the basic auth credentials of the config namespace to the image URL set on the
+	// BareMetalHost, it must be set when the image server requires them
+	ImageBasicAuth bool   `envconfig:"IMAGE_BASIC_AUTH" default:"false"`
+	DataDir        string `envconfig:"DATA_DIR" default:"/data"`
+	// DataDirShards is a comma separated list of directories, usually separate volumes, which hold the
+	// configs instead of DataDir. Namespaces are assigned to a shard by hash so the list must not change
+	// once configs have been written
+	DataDirShards   []string      `envconfig:"DATA_DIR_SHARDS"`
+	CleanupInterval time.Duration `envconfig:"CLEANUP_INTERVAL" default:"1h"`
+	// AuditInterval is how often ClusterConfigs are cross-checked against the data directory and BareMetalHosts,
+	// zero disables the audit
+	AuditInterval time.Duration `envconfig:"AUDIT_INTERVAL" default:"24h"`
+	// MetricsMaxClusterConfigs limits the number of ClusterConfigs with per-config metric samples
+	MetricsMaxClusterConfigs int `envconfig:"METRICS_MAX_CLUSTER_CONFIGS" default:"10000"`
+	// MaxClusterConfigsPerNamespace limits the number of ClusterConfigs admitted in a single namespace, zero means no limit
+	MaxClusterConfigsPerNamespace int `envconfig:"MAX_CLUSTER_CONFIGS_PER_NAMESPACE" default:"0"`
+	// MaxPayloadSize is the largest image in bytes that will be served for a rendered payload, zero means no limit
+	// Some BMC virtual media implementations fail to mount images beyond a few GB
+	MaxPayloadSize int64 `envconfig:"MAX_PAYLOAD_SIZE" default:"0"`
+	// ReadOnly stops all writes to the data directory so it can be migrated while images are still served
+	ReadOnly bool `envconfig:"READ_ONLY" default:"false"`
+	// BMHPatchQPS limits the rate of BareMetalHost patches across all ClusterConfigs, zero means no limit
+	BMHPatchQPS float64 `envconfig:"BMH_PATCH_QPS" default:"10"`
+	// BMHPatchBurst is the number of BareMetalHost patches allowed at once before BMHPatchQPS applies
+	BMHPatchBurst int `envconfig:"BMH_PATCH_BURST" default:"50"`
+	// BMHOwnerAnnotation sets the ClusterConfigAnnotation on the BareMetalHosts images are attached to
+	// Hosts are often in another namespace so an owner reference can't be used
+	BMHOwnerAnnotation bool `envconfig:"BMH_OWNER_ANNOTATION" default:"false"`
+	// ConsoleAnnotations sets the progress annotations and phase label read by console integrations on ClusterConfigs
+	ConsoleAnnotations bool `envconfig:"CONSOLE_ANNOTATIONS" default:"false"`
+	// ConsoleLogsURL is a link to the logs of a relocation set in the ConsoleLogsURLAnnotation, {namespace} and
+	// {name} are replaced with those of the ClusterConfig. The annotation isn't set if it is empty
+	ConsoleLogsURL string `envconfig:"CONSOLE_LOGS_URL"`
+	// ZoneServiceURLs is a comma separated list of zone=url pairs giving the URL the image service is reachable at
+	// from each network zone. ClusterConfigs with the ZoneLabel use the URL of their zone instead of the service URL
+	ZoneServiceURLs ZoneURLs `envconfig:"ZONE_SERVICE_URLS"`
+	// TenantDomain serves the images of each namespace from <namespace>.<TenantDomain> using SERVICE_SCHEME so
+	// tenants download from separate hostnames. It must match the TENANT_DOMAIN of the image server
+	TenantDomain string `envconfig:"TENANT_DOMAIN"`
+	// RenderPluginsDir holds executables run in name order once the payload is rendered, usually ConfigMap keys
+	// mounted with an executable mode. Each is passed a copy of the payload directory and may add or change files
+	RenderPluginsDir string `envconfig:"RENDER_PLUGINS_DIR"`
+	// RenderPluginTimeout bounds the run time of each render plugin, zero means no limit
+	RenderPluginTimeout time.Duration `envconfig:"RENDER_PLUGIN_TIMEOUT" default:"1m"`
+	// NotifyWindow is how long a repeated problem isn't logged or recorded as an event again, zero reports every time
+	NotifyWindow time.Duration `envconfig:"NOTIFY_WINDOW" default:"10m"`
+	// LockTimeout is how long to wait for the image server to release a config directory before requeueing
+	LockTimeout time.Duration `envconfig:"LOCK_TIMEOUT" default:"10s"`
+	// DeletionConcurrency is the number of deleted ClusterConfigs cleaned up at once by the deletion queue,
+	// zero cleans them up in the reconcile loop
+	DeletionConcurrency int `envconfig:"DELETION_CONCURRENCY" default:"2"`
+	// PrestageConcurrency is the number of images uploaded to zone caches at once by the prestage queue,
+	// zero uploads them in the reconcile loop
+	PrestageConcurrency int `envconfig:"PRESTAGE_CONCURRENCY" default:"2"`
+	// ManageEndpoint creates the image Service in SERVICE_NAMESPACE at startup instead of relying on the install
+	// manifests, along with a Route if EndpointRoute is set and a NetworkPolicy if any ingress is restricted
+	ManageEndpoint bool `envconfig:"MANAGE_ENDPOINT" default:"false"`
+	// EndpointRoute exposes the image Service with a reencrypt Route, hosts are then given the Route URL
+	EndpointRoute bool `envconfig:"ENDPOINT_ROUTE" default:"false"`
+	// EndpointRouteHost is the host of the Route, OpenShift generates one if it is empty
+	EndpointRouteHost string `envconfig:"ENDPOINT_ROUTE_HOST"`
+	// EndpointAllowedCIDRs is a comma separated list of networks, usually those of Ironic and the BMCs, allowed
+	// to reach the image server. Other traffic is refused by a NetworkPolicy, no policy is created if it is empty
+	// and EndpointRoute isn't set
+	EndpointAllowedCIDRs []string `envconfig:"ENDPOINT_ALLOWED_CIDRS"`
+	// ImageCAFile is a PEM bundle of the CA certificates the image server certificate is issued by, they are added
+	// to the bundle Ironic trusts so image downloads pass TLS verification. Nothing is published if it is empty
+	ImageCAFile string `envconfig:"IMAGE_CA_FILE"`
+	// ImageCAConfigMap is the <namespace>/<name> of the ConfigMap with a ca-bundle.crt key Ironic trusts which
+	// ImageCAFile is added to. If it is empty the ConfigMap the cluster Proxy trustedCA refers to is used
+	ImageCAConfigMap string `envconfig:"IMAGE_CA_CONFIGMAP"`
+	// ZoneCacheURLs is a comma separated list of zone=url pairs giving an HTTP cache near each network zone, such as
+	// a WebDAV server or S3 bucket accepting PUT. Images of ClusterConfigs with the ZoneLabel are uploaded to the
+	// cache of their zone and hosts download them from there. Credentials in the URL are only used for uploads
+	ZoneCacheURLs ZoneURLs `envconfig:"ZONE_CACHE_URLS"`
+	// CacheUploadTimeout bounds each upload to a zone cache, zero means no limit
+	CacheUploadTimeout time.Duration `envconfig:"CACHE_UPLOAD_TIMEOUT" default:"10m"`
+	// ISOStreaming uploads images to zone caches as they are generated instead of building them in the data dir first
+	ISOStreaming bool `envconfig:"ISO_STREAMING" default:"false"`
+	// ConsoleLogSourceURL is fetched for the console output of hosts booting the image, such as a console gathering
+	// service or a Redfish serial log. {namespace} and {name} are replaced with those of the BareMetalHost and {bmc}
+	// with the host of its BMC address, in which case the BMC credentials are sent. Output isn't captured if it is empty
+	ConsoleLogSourceURL string `envconfig:"CONSOLE_LOG_SOURCE_URL"`
+	// ConsoleLogInterval is how often console output is captured while an attempt is in progress
+	ConsoleLogInterval time.Duration `envconfig:"CONSOLE_LOG_INTERVAL" default:"1m"`
+	// ConsoleLogMaxSize is the number of bytes at the end of the console output kept for each attempt
+	ConsoleLogMaxSize int64 `envconfig:"CONSOLE_LOG_MAX_SIZE" default:"65536"`
+	// ResyncPeriod is how often each ClusterConfig is reconciled without any change so the BareMetalHost image and the
+	// rendered payload are put back if they were changed outside the manager, zero disables it
+	ResyncPeriod time.Duration `envconfig:"RESYNC_PERIOD" default:"1h"`
+	// CanaryPercent is the percentage of the ClusterConfigs sharing an input from another namespace which are
+	// re-attached first when it changes, the others wait until these succeed. Zero re-attaches all of them at once
+	CanaryPercent int `envconfig:"CANARY_PERCENT" default:"0"`
+	// DNSRecords creates an external-dns DNSEndpoint for each ClusterConfig with a domain and virtual IPs so the
+	// api and *.apps names of the relocated cluster resolve from the hub once the relocation has completed
+	DNSRecords bool `envconfig:"DNS_RECORDS" default:"false"`
 }
 
+const clusterConfigFinalizerName = "relocation.openshift.io/clusterconfig-finalizer"
+
+// multipleClusterConfigsReason is the event reason for a BareMetalHost referenced by more than one ClusterConfig
+const multipleClusterConfigsReason = "MultipleClusterConfigs"
+
+// payloadVersionLength is the number of payload hash characters used to version image URLs
+const payloadVersionLength = 16
+
+// payloadTxDir is the directory in a config dir holding payload changes until they are applied together
+const payloadTxDir = ".payload-tx"
+
+// provisioningRecheckInterval is how often an unreachable image service is checked again
+const provisioningRecheckInterval = 5 * time.Minute
+
 // ClusterConfigReconciler reconciles a ClusterConfig object
 type ClusterConfigReconciler struct {
 	client.Client
 	Log     logrus.FieldLogger
 	Scheme  *runtime.Scheme
 	Options *ClusterConfigReconcilerOptions
+	// BaseURL is the URL hosts reach the image service at, the service URL from Options is used if it is empty
+	// It is set before the manager starts and must not be changed once reconciles may run
 	BaseURL string
+	// FS creates and removes the config directories in the data dir, nil uses the os package
+	// The files written inside them don't go through it
+	FS FileSystem
+	// HTTPClients creates clients for outbound requests honoring the cluster proxy configuration
+	HTTPClients *httpclient.Factory
+	// Lease fences writes to the data dir so an instance that has been superseded stops writing
+	Lease *filelock.Lease
+	// Metrics records per-ClusterConfig phase samples
+	Metrics *metrics.ClusterConfigCollector
+	// Blobs shares identical rendered files between configs in DataDir, nil disables sharing
+	// Configs in DataDirShards share files through a store in their shard as links can't cross volumes
+	Blobs *dedup.Store
+	// BMHPatches limits the rate of BareMetalHost patches, nil disables the limit
+	BMHPatches *ratelimit.KeyedLimiter
+	// APIReader reads BareMetalHosts which aren't cached as they haven't been labeled yet, nil if all hosts are cached
+	APIReader client.Reader
+	// Notifier logs and records events for problems found in ClusterConfigs, nil disables both
+	Notifier *report.Notifier
+	// Deletions cleans up deleted ClusterConfigs with bounded concurrency, nil cleans them up in Reconcile
+	Deletions *DeletionQueue
+	// Prestages uploads images to zone caches with bounded concurrency, nil uploads them in Reconcile
+	Prestages *PrestageQueue
+	// Builds records the images built for zone caches, it is shared between reconciles so each payload is only
+	// recorded once. nil doesn't record them
+	Builds *imageserver.BuildRecorder
 }
 
 //+kubebuilder:rbac:groups=relocation.openshift.io,resources=clusterconfigs,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=relocation.openshift.io,resources=clusterconfigs/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=relocation.openshift.io,resources=clusterconfigs/finalizers,verbs=update
 //+kubebuilder:rbac:groups=metal3.io,resources=baremetalhosts,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=config.openshift.io,resources=proxies,verbs=get
+//+kubebuilder:rbac:groups="",resources=configmaps,resourceNames=trusted-ca-bundle,verbs=get
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get
+
+func (r *ClusterConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request) (res ctrl.Result, err error) {
+	ctx, span := tracing.Start(ctx, "Reconcile", tracing.ClusterConfigAttributes(req.Namespace, req.Name)...)
+	defer func() { tracing.End(span, err) }()
 
-func (r *ClusterConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := r.Log.WithFields(logrus.Fields{"name": req.Name, "namespace": req.Namespace})
 	log.Info("Running reconcile ...")
 	defer log.Info("Reconcile complete")
 
 	config := &relocationv1alpha1.ClusterConfig{}
 	if err := r.Get(ctx, req.NamespacedName, config); err != nil {
+		if errors.IsNotFound(err) {
+			r.Metrics.Delete(req.NamespacedName)
+			return ctrl.Result{}, nil
+		}
 		log.WithError(err).Error("failed to get referenced cluster config")
 		return ctrl.Result{}, err
 	}
 
-	requeue, err := r.writeInputData(ctx, config)
+	// everything after this point may write to the data dir, configs are reconciled again on restart
+	if r.Options.ReadOnly {
+		log.Info("data directory is read-only, skipping reconcile")
+		return ctrl.Result{}, nil
+	}
+
+	if !config.DeletionTimestamp.IsZero() {
+		return r.handleDeletion(ctx, log, config)
+	}
+
+	// reconcile again after the resync period to correct drift nothing is watched for, and by requeueIn for
+	// the work deferred below, however this reconcile ends. failed reconciles are already retried with a backoff
+	var requeueIn time.Duration
+	defer func() {
+		if err == nil && !res.Requeue {
+			res.RequeueAfter = shortestRequeue(shortestRequeue(res.RequeueAfter, requeueIn), r.Options.ResyncPeriod)
+		}
+	}()
+
+	if controllerutil.AddFinalizer(config, clusterConfigFinalizerName) {
+		if err := r.Update(ctx, config); err != nil {
+			log.WithError(err).Error("failed to add finalizer")
+			return ctrl.Result{}, err
+		}
+	}
+
+	if meta.IsStatusConditionTrue(config.Status.Conditions, relocationv1alpha1.RelocationCompletedCondition) {
+		if err := r.setPhase(ctx, config, relocationv1alpha1.ClusterConfigPhaseCompleted); err != nil {
+			log.WithError(err).Error("failed to set phase")
+			return ctrl.Result{}, err
+		}
+		if err := r.completeAttempt(ctx, config); err != nil {
+			log.WithError(err).Error("failed to record completed attempt")
+			return ctrl.Result{}, err
+		}
+		if err := r.runCompletionHooks(ctx, log, config); err != nil {
+			log.WithError(err).Error("failed to run completion hooks")
+			return ctrl.Result{}, err
+		}
+		if err := r.syncDNSRecords(ctx, config); err != nil {
+			log.WithError(err).Error("failed to sync DNS records")
+			return ctrl.Result{}, err
+		}
+		if config.Spec.CleanupPolicy != "" && config.Spec.CleanupPolicy != relocationv1alpha1.CleanupPolicyNone {
+			return r.handleCompletion(ctx, log, config)
+		}
+	} else if config.Status.Phase == "" {
+		if err := r.setPhase(ctx, config, relocationv1alpha1.ClusterConfigPhasePending); err != nil {
+			log.WithError(err).Error("failed to set phase")
+			return ctrl.Result{}, err
+		}
+	}
+
+	if _, abort := config.Annotations[relocationv1alpha1.AbortAnnotation]; abort && config.Status.Phase != relocationv1alpha1.ClusterConfigPhaseCompleted {
+		log.Info("relocation aborted, detaching image")
+		return r.handleAbort(ctx, log, config)
+	}
+	if err := r.clearAbort(ctx, config); err != nil {
+		log.WithError(err).Error("failed to clear aborted condition")
+		return ctrl.Result{}, err
+	}
+
+	// deferred changes are rendered once the rebuild interval passes
+	rebuildIn := rebuildWait(config, time.Now())
+	requeueIn = rebuildIn
+	if err := r.setRebuildThrottled(ctx, config, rebuildIn); err != nil {
+		log.WithError(err).Error("failed to set rebuild throttled condition")
+		return ctrl.Result{}, err
+	}
+
+	if err := r.recordHostHardware(ctx, config); err != nil {
+		log.WithError(err).Error("failed to record host hardware")
+		return ctrl.Result{}, err
+	}
+
+	if err := r.setClusterURLs(ctx, config); err != nil {
+		log.WithError(err).Error("failed to set cluster URLs")
+		return ctrl.Result{}, err
+	}
+
+	hold, err := r.checkCanaries(ctx, config)
 	if err != nil {
-		log.WithError(err).Error("failed to write input data")
+		log.WithError(err).Error("failed to check canaries")
 		return ctrl.Result{}, err
 	}
+	if err := r.setReattachHeld(ctx, config, hold); err != nil {
+		log.WithError(err).Error("failed to set reattach held condition")
+		return ctrl.Result{}, err
+	}
+	if hold != nil {
+		// other ClusterConfigs aren't watched so the canaries of held changes are checked again
+		requeueIn = shortestRequeue(requeueIn, canaryRecheckInterval)
+	}
+
+	writePayload := r.writeInputData
+	if config.Spec.ExternalImageURL != "" {
+		// the image is built elsewhere so only the host and status are managed
+		writePayload = r.useExternalImage
+	} else if config.Spec.AdoptExistingData {
+		// the payload was rendered elsewhere and copied into the data dir so it is only verified
+		writePayload = r.adoptExistingData
+	} else if rebuildIn > 0 {
+		// changes made until the interval passes are rendered together so the image is only rebuilt once
+		log.Infof("payload changed recently, deferring rendering for %s", rebuildIn)
+		writePayload = r.keepPayload
+	} else if hold != nil {
+		// the files the image is served from are only rendered once the canaries succeed with the change
+		log.Infof("not rendering the changed shared inputs: %s", hold.Message)
+		writePayload = r.keepRenderedPayload
+	}
+	payloadHash, diff, requeue, err := writePayload(ctx, config)
 	if requeue {
-		log.Info("requeueing due to lock contention")
-		return ctrl.Result{RequeueAfter: time.Second * 5}, nil
+		log.Info("timed out waiting for config dir lock, requeueing")
+		return ctrl.Result{Requeue: true}, nil
+	}
+	if condErr := r.setReconciled(ctx, config, err); condErr != nil {
+		log.WithError(condErr).Error("failed to set reconciled condition")
+		return ctrl.Result{}, condErr
+	}
+	var sizeErr *payloadSizeError
+	if goerrors.As(err, &sizeErr) {
+		// this won't succeed until the config changes so don't retry
+		log.WithError(err).Warn("rendered payload is too large")
+		if err := r.updatePayloadStatus(ctx, config, "", sizeErr); err != nil {
+			log.WithError(err).Error("failed to update payload status")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+	var insecureErr *insecureImageError
+	if goerrors.As(err, &insecureErr) {
+		// this won't succeed until the config or the service URL changes so don't retry
+		log.WithError(err).Warn("not rendering credentials for an insecure image URL")
+		r.Notifier.Warningf(config, relocationv1alpha1.InsecureImageURLReason, "%s", err)
+		return ctrl.Result{}, nil
+	}
+	if err != nil {
+		log.WithError(err).Error("failed to write input data")
+		return ctrl.Result{}, err
+	}
+	r.reportPayloadDrift(config, payloadHash, diff)
+	if err := r.setPayloadDiff(ctx, config, diff); err != nil {
+		log.WithError(err).Error("failed to set payload diff")
+		return ctrl.Result{}, err
+	}
+	if err := r.setBuildInfo(ctx, config); err != nil {
+		log.WithError(err).Error("failed to set build info")
+		return ctrl.Result{}, err
+	}
+	if err := r.clearForceRebuild(ctx, config); err != nil {
+		log.WithError(err).Error("failed to remove force rebuild annotation")
+		return ctrl.Result{}, err
 	}
 
-	u, err := url.JoinPath(r.BaseURL, "images", req.Namespace, fmt.Sprintf("%s.iso", req.Name))
+	certsValid, renewIn, err := r.checkCertificates(ctx, config)
+	if err != nil {
+		log.WithError(err).Error("failed to check certificates")
+		return ctrl.Result{}, err
+	}
+	// the condition is updated once a certificate enters the renewal window
+	requeueIn = shortestRequeue(requeueIn, renewIn)
+
+	if err := r.lintConfiguration(ctx, config); err != nil {
+		log.WithError(err).Error("failed to check the configuration for warnings")
+		return ctrl.Result{}, err
+	}
+
+	open, wait, err := r.checkMaintenanceWindow(ctx, config, time.Now())
+	if err != nil {
+		log.WithError(err).Error("failed to check maintenance window")
+		return ctrl.Result{}, err
+	}
+	if !open {
+		// the payload status is only updated once the host is modified so any
+		// reboot for changes made outside the window still happens once it opens
+		if wait > 0 {
+			log.Infof("deferring BareMetalHost changes for %s until the maintenance window opens", wait)
+		} else {
+			// requeuing can't fix the window, the spec update will trigger a reconcile
+			log.Warn("deferring BareMetalHost changes until the maintenance window is fixed")
+		}
+		if config.Status.Phase == relocationv1alpha1.ClusterConfigPhasePending {
+			if err := r.setPhase(ctx, config, relocationv1alpha1.ClusterConfigPhaseImageReady); err != nil {
+				log.WithError(err).Error("failed to set phase")
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{RequeueAfter: wait}, nil
+	}
+
+	// the host only needs to be rebooted if it may have already booted a previous version
+	// compare against the last attached payload so changes made while a patch is deferred still reboot
+	attachedHash := config.Status.PayloadHash
+	if n := len(config.Status.Attempts); n > 0 {
+		attachedHash = config.Status.Attempts[n-1].PayloadHash
+	}
+	payloadChanged := attachedHash != "" && attachedHash != payloadHash
+	if err := r.updatePayloadStatus(ctx, config, payloadHash, nil); err != nil {
+		log.WithError(err).Error("failed to update payload status")
+		return ctrl.Result{}, err
+	}
+
+	u, err := r.imageURL(config)
 	if err != nil {
 		log.WithError(err).Error("failed to create image url")
 		return ctrl.Result{}, err
 	}
+	if config.Status.ImageURL != u {
+		patch := client.MergeFrom(config.DeepCopy())
+		config.Status.ImageURL = u
+		if err := r.Status().Patch(ctx, config, patch); err != nil {
+			log.WithError(err).Error("failed to set image url")
+			return ctrl.Result{}, err
+		}
+	}
+	uploading, err := r.prestageImage(ctx, config)
+	if err != nil {
+		log.WithError(err).Error("failed to upload image to the zone cache")
+		return ctrl.Result{}, err
+	}
+
+	phase := relocationv1alpha1.ClusterConfigPhaseImageReady
+	if uploading {
+		// the queue records the cached image URL once it's uploaded, which reconciles the config again
+		log.Info("waiting for the image to be uploaded to the zone cache")
+		return r.holdAttach(ctx, config, phase, ctrl.Result{})
+	}
+	if bmhRef := configBMHRef(config); bmhRef != nil {
+		cached, err := r.ensureBMHCached(ctx, bmhRef)
+		if err != nil {
+			log.WithError(err).Error("failed to label BareMetalHost")
+			return ctrl.Result{}, err
+		}
+		if !cached {
+			// the BareMetalHost watch reconciles again once the labeled host is cached
+			log.Info("waiting for the referenced BareMetalHost to be cached")
+			return r.holdAttach(ctx, config, phase, ctrl.Result{})
+		}
+
+		found, err := r.bmhExists(ctx, bmhRef)
+		if err != nil {
+			log.WithError(err).Error("failed to get BareMetalHost")
+			return ctrl.Result{}, err
+		}
+		if err := r.setWaitingForHost(ctx, config, !found); err != nil {
+			log.WithError(err).Error("failed to set waiting for host condition")
+			return ctrl.Result{}, err
+		}
+		if !found {
+			// the BareMetalHost watch reconciles again once the host is created
+			log.Info("waiting for the referenced BareMetalHost to be created")
+			return r.holdAttach(ctx, config, phase, ctrl.Result{})
+		}
+		deprovision, err := r.bmhDeprovision(ctx, bmhRef)
+		if err != nil {
+			log.WithError(err).Error("failed to get BareMetalHost")
+			return ctrl.Result{}, err
+		}
+		if deprovision != "" {
+			// the BareMetalHost watch reconciles again once the ClusterDeprovision releases the host
+			log.Warnf("BareMetalHost is claimed by ClusterDeprovision %s, not attaching image", deprovision)
+			r.Notifier.Warningf(config, hostDeprovisionReason, "BareMetalHost is claimed by ClusterDeprovision %s", deprovision)
+			return r.holdAttach(ctx, config, phase, ctrl.Result{})
+		}
+
+		if err := r.setHostError(ctx, config); err != nil {
+			log.WithError(err).Error("failed to set host error condition")
+			return ctrl.Result{}, err
+		}
+
+		wait, failed, err := r.handleHostError(ctx, config)
+		if err != nil {
+			log.WithError(err).Error("failed to handle BareMetalHost error")
+			return ctrl.Result{}, err
+		}
+		if failed {
+			// this won't succeed until the config changes so don't retry
+			log.Warn("BareMetalHost errors persisted after the configured retries")
+			return r.holdAttach(ctx, config, relocationv1alpha1.ClusterConfigPhaseFailed, ctrl.Result{})
+		}
+		if wait > 0 {
+			log.Infof("retrying BareMetalHost error, attaching the image again in %s", wait)
+			return r.holdAttach(ctx, config, phase, ctrl.Result{RequeueAfter: wait})
+		}
+
+		if !certsValid {
+			// renewed certificates change the payload so the image is attached again once they're rendered
+			log.Info("certificates expire within the renewal window, not attaching image")
+			return r.holdAttach(ctx, config, phase, ctrl.Result{RequeueAfter: certRecheckInterval})
+		}
+
+		sufficient, err := r.checkHardware(ctx, config)
+		if err != nil {
+			log.WithError(err).Error("failed to check host hardware")
+			return ctrl.Result{}, err
+		}
+		if !sufficient {
+			// the BareMetalHost watch reconciles again once the host is inspected or its hardware changes
+			log.Info("host hardware doesn't meet the requirements, not attaching image")
+			return r.holdAttach(ctx, config, phase, ctrl.Result{})
+		}
+
+		if config.Spec.Preflight != nil {
+			passed, err := r.runPreflight(ctx, config)
+			if err != nil {
+				log.WithError(err).Error("failed to run preflight checks")
+				return ctrl.Result{}, err
+			}
+			if !passed && config.Spec.Preflight.Skip {
+				log.Warn("preflight checks failed, attaching the image anyway as they are skipped")
+			} else if !passed {
+				log.Info("preflight checks failed, not attaching image")
+				return r.holdAttach(ctx, config, phase, ctrl.Result{RequeueAfter: preflightRecheckInterval})
+			}
+		}
+
+		unreachable, err := r.checkProvisioningNetwork(ctx)
+		if err != nil {
+			log.WithError(err).Error("failed to check provisioning configuration")
+			return ctrl.Result{}, err
+		}
+		if err := r.setImageReachable(ctx, config, unreachable); err != nil {
+			log.WithError(err).Error("failed to set image reachable condition")
+			return ctrl.Result{}, err
+		}
+		if unreachable != "" {
+			// the Provisioning isn't watched so check again later
+			log.Warnf("not attaching image: %s", unreachable)
+			return r.holdAttach(ctx, config, phase, ctrl.Result{RequeueAfter: provisioningRecheckInterval})
+		}
 
-	if config.Spec.BareMetalHostRef != nil {
-		if err := r.setBMHImage(ctx, config.Spec.BareMetalHostRef, u); err != nil {
+		var rebootMode relocationv1alpha1.RebootMode
+		if payloadChanged && config.Spec.RebootMode != relocationv1alpha1.RebootModeNone {
+			rebootMode = config.Spec.RebootMode
+		}
+		// hosts download cached images with the image credentials too, the cache upload credentials are never attached
+		bmhURL := u
+		if config.Status.CachedImageURL != "" {
+			bmhURL = config.Status.CachedImageURL
+		}
+		bmhURL, err = r.withCredentials(ctx, config, bmhURL)
+		if err != nil {
+			log.WithError(err).Error("failed to create BareMetalHost image url")
+			return ctrl.Result{}, err
+		}
+		if err := r.reportHostDrift(ctx, config, payloadHash, bmhURL); err != nil {
+			log.WithError(err).Error("failed to check BareMetalHost for drift")
+			return ctrl.Result{}, err
+		}
+		networkData, err := r.syncNetworkData(ctx, config)
+		if err != nil {
+			log.WithError(err).Error("failed to copy BareMetalHost network data")
+			return ctrl.Result{}, err
+		}
+		deferred, err := r.setBMHImage(ctx, bmhRef, bmhURL, rebootMode, r.bmhOwner(config), networkData)
+		if err != nil {
 			log.WithError(err).Error("failed to set BareMetalHost image")
 			return ctrl.Result{}, err
 		}
+		if deferred > 0 {
+			log.Infof("BareMetalHost patch rate limit reached, retrying in %s", deferred)
+			return r.holdAttach(ctx, config, phase, ctrl.Result{RequeueAfter: deferred})
+		}
+		if err := r.recordAttempt(ctx, config, payloadHash); err != nil {
+			log.WithError(err).Error("failed to record attempt")
+			return ctrl.Result{}, err
+		}
+		captureIn, err := r.captureConsoleLog(ctx, log, config)
+		if err != nil {
+			log.WithError(err).Error("failed to capture host console output")
+			return ctrl.Result{}, err
+		}
+		// the console output is captured once it's due
+		requeueIn = shortestRequeue(requeueIn, captureIn)
+		phase = relocationv1alpha1.ClusterConfigPhaseImageAttached
+	}
+
+	if config.Status.Phase != relocationv1alpha1.ClusterConfigPhaseCompleted {
+		if err := r.setPhase(ctx, config, phase); err != nil {
+			log.WithError(err).Error("failed to set phase")
+			return ctrl.Result{}, err
+		}
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// updatePayloadStatus records the payload hash and whether the payload is within the size limit
+// An empty payloadHash leaves the current hash in place
+func (r *ClusterConfigReconciler) updatePayloadStatus(ctx context.Context, config *relocationv1alpha1.ClusterConfig, payloadHash string, sizeErr *payloadSizeError) error {
+	patch := client.MergeFrom(config.DeepCopy())
+	changed := false
+
+	if payloadHash != "" && config.Status.PayloadHash != payloadHash {
+		config.Status.PayloadHash = payloadHash
+		changed = true
+	}
+
+	if r.Options.MaxPayloadSize > 0 && config.Spec.ExternalImageURL == "" {
+		cond := metav1.Condition{
+			Type:    relocationv1alpha1.PayloadWithinSizeLimitCondition,
+			Status:  metav1.ConditionTrue,
+			Reason:  relocationv1alpha1.PayloadWithinSizeLimitReason,
+			Message: fmt.Sprintf("image is within the limit of %d bytes", r.Options.MaxPayloadSize),
+		}
+		if sizeErr != nil {
+			cond.Status = metav1.ConditionFalse
+			cond.Reason = relocationv1alpha1.PayloadTooLargeReason
+			cond.Message = sizeErr.Error()
+		}
+		cond.ObservedGeneration = config.Generation
+		if report.SetCondition(&config.Status.Conditions, cond) {
+			changed = true
+		}
+	} else if meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.PayloadWithinSizeLimitCondition) != nil {
+		meta.RemoveStatusCondition(&config.Status.Conditions, relocationv1alpha1.PayloadWithinSizeLimitCondition)
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+	return r.Status().Patch(ctx, config, patch)
+}
+
+// holdAttach ends a reconcile stopped by one of the gates before the image is attached with result
+// The phase is set to phase unless the relocation has already completed
+func (r *ClusterConfigReconciler) holdAttach(ctx context.Context, config *relocationv1alpha1.ClusterConfig, phase relocationv1alpha1.ClusterConfigPhase, result ctrl.Result) (ctrl.Result, error) {
+	if config.Status.Phase != relocationv1alpha1.ClusterConfigPhaseCompleted {
+		if err := r.setPhase(ctx, config, phase); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to set phase: %w", err)
+		}
+	}
+	return result, nil
+}
+
+// setPhase updates the status phase of config if it has changed and records it in the metrics
+func (r *ClusterConfigReconciler) setPhase(ctx context.Context, config *relocationv1alpha1.ClusterConfig, phase relocationv1alpha1.ClusterConfigPhase) error {
+	if config.Status.Phase != phase || config.Status.PhaseTransitionTime == nil {
+		patch := client.MergeFrom(config.DeepCopy())
+		now := metav1.Now()
+		config.Status.Phase = phase
+		config.Status.PhaseTransitionTime = &now
+		if err := r.Status().Patch(ctx, config, patch); err != nil {
+			return err
+		}
+	}
+
+	key := types.NamespacedName{Namespace: config.Namespace, Name: config.Name}
+	r.Metrics.SetPhase(key, string(phase), config.Status.PhaseTransitionTime.Time)
+	return r.setConsoleProgress(ctx, config)
+}
+
+func (r *ClusterConfigReconciler) handleDeletion(ctx context.Context, log logrus.FieldLogger, config *relocationv1alpha1.ClusterConfig) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(config, clusterConfigFinalizerName) {
+		return ctrl.Result{}, nil
+	}
+	if r.Deletions != nil {
+		r.Deletions.Add(types.NamespacedName{Namespace: config.Namespace, Name: config.Name})
+		log.Infof("queued cluster config cleanup, %d cleanups pending", r.Deletions.Len())
+		return ctrl.Result{}, nil
+	}
+	return r.cleanupDeleted(ctx, log, config)
+}
+
+// cleanupDeleted removes the data of a deleted config and then its finalizer
+// Objects changed for the config which can't be cleaned up only keep the finalizer while the host namespace they're in
+// isn't being deleted, as they may be gone with the namespace already, and nothing keeps it with ForceCleanupAnnotation
+func (r *ClusterConfigReconciler) cleanupDeleted(ctx context.Context, log logrus.FieldLogger, config *relocationv1alpha1.ClusterConfig) (ctrl.Result, error) {
+	forced := config.Annotations[relocationv1alpha1.ForceCleanupAnnotation] == "true"
+	lockCtx, cancel := r.lockContext(ctx)
+	defer cancel()
+	locked, err := removeConfigData(lockCtx, r.fs(), r.configDir(config), r.Lease)
+	if forced && (err != nil || !locked) {
+		if err == nil {
+			err = fmt.Errorf("timed out waiting for config dir lock")
+		}
+		r.Notifier.Warningf(config, cleanupSkippedReason, "cleanup was forced, leaving the config data behind: %v", err)
+	} else if err != nil {
+		log.WithError(err).Error("failed to remove config data")
+		return ctrl.Result{}, err
+	} else if !locked {
+		log.Info("timed out waiting for config dir lock, requeueing")
+		return ctrl.Result{Requeue: true}, nil
+	}
+	if err := r.cleanupDependents(ctx, config); err != nil {
+		// the dependents are in the host namespace, which may be torn down separately from the config's
+		dependentsNamespace := config.Namespace
+		if ref := configBMHRef(config); ref != nil {
+			dependentsNamespace = ref.Namespace
+		}
+		if !forced && !r.namespaceTerminating(ctx, dependentsNamespace) {
+			log.WithError(err).Error("failed to clean up objects changed for the config")
+			return ctrl.Result{}, err
+		}
+		r.Notifier.Warningf(config, cleanupSkippedReason, "removing the finalizer without cleaning up: %v", err)
 	}
 
+	controllerutil.RemoveFinalizer(config, clusterConfigFinalizerName)
+	if err := r.Update(ctx, config); client.IgnoreNotFound(err) != nil {
+		log.WithError(err).Error("failed to remove finalizer")
+		return ctrl.Result{}, err
+	}
+	r.Metrics.Delete(types.NamespacedName{Namespace: config.Namespace, Name: config.Name})
+
 	return ctrl.Result{}, nil
 }
 
+// handleCompletion runs the cleanup policy for a config whose relocation has completed
+func (r *ClusterConfigReconciler) handleCompletion(ctx context.Context, log logrus.FieldLogger, config *relocationv1alpha1.ClusterConfig) (ctrl.Result, error) {
+	switch config.Spec.CleanupPolicy {
+	case relocationv1alpha1.CleanupPolicyDeleteClusterConfig:
+		log.Info("relocation completed, deleting cluster config")
+		if err := r.Delete(ctx, config); client.IgnoreNotFound(err) != nil {
+			log.WithError(err).Error("failed to delete cluster config")
+			return ctrl.Result{}, err
+		}
+	case relocationv1alpha1.CleanupPolicyDetachImage:
+		log.Info("relocation completed, detaching image")
+		if bmhRef := configBMHRef(config); bmhRef != nil {
+			if err := r.detachBMHImage(ctx, bmhRef); err != nil {
+				log.WithError(err).Error("failed to detach BareMetalHost image")
+				return ctrl.Result{}, err
+			}
+		}
+		lockCtx, cancel := r.lockContext(ctx)
+		defer cancel()
+		locked, err := removeConfigData(lockCtx, r.fs(), r.configDir(config), r.Lease)
+		if err != nil {
+			log.WithError(err).Error("failed to remove config data")
+			return ctrl.Result{}, err
+		}
+		if !locked {
+			log.Info("timed out waiting for config dir lock, requeueing")
+			return ctrl.Result{Requeue: true}, nil
+		}
+	default:
+		return ctrl.Result{}, fmt.Errorf("unknown cleanup policy %s", config.Spec.CleanupPolicy)
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// imageURL returns the URL the image for config is served from
+// If ReattachOnChange is set the URL includes the payload version so it changes along with the content
+func (r *ClusterConfigReconciler) imageURL(config *relocationv1alpha1.ClusterConfig) (string, error) {
+	if config.Spec.ExternalImageURL != "" {
+		return config.Spec.ExternalImageURL, nil
+	}
+	base, err := r.zoneBaseURL(config)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.JoinPath(base, "images", config.Namespace, fmt.Sprintf("%s.iso", config.Name))
+	if err != nil {
+		return "", err
+	}
+	if !config.Spec.ReattachOnChange || config.Status.PayloadHash == "" {
+		return u, nil
+	}
+
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return "", err
+	}
+	parsed.RawQuery = url.Values{"version": []string{config.Status.PayloadHash[:payloadVersionLength]}}.Encode()
+	return parsed.String(), nil
+}
+
+// dataDir returns the directory holding the configs in namespace
+func (r *ClusterConfigReconciler) dataDir(namespace string) string {
+	if dir := datadir.For(r.Options.DataDirShards, namespace); dir != "" {
+		return dir
+	}
+	return r.Options.DataDir
+}
+
+// blobs returns the store sharing files between the configs in dataDir, or nil if sharing is disabled
+func (r *ClusterConfigReconciler) blobs(dataDir string) *dedup.Store {
+	if r.Blobs == nil || dataDir == r.Options.DataDir {
+		return r.Blobs
+	}
+	return &dedup.Store{Dir: filepath.Join(dataDir, "blobs")}
+}
+
+func (r *ClusterConfigReconciler) configDir(config *relocationv1alpha1.ClusterConfig) string {
+	return filepath.Join(r.dataDir(config.Namespace), "namespaces", config.Namespace, config.Name)
+}
+
+// mapBMHToCC returns requests for the ClusterConfigs referencing obj
+// The host isn't required to exist so configs created before the host are reconciled when it's created or deleted
 func (r *ClusterConfigReconciler) mapBMHToCC(ctx context.Context, obj client.Object) []reconcile.Request {
-	bmh := &bmh_v1alpha1.BareMetalHost{}
 	bmhName := obj.GetName()
 	bmhNamespace := obj.GetNamespace()
 
-	if err := r.Get(ctx, types.NamespacedName{Name: bmhName, Namespace: bmhNamespace}, bmh); err != nil {
-		return []reconcile.Request{}
+	if req, ok := r.annotatedOwner(ctx, obj); ok {
+		return []reconcile.Request{req}
 	}
+
 	ccList := &relocationv1alpha1.ClusterConfigList{}
-	if err := r.List(ctx, ccList); err != nil {
+	ref := types.NamespacedName{Namespace: bmhNamespace, Name: bmhName}.String()
+	if err := r.List(ctx, ccList, client.MatchingFields{bmhRefIndex: ref}); err != nil {
 		return []reconcile.Request{}
 	}
 	if len(ccList.Items) == 0 {
@@ -119,10 +847,11 @@ func (r *ClusterConfigReconciler) mapBMHToCC(ctx context.Context, obj client.Obj
 
 	requests := []reconcile.Request{}
 	for _, cc := range ccList.Items {
-		if cc.Spec.BareMetalHostRef == nil {
+		ref := configBMHRef(&cc)
+		if ref == nil {
 			continue
 		}
-		if cc.Spec.BareMetalHostRef.Name == bmhName && cc.Spec.BareMetalHostRef.Namespace == bmhNamespace {
+		if ref.Name == bmhName && ref.Namespace == bmhNamespace {
 			req := reconcile.Request{
 				NamespacedName: types.NamespacedName{
 					Namespace: cc.Namespace,
@@ -133,7 +862,22 @@ func (r *ClusterConfigReconciler) mapBMHToCC(ctx context.Context, obj client.Obj
 		}
 	}
 	if len(requests) > 1 {
-		r.Log.Warn("found multiple ClusterConfigs referencing BaremetalHost %s/%s", bmhNamespace, bmhName)
+		r.Notifier.Warningf(obj, multipleClusterConfigsReason, "found multiple ClusterConfigs referencing BareMetalHost %s/%s", bmhNamespace, bmhName)
+	}
+	return requests
+}
+
+// mapInputToCC returns requests for the ClusterConfigs whose payload is rendered from the Secret or ConfigMap obj
+func (r *ClusterConfigReconciler) mapInputToCC(ctx context.Context, obj client.Object) []reconcile.Request {
+	kind := obj.GetObjectKind().GroupVersionKind().Kind
+	ccList := &relocationv1alpha1.ClusterConfigList{}
+	if err := r.List(ctx, ccList, client.MatchingFields{inputRefIndex: inputRefKey(kind, client.ObjectKeyFromObject(obj))}); err != nil {
+		return []reconcile.Request{}
+	}
+
+	requests := make([]reconcile.Request, 0, len(ccList.Items))
+	for _, cc := range ccList.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&cc)})
 	}
 	return requests
 }
@@ -150,30 +894,70 @@ func serviceURL(opts *ClusterConfigReconcilerOptions) string {
 	return u.String()
 }
 
+// baseURL returns the URL the image service is reachable at
+// BaseURL is set when the endpoint is managed, see EnsureEndpoint
+func (r *ClusterConfigReconciler) baseURL() string {
+	if r.BaseURL != "" {
+		return r.BaseURL
+	}
+	return serviceURL(r.Options)
+}
+
 func (r *ClusterConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	if r.Options.ServiceName == "" || r.Options.ServiceNamespace == "" || r.Options.ServiceScheme == "" {
 		return fmt.Errorf("SERVICE_NAME, SERVICE_NAMESPACE, and SERVICE_SCHEME must be set")
 	}
-	r.BaseURL = serviceURL(r.Options)
+
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &relocationv1alpha1.ClusterConfig{}, bmhRefIndex, bmhRefIndexValue); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &relocationv1alpha1.ClusterConfig{}, inputRefIndex, inputRefIndexValue); err != nil {
+		return err
+	}
 
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&relocationv1alpha1.ClusterConfig{}).
 		WatchesRawSource(source.Kind(mgr.GetCache(), &bmh_v1alpha1.BareMetalHost{}), handler.EnqueueRequestsFromMapFunc(r.mapBMHToCC)).
+		WatchesRawSource(source.Kind(mgr.GetCache(), inputMetadata("Secret")), handler.EnqueueRequestsFromMapFunc(r.mapInputToCC)).
+		WatchesRawSource(source.Kind(mgr.GetCache(), inputMetadata("ConfigMap")), handler.EnqueueRequestsFromMapFunc(r.mapInputToCC)).
 		Complete(r)
 }
 
-func (r *ClusterConfigReconciler) setBMHImage(ctx context.Context, bmhRef *relocationv1alpha1.BareMetalHostReference, url string) error {
+// setBMHImage attaches the image at url to the referenced host
+// If rebootMode is set and the host already had an image attached it is also rebooted so it boots the new content
+// If networkData is set it is used as the network data of the OS provisioned on the host
+// If the patch rate limit has been reached the host is not modified and the time to wait before retrying is returned
+func (r *ClusterConfigReconciler) setBMHImage(ctx context.Context, bmhRef *relocationv1alpha1.BareMetalHostReference, url string, rebootMode relocationv1alpha1.RebootMode, owner string, networkData *corev1.SecretReference) (deferred time.Duration, err error) {
+	ctx, span := tracing.Start(ctx, "setBMHImage",
+		attribute.String("baremetalhost.namespace", bmhRef.Namespace),
+		attribute.String("baremetalhost.name", bmhRef.Name),
+	)
+	defer func() { tracing.End(span, err) }()
+
 	bmh := &bmh_v1alpha1.BareMetalHost{}
 	key := types.NamespacedName{
 		Name:      bmhRef.Name,
 		Namespace: bmhRef.Namespace,
 	}
 	if err := r.Get(ctx, key, bmh); err != nil {
-		return err
+		return 0, err
 	}
 	patch := client.MergeFrom(bmh.DeepCopy())
 
 	dirty := false
+	if rebootMode != "" && bmh.Spec.Image != nil && bmh.Spec.Image.URL != "" {
+		args, err := json.Marshal(bmh_v1alpha1.RebootAnnotationArguments{Mode: bmh_v1alpha1.RebootMode(rebootMode)})
+		if err != nil {
+			return 0, err
+		}
+		// the unsuffixed annotation is removed by the baremetal-operator once the reboot is done
+		metav1.SetMetaDataAnnotation(&bmh.ObjectMeta, bmh_v1alpha1.RebootAnnotationPrefix, string(args))
+		dirty = true
+	}
+	if owner != "" && bmh.Annotations[relocationv1alpha1.ClusterConfigAnnotation] != owner {
+		metav1.SetMetaDataAnnotation(&bmh.ObjectMeta, relocationv1alpha1.ClusterConfigAnnotation, owner)
+		dirty = true
+	}
 	if !bmh.Spec.Online {
 		bmh.Spec.Online = true
 		dirty = true
@@ -186,111 +970,239 @@ func (r *ClusterConfigReconciler) setBMHImage(ctx context.Context, bmhRef *reloc
 		bmh.Spec.Image.URL = url
 		dirty = true
 	}
-	liveIso := "live-iso"
-	if bmh.Spec.Image.DiskFormat == nil || *bmh.Spec.Image.DiskFormat != liveIso {
-		bmh.Spec.Image.DiskFormat = &liveIso
+	diskFormat := relocationv1alpha1.LiveISODiskFormat
+	if bmhRef.DiskFormat != "" {
+		diskFormat = bmhRef.DiskFormat
+	}
+	if bmh.Spec.Image.DiskFormat == nil || *bmh.Spec.Image.DiskFormat != diskFormat {
+		bmh.Spec.Image.DiskFormat = &diskFormat
+		dirty = true
+	}
+	if bmhRef.BootMode != "" && bmh.Spec.BootMode != bmhRef.BootMode {
+		bmh.Spec.BootMode = bmhRef.BootMode
+		dirty = true
+	}
+	if bmhRef.RootDeviceHints != nil && !equality.Semantic.DeepEqual(bmh.Spec.RootDeviceHints, bmhRef.RootDeviceHints) {
+		bmh.Spec.RootDeviceHints = bmhRef.RootDeviceHints.DeepCopy()
+		dirty = true
+	}
+	if bmhRef.AutomatedCleaningMode != "" && bmh.Spec.AutomatedCleaningMode != bmhRef.AutomatedCleaningMode {
+		bmh.Spec.AutomatedCleaningMode = bmhRef.AutomatedCleaningMode
+		dirty = true
+	}
+	if networkData != nil && !equality.Semantic.DeepEqual(bmh.Spec.NetworkData, networkData) {
+		bmh.Spec.NetworkData = networkData
 		dirty = true
 	}
 
-	if dirty {
-		if err := r.Patch(ctx, bmh, patch); err != nil {
-			return err
-		}
+	if !dirty {
+		r.BMHPatches.Forget(key)
+		return 0, nil
+	}
+	if delay := r.BMHPatches.Delay(key); delay > 0 {
+		return delay, nil
 	}
 
-	return nil
+	return 0, r.Patch(ctx, bmh, patch)
 }
 
-// writeInputData writes the required info based on the cluster config to the config cache dir
-func (r *ClusterConfigReconciler) writeInputData(ctx context.Context, config *relocationv1alpha1.ClusterConfig) (bool, error) {
-	configDir := filepath.Join(r.Options.DataDir, "namespaces", config.Namespace, config.Name)
-	filesDir := filepath.Join(configDir, "files")
-	if err := os.MkdirAll(filesDir, 0700); err != nil {
-		return false, err
+// setReconciled records whether the payload could be written from the current spec
+func (r *ClusterConfigReconciler) setReconciled(ctx context.Context, config *relocationv1alpha1.ClusterConfig, writeErr error) error {
+	cond := metav1.Condition{
+		Type:               relocationv1alpha1.ReconciledCondition,
+		Status:             metav1.ConditionTrue,
+		Reason:             cro.ReconciliationSucceededReason,
+		Message:            "the payload has been rendered",
+		ObservedGeneration: config.Generation,
+	}
+	if config.Spec.ExternalImageURL != "" {
+		cond.Message = "the external image is used"
+	}
+	if writeErr != nil {
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = reconciledReason(writeErr)
+		cond.Message = writeErr.Error()
 	}
 
-	locked, err := filelock.WithWriteLock(configDir, func() error {
-		if err := r.writeClusterRelocation(config, filepath.Join(filesDir, "cluster-relocation.json")); err != nil {
-			return err
-		}
-
-		if err := r.writeSecretToFile(ctx, config.Spec.APICertRef, filepath.Join(filesDir, "api-cert-secret.json")); err != nil {
-			return fmt.Errorf("failed to write api cert secret: %w", err)
-		}
-
-		if err := r.writeSecretToFile(ctx, config.Spec.IngressCertRef, filepath.Join(filesDir, "ingress-cert-secret.json")); err != nil {
-			return fmt.Errorf("failed to write ingress cert secret: %w", err)
-		}
-
-		if err := r.writeSecretToFile(ctx, config.Spec.PullSecretRef, filepath.Join(filesDir, "pull-secret-secret.json")); err != nil {
-			return fmt.Errorf("failed to write pull secret: %w", err)
-		}
+	patch := client.MergeFrom(config.DeepCopy())
+	if !report.SetCondition(&config.Status.Conditions, cond) {
+		return nil
+	}
+	return r.Status().Patch(ctx, config, patch)
+}
 
-		// TODO: create network config when we know what this looks like
-		// no sense in spending time working on a CM if it's not going to be one in the end
+// configBMHRef returns the BareMetalHostRef of config with the namespace defaulted to the config's, nil if it has none
+// The webhook defaults the namespace but configs created while it is disabled may leave it empty
+func configBMHRef(config *relocationv1alpha1.ClusterConfig) *relocationv1alpha1.BareMetalHostReference {
+	if config.Spec.BareMetalHostRef == nil {
 		return nil
-	})
-	if err != nil {
-		return false, fmt.Errorf("failed to acquire file lock: %w", err)
 	}
-	if !locked {
-		return true, nil
+	ref := config.Spec.BareMetalHostRef.DeepCopy()
+	if ref.Namespace == "" {
+		ref.Namespace = config.Namespace
 	}
+	return ref
+}
 
-	return false, nil
+// bmhExists returns true if the referenced host has been created
+func (r *ClusterConfigReconciler) bmhExists(ctx context.Context, bmhRef *relocationv1alpha1.BareMetalHostReference) (bool, error) {
+	bmh := &bmh_v1alpha1.BareMetalHost{}
+	key := types.NamespacedName{
+		Name:      bmhRef.Name,
+		Namespace: bmhRef.Namespace,
+	}
+	if err := r.Get(ctx, key, bmh); err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
 }
 
-func (r *ClusterConfigReconciler) writeClusterRelocation(config *relocationv1alpha1.ClusterConfig, file string) error {
-	cr := &cro.ClusterRelocation{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      config.Name,
-			Namespace: config.Namespace,
-		},
-		Spec: config.Spec.ClusterRelocationSpec,
+// bmhDeprovision returns the ClusterDeprovision which claimed the referenced host, if any
+func (r *ClusterConfigReconciler) bmhDeprovision(ctx context.Context, bmhRef *relocationv1alpha1.BareMetalHostReference) (string, error) {
+	bmh := &bmh_v1alpha1.BareMetalHost{}
+	key := types.NamespacedName{
+		Name:      bmhRef.Name,
+		Namespace: bmhRef.Namespace,
+	}
+	if err := r.Get(ctx, key, bmh); err != nil {
+		return "", client.IgnoreNotFound(err)
 	}
+	return bmh.Annotations[relocationv1alpha1.ClusterDeprovisionAnnotation], nil
+}
 
-	gvks, unversioned, err := r.Scheme.ObjectKinds(cr)
-	if err != nil {
-		return err
+// setWaitingForHost records whether the config is waiting for the referenced host to be created
+func (r *ClusterConfigReconciler) setWaitingForHost(ctx context.Context, config *relocationv1alpha1.ClusterConfig, waiting bool) error {
+	cond := metav1.Condition{
+		Type:               relocationv1alpha1.WaitingForHostCondition,
+		Status:             metav1.ConditionFalse,
+		Reason:             relocationv1alpha1.HostFoundReason,
+		Message:            "the referenced BareMetalHost exists",
+		ObservedGeneration: config.Generation,
 	}
-	if unversioned || len(gvks) == 0 {
-		return fmt.Errorf("unable to find API version for ClusterRelocation")
+	if waiting {
+		cond.Status = metav1.ConditionTrue
+		cond.Reason = relocationv1alpha1.HostNotFoundReason
+		ref := configBMHRef(config)
+		cond.Message = fmt.Sprintf("BareMetalHost %s/%s does not exist, the image will be attached once it is created", ref.Namespace, ref.Name)
 	}
-	// if there are multiple assume the last is the most recent
-	gvk := gvks[len(gvks)-1]
-	cr.TypeMeta = metav1.TypeMeta{
-		APIVersion: gvk.GroupVersion().String(),
-		Kind:       gvk.Kind,
+
+	patch := client.MergeFrom(config.DeepCopy())
+	if !report.SetCondition(&config.Status.Conditions, cond) {
+		return nil
 	}
+	return r.Status().Patch(ctx, config, patch)
+}
 
-	data, err := json.Marshal(cr)
-	if err != nil {
-		return fmt.Errorf("failed to marshal cluster relocation: %w", err)
+func (r *ClusterConfigReconciler) detachBMHImage(ctx context.Context, bmhRef *relocationv1alpha1.BareMetalHostReference) error {
+	bmh := &bmh_v1alpha1.BareMetalHost{}
+	key := types.NamespacedName{
+		Name:      bmhRef.Name,
+		Namespace: bmhRef.Namespace,
+	}
+	if err := r.Get(ctx, key, bmh); err != nil {
+		return client.IgnoreNotFound(err)
 	}
-	if err := os.WriteFile(file, data, 0644); err != nil {
-		return fmt.Errorf("failed to write cluster relocation: %w", err)
+	if bmh.Spec.Image == nil {
+		return nil
 	}
 
-	return nil
+	patch := client.MergeFrom(bmh.DeepCopy())
+	bmh.Spec.Image = nil
+	return r.Patch(ctx, bmh, patch)
 }
 
-func (r *ClusterConfigReconciler) writeSecretToFile(ctx context.Context, ref *corev1.SecretReference, file string) error {
-	if ref == nil {
-		return nil
+// lockContext bounds the time spent waiting for a config directory lock
+func (r *ClusterConfigReconciler) lockContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, r.Options.LockTimeout)
+}
+
+// writeInputData writes the required info based on the cluster config to the config cache dir
+// It returns a hash of the written content and how it differs from the content previously in the dir
+func (r *ClusterConfigReconciler) writeInputData(ctx context.Context, config *relocationv1alpha1.ClusterConfig) (payloadHash string, diff *relocationv1alpha1.PayloadDiff, requeue bool, err error) {
+	ctx, span := tracing.Start(ctx, "writeInputData", tracing.ClusterConfigAttributes(config.Namespace, config.Name)...)
+	defer func() { tracing.End(span, err) }()
+
+	configDir := r.configDir(config)
+	filesDir := filepath.Join(configDir, "files")
+	if err := r.fs().MkdirAll(filesDir, 0700); err != nil {
+		return "", nil, false, err
 	}
 
-	s := &corev1.Secret{}
-	key := types.NamespacedName{Name: ref.Name, Namespace: ref.Namespace}
-	if err := r.Get(ctx, key, s); err != nil {
-		return err
+	lockCtx, cancel := r.lockContext(ctx)
+	defer cancel()
+	locked, err := filelock.WithFencedWriteLockContext(lockCtx, configDir, r.Lease, func() error {
+		// don't leave content rendered before the check applied behind either
+		if err := r.checkImageTransport(config); err != nil {
+			if removeErr := r.fs().RemoveAll(filesDir); removeErr != nil {
+				return fmt.Errorf("failed to remove insecure payload: %w", removeErr)
+			}
+			return err
+		}
+		previous := snapshotPayload(filesDir)
+		// the payload is replaced as a whole so a failed render or a crash never leaves a mix of old and new files
+		tx, err := txfs.Begin(filesDir, filepath.Join(configDir, payloadTxDir))
+		if err != nil {
+			return fmt.Errorf("failed to begin payload transaction: %w", err)
+		}
+		defer tx.Rollback()
+		w := isoschema.NewWriterTo(filesDir, tx)
+		if err := r.renderPayload(ctx, payloadRenderers, config, w); err != nil {
+			return err
+		}
+		if err := r.runRenderPlugins(ctx, config, configDir, w); err != nil {
+			return err
+		}
+
+		if err := w.SetRelease(releasePin(config)); err != nil {
+			return err
+		}
+		if err := w.SetVolume(imageVolume(config)); err != nil {
+			return err
+		}
+
+		if err := w.WriteManifest(); err != nil {
+			return err
+		}
+		payloadHash = w.Hash()
+
+		if err := r.writeBuildInfo(ctx, config, filesDir, w, payloadHash); err != nil {
+			return fmt.Errorf("failed to write build info: %w", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to write payload: %w", err)
+		}
+		// the image is laid out from the committed files, the lock is still held so it isn't served meanwhile
+		// don't leave content behind that would produce an image the host may not be able to use
+		if err := checkPayloadSize(filesDir, w, r.Options.MaxPayloadSize); err != nil {
+			if removeErr := r.fs().RemoveAll(filesDir); removeErr != nil {
+				return fmt.Errorf("failed to remove oversized payload: %w", removeErr)
+			}
+			return err
+		}
+		diff = newPayloadDiff(previous, snapshotPayload(filesDir), payloadHash)
+
+		// many sites share certs and pull secrets so only keep one copy of each
+		if blobs := r.blobs(r.dataDir(config.Namespace)); blobs != nil {
+			if err := blobs.LinkDir(filesDir); err != nil {
+				return fmt.Errorf("failed to deduplicate files: %w", err)
+			}
+		}
+		return nil
+	})
+	var sizeErr *payloadSizeError
+	var insecureErr *insecureImageError
+	if goerrors.As(err, &sizeErr) || goerrors.As(err, &insecureErr) {
+		return "", nil, false, err
 	}
-	data, err := json.Marshal(s)
 	if err != nil {
-		return err
+		return "", nil, false, fmt.Errorf("failed to acquire file lock: %w", err)
 	}
-	if err := os.WriteFile(file, data, 0644); err != nil {
-		return err
+	if !locked {
+		return "", nil, true, nil
 	}
 
-	return nil
+	return payloadHash, diff, false, nil
 }
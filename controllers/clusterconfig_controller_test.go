@@ -1,25 +1,54 @@
 package controllers
 
 import (
+	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"math/big"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	cro "github.com/RHsyseng/cluster-relocation-operator/api/v1beta1"
+	"github.com/carbonin/cluster-relocation-service/api/isoschema"
 	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+	"github.com/carbonin/cluster-relocation-service/internal/datadir"
+	"github.com/carbonin/cluster-relocation-service/internal/dedup"
+	"github.com/carbonin/cluster-relocation-service/internal/filelock"
+	"github.com/carbonin/cluster-relocation-service/internal/ratelimit"
+	"github.com/carbonin/cluster-relocation-service/internal/report"
+	"github.com/carbonin/cluster-relocation-service/internal/version"
 	bmh_v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	configv1 "github.com/openshift/api/config/v1"
 	"github.com/sirupsen/logrus"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/yaml"
 )
 
 var _ = Describe("Reconcile", func() {
@@ -36,6 +65,7 @@ var _ = Describe("Reconcile", func() {
 		c = fakeclient.NewClientBuilder().
 			WithScheme(scheme.Scheme).
 			WithStatusSubresource(&relocationv1alpha1.ClusterConfig{}).
+			WithIndex(&relocationv1alpha1.ClusterConfig{}, bmhRefIndex, bmhRefIndexValue).
 			Build()
 		var err error
 		dataDir, err = os.MkdirTemp("", "clusterconfig_controller_test_data")
@@ -45,7 +75,7 @@ var _ = Describe("Reconcile", func() {
 			Client:  c,
 			Scheme:  scheme.Scheme,
 			Log:     logrus.New(),
-			BaseURL: "http://service.namespace",
+			BaseURL: "https://service.namespace",
 			Options: &ClusterConfigReconcilerOptions{
 				ServiceName:      "service",
 				ServiceNamespace: "namespace",
@@ -78,6 +108,51 @@ var _ = Describe("Reconcile", func() {
 		Expect(secret.Data).To(Equal(data))
 	}
 
+	It("records what the payload was built from", func() {
+		createSecret("pull-secret", map[string][]byte{".dockerconfigjson": []byte("{}")})
+		config := &relocationv1alpha1.ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: configName, Namespace: configNamespace},
+			Spec: relocationv1alpha1.ClusterConfigSpec{
+				ClusterRelocationSpec: cro.ClusterRelocationSpec{
+					Domain:        "thing.example.com",
+					PullSecretRef: &corev1.SecretReference{Name: "pull-secret", Namespace: configNamespace},
+				},
+			},
+		}
+		Expect(c.Create(ctx, config)).To(Succeed())
+		secret := &corev1.Secret{}
+		Expect(c.Get(ctx, types.NamespacedName{Namespace: configNamespace, Name: "pull-secret"}, secret)).To(Succeed())
+
+		key := types.NamespacedName{Namespace: configNamespace, Name: configName}
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+
+		filesDir := filepath.Join(dataDir, "namespaces", configNamespace, configName, "files")
+		info, err := isoschema.ReadBuildInfo(os.DirFS(filesDir))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info).NotTo(BeNil())
+		Expect(info.Version).To(Equal(version.Version))
+		Expect(info.Sources).To(HaveLen(2))
+		Expect(info.Sources[0].Kind).To(Equal("ClusterConfig"))
+		Expect(info.Sources[0].Name).To(Equal(configName))
+		Expect(info.Sources[0].ResourceVersion).NotTo(BeEmpty())
+		Expect(info.Sources[1]).To(Equal(isoschema.Source{Kind: "Secret", Namespace: configNamespace, Name: "pull-secret", ResourceVersion: secret.ResourceVersion}))
+
+		Expect(c.Get(ctx, key, config)).To(Succeed())
+		Expect(config.Status.BuildInfo).NotTo(BeNil())
+		Expect(config.Status.BuildInfo.PayloadHash).To(Equal(config.Status.PayloadHash))
+		Expect(info.PayloadHash).To(Equal(config.Status.PayloadHash))
+		Expect(config.Status.BuildInfo.BuildTime.Time.Equal(info.BuildTime)).To(BeTrue())
+		Expect(config.Status.BuildInfo.Sources).To(HaveLen(2))
+
+		// rendering the same content again keeps the original build info
+		_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		again, err := isoschema.ReadBuildInfo(os.DirFS(filesDir))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(again).To(Equal(info))
+	})
+
 	It("creates the correct relocation content", func() {
 		config := &relocationv1alpha1.ClusterConfig{
 			ObjectMeta: metav1.ObjectMeta{
@@ -111,6 +186,222 @@ var _ = Describe("Reconcile", func() {
 		Expect(relocation.Namespace).To(Equal(configNamespace))
 		Expect(relocation.Kind).To(Equal("ClusterRelocation"))
 		Expect(relocation.APIVersion).To(Equal("rhsyseng.github.io/v1beta1"))
+
+		Expect(c.Get(ctx, key, config)).To(Succeed())
+		Expect(config.Status.Phase).To(Equal(relocationv1alpha1.ClusterConfigPhaseImageReady))
+		Expect(config.Status.ImageURL).To(Equal(fmt.Sprintf("https://service.namespace/images/%s/%s.iso", configNamespace, configName)))
+		Expect(config.Status.PhaseTransitionTime).NotTo(BeNil())
+	})
+
+	It("records the console and API URLs of the relocated cluster", func() {
+		config := &relocationv1alpha1.ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: configName, Namespace: configNamespace},
+			Spec: relocationv1alpha1.ClusterConfigSpec{
+				ClusterRelocationSpec: cro.ClusterRelocationSpec{Domain: "thing.example.com"},
+			},
+		}
+		Expect(c.Create(ctx, config)).To(Succeed())
+
+		key := types.NamespacedName{Namespace: configNamespace, Name: configName}
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(c.Get(ctx, key, config)).To(Succeed())
+		Expect(config.Status.ConsoleURL).To(Equal("https://console-openshift-console.apps.thing.example.com"))
+		Expect(config.Status.APIURL).To(Equal("https://api.thing.example.com:6443"))
+
+		config.Spec.Domain = "other.example.com"
+		Expect(c.Update(ctx, config)).To(Succeed())
+		_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(c.Get(ctx, key, config)).To(Succeed())
+		Expect(config.Status.ConsoleURL).To(Equal("https://console-openshift-console.apps.other.example.com"))
+		Expect(config.Status.APIURL).To(Equal("https://api.other.example.com:6443"))
+	})
+
+	It("resyncs periodically and corrects drift of the payload and the host", func() {
+		recorder := record.NewFakeRecorder(10)
+		r.Notifier = &report.Notifier{Recorder: recorder}
+		r.Options.ResyncPeriod = time.Hour
+		bmh := &bmh_v1alpha1.BareMetalHost{ObjectMeta: metav1.ObjectMeta{Name: "test-bmh", Namespace: "test-bmh-namespace"}}
+		Expect(c.Create(ctx, bmh)).To(Succeed())
+		config := &relocationv1alpha1.ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: configName, Namespace: configNamespace},
+			Spec: relocationv1alpha1.ClusterConfigSpec{
+				ClusterRelocationSpec: cro.ClusterRelocationSpec{Domain: "thing.example.com"},
+				BareMetalHostRef:      &relocationv1alpha1.BareMetalHostReference{Name: bmh.Name, Namespace: bmh.Namespace},
+			},
+		}
+		Expect(c.Create(ctx, config)).To(Succeed())
+
+		key := types.NamespacedName{Namespace: configNamespace, Name: configName}
+		res, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.RequeueAfter).To(Equal(time.Hour))
+		res, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.RequeueAfter).To(Equal(time.Hour))
+		Expect(recorder.Events).To(BeEmpty())
+
+		Expect(c.Get(ctx, key, config)).To(Succeed())
+		relocationFile := filepath.Join(r.configDir(config), "files", "cluster-relocation.json")
+		Expect(os.WriteFile(relocationFile, []byte(`{"domain":"stale.example.com"}`), 0600)).To(Succeed())
+		Expect(c.Get(ctx, types.NamespacedName{Namespace: bmh.Namespace, Name: bmh.Name}, bmh)).To(Succeed())
+		attached := bmh.Spec.Image.URL
+		bmh.Spec.Image.URL = "https://old.example.com/image.iso"
+		Expect(c.Update(ctx, bmh)).To(Succeed())
+
+		_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recorder.Events).To(Receive(Equal("Warning DriftCorrected the rendered ClusterRelocation payload files didn't match the ClusterConfig and were rendered again")))
+		Expect(recorder.Events).To(Receive(Equal("Warning DriftCorrected BareMetalHost test-bmh-namespace/test-bmh no longer had the image of the ClusterConfig attached, attaching it again")))
+
+		content, err := os.ReadFile(relocationFile)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(content)).To(ContainSubstring("thing.example.com"))
+		Expect(c.Get(ctx, types.NamespacedName{Namespace: bmh.Namespace, Name: bmh.Name}, bmh)).To(Succeed())
+		Expect(bmh.Spec.Image.URL).To(Equal(attached))
+	})
+
+	It("renders tag mirrors and converts legacy digest mirrors", func() {
+		config := &relocationv1alpha1.ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      configName,
+				Namespace: configNamespace,
+			},
+			Spec: relocationv1alpha1.ClusterConfigSpec{
+				ClusterRelocationSpec: cro.ClusterRelocationSpec{
+					Domain: "thing.example.com",
+					ImageDigestMirrors: []configv1.ImageDigestMirrors{{
+						Source:  "quay.io/openshift-release-dev/ocp-release",
+						Mirrors: []configv1.ImageMirror{"registry.example.com/ocp-release"},
+					}},
+				},
+				ImageTagMirrors: []configv1.ImageTagMirrors{{
+					Source:  "quay.io/stuff",
+					Mirrors: []configv1.ImageMirror{"registry.example.com/stuff"},
+				}},
+				RepositoryDigestMirrors: []relocationv1alpha1.RepositoryDigestMirrors{{
+					Source:  "quay.io/openshift-release-dev/ocp-v4.0-art-dev",
+					Mirrors: []string{"registry.example.com/ocp-v4.0-art-dev"},
+				}},
+			},
+		}
+		Expect(c.Create(ctx, config)).To(Succeed())
+
+		key := types.NamespacedName{
+			Namespace: configNamespace,
+			Name:      configName,
+		}
+		res, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res).To(Equal(ctrl.Result{}))
+
+		reader, err := isoschema.NewReader(os.DirFS(filepath.Join(dataDir, "namespaces", configNamespace, configName, "files")))
+		Expect(err).NotTo(HaveOccurred())
+
+		relocation := &cro.ClusterRelocation{}
+		found, err := reader.ReadObject(isoschema.ClusterRelocationFileType, relocation)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found).To(BeTrue())
+		Expect(relocation.Spec.ImageDigestMirrors).To(Equal([]configv1.ImageDigestMirrors{
+			{
+				Source:  "quay.io/openshift-release-dev/ocp-release",
+				Mirrors: []configv1.ImageMirror{"registry.example.com/ocp-release"},
+			},
+			{
+				Source:  "quay.io/openshift-release-dev/ocp-v4.0-art-dev",
+				Mirrors: []configv1.ImageMirror{"registry.example.com/ocp-v4.0-art-dev"},
+			},
+		}))
+
+		itms := &configv1.ImageTagMirrorSet{}
+		found, err = reader.ReadObject(isoschema.ImageTagMirrorSetFileType, itms)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found).To(BeTrue())
+		Expect(itms.Kind).To(Equal("ImageTagMirrorSet"))
+		Expect(itms.APIVersion).To(Equal("config.openshift.io/v1"))
+		Expect(itms.Spec.ImageTagMirrors).To(Equal(config.Spec.ImageTagMirrors))
+	})
+
+	It("records the pinned release in the manifest", func() {
+		config := &relocationv1alpha1.ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      configName,
+				Namespace: configNamespace,
+			},
+			Spec: relocationv1alpha1.ClusterConfigSpec{
+				ReleaseImage:           "quay.io/openshift-release-dev/ocp-release@sha256:1234",
+				AllowedReleaseVersions: []string{"4.14.3"},
+			},
+		}
+		Expect(c.Create(ctx, config)).To(Succeed())
+
+		key := types.NamespacedName{Namespace: configNamespace, Name: configName}
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+
+		reader, err := isoschema.NewReader(os.DirFS(filepath.Join(dataDir, "namespaces", configNamespace, configName, "files")))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reader.Manifest().Release).To(Equal(&isoschema.Release{
+			Image:           "quay.io/openshift-release-dev/ocp-release@sha256:1234",
+			AllowedVersions: []string{"4.14.3"},
+		}))
+	})
+
+	It("records the image volume in the manifest", func() {
+		config := &relocationv1alpha1.ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      configName,
+				Namespace: configNamespace,
+			},
+			Spec: relocationv1alpha1.ClusterConfigSpec{
+				ImageVolume: &relocationv1alpha1.ImageVolume{
+					Label:    "site-1-config",
+					Metadata: map[string]string{"site": "site-1"},
+				},
+			},
+		}
+		Expect(c.Create(ctx, config)).To(Succeed())
+
+		key := types.NamespacedName{Namespace: configNamespace, Name: configName}
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+
+		reader, err := isoschema.NewReader(os.DirFS(filepath.Join(dataDir, "namespaces", configNamespace, configName, "files")))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reader.Manifest().Label()).To(Equal("site-1-config"))
+		Expect(reader.Manifest().Metadata).To(Equal(map[string]string{"site": "site-1"}))
+	})
+
+	It("renders the network config", func() {
+		Expect(c.Create(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "network", Namespace: configNamespace},
+			Data:       map[string]string{"host-1.yaml": "interfaces: []\n"},
+		})).To(Succeed())
+		config := &relocationv1alpha1.ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      configName,
+				Namespace: configNamespace,
+			},
+			Spec: relocationv1alpha1.ClusterConfigSpec{
+				NetworkConfigRef: &corev1.LocalObjectReference{Name: "network"},
+			},
+		}
+		Expect(c.Create(ctx, config)).To(Succeed())
+
+		key := types.NamespacedName{Namespace: configNamespace, Name: configName}
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+
+		reader, err := isoschema.NewReader(os.DirFS(filepath.Join(dataDir, "namespaces", configNamespace, configName, "files")))
+		Expect(err).NotTo(HaveOccurred())
+		cm := &corev1.ConfigMap{}
+		found, err := reader.ReadObject(isoschema.NetworkConfigFileType, cm)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found).To(BeTrue())
+		Expect(cm.Data).To(Equal(map[string]string{"host-1.yaml": "interfaces: []\n"}))
 	})
 
 	It("creates the referenced secrets", func() {
@@ -153,112 +444,2772 @@ var _ = Describe("Reconcile", func() {
 		validateSecretContent("/api-cert-secret.json", apiCertData)
 		validateSecretContent("/ingress-cert-secret.json", ingressCertData)
 		validateSecretContent("/pull-secret-secret.json", pullSecretData)
-	})
 
-	It("configures a referenced BMH", func() {
-		bmh := &bmh_v1alpha1.BareMetalHost{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      "test-bmh",
-				Namespace: "test-bmh-namespace",
-			},
+		reader, err := isoschema.NewReader(os.DirFS(filepath.Join(dataDir, "namespaces", configNamespace, configName, "files")))
+		Expect(err).NotTo(HaveOccurred())
+		for _, t := range []isoschema.FileType{
+			isoschema.ClusterRelocationFileType,
+			isoschema.APICertSecretFileType,
+			isoschema.IngressCertSecretFileType,
+			isoschema.PullSecretFileType,
+		} {
+			_, found := reader.Manifest().Lookup(t)
+			Expect(found).To(BeTrue(), "missing manifest entry for %s", t)
 		}
-		Expect(c.Create(ctx, bmh)).To(Succeed())
+	})
 
+	It("removes the config data when the config is deleted", func() {
 		config := &relocationv1alpha1.ClusterConfig{
 			ObjectMeta: metav1.ObjectMeta{
 				Name:      configName,
 				Namespace: configNamespace,
 			},
-			Spec: relocationv1alpha1.ClusterConfigSpec{
-				BareMetalHostRef: &relocationv1alpha1.BareMetalHostReference{
-					Name:      bmh.Name,
-					Namespace: bmh.Namespace,
-				},
-			},
 		}
 		Expect(c.Create(ctx, config)).To(Succeed())
 
-		req := ctrl.Request{
-			NamespacedName: types.NamespacedName{
-				Namespace: configNamespace,
+		key := types.NamespacedName{
+			Namespace: configNamespace,
+			Name:      configName,
+		}
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Get(ctx, key, config)).To(Succeed())
+		Expect(config.GetFinalizers()).To(ContainElement(clusterConfigFinalizerName))
+		namespaceDir := filepath.Join(dataDir, "namespaces", configNamespace)
+		Expect(filepath.Join(namespaceDir, configName)).To(BeADirectory())
+
+		Expect(c.Delete(ctx, config)).To(Succeed())
+		res, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res).To(Equal(ctrl.Result{}))
+
+		Expect(namespaceDir).NotTo(BeADirectory())
+		Expect(c.Get(ctx, key, config)).NotTo(Succeed())
+	})
+
+	It("cleans up deleted configs through the deletion queue", func() {
+		r.Deletions = NewDeletionQueue(r, 1)
+		config := &relocationv1alpha1.ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{
 				Name:      configName,
+				Namespace: configNamespace,
 			},
 		}
-		res, err := r.Reconcile(ctx, req)
+		Expect(c.Create(ctx, config)).To(Succeed())
+
+		key := types.NamespacedName{Namespace: configNamespace, Name: configName}
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		namespaceDir := filepath.Join(dataDir, "namespaces", configNamespace)
+
+		Expect(c.Delete(ctx, config)).To(Succeed())
+		res, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
 		Expect(err).NotTo(HaveOccurred())
 		Expect(res).To(Equal(ctrl.Result{}))
 
-		key := types.NamespacedName{
-			Namespace: bmh.Namespace,
-			Name:      bmh.Name,
-		}
-		Expect(c.Get(ctx, key, bmh)).To(Succeed())
-		Expect(bmh.Spec.Image).NotTo(BeNil())
-		Expect(bmh.Spec.Image.URL).To(Equal(fmt.Sprintf("http://service.namespace/images/%s/%s.iso", configNamespace, configName)))
-		Expect(bmh.Spec.Image.DiskFormat).To(HaveValue(Equal("live-iso")))
-		Expect(bmh.Spec.Online).To(BeTrue())
+		// the reconcile only queues the cleanup
+		Expect(r.Deletions.Len()).To(Equal(1))
+		Expect(filepath.Join(namespaceDir, configName)).To(BeADirectory())
+		Expect(c.Get(ctx, key, config)).To(Succeed())
+
+		// queueing again while the cleanup is pending doesn't add a second cleanup
+		_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Deletions.Len()).To(Equal(1))
+
+		Expect(r.Deletions.processNext(ctx)).To(BeTrue())
+		Expect(r.Deletions.Len()).To(Equal(0))
+		Expect(namespaceDir).NotTo(BeADirectory())
+		Expect(c.Get(ctx, key, config)).NotTo(Succeed())
 	})
-})
 
-var _ = Describe("mapBMHToCC", func() {
-	var (
-		c               client.Client
-		r               *ClusterConfigReconciler
-		ctx             = context.Background()
-		configName      = "test-config"
-		configNamespace = "test-namespace"
-	)
+	Context("when the host namespace of a deleted config is torn down", func() {
+		var (
+			key      = types.NamespacedName{Namespace: configNamespace, Name: configName}
+			bmhKey   = types.NamespacedName{Namespace: "test-bmh-namespace", Name: "test-bmh"}
+			ns       *corev1.Namespace
+			recorder *record.FakeRecorder
+		)
 
-	BeforeEach(func() {
-		c = fakeclient.NewClientBuilder().
-			WithScheme(scheme.Scheme).
-			WithStatusSubresource(&relocationv1alpha1.ClusterConfig{}).
-			Build()
+		BeforeEach(func() {
+			recorder = record.NewFakeRecorder(10)
+			r.Notifier = &report.Notifier{Recorder: recorder}
+			ns = &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: bmhKey.Namespace}}
+			Expect(c.Create(ctx, ns)).To(Succeed())
+			createSecret("pull-secret", map[string][]byte{".dockerconfigjson": []byte("{}")})
+			bmh := &bmh_v1alpha1.BareMetalHost{ObjectMeta: metav1.ObjectMeta{
+				Name:        bmhKey.Name,
+				Namespace:   bmhKey.Namespace,
+				Annotations: map[string]string{relocationv1alpha1.ClusterConfigAnnotation: key.String()},
+			}}
+			Expect(c.Create(ctx, bmh)).To(Succeed())
+			config := &relocationv1alpha1.ClusterConfig{
+				ObjectMeta: metav1.ObjectMeta{Name: configName, Namespace: configNamespace},
+				Spec: relocationv1alpha1.ClusterConfigSpec{
+					ClusterRelocationSpec: cro.ClusterRelocationSpec{
+						Domain:        "thing.example.com",
+						PullSecretRef: &corev1.SecretReference{Name: "pull-secret", Namespace: configNamespace},
+					},
+					BareMetalHostRef: &relocationv1alpha1.BareMetalHostReference{Name: bmh.Name, Namespace: bmh.Namespace},
+				},
+			}
+			Expect(c.Create(ctx, config)).To(Succeed())
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c.Delete(ctx, config)).To(Succeed())
+		})
 
-		r = &ClusterConfigReconciler{
-			Client: c,
-			Scheme: scheme.Scheme,
-			Log:    logrus.New(),
+		terminateNamespace := func() {
+			ns.Status.Phase = corev1.NamespaceTerminating
+			Expect(c.Status().Update(ctx, ns)).To(Succeed())
 		}
-	})
 
-	It("returns a request for the cluster config referencing the given BMH", func() {
-		bmh := &bmh_v1alpha1.BareMetalHost{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      "test-bmh",
-				Namespace: "test-bmh-namespace",
-			},
+		failHostPatches := func() {
+			r.Client = interceptor.NewClient(c.(client.WithWatch), interceptor.Funcs{
+				Patch: func(ctx context.Context, client client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+					if _, ok := obj.(*bmh_v1alpha1.BareMetalHost); ok {
+						return apierrors.NewForbidden(schema.GroupResource{Group: "metal3.io", Resource: "baremetalhosts"}, obj.GetName(), fmt.Errorf("denied"))
+					}
+					return client.Patch(ctx, obj, patch, opts...)
+				},
+			})
 		}
-		Expect(c.Create(ctx, bmh)).To(Succeed())
+
+		It("removes the finalizer once the secrets and host are gone", func() {
+			terminateNamespace()
+			Expect(c.Delete(ctx, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "pull-secret", Namespace: configNamespace}})).To(Succeed())
+			Expect(c.Delete(ctx, &bmh_v1alpha1.BareMetalHost{ObjectMeta: metav1.ObjectMeta{Name: bmhKey.Name, Namespace: bmhKey.Namespace}})).To(Succeed())
+
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c.Get(ctx, key, &relocationv1alpha1.ClusterConfig{})).To(MatchError(ContainSubstring("not found")))
+			Expect(filepath.Join(dataDir, "namespaces", configNamespace)).NotTo(BeADirectory())
+			Expect(recorder.Events).To(BeEmpty())
+		})
+
+		It("removes the finalizer when the host can't be cleaned up in a terminating namespace", func() {
+			terminateNamespace()
+			failHostPatches()
+
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c.Get(ctx, key, &relocationv1alpha1.ClusterConfig{})).To(MatchError(ContainSubstring("not found")))
+			Expect(recorder.Events).To(Receive(HavePrefix("Warning CleanupSkipped removing the finalizer without cleaning up: failed to remove BareMetalHost owner annotation")))
+		})
+
+		It("keeps the finalizer when only the config namespace is terminating", func() {
+			configNS := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: configNamespace}}
+			Expect(c.Create(ctx, configNS)).To(Succeed())
+			configNS.Status.Phase = corev1.NamespaceTerminating
+			Expect(c.Status().Update(ctx, configNS)).To(Succeed())
+			failHostPatches()
+
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(apierrors.IsForbidden(err)).To(BeTrue())
+			config := &relocationv1alpha1.ClusterConfig{}
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			Expect(config.GetFinalizers()).To(ContainElement(clusterConfigFinalizerName))
+		})
+
+		It("keeps the finalizer in an active namespace until cleanup is forced", func() {
+			failHostPatches()
+
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(apierrors.IsForbidden(err)).To(BeTrue())
+			config := &relocationv1alpha1.ClusterConfig{}
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			Expect(config.GetFinalizers()).To(ContainElement(clusterConfigFinalizerName))
+			Expect(recorder.Events).To(BeEmpty())
+
+			config.Annotations = map[string]string{relocationv1alpha1.ForceCleanupAnnotation: "true"}
+			Expect(c.Update(ctx, config)).To(Succeed())
+			_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c.Get(ctx, key, config)).To(MatchError(ContainSubstring("not found")))
+			Expect(recorder.Events).To(Receive(ContainSubstring("CleanupSkipped")))
+		})
+	})
+
+	It("stops writing once the data dir lease is taken over", func() {
+		var err error
+		r.Lease, err = filelock.AcquireLease(dataDir, "old")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = filelock.AcquireLease(dataDir, "new")
+		Expect(err).NotTo(HaveOccurred())
 
 		config := &relocationv1alpha1.ClusterConfig{
 			ObjectMeta: metav1.ObjectMeta{
 				Name:      configName,
 				Namespace: configNamespace,
 			},
-			Spec: relocationv1alpha1.ClusterConfigSpec{
-				BareMetalHostRef: &relocationv1alpha1.BareMetalHostReference{
-					Name:      bmh.Name,
-					Namespace: bmh.Namespace,
-				},
-			},
 		}
 		Expect(c.Create(ctx, config)).To(Succeed())
 
-		config = &relocationv1alpha1.ClusterConfig{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      "other-config",
-				Namespace: configNamespace,
-			},
+		key := types.NamespacedName{
+			Namespace: configNamespace,
+			Name:      configName,
 		}
-		Expect(c.Create(ctx, config)).To(Succeed())
+		_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).To(MatchError(filelock.ErrLeaseLost))
+		Expect(filepath.Join(dataDir, "namespaces", configNamespace, configName, "files", "cluster-relocation.json")).NotTo(BeAnExistingFile())
+	})
 
-		requests := r.mapBMHToCC(ctx, bmh)
-		Expect(len(requests)).To(Equal(1))
-		Expect(requests[0].NamespacedName).To(Equal(types.NamespacedName{
-			Name:      configName,
-			Namespace: configNamespace,
-		}))
+	Context("when the relocation has completed", func() {
+		var (
+			bmh    *bmh_v1alpha1.BareMetalHost
+			config *relocationv1alpha1.ClusterConfig
+			key    = types.NamespacedName{Namespace: configNamespace, Name: configName}
+		)
+
+		createCompletedConfig := func(policy relocationv1alpha1.CleanupPolicy) {
+			bmh = &bmh_v1alpha1.BareMetalHost{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-bmh",
+					Namespace: "test-bmh-namespace",
+				},
+			}
+			Expect(c.Create(ctx, bmh)).To(Succeed())
+
+			config = &relocationv1alpha1.ClusterConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      configName,
+					Namespace: configNamespace,
+				},
+				Spec: relocationv1alpha1.ClusterConfigSpec{
+					BareMetalHostRef: &relocationv1alpha1.BareMetalHostReference{
+						Name:      bmh.Name,
+						Namespace: bmh.Namespace,
+					},
+					CleanupPolicy: policy,
+				},
+			}
+			Expect(c.Create(ctx, config)).To(Succeed())
+
+			// initial reconcile attaches the image
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c.Get(ctx, client.ObjectKeyFromObject(bmh), bmh)).To(Succeed())
+			Expect(bmh.Spec.Image).NotTo(BeNil())
+
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			meta.SetStatusCondition(&config.Status.Conditions, metav1.Condition{
+				Type:   relocationv1alpha1.RelocationCompletedCondition,
+				Status: metav1.ConditionTrue,
+				Reason: "Reported",
+			})
+			Expect(c.Status().Update(ctx, config)).To(Succeed())
+		}
+
+		It("leaves everything in place with the None policy", func() {
+			createCompletedConfig(relocationv1alpha1.CleanupPolicyNone)
+
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(c.Get(ctx, client.ObjectKeyFromObject(bmh), bmh)).To(Succeed())
+			Expect(bmh.Spec.Image).NotTo(BeNil())
+			Expect(filepath.Join(dataDir, "namespaces", configNamespace, configName)).To(BeADirectory())
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			Expect(config.Status.Phase).To(Equal(relocationv1alpha1.ClusterConfigPhaseCompleted))
+		})
+
+		It("detaches the image and removes the data with the DetachImage policy", func() {
+			createCompletedConfig(relocationv1alpha1.CleanupPolicyDetachImage)
+
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(c.Get(ctx, client.ObjectKeyFromObject(bmh), bmh)).To(Succeed())
+			Expect(bmh.Spec.Image).To(BeNil())
+			Expect(filepath.Join(dataDir, "namespaces", configNamespace, configName)).NotTo(BeADirectory())
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+		})
+
+		It("deletes the config with the DeleteClusterConfig policy", func() {
+			createCompletedConfig(relocationv1alpha1.CleanupPolicyDeleteClusterConfig)
+
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			// the finalizer removes the data on the next reconcile
+			_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(c.Get(ctx, key, config)).NotTo(Succeed())
+			Expect(filepath.Join(dataDir, "namespaces", configNamespace)).NotTo(BeADirectory())
+		})
+
+		Context("with completion hooks", func() {
+			addHooks := func() {
+				Expect(c.Get(ctx, key, config)).To(Succeed())
+				config.Spec.PostCompletionHooks = []relocationv1alpha1.CompletionHook{{
+					Name: "inventory",
+					Template: batchv1.JobTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "inventory"}},
+						Spec: batchv1.JobSpec{
+							Template: corev1.PodTemplateSpec{
+								Spec: corev1.PodSpec{
+									RestartPolicy: corev1.RestartPolicyNever,
+									Containers: []corev1.Container{{
+										Name:  "update",
+										Image: "quay.io/example/inventory:latest",
+										Env:   []corev1.EnvVar{{Name: "INVENTORY_URL", Value: "https://inventory.example.com"}},
+									}},
+								},
+							},
+						},
+					},
+				}}
+				Expect(c.Update(ctx, config)).To(Succeed())
+			}
+			jobKey := types.NamespacedName{Namespace: configNamespace, Name: configName + "-inventory"}
+
+			It("runs each hook once", func() {
+				createCompletedConfig(relocationv1alpha1.CleanupPolicyNone)
+				addHooks()
+
+				_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+				Expect(err).NotTo(HaveOccurred())
+
+				job := &batchv1.Job{}
+				Expect(c.Get(ctx, jobKey, job)).To(Succeed())
+				Expect(job.Labels).To(HaveKeyWithValue("app", "inventory"))
+				Expect(job.Labels).To(HaveKeyWithValue(relocationv1alpha1.CompletionHookClusterConfigLabel, configName))
+				Expect(job.OwnerReferences).To(BeEmpty())
+				Expect(job.Spec.Template.Spec.ServiceAccountName).To(Equal(relocationv1alpha1.CompletionHookServiceAccount))
+				Expect(job.Spec.Template.Spec.Containers[0].Env).To(ConsistOf(
+					corev1.EnvVar{Name: "INVENTORY_URL", Value: "https://inventory.example.com"},
+					corev1.EnvVar{Name: "CLUSTER_CONFIG_NAME", Value: configName},
+					corev1.EnvVar{Name: "CLUSTER_CONFIG_NAMESPACE", Value: configNamespace},
+				))
+
+				Expect(c.Get(ctx, key, config)).To(Succeed())
+				Expect(config.Status.CompletionHooks).To(HaveLen(1))
+				Expect(config.Status.CompletionHooks[0].Name).To(Equal("inventory"))
+				Expect(config.Status.CompletionHooks[0].JobName).To(Equal(jobKey.Name))
+
+				// a finished Job removed by its TTL isn't created again
+				Expect(c.Delete(ctx, job)).To(Succeed())
+				_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(c.Get(ctx, jobKey, job)).NotTo(Succeed())
+			})
+
+			It("doesn't run hooks before the relocation completes", func() {
+				createCompletedConfig(relocationv1alpha1.CleanupPolicyNone)
+				Expect(c.Get(ctx, key, config)).To(Succeed())
+				meta.RemoveStatusCondition(&config.Status.Conditions, relocationv1alpha1.RelocationCompletedCondition)
+				Expect(c.Status().Update(ctx, config)).To(Succeed())
+				addHooks()
+
+				_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(c.Get(ctx, jobKey, &batchv1.Job{})).NotTo(Succeed())
+			})
+
+			It("runs hooks before the config is deleted", func() {
+				createCompletedConfig(relocationv1alpha1.CleanupPolicyDeleteClusterConfig)
+				addHooks()
+
+				_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+				Expect(err).NotTo(HaveOccurred())
+				_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(c.Get(ctx, key, config)).NotTo(Succeed())
+				Expect(c.Get(ctx, jobKey, &batchv1.Job{})).To(Succeed())
+			})
+
+			It("doesn't create hooks with host access", func() {
+				createCompletedConfig(relocationv1alpha1.CleanupPolicyNone)
+				addHooks()
+				Expect(c.Get(ctx, key, config)).To(Succeed())
+				config.Spec.PostCompletionHooks[0].Template.Spec.Template.Spec.HostNetwork = true
+				Expect(c.Update(ctx, config)).To(Succeed())
+
+				_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+				Expect(err).To(HaveOccurred())
+				Expect(c.Get(ctx, jobKey, &batchv1.Job{})).NotTo(Succeed())
+			})
+		})
+	})
+
+	It("shares identical files between configs", func() {
+		r.Blobs = &dedup.Store{Dir: filepath.Join(dataDir, "blobs")}
+		createSecret("pull-secret", map[string][]byte{".dockerconfigjson": []byte("{}")})
+
+		for _, name := range []string{"site-1", "site-2"} {
+			config := &relocationv1alpha1.ClusterConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      name,
+					Namespace: configNamespace,
+				},
+				Spec: relocationv1alpha1.ClusterConfigSpec{
+					ClusterRelocationSpec: cro.ClusterRelocationSpec{
+						Domain:        name + ".example.com",
+						PullSecretRef: &corev1.SecretReference{Name: "pull-secret", Namespace: configNamespace},
+					},
+				},
+			}
+			Expect(c.Create(ctx, config)).To(Succeed())
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(config)})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		stat := func(name, file string) os.FileInfo {
+			info, err := os.Stat(filepath.Join(dataDir, "namespaces", configNamespace, name, "files", file))
+			Expect(err).NotTo(HaveOccurred())
+			return info
+		}
+		Expect(os.SameFile(stat("site-1", "pull-secret-secret.json"), stat("site-2", "pull-secret-secret.json"))).To(BeTrue())
+		Expect(os.SameFile(stat("site-1", "cluster-relocation.json"), stat("site-2", "cluster-relocation.json"))).To(BeFalse())
+	})
+
+	It("writes configs to the namespace's data dir shard", func() {
+		shards := []string{filepath.Join(dataDir, "shard-0"), filepath.Join(dataDir, "shard-1")}
+		r.Options.DataDirShards = shards
+		r.Blobs = &dedup.Store{Dir: filepath.Join(dataDir, "blobs")}
+		createSecret("pull-secret", map[string][]byte{".dockerconfigjson": []byte("{}")})
+
+		config := &relocationv1alpha1.ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      configName,
+				Namespace: configNamespace,
+			},
+			Spec: relocationv1alpha1.ClusterConfigSpec{
+				ClusterRelocationSpec: cro.ClusterRelocationSpec{
+					Domain:        "thing.example.com",
+					PullSecretRef: &corev1.SecretReference{Name: "pull-secret", Namespace: configNamespace},
+				},
+			},
+		}
+		Expect(c.Create(ctx, config)).To(Succeed())
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(config)})
+		Expect(err).NotTo(HaveOccurred())
+
+		shard := datadir.For(shards, configNamespace)
+		Expect(filepath.Join(shard, "namespaces", configNamespace, configName, "files", "cluster-relocation.json")).To(BeARegularFile())
+		Expect(filepath.Join(dataDir, "namespaces")).NotTo(BeADirectory())
+
+		// shared files stay on the shard's volume
+		entries, err := os.ReadDir(filepath.Join(shard, "blobs"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).NotTo(BeEmpty())
+		Expect(filepath.Join(dataDir, "blobs")).NotTo(BeADirectory())
+	})
+
+	It("does not rewrite files when nothing changed", func() {
+		createSecret("pull-secret", map[string][]byte{".dockerconfigjson": []byte("{}")})
+		config := &relocationv1alpha1.ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      configName,
+				Namespace: configNamespace,
+			},
+			Spec: relocationv1alpha1.ClusterConfigSpec{
+				ClusterRelocationSpec: cro.ClusterRelocationSpec{
+					Domain:        "thing.example.com",
+					PullSecretRef: &corev1.SecretReference{Name: "pull-secret", Namespace: configNamespace},
+				},
+			},
+		}
+		Expect(c.Create(ctx, config)).To(Succeed())
+		req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(config)}
+
+		stat := func(file string) os.FileInfo {
+			info, err := os.Stat(filepath.Join(dataDir, "namespaces", configNamespace, configName, "files", file))
+			Expect(err).NotTo(HaveOccurred())
+			return info
+		}
+		_, err := r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		before := []os.FileInfo{stat("manifest.json"), stat("pull-secret-secret.json"), stat("cluster-relocation.json")}
+
+		_, err = r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		after := []os.FileInfo{stat("manifest.json"), stat("pull-secret-secret.json"), stat("cluster-relocation.json")}
+		for i := range before {
+			Expect(os.SameFile(before[i], after[i])).To(BeTrue(), before[i].Name())
+			Expect(before[i].ModTime()).To(Equal(after[i].ModTime()))
+		}
+	})
+
+	It("records a redacted diff when the payload changes", func() {
+		createSecret("pull-secret", map[string][]byte{".dockerconfigjson": []byte("{}")})
+		config := &relocationv1alpha1.ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      configName,
+				Namespace: configNamespace,
+			},
+			Spec: relocationv1alpha1.ClusterConfigSpec{
+				ClusterRelocationSpec: cro.ClusterRelocationSpec{
+					Domain:        "thing.example.com",
+					PullSecretRef: &corev1.SecretReference{Name: "pull-secret", Namespace: configNamespace},
+				},
+			},
+		}
+		Expect(c.Create(ctx, config)).To(Succeed())
+		req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(config)}
+
+		_, err := r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Get(ctx, req.NamespacedName, config)).To(Succeed())
+		Expect(config.Status.PayloadDiff).To(BeNil())
+
+		config.Spec.Domain = "other.example.com"
+		Expect(c.Update(ctx, config)).To(Succeed())
+		secret := &corev1.Secret{}
+		Expect(c.Get(ctx, types.NamespacedName{Name: "pull-secret", Namespace: configNamespace}, secret)).To(Succeed())
+		secret.Data[".dockerconfigjson"] = []byte(`{"auths": {}}`)
+		Expect(c.Update(ctx, secret)).To(Succeed())
+
+		_, err = r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Get(ctx, req.NamespacedName, config)).To(Succeed())
+		diff := config.Status.PayloadDiff
+		Expect(diff).NotTo(BeNil())
+		Expect(diff.PayloadHash).To(Equal(config.Status.PayloadHash))
+		Expect(diff.Changes).To(ContainElement(relocationv1alpha1.PayloadChange{
+			FileType:  string(isoschema.ClusterRelocationFileType),
+			Path:      "spec.domain",
+			Operation: relocationv1alpha1.PayloadChangeModified,
+			Old:       `"thing.example.com"`,
+			New:       `"other.example.com"`,
+		}))
+		Expect(diff.Changes).To(ContainElement(relocationv1alpha1.PayloadChange{
+			FileType:  string(isoschema.PullSecretFileType),
+			Path:      `data[".dockerconfigjson"]`,
+			Operation: relocationv1alpha1.PayloadChangeModified,
+			Redacted:  true,
+		}))
+	})
+
+	It("doesn't modify the data dir in read-only mode", func() {
+		config := &relocationv1alpha1.ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      configName,
+				Namespace: configNamespace,
+			},
+			Spec: relocationv1alpha1.ClusterConfigSpec{
+				ClusterRelocationSpec: cro.ClusterRelocationSpec{Domain: "thing.example.com"},
+			},
+		}
+		Expect(c.Create(ctx, config)).To(Succeed())
+		req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(config)}
+		_, err := r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		configDir := filepath.Join(dataDir, "namespaces", configNamespace, configName)
+		Expect(configDir).To(BeADirectory())
+
+		r.Options.ReadOnly = true
+		Expect(c.Get(ctx, req.NamespacedName, config)).To(Succeed())
+		Expect(c.Delete(ctx, config)).To(Succeed())
+		_, err = r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(configDir).To(BeADirectory())
+		Expect(c.Get(ctx, req.NamespacedName, config)).To(Succeed())
+		Expect(config.Finalizers).To(ContainElement(clusterConfigFinalizerName))
+
+		r.Options.ReadOnly = false
+		_, err = r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(configDir).NotTo(BeADirectory())
+	})
+
+	Context("with a payload size limit", func() {
+		var key = types.NamespacedName{Namespace: configNamespace, Name: configName}
+
+		createConfig := func() *relocationv1alpha1.ClusterConfig {
+			bmh := &bmh_v1alpha1.BareMetalHost{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-bmh",
+					Namespace: "test-bmh-namespace",
+				},
+			}
+			Expect(c.Create(ctx, bmh)).To(Succeed())
+			createSecret("pull-secret", map[string][]byte{".dockerconfigjson": bytes.Repeat([]byte("a"), 2048)})
+
+			config := &relocationv1alpha1.ClusterConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      configName,
+					Namespace: configNamespace,
+				},
+				Spec: relocationv1alpha1.ClusterConfigSpec{
+					ClusterRelocationSpec: cro.ClusterRelocationSpec{
+						Domain:        "thing.example.com",
+						PullSecretRef: &corev1.SecretReference{Name: "pull-secret", Namespace: configNamespace},
+					},
+					BareMetalHostRef: &relocationv1alpha1.BareMetalHostReference{Name: bmh.Name, Namespace: bmh.Namespace},
+				},
+			}
+			Expect(c.Create(ctx, config)).To(Succeed())
+			return config
+		}
+
+		It("rejects payloads over the limit", func() {
+			r.Options.MaxPayloadSize = 1024
+			createConfig()
+
+			res, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res).To(Equal(ctrl.Result{}))
+
+			config := &relocationv1alpha1.ClusterConfig{}
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			cond := meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.PayloadWithinSizeLimitCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Reason).To(Equal(relocationv1alpha1.PayloadTooLargeReason))
+			Expect(cond.Message).To(ContainSubstring("exceeds the limit of 1024 bytes"))
+			Expect(cond.Message).To(MatchRegexp("PullSecret: [0-9]+ bytes, ClusterRelocation"))
+			cond = meta.FindStatusCondition(config.Status.Conditions, cro.ConditionTypeReconciled)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Reason).To(Equal(cro.ValidationFailedReason))
+
+			Expect(filepath.Join(dataDir, "namespaces", configNamespace, configName, "files")).NotTo(BeADirectory())
+			bmh := &bmh_v1alpha1.BareMetalHost{}
+			Expect(c.Get(ctx, types.NamespacedName{Name: "test-bmh", Namespace: "test-bmh-namespace"}, bmh)).To(Succeed())
+			Expect(bmh.Spec.Image).To(BeNil())
+		})
+
+		It("counts the ISO structures around the files", func() {
+			// the files are a few KB but the system area alone takes 32KB
+			r.Options.MaxPayloadSize = 32 * 1024
+			createConfig()
+
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+
+			config := &relocationv1alpha1.ClusterConfig{}
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			cond := meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.PayloadWithinSizeLimitCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Reason).To(Equal(relocationv1alpha1.PayloadTooLargeReason))
+			Expect(cond.Message).To(MatchRegexp("^image size [0-9]+ bytes exceeds the limit of 32768 bytes"))
+		})
+
+		It("serves payloads within the limit", func() {
+			r.Options.MaxPayloadSize = 1024 * 1024
+			createConfig()
+
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+
+			config := &relocationv1alpha1.ClusterConfig{}
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			Expect(meta.IsStatusConditionTrue(config.Status.Conditions, relocationv1alpha1.PayloadWithinSizeLimitCondition)).To(BeTrue())
+			Expect(config.Status.Phase).To(Equal(relocationv1alpha1.ClusterConfigPhaseImageAttached))
+		})
+	})
+
+	Context("adopting existing data", func() {
+		var (
+			key      = types.NamespacedName{Namespace: configNamespace, Name: configName}
+			filesDir string
+		)
+
+		BeforeEach(func() {
+			filesDir = filepath.Join(dataDir, "namespaces", configNamespace, configName, "files")
+			Expect(os.MkdirAll(filesDir, 0700)).To(Succeed())
+			bmh := &bmh_v1alpha1.BareMetalHost{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-bmh",
+					Namespace: "test-bmh-namespace",
+				},
+			}
+			Expect(c.Create(ctx, bmh)).To(Succeed())
+			config := &relocationv1alpha1.ClusterConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      configName,
+					Namespace: configNamespace,
+				},
+				Spec: relocationv1alpha1.ClusterConfigSpec{
+					ClusterRelocationSpec: cro.ClusterRelocationSpec{Domain: "lab.example.com"},
+					BareMetalHostRef:      &relocationv1alpha1.BareMetalHostReference{Name: bmh.Name, Namespace: bmh.Namespace},
+					AdoptExistingData:     true,
+				},
+			}
+			Expect(c.Create(ctx, config)).To(Succeed())
+		})
+
+		writeLabPayload := func() string {
+			w := isoschema.NewWriter(filesDir)
+			Expect(w.WriteObject(isoschema.PullSecretFileType, &corev1.Secret{Data: map[string][]byte{".dockerconfigjson": []byte("{}")}})).To(Succeed())
+			Expect(w.WriteObject(isoschema.ClusterRelocationFileType, &cro.ClusterRelocation{Spec: cro.ClusterRelocationSpec{Domain: "lab.example.com"}})).To(Succeed())
+			Expect(w.WriteManifest()).To(Succeed())
+			return w.Hash()
+		}
+
+		It("serves the existing payload without rendering the configuration", func() {
+			hash := writeLabPayload()
+			pullSecret, err := os.ReadFile(filepath.Join(filesDir, isoschema.FileName(isoschema.PullSecretFileType)))
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+
+			config := &relocationv1alpha1.ClusterConfig{}
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			Expect(config.Status.PayloadHash).To(Equal(hash))
+			Expect(meta.IsStatusConditionTrue(config.Status.Conditions, cro.ConditionTypeReconciled)).To(BeTrue())
+			Expect(config.Status.Phase).To(Equal(relocationv1alpha1.ClusterConfigPhaseImageAttached))
+
+			// the config doesn't reference a pull secret but the adopted one is kept
+			content, err := os.ReadFile(filepath.Join(filesDir, isoschema.FileName(isoschema.PullSecretFileType)))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(content).To(Equal(pullSecret))
+		})
+
+		It("doesn't serve modified files", func() {
+			writeLabPayload()
+			Expect(os.WriteFile(filepath.Join(filesDir, isoschema.FileName(isoschema.PullSecretFileType)), []byte(`{"tampered": true}`), 0600)).To(Succeed())
+
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).To(MatchError(ContainSubstring("failed to adopt existing data")))
+
+			config := &relocationv1alpha1.ClusterConfig{}
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			cond := meta.FindStatusCondition(config.Status.Conditions, cro.ConditionTypeReconciled)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(config.Status.PayloadHash).To(BeEmpty())
+			bmh := &bmh_v1alpha1.BareMetalHost{}
+			Expect(c.Get(ctx, types.NamespacedName{Name: "test-bmh", Namespace: "test-bmh-namespace"}, bmh)).To(Succeed())
+			Expect(bmh.Spec.Image).To(BeNil())
+		})
+
+		It("doesn't serve symbolic links or files missing from the manifest", func() {
+			writeLabPayload()
+			Expect(os.Symlink("/etc/hostname", filepath.Join(filesDir, "hostname"))).To(Succeed())
+
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).To(MatchError(ContainSubstring("hostname is not a regular file")))
+
+			Expect(os.Remove(filepath.Join(filesDir, "hostname"))).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(filesDir, "extra.json"), []byte("{}"), 0600)).To(Succeed())
+			_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).To(MatchError(ContainSubstring("extra.json is not listed in the manifest")))
+		})
+
+		It("fails without a payload manifest", func() {
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).To(MatchError(ContainSubstring("failed to read manifest")))
+		})
+	})
+
+	Context("with a plain HTTP image URL", func() {
+		var key = types.NamespacedName{Namespace: configNamespace, Name: configName}
+
+		BeforeEach(func() {
+			r.BaseURL = "http://service.namespace"
+		})
+
+		createConfig := func(spec cro.ClusterRelocationSpec, allowInsecure bool) {
+			bmh := &bmh_v1alpha1.BareMetalHost{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-bmh",
+					Namespace: "test-bmh-namespace",
+				},
+			}
+			Expect(c.Create(ctx, bmh)).To(Succeed())
+			config := &relocationv1alpha1.ClusterConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      configName,
+					Namespace: configNamespace,
+				},
+				Spec: relocationv1alpha1.ClusterConfigSpec{
+					ClusterRelocationSpec: spec,
+					BareMetalHostRef:      &relocationv1alpha1.BareMetalHostReference{Name: bmh.Name, Namespace: bmh.Namespace},
+					AllowInsecureImageURL: allowInsecure,
+				},
+			}
+			Expect(c.Create(ctx, config)).To(Succeed())
+		}
+
+		It("refuses to embed a pull secret", func() {
+			createSecret("pull-secret", map[string][]byte{".dockerconfigjson": []byte("{}")})
+			createConfig(cro.ClusterRelocationSpec{
+				Domain:        "thing.example.com",
+				PullSecretRef: &corev1.SecretReference{Name: "pull-secret", Namespace: configNamespace},
+			}, false)
+
+			res, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res).To(Equal(ctrl.Result{}))
+
+			config := &relocationv1alpha1.ClusterConfig{}
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			cond := meta.FindStatusCondition(config.Status.Conditions, cro.ConditionTypeReconciled)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Reason).To(Equal(relocationv1alpha1.InsecureImageURLReason))
+			Expect(cond.Message).To(ContainSubstring("refusing to embed pull secrets in an image served over plain HTTP from http://service.namespace"))
+
+			Expect(filepath.Join(dataDir, "namespaces", configNamespace, configName, "files")).NotTo(BeADirectory())
+			bmh := &bmh_v1alpha1.BareMetalHost{}
+			Expect(c.Get(ctx, types.NamespacedName{Name: "test-bmh", Namespace: "test-bmh-namespace"}, bmh)).To(Succeed())
+			Expect(bmh.Spec.Image).To(BeNil())
+		})
+
+		It("embeds credentials when insecure image URLs are allowed", func() {
+			createSecret("pull-secret", map[string][]byte{".dockerconfigjson": []byte("{}")})
+			createConfig(cro.ClusterRelocationSpec{
+				Domain:        "thing.example.com",
+				PullSecretRef: &corev1.SecretReference{Name: "pull-secret", Namespace: configNamespace},
+			}, true)
+
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+
+			config := &relocationv1alpha1.ClusterConfig{}
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			Expect(meta.IsStatusConditionTrue(config.Status.Conditions, cro.ConditionTypeReconciled)).To(BeTrue())
+			Expect(config.Status.Phase).To(Equal(relocationv1alpha1.ClusterConfigPhaseImageAttached))
+		})
+
+		It("serves configurations without credentials", func() {
+			createConfig(cro.ClusterRelocationSpec{Domain: "thing.example.com"}, false)
+
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+
+			config := &relocationv1alpha1.ClusterConfig{}
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			Expect(meta.IsStatusConditionTrue(config.Status.Conditions, cro.ConditionTypeReconciled)).To(BeTrue())
+			Expect(config.Status.Phase).To(Equal(relocationv1alpha1.ClusterConfigPhaseImageAttached))
+		})
+	})
+
+	It("uses the ClusterRelocation reason when a referenced secret can't be rendered", func() {
+		config := &relocationv1alpha1.ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      configName,
+				Namespace: configNamespace,
+			},
+			Spec: relocationv1alpha1.ClusterConfigSpec{
+				ClusterRelocationSpec: cro.ClusterRelocationSpec{
+					Domain:        "thing.example.com",
+					PullSecretRef: &corev1.SecretReference{Name: "missing", Namespace: configNamespace},
+				},
+			},
+		}
+		Expect(c.Create(ctx, config)).To(Succeed())
+
+		key := types.NamespacedName{Namespace: configNamespace, Name: configName}
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).To(HaveOccurred())
+
+		Expect(c.Get(ctx, key, config)).To(Succeed())
+		cond := meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.ReconciledCondition)
+		Expect(cond).NotTo(BeNil())
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Reason).To(Equal(cro.PullSecretReconciliationFailedReason))
+		Expect(cond.Message).To(ContainSubstring("missing"))
+
+		createSecret("missing", map[string][]byte{".dockerconfigjson": []byte("{}")})
+		_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(c.Get(ctx, key, config)).To(Succeed())
+		cond = meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.ReconciledCondition)
+		Expect(cond).NotTo(BeNil())
+		Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+		Expect(cond.Reason).To(Equal(cro.ReconciliationSucceededReason))
+		Expect(cond.ObservedGeneration).To(Equal(config.Generation))
+	})
+
+	It("succeeds when the config no longer exists", func() {
+		key := types.NamespacedName{
+			Namespace: configNamespace,
+			Name:      configName,
+		}
+		res, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res).To(Equal(ctrl.Result{}))
+	})
+
+	It("configures a referenced BMH", func() {
+		bmh := &bmh_v1alpha1.BareMetalHost{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-bmh",
+				Namespace: "test-bmh-namespace",
+			},
+		}
+		Expect(c.Create(ctx, bmh)).To(Succeed())
+
+		config := &relocationv1alpha1.ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      configName,
+				Namespace: configNamespace,
+			},
+			Spec: relocationv1alpha1.ClusterConfigSpec{
+				BareMetalHostRef: &relocationv1alpha1.BareMetalHostReference{
+					Name:      bmh.Name,
+					Namespace: bmh.Namespace,
+				},
+			},
+		}
+		Expect(c.Create(ctx, config)).To(Succeed())
+
+		req := ctrl.Request{
+			NamespacedName: types.NamespacedName{
+				Namespace: configNamespace,
+				Name:      configName,
+			},
+		}
+		res, err := r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res).To(Equal(ctrl.Result{}))
+
+		key := types.NamespacedName{
+			Namespace: bmh.Namespace,
+			Name:      bmh.Name,
+		}
+		Expect(c.Get(ctx, key, bmh)).To(Succeed())
+		Expect(bmh.Spec.Image).NotTo(BeNil())
+		Expect(bmh.Spec.Image.URL).To(Equal(fmt.Sprintf("https://service.namespace/images/%s/%s.iso", configNamespace, configName)))
+		Expect(bmh.Spec.Image.DiskFormat).To(HaveValue(Equal("live-iso")))
+		Expect(bmh.Spec.Online).To(BeTrue())
+		Expect(bmh.Labels).To(HaveKeyWithValue(relocationv1alpha1.ReferencedBareMetalHostLabel, "true"))
+
+		Expect(c.Get(ctx, req.NamespacedName, config)).To(Succeed())
+		Expect(config.Status.Phase).To(Equal(relocationv1alpha1.ClusterConfigPhaseImageAttached))
+	})
+
+	It("doesn't attach the image to a host claimed by a ClusterDeprovision", func() {
+		bmh := &bmh_v1alpha1.BareMetalHost{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "test-bmh",
+				Namespace:   "test-bmh-namespace",
+				Annotations: map[string]string{relocationv1alpha1.ClusterDeprovisionAnnotation: "test-bmh-namespace/wipe"},
+			},
+		}
+		Expect(c.Create(ctx, bmh)).To(Succeed())
+
+		config := &relocationv1alpha1.ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      configName,
+				Namespace: configNamespace,
+			},
+			Spec: relocationv1alpha1.ClusterConfigSpec{
+				BareMetalHostRef: &relocationv1alpha1.BareMetalHostReference{Name: bmh.Name, Namespace: bmh.Namespace},
+			},
+		}
+		Expect(c.Create(ctx, config)).To(Succeed())
+
+		req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: configNamespace, Name: configName}}
+		_, err := r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(bmh), bmh)).To(Succeed())
+		Expect(bmh.Spec.Image).To(BeNil())
+		Expect(c.Get(ctx, req.NamespacedName, config)).To(Succeed())
+		Expect(config.Status.Phase).To(Equal(relocationv1alpha1.ClusterConfigPhaseImageReady))
+	})
+
+	It("attaches an external image without rendering the configuration", func() {
+		bmh := &bmh_v1alpha1.BareMetalHost{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-bmh",
+				Namespace: "test-bmh-namespace",
+			},
+		}
+		Expect(c.Create(ctx, bmh)).To(Succeed())
+
+		config := &relocationv1alpha1.ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      configName,
+				Namespace: configNamespace,
+			},
+			Spec: relocationv1alpha1.ClusterConfigSpec{
+				ClusterRelocationSpec: cro.ClusterRelocationSpec{Domain: "thing.example.com"},
+				BareMetalHostRef: &relocationv1alpha1.BareMetalHostReference{
+					Name:      bmh.Name,
+					Namespace: bmh.Namespace,
+				},
+			},
+		}
+		Expect(c.Create(ctx, config)).To(Succeed())
+
+		req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: configNamespace, Name: configName}}
+		_, err := r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		configDir := filepath.Join(dataDir, "namespaces", configNamespace, configName)
+		Expect(configDir).To(BeADirectory())
+
+		// the service's image credentials aren't added to external URLs
+		r.Options.ImageBasicAuth = true
+		Expect(c.Get(ctx, req.NamespacedName, config)).To(Succeed())
+		config.Spec.ExternalImageURL = "https://images.example.com/site-1.iso"
+		config.Spec.BareMetalHostRef.DiskFormat = "raw"
+		Expect(c.Update(ctx, config)).To(Succeed())
+
+		res, err := r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res).To(Equal(ctrl.Result{}))
+
+		Expect(configDir).NotTo(BeADirectory())
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(bmh), bmh)).To(Succeed())
+		Expect(bmh.Spec.Image).NotTo(BeNil())
+		Expect(bmh.Spec.Image.URL).To(Equal("https://images.example.com/site-1.iso"))
+		Expect(bmh.Spec.Image.DiskFormat).To(HaveValue(Equal("raw")))
+
+		Expect(c.Get(ctx, req.NamespacedName, config)).To(Succeed())
+		Expect(config.Status.ImageURL).To(Equal("https://images.example.com/site-1.iso"))
+		Expect(config.Status.Phase).To(Equal(relocationv1alpha1.ClusterConfigPhaseImageAttached))
+		Expect(meta.IsStatusConditionTrue(config.Status.Conditions, relocationv1alpha1.ReconciledCondition)).To(BeTrue())
+		Expect(config.Status.Attempts).To(HaveLen(2))
+	})
+
+	It("configures a BMH in the config namespace when the reference has no namespace", func() {
+		bmh := &bmh_v1alpha1.BareMetalHost{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-bmh",
+				Namespace: configNamespace,
+			},
+		}
+		Expect(c.Create(ctx, bmh)).To(Succeed())
+
+		config := &relocationv1alpha1.ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      configName,
+				Namespace: configNamespace,
+			},
+			Spec: relocationv1alpha1.ClusterConfigSpec{
+				BareMetalHostRef: &relocationv1alpha1.BareMetalHostReference{Name: bmh.Name},
+			},
+		}
+		Expect(c.Create(ctx, config)).To(Succeed())
+
+		req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: configNamespace, Name: configName}}
+		_, err := r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(bmh), bmh)).To(Succeed())
+		Expect(bmh.Spec.Image).NotTo(BeNil())
+		Expect(bmh.Spec.Image.URL).To(Equal(fmt.Sprintf("https://service.namespace/images/%s/%s.iso", configNamespace, configName)))
+		Expect(c.Get(ctx, req.NamespacedName, config)).To(Succeed())
+		Expect(config.Status.Phase).To(Equal(relocationv1alpha1.ClusterConfigPhaseImageAttached))
+	})
+
+	It("links the BMH to the config with the owner annotation", func() {
+		r.Options.BMHOwnerAnnotation = true
+		bmh := &bmh_v1alpha1.BareMetalHost{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-bmh",
+				Namespace: "test-bmh-namespace",
+			},
+		}
+		Expect(c.Create(ctx, bmh)).To(Succeed())
+
+		config := &relocationv1alpha1.ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      configName,
+				Namespace: configNamespace,
+			},
+			Spec: relocationv1alpha1.ClusterConfigSpec{
+				BareMetalHostRef: &relocationv1alpha1.BareMetalHostReference{Name: bmh.Name, Namespace: bmh.Namespace},
+			},
+		}
+		Expect(c.Create(ctx, config)).To(Succeed())
+
+		req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: configNamespace, Name: configName}}
+		_, err := r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(bmh), bmh)).To(Succeed())
+		Expect(bmh.Annotations).To(HaveKeyWithValue(relocationv1alpha1.ClusterConfigAnnotation, "test-namespace/test-config"))
+		Expect(bmh.OwnerReferences).To(BeEmpty())
+
+		Expect(c.Get(ctx, req.NamespacedName, config)).To(Succeed())
+		Expect(c.Delete(ctx, config)).To(Succeed())
+		_, err = r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(bmh), bmh)).To(Succeed())
+		Expect(bmh.Annotations).NotTo(HaveKey(relocationv1alpha1.ClusterConfigAnnotation))
+		Expect(bmh.Spec.Image).NotTo(BeNil())
+	})
+
+	It("waits for a referenced BMH which doesn't exist yet", func() {
+		config := &relocationv1alpha1.ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      configName,
+				Namespace: configNamespace,
+			},
+			Spec: relocationv1alpha1.ClusterConfigSpec{
+				BareMetalHostRef: &relocationv1alpha1.BareMetalHostReference{
+					Name:      "test-bmh",
+					Namespace: "test-bmh-namespace",
+				},
+			},
+		}
+		Expect(c.Create(ctx, config)).To(Succeed())
+
+		req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: configNamespace, Name: configName}}
+		res, err := r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res).To(Equal(ctrl.Result{}))
+
+		Expect(c.Get(ctx, req.NamespacedName, config)).To(Succeed())
+		Expect(config.Status.Phase).To(Equal(relocationv1alpha1.ClusterConfigPhaseImageReady))
+		cond := meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.WaitingForHostCondition)
+		Expect(cond).NotTo(BeNil())
+		Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+		Expect(cond.Reason).To(Equal(relocationv1alpha1.HostNotFoundReason))
+
+		bmh := &bmh_v1alpha1.BareMetalHost{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-bmh",
+				Namespace: "test-bmh-namespace",
+			},
+		}
+		Expect(c.Create(ctx, bmh)).To(Succeed())
+		Expect(r.mapBMHToCC(ctx, bmh)).To(ConsistOf(req))
+
+		res, err = r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res).To(Equal(ctrl.Result{}))
+
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(bmh), bmh)).To(Succeed())
+		Expect(bmh.Spec.Image).NotTo(BeNil())
+		Expect(c.Get(ctx, req.NamespacedName, config)).To(Succeed())
+		Expect(config.Status.Phase).To(Equal(relocationv1alpha1.ClusterConfigPhaseImageAttached))
+		cond = meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.WaitingForHostCondition)
+		Expect(cond).NotTo(BeNil())
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Reason).To(Equal(relocationv1alpha1.HostFoundReason))
+	})
+
+	It("adds the namespace image credentials to the BMH image URL", func() {
+		r.Options.ImageBasicAuth = true
+		bmh := &bmh_v1alpha1.BareMetalHost{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-bmh",
+				Namespace: "test-bmh-namespace",
+			},
+		}
+		Expect(c.Create(ctx, bmh)).To(Succeed())
+		config := &relocationv1alpha1.ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      configName,
+				Namespace: configNamespace,
+			},
+			Spec: relocationv1alpha1.ClusterConfigSpec{
+				BareMetalHostRef: &relocationv1alpha1.BareMetalHostReference{Name: bmh.Name, Namespace: bmh.Namespace},
+			},
+		}
+		Expect(c.Create(ctx, config)).To(Succeed())
+
+		req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(config)}
+		_, err := r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		secret := &corev1.Secret{}
+		Expect(c.Get(ctx, types.NamespacedName{Name: relocationv1alpha1.ImageCredentialsSecretName, Namespace: configNamespace}, secret)).To(Succeed())
+		password := string(secret.Data[relocationv1alpha1.ImageCredentialsPasswordKey])
+		Expect(password).To(HaveLen(43))
+
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(bmh), bmh)).To(Succeed())
+		Expect(bmh.Spec.Image.URL).To(Equal(fmt.Sprintf("https://relocation:%s@service.namespace/images/%s/%s.iso", password, configNamespace, configName)))
+
+		// the status is readable by more users than the host so it doesn't include the credentials
+		Expect(c.Get(ctx, req.NamespacedName, config)).To(Succeed())
+		Expect(config.Status.ImageURL).To(Equal(fmt.Sprintf("https://service.namespace/images/%s/%s.iso", configNamespace, configName)))
+
+		// existing credentials are reused
+		_, err = r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(bmh), bmh)).To(Succeed())
+		Expect(bmh.Spec.Image.URL).To(ContainSubstring(password))
+	})
+
+	It("applies the host provisioning preferences from the reference", func() {
+		bmh := &bmh_v1alpha1.BareMetalHost{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-bmh",
+				Namespace: "test-bmh-namespace",
+			},
+			Spec: bmh_v1alpha1.BareMetalHostSpec{BootMode: bmh_v1alpha1.Legacy},
+		}
+		Expect(c.Create(ctx, bmh)).To(Succeed())
+
+		config := &relocationv1alpha1.ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      configName,
+				Namespace: configNamespace,
+			},
+			Spec: relocationv1alpha1.ClusterConfigSpec{
+				BareMetalHostRef: &relocationv1alpha1.BareMetalHostReference{
+					Name:                  bmh.Name,
+					Namespace:             bmh.Namespace,
+					BootMode:              bmh_v1alpha1.UEFISecureBoot,
+					RootDeviceHints:       &bmh_v1alpha1.RootDeviceHints{DeviceName: "/dev/sda"},
+					AutomatedCleaningMode: bmh_v1alpha1.CleaningModeDisabled,
+				},
+			},
+		}
+		Expect(c.Create(ctx, config)).To(Succeed())
+
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(config)})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(bmh), bmh)).To(Succeed())
+		Expect(bmh.Spec.BootMode).To(Equal(bmh_v1alpha1.UEFISecureBoot))
+		Expect(bmh.Spec.RootDeviceHints).To(Equal(&bmh_v1alpha1.RootDeviceHints{DeviceName: "/dev/sda"}))
+		Expect(bmh.Spec.AutomatedCleaningMode).To(Equal(bmh_v1alpha1.CleaningModeDisabled))
+	})
+
+	It("copies the network data for the provisioned OS to the BMH namespace", func() {
+		bmh := &bmh_v1alpha1.BareMetalHost{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-bmh",
+				Namespace: "test-bmh-namespace",
+			},
+		}
+		Expect(c.Create(ctx, bmh)).To(Succeed())
+		networkData := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "network-data",
+				Namespace: configNamespace,
+			},
+			Data: map[string][]byte{relocationv1alpha1.NetworkDataKey: []byte(`{"links": []}`)},
+		}
+		Expect(c.Create(ctx, networkData)).To(Succeed())
+
+		config := &relocationv1alpha1.ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      configName,
+				Namespace: configNamespace,
+			},
+			Spec: relocationv1alpha1.ClusterConfigSpec{
+				BareMetalHostRef: &relocationv1alpha1.BareMetalHostReference{
+					Name:           bmh.Name,
+					Namespace:      bmh.Namespace,
+					NetworkDataRef: &corev1.LocalObjectReference{Name: networkData.Name},
+				},
+			},
+		}
+		Expect(c.Create(ctx, config)).To(Succeed())
+
+		req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(config)}
+		_, err := r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		copyKey := types.NamespacedName{Name: fmt.Sprintf("%s-%s-network-data", configNamespace, configName), Namespace: bmh.Namespace}
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(bmh), bmh)).To(Succeed())
+		Expect(bmh.Spec.NetworkData).To(Equal(&corev1.SecretReference{Name: copyKey.Name, Namespace: copyKey.Namespace}))
+		secret := &corev1.Secret{}
+		Expect(c.Get(ctx, copyKey, secret)).To(Succeed())
+		Expect(secret.Data).To(Equal(networkData.Data))
+
+		// changes to the referenced secret are copied
+		networkData.Data[relocationv1alpha1.NetworkDataKey] = []byte(`{"links": [{"id": "eth0"}]}`)
+		Expect(c.Update(ctx, networkData)).To(Succeed())
+		_, err = r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Get(ctx, copyKey, secret)).To(Succeed())
+		Expect(secret.Data).To(Equal(networkData.Data))
+
+		// the copy is removed with the config
+		Expect(c.Get(ctx, req.NamespacedName, config)).To(Succeed())
+		Expect(c.Delete(ctx, config)).To(Succeed())
+		_, err = r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Get(ctx, copyKey, secret)).NotTo(Succeed())
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(bmh), bmh)).To(Succeed())
+		Expect(bmh.Spec.NetworkData).To(BeNil())
+	})
+
+	It("removes the network data from the BMH when the reference is removed", func() {
+		bmh := &bmh_v1alpha1.BareMetalHost{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-bmh",
+				Namespace: "test-bmh-namespace",
+			},
+		}
+		Expect(c.Create(ctx, bmh)).To(Succeed())
+		networkData := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "network-data",
+				Namespace: configNamespace,
+			},
+			Data: map[string][]byte{relocationv1alpha1.NetworkDataKey: []byte(`{"links": []}`)},
+		}
+		Expect(c.Create(ctx, networkData)).To(Succeed())
+
+		config := &relocationv1alpha1.ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      configName,
+				Namespace: configNamespace,
+			},
+			Spec: relocationv1alpha1.ClusterConfigSpec{
+				BareMetalHostRef: &relocationv1alpha1.BareMetalHostReference{
+					Name:           bmh.Name,
+					Namespace:      bmh.Namespace,
+					NetworkDataRef: &corev1.LocalObjectReference{Name: networkData.Name},
+				},
+			},
+		}
+		Expect(c.Create(ctx, config)).To(Succeed())
+
+		req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(config)}
+		_, err := r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(bmh), bmh)).To(Succeed())
+		Expect(bmh.Spec.NetworkData).NotTo(BeNil())
+
+		Expect(c.Get(ctx, req.NamespacedName, config)).To(Succeed())
+		config.Spec.BareMetalHostRef.NetworkDataRef = nil
+		Expect(c.Update(ctx, config)).To(Succeed())
+		_, err = r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(bmh), bmh)).To(Succeed())
+		Expect(bmh.Spec.NetworkData).To(BeNil())
+		copyKey := types.NamespacedName{Name: fmt.Sprintf("%s-%s-network-data", configNamespace, configName), Namespace: bmh.Namespace}
+		Expect(apierrors.IsNotFound(c.Get(ctx, copyKey, &corev1.Secret{}))).To(BeTrue())
+
+		// network data set on the host by someone else is left alone
+		bmh.Spec.NetworkData = &corev1.SecretReference{Name: "other", Namespace: bmh.Namespace}
+		Expect(c.Update(ctx, bmh)).To(Succeed())
+		_, err = r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(bmh), bmh)).To(Succeed())
+		Expect(bmh.Spec.NetworkData).To(Equal(&corev1.SecretReference{Name: "other", Namespace: bmh.Namespace}))
+	})
+
+	It("fails to attach the image when the network data secret has no networkData key", func() {
+		bmh := &bmh_v1alpha1.BareMetalHost{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-bmh",
+				Namespace: "test-bmh-namespace",
+			},
+		}
+		Expect(c.Create(ctx, bmh)).To(Succeed())
+		networkData := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "network-data",
+				Namespace: configNamespace,
+			},
+			Data: map[string][]byte{"network_data.json": []byte(`{}`)},
+		}
+		Expect(c.Create(ctx, networkData)).To(Succeed())
+
+		config := &relocationv1alpha1.ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      configName,
+				Namespace: configNamespace,
+			},
+			Spec: relocationv1alpha1.ClusterConfigSpec{
+				BareMetalHostRef: &relocationv1alpha1.BareMetalHostReference{
+					Name:           bmh.Name,
+					Namespace:      bmh.Namespace,
+					NetworkDataRef: &corev1.LocalObjectReference{Name: networkData.Name},
+				},
+			},
+		}
+		Expect(c.Create(ctx, config)).To(Succeed())
+
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(config)})
+		Expect(err).To(MatchError(ContainSubstring("has no networkData key")))
+
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(bmh), bmh)).To(Succeed())
+		Expect(bmh.Spec.Image).To(BeNil())
+	})
+
+	Context("with a hub Provisioning configuration", func() {
+		var (
+			bmh *bmh_v1alpha1.BareMetalHost
+			key = types.NamespacedName{Namespace: configNamespace, Name: configName}
+		)
+
+		reconcileWithProvisioning := func(spec map[string]interface{}) ctrl.Result {
+			p := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+			p.SetGroupVersionKind(provisioningGVK)
+			p.SetName(provisioningName)
+			Expect(c.Create(ctx, p)).To(Succeed())
+
+			bmh = &bmh_v1alpha1.BareMetalHost{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-bmh",
+					Namespace: "test-bmh-namespace",
+				},
+			}
+			Expect(c.Create(ctx, bmh)).To(Succeed())
+			config := &relocationv1alpha1.ClusterConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      configName,
+					Namespace: configNamespace,
+				},
+				Spec: relocationv1alpha1.ClusterConfigSpec{
+					BareMetalHostRef: &relocationv1alpha1.BareMetalHostReference{Name: bmh.Name, Namespace: bmh.Namespace},
+				},
+			}
+			Expect(c.Create(ctx, config)).To(Succeed())
+
+			res, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c.Get(ctx, client.ObjectKeyFromObject(bmh), bmh)).To(Succeed())
+			return res
+		}
+
+		It("doesn't attach the image when virtual media uses the provisioning network", func() {
+			res := reconcileWithProvisioning(map[string]interface{}{"provisioningNetwork": "Managed"})
+			Expect(res.RequeueAfter).To(Equal(provisioningRecheckInterval))
+			Expect(bmh.Spec.Image).To(BeNil())
+
+			config := &relocationv1alpha1.ClusterConfig{}
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			cond := meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.ImageReachableCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Reason).To(Equal(relocationv1alpha1.ProvisioningNetworkUnreachableReason))
+			Expect(cond.Message).To(ContainSubstring("virtualMediaViaExternalNetwork"))
+			Expect(config.Status.Phase).To(Equal(relocationv1alpha1.ClusterConfigPhaseImageReady))
+		})
+
+		It("attaches the image when virtual media uses the external network", func() {
+			res := reconcileWithProvisioning(map[string]interface{}{"provisioningNetwork": "Managed", "virtualMediaViaExternalNetwork": true})
+			Expect(res).To(Equal(ctrl.Result{}))
+			Expect(bmh.Spec.Image).NotTo(BeNil())
+
+			config := &relocationv1alpha1.ClusterConfig{}
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			Expect(meta.IsStatusConditionTrue(config.Status.Conditions, relocationv1alpha1.ImageReachableCondition)).To(BeTrue())
+		})
+
+		It("attaches the image without a provisioning network", func() {
+			res := reconcileWithProvisioning(map[string]interface{}{"provisioningNetwork": "Disabled"})
+			Expect(res).To(Equal(ctrl.Result{}))
+			Expect(bmh.Spec.Image).NotTo(BeNil())
+		})
+	})
+
+	Context("with host retries", func() {
+		var (
+			key    = types.NamespacedName{Namespace: configNamespace, Name: configName}
+			bmhKey = types.NamespacedName{Namespace: "test-bmh-namespace", Name: "test-bmh"}
+		)
+
+		BeforeEach(func() {
+			bmh := &bmh_v1alpha1.BareMetalHost{ObjectMeta: metav1.ObjectMeta{Name: bmhKey.Name, Namespace: bmhKey.Namespace}}
+			Expect(c.Create(ctx, bmh)).To(Succeed())
+			config := &relocationv1alpha1.ClusterConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      configName,
+					Namespace: configNamespace,
+				},
+				Spec: relocationv1alpha1.ClusterConfigSpec{
+					BareMetalHostRef: &relocationv1alpha1.BareMetalHostReference{Name: bmh.Name, Namespace: bmh.Namespace},
+					MaxRetries:       pointer.Int32(1),
+				},
+			}
+			Expect(c.Create(ctx, config)).To(Succeed())
+
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		setHostError := func(errorType bmh_v1alpha1.ErrorType) {
+			bmh := &bmh_v1alpha1.BareMetalHost{}
+			Expect(c.Get(ctx, bmhKey, bmh)).To(Succeed())
+			bmh.Status.OperationalStatus = bmh_v1alpha1.OperationalStatusError
+			bmh.Status.ErrorType = errorType
+			bmh.Status.ErrorMessage = "BMC timed out"
+			Expect(c.Update(ctx, bmh)).To(Succeed())
+		}
+
+		expireBackoff := func() {
+			config := &relocationv1alpha1.ClusterConfig{}
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			patch := client.MergeFrom(config.DeepCopy())
+			config.Status.LastHostRetryTime = &metav1.Time{Time: time.Now().Add(-time.Hour)}
+			Expect(c.Status().Patch(ctx, config, patch)).To(Succeed())
+		}
+
+		It("detaches the image to retry provisioning errors then fails once retries are used up", func() {
+			setHostError(bmh_v1alpha1.ProvisioningError)
+
+			res, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.RequeueAfter).To(Equal(hostRetryBaseDelay))
+
+			bmh := &bmh_v1alpha1.BareMetalHost{}
+			Expect(c.Get(ctx, bmhKey, bmh)).To(Succeed())
+			Expect(bmh.Spec.Image).To(BeNil())
+			config := &relocationv1alpha1.ClusterConfig{}
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			Expect(config.Status.HostRetries).To(Equal(int32(1)))
+			Expect(config.Status.Phase).To(Equal(relocationv1alpha1.ClusterConfigPhaseImageReady))
+			cond := meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.HostProvisioningFailedCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Reason).To(Equal(relocationv1alpha1.HostErrorRetryingReason))
+			Expect(cond.Message).To(ContainSubstring("BMC timed out"))
+
+			// the error remains during the backoff so the image isn't attached yet
+			res, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.RequeueAfter).To(BeNumerically(">", 0))
+			Expect(c.Get(ctx, bmhKey, bmh)).To(Succeed())
+			Expect(bmh.Spec.Image).To(BeNil())
+
+			expireBackoff()
+			res, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res).To(Equal(ctrl.Result{}))
+
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			Expect(config.Status.Phase).To(Equal(relocationv1alpha1.ClusterConfigPhaseFailed))
+			cond = meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.HostProvisioningFailedCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+			Expect(cond.Reason).To(Equal(relocationv1alpha1.HostRetriesExhaustedReason))
+		})
+
+		It("requests a new inspection to retry inspection errors", func() {
+			setHostError(bmh_v1alpha1.InspectionError)
+
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+
+			bmh := &bmh_v1alpha1.BareMetalHost{}
+			Expect(c.Get(ctx, bmhKey, bmh)).To(Succeed())
+			Expect(bmh.Annotations).To(HaveKey(bmh_v1alpha1.InspectAnnotation))
+		})
+
+		It("attaches the image again once the error clears", func() {
+			setHostError(bmh_v1alpha1.ProvisioningError)
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+
+			bmh := &bmh_v1alpha1.BareMetalHost{}
+			Expect(c.Get(ctx, bmhKey, bmh)).To(Succeed())
+			bmh.Status = bmh_v1alpha1.BareMetalHostStatus{OperationalStatus: bmh_v1alpha1.OperationalStatusOK}
+			Expect(c.Update(ctx, bmh)).To(Succeed())
+
+			res, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res).To(Equal(ctrl.Result{}))
+			Expect(c.Get(ctx, bmhKey, bmh)).To(Succeed())
+			Expect(bmh.Spec.Image).NotTo(BeNil())
+			config := &relocationv1alpha1.ClusterConfig{}
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			Expect(config.Status.Phase).To(Equal(relocationv1alpha1.ClusterConfigPhaseImageAttached))
+		})
+
+		It("copies the BareMetalHost error into the HostError condition", func() {
+			config := &relocationv1alpha1.ClusterConfig{}
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			cond := meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.HostErrorCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Reason).To(Equal(relocationv1alpha1.NoHostErrorReason))
+
+			bmh := &bmh_v1alpha1.BareMetalHost{}
+			Expect(c.Get(ctx, bmhKey, bmh)).To(Succeed())
+			bmh.Status.OperationalStatus = bmh_v1alpha1.OperationalStatusError
+			bmh.Status.ErrorType = bmh_v1alpha1.ProvisioningError
+			bmh.Status.ErrorMessage = "Failed to attach virtual media:\n\tinvalid image " + strings.Repeat("x", 1000)
+			Expect(c.Update(ctx, bmh)).To(Succeed())
+
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			cond = meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.HostErrorCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+			Expect(cond.Reason).To(Equal(relocationv1alpha1.HostErrorReportedReason))
+			Expect(cond.Message).To(HavePrefix("BareMetalHost test-bmh-namespace/test-bmh reported provisioning error: Failed to attach virtual media: invalid image xxx"))
+			Expect(cond.Message).To(HaveSuffix("..."))
+			Expect(len(cond.Message)).To(BeNumerically("<", 700))
+
+			Expect(c.Get(ctx, bmhKey, bmh)).To(Succeed())
+			bmh.Status = bmh_v1alpha1.BareMetalHostStatus{OperationalStatus: bmh_v1alpha1.OperationalStatusOK}
+			Expect(c.Update(ctx, bmh)).To(Succeed())
+
+			_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			cond = meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.HostErrorCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		})
+
+		It("starts the retries over when the spec changes", func() {
+			setHostError(bmh_v1alpha1.ProvisioningError)
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+
+			config := &relocationv1alpha1.ClusterConfig{}
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			config.Spec.MaxRetries = pointer.Int32(2)
+			Expect(c.Update(ctx, config)).To(Succeed())
+
+			_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			Expect(config.Status.HostRetries).To(Equal(int32(1)))
+			cond := meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.HostProvisioningFailedCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.ObservedGeneration).To(Equal(config.Generation))
+		})
+	})
+
+	Context("with preflight checks", func() {
+		var (
+			bmh *bmh_v1alpha1.BareMetalHost
+			key = types.NamespacedName{Namespace: configNamespace, Name: configName}
+		)
+
+		reconcileWithPreflight := func(preflight *relocationv1alpha1.PreflightChecks) (ctrl.Result, *relocationv1alpha1.ClusterConfig) {
+			Expect(c.Create(ctx, bmh)).To(Succeed())
+			config := &relocationv1alpha1.ClusterConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      configName,
+					Namespace: configNamespace,
+				},
+				Spec: relocationv1alpha1.ClusterConfigSpec{
+					BareMetalHostRef: &relocationv1alpha1.BareMetalHostReference{Name: bmh.Name, Namespace: bmh.Namespace},
+					NetworkConfigRef: &corev1.LocalObjectReference{Name: "network"},
+					Preflight:        preflight,
+				},
+			}
+			Expect(c.Create(ctx, config)).To(Succeed())
+
+			res, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c.Get(ctx, client.ObjectKeyFromObject(bmh), bmh)).To(Succeed())
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			return res, config
+		}
+
+		BeforeEach(func() {
+			bmh = &bmh_v1alpha1.BareMetalHost{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-bmh", Namespace: "test-bmh-namespace"},
+				Status: bmh_v1alpha1.BareMetalHostStatus{
+					GoodCredentials: bmh_v1alpha1.CredentialsStatus{Reference: &corev1.SecretReference{Name: "bmc"}},
+					HardwareDetails: &bmh_v1alpha1.HardwareDetails{
+						Storage: []bmh_v1alpha1.Storage{{Name: "/dev/sda", SizeBytes: 200 * bmh_v1alpha1.GigaByte}},
+					},
+				},
+			}
+			cm := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "network", Namespace: configNamespace},
+				Data:       map[string]string{"eth0.yaml": "interfaces:\n- name: eth0\n  type: ethernet\n"},
+			}
+			Expect(c.Create(ctx, cm)).To(Succeed())
+		})
+
+		It("attaches the image when the checks pass", func() {
+			minSize := resource.MustParse("100Gi")
+			res, config := reconcileWithPreflight(&relocationv1alpha1.PreflightChecks{MinDiskSize: &minSize})
+			Expect(res).To(Equal(ctrl.Result{}))
+			Expect(bmh.Spec.Image).NotTo(BeNil())
+
+			Expect(config.Status.Preflight).NotTo(BeNil())
+			Expect(config.Status.Preflight.Passed).To(BeTrue())
+			Expect(config.Status.Preflight.Checks).To(HaveLen(4))
+		})
+
+		It("doesn't attach the image when a check fails", func() {
+			minSize := resource.MustParse("1Ti")
+			res, config := reconcileWithPreflight(&relocationv1alpha1.PreflightChecks{MinDiskSize: &minSize})
+			Expect(res.RequeueAfter).To(Equal(preflightRecheckInterval))
+			Expect(bmh.Spec.Image).To(BeNil())
+			Expect(config.Status.Phase).To(Equal(relocationv1alpha1.ClusterConfigPhaseImageReady))
+
+			Expect(config.Status.Preflight.Passed).To(BeFalse())
+			for _, check := range config.Status.Preflight.Checks {
+				Expect(check.Passed).To(Equal(check.Name != relocationv1alpha1.PreflightCheckDiskSize), string(check.Name))
+			}
+		})
+
+		It("fails the network config check for invalid files", func() {
+			cm := &corev1.ConfigMap{}
+			Expect(c.Get(ctx, types.NamespacedName{Name: "network", Namespace: configNamespace}, cm)).To(Succeed())
+			cm.Data["eth1.yaml"] = "interfaces: [\n"
+			Expect(c.Update(ctx, cm)).To(Succeed())
+
+			_, config := reconcileWithPreflight(&relocationv1alpha1.PreflightChecks{})
+			Expect(bmh.Spec.Image).To(BeNil())
+			Expect(config.Status.Preflight.Checks).To(ContainElement(And(
+				HaveField("Name", relocationv1alpha1.PreflightCheckNetworkConfig),
+				HaveField("Passed", false),
+				HaveField("Message", ContainSubstring("eth1.yaml")),
+			)))
+		})
+
+		It("attaches the image when failed checks are skipped", func() {
+			bmh.Status.HardwareDetails = nil
+			res, config := reconcileWithPreflight(&relocationv1alpha1.PreflightChecks{Skip: true})
+			Expect(res).To(Equal(ctrl.Result{}))
+			Expect(bmh.Spec.Image).NotTo(BeNil())
+			Expect(config.Status.Preflight.Passed).To(BeFalse())
+		})
+	})
+
+	Context("with hardware requirements", func() {
+		var (
+			bmh *bmh_v1alpha1.BareMetalHost
+			key = types.NamespacedName{Namespace: configNamespace, Name: configName}
+		)
+
+		reconcileWithRequirements := func(reqs *relocationv1alpha1.HardwareRequirements) (ctrl.Result, *relocationv1alpha1.ClusterConfig) {
+			Expect(c.Create(ctx, bmh)).To(Succeed())
+			config := &relocationv1alpha1.ClusterConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      configName,
+					Namespace: configNamespace,
+				},
+				Spec: relocationv1alpha1.ClusterConfigSpec{
+					BareMetalHostRef:     &relocationv1alpha1.BareMetalHostReference{Name: bmh.Name, Namespace: bmh.Namespace},
+					HardwareRequirements: reqs,
+				},
+			}
+			Expect(c.Create(ctx, config)).To(Succeed())
+
+			res, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c.Get(ctx, client.ObjectKeyFromObject(bmh), bmh)).To(Succeed())
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			return res, config
+		}
+
+		BeforeEach(func() {
+			bmh = &bmh_v1alpha1.BareMetalHost{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-bmh", Namespace: "test-bmh-namespace"},
+				Status: bmh_v1alpha1.BareMetalHostStatus{
+					HardwareDetails: &bmh_v1alpha1.HardwareDetails{
+						RAMMebibytes: 32 * 1024,
+						NIC:          []bmh_v1alpha1.NIC{{Name: "eth0"}, {Name: "eth1"}},
+						Storage:      []bmh_v1alpha1.Storage{{Name: "/dev/sda", SizeBytes: 200 * bmh_v1alpha1.GigaByte}},
+					},
+				},
+			}
+		})
+
+		It("attaches the image when the hardware is sufficient", func() {
+			minDisk := resource.MustParse("120Gi")
+			minMemory := resource.MustParse("16Gi")
+			res, config := reconcileWithRequirements(&relocationv1alpha1.HardwareRequirements{MinDiskSize: &minDisk, MinMemory: &minMemory, MinNICs: 2})
+			Expect(res).To(Equal(ctrl.Result{}))
+			Expect(bmh.Spec.Image).NotTo(BeNil())
+
+			cond := meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.HardwareInsufficientCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Reason).To(Equal(relocationv1alpha1.HardwareSufficientReason))
+		})
+
+		It("doesn't attach the image when the hardware is insufficient", func() {
+			minMemory := resource.MustParse("64Gi")
+			res, config := reconcileWithRequirements(&relocationv1alpha1.HardwareRequirements{MinMemory: &minMemory, MinNICs: 3})
+			Expect(res).To(Equal(ctrl.Result{}))
+			Expect(bmh.Spec.Image).To(BeNil())
+			Expect(config.Status.Phase).To(Equal(relocationv1alpha1.ClusterConfigPhaseImageReady))
+
+			cond := meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.HardwareInsufficientCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+			Expect(cond.Reason).To(Equal(relocationv1alpha1.HardwareBelowMinimumReason))
+			Expect(cond.Message).To(ContainSubstring("memory is 32Gi"))
+			Expect(cond.Message).To(ContainSubstring("2 network interfaces"))
+		})
+
+		It("waits for the host to be inspected", func() {
+			bmh.Status.HardwareDetails = nil
+			_, config := reconcileWithRequirements(&relocationv1alpha1.HardwareRequirements{MinNICs: 1})
+			Expect(bmh.Spec.Image).To(BeNil())
+
+			cond := meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.HardwareInsufficientCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionUnknown))
+			Expect(cond.Reason).To(Equal(relocationv1alpha1.HardwareDetailsUnavailableReason))
+		})
+
+		It("removes the condition when the requirements are removed", func() {
+			_, config := reconcileWithRequirements(&relocationv1alpha1.HardwareRequirements{MinNICs: 3})
+			Expect(meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.HardwareInsufficientCondition)).NotTo(BeNil())
+
+			config.Spec.HardwareRequirements = nil
+			Expect(c.Update(ctx, config)).To(Succeed())
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			Expect(meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.HardwareInsufficientCondition)).To(BeNil())
+			Expect(c.Get(ctx, client.ObjectKeyFromObject(bmh), bmh)).To(Succeed())
+			Expect(bmh.Spec.Image).NotTo(BeNil())
+		})
+	})
+
+	Context("with host inspection data", func() {
+		var (
+			bmh *bmh_v1alpha1.BareMetalHost
+			key = types.NamespacedName{Namespace: configNamespace, Name: configName}
+		)
+
+		BeforeEach(func() {
+			bmh = &bmh_v1alpha1.BareMetalHost{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-bmh", Namespace: "test-bmh-namespace"},
+				Status: bmh_v1alpha1.BareMetalHostStatus{
+					HardwareDetails: &bmh_v1alpha1.HardwareDetails{
+						SystemVendor: bmh_v1alpha1.HardwareSystemVendor{Manufacturer: "Dell Inc.", ProductName: "PowerEdge R650", SerialNumber: "ABC1234"},
+						NIC: []bmh_v1alpha1.NIC{
+							{Name: "eno1", MAC: "aa:bb:cc:dd:ee:01"},
+							{Name: "eno2", MAC: "aa:bb:cc:dd:ee:02"},
+						},
+					},
+				},
+			}
+		})
+
+		createConfig := func(interfaceNames bool) {
+			Expect(c.Create(ctx, bmh)).To(Succeed())
+			Expect(c.Create(ctx, &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "network", Namespace: configNamespace},
+				Data: map[string]string{
+					"host.yaml": "interfaces:\n- mac-address: AA:BB:CC:DD:EE:02\n  type: ethernet\n- name: eno1\n  type: ethernet\n",
+				},
+			})).To(Succeed())
+			Expect(c.Create(ctx, &relocationv1alpha1.ClusterConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      configName,
+					Namespace: configNamespace,
+				},
+				Spec: relocationv1alpha1.ClusterConfigSpec{
+					BareMetalHostRef:       &relocationv1alpha1.BareMetalHostReference{Name: bmh.Name, Namespace: bmh.Namespace},
+					NetworkConfigRef:       &corev1.LocalObjectReference{Name: "network"},
+					InterfaceNamesFromHost: interfaceNames,
+				},
+			})).To(Succeed())
+		}
+
+		renderedNetworkConfig := func() map[string]string {
+			reader, err := isoschema.NewReader(os.DirFS(filepath.Join(dataDir, "namespaces", configNamespace, configName, "files")))
+			Expect(err).NotTo(HaveOccurred())
+			cm := &corev1.ConfigMap{}
+			found, err := reader.ReadObject(isoschema.NetworkConfigFileType, cm)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeTrue())
+			return cm.Data
+		}
+
+		It("records the inspected hardware in the status", func() {
+			createConfig(false)
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+
+			config := &relocationv1alpha1.ClusterConfig{}
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			Expect(config.Status.HostHardware).To(Equal(&relocationv1alpha1.HostHardware{
+				Manufacturer: "Dell Inc.",
+				ProductName:  "PowerEdge R650",
+				SerialNumber: "ABC1234",
+				NICs: []relocationv1alpha1.HostNIC{
+					{Name: "eno1", MAC: "aa:bb:cc:dd:ee:01"},
+					{Name: "eno2", MAC: "aa:bb:cc:dd:ee:02"},
+				},
+			}))
+			Expect(renderedNetworkConfig()["host.yaml"]).NotTo(ContainSubstring("eno2"))
+		})
+
+		It("fills in interface names from the inspected MAC addresses", func() {
+			createConfig(true)
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+
+			doc := map[string]interface{}{}
+			Expect(yaml.Unmarshal([]byte(renderedNetworkConfig()["host.yaml"]), &doc)).To(Succeed())
+			Expect(doc["interfaces"]).To(Equal([]interface{}{
+				map[string]interface{}{"name": "eno2", "mac-address": "AA:BB:CC:DD:EE:02", "type": "ethernet"},
+				map[string]interface{}{"name": "eno1", "type": "ethernet"},
+			}))
+		})
+
+		It("fails to render interface names before the host is inspected", func() {
+			bmh.Status.HardwareDetails = nil
+			createConfig(true)
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("has not been inspected yet"))
+		})
+	})
+
+	Context("with a certificate renewal window", func() {
+		var (
+			bmh *bmh_v1alpha1.BareMetalHost
+			key = types.NamespacedName{Namespace: configNamespace, Name: configName}
+		)
+
+		certPEM := func(notAfter time.Time) []byte {
+			priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+			tmpl := &x509.Certificate{
+				SerialNumber: big.NewInt(1),
+				Subject:      pkix.Name{CommonName: "api.thing.example.com"},
+				NotBefore:    time.Now().Add(-time.Hour),
+				NotAfter:     notAfter,
+			}
+			der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &priv.PublicKey, priv)
+			Expect(err).NotTo(HaveOccurred())
+			return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+		}
+
+		reconcileWithCerts := func(window *metav1.Duration, apiCert []byte) (ctrl.Result, *relocationv1alpha1.ClusterConfig) {
+			createSecret("api-cert", map[string][]byte{corev1.TLSCertKey: apiCert})
+			Expect(c.Create(ctx, bmh)).To(Succeed())
+			config := &relocationv1alpha1.ClusterConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      configName,
+					Namespace: configNamespace,
+				},
+				Spec: relocationv1alpha1.ClusterConfigSpec{
+					ClusterRelocationSpec: cro.ClusterRelocationSpec{
+						APICertRef: &corev1.SecretReference{Name: "api-cert", Namespace: configNamespace},
+					},
+					BareMetalHostRef:  &relocationv1alpha1.BareMetalHostReference{Name: bmh.Name, Namespace: bmh.Namespace},
+					CertRenewalWindow: window,
+				},
+			}
+			Expect(c.Create(ctx, config)).To(Succeed())
+
+			res, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c.Get(ctx, client.ObjectKeyFromObject(bmh), bmh)).To(Succeed())
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			return res, config
+		}
+
+		BeforeEach(func() {
+			bmh = &bmh_v1alpha1.BareMetalHost{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-bmh", Namespace: "test-bmh-namespace"},
+			}
+		})
+
+		It("records the expiry without a renewal window", func() {
+			notAfter := time.Now().Add(time.Hour).Truncate(time.Second)
+			res, config := reconcileWithCerts(nil, certPEM(notAfter))
+			Expect(res).To(Equal(ctrl.Result{}))
+			Expect(bmh.Spec.Image).NotTo(BeNil())
+			Expect(config.Status.APICertExpiry.Time).To(BeTemporally("==", notAfter))
+			Expect(config.Status.IngressCertExpiry).To(BeNil())
+			Expect(meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.CertificatesValidCondition)).To(BeNil())
+		})
+
+		It("attaches the image and requeues for when the certificate enters the window", func() {
+			notAfter := time.Now().Add(30 * 24 * time.Hour)
+			res, config := reconcileWithCerts(&metav1.Duration{Duration: 7 * 24 * time.Hour}, certPEM(notAfter))
+			Expect(res.RequeueAfter).To(BeNumerically("~", 23*24*time.Hour, time.Minute))
+			Expect(bmh.Spec.Image).NotTo(BeNil())
+			Expect(config.Status.Phase).To(Equal(relocationv1alpha1.ClusterConfigPhaseImageAttached))
+
+			cond := meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.CertificatesValidCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+			Expect(cond.Reason).To(Equal(relocationv1alpha1.CertificatesValidReason))
+		})
+
+		It("doesn't attach the image until an expiring certificate is renewed", func() {
+			notAfter := time.Now().Add(24 * time.Hour)
+			res, config := reconcileWithCerts(&metav1.Duration{Duration: 7 * 24 * time.Hour}, certPEM(notAfter))
+			Expect(res.RequeueAfter).To(Equal(certRecheckInterval))
+			Expect(bmh.Spec.Image).To(BeNil())
+			Expect(config.Status.Phase).To(Equal(relocationv1alpha1.ClusterConfigPhaseImageReady))
+
+			cond := meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.CertificatesValidCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Reason).To(Equal(relocationv1alpha1.CertificateExpiringReason))
+			Expect(cond.Message).To(ContainSubstring("API certificate"))
+			hash := config.Status.PayloadHash
+
+			s := &corev1.Secret{}
+			Expect(c.Get(ctx, types.NamespacedName{Name: "api-cert", Namespace: configNamespace}, s)).To(Succeed())
+			s.Data[corev1.TLSCertKey] = certPEM(time.Now().Add(90 * 24 * time.Hour))
+			Expect(c.Update(ctx, s)).To(Succeed())
+
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c.Get(ctx, client.ObjectKeyFromObject(bmh), bmh)).To(Succeed())
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			Expect(bmh.Spec.Image).NotTo(BeNil())
+			Expect(config.Status.PayloadHash).NotTo(Equal(hash))
+			Expect(meta.IsStatusConditionTrue(config.Status.Conditions, relocationv1alpha1.CertificatesValidCondition)).To(BeTrue())
+		})
+
+		It("doesn't attach the image when the certificate can't be parsed", func() {
+			res, config := reconcileWithCerts(&metav1.Duration{Duration: time.Hour}, []byte("not a cert"))
+			Expect(res.RequeueAfter).To(Equal(certRecheckInterval))
+			Expect(bmh.Spec.Image).To(BeNil())
+			Expect(config.Status.APICertExpiry).To(BeNil())
+
+			cond := meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.CertificatesValidCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Reason).To(Equal(relocationv1alpha1.CertificateInvalidReason))
+		})
+	})
+
+	Context("with console annotations", func() {
+		key := types.NamespacedName{Namespace: configNamespace, Name: configName}
+
+		BeforeEach(func() {
+			r.Options.ConsoleAnnotations = true
+			config := &relocationv1alpha1.ClusterConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      configName,
+					Namespace: configNamespace,
+				},
+			}
+			Expect(c.Create(ctx, config)).To(Succeed())
+		})
+
+		It("sets the progress of the current phase", func() {
+			r.Options.ConsoleLogsURL = "https://logs.example.com/search?q={namespace}%2F{name}"
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+
+			config := &relocationv1alpha1.ClusterConfig{}
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			Expect(config.Labels).To(HaveKeyWithValue(relocationv1alpha1.PhaseLabel, "ImageReady"))
+			Expect(config.Annotations).To(HaveKeyWithValue(relocationv1alpha1.ProgressPercentAnnotation, "25"))
+			Expect(config.Annotations).To(HaveKey(relocationv1alpha1.ProgressMessageAnnotation))
+			Expect(config.Annotations).To(HaveKeyWithValue(relocationv1alpha1.ConsoleLogsURLAnnotation,
+				"https://logs.example.com/search?q=test-namespace%2Ftest-config"))
+
+			meta.SetStatusCondition(&config.Status.Conditions, metav1.Condition{
+				Type:   relocationv1alpha1.RelocationCompletedCondition,
+				Status: metav1.ConditionTrue,
+				Reason: "Reported",
+			})
+			Expect(c.Status().Update(ctx, config)).To(Succeed())
+			_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			Expect(config.Labels).To(HaveKeyWithValue(relocationv1alpha1.PhaseLabel, "Completed"))
+			Expect(config.Annotations).To(HaveKeyWithValue(relocationv1alpha1.ProgressPercentAnnotation, "100"))
+		})
+
+		It("doesn't set anything when disabled", func() {
+			r.Options.ConsoleAnnotations = false
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+
+			config := &relocationv1alpha1.ClusterConfig{}
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			Expect(config.Labels).NotTo(HaveKey(relocationv1alpha1.PhaseLabel))
+			Expect(config.Annotations).NotTo(HaveKey(relocationv1alpha1.ProgressPercentAnnotation))
+		})
+	})
+
+	Context("with a minimum rebuild interval", func() {
+		var (
+			config *relocationv1alpha1.ClusterConfig
+			key    = types.NamespacedName{Namespace: configNamespace, Name: configName}
+		)
+
+		renderedDomain := func() string {
+			content, err := os.ReadFile(filepath.Join(dataDir, "namespaces", configNamespace, configName, "files", "cluster-relocation.json"))
+			Expect(err).NotTo(HaveOccurred())
+			relocation := &cro.ClusterRelocation{}
+			Expect(json.Unmarshal(content, relocation)).To(Succeed())
+			return relocation.Spec.Domain
+		}
+
+		setDomain := func(domain string) {
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			config.Spec.Domain = domain
+			Expect(c.Update(ctx, config)).To(Succeed())
+		}
+
+		reconcile := func() ctrl.Result {
+			res, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			return res
+		}
+
+		BeforeEach(func() {
+			config = &relocationv1alpha1.ClusterConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      configName,
+					Namespace: configNamespace,
+				},
+				Spec: relocationv1alpha1.ClusterConfigSpec{
+					ClusterRelocationSpec: cro.ClusterRelocationSpec{Domain: "one.example.com"},
+					MinRebuildInterval:    &metav1.Duration{Duration: time.Hour},
+				},
+			}
+			Expect(c.Create(ctx, config)).To(Succeed())
+			Expect(reconcile()).To(Equal(ctrl.Result{}))
+
+			// the first change is rendered immediately as nothing was rebuilt before
+			setDomain("two.example.com")
+			Expect(reconcile()).To(Equal(ctrl.Result{}))
+			Expect(renderedDomain()).To(Equal("two.example.com"))
+		})
+
+		It("coalesces changes made within the interval", func() {
+			setDomain("three.example.com")
+			res := reconcile()
+			Expect(res.RequeueAfter).To(BeNumerically("~", time.Hour, time.Minute))
+			Expect(renderedDomain()).To(Equal("two.example.com"))
+			hash := config.Status.PayloadHash
+
+			cond := meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.RebuildThrottledCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+			Expect(cond.Reason).To(Equal(relocationv1alpha1.MinRebuildIntervalReason))
+
+			setDomain("four.example.com")
+			reconcile()
+			Expect(renderedDomain()).To(Equal("two.example.com"))
+			Expect(config.Status.PayloadHash).To(Equal(hash))
+
+			// move the last rebuild back past the interval
+			patch := client.MergeFrom(config.DeepCopy())
+			config.Status.PayloadDiff.Time = metav1.NewTime(time.Now().Add(-2 * time.Hour))
+			Expect(c.Status().Patch(ctx, config, patch)).To(Succeed())
+
+			reconcile()
+			Expect(renderedDomain()).To(Equal("four.example.com"))
+			Expect(config.Status.PayloadHash).NotTo(Equal(hash))
+		})
+
+		It("requeues for coalesced changes while waiting for the host", func() {
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			config.Spec.Domain = "three.example.com"
+			config.Spec.BareMetalHostRef = &relocationv1alpha1.BareMetalHostReference{Name: "missing-bmh", Namespace: "test-bmh-namespace"}
+			Expect(c.Update(ctx, config)).To(Succeed())
+
+			res := reconcile()
+			Expect(res.RequeueAfter).To(BeNumerically("~", time.Hour, time.Minute))
+			Expect(renderedDomain()).To(Equal("two.example.com"))
+			Expect(meta.IsStatusConditionTrue(config.Status.Conditions, relocationv1alpha1.WaitingForHostCondition)).To(BeTrue())
+		})
+
+		It("renders immediately with the force annotation", func() {
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			config.Spec.Domain = "three.example.com"
+			metav1.SetMetaDataAnnotation(&config.ObjectMeta, relocationv1alpha1.ForceRebuildAnnotation, "")
+			Expect(c.Update(ctx, config)).To(Succeed())
+
+			reconcile()
+			Expect(renderedDomain()).To(Equal("three.example.com"))
+			Expect(config.Annotations).NotTo(HaveKey(relocationv1alpha1.ForceRebuildAnnotation))
+		})
+	})
+
+	Context("with a maintenance window", func() {
+		var (
+			bmh *bmh_v1alpha1.BareMetalHost
+			key = types.NamespacedName{Namespace: configNamespace, Name: configName}
+		)
+
+		reconcileWithWindow := func(start time.Time, duration time.Duration) ctrl.Result {
+			bmh = &bmh_v1alpha1.BareMetalHost{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-bmh",
+					Namespace: "test-bmh-namespace",
+				},
+			}
+			Expect(c.Create(ctx, bmh)).To(Succeed())
+
+			config := &relocationv1alpha1.ClusterConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      configName,
+					Namespace: configNamespace,
+				},
+				Spec: relocationv1alpha1.ClusterConfigSpec{
+					BareMetalHostRef: &relocationv1alpha1.BareMetalHostReference{Name: bmh.Name, Namespace: bmh.Namespace},
+					MaintenanceWindow: &relocationv1alpha1.MaintenanceWindow{
+						Start:    start.UTC().Format("15:04"),
+						Duration: metav1.Duration{Duration: duration},
+					},
+				},
+			}
+			Expect(c.Create(ctx, config)).To(Succeed())
+
+			res, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c.Get(ctx, client.ObjectKeyFromObject(bmh), bmh)).To(Succeed())
+			return res
+		}
+
+		It("serves the image but waits to attach it outside the window", func() {
+			res := reconcileWithWindow(time.Now().Add(2*time.Hour), time.Hour)
+			Expect(res.RequeueAfter).To(BeNumerically(">", time.Hour))
+			Expect(res.RequeueAfter).To(BeNumerically("<=", 2*time.Hour))
+			Expect(bmh.Spec.Image).To(BeNil())
+
+			config := &relocationv1alpha1.ClusterConfig{}
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			Expect(config.Status.Phase).To(Equal(relocationv1alpha1.ClusterConfigPhaseImageReady))
+			Expect(filepath.Join(dataDir, "namespaces", configNamespace, configName, "files", "manifest.json")).To(BeAnExistingFile())
+			cond := meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.MaintenanceWindowOpenCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Reason).To(Equal(relocationv1alpha1.MaintenanceWindowClosedReason))
+		})
+
+		It("attaches the image inside the window", func() {
+			res := reconcileWithWindow(time.Now().Add(-time.Hour), 3*time.Hour)
+			Expect(res).To(Equal(ctrl.Result{}))
+			Expect(bmh.Spec.Image).NotTo(BeNil())
+
+			config := &relocationv1alpha1.ClusterConfig{}
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			Expect(meta.IsStatusConditionTrue(config.Status.Conditions, relocationv1alpha1.MaintenanceWindowOpenCondition)).To(BeTrue())
+
+			config.Spec.MaintenanceWindow = nil
+			Expect(c.Update(ctx, config)).To(Succeed())
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			Expect(meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.MaintenanceWindowOpenCondition)).To(BeNil())
+		})
+
+		It("reports an invalid window without requeueing", func() {
+			res := reconcileWithWindow(time.Now(), 0)
+			Expect(res).To(Equal(ctrl.Result{}))
+			Expect(bmh.Spec.Image).To(BeNil())
+
+			config := &relocationv1alpha1.ClusterConfig{}
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			Expect(config.Status.Phase).To(Equal(relocationv1alpha1.ClusterConfigPhaseImageReady))
+			cond := meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.MaintenanceWindowOpenCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Reason).To(Equal(relocationv1alpha1.MaintenanceWindowInvalidReason))
+			Expect(cond.Message).To(ContainSubstring("duration"))
+		})
+
+		It("resyncs while waiting for the window", func() {
+			r.Options.ResyncPeriod = 30 * time.Minute
+			res := reconcileWithWindow(time.Now().Add(2*time.Hour), time.Hour)
+			Expect(res.RequeueAfter).To(Equal(30 * time.Minute))
+			Expect(bmh.Spec.Image).To(BeNil())
+		})
+
+		It("resyncs with an invalid window", func() {
+			r.Options.ResyncPeriod = time.Hour
+			res := reconcileWithWindow(time.Now(), 0)
+			Expect(res).To(Equal(ctrl.Result{RequeueAfter: time.Hour}))
+		})
+	})
+
+	Context("with the abort annotation", func() {
+		var (
+			bmh    *bmh_v1alpha1.BareMetalHost
+			config *relocationv1alpha1.ClusterConfig
+			key    = types.NamespacedName{Namespace: configNamespace, Name: configName}
+		)
+
+		reconcile := func() {
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c.Get(ctx, client.ObjectKeyFromObject(bmh), bmh)).To(Succeed())
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+		}
+
+		setAbort := func(value *string) {
+			if value == nil {
+				delete(config.Annotations, relocationv1alpha1.AbortAnnotation)
+			} else {
+				metav1.SetMetaDataAnnotation(&config.ObjectMeta, relocationv1alpha1.AbortAnnotation, *value)
+			}
+			Expect(c.Update(ctx, config)).To(Succeed())
+			reconcile()
+		}
+
+		BeforeEach(func() {
+			bmh = &bmh_v1alpha1.BareMetalHost{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-bmh",
+					Namespace: "test-bmh-namespace",
+				},
+				Spec: bmh_v1alpha1.BareMetalHostSpec{Online: true},
+			}
+			Expect(c.Create(ctx, bmh)).To(Succeed())
+
+			config = &relocationv1alpha1.ClusterConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      configName,
+					Namespace: configNamespace,
+				},
+				Spec: relocationv1alpha1.ClusterConfigSpec{
+					BareMetalHostRef: &relocationv1alpha1.BareMetalHostReference{Name: bmh.Name, Namespace: bmh.Namespace},
+				},
+			}
+			Expect(c.Create(ctx, config)).To(Succeed())
+			reconcile()
+			Expect(bmh.Spec.Image).NotTo(BeNil())
+		})
+
+		It("detaches the image and marks the relocation aborted", func() {
+			setAbort(pointer.String(""))
+			Expect(bmh.Spec.Image).To(BeNil())
+			Expect(bmh.Spec.Online).To(BeTrue())
+
+			Expect(config.Status.Phase).To(Equal(relocationv1alpha1.ClusterConfigPhaseAborted))
+			cond := meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.AbortedCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+			Expect(cond.Reason).To(Equal(relocationv1alpha1.AbortRequestedReason))
+			Expect(config.Status.Attempts).To(HaveLen(1))
+			Expect(config.Status.Attempts[0].Outcome).To(Equal(relocationv1alpha1.RelocationAttemptAborted))
+			Expect(config.Status.Attempts[0].CompletionTime).NotTo(BeNil())
+
+			reconcile()
+			Expect(bmh.Spec.Image).To(BeNil())
+		})
+
+		It("powers the host off when requested", func() {
+			setAbort(pointer.String(relocationv1alpha1.AbortPowerOff))
+			Expect(bmh.Spec.Image).To(BeNil())
+			Expect(bmh.Spec.Online).To(BeFalse())
+		})
+
+		It("attaches the image again as a new attempt once the annotation is removed", func() {
+			setAbort(pointer.String(""))
+			setAbort(nil)
+			Expect(bmh.Spec.Image).NotTo(BeNil())
+			Expect(meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.AbortedCondition)).To(BeNil())
+			Expect(config.Status.Phase).To(Equal(relocationv1alpha1.ClusterConfigPhaseImageAttached))
+			Expect(config.Status.Attempts).To(HaveLen(2))
+			Expect(config.Status.Attempts[1].Outcome).To(Equal(relocationv1alpha1.RelocationAttemptInProgress))
+		})
+	})
+
+	Context("with render plugins", func() {
+		var (
+			key        = types.NamespacedName{Namespace: configNamespace, Name: configName}
+			pluginsDir string
+			filesDir   string
+		)
+
+		BeforeEach(func() {
+			pluginsDir = GinkgoT().TempDir()
+			r.Options.RenderPluginsDir = pluginsDir
+			r.Options.RenderPluginTimeout = time.Minute
+			filesDir = filepath.Join(dataDir, "namespaces", configNamespace, configName, "files")
+
+			config := &relocationv1alpha1.ClusterConfig{
+				ObjectMeta: metav1.ObjectMeta{Name: configName, Namespace: configNamespace},
+				Spec: relocationv1alpha1.ClusterConfigSpec{
+					ClusterRelocationSpec: cro.ClusterRelocationSpec{Domain: "thing.example.com"},
+				},
+			}
+			Expect(c.Create(ctx, config)).To(Succeed())
+		})
+
+		writePlugin := func(name, script string) {
+			Expect(os.WriteFile(filepath.Join(pluginsDir, name), []byte("#!/bin/sh\nset -e\n"+script+"\n"), 0755)).To(Succeed())
+		}
+
+		readManifest := func() *isoschema.Manifest {
+			reader, err := isoschema.NewReader(os.DirFS(filesDir))
+			Expect(err).NotTo(HaveOccurred())
+			return reader.Manifest()
+		}
+
+		It("adds and changes files in name order", func() {
+			writePlugin("10-motd", `mkdir -p "$1/site" && echo "$CLUSTERCONFIG_NAMESPACE/$CLUSTERCONFIG_NAME" > "$1/site/motd"`)
+			writePlugin("20-domain", `sed -i 's/thing.example.com/other.example.com/' "$1/cluster-relocation.json" && cat "$1/site/motd" > "$1/copy"`)
+			// not executable so it isn't run
+			Expect(os.WriteFile(filepath.Join(pluginsDir, "30-disabled"), []byte("#!/bin/sh\nexit 1\n"), 0644)).To(Succeed())
+
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+
+			content, err := os.ReadFile(filepath.Join(filesDir, "site", "motd"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(content)).To(Equal("test-namespace/test-config\n"))
+			Expect(filepath.Join(filesDir, "copy")).To(BeAnExistingFile())
+			relocation := &cro.ClusterRelocation{}
+			content, err = os.ReadFile(filepath.Join(filesDir, "cluster-relocation.json"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(json.Unmarshal(content, relocation)).To(Succeed())
+			Expect(relocation.Spec.Domain).To(Equal("other.example.com"))
+
+			manifest := readManifest()
+			f, ok := manifest.Lookup(isoschema.ClusterRelocationFileType)
+			Expect(ok).To(BeTrue())
+			Expect(f.Size).To(Equal(int64(len(content))))
+			var plugin []string
+			for _, f := range manifest.Files {
+				if f.Type == isoschema.PluginFileType {
+					plugin = append(plugin, f.Path)
+				}
+			}
+			Expect(plugin).To(ConsistOf("site/motd", "copy"))
+
+			config := &relocationv1alpha1.ClusterConfig{}
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			first := config.Status.PayloadHash
+
+			// files are removed once the plugin stops producing them
+			Expect(os.Remove(filepath.Join(pluginsDir, "20-domain"))).To(Succeed())
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			config.Spec.Domain = "new.example.com"
+			Expect(c.Update(ctx, config)).To(Succeed())
+			_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(filepath.Join(filesDir, "copy")).NotTo(BeAnExistingFile())
+			Expect(filepath.Join(filesDir, "site", "motd")).To(BeAnExistingFile())
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			Expect(config.Status.PayloadHash).NotTo(Equal(first))
+		})
+
+		It("reports plugin failures in the Reconciled condition", func() {
+			writePlugin("10-fail", `echo "missing site data" >&2; exit 3`)
+
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).To(HaveOccurred())
+
+			config := &relocationv1alpha1.ClusterConfig{}
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			cond := meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.ReconciledCondition)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Message).To(ContainSubstring("render plugin 10-fail failed"))
+			Expect(cond.Message).To(ContainSubstring("missing site data"))
+		})
+
+		It("keeps the previous payload when a later render fails", func() {
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			before, err := os.ReadFile(filepath.Join(filesDir, "cluster-relocation.json"))
+			Expect(err).NotTo(HaveOccurred())
+			manifest := readManifest()
+
+			writePlugin("10-fail", "exit 1")
+			config := &relocationv1alpha1.ClusterConfig{}
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			config.Spec.Domain = "new.example.com"
+			Expect(c.Update(ctx, config)).To(Succeed())
+			_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).To(HaveOccurred())
+
+			after, err := os.ReadFile(filepath.Join(filesDir, "cluster-relocation.json"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(after).To(Equal(before))
+			Expect(readManifest()).To(Equal(manifest))
+			Expect(filepath.Join(filepath.Dir(filesDir), payloadTxDir)).NotTo(BeADirectory())
+		})
+	})
+
+	It("defers BareMetalHost patches beyond the rate limit", func() {
+		r.BMHPatches = ratelimit.NewKeyedLimiter(0.001, 1)
+		createHostConfig := func(name string) (*bmh_v1alpha1.BareMetalHost, ctrl.Result) {
+			bmh := &bmh_v1alpha1.BareMetalHost{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test-bmh-namespace"},
+			}
+			Expect(c.Create(ctx, bmh)).To(Succeed())
+			config := &relocationv1alpha1.ClusterConfig{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: configNamespace},
+				Spec: relocationv1alpha1.ClusterConfigSpec{
+					BareMetalHostRef: &relocationv1alpha1.BareMetalHostReference{Name: bmh.Name, Namespace: bmh.Namespace},
+				},
+			}
+			Expect(c.Create(ctx, config)).To(Succeed())
+			res, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(config)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c.Get(ctx, client.ObjectKeyFromObject(bmh), bmh)).To(Succeed())
+			return bmh, res
+		}
+
+		first, res := createHostConfig("host-1")
+		Expect(res).To(Equal(ctrl.Result{}))
+		Expect(first.Spec.Image).NotTo(BeNil())
+
+		second, res := createHostConfig("host-2")
+		Expect(res.RequeueAfter).To(BeNumerically(">", 0))
+		Expect(second.Spec.Image).To(BeNil())
+
+		config := &relocationv1alpha1.ClusterConfig{}
+		Expect(c.Get(ctx, types.NamespacedName{Namespace: configNamespace, Name: "host-2"}, config)).To(Succeed())
+		Expect(config.Status.Phase).To(Equal(relocationv1alpha1.ClusterConfigPhaseImageReady))
+		Expect(config.Status.Attempts).To(BeEmpty())
+	})
+
+	Context("when the configuration changes after the image is attached", func() {
+		var (
+			bmh    *bmh_v1alpha1.BareMetalHost
+			config *relocationv1alpha1.ClusterConfig
+			key    = types.NamespacedName{Namespace: configNamespace, Name: configName}
+		)
+
+		createAttachedConfig := func(spec relocationv1alpha1.ClusterConfigSpec) {
+			bmh = &bmh_v1alpha1.BareMetalHost{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-bmh",
+					Namespace: "test-bmh-namespace",
+				},
+			}
+			Expect(c.Create(ctx, bmh)).To(Succeed())
+
+			spec.Domain = "thing.example.com"
+			spec.BareMetalHostRef = &relocationv1alpha1.BareMetalHostReference{Name: bmh.Name, Namespace: bmh.Namespace}
+			config = &relocationv1alpha1.ClusterConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      configName,
+					Namespace: configNamespace,
+				},
+				Spec: spec,
+			}
+			Expect(c.Create(ctx, config)).To(Succeed())
+
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c.Get(ctx, client.ObjectKeyFromObject(bmh), bmh)).To(Succeed())
+			Expect(bmh.Spec.Image).NotTo(BeNil())
+		}
+
+		changeDomain := func() {
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			config.Spec.Domain = "other.example.com"
+			Expect(c.Update(ctx, config)).To(Succeed())
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c.Get(ctx, client.ObjectKeyFromObject(bmh), bmh)).To(Succeed())
+		}
+
+		It("records the payload hash", func() {
+			createAttachedConfig(relocationv1alpha1.ClusterConfigSpec{})
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			first := config.Status.PayloadHash
+			Expect(first).NotTo(BeEmpty())
+
+			changeDomain()
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			Expect(config.Status.PayloadHash).NotTo(Equal(first))
+		})
+
+		It("keeps the same image URL and doesn't reboot by default", func() {
+			createAttachedConfig(relocationv1alpha1.ClusterConfigSpec{})
+			url := bmh.Spec.Image.URL
+
+			changeDomain()
+			Expect(bmh.Spec.Image.URL).To(Equal(url))
+			Expect(bmh.Annotations).NotTo(HaveKey(bmh_v1alpha1.RebootAnnotationPrefix))
+		})
+
+		It("versions the image URL with ReattachOnChange", func() {
+			createAttachedConfig(relocationv1alpha1.ClusterConfigSpec{ReattachOnChange: true})
+			url := bmh.Spec.Image.URL
+			Expect(url).To(HavePrefix(fmt.Sprintf("https://service.namespace/images/%s/%s.iso?version=", configNamespace, configName)))
+
+			changeDomain()
+			Expect(bmh.Spec.Image.URL).NotTo(Equal(url))
+			Expect(bmh.Spec.Image.URL).To(HavePrefix(fmt.Sprintf("https://service.namespace/images/%s/%s.iso?version=", configNamespace, configName)))
+		})
+
+		It("records each attempt", func() {
+			createAttachedConfig(relocationv1alpha1.ClusterConfigSpec{})
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			Expect(config.Status.Attempts).To(HaveLen(1))
+			Expect(config.Status.Attempts[0].Outcome).To(Equal(relocationv1alpha1.RelocationAttemptInProgress))
+			Expect(config.Status.Attempts[0].PayloadHash).To(Equal(config.Status.PayloadHash))
+
+			changeDomain()
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			Expect(config.Status.Attempts).To(HaveLen(2))
+			Expect(config.Status.Attempts[0].Outcome).To(Equal(relocationv1alpha1.RelocationAttemptSuperseded))
+			Expect(config.Status.Attempts[0].CompletionTime).NotTo(BeNil())
+			Expect(config.Status.Attempts[1].Outcome).To(Equal(relocationv1alpha1.RelocationAttemptInProgress))
+
+			meta.SetStatusCondition(&config.Status.Conditions, metav1.Condition{
+				Type:   relocationv1alpha1.RelocationCompletedCondition,
+				Status: metav1.ConditionTrue,
+				Reason: "Reported",
+			})
+			Expect(c.Status().Update(ctx, config)).To(Succeed())
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			Expect(config.Status.Attempts).To(HaveLen(2))
+			Expect(config.Status.Attempts[1].Outcome).To(Equal(relocationv1alpha1.RelocationAttemptSucceeded))
+			Expect(config.Status.Attempts[1].CompletionTime).NotTo(BeNil())
+		})
+
+		It("keeps a bounded number of attempts", func() {
+			createAttachedConfig(relocationv1alpha1.ClusterConfigSpec{})
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			for i := 0; i < maxRelocationAttempts+5; i++ {
+				Expect(r.recordAttempt(ctx, config, fmt.Sprintf("hash-%d", i))).To(Succeed())
+			}
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			Expect(config.Status.Attempts).To(HaveLen(maxRelocationAttempts))
+			Expect(config.Status.Attempts[maxRelocationAttempts-1].PayloadHash).To(Equal(fmt.Sprintf("hash-%d", maxRelocationAttempts+4)))
+		})
+
+		It("reboots the host with the configured mode", func() {
+			createAttachedConfig(relocationv1alpha1.ClusterConfigSpec{RebootMode: relocationv1alpha1.RebootModeHard})
+			Expect(bmh.Annotations).NotTo(HaveKey(bmh_v1alpha1.RebootAnnotationPrefix))
+
+			// reconciling without changes doesn't reboot
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c.Get(ctx, client.ObjectKeyFromObject(bmh), bmh)).To(Succeed())
+			Expect(bmh.Annotations).NotTo(HaveKey(bmh_v1alpha1.RebootAnnotationPrefix))
+
+			changeDomain()
+			Expect(bmh.Annotations).To(HaveKeyWithValue(bmh_v1alpha1.RebootAnnotationPrefix, `{"mode":"hard","force":false}`))
+		})
+
+		It("doesn't reboot the host with the none mode", func() {
+			createAttachedConfig(relocationv1alpha1.ClusterConfigSpec{RebootMode: relocationv1alpha1.RebootModeNone})
+			changeDomain()
+			Expect(bmh.Annotations).NotTo(HaveKey(bmh_v1alpha1.RebootAnnotationPrefix))
+		})
+	})
+})
+
+var _ = Describe("mapBMHToCC", func() {
+	var (
+		c               client.Client
+		r               *ClusterConfigReconciler
+		ctx             = context.Background()
+		configName      = "test-config"
+		configNamespace = "test-namespace"
+	)
+
+	BeforeEach(func() {
+		c = fakeclient.NewClientBuilder().
+			WithScheme(scheme.Scheme).
+			WithStatusSubresource(&relocationv1alpha1.ClusterConfig{}).
+			WithIndex(&relocationv1alpha1.ClusterConfig{}, bmhRefIndex, bmhRefIndexValue).
+			Build()
+
+		r = &ClusterConfigReconciler{
+			Client: c,
+			Scheme: scheme.Scheme,
+			Log:    logrus.New(),
+		}
+	})
+
+	It("returns a request for the cluster config referencing the given BMH", func() {
+		bmh := &bmh_v1alpha1.BareMetalHost{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-bmh",
+				Namespace: "test-bmh-namespace",
+			},
+		}
+		Expect(c.Create(ctx, bmh)).To(Succeed())
+
+		config := &relocationv1alpha1.ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      configName,
+				Namespace: configNamespace,
+			},
+			Spec: relocationv1alpha1.ClusterConfigSpec{
+				BareMetalHostRef: &relocationv1alpha1.BareMetalHostReference{
+					Name:      bmh.Name,
+					Namespace: bmh.Namespace,
+				},
+			},
+		}
+		Expect(c.Create(ctx, config)).To(Succeed())
+
+		config = &relocationv1alpha1.ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "other-config",
+				Namespace: configNamespace,
+			},
+		}
+		Expect(c.Create(ctx, config)).To(Succeed())
+
+		requests := r.mapBMHToCC(ctx, bmh)
+		Expect(len(requests)).To(Equal(1))
+		Expect(requests[0].NamespacedName).To(Equal(types.NamespacedName{
+			Name:      configName,
+			Namespace: configNamespace,
+		}))
+	})
+
+	It("reports a host referenced by multiple cluster configs once", func() {
+		recorder := record.NewFakeRecorder(10)
+		r.Notifier = &report.Notifier{Recorder: recorder, Window: time.Hour}
+		bmh := &bmh_v1alpha1.BareMetalHost{ObjectMeta: metav1.ObjectMeta{Name: "test-bmh", Namespace: "test-bmh-namespace"}}
+		for _, name := range []string{configName, "other-config"} {
+			Expect(c.Create(ctx, &relocationv1alpha1.ClusterConfig{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: configNamespace},
+				Spec: relocationv1alpha1.ClusterConfigSpec{
+					BareMetalHostRef: &relocationv1alpha1.BareMetalHostReference{Name: bmh.Name, Namespace: bmh.Namespace},
+				},
+			})).To(Succeed())
+		}
+
+		Expect(r.mapBMHToCC(ctx, bmh)).To(HaveLen(2))
+		Expect(r.mapBMHToCC(ctx, bmh)).To(HaveLen(2))
+		Expect(recorder.Events).To(Receive(Equal("Warning MultipleClusterConfigs found multiple ClusterConfigs referencing BareMetalHost test-bmh-namespace/test-bmh")))
+		Expect(recorder.Events).To(BeEmpty())
+	})
+
+	It("returns requests for hosts that have been deleted", func() {
+		config := &relocationv1alpha1.ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      configName,
+				Namespace: configNamespace,
+			},
+			Spec: relocationv1alpha1.ClusterConfigSpec{
+				BareMetalHostRef: &relocationv1alpha1.BareMetalHostReference{
+					Name:      "test-bmh",
+					Namespace: "test-bmh-namespace",
+				},
+			},
+		}
+		Expect(c.Create(ctx, config)).To(Succeed())
+
+		bmh := &bmh_v1alpha1.BareMetalHost{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-bmh",
+				Namespace: "test-bmh-namespace",
+			},
+		}
+		requests := r.mapBMHToCC(ctx, bmh)
+		Expect(len(requests)).To(Equal(1))
+	})
+
+	It("uses the owner annotation without listing cluster configs", func() {
+		config := &relocationv1alpha1.ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      configName,
+				Namespace: configNamespace,
+			},
+			Spec: relocationv1alpha1.ClusterConfigSpec{
+				BareMetalHostRef: &relocationv1alpha1.BareMetalHostReference{
+					Name:      "test-bmh",
+					Namespace: "test-bmh-namespace",
+				},
+			},
+		}
+		Expect(c.Create(ctx, config)).To(Succeed())
+		listed := false
+		r.Client = interceptor.NewClient(c.(client.WithWatch), interceptor.Funcs{
+			List: func(ctx context.Context, client client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+				listed = true
+				return client.List(ctx, list, opts...)
+			},
+		})
+
+		bmh := &bmh_v1alpha1.BareMetalHost{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "test-bmh",
+				Namespace:   "test-bmh-namespace",
+				Annotations: map[string]string{relocationv1alpha1.ClusterConfigAnnotation: configNamespace + "/" + configName},
+			},
+		}
+		Expect(r.mapBMHToCC(ctx, bmh)).To(ConsistOf(reconcile.Request{NamespacedName: client.ObjectKeyFromObject(config)}))
+		Expect(listed).To(BeFalse())
+
+		// a stale annotation falls back to listing
+		bmh.Annotations[relocationv1alpha1.ClusterConfigAnnotation] = configNamespace + "/deleted"
+		Expect(r.mapBMHToCC(ctx, bmh)).To(ConsistOf(reconcile.Request{NamespacedName: client.ObjectKeyFromObject(config)}))
+		Expect(listed).To(BeTrue())
 	})
 
 	It("returns an empty list when no cluster config matches", func() {
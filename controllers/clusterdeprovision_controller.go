@@ -0,0 +1,313 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	bmh_v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+	"github.com/carbonin/cluster-relocation-service/internal/report"
+	"github.com/carbonin/cluster-relocation-service/internal/tracing"
+)
+
+//+kubebuilder:rbac:groups=relocation.openshift.io,resources=clusterdeprovisions,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=relocation.openshift.io,resources=clusterdeprovisions/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=relocation.openshift.io,resources=clusterdeprovisions/finalizers,verbs=update
+
+const (
+	clusterDeprovisionFinalizerName = "relocation.openshift.io/clusterdeprovision-finalizer"
+	// hostDeprovisionReason is the event reason when a ClusterConfig references a host claimed by a ClusterDeprovision
+	hostDeprovisionReason = "HostDeprovisioning"
+)
+
+// ClusterDeprovisionReconciler reconciles a ClusterDeprovision object
+// The host is deprovisioned by the baremetal-operator, whose automated cleaning wipes the disk metadata, so nothing
+// has to run on the host. BareMetalHost patches share the ClusterConfig patch limits
+type ClusterDeprovisionReconciler struct {
+	client.Client
+	Log logrus.FieldLogger
+	// Configs is the ClusterConfig reconciler of the manager
+	Configs *ClusterConfigReconciler
+}
+
+func (r *ClusterDeprovisionReconciler) Reconcile(ctx context.Context, req ctrl.Request) (res ctrl.Result, err error) {
+	ctx, span := tracing.Start(ctx, "ReconcileDeprovision",
+		attribute.String("clusterdeprovision.namespace", req.Namespace),
+		attribute.String("clusterdeprovision.name", req.Name),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	log := r.Log.WithFields(logrus.Fields{"name": req.Name, "namespace": req.Namespace, "kind": "ClusterDeprovision"})
+
+	deprovision := &relocationv1alpha1.ClusterDeprovision{}
+	if err := r.Get(ctx, req.NamespacedName, deprovision); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if r.Configs.Options.ReadOnly {
+		log.Info("data directory is read-only, skipping reconcile")
+		return ctrl.Result{}, nil
+	}
+	bmhRef := deprovisionBMHRef(deprovision)
+
+	if !deprovision.DeletionTimestamp.IsZero() {
+		return r.cleanupDeleted(ctx, log, deprovision, bmhRef)
+	}
+	// wiping a host is only allowed to those who can manage the hosts of their own namespace
+	if bmhRef.Namespace != deprovision.Namespace {
+		return ctrl.Result{}, r.setDeprovisioned(ctx, deprovision, relocationv1alpha1.DeprovisionFailedReason,
+			fmt.Sprintf("BareMetalHost %s/%s must be in the ClusterDeprovision namespace %s", bmhRef.Namespace, bmhRef.Name, deprovision.Namespace))
+	}
+	if controllerutil.AddFinalizer(deprovision, clusterDeprovisionFinalizerName) {
+		if err := r.Update(ctx, deprovision); err != nil {
+			log.WithError(err).Error("failed to add finalizer")
+			return ctrl.Result{}, err
+		}
+	}
+
+	// the ClusterConfig would attach its image again once the host is deprovisioned
+	inUseBy, err := r.hostUser(ctx, bmhRef)
+	if err != nil {
+		log.WithError(err).Error("failed to list ClusterConfigs referencing the host")
+		return ctrl.Result{}, err
+	}
+	if inUseBy != "" {
+		log.Infof("waiting for ClusterConfig %s to be deleted", inUseBy)
+		return ctrl.Result{}, r.setDeprovisioned(ctx, deprovision, relocationv1alpha1.HostInUseReason,
+			fmt.Sprintf("BareMetalHost %s/%s is still referenced by ClusterConfig %s, delete it first", bmhRef.Namespace, bmhRef.Name, inUseBy))
+	}
+
+	cached, err := r.Configs.ensureBMHCached(ctx, bmhRef)
+	if err != nil {
+		log.WithError(err).Error("failed to label BareMetalHost")
+		return ctrl.Result{}, err
+	}
+	if !cached {
+		log.Info("waiting for the referenced BareMetalHost to be cached")
+		return ctrl.Result{}, nil
+	}
+	bmh := &bmh_v1alpha1.BareMetalHost{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: bmhRef.Namespace, Name: bmhRef.Name}, bmh); err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, r.setDeprovisioned(ctx, deprovision, relocationv1alpha1.HostNotFoundReason,
+			fmt.Sprintf("BareMetalHost %s/%s does not exist, it will be deprovisioned once it is created", bmhRef.Namespace, bmhRef.Name))
+	}
+	if bmh.Spec.ExternallyProvisioned {
+		return ctrl.Result{}, r.setDeprovisioned(ctx, deprovision, relocationv1alpha1.DeprovisionFailedReason,
+			fmt.Sprintf("BareMetalHost %s/%s is externally provisioned so the baremetal-operator can't clean it", bmhRef.Namespace, bmhRef.Name))
+	}
+
+	deferred, err := r.deprovisionHost(ctx, deprovision, bmh)
+	if err != nil {
+		log.WithError(err).Error("failed to deprovision BareMetalHost")
+		return ctrl.Result{}, err
+	}
+	if deferred > 0 {
+		log.Infof("BareMetalHost patch rate limit reached, retrying in %s", deferred)
+		return ctrl.Result{RequeueAfter: deferred}, nil
+	}
+
+	// the BareMetalHost watch reconciles again as the host moves through deprovisioning and cleaning
+	state := bmh.Status.Provisioning.State
+	done := (state == bmh_v1alpha1.StateAvailable || state == bmh_v1alpha1.StateReady) && bmh.Status.Provisioning.Image.URL == ""
+	if !done {
+		message := fmt.Sprintf("BareMetalHost %s/%s is being deprovisioned, it is %s", bmhRef.Namespace, bmhRef.Name, state)
+		if bmh.Status.ErrorType != "" {
+			message = fmt.Sprintf("%s with a %s: %s", message, bmh.Status.ErrorType, bmh.Status.ErrorMessage)
+		}
+		return ctrl.Result{}, r.setDeprovisioned(ctx, deprovision, relocationv1alpha1.DeprovisioningReason, message)
+	}
+	return ctrl.Result{}, r.setDeprovisioned(ctx, deprovision, relocationv1alpha1.HostDeprovisionedReason,
+		fmt.Sprintf("BareMetalHost %s/%s has been deprovisioned and its disks cleaned", bmhRef.Namespace, bmhRef.Name))
+}
+
+// deprovisionHost claims bmh for deprovision, detaches its image and enables automated cleaning so the
+// baremetal-operator deprovisions and cleans it, and powers it off if requested
+func (r *ClusterDeprovisionReconciler) deprovisionHost(ctx context.Context, deprovision *relocationv1alpha1.ClusterDeprovision, bmh *bmh_v1alpha1.BareMetalHost) (time.Duration, error) {
+	patch := client.MergeFrom(bmh.DeepCopy())
+	dirty := false
+	owner := types.NamespacedName{Namespace: deprovision.Namespace, Name: deprovision.Name}.String()
+	if bmh.Annotations[relocationv1alpha1.ClusterDeprovisionAnnotation] != owner {
+		metav1.SetMetaDataAnnotation(&bmh.ObjectMeta, relocationv1alpha1.ClusterDeprovisionAnnotation, owner)
+		dirty = true
+	}
+	if bmh.Spec.AutomatedCleaningMode != bmh_v1alpha1.CleaningModeMetadata {
+		bmh.Spec.AutomatedCleaningMode = bmh_v1alpha1.CleaningModeMetadata
+		dirty = true
+	}
+	if bmh.Spec.Image != nil {
+		bmh.Spec.Image = nil
+		dirty = true
+	}
+	if bmh.Spec.Online == deprovision.Spec.PowerOff {
+		bmh.Spec.Online = !deprovision.Spec.PowerOff
+		dirty = true
+	}
+
+	key := client.ObjectKeyFromObject(bmh)
+	if !dirty {
+		r.Configs.BMHPatches.Forget(key)
+		return 0, nil
+	}
+	if delay := r.Configs.BMHPatches.Delay(key); delay > 0 {
+		return delay, nil
+	}
+	return 0, r.Patch(ctx, bmh, patch)
+}
+
+// deprovisionBMHRef returns the host reference of deprovision with the namespace defaulted
+func deprovisionBMHRef(deprovision *relocationv1alpha1.ClusterDeprovision) *relocationv1alpha1.BareMetalHostReference {
+	ref := &relocationv1alpha1.BareMetalHostReference{}
+	if deprovision.Spec.BareMetalHostRef != nil {
+		ref = deprovision.Spec.BareMetalHostRef.DeepCopy()
+	}
+	if ref.Namespace == "" {
+		ref.Namespace = deprovision.Namespace
+	}
+	return ref
+}
+
+// hostUser returns the namespaced name of a ClusterConfig which isn't being deleted and references bmhRef, if any
+func (r *ClusterDeprovisionReconciler) hostUser(ctx context.Context, bmhRef *relocationv1alpha1.BareMetalHostReference) (string, error) {
+	configs := &relocationv1alpha1.ClusterConfigList{}
+	ref := types.NamespacedName{Namespace: bmhRef.Namespace, Name: bmhRef.Name}.String()
+	if err := r.List(ctx, configs, client.MatchingFields{bmhRefIndex: ref}); err != nil {
+		return "", err
+	}
+	for _, config := range configs.Items {
+		if config.DeletionTimestamp.IsZero() {
+			return types.NamespacedName{Namespace: config.Namespace, Name: config.Name}.String(), nil
+		}
+	}
+	return "", nil
+}
+
+// cleanupDeleted releases the host claimed by deprovision and removes the finalizer
+// The host stays deprovisioned, ClusterConfigs can attach images to it again once it's released
+func (r *ClusterDeprovisionReconciler) cleanupDeleted(ctx context.Context, log logrus.FieldLogger, deprovision *relocationv1alpha1.ClusterDeprovision, bmhRef *relocationv1alpha1.BareMetalHostReference) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(deprovision, clusterDeprovisionFinalizerName) {
+		return ctrl.Result{}, nil
+	}
+	if err := r.releaseHost(ctx, deprovision, bmhRef); err != nil {
+		log.WithError(err).Error("failed to release BareMetalHost")
+		return ctrl.Result{}, err
+	}
+
+	controllerutil.RemoveFinalizer(deprovision, clusterDeprovisionFinalizerName)
+	if err := r.Update(ctx, deprovision); client.IgnoreNotFound(err) != nil {
+		log.WithError(err).Error("failed to remove finalizer")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// releaseHost removes the ClusterDeprovisionAnnotation from the referenced host if it names deprovision
+func (r *ClusterDeprovisionReconciler) releaseHost(ctx context.Context, deprovision *relocationv1alpha1.ClusterDeprovision, bmhRef *relocationv1alpha1.BareMetalHostReference) error {
+	bmh := &bmh_v1alpha1.BareMetalHost{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: bmhRef.Namespace, Name: bmhRef.Name}, bmh); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	owner := types.NamespacedName{Namespace: deprovision.Namespace, Name: deprovision.Name}.String()
+	if bmh.Annotations[relocationv1alpha1.ClusterDeprovisionAnnotation] != owner {
+		return nil
+	}
+	patch := client.MergeFrom(bmh.DeepCopy())
+	delete(bmh.Annotations, relocationv1alpha1.ClusterDeprovisionAnnotation)
+	return client.IgnoreNotFound(r.Patch(ctx, bmh, patch))
+}
+
+// setDeprovisioned sets the HostDeprovisioned condition, it is only true with HostDeprovisionedReason
+func (r *ClusterDeprovisionReconciler) setDeprovisioned(ctx context.Context, deprovision *relocationv1alpha1.ClusterDeprovision, reason, message string) error {
+	cond := metav1.Condition{
+		Type:               relocationv1alpha1.HostDeprovisionedCondition,
+		Status:             metav1.ConditionFalse,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: deprovision.Generation,
+	}
+	if reason == relocationv1alpha1.HostDeprovisionedReason {
+		cond.Status = metav1.ConditionTrue
+	}
+
+	patch := client.MergeFrom(deprovision.DeepCopy())
+	changed := report.SetCondition(&deprovision.Status.Conditions, cond)
+	if !changed && deprovision.Status.ObservedGeneration == deprovision.Generation {
+		return nil
+	}
+	deprovision.Status.ObservedGeneration = deprovision.Generation
+	return r.Status().Patch(ctx, deprovision, patch)
+}
+
+// deprovisionBMHRefIndexValue returns the bmhRefIndex values for a ClusterDeprovision
+func deprovisionBMHRefIndexValue(obj client.Object) []string {
+	deprovision, ok := obj.(*relocationv1alpha1.ClusterDeprovision)
+	if !ok || deprovision.Spec.BareMetalHostRef == nil {
+		return nil
+	}
+	ref := deprovisionBMHRef(deprovision)
+	return []string{types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}.String()}
+}
+
+// mapHostToDeprovisions returns requests for the ClusterDeprovisions of the host obj is or references
+// ClusterConfigs are mapped through their host so deprovisions waiting for one to be deleted are reconciled
+func (r *ClusterDeprovisionReconciler) mapHostToDeprovisions(ctx context.Context, obj client.Object) []reconcile.Request {
+	ref := types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetName()}
+	if config, ok := obj.(*relocationv1alpha1.ClusterConfig); ok {
+		bmhRef := configBMHRef(config)
+		if bmhRef == nil {
+			return nil
+		}
+		ref = types.NamespacedName{Namespace: bmhRef.Namespace, Name: bmhRef.Name}
+	}
+
+	deprovisions := &relocationv1alpha1.ClusterDeprovisionList{}
+	if err := r.List(ctx, deprovisions, client.MatchingFields{bmhRefIndex: ref.String()}); err != nil {
+		return nil
+	}
+	requests := []reconcile.Request{}
+	for _, d := range deprovisions.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: d.Namespace, Name: d.Name}})
+	}
+	return requests
+}
+
+func (r *ClusterDeprovisionReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &relocationv1alpha1.ClusterDeprovision{}, bmhRefIndex, deprovisionBMHRefIndexValue); err != nil {
+		return err
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&relocationv1alpha1.ClusterDeprovision{}).
+		WatchesRawSource(source.Kind(mgr.GetCache(), &bmh_v1alpha1.BareMetalHost{}), handler.EnqueueRequestsFromMapFunc(r.mapHostToDeprovisions)).
+		WatchesRawSource(source.Kind(mgr.GetCache(), &relocationv1alpha1.ClusterConfig{}), handler.EnqueueRequestsFromMapFunc(r.mapHostToDeprovisions)).
+		Complete(r)
+}
@@ -0,0 +1,219 @@
+package controllers
+
+import (
+	"context"
+
+	bmh_v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+)
+
+var _ = Describe("ClusterDeprovision Reconcile", func() {
+	var (
+		c        client.Client
+		r        *ClusterDeprovisionReconciler
+		ctx      = context.Background()
+		key      = types.NamespacedName{Namespace: "test-namespace", Name: "test-deprovision"}
+		bmhKey   = types.NamespacedName{Namespace: "test-namespace", Name: "test-bmh"}
+		imageURL = "https://service.namespace/images/test-namespace/test-config.iso"
+	)
+
+	BeforeEach(func() {
+		c = fakeclient.NewClientBuilder().
+			WithScheme(scheme.Scheme).
+			WithStatusSubresource(&relocationv1alpha1.ClusterConfig{}, &relocationv1alpha1.ClusterDeprovision{}).
+			WithIndex(&relocationv1alpha1.ClusterConfig{}, bmhRefIndex, bmhRefIndexValue).
+			WithIndex(&relocationv1alpha1.ClusterDeprovision{}, bmhRefIndex, deprovisionBMHRefIndexValue).
+			Build()
+
+		r = &ClusterDeprovisionReconciler{
+			Client: c,
+			Log:    logrus.New(),
+			Configs: &ClusterConfigReconciler{
+				Client:  c,
+				Scheme:  scheme.Scheme,
+				Log:     logrus.New(),
+				Options: &ClusterConfigReconcilerOptions{},
+			},
+		}
+
+		Expect(c.Create(ctx, &bmh_v1alpha1.BareMetalHost{
+			ObjectMeta: metav1.ObjectMeta{Name: bmhKey.Name, Namespace: bmhKey.Namespace},
+			Spec: bmh_v1alpha1.BareMetalHostSpec{
+				Online: true,
+				Image:  &bmh_v1alpha1.Image{URL: imageURL},
+			},
+		})).To(Succeed())
+	})
+
+	createDeprovision := func(spec relocationv1alpha1.ClusterDeprovisionSpec) {
+		if spec.BareMetalHostRef == nil {
+			spec.BareMetalHostRef = &relocationv1alpha1.BareMetalHostReference{Name: bmhKey.Name}
+		}
+		ExpectWithOffset(1, c.Create(ctx, &relocationv1alpha1.ClusterDeprovision{
+			ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+			Spec:       spec,
+		})).To(Succeed())
+	}
+
+	reconcile := func() {
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		ExpectWithOffset(1, err).NotTo(HaveOccurred())
+	}
+
+	getBMH := func() *bmh_v1alpha1.BareMetalHost {
+		bmh := &bmh_v1alpha1.BareMetalHost{}
+		ExpectWithOffset(1, c.Get(ctx, bmhKey, bmh)).To(Succeed())
+		return bmh
+	}
+
+	getDeprovision := func() *relocationv1alpha1.ClusterDeprovision {
+		deprovision := &relocationv1alpha1.ClusterDeprovision{}
+		ExpectWithOffset(1, c.Get(ctx, key, deprovision)).To(Succeed())
+		return deprovision
+	}
+
+	deprovisioned := func() *metav1.Condition {
+		cond := meta.FindStatusCondition(getDeprovision().Status.Conditions, relocationv1alpha1.HostDeprovisionedCondition)
+		ExpectWithOffset(1, cond).NotTo(BeNil())
+		return cond
+	}
+
+	setProvisioning := func(state bmh_v1alpha1.ProvisioningState, url string) {
+		bmh := getBMH()
+		bmh.Status.Provisioning.State = state
+		bmh.Status.Provisioning.Image.URL = url
+		ExpectWithOffset(1, c.Update(ctx, bmh)).To(Succeed())
+	}
+
+	It("claims the host and has the baremetal-operator deprovision it with metadata cleaning", func() {
+		createDeprovision(relocationv1alpha1.ClusterDeprovisionSpec{PowerOff: true})
+		setProvisioning(bmh_v1alpha1.StateProvisioned, imageURL)
+		reconcile()
+
+		bmh := getBMH()
+		Expect(bmh.Annotations).To(HaveKeyWithValue(relocationv1alpha1.ClusterDeprovisionAnnotation, key.String()))
+		Expect(bmh.Spec.Image).To(BeNil())
+		Expect(bmh.Spec.AutomatedCleaningMode).To(Equal(bmh_v1alpha1.CleaningModeMetadata))
+		Expect(bmh.Spec.Online).To(BeFalse())
+
+		Expect(getDeprovision().Finalizers).To(ContainElement(clusterDeprovisionFinalizerName))
+		cond := deprovisioned()
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Reason).To(Equal(relocationv1alpha1.DeprovisioningReason))
+
+		setProvisioning(bmh_v1alpha1.StateAvailable, "")
+		reconcile()
+		cond = deprovisioned()
+		Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+		Expect(cond.Reason).To(Equal(relocationv1alpha1.HostDeprovisionedReason))
+	})
+
+	It("rejects hosts in other namespaces", func() {
+		other := types.NamespacedName{Namespace: "other-namespace", Name: "test-bmh"}
+		Expect(c.Create(ctx, &bmh_v1alpha1.BareMetalHost{
+			ObjectMeta: metav1.ObjectMeta{Name: other.Name, Namespace: other.Namespace},
+			Spec:       bmh_v1alpha1.BareMetalHostSpec{Image: &bmh_v1alpha1.Image{URL: imageURL}},
+		})).To(Succeed())
+		createDeprovision(relocationv1alpha1.ClusterDeprovisionSpec{
+			BareMetalHostRef: &relocationv1alpha1.BareMetalHostReference{Name: other.Name, Namespace: other.Namespace},
+		})
+		reconcile()
+
+		bmh := &bmh_v1alpha1.BareMetalHost{}
+		Expect(c.Get(ctx, other, bmh)).To(Succeed())
+		Expect(bmh.Spec.Image).NotTo(BeNil())
+		Expect(bmh.Annotations).NotTo(HaveKey(relocationv1alpha1.ClusterDeprovisionAnnotation))
+		cond := deprovisioned()
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Reason).To(Equal(relocationv1alpha1.DeprovisionFailedReason))
+	})
+
+	It("rejects externally provisioned hosts", func() {
+		bmh := getBMH()
+		bmh.Spec.ExternallyProvisioned = true
+		Expect(c.Update(ctx, bmh)).To(Succeed())
+		createDeprovision(relocationv1alpha1.ClusterDeprovisionSpec{})
+		reconcile()
+
+		Expect(getBMH().Spec.Image).NotTo(BeNil())
+		Expect(deprovisioned().Reason).To(Equal(relocationv1alpha1.DeprovisionFailedReason))
+	})
+
+	It("waits for ClusterConfigs referencing the host to be deleted", func() {
+		config := &relocationv1alpha1.ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-config", Namespace: key.Namespace},
+			Spec: relocationv1alpha1.ClusterConfigSpec{
+				BareMetalHostRef: &relocationv1alpha1.BareMetalHostReference{Name: bmhKey.Name, Namespace: bmhKey.Namespace},
+			},
+		}
+		Expect(c.Create(ctx, config)).To(Succeed())
+		createDeprovision(relocationv1alpha1.ClusterDeprovisionSpec{})
+		reconcile()
+
+		Expect(getBMH().Spec.Image).NotTo(BeNil())
+		cond := deprovisioned()
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Reason).To(Equal(relocationv1alpha1.HostInUseReason))
+		Expect(cond.Message).To(ContainSubstring("test-namespace/test-config"))
+
+		Expect(r.mapHostToDeprovisions(ctx, config)).To(ConsistOf(ctrl.Request{NamespacedName: key}))
+		Expect(c.Delete(ctx, config)).To(Succeed())
+		reconcile()
+		Expect(getBMH().Spec.Image).To(BeNil())
+	})
+
+	It("reports a missing host", func() {
+		createDeprovision(relocationv1alpha1.ClusterDeprovisionSpec{
+			BareMetalHostRef: &relocationv1alpha1.BareMetalHostReference{Name: "missing"},
+		})
+		reconcile()
+
+		cond := deprovisioned()
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Reason).To(Equal(relocationv1alpha1.HostNotFoundReason))
+	})
+
+	It("releases the host when deleted", func() {
+		createDeprovision(relocationv1alpha1.ClusterDeprovisionSpec{})
+		reconcile()
+		Expect(getBMH().Annotations).To(HaveKey(relocationv1alpha1.ClusterDeprovisionAnnotation))
+
+		Expect(c.Delete(ctx, getDeprovision())).To(Succeed())
+		reconcile()
+
+		bmh := getBMH()
+		Expect(bmh.Annotations).NotTo(HaveKey(relocationv1alpha1.ClusterDeprovisionAnnotation))
+		Expect(bmh.Spec.Image).To(BeNil())
+		err := c.Get(ctx, key, &relocationv1alpha1.ClusterDeprovision{})
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("keeps a host claimed by another deprovision when deleted", func() {
+		createDeprovision(relocationv1alpha1.ClusterDeprovisionSpec{})
+		reconcile()
+
+		bmh := getBMH()
+		patch := client.MergeFrom(bmh.DeepCopy())
+		bmh.Annotations[relocationv1alpha1.ClusterDeprovisionAnnotation] = "test-namespace/other"
+		Expect(c.Patch(ctx, bmh, patch)).To(Succeed())
+
+		Expect(c.Delete(ctx, getDeprovision())).To(Succeed())
+		reconcile()
+
+		Expect(getBMH().Annotations).To(HaveKeyWithValue(relocationv1alpha1.ClusterDeprovisionAnnotation, "test-namespace/other"))
+		err := c.Get(ctx, key, &relocationv1alpha1.ClusterDeprovision{})
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+	})
+})
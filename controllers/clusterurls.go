@@ -0,0 +1,54 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"net"
+	"net/url"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+)
+
+// apiServerPort is the port the API server of an OpenShift cluster listens on
+const apiServerPort = "6443"
+
+// clusterURLs returns the console and API server URLs of a cluster relocated to domain
+// The console is served by the default ingress controller under apps.<domain>
+func clusterURLs(domain string) (console string, api string) {
+	if domain == "" {
+		return "", ""
+	}
+	consoleURL := url.URL{Scheme: "https", Host: "console-openshift-console.apps." + domain}
+	apiURL := url.URL{Scheme: "https", Host: net.JoinHostPort("api."+domain, apiServerPort)}
+	return consoleURL.String(), apiURL.String()
+}
+
+// setClusterURLs records the console and API server URLs the relocated cluster will be reachable at
+func (r *ClusterConfigReconciler) setClusterURLs(ctx context.Context, config *relocationv1alpha1.ClusterConfig) error {
+	console, api := clusterURLs(config.Spec.Domain)
+	if config.Status.ConsoleURL == console && config.Status.APIURL == api {
+		return nil
+	}
+
+	patch := client.MergeFrom(config.DeepCopy())
+	config.Status.ConsoleURL = console
+	config.Status.APIURL = api
+	return r.Status().Patch(ctx, config, patch)
+}
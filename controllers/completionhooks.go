@@ -0,0 +1,101 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+)
+
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=create
+
+// runCompletionHooks creates the Job for each completion hook which hasn't been run yet and records it in the status
+// Jobs are named after the config and hook so a Job created before the status was updated isn't created again
+func (r *ClusterConfigReconciler) runCompletionHooks(ctx context.Context, log logrus.FieldLogger, config *relocationv1alpha1.ClusterConfig) error {
+	launched := map[string]bool{}
+	for _, h := range config.Status.CompletionHooks {
+		launched[h.Name] = true
+	}
+
+	patch := client.MergeFrom(config.DeepCopy())
+	changed := false
+	for i := range config.Spec.PostCompletionHooks {
+		hook := &config.Spec.PostCompletionHooks[i]
+		if launched[hook.Name] {
+			continue
+		}
+		// configs created before the webhook checked hooks may still hold pods it now rejects
+		path := field.NewPath("spec", "postCompletionHooks").Index(i).Child("template", "spec", "template", "spec")
+		if errs := relocationv1alpha1.ValidateCompletionHookPod(path, &hook.Template.Spec.Template.Spec); len(errs) > 0 {
+			return fmt.Errorf("completion hook %s is not allowed: %w", hook.Name, errs.ToAggregate())
+		}
+		job := completionHookJob(config, hook)
+		if err := r.Create(ctx, job); err != nil && !errors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to create Job for completion hook %s: %w", hook.Name, err)
+		}
+		log.Infof("started completion hook %s as Job %s", hook.Name, job.Name)
+		config.Status.CompletionHooks = append(config.Status.CompletionHooks, relocationv1alpha1.CompletionHookStatus{
+			Name:      hook.Name,
+			JobName:   job.Name,
+			StartTime: metav1.Now(),
+		})
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+	return r.Status().Patch(ctx, config, patch)
+}
+
+// completionHookJob returns the Job to create for hook, run as the completion hook service account
+// It isn't owned by config so it keeps running when CleanupPolicy deletes the config
+func completionHookJob(config *relocationv1alpha1.ClusterConfig, hook *relocationv1alpha1.CompletionHook) *batchv1.Job {
+	job := &batchv1.Job{
+		ObjectMeta: *hook.Template.ObjectMeta.DeepCopy(),
+		Spec:       *hook.Template.Spec.DeepCopy(),
+	}
+	job.Name = config.Name + "-" + hook.Name
+	job.Namespace = config.Namespace
+	job.GenerateName = ""
+	if job.Labels == nil {
+		job.Labels = map[string]string{}
+	}
+	job.Labels[relocationv1alpha1.CompletionHookClusterConfigLabel] = config.Name
+	job.Spec.Template.Spec.ServiceAccountName = relocationv1alpha1.CompletionHookServiceAccount
+	job.Spec.Template.Spec.DeprecatedServiceAccount = ""
+
+	env := []corev1.EnvVar{
+		{Name: "CLUSTER_CONFIG_NAME", Value: config.Name},
+		{Name: "CLUSTER_CONFIG_NAMESPACE", Value: config.Namespace},
+	}
+	containers := job.Spec.Template.Spec.Containers
+	for i := range containers {
+		containers[i].Env = append(containers[i].Env, env...)
+	}
+	return job
+}
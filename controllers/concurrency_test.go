@@ -0,0 +1,176 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	cro "github.com/RHsyseng/cluster-relocation-operator/api/v1beta1"
+	"github.com/carbonin/cluster-relocation-service/api/isoschema"
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+	"github.com/carbonin/cluster-relocation-service/internal/metrics"
+	"github.com/carbonin/cluster-relocation-service/internal/ratelimit"
+	bmh_v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// failingFS fails MkdirAll for paths under dir
+type failingFS struct {
+	osFileSystem
+	dir string
+}
+
+func (f failingFS) MkdirAll(path string, perm fs.FileMode) error {
+	if rel, err := filepath.Rel(f.dir, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return errors.New("disk full")
+	}
+	return f.osFileSystem.MkdirAll(path, perm)
+}
+
+// Run with -race (make test-race) to check the reconciler for data races
+var _ = Describe("concurrent Reconcile", func() {
+	const (
+		configName      = "test-config"
+		configNamespace = "test-namespace"
+		reconcilers     = 8
+	)
+	var (
+		c       client.Client
+		dataDir string
+		r       *ClusterConfigReconciler
+		ctx     = context.Background()
+		key     = types.NamespacedName{Namespace: configNamespace, Name: configName}
+	)
+
+	BeforeEach(func() {
+		c = fakeclient.NewClientBuilder().
+			WithScheme(scheme.Scheme).
+			WithStatusSubresource(&relocationv1alpha1.ClusterConfig{}).
+			WithIndex(&relocationv1alpha1.ClusterConfig{}, bmhRefIndex, bmhRefIndexValue).
+			Build()
+		var err error
+		dataDir, err = os.MkdirTemp("", "concurrency_test_data")
+		Expect(err).NotTo(HaveOccurred())
+
+		r = &ClusterConfigReconciler{
+			Client:     c,
+			Scheme:     scheme.Scheme,
+			Log:        logrus.New(),
+			Metrics:    metrics.NewClusterConfigCollector(10),
+			BMHPatches: ratelimit.NewKeyedLimiter(100, 100),
+			Options: &ClusterConfigReconcilerOptions{
+				ServiceName:      "service",
+				ServiceNamespace: "namespace",
+				ServiceScheme:    "https",
+				DataDir:          dataDir,
+			},
+		}
+
+		s := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "pull-secret", Namespace: configNamespace},
+			Data:       map[string][]byte{".dockerconfigjson": []byte("{}")},
+		}
+		Expect(c.Create(ctx, s)).To(Succeed())
+		bmh := &bmh_v1alpha1.BareMetalHost{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-bmh", Namespace: "test-bmh-namespace"},
+		}
+		Expect(c.Create(ctx, bmh)).To(Succeed())
+		config := &relocationv1alpha1.ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: configName, Namespace: configNamespace},
+			Spec: relocationv1alpha1.ClusterConfigSpec{
+				ClusterRelocationSpec: cro.ClusterRelocationSpec{
+					Domain:        "thing.example.com",
+					PullSecretRef: &corev1.SecretReference{Name: "pull-secret", Namespace: configNamespace},
+				},
+				BareMetalHostRef: &relocationv1alpha1.BareMetalHostReference{Name: "test-bmh", Namespace: "test-bmh-namespace"},
+			},
+		}
+		Expect(c.Create(ctx, config)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dataDir)).To(Succeed())
+	})
+
+	// reconcileAll reconciles the config from several goroutines at once and returns their errors
+	reconcileAll := func() []error {
+		var wg sync.WaitGroup
+		errs := make([]error, reconcilers)
+		for i := 0; i < reconcilers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, errs[i] = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			}(i)
+		}
+		wg.Wait()
+		return errs
+	}
+
+	It("renders a single consistent payload", func() {
+		// updates and patches of the same object conflict when made concurrently, the controller retries those
+		for round := 0; round < 2; round++ {
+			for _, err := range reconcileAll() {
+				if err != nil {
+					Expect(apierrors.IsConflict(err)).To(BeTrue(), "unexpected error: %v", err)
+				}
+			}
+		}
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+
+		config := &relocationv1alpha1.ClusterConfig{}
+		Expect(c.Get(ctx, key, config)).To(Succeed())
+		Expect(config.Status.Phase).To(Equal(relocationv1alpha1.ClusterConfigPhaseImageAttached))
+		Expect(config.Status.Attempts).To(HaveLen(1))
+
+		reader, err := isoschema.NewReader(os.DirFS(filepath.Join(dataDir, "namespaces", configNamespace, configName, "files")))
+		Expect(err).NotTo(HaveOccurred())
+		hash, err := reader.Verify()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hash).To(Equal(config.Status.PayloadHash))
+
+		bmh := &bmh_v1alpha1.BareMetalHost{}
+		Expect(c.Get(ctx, types.NamespacedName{Namespace: "test-bmh-namespace", Name: "test-bmh"}, bmh)).To(Succeed())
+		Expect(bmh.Spec.Image.URL).To(Equal(config.Status.ImageURL))
+	})
+
+	It("reports data directory failures in the reconciled condition", func() {
+		r.FS = failingFS{dir: dataDir}
+
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).To(MatchError(ContainSubstring("disk full")))
+
+		config := &relocationv1alpha1.ClusterConfig{}
+		Expect(c.Get(ctx, key, config)).To(Succeed())
+		cond := meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.ReconciledCondition)
+		Expect(cond).NotTo(BeNil())
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Message).To(ContainSubstring("disk full"))
+	})
+
+	It("uses the service URL without setting BaseURL", func() {
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.BaseURL).To(BeEmpty())
+
+		config := &relocationv1alpha1.ClusterConfig{}
+		Expect(c.Get(ctx, key, config)).To(Succeed())
+		Expect(config.Status.ImageURL).To(Equal("https://service.namespace/images/test-namespace/test-config.iso"))
+	})
+})
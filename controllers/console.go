@@ -0,0 +1,88 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+)
+
+// consoleProgress is the progress shown by console integrations for each phase
+var consoleProgress = map[relocationv1alpha1.ClusterConfigPhase]struct {
+	percent int
+	message string
+}{
+	relocationv1alpha1.ClusterConfigPhasePending:       {0, "Rendering the cluster configuration"},
+	relocationv1alpha1.ClusterConfigPhaseImageReady:    {25, "The configuration image is ready to be attached to the host"},
+	relocationv1alpha1.ClusterConfigPhaseImageAttached: {50, "The configuration image is attached to the host, waiting for the relocated cluster to report success"},
+	relocationv1alpha1.ClusterConfigPhaseCompleted:     {100, "The relocation has completed"},
+	relocationv1alpha1.ClusterConfigPhaseFailed:        {50, "The host failed to provision the configuration image"},
+	relocationv1alpha1.ClusterConfigPhaseAborted:       {0, "The relocation was aborted"},
+}
+
+// setConsoleProgress sets the phase label and progress annotations for the current phase of config
+// Nothing is changed unless console annotations are enabled
+func (r *ClusterConfigReconciler) setConsoleProgress(ctx context.Context, config *relocationv1alpha1.ClusterConfig) error {
+	if !r.Options.ConsoleAnnotations {
+		return nil
+	}
+	progress, ok := consoleProgress[config.Status.Phase]
+	if !ok {
+		return nil
+	}
+
+	annotations := map[string]string{
+		relocationv1alpha1.ProgressPercentAnnotation: strconv.Itoa(progress.percent),
+		relocationv1alpha1.ProgressMessageAnnotation: progress.message,
+	}
+	if r.Options.ConsoleLogsURL != "" {
+		annotations[relocationv1alpha1.ConsoleLogsURLAnnotation] = consoleLogsURL(r.Options.ConsoleLogsURL, config)
+	}
+
+	patch := client.MergeFrom(config.DeepCopy())
+	changed := false
+	if config.Labels[relocationv1alpha1.PhaseLabel] != string(config.Status.Phase) {
+		if config.Labels == nil {
+			config.Labels = map[string]string{}
+		}
+		config.Labels[relocationv1alpha1.PhaseLabel] = string(config.Status.Phase)
+		changed = true
+	}
+	for k, v := range annotations {
+		if config.Annotations[k] != v {
+			if config.Annotations == nil {
+				config.Annotations = map[string]string{}
+			}
+			config.Annotations[k] = v
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return r.Patch(ctx, config, patch)
+}
+
+// consoleLogsURL returns the logs link for config from the configured template
+func consoleLogsURL(template string, config *relocationv1alpha1.ClusterConfig) string {
+	return strings.NewReplacer("{namespace}", config.Namespace, "{name}", config.Name).Replace(template)
+}
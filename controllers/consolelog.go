@@ -0,0 +1,240 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	bmh_v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+	"github.com/carbonin/cluster-relocation-service/internal/apiserver"
+	"github.com/carbonin/cluster-relocation-service/internal/filelock"
+	"github.com/carbonin/cluster-relocation-service/internal/httpclient"
+)
+
+// consoleLogName returns the name of the console output captured during attempt
+func consoleLogName(attempt *relocationv1alpha1.RelocationAttempt) string {
+	return fmt.Sprintf("%d.log", attempt.StartTime.Unix())
+}
+
+// captureConsoleLog stores the end of the host console output while the latest attempt of config is in progress
+// and removes the output of attempts no longer in the history. It returns how long to wait before capturing it
+// again, zero once the attempt is over. Console output is only for debugging so failing to fetch it is logged
+// without holding up the relocation
+func (r *ClusterConfigReconciler) captureConsoleLog(ctx context.Context, log logrus.FieldLogger, config *relocationv1alpha1.ClusterConfig) (time.Duration, error) {
+	n := len(config.Status.Attempts)
+	if r.Options.ConsoleLogSourceURL == "" || config.Spec.BareMetalHostRef == nil || n == 0 ||
+		config.Status.Attempts[n-1].Outcome != relocationv1alpha1.RelocationAttemptInProgress {
+		return 0, nil
+	}
+
+	output, err := r.fetchConsoleLog(ctx, configBMHRef(config))
+	if err != nil {
+		log.WithError(err).Warn("failed to capture host console output")
+		return r.Options.ConsoleLogInterval, nil
+	}
+
+	name := consoleLogName(&config.Status.Attempts[n-1])
+	configDir := r.configDir(config)
+	lockCtx, cancel := r.lockContext(ctx)
+	defer cancel()
+	locked, err := filelock.WithFencedWriteLockContext(lockCtx, configDir, r.Lease, func() error {
+		dir := filepath.Join(configDir, apiserver.ConsoleLogDir)
+		if err := r.fs().MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+		if err := writeFileAtomic(filepath.Join(dir, name), output); err != nil {
+			return err
+		}
+		return r.pruneConsoleLogs(dir, config.Status.Attempts)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to store console output: %w", err)
+	}
+	if !locked {
+		log.Info("timed out waiting for config dir lock, capturing console output later")
+		return r.Options.ConsoleLogInterval, nil
+	}
+
+	if config.Status.Attempts[n-1].ConsoleLog != name {
+		patch := client.MergeFrom(config.DeepCopy())
+		config.Status.Attempts[n-1].ConsoleLog = name
+		if err := r.Status().Patch(ctx, config, patch); err != nil {
+			return 0, err
+		}
+	}
+	return r.Options.ConsoleLogInterval, nil
+}
+
+// pruneConsoleLogs removes the console output in dir of attempts which are no longer recorded
+func (r *ClusterConfigReconciler) pruneConsoleLogs(dir string, attempts []relocationv1alpha1.RelocationAttempt) error {
+	keep := map[string]bool{}
+	for i := range attempts {
+		keep[consoleLogName(&attempts[i])] = true
+	}
+	entries, err := r.fs().ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if keep[entry.Name()] {
+			continue
+		}
+		if err := r.fs().Remove(filepath.Join(dir, entry.Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// maxLogEntriesSize bounds the log entry collections read from BMCs, which are parsed as a whole
+const maxLogEntriesSize = 16 * 1024 * 1024
+
+// fetchConsoleLog returns the last ConsoleLogMaxSize bytes of console output from the console log source of
+// the host referenced by ref. Requests to the BMC of the host use its credentials and are made directly rather than
+// through the cluster proxy, as ironic does. Redfish log entry collections are converted to their messages
+func (r *ClusterConfigReconciler) fetchConsoleLog(ctx context.Context, ref *relocationv1alpha1.BareMetalHostReference) ([]byte, error) {
+	bmh := &bmh_v1alpha1.BareMetalHost{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}, bmh); err != nil {
+		return nil, err
+	}
+	source := r.Options.ConsoleLogSourceURL
+	fromBMC := strings.Contains(source, "{bmc}")
+	if fromBMC {
+		bmc, err := url.Parse(bmh.Spec.BMC.Address)
+		if err != nil || bmc.Host == "" {
+			return nil, fmt.Errorf("failed to parse BMC address %q", bmh.Spec.BMC.Address)
+		}
+		source = strings.ReplaceAll(source, "{bmc}", bmc.Host)
+	}
+	source = strings.NewReplacer("{namespace}", url.PathEscape(bmh.Namespace), "{name}", url.PathEscape(bmh.Name)).Replace(source)
+
+	factory := r.HTTPClients
+	if factory == nil {
+		factory = &httpclient.Factory{Reader: r.Client}
+	}
+	c, err := factory.Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	if fromBMC {
+		// BMCs are on the management network, which the cluster proxy usually can't reach
+		transport := c.Transport.(*http.Transport)
+		transport.Proxy = nil
+		if bmh.Spec.BMC.DisableCertificateVerification {
+			// the host is already managed without verifying its BMC certificate
+			transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: true}
+		}
+		secret := &corev1.Secret{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: bmh.Namespace, Name: bmh.Spec.BMC.CredentialsName}, secret); err != nil {
+			return nil, fmt.Errorf("failed to get BMC credentials: %w", err)
+		}
+		req.SetBasicAuth(string(secret.Data["username"]), string(secret.Data["password"]))
+	} else {
+		// sources supporting ranges only send the end of the output, Redfish doesn't support them
+		req.Header.Set("Range", fmt.Sprintf("bytes=-%d", r.Options.ConsoleLogMaxSize))
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("unexpected status %d from console log source", resp.StatusCode)
+	}
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		return logEntriesTail(io.LimitReader(resp.Body, maxLogEntriesSize), r.Options.ConsoleLogMaxSize)
+	}
+	return readTail(resp.Body, r.Options.ConsoleLogMaxSize)
+}
+
+// logEntriesTail returns the last n bytes of the messages in the Redfish LogEntry collection read from src,
+// one entry per line. Only the entries in the collection are read, further pages aren't followed
+func logEntriesTail(src io.Reader, n int64) ([]byte, error) {
+	collection := struct {
+		Members []struct {
+			Message string `json:"Message"`
+		} `json:"Members"`
+	}{}
+	if err := json.NewDecoder(src).Decode(&collection); err != nil {
+		return nil, fmt.Errorf("failed to parse console log entries: %w", err)
+	}
+	var buf bytes.Buffer
+	for _, entry := range collection.Members {
+		buf.WriteString(entry.Message)
+		if !strings.HasSuffix(entry.Message, "\n") {
+			buf.WriteByte('\n')
+		}
+	}
+	return readTail(&buf, n)
+}
+
+// readTail returns the last n bytes read from src, sources which don't support ranges send all of their output
+func readTail(src io.Reader, n int64) ([]byte, error) {
+	buf := make([]byte, 0, n)
+	chunk := make([]byte, 32*1024)
+	for {
+		read, err := src.Read(chunk)
+		buf = append(buf, chunk[:read]...)
+		if int64(len(buf)) > n {
+			buf = append(buf[:0], buf[int64(len(buf))-n:]...)
+		}
+		if err == io.EOF {
+			return buf, nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// writeFileAtomic replaces the file at path with data so readers never see a partial file
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-"+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,200 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	cro "github.com/RHsyseng/cluster-relocation-operator/api/v1beta1"
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+	"github.com/carbonin/cluster-relocation-service/internal/apiserver"
+	"github.com/carbonin/cluster-relocation-service/internal/httpclient"
+	bmh_v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("captureConsoleLog", func() {
+	var (
+		c        client.Client
+		dataDir  string
+		r        *ClusterConfigReconciler
+		source   *httptest.Server
+		output   string
+		requests []*http.Request
+		ctx      = context.Background()
+		key      = types.NamespacedName{Namespace: "test-namespace", Name: "test-config"}
+	)
+
+	BeforeEach(func() {
+		c = fakeclient.NewClientBuilder().
+			WithScheme(scheme.Scheme).
+			WithStatusSubresource(&relocationv1alpha1.ClusterConfig{}).
+			WithIndex(&relocationv1alpha1.ClusterConfig{}, bmhRefIndex, bmhRefIndexValue).
+			Build()
+		var err error
+		dataDir, err = os.MkdirTemp("", "consolelog_test_data")
+		Expect(err).NotTo(HaveOccurred())
+
+		output = "kernel: booting\nignition: fetching config\n"
+		requests = nil
+		source = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			requests = append(requests, req)
+			if strings.HasPrefix(req.URL.Path, "/redfish/") {
+				w.Header().Set("Content-Type", "application/json")
+			}
+			_, _ = w.Write([]byte(output))
+		}))
+
+		r = &ClusterConfigReconciler{
+			Client:      c,
+			Scheme:      scheme.Scheme,
+			Log:         logrus.New(),
+			BaseURL:     "https://service.namespace",
+			HTTPClients: &httpclient.Factory{Reader: c},
+			Options: &ClusterConfigReconcilerOptions{
+				DataDir:             dataDir,
+				ConsoleLogSourceURL: source.URL + "/consoles/{namespace}/{name}",
+				ConsoleLogInterval:  time.Minute,
+				ConsoleLogMaxSize:   16,
+			},
+		}
+
+		bmh := &bmh_v1alpha1.BareMetalHost{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-bmh", Namespace: "test-bmh-namespace"},
+			Spec: bmh_v1alpha1.BareMetalHostSpec{
+				BMC: bmh_v1alpha1.BMCDetails{
+					Address:         "redfish-virtualmedia+" + source.URL + "/redfish/v1/Systems/1",
+					CredentialsName: "bmc-secret",
+				},
+			},
+		}
+		Expect(c.Create(ctx, bmh)).To(Succeed())
+		config := &relocationv1alpha1.ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+			Spec: relocationv1alpha1.ClusterConfigSpec{
+				ClusterRelocationSpec: cro.ClusterRelocationSpec{Domain: "thing.example.com"},
+				BareMetalHostRef:      &relocationv1alpha1.BareMetalHostReference{Name: "test-bmh", Namespace: "test-bmh-namespace"},
+			},
+		}
+		Expect(c.Create(ctx, config)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		source.Close()
+		Expect(os.RemoveAll(dataDir)).To(Succeed())
+	})
+
+	consoleLog := func() (string, string) {
+		config := &relocationv1alpha1.ClusterConfig{}
+		Expect(c.Get(ctx, key, config)).To(Succeed())
+		Expect(config.Status.Attempts).To(HaveLen(1))
+		name := config.Status.Attempts[0].ConsoleLog
+		Expect(name).NotTo(BeEmpty())
+		content, err := os.ReadFile(filepath.Join(r.configDir(config), apiserver.ConsoleLogDir, name))
+		Expect(err).NotTo(HaveOccurred())
+		return name, string(content)
+	}
+
+	It("stores the end of the console output while the attempt is in progress", func() {
+		res, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.RequeueAfter).To(Equal(time.Minute))
+
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].URL.Path).To(Equal("/consoles/test-bmh-namespace/test-bmh"))
+		Expect(requests[0].Header.Get("Range")).To(Equal("bytes=-16"))
+		_, _, hasAuth := requests[0].BasicAuth()
+		Expect(hasAuth).To(BeFalse())
+
+		name, content := consoleLog()
+		Expect(content).To(Equal("fetching config\n"))
+
+		output = "ignition: done\n"
+		_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		name2, content := consoleLog()
+		Expect(name2).To(Equal(name))
+		Expect(content).To(Equal("ignition: done\n"))
+	})
+
+	It("uses the BMC credentials for the BMC console", func() {
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "bmc-secret", Namespace: "test-bmh-namespace"},
+			Data:       map[string][]byte{"username": []byte("admin"), "password": []byte("secret")},
+		}
+		Expect(c.Create(ctx, secret)).To(Succeed())
+		r.Options.ConsoleLogSourceURL = "http://{bmc}/redfish/v1/Systems/1/LogServices/SerialConsole/Entries"
+		output = `{"Members": [{"Id": "1", "Message": "kernel: booting"}, {"Id": "2", "Message": "ignition: done\n"}]}`
+
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].URL.Path).To(Equal("/redfish/v1/Systems/1/LogServices/SerialConsole/Entries"))
+		Expect(requests[0].Header.Get("Range")).To(BeEmpty())
+		user, password, _ := requests[0].BasicAuth()
+		Expect(user).To(Equal("admin"))
+		Expect(password).To(Equal("secret"))
+
+		// the messages of the log entries are stored rather than the collection
+		_, content := consoleLog()
+		Expect(content).To(Equal("\nignition: done\n"))
+	})
+
+	It("doesn't fail the reconcile when the output can't be fetched", func() {
+		r.Options.ConsoleLogSourceURL = source.URL + "/missing"
+		source.Config.Handler = http.NotFoundHandler()
+
+		res, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.RequeueAfter).To(Equal(time.Minute))
+
+		config := &relocationv1alpha1.ClusterConfig{}
+		Expect(c.Get(ctx, key, config)).To(Succeed())
+		Expect(config.Status.Attempts).To(HaveLen(1))
+		Expect(config.Status.Attempts[0].ConsoleLog).To(BeEmpty())
+	})
+
+	It("stops capturing once the attempt is over and prunes output of old attempts", func() {
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		config := &relocationv1alpha1.ClusterConfig{}
+		Expect(c.Get(ctx, key, config)).To(Succeed())
+		dir := filepath.Join(r.configDir(config), apiserver.ConsoleLogDir)
+		Expect(os.WriteFile(filepath.Join(dir, "1.log"), []byte("dropped attempt"), 0600)).To(Succeed())
+
+		config.Status.Attempts[0].Outcome = relocationv1alpha1.RelocationAttemptSucceeded
+		wait, err := r.captureConsoleLog(ctx, r.Log, config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(wait).To(BeZero())
+		Expect(requests).To(HaveLen(1))
+
+		config.Status.Attempts[0].Outcome = relocationv1alpha1.RelocationAttemptInProgress
+		_, err = r.captureConsoleLog(ctx, r.Log, config)
+		Expect(err).NotTo(HaveOccurred())
+		entries, err := os.ReadDir(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].Name()).To(Equal(config.Status.Attempts[0].ConsoleLog))
+	})
+})
+
+var _ = Describe("readTail", func() {
+	It("keeps the last bytes of long output", func() {
+		data := strings.Repeat("a", 100*1024) + "end"
+		Expect(readTail(strings.NewReader(data), 5)).To(Equal([]byte("aaend")))
+		Expect(readTail(strings.NewReader("short"), 10)).To(Equal([]byte("short")))
+	})
+})
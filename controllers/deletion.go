@@ -0,0 +1,161 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+	"github.com/carbonin/cluster-relocation-service/internal/metrics"
+)
+
+const (
+	// deletionQueueName names the deletion queue in the workqueue metrics
+	deletionQueueName = "clusterconfig_deletion"
+	// deletionRetryBaseDelay and deletionRetryMaxDelay bound the wait before a failed cleanup is retried
+	deletionRetryBaseDelay = time.Second
+	deletionRetryMaxDelay  = 5 * time.Minute
+	// cleanupSkippedReason is the event reason when a deleted config's finalizer is removed without a complete cleanup
+	cleanupSkippedReason = "CleanupSkipped"
+)
+
+// DeletionQueue removes the data and finalizers of deleted ClusterConfigs outside of the reconcile loop
+// Deleting a namespace of configs then only runs Workers cleanups at once and doesn't hold up reconciles of
+// configs that are still being provisioned
+type DeletionQueue struct {
+	Reconciler *ClusterConfigReconciler
+	Workers    int
+
+	queue workqueue.RateLimitingInterface
+}
+
+// NewDeletionQueue returns a queue running the cleanups of r with the given number of workers
+func NewDeletionQueue(r *ClusterConfigReconciler, workers int) *DeletionQueue {
+	return &DeletionQueue{
+		Reconciler: r,
+		Workers:    workers,
+		queue: workqueue.NewRateLimitingQueueWithConfig(
+			workqueue.NewItemExponentialFailureRateLimiter(deletionRetryBaseDelay, deletionRetryMaxDelay),
+			workqueue.RateLimitingQueueConfig{Name: deletionQueueName},
+		),
+	}
+}
+
+// Add queues the cleanup of a deleted config, it is a no-op if the config is already queued
+func (q *DeletionQueue) Add(key types.NamespacedName) {
+	q.queue.Add(key)
+}
+
+// Len returns the number of configs waiting to be cleaned up
+func (q *DeletionQueue) Len() int {
+	return q.queue.Len()
+}
+
+// Start runs the workers until the context is cancelled
+func (q *DeletionQueue) Start(ctx context.Context) error {
+	go func() {
+		<-ctx.Done()
+		q.queue.ShutDown()
+	}()
+	for i := 0; i < q.Workers; i++ {
+		go wait.UntilWithContext(ctx, func(ctx context.Context) {
+			for q.processNext(ctx) {
+			}
+		}, time.Second)
+	}
+	<-ctx.Done()
+	return nil
+}
+
+// processNext cleans up the next queued config and returns false once the queue is shut down
+func (q *DeletionQueue) processNext(ctx context.Context) bool {
+	item, shutdown := q.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer q.queue.Done(item)
+
+	key := item.(types.NamespacedName)
+	if q.cleanup(ctx, key) {
+		q.queue.Forget(item)
+	} else {
+		q.queue.AddRateLimited(item)
+	}
+	return true
+}
+
+// cleanup runs the deletion cleanup for the config with key and returns false if it should be retried
+func (q *DeletionQueue) cleanup(ctx context.Context, key types.NamespacedName) bool {
+	r := q.Reconciler
+	log := r.Log.WithFields(logrus.Fields{"name": key.Name, "namespace": key.Namespace})
+	config := &relocationv1alpha1.ClusterConfig{}
+	if err := r.Get(ctx, key, config); err != nil {
+		if errors.IsNotFound(err) {
+			return true
+		}
+		log.WithError(err).Error("failed to get deleted cluster config")
+		metrics.DeletionCleanups.WithLabelValues("retried").Inc()
+		return false
+	}
+	if config.DeletionTimestamp.IsZero() || !controllerutil.ContainsFinalizer(config, clusterConfigFinalizerName) {
+		return true
+	}
+
+	res, err := r.cleanupDeleted(ctx, log, config)
+	if err != nil || res.Requeue {
+		metrics.DeletionCleanups.WithLabelValues("retried").Inc()
+		return false
+	}
+	metrics.DeletionCleanups.WithLabelValues("completed").Inc()
+	return true
+}
+
+// cleanupDependents reverts the changes made for config to objects outside the data dir
+func (r *ClusterConfigReconciler) cleanupDependents(ctx context.Context, config *relocationv1alpha1.ClusterConfig) error {
+	if err := r.removeBMHOwner(ctx, config); err != nil {
+		return fmt.Errorf("failed to remove BareMetalHost owner annotation: %w", err)
+	}
+	if err := r.removeNetworkData(ctx, config); err != nil {
+		return fmt.Errorf("failed to remove BareMetalHost network data: %w", err)
+	}
+	return nil
+}
+
+// namespaceTerminating returns true if the namespace is being deleted or already gone
+// Errors reading the namespace are treated as the namespace being active so the cleanup is retried
+func (r *ClusterConfigReconciler) namespaceTerminating(ctx context.Context, name string) bool {
+	var reader client.Reader = r.Client
+	if r.APIReader != nil {
+		reader = r.APIReader
+	}
+	ns := &corev1.Namespace{}
+	if err := reader.Get(ctx, types.NamespacedName{Name: name}, ns); err != nil {
+		return errors.IsNotFound(err)
+	}
+	return ns.DeletionTimestamp != nil || ns.Status.Phase == corev1.NamespaceTerminating
+}
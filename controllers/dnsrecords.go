@@ -0,0 +1,146 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+	"github.com/carbonin/cluster-relocation-service/internal/report"
+)
+
+// dnsEndpointGVK identifies the external-dns DNSEndpoint kind
+// It's used as unstructured to avoid depending on the external-dns module
+var dnsEndpointGVK = schema.GroupVersionKind{Group: "externaldns.k8s.io", Version: "v1alpha1", Kind: "DNSEndpoint"}
+
+// unstructured objects are read directly from the API server rather than the cache
+//+kubebuilder:rbac:groups=externaldns.k8s.io,resources=dnsendpoints,verbs=get;create;update;delete
+
+// dnsEndpoints returns the external-dns endpoints mapping the API and apps domains of a cluster relocated to domain
+// to its virtual IPs, one per record type. Nothing is returned without a domain or virtual IPs
+func dnsEndpoints(domain string, network *relocationv1alpha1.ClusterNetwork) []interface{} {
+	if domain == "" || network == nil {
+		return nil
+	}
+	var endpoints []interface{}
+	add := func(name string, vips []string) {
+		targets := map[string][]interface{}{}
+		for _, vip := range vips {
+			ip := net.ParseIP(vip)
+			if ip == nil {
+				continue
+			}
+			recordType := "AAAA"
+			if ip.To4() != nil {
+				recordType = "A"
+			}
+			targets[recordType] = append(targets[recordType], vip)
+		}
+		for _, recordType := range []string{"A", "AAAA"} {
+			if len(targets[recordType]) == 0 {
+				continue
+			}
+			endpoints = append(endpoints, map[string]interface{}{
+				"dnsName":    name,
+				"recordType": recordType,
+				"targets":    targets[recordType],
+			})
+		}
+	}
+	add("api."+domain, network.APIVIPs)
+	add("*.apps."+domain, network.IngressVIPs)
+	return endpoints
+}
+
+// syncDNSRecords creates or updates a DNSEndpoint named after config in its namespace so external-dns publishes
+// records for the relocated cluster's domain on the hub once the relocation has completed. It is only deleted when
+// there is nothing to publish if it was created, which the DNSRecordsPublished condition records.
+// The DNSEndpoint is owned by config so it is removed with it, unless the DeleteClusterConfig cleanup policy deletes
+// config as soon as the relocation completes, in which case the records are kept and must be removed by the user
+func (r *ClusterConfigReconciler) syncDNSRecords(ctx context.Context, config *relocationv1alpha1.ClusterConfig) error {
+	if !r.Options.DNSRecords || !meta.IsStatusConditionTrue(config.Status.Conditions, relocationv1alpha1.RelocationCompletedCondition) {
+		return nil
+	}
+
+	endpoint := &unstructured.Unstructured{}
+	endpoint.SetGroupVersionKind(dnsEndpointGVK)
+	endpoint.SetName(config.Name)
+	endpoint.SetNamespace(config.Namespace)
+
+	endpoints := dnsEndpoints(config.Spec.Domain, config.Spec.Network)
+	if len(endpoints) == 0 {
+		if meta.IsStatusConditionTrue(config.Status.Conditions, relocationv1alpha1.DNSRecordsPublishedCondition) {
+			if err := r.Delete(ctx, endpoint); client.IgnoreNotFound(err) != nil && !meta.IsNoMatchError(err) {
+				return err
+			}
+		}
+		return r.setDNSRecordsPublished(ctx, config, relocationv1alpha1.NoDNSRecordsReason,
+			"the ClusterConfig has no domain or virtual IPs to publish DNS records for")
+	}
+
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, endpoint, func() error {
+		if config.Spec.CleanupPolicy == relocationv1alpha1.CleanupPolicyDeleteClusterConfig {
+			endpoint.SetOwnerReferences(nil)
+		} else {
+			endpoint.SetOwnerReferences([]metav1.OwnerReference{
+				*metav1.NewControllerRef(config, relocationv1alpha1.GroupVersion.WithKind("ClusterConfig")),
+			})
+		}
+		return unstructured.SetNestedSlice(endpoint.Object, endpoints, "spec", "endpoints")
+	})
+	if meta.IsNoMatchError(err) {
+		return r.setDNSRecordsPublished(ctx, config, relocationv1alpha1.DNSEndpointUnavailableReason,
+			fmt.Sprintf("DNS records for %s aren't created as the external-dns DNSEndpoint CRD isn't installed", config.Spec.Domain))
+	}
+	if err != nil {
+		return err
+	}
+	return r.setDNSRecordsPublished(ctx, config, relocationv1alpha1.DNSEndpointCreatedReason,
+		fmt.Sprintf("DNSEndpoint %s/%s holds the records for %s", config.Namespace, config.Name, config.Spec.Domain))
+}
+
+// setDNSRecordsPublished records the outcome of publishing the DNS records of config in the DNSRecordsPublished
+// condition, which is only true for the DNSEndpointCreated reason. A missing CRD is reported once with a warning
+func (r *ClusterConfigReconciler) setDNSRecordsPublished(ctx context.Context, config *relocationv1alpha1.ClusterConfig, reason, message string) error {
+	cond := metav1.Condition{
+		Type:               relocationv1alpha1.DNSRecordsPublishedCondition,
+		Status:             metav1.ConditionFalse,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: config.Generation,
+	}
+	if reason == relocationv1alpha1.DNSEndpointCreatedReason {
+		cond.Status = metav1.ConditionTrue
+	}
+	patch := client.MergeFrom(config.DeepCopy())
+	if !report.SetCondition(&config.Status.Conditions, cond) {
+		return nil
+	}
+	if reason == relocationv1alpha1.DNSEndpointUnavailableReason {
+		r.Notifier.Warningf(config, reason, "%s", message)
+	}
+	return r.Status().Patch(ctx, config, patch)
+}
@@ -0,0 +1,187 @@
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+	"github.com/carbonin/cluster-relocation-service/internal/report"
+)
+
+var _ = Describe("DNS records", func() {
+	var (
+		ctx      = context.Background()
+		c        client.Client
+		r        *ClusterConfigReconciler
+		config   *relocationv1alpha1.ClusterConfig
+		recorder *record.FakeRecorder
+		deletes  int
+		noCRD    bool
+	)
+
+	BeforeEach(func() {
+		deletes = 0
+		noCRD = false
+		recorder = record.NewFakeRecorder(10)
+		c = interceptor.NewClient(fakeclient.NewClientBuilder().
+			WithScheme(scheme.Scheme).
+			WithStatusSubresource(&relocationv1alpha1.ClusterConfig{}).
+			Build(), interceptor.Funcs{
+			Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+				if _, ok := obj.(*unstructured.Unstructured); ok && noCRD {
+					return &meta.NoKindMatchError{GroupKind: dnsEndpointGVK.GroupKind()}
+				}
+				return c.Get(ctx, key, obj, opts...)
+			},
+			Delete: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.DeleteOption) error {
+				deletes++
+				return c.Delete(ctx, obj, opts...)
+			},
+		})
+		r = &ClusterConfigReconciler{
+			Client:   c,
+			Log:      logrus.New(),
+			Notifier: &report.Notifier{Log: logrus.New(), Recorder: recorder},
+			Options:  &ClusterConfigReconcilerOptions{DNSRecords: true},
+		}
+		config = &relocationv1alpha1.ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "site", Namespace: "site"},
+		}
+		config.Spec.Domain = "site.example.com"
+		config.Spec.Network = &relocationv1alpha1.ClusterNetwork{
+			APIVIPs:     []string{"192.0.2.10", "2001:db8::10"},
+			IngressVIPs: []string{"192.0.2.11"},
+		}
+		Expect(c.Create(ctx, config)).To(Succeed())
+		meta.SetStatusCondition(&config.Status.Conditions, metav1.Condition{
+			Type:   relocationv1alpha1.RelocationCompletedCondition,
+			Status: metav1.ConditionTrue,
+			Reason: "Completed",
+		})
+		Expect(c.Status().Update(ctx, config)).To(Succeed())
+	})
+
+	published := func() *metav1.Condition {
+		return meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.DNSRecordsPublishedCondition)
+	}
+
+	getEndpoint := func() (*unstructured.Unstructured, error) {
+		endpoint := &unstructured.Unstructured{}
+		endpoint.SetGroupVersionKind(dnsEndpointGVK)
+		return endpoint, c.Get(ctx, client.ObjectKeyFromObject(config), endpoint)
+	}
+
+	It("maps the api and apps domains to the virtual IPs of each family", func() {
+		Expect(dnsEndpoints(config.Spec.Domain, config.Spec.Network)).To(Equal([]interface{}{
+			map[string]interface{}{"dnsName": "api.site.example.com", "recordType": "A", "targets": []interface{}{"192.0.2.10"}},
+			map[string]interface{}{"dnsName": "api.site.example.com", "recordType": "AAAA", "targets": []interface{}{"2001:db8::10"}},
+			map[string]interface{}{"dnsName": "*.apps.site.example.com", "recordType": "A", "targets": []interface{}{"192.0.2.11"}},
+		}))
+		Expect(dnsEndpoints("", config.Spec.Network)).To(BeEmpty())
+		Expect(dnsEndpoints(config.Spec.Domain, nil)).To(BeEmpty())
+	})
+
+	It("creates a DNSEndpoint owned by the ClusterConfig and removes it without virtual IPs", func() {
+		Expect(r.syncDNSRecords(ctx, config)).To(Succeed())
+		Expect(published().Status).To(Equal(metav1.ConditionTrue))
+		Expect(published().Reason).To(Equal(relocationv1alpha1.DNSEndpointCreatedReason))
+		endpoint, err := getEndpoint()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(endpoint.GetOwnerReferences()).To(HaveLen(1))
+		Expect(endpoint.GetOwnerReferences()[0].UID).To(Equal(config.UID))
+		endpoints, _, err := unstructured.NestedSlice(endpoint.Object, "spec", "endpoints")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(endpoints).To(HaveLen(3))
+
+		config.Spec.Network.APIVIPs = []string{"192.0.2.20"}
+		Expect(r.syncDNSRecords(ctx, config)).To(Succeed())
+		endpoint, err = getEndpoint()
+		Expect(err).NotTo(HaveOccurred())
+		endpoints, _, err = unstructured.NestedSlice(endpoint.Object, "spec", "endpoints")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(endpoints).To(HaveLen(2))
+		Expect(endpoints[0]).To(HaveKeyWithValue("targets", []interface{}{"192.0.2.20"}))
+
+		config.Spec.Network = nil
+		Expect(r.syncDNSRecords(ctx, config)).To(Succeed())
+		_, err = getEndpoint()
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+		Expect(published().Status).To(Equal(metav1.ConditionFalse))
+		Expect(published().Reason).To(Equal(relocationv1alpha1.NoDNSRecordsReason))
+		Expect(deletes).To(Equal(1))
+
+		// the DNSEndpoint is only deleted once
+		Expect(r.syncDNSRecords(ctx, config)).To(Succeed())
+		Expect(deletes).To(Equal(1))
+	})
+
+	It("keeps the records of ClusterConfigs deleted on completion", func() {
+		config.Spec.CleanupPolicy = relocationv1alpha1.CleanupPolicyDeleteClusterConfig
+		Expect(r.syncDNSRecords(ctx, config)).To(Succeed())
+		endpoint, err := getEndpoint()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(endpoint.GetOwnerReferences()).To(BeEmpty())
+
+		// records created before the policy was set are no longer owned either
+		config.Spec.CleanupPolicy = relocationv1alpha1.CleanupPolicyNone
+		Expect(r.syncDNSRecords(ctx, config)).To(Succeed())
+		endpoint, err = getEndpoint()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(endpoint.GetOwnerReferences()).To(HaveLen(1))
+		config.Spec.CleanupPolicy = relocationv1alpha1.CleanupPolicyDeleteClusterConfig
+		Expect(r.syncDNSRecords(ctx, config)).To(Succeed())
+		endpoint, err = getEndpoint()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(endpoint.GetOwnerReferences()).To(BeEmpty())
+	})
+
+	It("doesn't delete records it didn't create", func() {
+		config.Spec.Network = nil
+		Expect(r.syncDNSRecords(ctx, config)).To(Succeed())
+		Expect(deletes).To(BeZero())
+		Expect(published().Reason).To(Equal(relocationv1alpha1.NoDNSRecordsReason))
+	})
+
+	It("doesn't create records unless enabled", func() {
+		r.Options.DNSRecords = false
+		Expect(r.syncDNSRecords(ctx, config)).To(Succeed())
+		_, err := getEndpoint()
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+		Expect(published()).To(BeNil())
+	})
+
+	It("doesn't create records until the relocation has completed", func() {
+		meta.SetStatusCondition(&config.Status.Conditions, metav1.Condition{
+			Type:   relocationv1alpha1.RelocationCompletedCondition,
+			Status: metav1.ConditionFalse,
+			Reason: "InProgress",
+		})
+		Expect(r.syncDNSRecords(ctx, config)).To(Succeed())
+		_, err := getEndpoint()
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+		Expect(published()).To(BeNil())
+	})
+
+	It("reports a missing DNSEndpoint CRD once", func() {
+		noCRD = true
+		Expect(r.syncDNSRecords(ctx, config)).To(Succeed())
+		Expect(published().Status).To(Equal(metav1.ConditionFalse))
+		Expect(published().Reason).To(Equal(relocationv1alpha1.DNSEndpointUnavailableReason))
+		Expect(recorder.Events).To(HaveLen(1))
+
+		Expect(r.syncDNSRecords(ctx, config)).To(Succeed())
+		Expect(recorder.Events).To(HaveLen(1))
+	})
+})
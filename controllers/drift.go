@@ -0,0 +1,73 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+
+	bmh_v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+)
+
+// driftCorrectedReason is the event reason for data changed outside the manager which a reconcile put back
+const driftCorrectedReason = "DriftCorrected"
+
+// reportPayloadDrift warns when rendering the unchanged spec of config changed the payload on disk, which means
+// the files were modified outside the manager, for example by restoring a backup of the data volume
+func (r *ClusterConfigReconciler) reportPayloadDrift(config *relocationv1alpha1.ClusterConfig, payloadHash string, diff *relocationv1alpha1.PayloadDiff) {
+	if diff == nil || config.Status.PayloadHash == "" || config.Status.PayloadHash != payloadHash {
+		return
+	}
+	// changes are ordered by file type
+	var fileTypes []string
+	for _, change := range diff.Changes {
+		if len(fileTypes) == 0 || fileTypes[len(fileTypes)-1] != change.FileType {
+			fileTypes = append(fileTypes, change.FileType)
+		}
+	}
+	r.Notifier.Warningf(config, driftCorrectedReason, "the rendered %s payload files didn't match the ClusterConfig and were rendered again", strings.Join(fileTypes, ", "))
+}
+
+// reportHostDrift warns when the BareMetalHost referenced by config no longer has url attached even though the
+// payload was already attached in the current attempt, which means the host was edited outside the manager
+// or restored from an older backup
+func (r *ClusterConfigReconciler) reportHostDrift(ctx context.Context, config *relocationv1alpha1.ClusterConfig, payloadHash, url string) error {
+	attempts := config.Status.Attempts
+	if len(attempts) == 0 || attempts[len(attempts)-1].PayloadHash != payloadHash ||
+		attempts[len(attempts)-1].Outcome == relocationv1alpha1.RelocationAttemptAborted {
+		return nil
+	}
+
+	ref := configBMHRef(config)
+	bmh := &bmh_v1alpha1.BareMetalHost{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}, bmh); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if bmh.Spec.Image != nil && bmh.Spec.Image.URL == url {
+		return nil
+	}
+	// the URL may contain credentials so it isn't included
+	r.Notifier.Warningf(config, driftCorrectedReason, "BareMetalHost %s/%s no longer had the image of the ClusterConfig attached, attaching it again", ref.Namespace, ref.Name)
+	return nil
+}
@@ -0,0 +1,204 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	routev1 "github.com/openshift/api/route/v1"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+//+kubebuilder:rbac:groups="",resources=services,verbs=get;create;update
+//+kubebuilder:rbac:groups=route.openshift.io,resources=routes,verbs=get;create;update
+//+kubebuilder:rbac:groups=route.openshift.io,resources=routes/custom-host,verbs=create;update
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies,verbs=get;create;update
+
+const (
+	// imageServerLabel selects the image server pods, it must match the label set by the install manifests
+	imageServerLabel = "relocation.openshift.io/image-server"
+	// imageServerPortName is the name of the image server container port
+	imageServerPortName = "config-server"
+	// servingCertAnnotation has the service CA issue a certificate for the Service so a reencrypt Route trusts the server
+	servingCertAnnotation = "service.beta.openshift.io/serving-cert-secret-name"
+	// ingressPolicyGroupLabel is set on the namespaces of the OpenShift router
+	ingressPolicyGroupLabel = "network.openshift.io/policy-group"
+)
+
+// servingCertSecretName is the name of the secret the service CA writes the image server certificate to
+func servingCertSecretName(opts *ClusterConfigReconcilerOptions) string {
+	return opts.ServiceName + "-serving-cert"
+}
+
+// servicePort returns the port the image Service listens on, defaulting to the standard port of the scheme
+func servicePort(opts *ClusterConfigReconcilerOptions) (int32, error) {
+	if opts.ServicePort == "" {
+		if opts.ServiceScheme == "https" {
+			return 443, nil
+		}
+		return 80, nil
+	}
+	port, err := strconv.ParseInt(opts.ServicePort, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid SERVICE_PORT %q: %w", opts.ServicePort, err)
+	}
+	return int32(port), nil
+}
+
+// EnsureEndpoint creates or updates the Service, Route, and NetworkPolicy exposing the image server in the
+// service namespace and returns the base URL it is reachable at. It must be called before the manager starts
+// as the returned URL is set on every BareMetalHost
+func EnsureEndpoint(ctx context.Context, c client.Client, opts *ClusterConfigReconcilerOptions) (string, error) {
+	if opts.EndpointRoute && opts.ServiceScheme != "https" {
+		return "", fmt.Errorf("ENDPOINT_ROUTE uses reencrypt TLS which requires SERVICE_SCHEME to be https")
+	}
+	port, err := servicePort(opts)
+	if err != nil {
+		return "", err
+	}
+	if err := ensureImageService(ctx, c, opts, port); err != nil {
+		return "", fmt.Errorf("failed to ensure image service: %w", err)
+	}
+	if opts.EndpointRoute || len(opts.EndpointAllowedCIDRs) > 0 {
+		if err := ensureNetworkPolicy(ctx, c, opts); err != nil {
+			return "", fmt.Errorf("failed to ensure image server network policy: %w", err)
+		}
+	}
+	if !opts.EndpointRoute {
+		return serviceURL(opts), nil
+	}
+
+	host, err := ensureRoute(ctx, c, opts)
+	if err != nil {
+		return "", fmt.Errorf("failed to ensure image route: %w", err)
+	}
+	u := url.URL{Scheme: "https", Host: host}
+	return u.String(), nil
+}
+
+// EndpointKeeper ensures the endpoint again every Interval so a Service, Route, or NetworkPolicy changed or deleted
+// outside the manager is put back. Zero leaves the endpoint as EnsureEndpoint created it at startup
+type EndpointKeeper struct {
+	Client  client.Client
+	Log     logrus.FieldLogger
+	Options *ClusterConfigReconcilerOptions
+	// URL is the base URL EnsureEndpoint returned at startup, which is the one given to hosts
+	URL      string
+	Interval time.Duration
+}
+
+// Start ensures the endpoint every Interval until the context is cancelled
+func (k *EndpointKeeper) Start(ctx context.Context) error {
+	if k.Interval == 0 {
+		return nil
+	}
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		u, err := EnsureEndpoint(ctx, k.Client, k.Options)
+		if err != nil {
+			k.Log.WithError(err).Error("failed to ensure image server endpoint")
+			return
+		}
+		if u != k.URL {
+			// a generated Route host changes if the Route is recreated, hosts keep the URL they were given
+			k.Log.Warnf("image server endpoint moved from %s to %s, restart the manager to attach images with the new URL", k.URL, u)
+		}
+	}, k.Interval)
+	return nil
+}
+
+func ensureImageService(ctx context.Context, c client.Client, opts *ClusterConfigReconcilerOptions, port int32) error {
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: opts.ServiceName, Namespace: opts.ServiceNamespace}}
+	_, err := controllerutil.CreateOrUpdate(ctx, c, svc, func() error {
+		if opts.EndpointRoute {
+			metav1.SetMetaDataAnnotation(&svc.ObjectMeta, servingCertAnnotation, servingCertSecretName(opts))
+		}
+		svc.Spec.Selector = map[string]string{imageServerLabel: "true"}
+		svc.Spec.Ports = []corev1.ServicePort{{
+			Name:       imageServerPortName,
+			Port:       port,
+			Protocol:   corev1.ProtocolTCP,
+			TargetPort: intstr.FromString(imageServerPortName),
+		}}
+		return nil
+	})
+	return err
+}
+
+// ensureRoute creates or updates the reencrypt Route to the image Service and returns its host
+// OpenShift generates a host when EndpointRouteHost is unset, it is set on the Route returned by the create
+func ensureRoute(ctx context.Context, c client.Client, opts *ClusterConfigReconcilerOptions) (string, error) {
+	route := &routev1.Route{ObjectMeta: metav1.ObjectMeta{Name: opts.ServiceName, Namespace: opts.ServiceNamespace}}
+	_, err := controllerutil.CreateOrUpdate(ctx, c, route, func() error {
+		if opts.EndpointRouteHost != "" {
+			route.Spec.Host = opts.EndpointRouteHost
+		}
+		weight := int32(100)
+		route.Spec.To = routev1.RouteTargetReference{Kind: "Service", Name: opts.ServiceName, Weight: &weight}
+		route.Spec.Port = &routev1.RoutePort{TargetPort: intstr.FromString(imageServerPortName)}
+		route.Spec.TLS = &routev1.TLSConfig{
+			Termination:                   routev1.TLSTerminationReencrypt,
+			InsecureEdgeTerminationPolicy: routev1.InsecureEdgeTerminationPolicyRedirect,
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if route.Spec.Host == "" {
+		return "", fmt.Errorf("route %s/%s has no host, set ENDPOINT_ROUTE_HOST", route.Namespace, route.Name)
+	}
+	return route.Spec.Host, nil
+}
+
+// ensureNetworkPolicy only admits traffic to the image server from EndpointAllowedCIDRs, usually the Ironic
+// and BMC networks, from the router when a Route is used, and from pods in the service namespace
+func ensureNetworkPolicy(ctx context.Context, c client.Client, opts *ClusterConfigReconcilerOptions) error {
+	peers := []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{}}}
+	for _, cidr := range opts.EndpointAllowedCIDRs {
+		peers = append(peers, networkingv1.NetworkPolicyPeer{IPBlock: &networkingv1.IPBlock{CIDR: cidr}})
+	}
+	if opts.EndpointRoute {
+		peers = append(peers, networkingv1.NetworkPolicyPeer{
+			NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{ingressPolicyGroupLabel: "ingress"}},
+		})
+	}
+	port := intstr.FromString(imageServerPortName)
+	protocol := corev1.ProtocolTCP
+
+	policy := &networkingv1.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{Name: opts.ServiceName, Namespace: opts.ServiceNamespace}}
+	_, err := controllerutil.CreateOrUpdate(ctx, c, policy, func() error {
+		policy.Spec.PodSelector = metav1.LabelSelector{MatchLabels: map[string]string{imageServerLabel: "true"}}
+		policy.Spec.PolicyTypes = []networkingv1.PolicyType{networkingv1.PolicyTypeIngress}
+		policy.Spec.Ingress = []networkingv1.NetworkPolicyIngressRule{{
+			Ports: []networkingv1.NetworkPolicyPort{{Protocol: &protocol, Port: &port}},
+			From:  peers,
+		}}
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	routev1 "github.com/openshift/api/route/v1"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("EnsureEndpoint", func() {
+	var (
+		ctx  = context.Background()
+		c    client.Client
+		opts *ClusterConfigReconcilerOptions
+		key  = types.NamespacedName{Name: "service", Namespace: "namespace"}
+	)
+
+	BeforeEach(func() {
+		c = fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		opts = &ClusterConfigReconcilerOptions{
+			ServiceName:      "service",
+			ServiceNamespace: "namespace",
+			ServiceScheme:    "https",
+			ManageEndpoint:   true,
+		}
+	})
+
+	It("creates the image service and returns its URL", func() {
+		opts.ServicePort = "8443"
+		Expect(EnsureEndpoint(ctx, c, opts)).To(Equal("https://service.namespace:8443"))
+
+		svc := &corev1.Service{}
+		Expect(c.Get(ctx, key, svc)).To(Succeed())
+		Expect(svc.Spec.Selector).To(Equal(map[string]string{imageServerLabel: "true"}))
+		Expect(svc.Spec.Ports).To(HaveLen(1))
+		Expect(svc.Spec.Ports[0].Port).To(Equal(int32(8443)))
+		Expect(svc.Spec.Ports[0].TargetPort.StrVal).To(Equal(imageServerPortName))
+
+		Expect(errors.IsNotFound(c.Get(ctx, key, &routev1.Route{}))).To(BeTrue())
+		Expect(errors.IsNotFound(c.Get(ctx, key, &networkingv1.NetworkPolicy{}))).To(BeTrue())
+	})
+
+	It("updates an existing service", func() {
+		Expect(EnsureEndpoint(ctx, c, opts)).To(Equal("https://service.namespace"))
+		opts.ServicePort = "9443"
+		Expect(EnsureEndpoint(ctx, c, opts)).To(Equal("https://service.namespace:9443"))
+
+		svc := &corev1.Service{}
+		Expect(c.Get(ctx, key, svc)).To(Succeed())
+		Expect(svc.Spec.Ports[0].Port).To(Equal(int32(9443)))
+	})
+
+	It("returns the route URL when a route is requested", func() {
+		opts.EndpointRoute = true
+		opts.EndpointRouteHost = "images.apps.example.com"
+		Expect(EnsureEndpoint(ctx, c, opts)).To(Equal("https://images.apps.example.com"))
+
+		route := &routev1.Route{}
+		Expect(c.Get(ctx, key, route)).To(Succeed())
+		Expect(route.Spec.TLS.Termination).To(Equal(routev1.TLSTerminationReencrypt))
+		Expect(route.Spec.To.Name).To(Equal("service"))
+
+		svc := &corev1.Service{}
+		Expect(c.Get(ctx, key, svc)).To(Succeed())
+		Expect(svc.Annotations).To(HaveKeyWithValue(servingCertAnnotation, "service-serving-cert"))
+	})
+
+	It("fails when the route has no host", func() {
+		opts.EndpointRoute = true
+		_, err := EnsureEndpoint(ctx, c, opts)
+		Expect(err).To(MatchError(ContainSubstring("has no host")))
+	})
+
+	It("refuses a route to a plain HTTP server", func() {
+		opts.EndpointRoute = true
+		opts.EndpointRouteHost = "images.apps.example.com"
+		opts.ServiceScheme = "http"
+		_, err := EnsureEndpoint(ctx, c, opts)
+		Expect(err).To(MatchError(ContainSubstring("SERVICE_SCHEME")))
+	})
+
+	It("restricts ingress to the allowed CIDRs", func() {
+		opts.EndpointAllowedCIDRs = []string{"172.22.0.0/24", "10.10.0.0/16"}
+		_, err := EnsureEndpoint(ctx, c, opts)
+		Expect(err).NotTo(HaveOccurred())
+
+		policy := &networkingv1.NetworkPolicy{}
+		Expect(c.Get(ctx, key, policy)).To(Succeed())
+		Expect(policy.Spec.PodSelector.MatchLabels).To(Equal(map[string]string{imageServerLabel: "true"}))
+		Expect(policy.Spec.Ingress).To(HaveLen(1))
+		var cidrs []string
+		for _, peer := range policy.Spec.Ingress[0].From {
+			if peer.IPBlock != nil {
+				cidrs = append(cidrs, peer.IPBlock.CIDR)
+			}
+		}
+		Expect(cidrs).To(Equal([]string{"172.22.0.0/24", "10.10.0.0/16"}))
+	})
+
+	It("puts back a deleted service periodically", func() {
+		u, err := EnsureEndpoint(ctx, c, opts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Delete(ctx, &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}})).To(Succeed())
+
+		keeperCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		keeper := &EndpointKeeper{Client: c, Log: logrus.New(), Options: opts, URL: u, Interval: 10 * time.Millisecond}
+		go func() {
+			defer GinkgoRecover()
+			Expect(keeper.Start(keeperCtx)).To(Succeed())
+		}()
+		Eventually(func() error { return c.Get(ctx, key, &corev1.Service{}) }).Should(Succeed())
+	})
+})
@@ -0,0 +1,41 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+)
+
+// useExternalImage removes any payload rendered before config switched to an external image
+// The returned hash identifies the external image URL so changing it is handled like a payload change
+func (r *ClusterConfigReconciler) useExternalImage(ctx context.Context, config *relocationv1alpha1.ClusterConfig) (payloadHash string, diff *relocationv1alpha1.PayloadDiff, requeue bool, err error) {
+	lockCtx, cancel := r.lockContext(ctx)
+	defer cancel()
+	locked, err := removeConfigData(lockCtx, r.fs(), r.configDir(config), r.Lease)
+	if err != nil {
+		return "", nil, false, fmt.Errorf("failed to remove rendered config data: %w", err)
+	}
+	if !locked {
+		return "", nil, true, nil
+	}
+
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(config.Spec.ExternalImageURL))), nil, false, nil
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"io/fs"
+	"os"
+)
+
+// FileSystem is used by the reconciler to create, list and remove config directories, tests replace it to fail
+// or delay those operations. It doesn't cover the files inside them: the payload is written through txfs and
+// plugin output, console logs and prestaged images use the os package directly
+type FileSystem interface {
+	Stat(name string) (fs.FileInfo, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+	MkdirAll(path string, perm fs.FileMode) error
+	Remove(name string) error
+	RemoveAll(path string) error
+}
+
+// osFileSystem implements FileSystem with the os package
+type osFileSystem struct{}
+
+func (osFileSystem) Stat(name string) (fs.FileInfo, error)        { return os.Stat(name) }
+func (osFileSystem) ReadDir(name string) ([]fs.DirEntry, error)   { return os.ReadDir(name) }
+func (osFileSystem) MkdirAll(path string, perm fs.FileMode) error { return os.MkdirAll(path, perm) }
+func (osFileSystem) Remove(name string) error                     { return os.Remove(name) }
+func (osFileSystem) RemoveAll(path string) error                  { return os.RemoveAll(path) }
+
+// fs returns the FileSystem config directories are managed with
+func (r *ClusterConfigReconciler) fs() FileSystem {
+	if r.FS == nil {
+		return osFileSystem{}
+	}
+	return r.FS
+}
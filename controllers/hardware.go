@@ -0,0 +1,146 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	bmh_v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+	"github.com/carbonin/cluster-relocation-service/internal/report"
+)
+
+// hardwareShortfalls returns a description of each way the inspected host hardware is below reqs
+func hardwareShortfalls(bmh *bmh_v1alpha1.BareMetalHost, bmhRef *relocationv1alpha1.BareMetalHostReference, reqs *relocationv1alpha1.HardwareRequirements) []string {
+	hw := bmh.Status.HardwareDetails
+	var shortfalls []string
+	if reqs.MinDiskSize != nil {
+		if check := checkDiskSize(bmh, bmhRef, *reqs.MinDiskSize); !check.Passed {
+			shortfalls = append(shortfalls, check.Message)
+		}
+	}
+	if reqs.MinMemory != nil {
+		memory := resource.NewQuantity(int64(hw.RAMMebibytes)*1024*1024, resource.BinarySI)
+		if memory.Cmp(*reqs.MinMemory) < 0 {
+			shortfalls = append(shortfalls, fmt.Sprintf("memory is %s which is less than the minimum of %s", memory, reqs.MinMemory.String()))
+		}
+	}
+	if len(hw.NIC) < reqs.MinNICs {
+		shortfalls = append(shortfalls, fmt.Sprintf("the host has %d network interfaces which is fewer than the minimum of %d", len(hw.NIC), reqs.MinNICs))
+	}
+	return shortfalls
+}
+
+// checkHardware compares the referenced BareMetalHost hardware with the config HardwareRequirements and records the
+// result in the HardwareInsufficient condition. It returns true if the image may be attached
+func (r *ClusterConfigReconciler) checkHardware(ctx context.Context, config *relocationv1alpha1.ClusterConfig) (bool, error) {
+	patch := client.MergeFrom(config.DeepCopy())
+	reqs := config.Spec.HardwareRequirements
+	if reqs == nil {
+		if meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.HardwareInsufficientCondition) == nil {
+			return true, nil
+		}
+		meta.RemoveStatusCondition(&config.Status.Conditions, relocationv1alpha1.HardwareInsufficientCondition)
+		return true, r.Status().Patch(ctx, config, patch)
+	}
+
+	ref := configBMHRef(config)
+	bmh := &bmh_v1alpha1.BareMetalHost{}
+	key := types.NamespacedName{Name: ref.Name, Namespace: ref.Namespace}
+	if err := r.Get(ctx, key, bmh); err != nil {
+		return false, err
+	}
+
+	cond := metav1.Condition{
+		Type:               relocationv1alpha1.HardwareInsufficientCondition,
+		Status:             metav1.ConditionFalse,
+		Reason:             relocationv1alpha1.HardwareSufficientReason,
+		Message:            "the host hardware meets the requirements",
+		ObservedGeneration: config.Generation,
+	}
+	if bmh.Status.HardwareDetails == nil {
+		cond.Status = metav1.ConditionUnknown
+		cond.Reason = relocationv1alpha1.HardwareDetailsUnavailableReason
+		cond.Message = "the host has not been inspected yet"
+	} else if shortfalls := hardwareShortfalls(bmh, ref, reqs); len(shortfalls) > 0 {
+		cond.Status = metav1.ConditionTrue
+		cond.Reason = relocationv1alpha1.HardwareBelowMinimumReason
+		cond.Message = strings.Join(shortfalls, ", ")
+	}
+
+	sufficient := cond.Status == metav1.ConditionFalse
+	if !report.SetCondition(&config.Status.Conditions, cond) {
+		return sufficient, nil
+	}
+	return sufficient, r.Status().Patch(ctx, config, patch)
+}
+
+// hostHardware returns the facts recorded in the ClusterConfig status from the inspection data of bmh
+// It returns nil if the host has not been inspected
+func hostHardware(bmh *bmh_v1alpha1.BareMetalHost) *relocationv1alpha1.HostHardware {
+	hw := bmh.Status.HardwareDetails
+	if hw == nil {
+		return nil
+	}
+	out := &relocationv1alpha1.HostHardware{
+		Manufacturer: hw.SystemVendor.Manufacturer,
+		ProductName:  hw.SystemVendor.ProductName,
+		SerialNumber: hw.SystemVendor.SerialNumber,
+	}
+	for _, nic := range hw.NIC {
+		out.NICs = append(out.NICs, relocationv1alpha1.HostNIC{Name: nic.Name, MAC: nic.MAC})
+	}
+	return out
+}
+
+// recordHostHardware copies the inspection data of the referenced BareMetalHost into the ClusterConfig status
+// The host is read from the API server when it is not cached yet so the data is available to render the payload
+// A missing host keeps the data recorded before
+func (r *ClusterConfigReconciler) recordHostHardware(ctx context.Context, config *relocationv1alpha1.ClusterConfig) error {
+	var hw *relocationv1alpha1.HostHardware
+	if ref := configBMHRef(config); ref != nil {
+		bmh := &bmh_v1alpha1.BareMetalHost{}
+		key := types.NamespacedName{Name: ref.Name, Namespace: ref.Namespace}
+		err := r.Get(ctx, key, bmh)
+		if errors.IsNotFound(err) && r.APIReader != nil {
+			err = r.APIReader.Get(ctx, key, bmh)
+		}
+		if errors.IsNotFound(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		hw = hostHardware(bmh)
+	}
+	if equality.Semantic.DeepEqual(config.Status.HostHardware, hw) {
+		return nil
+	}
+
+	patch := client.MergeFrom(config.DeepCopy())
+	config.Status.HostHardware = hw
+	return r.Status().Patch(ctx, config, patch)
+}
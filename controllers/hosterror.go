@@ -0,0 +1,80 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	bmh_v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+	"github.com/carbonin/cluster-relocation-service/internal/report"
+)
+
+// maxHostErrorMessageLength bounds the BareMetalHost error message copied into the HostError condition,
+// Ironic errors can include long tracebacks
+const maxHostErrorMessageLength = 512
+
+// hostErrorCondition returns the HostError condition for the given BareMetalHost status
+func hostErrorCondition(config *relocationv1alpha1.ClusterConfig, bmh *bmh_v1alpha1.BareMetalHost) metav1.Condition {
+	cond := metav1.Condition{
+		Type:               relocationv1alpha1.HostErrorCondition,
+		Status:             metav1.ConditionFalse,
+		Reason:             relocationv1alpha1.NoHostErrorReason,
+		Message:            fmt.Sprintf("BareMetalHost %s/%s has not reported an error", bmh.Namespace, bmh.Name),
+		ObservedGeneration: config.Generation,
+	}
+	if bmh.Status.ErrorType == "" && bmh.Status.OperationalStatus != bmh_v1alpha1.OperationalStatusError {
+		return cond
+	}
+
+	cond.Status = metav1.ConditionTrue
+	cond.Reason = relocationv1alpha1.HostErrorReportedReason
+	errorType := string(bmh.Status.ErrorType)
+	if errorType == "" {
+		errorType = "an error"
+	}
+	cond.Message = fmt.Sprintf("BareMetalHost %s/%s reported %s", bmh.Namespace, bmh.Name, errorType)
+	if msg := report.Summarize(bmh.Status.ErrorMessage, maxHostErrorMessageLength); msg != "" {
+		cond.Message = fmt.Sprintf("%s: %s", cond.Message, msg)
+	}
+	return cond
+}
+
+// setHostError copies the error reported by the referenced BareMetalHost into the HostError condition
+func (r *ClusterConfigReconciler) setHostError(ctx context.Context, config *relocationv1alpha1.ClusterConfig) error {
+	ref := configBMHRef(config)
+	bmh := &bmh_v1alpha1.BareMetalHost{}
+	key := types.NamespacedName{
+		Name:      ref.Name,
+		Namespace: ref.Namespace,
+	}
+	if err := r.Get(ctx, key, bmh); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+
+	cond := hostErrorCondition(config, bmh)
+	patch := client.MergeFrom(config.DeepCopy())
+	if !report.SetCondition(&config.Status.Conditions, cond) {
+		return nil
+	}
+	return r.Status().Patch(ctx, config, patch)
+}
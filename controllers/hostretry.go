@@ -0,0 +1,141 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	bmh_v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+)
+
+const (
+	// hostRetryBaseDelay is the time a BareMetalHost error retry is given to take effect, it doubles for each retry after the first
+	hostRetryBaseDelay = 30 * time.Second
+	// hostRetryMaxDelay bounds the wait between retries
+	hostRetryMaxDelay = 10 * time.Minute
+)
+
+// retryableHostError returns true if the BareMetalHost reports an error which retrying may clear
+func retryableHostError(bmh *bmh_v1alpha1.BareMetalHost) bool {
+	if bmh.Status.OperationalStatus != bmh_v1alpha1.OperationalStatusError {
+		return false
+	}
+	return bmh.Status.ErrorType == bmh_v1alpha1.ProvisioningError || bmh.Status.ErrorType == bmh_v1alpha1.InspectionError
+}
+
+// hostRetryDelay returns the wait after the given number of retries before the error is checked again
+func hostRetryDelay(retries int32) time.Duration {
+	delay := hostRetryBaseDelay
+	for i := int32(1); i < retries; i++ {
+		delay *= 2
+		if delay >= hostRetryMaxDelay {
+			return hostRetryMaxDelay
+		}
+	}
+	return delay
+}
+
+// handleHostError retries provisioning and inspection errors reported by the referenced BareMetalHost
+// up to the configured number of times, backing off between attempts.
+// A provisioning error is retried by detaching the image so the host is deprovisioned before it is attached again,
+// and an inspection error by requesting a new inspection.
+// It returns how long to wait before the image may be attached and whether the retries are used up
+func (r *ClusterConfigReconciler) handleHostError(ctx context.Context, config *relocationv1alpha1.ClusterConfig) (wait time.Duration, failed bool, err error) {
+	if config.Spec.MaxRetries == nil {
+		return 0, false, nil
+	}
+
+	// retries start over when the spec changes
+	cond := meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.HostProvisioningFailedCondition)
+	if cond != nil && cond.ObservedGeneration != config.Generation {
+		patch := client.MergeFrom(config.DeepCopy())
+		meta.RemoveStatusCondition(&config.Status.Conditions, relocationv1alpha1.HostProvisioningFailedCondition)
+		config.Status.HostRetries = 0
+		config.Status.LastHostRetryTime = nil
+		if err := r.Status().Patch(ctx, config, patch); err != nil {
+			return 0, false, err
+		}
+		cond = nil
+	}
+	if cond != nil && cond.Status == metav1.ConditionTrue {
+		return 0, true, nil
+	}
+
+	bmhRef := configBMHRef(config)
+	bmh := &bmh_v1alpha1.BareMetalHost{}
+	if err := r.Get(ctx, types.NamespacedName{Name: bmhRef.Name, Namespace: bmhRef.Namespace}, bmh); err != nil {
+		return 0, false, client.IgnoreNotFound(err)
+	}
+	if !retryableHostError(bmh) {
+		return 0, false, nil
+	}
+
+	// give the previous retry time to take effect
+	if last := config.Status.LastHostRetryTime; last != nil {
+		if remaining := time.Until(last.Add(hostRetryDelay(config.Status.HostRetries))); remaining > 0 {
+			return remaining, false, nil
+		}
+	}
+
+	patch := client.MergeFrom(config.DeepCopy())
+	if config.Status.HostRetries >= *config.Spec.MaxRetries {
+		meta.SetStatusCondition(&config.Status.Conditions, metav1.Condition{
+			Type:   relocationv1alpha1.HostProvisioningFailedCondition,
+			Status: metav1.ConditionTrue,
+			Reason: relocationv1alpha1.HostRetriesExhaustedReason,
+			Message: fmt.Sprintf("BareMetalHost %s/%s reported %s after %d retries: %s",
+				bmh.Namespace, bmh.Name, bmh.Status.ErrorType, config.Status.HostRetries, bmh.Status.ErrorMessage),
+			ObservedGeneration: config.Generation,
+		})
+		return 0, true, r.Status().Patch(ctx, config, patch)
+	}
+
+	if bmh.Status.ErrorType == bmh_v1alpha1.InspectionError {
+		bmhPatch := client.MergeFrom(bmh.DeepCopy())
+		// the baremetal-operator removes the annotation once inspection starts
+		metav1.SetMetaDataAnnotation(&bmh.ObjectMeta, bmh_v1alpha1.InspectAnnotation, "")
+		if err := r.Patch(ctx, bmh, bmhPatch); err != nil {
+			return 0, false, err
+		}
+	} else if err := r.detachBMHImage(ctx, bmhRef); err != nil {
+		return 0, false, err
+	}
+
+	now := metav1.Now()
+	config.Status.HostRetries++
+	config.Status.LastHostRetryTime = &now
+	meta.SetStatusCondition(&config.Status.Conditions, metav1.Condition{
+		Type:   relocationv1alpha1.HostProvisioningFailedCondition,
+		Status: metav1.ConditionFalse,
+		Reason: relocationv1alpha1.HostErrorRetryingReason,
+		Message: fmt.Sprintf("retry %d of %d after BareMetalHost %s/%s reported %s: %s",
+			config.Status.HostRetries, *config.Spec.MaxRetries, bmh.Namespace, bmh.Name, bmh.Status.ErrorType, bmh.Status.ErrorMessage),
+		ObservedGeneration: config.Generation,
+	})
+	if err := r.Status().Patch(ctx, config, patch); err != nil {
+		return 0, false, err
+	}
+	return hostRetryDelay(config.Status.HostRetries), false, nil
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+)
+
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create
+
+// imageCredentialsUsername is the username of generated image credentials
+const imageCredentialsUsername = "relocation"
+
+// imageCredentials returns the basic auth credentials for images in namespace, generating them if they don't exist
+func (r *ClusterConfigReconciler) imageCredentials(ctx context.Context, namespace string) (*url.Userinfo, error) {
+	s := &corev1.Secret{}
+	key := types.NamespacedName{Name: relocationv1alpha1.ImageCredentialsSecretName, Namespace: namespace}
+	err := r.Get(ctx, key, s)
+	if errors.IsNotFound(err) {
+		s, err = r.createImageCredentials(ctx, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	username := string(s.Data[relocationv1alpha1.ImageCredentialsUsernameKey])
+	password := string(s.Data[relocationv1alpha1.ImageCredentialsPasswordKey])
+	if username == "" || password == "" {
+		return nil, fmt.Errorf("secret %s must contain %s and %s", key, relocationv1alpha1.ImageCredentialsUsernameKey, relocationv1alpha1.ImageCredentialsPasswordKey)
+	}
+	return url.UserPassword(username, password), nil
+}
+
+func (r *ClusterConfigReconciler) createImageCredentials(ctx context.Context, key types.NamespacedName) (*corev1.Secret, error) {
+	password := make([]byte, 32)
+	if _, err := rand.Read(password); err != nil {
+		return nil, err
+	}
+	s := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+		Type:       corev1.SecretTypeBasicAuth,
+		Data: map[string][]byte{
+			relocationv1alpha1.ImageCredentialsUsernameKey: []byte(imageCredentialsUsername),
+			relocationv1alpha1.ImageCredentialsPasswordKey: []byte(base64.RawURLEncoding.EncodeToString(password)),
+		},
+	}
+	err := r.Create(ctx, s)
+	if errors.IsAlreadyExists(err) {
+		// another config in the namespace created it first
+		s = &corev1.Secret{}
+		err = r.Get(ctx, key, s)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// withCredentials adds the image credentials of config's namespace to imageURL if the image server requires them
+func (r *ClusterConfigReconciler) withCredentials(ctx context.Context, config *relocationv1alpha1.ClusterConfig, imageURL string) (string, error) {
+	// the credentials are only for the service's own image server
+	if !r.Options.ImageBasicAuth || config.Spec.ExternalImageURL != "" {
+		return imageURL, nil
+	}
+	creds, err := r.imageCredentials(ctx, config.Namespace)
+	if err != nil {
+		return "", fmt.Errorf("failed to get image credentials: %w", err)
+	}
+	u, err := url.Parse(imageURL)
+	if err != nil {
+		return "", err
+	}
+	u.User = creds
+	return u.String(), nil
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+)
+
+// insecureImageError is returned when credentials would be embedded in an image served over plain HTTP,
+// or downloaded from a zone cache without credentials
+type insecureImageError struct {
+	url     string
+	secrets []string
+	// unauthenticated is set when the image would be downloaded from a zone cache without credentials
+	unauthenticated bool
+}
+
+func (e *insecureImageError) Error() string {
+	if e.unauthenticated {
+		return fmt.Sprintf("refusing to embed %s in an image downloaded from the zone cache %s without credentials, enable image basic auth or set allowInsecureImageURL", strings.Join(e.secrets, ", "), e.url)
+	}
+	return fmt.Sprintf("refusing to embed %s in an image served over plain HTTP from %s, use an HTTPS image URL or set allowInsecureImageURL", strings.Join(e.secrets, ", "), e.url)
+}
+
+// embeddedSecrets returns the kinds of credentials config embeds in its image
+func embeddedSecrets(config *relocationv1alpha1.ClusterConfig) []string {
+	var secrets []string
+	if config.Spec.PullSecretRef != nil || len(config.Spec.AdditionalPullSecretRefs) > 0 {
+		secrets = append(secrets, "pull secrets")
+	}
+	if config.Spec.APICertRef != nil || config.Spec.IngressCertRef != nil {
+		secrets = append(secrets, "certificate keys")
+	}
+	return secrets
+}
+
+// checkImageTransport returns an insecureImageError if the image for config would be served over plain HTTP while
+// it embeds credentials, unless config explicitly allows it
+// Hosts in zones with a cache download the image from it, so the cache must also require the image credentials
+func (r *ClusterConfigReconciler) checkImageTransport(config *relocationv1alpha1.ClusterConfig) error {
+	if config.Spec.AllowInsecureImageURL {
+		return nil
+	}
+	secrets := embeddedSecrets(config)
+	if len(secrets) == 0 {
+		return nil
+	}
+	base, cached := r.zoneCacheURL(config)
+	if !cached {
+		var err error
+		if base, err = r.zoneBaseURL(config); err != nil {
+			return err
+		}
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return err
+	}
+	u.User = nil
+	if u.Scheme != "https" {
+		return &insecureImageError{url: u.String(), secrets: secrets}
+	}
+	if cached && !r.Options.ImageBasicAuth {
+		return &insecureImageError{url: u.String(), secrets: secrets, unauthenticated: true}
+	}
+	return nil
+}
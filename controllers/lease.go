@@ -0,0 +1,67 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/carbonin/cluster-relocation-service/internal/filelock"
+)
+
+// LeaseKeeper acquires the data dir lease once the manager is elected leader so a standby or a new pod in a rolling
+// update doesn't fence out the instance still writing. It stops the manager if another instance takes the lease over
+// as every write would fail from then on
+type LeaseKeeper struct {
+	Lease *filelock.Lease
+	Log   logrus.FieldLogger
+	// Interval is how often the lease is checked once it has been acquired
+	Interval time.Duration
+}
+
+// NeedLeaderElection only runs the keeper on the leader
+func (k *LeaseKeeper) NeedLeaderElection() bool {
+	return true
+}
+
+func (k *LeaseKeeper) Start(ctx context.Context) error {
+	if err := k.Lease.Acquire(); err != nil {
+		return fmt.Errorf("failed to acquire data dir lease: %w", err)
+	}
+	k.Log.WithField("generation", k.Lease.Generation()).Info("acquired data dir lease")
+
+	ticker := time.NewTicker(k.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			err := k.Lease.Check()
+			if errors.Is(err, filelock.ErrLeaseLost) {
+				return fmt.Errorf("stopping as another instance took over the data dir: %w", err)
+			}
+			if err != nil {
+				k.Log.WithError(err).Error("failed to check data dir lease")
+			}
+		}
+	}
+}
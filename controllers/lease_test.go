@@ -0,0 +1,49 @@
+package controllers
+
+import (
+	"context"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+
+	"github.com/carbonin/cluster-relocation-service/internal/filelock"
+)
+
+var _ = Describe("LeaseKeeper", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "lease_keeper_test")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	It("acquires the lease when started and stops once another instance takes it over", func() {
+		k := &LeaseKeeper{Lease: filelock.NewLease(dir, "pod-1"), Log: logrus.New(), Interval: 10 * time.Millisecond}
+		Expect(k.Lease.Check()).To(MatchError(filelock.ErrLeaseNotAcquired))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		done := make(chan error)
+		go func() { done <- k.Start(ctx) }()
+		Eventually(k.Lease.Check).Should(Succeed())
+
+		_, err := filelock.AcquireLease(dir, "pod-2")
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(done).Should(Receive(MatchError(filelock.ErrLeaseLost)))
+	})
+
+	It("stops without an error when the manager stops", func() {
+		k := &LeaseKeeper{Lease: filelock.NewLease(dir, "pod-1"), Log: logrus.New(), Interval: time.Hour}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		Expect(k.Start(ctx)).To(Succeed())
+	})
+})
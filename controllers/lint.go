@@ -0,0 +1,240 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/dsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/carbonin/cluster-relocation-service/api/isoschema"
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+	"github.com/carbonin/cluster-relocation-service/internal/report"
+)
+
+// defaultCertWarningWindow is used when CertWarningWindow isn't set
+const defaultCertWarningWindow = 30 * 24 * time.Hour
+
+// minRSABits is the smallest RSA key size for certificates and SSH keys which isn't reported as weak
+const minRSABits = 2048
+
+// configurationWarningReason is the reason of the events recorded when new configuration warnings are found
+const configurationWarningReason = "ConfigurationWarning"
+
+// weakSignatureAlgorithms are the certificate signature algorithms reported as weak
+var weakSignatureAlgorithms = map[x509.SignatureAlgorithm]bool{
+	x509.MD2WithRSA:    true,
+	x509.MD5WithRSA:    true,
+	x509.SHA1WithRSA:   true,
+	x509.DSAWithSHA1:   true,
+	x509.ECDSAWithSHA1: true,
+}
+
+// lintConfiguration checks the certificates and SSH keys rendered for config and reports problems in the
+// ConfigurationWarnings condition and as an event. Nothing is held back, the warnings are only for the operator
+func (r *ClusterConfigReconciler) lintConfiguration(ctx context.Context, config *relocationv1alpha1.ClusterConfig) error {
+	var warnings []string
+	// the content of external images isn't rendered by the service
+	if config.Spec.ExternalImageURL == "" {
+		var err error
+		warnings, err = r.configurationWarnings(ctx, config, time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
+	cond := metav1.Condition{
+		Type:               relocationv1alpha1.ConfigurationWarningsCondition,
+		Status:             metav1.ConditionFalse,
+		Reason:             relocationv1alpha1.NoWarningsReason,
+		Message:            "no problems were found with the certificates and SSH keys",
+		ObservedGeneration: config.Generation,
+	}
+	if len(warnings) > 0 {
+		cond.Status = metav1.ConditionTrue
+		cond.Reason = relocationv1alpha1.WarningsFoundReason
+		cond.Message = strings.Join(warnings, ", ")
+	}
+	patch := client.MergeFrom(config.DeepCopy())
+	if !report.SetCondition(&config.Status.Conditions, cond) {
+		return nil
+	}
+	if err := r.Status().Patch(ctx, config, patch); err != nil {
+		return err
+	}
+	// only record changes so the same warnings aren't repeated on every reconcile
+	if len(warnings) > 0 {
+		r.Notifier.Warningf(config, configurationWarningReason, "%s", cond.Message)
+	}
+	return nil
+}
+
+// configurationWarnings returns a warning for each certificate expiring within the warning window or using a weak
+// key or signature, and each SSH key using a weak algorithm
+func (r *ClusterConfigReconciler) configurationWarnings(ctx context.Context, config *relocationv1alpha1.ClusterConfig, now time.Time) ([]string, error) {
+	window := defaultCertWarningWindow
+	if config.Spec.CertWarningWindow != nil {
+		window = config.Spec.CertWarningWindow.Duration
+	}
+
+	var warnings []string
+	certs := []struct {
+		name string
+		ref  *corev1.SecretReference
+	}{
+		{"API", config.Spec.APICertRef},
+		{"ingress", config.Spec.IngressCertRef},
+	}
+	for _, c := range certs {
+		if c.ref == nil {
+			continue
+		}
+		s := &corev1.Secret{}
+		if err := r.Get(ctx, types.NamespacedName{Name: c.ref.Name, Namespace: c.ref.Namespace}, s); err != nil {
+			return nil, err
+		}
+		warnings = append(warnings, lintCertificates(c.name+" certificate", s.Data[corev1.TLSCertKey], window, now)...)
+	}
+
+	if ref := config.Spec.AdditionalTrustBundleRef; ref != nil {
+		cm := &corev1.ConfigMap{}
+		if err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: config.Namespace}, cm); err != nil {
+			return nil, err
+		}
+		warnings = append(warnings, lintCertificates("additional trust bundle", []byte(cm.Data[isoschema.AdditionalTrustBundleKey]), window, now)...)
+	}
+
+	for i, key := range config.Spec.SSHKeys {
+		if warning := lintSSHKey(key); warning != "" {
+			warnings = append(warnings, fmt.Sprintf("SSH key %d %s", i, warning))
+		}
+	}
+	return warnings, nil
+}
+
+// lintCertificates returns warnings for each certificate in the PEM encoded data
+func lintCertificates(name string, data []byte, window time.Duration, now time.Time) []string {
+	var warnings []string
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return warnings
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("the %s contains a certificate which can't be parsed: %s", name, err))
+			continue
+		}
+
+		subject := fmt.Sprintf("the %s %q", name, cert.Subject.CommonName)
+		expiry := cert.NotAfter.UTC().Format(time.RFC3339)
+		if !now.Before(cert.NotAfter) {
+			warnings = append(warnings, fmt.Sprintf("%s expired at %s", subject, expiry))
+		} else if window > 0 && cert.NotAfter.Sub(now) <= window {
+			warnings = append(warnings, fmt.Sprintf("%s expires at %s which is within the warning window of %s", subject, expiry, window))
+		}
+		if key, ok := cert.PublicKey.(*rsa.PublicKey); ok && key.N.BitLen() < minRSABits {
+			warnings = append(warnings, fmt.Sprintf("%s uses a weak %d bit RSA key", subject, key.N.BitLen()))
+		}
+		if _, ok := cert.PublicKey.(*dsa.PublicKey); ok {
+			warnings = append(warnings, fmt.Sprintf("%s uses a weak DSA key", subject))
+		}
+		if weakSignatureAlgorithms[cert.SignatureAlgorithm] {
+			warnings = append(warnings, fmt.Sprintf("%s is signed with the weak %s algorithm", subject, cert.SignatureAlgorithm))
+		}
+	}
+}
+
+// lintSSHKey returns a warning if an authorized key uses a weak algorithm or can't be parsed, or an empty string
+func lintSSHKey(key string) string {
+	fields := strings.Fields(key)
+	for i, f := range fields {
+		if i+1 == len(fields) || !isSSHKeyType(f) {
+			continue
+		}
+		blob, err := base64.StdEncoding.DecodeString(fields[i+1])
+		if err != nil {
+			return fmt.Sprintf("can't be parsed: %s", err)
+		}
+		return lintSSHKeyBlob(blob)
+	}
+	return "can't be parsed as an authorized key"
+}
+
+func isSSHKeyType(s string) bool {
+	return strings.HasPrefix(s, "ssh-") || strings.HasPrefix(s, "ecdsa-sha2-") || strings.HasPrefix(s, "sk-")
+}
+
+// lintSSHKeyBlob checks a key in the SSH wire format
+func lintSSHKeyBlob(blob []byte) string {
+	r := bytes.NewReader(blob)
+	keyType, err := readSSHString(r)
+	if err != nil {
+		return fmt.Sprintf("can't be parsed: %s", err)
+	}
+	switch string(keyType) {
+	case "ssh-dss":
+		return "uses the weak DSA algorithm"
+	case "ssh-rsa":
+		// the exponent comes before the modulus
+		if _, err := readSSHString(r); err != nil {
+			return fmt.Sprintf("can't be parsed: %s", err)
+		}
+		n, err := readSSHString(r)
+		if err != nil {
+			return fmt.Sprintf("can't be parsed: %s", err)
+		}
+		if bits := new(big.Int).SetBytes(n).BitLen(); bits < minRSABits {
+			return fmt.Sprintf("uses a weak %d bit RSA key", bits)
+		}
+	}
+	return ""
+}
+
+func readSSHString(r *bytes.Reader) ([]byte, error) {
+	var length uint32
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+	if int64(length) > int64(r.Len()) {
+		return nil, errors.New("truncated key")
+	}
+	data := make([]byte, length)
+	if _, err := r.Read(data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
@@ -0,0 +1,152 @@
+package controllers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"math/big"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+	"github.com/carbonin/cluster-relocation-service/internal/report"
+)
+
+// sshKey returns an authorized key line for the given key type and wire format fields
+func sshKey(keyType string, fields ...[]byte) string {
+	var blob []byte
+	for _, f := range append([][]byte{[]byte(keyType)}, fields...) {
+		blob = binary.BigEndian.AppendUint32(blob, uint32(len(f)))
+		blob = append(blob, f...)
+	}
+	return keyType + " " + base64.StdEncoding.EncodeToString(blob) + " user@example.com"
+}
+
+func rsaSSHKey(bits int) string {
+	n := new(big.Int).Lsh(big.NewInt(1), uint(bits-1))
+	return sshKey("ssh-rsa", big.NewInt(65537).Bytes(), append([]byte{0}, n.Bytes()...))
+}
+
+func lintTestCert(commonName string, notAfter time.Time, sign func(tmpl *x509.Certificate) []byte) []byte {
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: sign(tmpl)})
+}
+
+func ecdsaSigned(tmpl *x509.Certificate) []byte {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ExpectWithOffset(2, err).NotTo(HaveOccurred())
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &priv.PublicKey, priv)
+	ExpectWithOffset(2, err).NotTo(HaveOccurred())
+	return der
+}
+
+var _ = Describe("lintCertificates", func() {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	window := 30 * 24 * time.Hour
+
+	It("doesn't warn for certificates outside the window", func() {
+		data := lintTestCert("api.example.com", now.Add(90*24*time.Hour), ecdsaSigned)
+		Expect(lintCertificates("API certificate", data, window, now)).To(BeEmpty())
+	})
+
+	It("warns for expiring and expired certificates", func() {
+		data := append(lintTestCert("expiring", now.Add(7*24*time.Hour), ecdsaSigned), lintTestCert("expired", now.Add(-time.Hour), ecdsaSigned)...)
+		warnings := lintCertificates("additional trust bundle", data, window, now)
+		Expect(warnings).To(HaveLen(2))
+		Expect(warnings[0]).To(ContainSubstring(`"expiring" expires at 2024-01-08T00:00:00Z which is within the warning window`))
+		Expect(warnings[1]).To(ContainSubstring(`"expired" expired at`))
+
+		Expect(lintCertificates("API certificate", lintTestCert("expiring", now.Add(7*24*time.Hour), ecdsaSigned), 0, now)).To(BeEmpty())
+	})
+
+	It("warns for weak keys and signatures", func() {
+		priv, err := rsa.GenerateKey(rand.Reader, 1024)
+		Expect(err).NotTo(HaveOccurred())
+		data := lintTestCert("weak", now.Add(90*24*time.Hour), func(tmpl *x509.Certificate) []byte {
+			tmpl.SignatureAlgorithm = x509.SHA1WithRSA
+			der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &priv.PublicKey, priv)
+			Expect(err).NotTo(HaveOccurred())
+			return der
+		})
+
+		warnings := lintCertificates("ingress certificate", data, window, now)
+		Expect(warnings).To(ConsistOf(
+			ContainSubstring("uses a weak 1024 bit RSA key"),
+			ContainSubstring("is signed with the weak SHA1-RSA algorithm"),
+		))
+	})
+})
+
+var _ = Describe("lintSSHKey", func() {
+	It("accepts strong keys", func() {
+		Expect(lintSSHKey(sshKey("ssh-ed25519", make([]byte, 32)))).To(BeEmpty())
+		Expect(lintSSHKey(rsaSSHKey(3072))).To(BeEmpty())
+		Expect(lintSSHKey(`no-pty ` + rsaSSHKey(4096))).To(BeEmpty())
+	})
+
+	It("warns for weak keys", func() {
+		Expect(lintSSHKey(rsaSSHKey(1024))).To(Equal("uses a weak 1024 bit RSA key"))
+		Expect(lintSSHKey(sshKey("ssh-dss", []byte{1}, []byte{2}, []byte{3}, []byte{4}))).To(Equal("uses the weak DSA algorithm"))
+	})
+
+	It("warns for keys which can't be parsed", func() {
+		Expect(lintSSHKey("not a key")).To(ContainSubstring("can't be parsed"))
+		Expect(lintSSHKey("ssh-rsa AAAA")).To(ContainSubstring("can't be parsed"))
+		Expect(lintSSHKey("ssh-rsa !!!")).To(ContainSubstring("can't be parsed"))
+	})
+})
+
+var _ = Describe("lintConfiguration", func() {
+	It("sets the condition and records an event when warnings are found", func() {
+		ctx := context.Background()
+		c := fakeclient.NewClientBuilder().
+			WithScheme(scheme.Scheme).
+			WithStatusSubresource(&relocationv1alpha1.ClusterConfig{}).
+			Build()
+		recorder := record.NewFakeRecorder(10)
+		r := &ClusterConfigReconciler{Client: c, Log: logrus.New(), Notifier: &report.Notifier{Recorder: recorder}}
+
+		config := &relocationv1alpha1.ClusterConfig{ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "test-namespace"}}
+		config.Spec.SSHKeys = []string{rsaSSHKey(4096), rsaSSHKey(1024)}
+		Expect(c.Create(ctx, config)).To(Succeed())
+
+		Expect(r.lintConfiguration(ctx, config)).To(Succeed())
+		cond := meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.ConfigurationWarningsCondition)
+		Expect(cond).NotTo(BeNil())
+		Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+		Expect(cond.Reason).To(Equal(relocationv1alpha1.WarningsFoundReason))
+		Expect(cond.Message).To(Equal("SSH key 1 uses a weak 1024 bit RSA key"))
+		Expect(recorder.Events).To(Receive(ContainSubstring(configurationWarningReason)))
+
+		// unchanged warnings aren't recorded again
+		Expect(r.lintConfiguration(ctx, config)).To(Succeed())
+		Expect(recorder.Events).To(BeEmpty())
+
+		config.Spec.SSHKeys = config.Spec.SSHKeys[:1]
+		Expect(r.lintConfiguration(ctx, config)).To(Succeed())
+		cond = meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.ConfigurationWarningsCondition)
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Reason).To(Equal(relocationv1alpha1.NoWarningsReason))
+		Expect(recorder.Events).To(BeEmpty())
+	})
+})
@@ -0,0 +1,129 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+	"github.com/carbonin/cluster-relocation-service/internal/report"
+)
+
+// checkMaintenanceWindow records whether the maintenance window of config is open in the MaintenanceWindowOpen
+// condition. It returns true if the BareMetalHost may be changed, and otherwise how long until the window opens,
+// zero if it can't be parsed as a spec change is needed
+func (r *ClusterConfigReconciler) checkMaintenanceWindow(ctx context.Context, config *relocationv1alpha1.ClusterConfig, now time.Time) (bool, time.Duration, error) {
+	patch := client.MergeFrom(config.DeepCopy())
+	window := config.Spec.MaintenanceWindow
+	if window == nil || config.Spec.BareMetalHostRef == nil {
+		if meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.MaintenanceWindowOpenCondition) == nil {
+			return true, 0, nil
+		}
+		meta.RemoveStatusCondition(&config.Status.Conditions, relocationv1alpha1.MaintenanceWindowOpenCondition)
+		return true, 0, r.Status().Patch(ctx, config, patch)
+	}
+
+	cond := metav1.Condition{
+		Type:               relocationv1alpha1.MaintenanceWindowOpenCondition,
+		Status:             metav1.ConditionTrue,
+		Reason:             relocationv1alpha1.MaintenanceWindowOpenReason,
+		Message:            "the maintenance window is open",
+		ObservedGeneration: config.Generation,
+	}
+	open, wait, err := maintenanceWindowOpen(window, now)
+	if err != nil {
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = relocationv1alpha1.MaintenanceWindowInvalidReason
+		cond.Message = err.Error()
+	} else if !open {
+		// the opening time rather than the wait keeps the message the same until the window opens
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = relocationv1alpha1.MaintenanceWindowClosedReason
+		cond.Message = fmt.Sprintf("BareMetalHost changes are deferred until the maintenance window opens at %s", now.Add(wait).UTC().Format(time.RFC3339))
+	}
+	if report.SetCondition(&config.Status.Conditions, cond) {
+		if err := r.Status().Patch(ctx, config, patch); err != nil {
+			return false, 0, err
+		}
+	}
+	return open, wait, nil
+}
+
+// maintenanceWindowOpen returns true if now is inside window
+// If it is not, it also returns how long until the window next opens
+func maintenanceWindowOpen(window *relocationv1alpha1.MaintenanceWindow, now time.Time) (bool, time.Duration, error) {
+	loc := time.UTC
+	if window.TimeZone != "" {
+		var err error
+		loc, err = time.LoadLocation(window.TimeZone)
+		if err != nil {
+			return false, 0, fmt.Errorf("invalid maintenance window time zone %q: %w", window.TimeZone, err)
+		}
+	}
+
+	start, err := time.Parse("15:04", window.Start)
+	if err != nil {
+		return false, 0, fmt.Errorf("invalid maintenance window start %q: %w", window.Start, err)
+	}
+	if window.Duration.Duration <= 0 {
+		return false, 0, fmt.Errorf("maintenance window duration must be positive")
+	}
+
+	days := map[time.Weekday]bool{}
+	for _, d := range window.Days {
+		wd, ok := weekdays[d]
+		if !ok {
+			return false, 0, fmt.Errorf("invalid maintenance window day %q", d)
+		}
+		days[wd] = true
+	}
+
+	// a window that started on a previous day may still be open
+	// so check a week either side of today to cover every case
+	local := now.In(loc)
+	var wait time.Duration
+	for offset := -7; offset <= 7; offset++ {
+		opens := time.Date(local.Year(), local.Month(), local.Day()+offset, start.Hour(), start.Minute(), 0, 0, loc)
+		if len(days) > 0 && !days[opens.Weekday()] {
+			continue
+		}
+		if !now.Before(opens) && now.Before(opens.Add(window.Duration.Duration)) {
+			return true, 0, nil
+		}
+		if opens.After(now) && (wait == 0 || opens.Sub(now) < wait) {
+			wait = opens.Sub(now)
+		}
+	}
+
+	return false, wait, nil
+}
+
+var weekdays = map[relocationv1alpha1.Weekday]time.Weekday{
+	"Sunday":    time.Sunday,
+	"Monday":    time.Monday,
+	"Tuesday":   time.Tuesday,
+	"Wednesday": time.Wednesday,
+	"Thursday":  time.Thursday,
+	"Friday":    time.Friday,
+	"Saturday":  time.Saturday,
+}
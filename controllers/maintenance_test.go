@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"time"
+
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("maintenanceWindowOpen", func() {
+	// a Wednesday
+	now := time.Date(2023, time.June, 14, 12, 0, 0, 0, time.UTC)
+
+	window := func(start string, duration time.Duration, days ...relocationv1alpha1.Weekday) *relocationv1alpha1.MaintenanceWindow {
+		return &relocationv1alpha1.MaintenanceWindow{Start: start, Duration: metav1.Duration{Duration: duration}, Days: days}
+	}
+
+	It("is open inside a daily window", func() {
+		open, _, err := maintenanceWindowOpen(window("11:00", 2*time.Hour), now)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(open).To(BeTrue())
+	})
+
+	It("returns the time until a window later today", func() {
+		open, wait, err := maintenanceWindowOpen(window("22:00", 4*time.Hour), now)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(open).To(BeFalse())
+		Expect(wait).To(Equal(10 * time.Hour))
+	})
+
+	It("is open in a window that started the previous day", func() {
+		open, _, err := maintenanceWindowOpen(window("22:00", 16*time.Hour), now)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(open).To(BeTrue())
+	})
+
+	It("only opens on the given days", func() {
+		open, wait, err := maintenanceWindowOpen(window("11:00", 2*time.Hour, "Saturday", "Sunday"), now)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(open).To(BeFalse())
+		Expect(wait).To(Equal(2*24*time.Hour + 23*time.Hour))
+	})
+
+	It("uses the configured time zone", func() {
+		w := window("08:00", time.Hour)
+		w.TimeZone = "America/New_York"
+		// 12:00 UTC is 08:00 EDT
+		open, _, err := maintenanceWindowOpen(w, now)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(open).To(BeTrue())
+	})
+
+	It("rejects invalid windows", func() {
+		w := window("08:00", time.Hour)
+		w.TimeZone = "Not/AZone"
+		_, _, err := maintenanceWindowOpen(w, now)
+		Expect(err).To(HaveOccurred())
+
+		_, _, err = maintenanceWindowOpen(window("25:00", time.Hour), now)
+		Expect(err).To(HaveOccurred())
+
+		_, _, err = maintenanceWindowOpen(window("08:00", 0), now)
+		Expect(err).To(HaveOccurred())
+	})
+})
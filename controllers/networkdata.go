@@ -0,0 +1,138 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	bmh_v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+)
+
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=update;delete
+
+// networkDataKey returns the key of the copy of config's network data secret in the BareMetalHost namespace
+// The config namespace is part of the name so configs with the same name in different namespaces don't share it
+func networkDataKey(config *relocationv1alpha1.ClusterConfig) types.NamespacedName {
+	return types.NamespacedName{
+		Name:      fmt.Sprintf("%s-%s-network-data", config.Namespace, config.Name),
+		Namespace: configBMHRef(config).Namespace,
+	}
+}
+
+// syncNetworkData copies the network data secret referenced by config to the BareMetalHost namespace
+// It returns the reference to set as the host's networkData, or nil if config doesn't reference any network data,
+// in which case a copy made before is removed
+func (r *ClusterConfigReconciler) syncNetworkData(ctx context.Context, config *relocationv1alpha1.ClusterConfig) (*corev1.SecretReference, error) {
+	ref := config.Spec.BareMetalHostRef.NetworkDataRef
+	if ref == nil {
+		// the reference may have been removed since the copy was made
+		return nil, r.removeNetworkData(ctx, config)
+	}
+	src := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: config.Namespace}, src); err != nil {
+		return nil, fmt.Errorf("failed to get network data secret %s: %w", ref.Name, err)
+	}
+	data, ok := src.Data[relocationv1alpha1.NetworkDataKey]
+	if !ok {
+		return nil, fmt.Errorf("network data secret %s has no %s key", ref.Name, relocationv1alpha1.NetworkDataKey)
+	}
+
+	key := networkDataKey(config)
+	owner := types.NamespacedName{Namespace: config.Namespace, Name: config.Name}.String()
+	s := &corev1.Secret{}
+	err := r.Get(ctx, key, s)
+	if errors.IsNotFound(err) {
+		s = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        key.Name,
+				Namespace:   key.Namespace,
+				Annotations: map[string]string{relocationv1alpha1.ClusterConfigAnnotation: owner},
+			},
+			Data: map[string][]byte{relocationv1alpha1.NetworkDataKey: data},
+		}
+		err = r.Create(ctx, s)
+	} else if err == nil {
+		if s.Annotations[relocationv1alpha1.ClusterConfigAnnotation] != owner {
+			return nil, fmt.Errorf("secret %s already exists and doesn't belong to cluster config %s", key, owner)
+		}
+		if len(s.Data) != 1 || !bytes.Equal(s.Data[relocationv1alpha1.NetworkDataKey], data) {
+			s.Data = map[string][]byte{relocationv1alpha1.NetworkDataKey: data}
+			err = r.Update(ctx, s)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &corev1.SecretReference{Name: key.Name, Namespace: key.Namespace}, nil
+}
+
+// removeNetworkData deletes the copy of config's network data secret from the BareMetalHost namespace
+// The host's networkData is cleared first if it refers to the copy so it doesn't refer to a missing secret
+func (r *ClusterConfigReconciler) removeNetworkData(ctx context.Context, config *relocationv1alpha1.ClusterConfig) error {
+	if config.Spec.BareMetalHostRef == nil {
+		return nil
+	}
+	key := networkDataKey(config)
+	s := &corev1.Secret{}
+	if err := r.Get(ctx, key, s); err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+		s = nil
+	}
+	owner := types.NamespacedName{Namespace: config.Namespace, Name: config.Name}.String()
+	if s != nil && s.Annotations[relocationv1alpha1.ClusterConfigAnnotation] != owner {
+		return nil
+	}
+
+	if err := r.clearBMHNetworkData(ctx, config, key); err != nil {
+		return fmt.Errorf("failed to clear BareMetalHost network data: %w", err)
+	}
+	if s == nil {
+		return nil
+	}
+	return client.IgnoreNotFound(r.Delete(ctx, s))
+}
+
+// clearBMHNetworkData removes the networkData of the host referenced by config if it refers to the secret with key
+func (r *ClusterConfigReconciler) clearBMHNetworkData(ctx context.Context, config *relocationv1alpha1.ClusterConfig, key types.NamespacedName) error {
+	ref := configBMHRef(config)
+	bmh := &bmh_v1alpha1.BareMetalHost{}
+	bmhKey := types.NamespacedName{Name: ref.Name, Namespace: ref.Namespace}
+	if err := r.Get(ctx, bmhKey, bmh); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	data := bmh.Spec.NetworkData
+	// the baremetal-operator defaults an empty namespace to the host namespace, which is where the copy is
+	if data == nil || data.Name != key.Name || (data.Namespace != "" && data.Namespace != key.Namespace) {
+		return nil
+	}
+
+	// the host may be deleted along with its namespace in the meantime
+	patch := client.MergeFrom(bmh.DeepCopy())
+	bmh.Spec.NetworkData = nil
+	return client.IgnoreNotFound(r.Patch(ctx, bmh, patch))
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/carbonin/cluster-relocation-service/api/isoschema"
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+	"github.com/carbonin/cluster-relocation-service/internal/isostream"
+)
+
+// payloadSizeError is returned when the image built from the rendered payload is larger than the configured limit
+// files lists the rendered items so the largest can be found
+type payloadSizeError struct {
+	size  int64
+	limit int64
+	files []isoschema.File
+}
+
+func (e *payloadSizeError) Error() string {
+	files := make([]isoschema.File, len(e.files))
+	copy(files, e.files)
+	// list the largest items first as they're the most likely to need attention
+	sort.SliceStable(files, func(i, j int) bool { return files[i].Size > files[j].Size })
+
+	items := make([]string, 0, len(files))
+	for _, f := range files {
+		items = append(items, fmt.Sprintf("%s: %d bytes", f.Type, f.Size))
+	}
+	return fmt.Sprintf("image size %d bytes exceeds the limit of %d bytes (%s)", e.size, e.limit, strings.Join(items, ", "))
+}
+
+// checkPayloadSize returns a payloadSizeError if the image built from the files in filesDir exceeds limit
+// The files are those written by w along with the manifest and build info. A limit of zero or less disables the check
+func checkPayloadSize(filesDir string, w *isoschema.Writer, limit int64) error {
+	if limit <= 0 {
+		return nil
+	}
+	size, err := imageSize(filesDir)
+	if err != nil {
+		return fmt.Errorf("failed to calculate image size: %w", err)
+	}
+	if size <= limit {
+		return nil
+	}
+	return &payloadSizeError{size: size, limit: limit, files: w.Files()}
+}
+
+// imageSize returns the size of the ISO served for the files in dir, including the ISO 9660 structures around them
+// It's laid out the same way as streamed images, built images may differ by a few sectors
+func imageSize(dir string) (int64, error) {
+	var files []isostream.File
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		// only the layout is needed so the content is never read
+		files = append(files, isostream.File{Path: filepath.ToSlash(rel), Size: info.Size(), Mode: info.Mode()})
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	img, err := isostream.New(isoschema.VolumeLabel, time.Time{}, files)
+	if err != nil {
+		return 0, err
+	}
+	return img.Size(), nil
+}
+
+// releasePin returns the release recorded in the payload manifest for config, nil if the release isn't pinned
+func releasePin(config *relocationv1alpha1.ClusterConfig) *isoschema.Release {
+	if config.Spec.ReleaseImage == "" && len(config.Spec.AllowedReleaseVersions) == 0 {
+		return nil
+	}
+	return &isoschema.Release{
+		Image:           config.Spec.ReleaseImage,
+		AllowedVersions: config.Spec.AllowedReleaseVersions,
+	}
+}
+
+// imageVolume returns the volume label and metadata recorded in the payload manifest for config
+func imageVolume(config *relocationv1alpha1.ClusterConfig) (string, map[string]string) {
+	if config.Spec.ImageVolume == nil {
+		return "", nil
+	}
+	return config.Spec.ImageVolume.Label, config.Spec.ImageVolume.Metadata
+}
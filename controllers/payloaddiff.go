@@ -0,0 +1,224 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/carbonin/cluster-relocation-service/api/isoschema"
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+)
+
+const (
+	// maxPayloadChanges bounds the number of changes kept in the status
+	maxPayloadChanges = 50
+	// maxPayloadChangeValueLength bounds the length of each value kept in the status
+	maxPayloadChangeValueLength = 256
+)
+
+// payloadSnapshot maps each file type in a payload to its raw content
+type payloadSnapshot map[isoschema.FileType][]byte
+
+// snapshotPayload reads the payload currently in dir
+// A missing or unreadable payload results in an empty snapshot as there is nothing being served to compare against
+func snapshotPayload(dir string) payloadSnapshot {
+	reader, err := isoschema.NewReader(os.DirFS(dir))
+	if err != nil {
+		return nil
+	}
+	snapshot := payloadSnapshot{}
+	for _, f := range reader.Manifest().Files {
+		data, found, err := reader.ReadFile(f.Type)
+		if err != nil || !found {
+			continue
+		}
+		snapshot[f.Type] = data
+	}
+	return snapshot
+}
+
+// diffPayload lists the changed fields between two payloads ordered by file type and path
+// Values from Secrets are omitted so the result is safe to store in the status
+func diffPayload(old, new payloadSnapshot) (changes []relocationv1alpha1.PayloadChange, truncated bool) {
+	types := map[isoschema.FileType]bool{}
+	for t := range old {
+		types[t] = true
+	}
+	for t := range new {
+		types[t] = true
+	}
+	sorted := make([]string, 0, len(types))
+	for t := range types {
+		sorted = append(sorted, string(t))
+	}
+	sort.Strings(sorted)
+
+	for _, t := range sorted {
+		ft := isoschema.FileType(t)
+		oldData, inOld := old[ft]
+		newData, inNew := new[ft]
+		switch {
+		case !inOld:
+			changes = append(changes, relocationv1alpha1.PayloadChange{FileType: t, Operation: relocationv1alpha1.PayloadChangeAdded})
+		case !inNew:
+			changes = append(changes, relocationv1alpha1.PayloadChange{FileType: t, Operation: relocationv1alpha1.PayloadChangeRemoved})
+		default:
+			var oldObj, newObj interface{}
+			if json.Unmarshal(oldData, &oldObj) != nil || json.Unmarshal(newData, &newObj) != nil {
+				if string(oldData) != string(newData) {
+					changes = append(changes, relocationv1alpha1.PayloadChange{FileType: t, Operation: relocationv1alpha1.PayloadChangeModified, Redacted: true})
+				}
+				continue
+			}
+			redact := isSecret(oldObj) || isSecret(newObj)
+			for _, c := range diffValues("", oldObj, newObj) {
+				c.FileType = t
+				if redact {
+					c.Old, c.New, c.Redacted = "", "", true
+				}
+				changes = append(changes, c)
+			}
+		}
+	}
+
+	if len(changes) > maxPayloadChanges {
+		return changes[:maxPayloadChanges], true
+	}
+	return changes, false
+}
+
+// diffValues returns a change for each leaf that differs between two unmarshalled JSON values
+func diffValues(path string, old, new interface{}) []relocationv1alpha1.PayloadChange {
+	switch o := old.(type) {
+	case map[string]interface{}:
+		if n, ok := new.(map[string]interface{}); ok {
+			keys := make([]string, 0, len(o)+len(n))
+			for k := range o {
+				keys = append(keys, k)
+			}
+			for k := range n {
+				if _, ok := o[k]; !ok {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+
+			var changes []relocationv1alpha1.PayloadChange
+			for _, k := range keys {
+				changes = append(changes, diffValues(joinPath(path, k), o[k], n[k])...)
+			}
+			return changes
+		}
+	case []interface{}:
+		if n, ok := new.([]interface{}); ok {
+			var changes []relocationv1alpha1.PayloadChange
+			for i := 0; i < len(o) || i < len(n); i++ {
+				var oi, ni interface{}
+				if i < len(o) {
+					oi = o[i]
+				}
+				if i < len(n) {
+					ni = n[i]
+				}
+				changes = append(changes, diffValues(fmt.Sprintf("%s[%d]", path, i), oi, ni)...)
+			}
+			return changes
+		}
+	}
+
+	oldJSON, newJSON := encodeValue(old), encodeValue(new)
+	if oldJSON == newJSON {
+		return nil
+	}
+	change := relocationv1alpha1.PayloadChange{Path: path, Operation: relocationv1alpha1.PayloadChangeModified, Old: oldJSON, New: newJSON}
+	if old == nil {
+		change.Operation = relocationv1alpha1.PayloadChangeAdded
+	} else if new == nil {
+		change.Operation = relocationv1alpha1.PayloadChangeRemoved
+	}
+	return []relocationv1alpha1.PayloadChange{change}
+}
+
+// joinPath appends a field name to a dotted path, quoting names which would be ambiguous
+func joinPath(path, key string) string {
+	if strings.ContainsAny(key, ".[]\"") {
+		return fmt.Sprintf("%s[%q]", path, key)
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// encodeValue returns v as truncated JSON, or an empty string for a missing value
+func encodeValue(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	if len(data) > maxPayloadChangeValueLength {
+		return string(data[:maxPayloadChangeValueLength]) + "..."
+	}
+	return string(data)
+}
+
+// isSecret returns true if obj is a serialized Secret
+func isSecret(obj interface{}) bool {
+	m, ok := obj.(map[string]interface{})
+	return ok && m["kind"] == "Secret"
+}
+
+// newPayloadDiff returns the diff between the previously served payload and the one rendered with payloadHash
+// It returns nil if nothing was served before or nothing changed
+func newPayloadDiff(previous, rendered payloadSnapshot, payloadHash string) *relocationv1alpha1.PayloadDiff {
+	if len(previous) == 0 {
+		return nil
+	}
+	changes, truncated := diffPayload(previous, rendered)
+	if len(changes) == 0 {
+		return nil
+	}
+	return &relocationv1alpha1.PayloadDiff{
+		PayloadHash: payloadHash,
+		Time:        metav1.Now(),
+		Changes:     changes,
+		Truncated:   truncated,
+	}
+}
+
+// setPayloadDiff records the changes made by rendering a new payload in the status
+// It is set as soon as the payload is rendered so the changes can be reviewed before they reach the host
+func (r *ClusterConfigReconciler) setPayloadDiff(ctx context.Context, config *relocationv1alpha1.ClusterConfig, diff *relocationv1alpha1.PayloadDiff) error {
+	if diff == nil || (config.Status.PayloadDiff != nil && config.Status.PayloadDiff.PayloadHash == diff.PayloadHash) {
+		return nil
+	}
+
+	patch := client.MergeFrom(config.DeepCopy())
+	config.Status.PayloadDiff = diff
+	return r.Status().Patch(ctx, config, patch)
+}
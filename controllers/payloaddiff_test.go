@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/carbonin/cluster-relocation-service/api/isoschema"
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+)
+
+var _ = Describe("diffPayload", func() {
+	It("reports added and removed files", func() {
+		changes, truncated := diffPayload(
+			payloadSnapshot{isoschema.APICertSecretFileType: []byte(`{"kind": "Secret"}`)},
+			payloadSnapshot{isoschema.ImageTagMirrorSetFileType: []byte(`{"kind": "ImageTagMirrorSet"}`)},
+		)
+		Expect(truncated).To(BeFalse())
+		Expect(changes).To(Equal([]relocationv1alpha1.PayloadChange{
+			{FileType: string(isoschema.APICertSecretFileType), Operation: relocationv1alpha1.PayloadChangeRemoved},
+			{FileType: string(isoschema.ImageTagMirrorSetFileType), Operation: relocationv1alpha1.PayloadChangeAdded},
+		}))
+	})
+
+	It("reports changed fields in order", func() {
+		changes, _ := diffPayload(
+			payloadSnapshot{isoschema.ClusterRelocationFileType: []byte(`{"spec": {"domain": "a.example.com", "mirrors": ["one", "two"], "removed": true}}`)},
+			payloadSnapshot{isoschema.ClusterRelocationFileType: []byte(`{"spec": {"domain": "b.example.com", "mirrors": ["one"], "added": {"x": 1}}}`)},
+		)
+		t := string(isoschema.ClusterRelocationFileType)
+		Expect(changes).To(Equal([]relocationv1alpha1.PayloadChange{
+			{FileType: t, Path: "spec.added", Operation: relocationv1alpha1.PayloadChangeAdded, New: `{"x":1}`},
+			{FileType: t, Path: "spec.domain", Operation: relocationv1alpha1.PayloadChangeModified, Old: `"a.example.com"`, New: `"b.example.com"`},
+			{FileType: t, Path: "spec.mirrors[1]", Operation: relocationv1alpha1.PayloadChangeRemoved, Old: `"two"`},
+			{FileType: t, Path: "spec.removed", Operation: relocationv1alpha1.PayloadChangeRemoved, Old: "true"},
+		}))
+	})
+
+	It("never includes secret values", func() {
+		changes, _ := diffPayload(
+			payloadSnapshot{isoschema.PullSecretFileType: []byte(`{"kind": "Secret", "data": {"a": "b2xk"}}`)},
+			payloadSnapshot{isoschema.PullSecretFileType: []byte(`{"kind": "Secret", "data": {"a": "bmV3", "b": "bmV3"}}`)},
+		)
+		t := string(isoschema.PullSecretFileType)
+		Expect(changes).To(Equal([]relocationv1alpha1.PayloadChange{
+			{FileType: t, Path: "data.a", Operation: relocationv1alpha1.PayloadChangeModified, Redacted: true},
+			{FileType: t, Path: "data.b", Operation: relocationv1alpha1.PayloadChangeAdded, Redacted: true},
+		}))
+	})
+
+	It("reports nothing for identical payloads", func() {
+		p := payloadSnapshot{isoschema.ClusterRelocationFileType: []byte(`{"spec": {"domain": "a.example.com"}}`)}
+		changes, truncated := diffPayload(p, p)
+		Expect(changes).To(BeEmpty())
+		Expect(truncated).To(BeFalse())
+		Expect(newPayloadDiff(p, p, "hash")).To(BeNil())
+		Expect(newPayloadDiff(nil, p, "hash")).To(BeNil())
+	})
+
+	It("truncates long diffs", func() {
+		changes, truncated := diffPayload(
+			payloadSnapshot{isoschema.ClusterRelocationFileType: []byte(`{"a": [` + strings.TrimSuffix(strings.Repeat("0,", 60), ",") + `]}`)},
+			payloadSnapshot{isoschema.ClusterRelocationFileType: []byte(`{"a": [` + strings.TrimSuffix(strings.Repeat("1,", 60), ",") + `]}`)},
+		)
+		Expect(truncated).To(BeTrue())
+		Expect(changes).To(HaveLen(maxPayloadChanges))
+	})
+})
@@ -0,0 +1,172 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/carbonin/cluster-relocation-service/api/isoschema"
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+	"github.com/carbonin/cluster-relocation-service/internal/tracing"
+)
+
+// maxPluginOutputLength bounds the plugin output included in errors, the end of the output is kept
+const maxPluginOutputLength = 512
+
+// renderPlugins returns the executables in dir in the order they are run
+// Hidden entries are skipped, which includes the data links of a mounted ConfigMap
+func renderPlugins(dir string) ([]string, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list render plugins: %w", err)
+	}
+	var plugins []string
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		// ConfigMap keys are links so follow them
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check render plugin %s: %w", e.Name(), err)
+		}
+		if info.Mode().IsRegular() && info.Mode().Perm()&0111 != 0 {
+			plugins = append(plugins, path)
+		}
+	}
+	return plugins, nil
+}
+
+// runRenderPlugins runs each render plugin in order on a copy of the payload rendered with w
+// then records the files they added or changed with w
+// Files the plugins remove are still included in the payload
+func (r *ClusterConfigReconciler) runRenderPlugins(ctx context.Context, config *relocationv1alpha1.ClusterConfig, configDir string, w *isoschema.Writer) error {
+	plugins, err := renderPlugins(r.Options.RenderPluginsDir)
+	if err != nil || len(plugins) == 0 {
+		return err
+	}
+
+	workDir, err := os.MkdirTemp(configDir, "plugins")
+	if err != nil {
+		return fmt.Errorf("failed to create render plugin work dir: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	rendered := map[string]isoschema.File{}
+	original := map[string][]byte{}
+	for _, f := range w.Files() {
+		data, err := w.ReadFile(f.Path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(workDir, f.Path)
+		if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+			return err
+		}
+		if err := os.WriteFile(target, data, 0600); err != nil {
+			return err
+		}
+		rendered[f.Path] = f
+		original[f.Path] = data
+	}
+
+	for _, p := range plugins {
+		if err := r.runRenderPlugin(ctx, config, p, workDir); err != nil {
+			return err
+		}
+	}
+
+	return filepath.WalkDir(workDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(workDir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		// don't follow links a plugin leaves behind out of the work dir
+		if !d.Type().IsRegular() {
+			return fmt.Errorf("render plugins left %s which is not a regular file", rel)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		fileType := isoschema.PluginFileType
+		if f, ok := rendered[rel]; ok {
+			if bytes.Equal(original[rel], data) {
+				return nil
+			}
+			fileType = f.Type
+		}
+		return w.WriteFile(fileType, rel, data)
+	})
+}
+
+// runRenderPlugin runs the plugin at path with the payload work dir as its only argument
+func (r *ClusterConfigReconciler) runRenderPlugin(ctx context.Context, config *relocationv1alpha1.ClusterConfig, path, workDir string) (err error) {
+	name := filepath.Base(path)
+	attrs := append(tracing.ClusterConfigAttributes(config.Namespace, config.Name), attribute.String("plugin", name))
+	ctx, span := tracing.Start(ctx, "renderPlugin", attrs...)
+	defer func() { tracing.End(span, err) }()
+
+	if r.Options.RenderPluginTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Options.RenderPluginTimeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, path, workDir)
+	cmd.Dir = workDir
+	// the manager environment isn't passed on
+	cmd.Env = []string{
+		"PATH=" + os.Getenv("PATH"),
+		"CLUSTERCONFIG_NAMESPACE=" + config.Namespace,
+		"CLUSTERCONFIG_NAME=" + config.Name,
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return fmt.Errorf("render plugin %s failed: %w: %s", name, err, pluginOutput(out))
+	}
+	return nil
+}
+
+// pluginOutput returns the end of the output of a failed plugin
+func pluginOutput(out []byte) string {
+	out = bytes.TrimSpace(out)
+	if len(out) > maxPluginOutputLength {
+		out = out[len(out)-maxPluginOutputLength:]
+	}
+	return strings.Join(strings.Fields(string(out)), " ")
+}
@@ -0,0 +1,194 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	bmh_v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+)
+
+// preflightRecheckInterval is how often failed checks are run again
+// BareMetalHost changes are watched but the network config map is not
+const preflightRecheckInterval = time.Minute
+
+// runPreflight checks the host is ready for the image and records the results in the config status
+// It returns true if every check passed
+func (r *ClusterConfigReconciler) runPreflight(ctx context.Context, config *relocationv1alpha1.ClusterConfig) (bool, error) {
+	ref := configBMHRef(config)
+	bmh := &bmh_v1alpha1.BareMetalHost{}
+	key := types.NamespacedName{Name: ref.Name, Namespace: ref.Namespace}
+	if err := r.Get(ctx, key, bmh); err != nil {
+		return false, err
+	}
+
+	checks := []relocationv1alpha1.PreflightCheckResult{checkBMCReachable(bmh), checkHostInspected(bmh)}
+	if minSize := config.Spec.Preflight.MinDiskSize; minSize != nil {
+		checks = append(checks, checkDiskSize(bmh, ref, *minSize))
+	}
+	if config.Spec.NetworkConfigRef != nil {
+		check, err := r.checkNetworkConfig(ctx, config)
+		if err != nil {
+			return false, err
+		}
+		checks = append(checks, check)
+	}
+
+	passed := true
+	for _, c := range checks {
+		passed = passed && c.Passed
+	}
+
+	// only patch when the results change so passing checks don't update the status on every reconcile
+	existing := config.Status.Preflight
+	if existing != nil && existing.Passed == passed && equality.Semantic.DeepEqual(existing.Checks, checks) {
+		return passed, nil
+	}
+	patch := client.MergeFrom(config.DeepCopy())
+	config.Status.Preflight = &relocationv1alpha1.PreflightStatus{
+		Passed: passed,
+		Time:   metav1.Now(),
+		Checks: checks,
+	}
+	return passed, r.Status().Patch(ctx, config, patch)
+}
+
+// checkBMCReachable passes once the baremetal-operator has verified the BMC credentials
+func checkBMCReachable(bmh *bmh_v1alpha1.BareMetalHost) relocationv1alpha1.PreflightCheckResult {
+	check := relocationv1alpha1.PreflightCheckResult{Name: relocationv1alpha1.PreflightCheckBMCReachable}
+	switch {
+	case bmh.Status.ErrorType == bmh_v1alpha1.RegistrationError || bmh.Status.ErrorType == bmh_v1alpha1.PowerManagementError:
+		check.Message = fmt.Sprintf("the BMC is not reachable: %s", bmh.Status.ErrorMessage)
+	case bmh.Status.GoodCredentials.Reference == nil:
+		check.Message = "the BMC credentials have not been verified yet"
+	default:
+		check.Passed = true
+		check.Message = "the BMC credentials have been verified"
+	}
+	return check
+}
+
+// checkHostInspected passes once the hardware details of the host have been collected
+func checkHostInspected(bmh *bmh_v1alpha1.BareMetalHost) relocationv1alpha1.PreflightCheckResult {
+	check := relocationv1alpha1.PreflightCheckResult{Name: relocationv1alpha1.PreflightCheckHostInspected}
+	if bmh.Status.HardwareDetails == nil {
+		check.Message = "the host has not been inspected yet"
+		return check
+	}
+	check.Passed = true
+	check.Message = "the host hardware details are available"
+	return check
+}
+
+// checkDiskSize passes if the root disk is at least minSize
+// The root disk is the one named by the device name hint, or the largest disk if there isn't one
+func checkDiskSize(bmh *bmh_v1alpha1.BareMetalHost, bmhRef *relocationv1alpha1.BareMetalHostReference, minSize resource.Quantity) relocationv1alpha1.PreflightCheckResult {
+	check := relocationv1alpha1.PreflightCheckResult{Name: relocationv1alpha1.PreflightCheckDiskSize}
+	if bmh.Status.HardwareDetails == nil || len(bmh.Status.HardwareDetails.Storage) == 0 {
+		check.Message = "the host disks are not known"
+		return check
+	}
+
+	disk, err := rootDisk(bmh, bmhRef)
+	if err != nil {
+		check.Message = err.Error()
+		return check
+	}
+	size := resource.NewQuantity(int64(disk.SizeBytes), resource.BinarySI)
+	if size.Cmp(minSize) < 0 {
+		check.Message = fmt.Sprintf("root disk %s is %s which is smaller than the minimum of %s", disk.Name, size, minSize.String())
+		return check
+	}
+	check.Passed = true
+	check.Message = fmt.Sprintf("root disk %s is %s", disk.Name, size)
+	return check
+}
+
+// rootDisk returns the disk named by the device name hint, or the largest disk if there isn't one
+// The host must have been inspected and have at least one disk
+func rootDisk(bmh *bmh_v1alpha1.BareMetalHost, bmhRef *relocationv1alpha1.BareMetalHostReference) (*bmh_v1alpha1.Storage, error) {
+	hints := bmh.Spec.RootDeviceHints
+	if bmhRef.RootDeviceHints != nil {
+		hints = bmhRef.RootDeviceHints
+	}
+	disks := append([]bmh_v1alpha1.Storage{}, bmh.Status.HardwareDetails.Storage...)
+	sort.Slice(disks, func(i, j int) bool { return disks[i].SizeBytes > disks[j].SizeBytes })
+	if hints == nil || hints.DeviceName == "" {
+		return &disks[0], nil
+	}
+	for i := range disks {
+		if disks[i].Name == hints.DeviceName {
+			return &disks[i], nil
+		}
+	}
+	return nil, fmt.Errorf("the host has no disk named %s", hints.DeviceName)
+}
+
+// checkNetworkConfig passes if every file in the referenced network config map is a YAML document
+func (r *ClusterConfigReconciler) checkNetworkConfig(ctx context.Context, config *relocationv1alpha1.ClusterConfig) (relocationv1alpha1.PreflightCheckResult, error) {
+	check := relocationv1alpha1.PreflightCheckResult{Name: relocationv1alpha1.PreflightCheckNetworkConfig}
+	cm := &corev1.ConfigMap{}
+	key := types.NamespacedName{Name: config.Spec.NetworkConfigRef.Name, Namespace: config.Namespace}
+	if err := r.Get(ctx, key, cm); err != nil {
+		if errors.IsNotFound(err) {
+			check.Message = fmt.Sprintf("network config map %s does not exist", key.Name)
+			return check, nil
+		}
+		return check, err
+	}
+	if len(cm.Data) == 0 {
+		check.Message = fmt.Sprintf("network config map %s is empty", key.Name)
+		return check, nil
+	}
+	if err := executeTemplates(cm, config); err != nil {
+		check.Message = fmt.Sprintf("network config map %s could not be rendered: %s", key.Name, err)
+		return check, nil
+	}
+
+	names := make([]string, 0, len(cm.Data))
+	for name := range cm.Data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		doc := map[string]interface{}{}
+		if err := yaml.Unmarshal([]byte(cm.Data[name]), &doc); err != nil {
+			check.Message = fmt.Sprintf("%s in network config map %s is not valid YAML: %s", name, key.Name, err)
+			return check, nil
+		}
+		if len(doc) == 0 {
+			check.Message = fmt.Sprintf("%s in network config map %s is empty", name, key.Name)
+			return check, nil
+		}
+	}
+	check.Passed = true
+	check.Message = fmt.Sprintf("network config map %s contains %d valid files", key.Name, len(names))
+	return check, nil
+}
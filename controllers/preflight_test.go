@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+	bmh_v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+var _ = Describe("preflight checks", func() {
+	var bmh *bmh_v1alpha1.BareMetalHost
+
+	BeforeEach(func() {
+		bmh = &bmh_v1alpha1.BareMetalHost{
+			Status: bmh_v1alpha1.BareMetalHostStatus{
+				GoodCredentials: bmh_v1alpha1.CredentialsStatus{Reference: &corev1.SecretReference{Name: "bmc"}},
+				HardwareDetails: &bmh_v1alpha1.HardwareDetails{
+					Storage: []bmh_v1alpha1.Storage{
+						{Name: "/dev/sda", SizeBytes: 100 * bmh_v1alpha1.GigaByte},
+						{Name: "/dev/sdb", SizeBytes: 500 * bmh_v1alpha1.GigaByte},
+					},
+				},
+			},
+		}
+	})
+
+	It("checks the BMC credentials have been verified", func() {
+		Expect(checkBMCReachable(bmh).Passed).To(BeTrue())
+
+		bmh.Status.ErrorType = bmh_v1alpha1.RegistrationError
+		bmh.Status.ErrorMessage = "connection refused"
+		check := checkBMCReachable(bmh)
+		Expect(check.Passed).To(BeFalse())
+		Expect(check.Message).To(ContainSubstring("connection refused"))
+
+		bmh.Status.ErrorType = ""
+		bmh.Status.GoodCredentials.Reference = nil
+		Expect(checkBMCReachable(bmh).Passed).To(BeFalse())
+	})
+
+	It("checks the host has been inspected", func() {
+		Expect(checkHostInspected(bmh).Passed).To(BeTrue())
+		bmh.Status.HardwareDetails = nil
+		Expect(checkHostInspected(bmh).Passed).To(BeFalse())
+	})
+
+	It("checks the largest disk without hints", func() {
+		ref := &relocationv1alpha1.BareMetalHostReference{}
+		Expect(checkDiskSize(bmh, ref, resource.MustParse("400Gi")).Passed).To(BeTrue())
+
+		check := checkDiskSize(bmh, ref, resource.MustParse("1Ti"))
+		Expect(check.Passed).To(BeFalse())
+		Expect(check.Message).To(ContainSubstring("/dev/sdb"))
+	})
+
+	It("checks the disk named by the root device hints", func() {
+		ref := &relocationv1alpha1.BareMetalHostReference{RootDeviceHints: &bmh_v1alpha1.RootDeviceHints{DeviceName: "/dev/sda"}}
+		check := checkDiskSize(bmh, ref, resource.MustParse("400Gi"))
+		Expect(check.Passed).To(BeFalse())
+		Expect(check.Message).To(ContainSubstring("/dev/sda"))
+
+		bmh.Spec.RootDeviceHints = &bmh_v1alpha1.RootDeviceHints{DeviceName: "/dev/sdb"}
+		Expect(checkDiskSize(bmh, &relocationv1alpha1.BareMetalHostReference{}, resource.MustParse("400Gi")).Passed).To(BeTrue())
+
+		ref.RootDeviceHints.DeviceName = "/dev/nvme0n1"
+		Expect(checkDiskSize(bmh, ref, resource.MustParse("1Gi")).Message).To(ContainSubstring("no disk named /dev/nvme0n1"))
+	})
+
+	It("fails the disk check before inspection", func() {
+		bmh.Status.HardwareDetails = nil
+		Expect(checkDiskSize(bmh, &relocationv1alpha1.BareMetalHostReference{}, resource.MustParse("1Gi")).Passed).To(BeFalse())
+	})
+})
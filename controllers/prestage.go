@@ -0,0 +1,259 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+	"github.com/carbonin/cluster-relocation-service/internal/httpclient"
+	"github.com/carbonin/cluster-relocation-service/internal/imageserver"
+	"github.com/carbonin/cluster-relocation-service/internal/prestage"
+	"github.com/carbonin/cluster-relocation-service/internal/tracing"
+)
+
+const (
+	// prestageWorkDir is the directory in DataDir images are built in before they're uploaded to a cache
+	prestageWorkDir = "prestage-workdir"
+	// prestageQueueName names the prestage queue in the workqueue metrics
+	prestageQueueName = "clusterconfig_prestage"
+	// prestageRetryBaseDelay and prestageRetryMaxDelay bound the wait before a failed upload is retried
+	prestageRetryBaseDelay = 5 * time.Second
+	prestageRetryMaxDelay  = 5 * time.Minute
+	// cacheUploadFailedReason is the event reason when an image couldn't be uploaded to a zone cache
+	cacheUploadFailedReason = "CacheUploadFailed"
+)
+
+// zoneCacheURL returns the cache of the zone of config, including its upload credentials, and whether there is one
+func (r *ClusterConfigReconciler) zoneCacheURL(config *relocationv1alpha1.ClusterConfig) (string, bool) {
+	zone := config.Labels[relocationv1alpha1.ZoneLabel]
+	cache, ok := r.Options.ZoneCacheURLs[zone]
+	if zone == "" || !ok || config.Spec.ExternalImageURL != "" {
+		return "", false
+	}
+	return cache, true
+}
+
+// cacheURL returns the URL the image of config is uploaded to in the cache of its zone, or an empty string if
+// the zone has no cache. The name includes the payload version so a cache never serves an outdated image
+func (r *ClusterConfigReconciler) cacheURL(config *relocationv1alpha1.ClusterConfig) (string, error) {
+	cache, ok := r.zoneCacheURL(config)
+	if !ok || config.Status.PayloadHash == "" {
+		return "", nil
+	}
+	name := fmt.Sprintf("%s-%s.iso", config.Name, config.Status.PayloadHash[:payloadVersionLength])
+	return url.JoinPath(cache, config.Namespace, name)
+}
+
+// prestageImage makes sure the image of config is uploaded to the cache of its zone and returns true while the
+// upload is queued. The URL hosts download it from is recorded in the status once it is uploaded, and cleared
+// if the zone has no cache
+func (r *ClusterConfigReconciler) prestageImage(ctx context.Context, config *relocationv1alpha1.ClusterConfig) (bool, error) {
+	dest, err := r.cacheURL(config)
+	if err != nil {
+		return false, err
+	}
+	downloadURL := prestage.DownloadURL(dest)
+	if config.Status.CachedImageURL == downloadURL {
+		return false, nil
+	}
+	if dest == "" || r.Prestages != nil {
+		if dest != "" {
+			r.Prestages.Add(types.NamespacedName{Namespace: config.Namespace, Name: config.Name})
+		}
+		// the image of a previous payload must not be attached while the upload is queued
+		if config.Status.CachedImageURL != "" {
+			patch := client.MergeFrom(config.DeepCopy())
+			config.Status.CachedImageURL = ""
+			if err := r.Status().Patch(ctx, config, patch); err != nil {
+				return false, err
+			}
+		}
+		return dest != "", nil
+	}
+	return false, r.uploadImage(ctx, config, dest)
+}
+
+// uploadImage uploads the image of config to dest unless the cache already has it and records the URL hosts
+// download it from in the status
+func (r *ClusterConfigReconciler) uploadImage(ctx context.Context, config *relocationv1alpha1.ClusterConfig, dest string) (err error) {
+	ctx, span := tracing.Start(ctx, "prestageImage", tracing.ClusterConfigAttributes(config.Namespace, config.Name)...)
+	defer func() { tracing.End(span, err) }()
+
+	if err := r.publishImage(ctx, config, dest); err != nil {
+		return err
+	}
+	patch := client.MergeFrom(config.DeepCopy())
+	config.Status.CachedImageURL = prestage.DownloadURL(dest)
+	return r.Status().Patch(ctx, config, patch)
+}
+
+// publishImage builds the image of config and uploads it to dest if it isn't there already
+func (r *ClusterConfigReconciler) publishImage(ctx context.Context, config *relocationv1alpha1.ClusterConfig, dest string) error {
+	factory := r.HTTPClients
+	if factory == nil {
+		factory = &httpclient.Factory{Reader: r.Client}
+	}
+	c, err := factory.Client(ctx)
+	if err != nil {
+		return err
+	}
+	// images can take longer to upload over a WAN than the default request timeout allows
+	c.Timeout = r.Options.CacheUploadTimeout
+	publisher := &prestage.Publisher{Client: c}
+
+	exists, err := publisher.Exists(ctx, dest)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	configDir := r.configDir(config)
+	if r.Options.ISOStreaming {
+		img, err := imageserver.OpenISO(ctx, configDir, filepath.Join(configDir, "files"), r.Options.LockTimeout)
+		if err != nil {
+			return fmt.Errorf("failed to open image: %w", err)
+		}
+		defer img.Close()
+		return publisher.UploadContent(ctx, img, img.Size(), dest)
+	}
+
+	workDir := filepath.Join(r.Options.DataDir, prestageWorkDir)
+	if err := r.fs().MkdirAll(workDir, 0700); err != nil {
+		return err
+	}
+	iso, err := imageserver.BuildISO(ctx, workDir, configDir, filepath.Join(configDir, "files"), r.Options.LockTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to build image: %w", err)
+	}
+	defer os.Remove(iso.Path)
+	r.Builds.Record(ctx, client.ObjectKeyFromObject(config), iso.Key, iso.Stats)
+
+	return publisher.Upload(ctx, iso.Path, dest)
+}
+
+// PrestageQueue builds and uploads images to zone caches outside of the reconcile loop
+// Uploads over slow WAN links can take minutes, so they run Workers at once without holding up reconciles
+type PrestageQueue struct {
+	Reconciler *ClusterConfigReconciler
+	Workers    int
+
+	queue workqueue.RateLimitingInterface
+}
+
+// NewPrestageQueue returns a queue running the uploads of r with the given number of workers
+func NewPrestageQueue(r *ClusterConfigReconciler, workers int) *PrestageQueue {
+	return &PrestageQueue{
+		Reconciler: r,
+		Workers:    workers,
+		queue: workqueue.NewRateLimitingQueueWithConfig(
+			workqueue.NewItemExponentialFailureRateLimiter(prestageRetryBaseDelay, prestageRetryMaxDelay),
+			workqueue.RateLimitingQueueConfig{Name: prestageQueueName},
+		),
+	}
+}
+
+// Add queues the upload of a config's image, it is a no-op if the config is already queued
+func (q *PrestageQueue) Add(key types.NamespacedName) {
+	q.queue.Add(key)
+}
+
+// Len returns the number of configs waiting for their image to be uploaded
+func (q *PrestageQueue) Len() int {
+	return q.queue.Len()
+}
+
+// Start runs the workers until the context is cancelled
+func (q *PrestageQueue) Start(ctx context.Context) error {
+	go func() {
+		<-ctx.Done()
+		q.queue.ShutDown()
+	}()
+	for i := 0; i < q.Workers; i++ {
+		go wait.UntilWithContext(ctx, func(ctx context.Context) {
+			for q.processNext(ctx) {
+			}
+		}, time.Second)
+	}
+	<-ctx.Done()
+	return nil
+}
+
+// processNext uploads the image of the next queued config and returns false once the queue is shut down
+func (q *PrestageQueue) processNext(ctx context.Context) bool {
+	item, shutdown := q.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer q.queue.Done(item)
+
+	key := item.(types.NamespacedName)
+	if q.upload(ctx, key) {
+		q.queue.Forget(item)
+	} else {
+		q.queue.AddRateLimited(item)
+	}
+	return true
+}
+
+// upload uploads the image of the config with key for its current payload and returns false if it should be retried
+// Recording the URL in the status reconciles the config again so the image is attached
+func (q *PrestageQueue) upload(ctx context.Context, key types.NamespacedName) bool {
+	r := q.Reconciler
+	log := r.Log.WithFields(logrus.Fields{"name": key.Name, "namespace": key.Namespace})
+	config := &relocationv1alpha1.ClusterConfig{}
+	if err := r.Get(ctx, key, config); err != nil {
+		if errors.IsNotFound(err) {
+			return true
+		}
+		log.WithError(err).Error("failed to get cluster config")
+		return false
+	}
+	if !config.DeletionTimestamp.IsZero() {
+		return true
+	}
+	dest, err := r.cacheURL(config)
+	if err != nil {
+		// the cache URL is validated so this won't succeed until the configuration changes
+		log.WithError(err).Error("invalid zone cache URL")
+		return true
+	}
+	if dest == "" || config.Status.CachedImageURL == prestage.DownloadURL(dest) {
+		return true
+	}
+
+	if err := r.uploadImage(ctx, config, dest); err != nil {
+		r.Notifier.Warningf(config, cacheUploadFailedReason, "failed to upload image to the zone cache: %v", err)
+		return false
+	}
+	log.Infof("uploaded image to %s", prestage.DownloadURL(dest))
+	return true
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/carbonin/cluster-relocation-service/api/isoschema"
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+	"github.com/carbonin/cluster-relocation-service/internal/version"
+)
+
+// payloadSources returns the ClusterConfig and the objects the renderers read for it, in render order
+func (r *ClusterConfigReconciler) payloadSources(ctx context.Context, config *relocationv1alpha1.ClusterConfig) ([]isoschema.Source, error) {
+	sources := []isoschema.Source{{
+		Kind:            "ClusterConfig",
+		Namespace:       config.Namespace,
+		Name:            config.Name,
+		ResourceVersion: config.ResourceVersion,
+	}}
+	seen := map[isoschema.Source]bool{}
+	for _, pr := range payloadRenderers {
+		if pr.Inputs == nil {
+			continue
+		}
+		for _, in := range pr.Inputs(config) {
+			key := isoschema.Source{Kind: in.Kind, Namespace: in.Namespace, Name: in.Name}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			obj, err := newInputObject(in.Kind)
+			if err != nil {
+				return nil, err
+			}
+			if err := r.Get(ctx, types.NamespacedName{Namespace: in.Namespace, Name: in.Name}, obj); err != nil {
+				if errors.IsNotFound(err) {
+					continue
+				}
+				return nil, err
+			}
+			key.ResourceVersion = obj.GetResourceVersion()
+			sources = append(sources, key)
+		}
+	}
+	return sources, nil
+}
+
+// writeBuildInfo writes the build info for the payload with the given hash
+// The existing build info is kept while the hash is unchanged so it records when the content was first rendered
+func (r *ClusterConfigReconciler) writeBuildInfo(ctx context.Context, config *relocationv1alpha1.ClusterConfig, filesDir string, w *isoschema.Writer, payloadHash string) error {
+	existing, err := isoschema.ReadBuildInfo(os.DirFS(filesDir))
+	if err == nil && existing != nil && existing.PayloadHash == payloadHash {
+		return nil
+	}
+
+	sources, err := r.payloadSources(ctx, config)
+	if err != nil {
+		return err
+	}
+	return w.WriteBuildInfo(&isoschema.BuildInfo{
+		Version:     version.Version,
+		GitCommit:   version.Commit(),
+		BuildTime:   time.Now().UTC().Truncate(time.Second),
+		PayloadHash: payloadHash,
+		Sources:     sources,
+	})
+}
+
+// setBuildInfo copies the build info of the rendered payload into the status
+// It is removed when the config has no rendered payload
+func (r *ClusterConfigReconciler) setBuildInfo(ctx context.Context, config *relocationv1alpha1.ClusterConfig) error {
+	var status *relocationv1alpha1.BuildInfo
+	if config.Spec.ExternalImageURL == "" {
+		info, err := isoschema.ReadBuildInfo(os.DirFS(filepath.Join(r.configDir(config), "files")))
+		if err != nil {
+			return err
+		}
+		if info != nil {
+			status = &relocationv1alpha1.BuildInfo{
+				Version:     info.Version,
+				GitCommit:   info.GitCommit,
+				BuildTime:   metav1.NewTime(info.BuildTime),
+				PayloadHash: info.PayloadHash,
+			}
+			for _, s := range info.Sources {
+				status.Sources = append(status.Sources, relocationv1alpha1.BuildSource(s))
+			}
+		}
+	}
+
+	if equality.Semantic.DeepEqual(config.Status.BuildInfo, status) {
+		return nil
+	}
+	patch := client.MergeFrom(config.DeepCopy())
+	config.Status.BuildInfo = status
+	return r.Status().Patch(ctx, config, patch)
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+	"github.com/carbonin/cluster-relocation-service/internal/report"
+)
+
+// provisioningName is the name of the singleton Provisioning managed by the cluster-baremetal-operator
+const provisioningName = "provisioning-configuration"
+
+// provisioningGVK identifies the cluster-baremetal-operator Provisioning kind
+// It's read as unstructured to avoid depending on the operator's API module
+var provisioningGVK = schema.GroupVersionKind{Group: "metal3.io", Version: "v1alpha1", Kind: "Provisioning"}
+
+// provisioningNetworkDisabled is the provisioningNetwork value used when Ironic only uses the external network
+const provisioningNetworkDisabled = "Disabled"
+
+// unstructured objects are read directly from the API server rather than the cache
+//+kubebuilder:rbac:groups=metal3.io,resources=provisionings,verbs=get
+
+// checkProvisioningNetwork returns a message describing why Ironic can't reach the image service
+// with the hub's provisioning configuration, or an empty string if it can
+// Clusters without a Provisioning are assumed to be able to reach the service
+func (r *ClusterConfigReconciler) checkProvisioningNetwork(ctx context.Context) (string, error) {
+	p := &unstructured.Unstructured{}
+	p.SetGroupVersionKind(provisioningGVK)
+	if err := r.Get(ctx, types.NamespacedName{Name: provisioningName}, p); err != nil {
+		if errors.IsNotFound(err) || meta.IsNoMatchError(err) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	network, _, err := unstructured.NestedString(p.Object, "spec", "provisioningNetwork")
+	if err != nil {
+		return "", err
+	}
+	viaExternal, _, err := unstructured.NestedBool(p.Object, "spec", "virtualMediaViaExternalNetwork")
+	if err != nil {
+		return "", err
+	}
+
+	// an unset network defaults to Managed in the cluster-baremetal-operator
+	if network == provisioningNetworkDisabled || viaExternal {
+		return "", nil
+	}
+	if network == "" {
+		network = "Managed"
+	}
+	return fmt.Sprintf("virtual media is served over the %s provisioning network which cannot reach the image service at %s, set virtualMediaViaExternalNetwork in the %s Provisioning to attach images", network, r.baseURL(), provisioningName), nil
+}
+
+// setImageReachable records whether Ironic can reach the image service in the config status
+func (r *ClusterConfigReconciler) setImageReachable(ctx context.Context, config *relocationv1alpha1.ClusterConfig, unreachable string) error {
+	cond := metav1.Condition{
+		Type:               relocationv1alpha1.ImageReachableCondition,
+		Status:             metav1.ConditionTrue,
+		Reason:             relocationv1alpha1.ImageReachableReason,
+		Message:            "the image service is reachable with the hub provisioning configuration",
+		ObservedGeneration: config.Generation,
+	}
+	if unreachable != "" {
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = relocationv1alpha1.ProvisioningNetworkUnreachableReason
+		cond.Message = unreachable
+	}
+
+	patch := client.MergeFrom(config.DeepCopy())
+	if !report.SetCondition(&config.Status.Conditions, cond) {
+		return nil
+	}
+	return r.Status().Patch(ctx, config, patch)
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	cro "github.com/RHsyseng/cluster-relocation-operator/api/v1beta1"
+	"github.com/carbonin/cluster-relocation-service/api/isoschema"
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+	configv1 "github.com/openshift/api/config/v1"
+)
+
+// clusterRelocationRenderer writes the ClusterRelocation consumed by the cluster-relocation-operator
+var clusterRelocationRenderer = payloadRenderer{
+	Name:     "cluster relocation",
+	FileType: isoschema.ClusterRelocationFileType,
+	Render:   renderClusterRelocation,
+}
+
+func renderClusterRelocation(_ context.Context, r *ClusterConfigReconciler, config *relocationv1alpha1.ClusterConfig) (runtime.Object, error) {
+	cr := &cro.ClusterRelocation{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      config.Name,
+			Namespace: config.Namespace,
+		},
+		Spec: *config.Spec.ClusterRelocationSpec.DeepCopy(),
+	}
+	for _, m := range config.Spec.RepositoryDigestMirrors {
+		cr.Spec.ImageDigestMirrors = append(cr.Spec.ImageDigestMirrors, convertRepositoryDigestMirrors(m))
+	}
+	// the ClusterRelocation creates an ImageDigestMirrorSet which older clusters don't support
+	if relocationv1alpha1.EffectiveMirrorOutput(&config.Spec) == relocationv1alpha1.MirrorOutputImageContentSourcePolicy {
+		cr.Spec.ImageDigestMirrors = nil
+	}
+	// the annotation is only added when set so the payload of existing configs doesn't change
+	if config.Spec.RegenerateClusterIdentity {
+		metav1.SetMetaDataAnnotation(&cr.ObjectMeta, isoschema.RegenerateClusterIdentityAnnotation, "true")
+	}
+
+	if err := r.setTypeMeta(cr); err != nil {
+		return nil, err
+	}
+
+	return cr, nil
+}
+
+// convertRepositoryDigestMirrors converts legacy ImageContentSourcePolicy mirrors to the equivalent digest mirrors
+func convertRepositoryDigestMirrors(m relocationv1alpha1.RepositoryDigestMirrors) configv1.ImageDigestMirrors {
+	idm := configv1.ImageDigestMirrors{Source: m.Source}
+	for _, mirror := range m.Mirrors {
+		idm.Mirrors = append(idm.Mirrors, configv1.ImageMirror(mirror))
+	}
+	return idm
+}
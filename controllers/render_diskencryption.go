@@ -0,0 +1,63 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/carbonin/cluster-relocation-service/api/isoschema"
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+)
+
+// diskEncryptionRenderer writes how the relocated host binds its encrypted disks
+var diskEncryptionRenderer = payloadRenderer{
+	Name:     "disk encryption",
+	FileType: isoschema.DiskEncryptionFileType,
+	Render:   renderDiskEncryption,
+}
+
+func renderDiskEncryption(_ context.Context, r *ClusterConfigReconciler, config *relocationv1alpha1.ClusterConfig) (runtime.Object, error) {
+	encryption := config.Spec.DiskEncryption
+	if encryption == nil {
+		return nil, nil
+	}
+
+	rendered := isoschema.DiskEncryption{Mode: string(encryption.Mode)}
+	for _, server := range encryption.TangServers {
+		rendered.TangServers = append(rendered.TangServers, isoschema.TangServer{URL: server.URL, Thumbprint: server.Thumbprint})
+	}
+	data, err := json.Marshal(rendered)
+	if err != nil {
+		return nil, err
+	}
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: config.Name,
+		},
+		Data: map[string]string{isoschema.DiskEncryptionKey: string(data)},
+	}
+	if err := r.setTypeMeta(cm); err != nil {
+		return nil, err
+	}
+
+	return cm, nil
+}
@@ -0,0 +1,40 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/carbonin/cluster-relocation-service/api/isoschema"
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+)
+
+// extraManifestsRenderer copies the referenced manifests into the payload for the relocated cluster to apply
+var extraManifestsRenderer = withTemplates(objectRenderer("extra manifests", isoschema.ExtraManifestsFileType, func(config *relocationv1alpha1.ClusterConfig) *corev1.ObjectReference {
+	if config.Spec.ExtraManifestsRef == nil {
+		return nil
+	}
+	return &corev1.ObjectReference{Kind: "ConfigMap", Namespace: config.Namespace, Name: config.Spec.ExtraManifestsRef.Name}
+}, func(obj client.Object) error {
+	if len(obj.(*corev1.ConfigMap).Data) == 0 {
+		return fmt.Errorf("extra manifests config map %s is empty", client.ObjectKeyFromObject(obj))
+	}
+	return nil
+}))
@@ -0,0 +1,72 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/carbonin/cluster-relocation-service/api/isoschema"
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+	operatorv1alpha1 "github.com/openshift/api/operator/v1alpha1"
+)
+
+// imageContentSourcePolicyRenderer writes an ImageContentSourcePolicy when digest mirrors are configured
+// and the mirror output includes them
+var imageContentSourcePolicyRenderer = payloadRenderer{
+	Name:     "image content source policy",
+	FileType: isoschema.ImageContentSourcePolicyFileType,
+	Render:   renderImageContentSourcePolicy,
+}
+
+func renderImageContentSourcePolicy(_ context.Context, r *ClusterConfigReconciler, config *relocationv1alpha1.ClusterConfig) (runtime.Object, error) {
+	output := relocationv1alpha1.EffectiveMirrorOutput(&config.Spec)
+	if output != relocationv1alpha1.MirrorOutputImageContentSourcePolicy && output != relocationv1alpha1.MirrorOutputBoth {
+		return nil, nil
+	}
+
+	var mirrors []operatorv1alpha1.RepositoryDigestMirrors
+	for _, idm := range config.Spec.ImageDigestMirrors {
+		m := operatorv1alpha1.RepositoryDigestMirrors{Source: idm.Source}
+		for _, mirror := range idm.Mirrors {
+			m.Mirrors = append(m.Mirrors, string(mirror))
+		}
+		mirrors = append(mirrors, m)
+	}
+	for _, rdm := range config.Spec.RepositoryDigestMirrors {
+		mirrors = append(mirrors, operatorv1alpha1.RepositoryDigestMirrors{Source: rdm.Source, Mirrors: rdm.Mirrors})
+	}
+	if len(mirrors) == 0 {
+		return nil, nil
+	}
+
+	icsp := &operatorv1alpha1.ImageContentSourcePolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: config.Name,
+		},
+		Spec: operatorv1alpha1.ImageContentSourcePolicySpec{
+			RepositoryDigestMirrors: mirrors,
+		},
+	}
+	if err := r.setTypeMeta(icsp); err != nil {
+		return nil, err
+	}
+
+	return icsp, nil
+}
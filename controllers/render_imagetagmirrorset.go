@@ -0,0 +1,55 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/carbonin/cluster-relocation-service/api/isoschema"
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+	configv1 "github.com/openshift/api/config/v1"
+)
+
+// imageTagMirrorSetRenderer writes an ImageTagMirrorSet when tag mirrors are configured
+var imageTagMirrorSetRenderer = payloadRenderer{
+	Name:     "image tag mirror set",
+	FileType: isoschema.ImageTagMirrorSetFileType,
+	Render:   renderImageTagMirrorSet,
+}
+
+func renderImageTagMirrorSet(_ context.Context, r *ClusterConfigReconciler, config *relocationv1alpha1.ClusterConfig) (runtime.Object, error) {
+	if len(config.Spec.ImageTagMirrors) == 0 {
+		return nil, nil
+	}
+
+	itms := &configv1.ImageTagMirrorSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: config.Name,
+		},
+		Spec: configv1.ImageTagMirrorSetSpec{
+			ImageTagMirrors: config.Spec.ImageTagMirrors,
+		},
+	}
+	if err := r.setTypeMeta(itms); err != nil {
+		return nil, err
+	}
+
+	return itms, nil
+}
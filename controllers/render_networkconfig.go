@@ -0,0 +1,119 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/carbonin/cluster-relocation-service/api/isoschema"
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+)
+
+// networkConfigRenderer copies the nmstate files of the network config map so they can be applied on the host,
+// or fetched on their own by flows which deliver the network configuration separately from the image
+var networkConfigRenderer = withInterfaceNames(withTemplates(objectRenderer("network config", isoschema.NetworkConfigFileType, func(config *relocationv1alpha1.ClusterConfig) *corev1.ObjectReference {
+	if config.Spec.NetworkConfigRef == nil {
+		return nil
+	}
+	return &corev1.ObjectReference{Kind: "ConfigMap", Namespace: config.Namespace, Name: config.Spec.NetworkConfigRef.Name}
+}, func(obj client.Object) error {
+	if len(obj.(*corev1.ConfigMap).Data) == 0 {
+		return fmt.Errorf("network config map %s is empty", client.ObjectKeyFromObject(obj))
+	}
+	return nil
+})))
+
+// withInterfaceNames wraps the network config renderer pr to fill in interface names from the host inspection data
+// for configs with InterfaceNamesFromHost set
+func withInterfaceNames(pr payloadRenderer) payloadRenderer {
+	render := pr.Render
+	pr.Render = func(ctx context.Context, r *ClusterConfigReconciler, config *relocationv1alpha1.ClusterConfig) (runtime.Object, error) {
+		obj, err := render(ctx, r, config)
+		if err != nil || obj == nil || !config.Spec.InterfaceNamesFromHost {
+			return obj, err
+		}
+		hw := config.Status.HostHardware
+		if hw == nil {
+			ref := configBMHRef(config)
+			return nil, fmt.Errorf("BareMetalHost %s/%s has not been inspected yet", ref.Namespace, ref.Name)
+		}
+		cm := obj.(*corev1.ConfigMap)
+		names := make([]string, 0, len(cm.Data))
+		for name := range cm.Data {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			content, err := fillInterfaceNames(cm.Data[name], hw.NICs)
+			if err != nil {
+				return nil, fmt.Errorf("failed to fill interface names in %s: %w", name, err)
+			}
+			cm.Data[name] = content
+		}
+		return cm, nil
+	}
+	return pr
+}
+
+// fillInterfaceNames sets the name of each interface in the nmstate document content which has a mac-address
+// but no name to the name of the NIC with that address. The content is returned unchanged if no names are missing
+func fillInterfaceNames(content string, nics []relocationv1alpha1.HostNIC) (string, error) {
+	doc := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(content), &doc); err != nil {
+		return "", err
+	}
+	interfaces, _ := doc["interfaces"].([]interface{})
+	changed := false
+	for _, i := range interfaces {
+		iface, ok := i.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		mac, _ := iface["mac-address"].(string)
+		if name, _ := iface["name"].(string); name != "" || mac == "" {
+			continue
+		}
+		name := ""
+		for _, nic := range nics {
+			if strings.EqualFold(nic.MAC, mac) {
+				name = nic.Name
+				break
+			}
+		}
+		if name == "" {
+			return "", fmt.Errorf("the host has no network interface with MAC address %s", mac)
+		}
+		iface["name"] = name
+		changed = true
+	}
+	if !changed {
+		return content, nil
+	}
+	out, err := yaml.Marshal(doc)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
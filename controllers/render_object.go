@@ -0,0 +1,108 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/carbonin/cluster-relocation-service/api/isoschema"
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+)
+
+// objectRenderer returns a renderer copying the Secret or ConfigMap returned by ref into the payload as t
+// The file is removed if the reference is unset. check validates the object before it is written and may be nil
+func objectRenderer(name string, t isoschema.FileType, ref func(*relocationv1alpha1.ClusterConfig) *corev1.ObjectReference, check func(client.Object) error) payloadRenderer {
+	return payloadRenderer{
+		Name:     name,
+		FileType: t,
+		Inputs: func(config *relocationv1alpha1.ClusterConfig) []corev1.ObjectReference {
+			objRef := ref(config)
+			if objRef == nil {
+				return nil
+			}
+			return []corev1.ObjectReference{*objRef}
+		},
+		Render: func(ctx context.Context, r *ClusterConfigReconciler, config *relocationv1alpha1.ClusterConfig) (runtime.Object, error) {
+			objRef := ref(config)
+			if objRef == nil {
+				return nil, nil
+			}
+
+			obj, err := newInputObject(objRef.Kind)
+			if err != nil {
+				return nil, err
+			}
+			key := types.NamespacedName{Name: objRef.Name, Namespace: objRef.Namespace}
+			if err := r.Get(ctx, key, obj); err != nil {
+				return nil, err
+			}
+			if check != nil {
+				if err := check(obj); err != nil {
+					return nil, err
+				}
+			}
+			return obj, nil
+		},
+	}
+}
+
+// newInputObject returns an empty object of a kind which can be copied into the payload
+func newInputObject(kind string) (client.Object, error) {
+	switch kind {
+	case "Secret":
+		return &corev1.Secret{}, nil
+	case "ConfigMap":
+		return &corev1.ConfigMap{}, nil
+	default:
+		return nil, fmt.Errorf("%s objects can't be copied into the payload", kind)
+	}
+}
+
+// secretRenderer returns a renderer copying the secret returned by ref into the payload as t
+// The file is removed if the reference is unset
+func secretRenderer(name string, t isoschema.FileType, ref func(*relocationv1alpha1.ClusterConfig) *corev1.SecretReference) payloadRenderer {
+	return objectRenderer(name, t, func(config *relocationv1alpha1.ClusterConfig) *corev1.ObjectReference {
+		secretRef := ref(config)
+		if secretRef == nil {
+			return nil
+		}
+		return &corev1.ObjectReference{Kind: "Secret", Namespace: secretRef.Namespace, Name: secretRef.Name}
+	}, nil)
+}
+
+// configMapRenderer returns a renderer copying the config map in the ClusterConfig namespace returned by ref
+// into the payload as t. The config map must contain key and the file is removed if the reference is unset
+func configMapRenderer(name string, t isoschema.FileType, ref func(*relocationv1alpha1.ClusterConfig) *corev1.LocalObjectReference, key string) payloadRenderer {
+	return objectRenderer(name, t, func(config *relocationv1alpha1.ClusterConfig) *corev1.ObjectReference {
+		cmRef := ref(config)
+		if cmRef == nil {
+			return nil
+		}
+		return &corev1.ObjectReference{Kind: "ConfigMap", Namespace: config.Namespace, Name: cmRef.Name}
+	}, func(obj client.Object) error {
+		if _, ok := obj.(*corev1.ConfigMap).Data[key]; !ok {
+			return fmt.Errorf("config map %s does not contain %s", client.ObjectKeyFromObject(obj), key)
+		}
+		return nil
+	})
+}
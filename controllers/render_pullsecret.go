@@ -0,0 +1,128 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/carbonin/cluster-relocation-service/api/isoschema"
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+	"github.com/carbonin/cluster-relocation-service/internal/redact"
+)
+
+// pullSecretRenderer copies the pull secret into the payload with the additional pull secrets merged into it
+// The secret is copied unchanged when there are no additional pull secrets
+var pullSecretRenderer = payloadRenderer{
+	Name:     "pull secret",
+	FileType: isoschema.PullSecretFileType,
+	Inputs: func(config *relocationv1alpha1.ClusterConfig) []corev1.ObjectReference {
+		var refs []corev1.ObjectReference
+		if ref := config.Spec.PullSecretRef; ref != nil {
+			refs = append(refs, corev1.ObjectReference{Kind: "Secret", Namespace: ref.Namespace, Name: ref.Name})
+		}
+		for _, ref := range config.Spec.AdditionalPullSecretRefs {
+			refs = append(refs, corev1.ObjectReference{Kind: "Secret", Namespace: ref.Namespace, Name: ref.Name})
+		}
+		return refs
+	},
+	Render: func(ctx context.Context, r *ClusterConfigReconciler, config *relocationv1alpha1.ClusterConfig) (runtime.Object, error) {
+		if config.Spec.PullSecretRef == nil {
+			return nil, nil
+		}
+		s, err := r.getSecret(ctx, config.Spec.PullSecretRef)
+		if err != nil {
+			return nil, err
+		}
+		if len(config.Spec.AdditionalPullSecretRefs) == 0 {
+			return s, nil
+		}
+
+		auths, err := pullSecretAuths(s)
+		if err != nil {
+			return nil, err
+		}
+		for i := range config.Spec.AdditionalPullSecretRefs {
+			additional, err := r.getSecret(ctx, &config.Spec.AdditionalPullSecretRefs[i])
+			if err != nil {
+				return nil, err
+			}
+			additionalAuths, err := pullSecretAuths(additional)
+			if err != nil {
+				return nil, err
+			}
+			for registry, auth := range additionalAuths {
+				auths[registry] = auth
+			}
+		}
+
+		// the merged content is only kept in the rendered copy, the referenced secret isn't modified
+		merged, err := mergeAuths(s, auths)
+		if err != nil {
+			return nil, err
+		}
+		s = s.DeepCopy()
+		s.Data[corev1.DockerConfigJsonKey] = merged
+		return s, nil
+	},
+}
+
+// getSecret returns the secret referenced by ref
+func (r *ClusterConfigReconciler) getSecret(ctx context.Context, ref *corev1.SecretReference) (*corev1.Secret, error) {
+	s := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: ref.Namespace}, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// pullSecretAuths returns the credentials in s by registry
+func pullSecretAuths(s *corev1.Secret) (map[string]json.RawMessage, error) {
+	data, ok := s.Data[corev1.DockerConfigJsonKey]
+	if !ok {
+		return nil, fmt.Errorf("secret %s/%s has no %s key", s.Namespace, s.Name, corev1.DockerConfigJsonKey)
+	}
+	config := struct {
+		Auths map[string]json.RawMessage `json:"auths"`
+	}{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, redact.SecretError(fmt.Errorf("failed to parse %s in secret %s/%s: %w", corev1.DockerConfigJsonKey, s.Namespace, s.Name, err), s)
+	}
+	if config.Auths == nil {
+		config.Auths = map[string]json.RawMessage{}
+	}
+	return config.Auths, nil
+}
+
+// mergeAuths returns the docker config of s with its auths replaced, keeping any other fields
+func mergeAuths(s *corev1.Secret, auths map[string]json.RawMessage) ([]byte, error) {
+	config := map[string]json.RawMessage{}
+	if err := json.Unmarshal(s.Data[corev1.DockerConfigJsonKey], &config); err != nil {
+		return nil, redact.SecretError(err, s)
+	}
+	encoded, err := json.Marshal(auths)
+	if err != nil {
+		return nil, err
+	}
+	config["auths"] = encoded
+	return json.Marshal(config)
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/carbonin/cluster-relocation-service/api/isoschema"
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+)
+
+const (
+	// maxSecureBootCerts is the most certificates shipped for enrollment, firmware MOK lists only hold a few
+	maxSecureBootCerts = 16
+	// maxSecureBootCertsSize is the largest total DER size of the certificates shipped for enrollment
+	maxSecureBootCertsSize = 64 * 1024
+)
+
+// secureBootCertsRenderer copies the referenced secure boot certificates into the payload once they're validated
+var secureBootCertsRenderer = objectRenderer("secure boot certificates", isoschema.SecureBootCertsFileType, func(config *relocationv1alpha1.ClusterConfig) *corev1.ObjectReference {
+	if config.Spec.SecureBootCertsRef == nil {
+		return nil
+	}
+	return &corev1.ObjectReference{Kind: "ConfigMap", Namespace: config.Namespace, Name: config.Spec.SecureBootCertsRef.Name}
+}, func(obj client.Object) error {
+	cm := obj.(*corev1.ConfigMap)
+	if len(cm.Data)+len(cm.BinaryData) == 0 {
+		return fmt.Errorf("secure boot certificates config map %s is empty", client.ObjectKeyFromObject(obj))
+	}
+	if n := len(cm.Data) + len(cm.BinaryData); n > maxSecureBootCerts {
+		return fmt.Errorf("secure boot certificates config map %s has %d certificates, at most %d can be enrolled", client.ObjectKeyFromObject(obj), n, maxSecureBootCerts)
+	}
+
+	certs := map[string][]byte{}
+	for key, value := range cm.Data {
+		certs[key] = []byte(value)
+	}
+	for key, value := range cm.BinaryData {
+		certs[key] = value
+	}
+	keys := make([]string, 0, len(certs))
+	for key := range certs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	size := 0
+	for _, key := range keys {
+		der, err := secureBootCertDER(certs[key])
+		if err != nil {
+			return fmt.Errorf("secure boot certificate %s in config map %s is invalid: %w", key, client.ObjectKeyFromObject(obj), err)
+		}
+		size += len(der)
+	}
+	if size > maxSecureBootCertsSize {
+		return fmt.Errorf("secure boot certificates in config map %s are %d bytes, at most %d bytes can be enrolled", client.ObjectKeyFromObject(obj), size, maxSecureBootCertsSize)
+	}
+	return nil
+})
+
+// secureBootCertDER returns the DER encoding of the single X.509 certificate in data, which may be PEM or DER encoded
+func secureBootCertDER(data []byte) ([]byte, error) {
+	der := data
+	if block, rest := pem.Decode(data); block != nil {
+		if block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("expected a CERTIFICATE PEM block, found %s", block.Type)
+		}
+		if len(bytes.TrimSpace(rest)) != 0 {
+			return nil, fmt.Errorf("only one certificate can be stored under each key")
+		}
+		der = block.Bytes
+	}
+	if _, err := x509.ParseCertificate(der); err != nil {
+		return nil, fmt.Errorf("not a PEM or DER encoded X.509 certificate: %w", err)
+	}
+	return der, nil
+}
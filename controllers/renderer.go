@@ -0,0 +1,158 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	goerrors "errors"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	cro "github.com/RHsyseng/cluster-relocation-operator/api/v1beta1"
+	"github.com/carbonin/cluster-relocation-service/api/isoschema"
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+	"github.com/carbonin/cluster-relocation-service/internal/redact"
+	"github.com/carbonin/cluster-relocation-service/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// payloadRenderer produces a single file in the payload
+type payloadRenderer struct {
+	// Name describes the rendered content in errors and traces
+	Name string
+	// FileType is the payload file written by the renderer
+	FileType isoschema.FileType
+	// Inputs returns the objects other than the ClusterConfig the file is rendered from, it may be nil
+	Inputs func(config *relocationv1alpha1.ClusterConfig) []corev1.ObjectReference
+	// Render returns the object to write for config, a nil object removes the file from the payload
+	Render func(ctx context.Context, r *ClusterConfigReconciler, config *relocationv1alpha1.ClusterConfig) (runtime.Object, error)
+}
+
+// payloadRenderers are run in order when writing the payload
+// New renderers must be appended so the payload hash of existing configs doesn't change
+var payloadRenderers = []payloadRenderer{
+	clusterRelocationRenderer,
+	imageTagMirrorSetRenderer,
+	secretRenderer("api cert secret", isoschema.APICertSecretFileType, func(config *relocationv1alpha1.ClusterConfig) *corev1.SecretReference {
+		return config.Spec.APICertRef
+	}),
+	secretRenderer("ingress cert secret", isoschema.IngressCertSecretFileType, func(config *relocationv1alpha1.ClusterConfig) *corev1.SecretReference {
+		return config.Spec.IngressCertRef
+	}),
+	pullSecretRenderer,
+	agentConfigRenderer,
+	clusterNetworkRenderer,
+	localizationRenderer,
+	imageContentSourcePolicyRenderer,
+	ignitionConfigOverrideRenderer,
+	configMapRenderer("additional trust bundle", isoschema.AdditionalTrustBundleFileType, func(config *relocationv1alpha1.ClusterConfig) *corev1.LocalObjectReference {
+		return config.Spec.AdditionalTrustBundleRef
+	}, isoschema.AdditionalTrustBundleKey),
+	diskEncryptionRenderer,
+	networkConfigRenderer,
+	extraManifestsRenderer,
+	secureBootCertsRenderer,
+}
+
+// failureReasons are the ClusterRelocation condition reasons for failures rendering each file type
+// Types without one use ReconciliationFailedReason
+var failureReasons = map[isoschema.FileType]string{
+	isoschema.APICertSecretFileType:            cro.APIReconciliationFailedReason,
+	isoschema.IngressCertSecretFileType:        cro.IngressReconciliationFailedReason,
+	isoschema.PullSecretFileType:               cro.PullSecretReconciliationFailedReason,
+	isoschema.ImageTagMirrorSetFileType:        cro.MirrorReconciliationFailedReason,
+	isoschema.ImageContentSourcePolicyFileType: cro.MirrorReconciliationFailedReason,
+}
+
+// renderError is returned when a renderer fails
+type renderError struct {
+	fileType isoschema.FileType
+	err      error
+}
+
+func (e *renderError) Error() string { return e.err.Error() }
+func (e *renderError) Unwrap() error { return e.err }
+
+// reconciledReason returns the Reconciled condition reason for an error writing the payload
+func reconciledReason(err error) string {
+	var sizeErr *payloadSizeError
+	if goerrors.As(err, &sizeErr) {
+		return cro.ValidationFailedReason
+	}
+	var insecureErr *insecureImageError
+	if goerrors.As(err, &insecureErr) {
+		return relocationv1alpha1.InsecureImageURLReason
+	}
+	var renderErr *renderError
+	if goerrors.As(err, &renderErr) {
+		if reason, ok := failureReasons[renderErr.fileType]; ok {
+			return reason
+		}
+	}
+	return relocationv1alpha1.ReconciliationFailedReason
+}
+
+// renderPayload runs each of renderers for config and writes the results with w
+func (r *ClusterConfigReconciler) renderPayload(ctx context.Context, renderers []payloadRenderer, config *relocationv1alpha1.ClusterConfig, w *isoschema.Writer) error {
+	for _, pr := range renderers {
+		if err := r.render(ctx, pr, config, w); err != nil {
+			return &renderError{fileType: pr.FileType, err: fmt.Errorf("failed to write %s: %w", pr.Name, err)}
+		}
+	}
+	return nil
+}
+
+func (r *ClusterConfigReconciler) render(ctx context.Context, pr payloadRenderer, config *relocationv1alpha1.ClusterConfig, w *isoschema.Writer) (err error) {
+	attrs := append(tracing.ClusterConfigAttributes(config.Namespace, config.Name), attribute.String("renderer", pr.Name))
+	if pr.Inputs != nil {
+		for _, in := range pr.Inputs(config) {
+			attrs = append(attrs, attribute.String("input."+in.Kind, in.Namespace+"/"+in.Name))
+		}
+	}
+	ctx, span := tracing.Start(ctx, "render", attrs...)
+	defer func() { tracing.End(span, err) }()
+
+	obj, err := pr.Render(ctx, r, config)
+	if err != nil {
+		return err
+	}
+	// errors are logged and recorded in traces so they must not contain the secret content
+	if s, ok := obj.(*corev1.Secret); ok {
+		defer func() { err = redact.SecretError(err, s) }()
+	}
+	if obj == nil {
+		return w.Remove(pr.FileType)
+	}
+	return w.WriteObject(pr.FileType, obj)
+}
+
+// setTypeMeta sets the api version and kind of obj based on the scheme
+func (r *ClusterConfigReconciler) setTypeMeta(obj runtime.Object) error {
+	gvks, unversioned, err := r.Scheme.ObjectKinds(obj)
+	if err != nil {
+		return err
+	}
+	if unversioned || len(gvks) == 0 {
+		return fmt.Errorf("unable to find API version for %T", obj)
+	}
+	// if there are multiple assume the last is the most recent
+	obj.GetObjectKind().SetGroupVersionKind(gvks[len(gvks)-1])
+
+	return nil
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+)
+
+//+kubebuilder:rbac:groups=relocation.openshift.io,resources=relocationserviceconfigs,verbs=get;list;watch
+//+kubebuilder:rbac:groups=relocation.openshift.io,resources=relocationserviceconfigs/status,verbs=get;update;patch
+
+// LoadServiceConfig overlays the spec of the RelocationServiceConfig on opts and returns its generation, zero if
+// there is none. opts are left unchanged if the spec is invalid so a bad edit can't stop the manager from starting
+// It must be called before opts are used as most options can't change once the manager runs
+func LoadServiceConfig(ctx context.Context, c client.Reader, opts *ClusterConfigReconcilerOptions) (int64, error) {
+	config := &relocationv1alpha1.RelocationServiceConfig{}
+	if err := c.Get(ctx, types.NamespacedName{Name: relocationv1alpha1.RelocationServiceConfigName}, config); err != nil {
+		if errors.IsNotFound(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to get RelocationServiceConfig: %w", err)
+	}
+	if errs := relocationv1alpha1.ValidateServiceConfig(config, opts.ServiceScheme); len(errs) > 0 {
+		return 0, fmt.Errorf("invalid RelocationServiceConfig: %w", errs.ToAggregate())
+	}
+	applyServiceConfig(&config.Spec, opts)
+	return config.Generation, nil
+}
+
+// applyServiceConfig sets the options in spec on opts
+func applyServiceConfig(spec *relocationv1alpha1.RelocationServiceConfigSpec, opts *ClusterConfigReconcilerOptions) {
+	if spec.ServiceScheme != "" {
+		opts.ServiceScheme = spec.ServiceScheme
+	}
+	if spec.ImageBasicAuth != nil {
+		opts.ImageBasicAuth = *spec.ImageBasicAuth
+	}
+	if e := spec.Endpoint; e != nil {
+		opts.ManageEndpoint = e.Manage
+		opts.EndpointRoute = e.Route
+		opts.EndpointRouteHost = e.RouteHost
+		opts.EndpointAllowedCIDRs = e.AllowedCIDRs
+	}
+	if spec.ZoneServiceURLs != nil {
+		opts.ZoneServiceURLs = spec.ZoneServiceURLs
+	}
+	if spec.ZoneCacheURLs != nil {
+		opts.ZoneCacheURLs = spec.ZoneCacheURLs
+	}
+	if c := spec.ConsoleLog; c != nil {
+		opts.ConsoleLogSourceURL = c.SourceURL
+		if c.Interval != nil {
+			opts.ConsoleLogInterval = c.Interval.Duration
+		}
+		if c.MaxSize != nil {
+			opts.ConsoleLogMaxSize = *c.MaxSize
+		}
+	}
+	if spec.ResyncPeriod != nil {
+		opts.ResyncPeriod = spec.ResyncPeriod.Duration
+	}
+	if spec.NotifyWindow != nil {
+		opts.NotifyWindow = spec.NotifyWindow.Duration
+	}
+	if spec.MaxClusterConfigsPerNamespace != nil {
+		opts.MaxClusterConfigsPerNamespace = int(*spec.MaxClusterConfigsPerNamespace)
+	}
+}
+
+// ServiceConfigReconciler reports on the RelocationServiceConfig whether its spec is valid and in use
+type ServiceConfigReconciler struct {
+	client.Client
+	Log logrus.FieldLogger
+	// ServiceScheme is the scheme from the manager environment, used when the spec doesn't set one
+	ServiceScheme string
+	// AppliedGeneration is the generation returned by LoadServiceConfig when the manager started
+	AppliedGeneration int64
+}
+
+func (r *ServiceConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	if req.Name != relocationv1alpha1.RelocationServiceConfigName {
+		return ctrl.Result{}, nil
+	}
+	config := &relocationv1alpha1.RelocationServiceConfig{}
+	if err := r.Get(ctx, req.NamespacedName, config); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	original := config.DeepCopy()
+	valid := metav1.Condition{
+		Type:               relocationv1alpha1.ServiceConfigValidCondition,
+		Status:             metav1.ConditionTrue,
+		Reason:             relocationv1alpha1.ServiceConfigValidReason,
+		ObservedGeneration: config.Generation,
+	}
+	applied := metav1.Condition{
+		Type:               relocationv1alpha1.ServiceConfigAppliedCondition,
+		Status:             metav1.ConditionTrue,
+		Reason:             relocationv1alpha1.ServiceConfigAppliedReason,
+		Message:            "the manager is running with the current spec",
+		ObservedGeneration: config.Generation,
+	}
+	// webhooks may be disabled so the spec is checked again
+	if errs := relocationv1alpha1.ValidateServiceConfig(config, r.ServiceScheme); len(errs) > 0 {
+		valid.Status = metav1.ConditionFalse
+		valid.Reason = relocationv1alpha1.ServiceConfigInvalidReason
+		valid.Message = errs.ToAggregate().Error()
+		applied.Status = metav1.ConditionFalse
+		applied.Reason = relocationv1alpha1.ServiceConfigInvalidReason
+		applied.Message = "the manager is running with its environment configuration"
+	} else if config.Generation != r.AppliedGeneration {
+		applied.Status = metav1.ConditionFalse
+		applied.Reason = relocationv1alpha1.ServiceConfigRestartRequiredReason
+		applied.Message = "the spec changed after the manager started, restart it to apply the change"
+	}
+	meta.SetStatusCondition(&config.Status.Conditions, valid)
+	meta.SetStatusCondition(&config.Status.Conditions, applied)
+	config.Status.ObservedGeneration = config.Generation
+
+	if equality.Semantic.DeepEqual(original.Status, config.Status) {
+		return ctrl.Result{}, nil
+	}
+	if err := r.Status().Patch(ctx, config, client.MergeFrom(original)); err != nil {
+		return ctrl.Result{}, err
+	}
+	if valid.Status == metav1.ConditionFalse {
+		r.Log.WithField("reason", valid.Message).Warn("RelocationServiceConfig is invalid")
+	}
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ServiceConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&relocationv1alpha1.RelocationServiceConfig{}).
+		Complete(r)
+}
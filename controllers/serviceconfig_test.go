@@ -0,0 +1,159 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/pointer"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("RelocationServiceConfig", func() {
+	var (
+		c   client.Client
+		ctx = context.Background()
+		key = types.NamespacedName{Name: relocationv1alpha1.RelocationServiceConfigName}
+	)
+
+	BeforeEach(func() {
+		c = fakeclient.NewClientBuilder().
+			WithScheme(scheme.Scheme).
+			WithStatusSubresource(&relocationv1alpha1.RelocationServiceConfig{}).
+			Build()
+	})
+
+	createConfig := func(spec relocationv1alpha1.RelocationServiceConfigSpec) *relocationv1alpha1.RelocationServiceConfig {
+		config := &relocationv1alpha1.RelocationServiceConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: key.Name},
+			Spec:       spec,
+		}
+		Expect(c.Create(ctx, config)).To(Succeed())
+		return config
+	}
+
+	envOptions := func() *ClusterConfigReconcilerOptions {
+		return &ClusterConfigReconcilerOptions{
+			ServiceScheme:                 "https",
+			ConsoleLogInterval:            time.Minute,
+			ConsoleLogMaxSize:             65536,
+			ResyncPeriod:                  time.Hour,
+			NotifyWindow:                  10 * time.Minute,
+			MaxClusterConfigsPerNamespace: 50,
+		}
+	}
+
+	Describe("LoadServiceConfig", func() {
+		It("keeps the environment configuration without a RelocationServiceConfig", func() {
+			opts := envOptions()
+			generation, err := LoadServiceConfig(ctx, c, opts)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generation).To(BeZero())
+			Expect(opts).To(Equal(envOptions()))
+		})
+
+		It("overlays the options set in the spec", func() {
+			config := createConfig(relocationv1alpha1.RelocationServiceConfigSpec{
+				ImageBasicAuth:                pointer.Bool(true),
+				Endpoint:                      &relocationv1alpha1.EndpointConfig{Manage: true, Route: true, RouteHost: "images.example.com"},
+				ZoneServiceURLs:               map[string]string{"east": "http://images.east.example.com"},
+				ConsoleLog:                    &relocationv1alpha1.ConsoleLogConfig{SourceURL: "http://console/{name}", MaxSize: pointer.Int64(1024)},
+				ResyncPeriod:                  &metav1.Duration{},
+				MaxClusterConfigsPerNamespace: pointer.Int32(0),
+			})
+
+			opts := envOptions()
+			generation, err := LoadServiceConfig(ctx, c, opts)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generation).To(Equal(config.Generation))
+
+			expected := envOptions()
+			expected.ImageBasicAuth = true
+			expected.ManageEndpoint = true
+			expected.EndpointRoute = true
+			expected.EndpointRouteHost = "images.example.com"
+			expected.ZoneServiceURLs = ZoneURLs{"east": "http://images.east.example.com"}
+			expected.ConsoleLogSourceURL = "http://console/{name}"
+			expected.ConsoleLogMaxSize = 1024
+			expected.ResyncPeriod = 0
+			expected.MaxClusterConfigsPerNamespace = 0
+			Expect(opts).To(Equal(expected))
+		})
+
+		It("ignores an invalid spec", func() {
+			createConfig(relocationv1alpha1.RelocationServiceConfigSpec{
+				ServiceScheme: "http",
+				Endpoint:      &relocationv1alpha1.EndpointConfig{Manage: true, Route: true},
+				ResyncPeriod:  &metav1.Duration{Duration: time.Minute},
+			})
+
+			opts := envOptions()
+			generation, err := LoadServiceConfig(ctx, c, opts)
+			Expect(err).To(MatchError(ContainSubstring("spec.endpoint.route")))
+			Expect(generation).To(BeZero())
+			Expect(opts).To(Equal(envOptions()))
+		})
+	})
+
+	Describe("ServiceConfigReconciler", func() {
+		var r *ServiceConfigReconciler
+
+		BeforeEach(func() {
+			r = &ServiceConfigReconciler{Client: c, Log: logrus.New(), ServiceScheme: "http"}
+		})
+
+		conditions := func() (*metav1.Condition, *metav1.Condition) {
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			config := &relocationv1alpha1.RelocationServiceConfig{}
+			Expect(c.Get(ctx, key, config)).To(Succeed())
+			Expect(config.Status.ObservedGeneration).To(Equal(config.Generation))
+			return meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.ServiceConfigValidCondition),
+				meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.ServiceConfigAppliedCondition)
+		}
+
+		It("reports the spec the manager started with as applied", func() {
+			config := createConfig(relocationv1alpha1.RelocationServiceConfigSpec{ResyncPeriod: &metav1.Duration{Duration: time.Minute}})
+			r.AppliedGeneration = config.Generation
+
+			valid, applied := conditions()
+			Expect(valid.Status).To(Equal(metav1.ConditionTrue))
+			Expect(applied.Status).To(Equal(metav1.ConditionTrue))
+			Expect(applied.Reason).To(Equal(relocationv1alpha1.ServiceConfigAppliedReason))
+		})
+
+		It("reports a restart is required for a later spec", func() {
+			config := createConfig(relocationv1alpha1.RelocationServiceConfigSpec{})
+			r.AppliedGeneration = config.Generation - 1
+
+			valid, applied := conditions()
+			Expect(valid.Status).To(Equal(metav1.ConditionTrue))
+			Expect(applied.Status).To(Equal(metav1.ConditionFalse))
+			Expect(applied.Reason).To(Equal(relocationv1alpha1.ServiceConfigRestartRequiredReason))
+		})
+
+		It("reports conflicting options instead of applying them", func() {
+			createConfig(relocationv1alpha1.RelocationServiceConfigSpec{
+				ImageBasicAuth: pointer.Bool(true),
+				Endpoint:       &relocationv1alpha1.EndpointConfig{Route: true},
+			})
+
+			valid, applied := conditions()
+			Expect(valid.Status).To(Equal(metav1.ConditionFalse))
+			Expect(valid.Reason).To(Equal(relocationv1alpha1.ServiceConfigInvalidReason))
+			Expect(valid.Message).To(ContainSubstring("spec.imageBasicAuth"))
+			Expect(valid.Message).To(ContainSubstring("spec.endpoint.route"))
+			Expect(applied.Status).To(Equal(metav1.ConditionFalse))
+			Expect(applied.Reason).To(Equal(relocationv1alpha1.ServiceConfigInvalidReason))
+		})
+	})
+})
@@ -27,6 +27,9 @@ import (
 	cro "github.com/RHsyseng/cluster-relocation-operator/api/v1beta1"
 	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
 	bmh_v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	configv1 "github.com/openshift/api/config/v1"
+	operatorv1alpha1 "github.com/openshift/api/operator/v1alpha1"
+	routev1 "github.com/openshift/api/route/v1"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -39,4 +42,7 @@ var _ = BeforeSuite(func() {
 	Expect(cro.AddToScheme(scheme.Scheme)).To(Succeed())
 	Expect(relocationv1alpha1.AddToScheme(scheme.Scheme)).To(Succeed())
 	Expect(bmh_v1alpha1.AddToScheme(scheme.Scheme)).To(Succeed())
+	Expect(configv1.AddToScheme(scheme.Scheme)).To(Succeed())
+	Expect(operatorv1alpha1.AddToScheme(scheme.Scheme)).To(Succeed())
+	Expect(routev1.AddToScheme(scheme.Scheme)).To(Succeed())
 })
@@ -0,0 +1,123 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"text/template"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+)
+
+// templateData is what the values of templated config maps can refer to, such as {{ .Spec.Domain }}
+type templateData struct {
+	Name      string
+	Namespace string
+	Spec      *relocationv1alpha1.ClusterConfigSpec
+	BMH       templateHost
+}
+
+// templateHost exposes the recorded inspection data of the ClusterConfig's BareMetalHost to templates
+type templateHost struct {
+	hw *relocationv1alpha1.HostHardware
+}
+
+func (h templateHost) hardware() (*relocationv1alpha1.HostHardware, error) {
+	if h.hw == nil {
+		return nil, fmt.Errorf("the BareMetalHost has not been inspected yet")
+	}
+	return h.hw, nil
+}
+
+// MAC returns the MAC address of the NIC named name, as in {{ .BMH.MAC "eno1" }}
+func (h templateHost) MAC(name string) (string, error) {
+	hw, err := h.hardware()
+	if err != nil {
+		return "", err
+	}
+	for _, nic := range hw.NICs {
+		if nic.Name == name {
+			return nic.MAC, nil
+		}
+	}
+	return "", fmt.Errorf("the BareMetalHost has no network interface named %s", name)
+}
+
+// SerialNumber returns the system serial number of the host
+func (h templateHost) SerialNumber() (string, error) {
+	hw, err := h.hardware()
+	if err != nil {
+		return "", err
+	}
+	return hw.SerialNumber, nil
+}
+
+// executeTemplates renders each value of cm as a template if it has the TemplateAnnotation
+// cm is modified in place
+func executeTemplates(cm *corev1.ConfigMap, config *relocationv1alpha1.ClusterConfig) error {
+	if cm.Annotations[relocationv1alpha1.TemplateAnnotation] != "true" {
+		return nil
+	}
+	data := templateData{
+		Name:      config.Name,
+		Namespace: config.Namespace,
+		Spec:      &config.Spec,
+		BMH:       templateHost{hw: config.Status.HostHardware},
+	}
+
+	keys := make([]string, 0, len(cm.Data))
+	for key := range cm.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		// parse and execution errors include the key
+		tmpl, err := template.New(key).Option("missingkey=error").Parse(cm.Data[key])
+		if err != nil {
+			return err
+		}
+		var out bytes.Buffer
+		if err := tmpl.Execute(&out, data); err != nil {
+			return err
+		}
+		cm.Data[key] = out.String()
+	}
+	return nil
+}
+
+// withTemplates wraps pr, which renders a ConfigMap, to execute its values as templates when it is marked as templated
+func withTemplates(pr payloadRenderer) payloadRenderer {
+	render := pr.Render
+	pr.Render = func(ctx context.Context, r *ClusterConfigReconciler, config *relocationv1alpha1.ClusterConfig) (runtime.Object, error) {
+		obj, err := render(ctx, r, config)
+		if err != nil || obj == nil {
+			return obj, err
+		}
+		cm := obj.(*corev1.ConfigMap)
+		if err := executeTemplates(cm, config); err != nil {
+			return nil, fmt.Errorf("config map %s/%s: %w", cm.Namespace, cm.Name, err)
+		}
+		return cm, nil
+	}
+	return pr
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+	"github.com/carbonin/cluster-relocation-service/internal/report"
+)
+
+// rebuildWait returns how long to wait before the configuration may be rendered again, zero if it may be rendered now
+// The payload diff records when the rendered payload last changed so only rebuilds are throttled
+func rebuildWait(config *relocationv1alpha1.ClusterConfig, now time.Time) time.Duration {
+	interval := config.Spec.MinRebuildInterval
+	if interval == nil || config.Spec.ExternalImageURL != "" || config.Status.PayloadDiff == nil {
+		return 0
+	}
+	if _, force := config.Annotations[relocationv1alpha1.ForceRebuildAnnotation]; force {
+		return 0
+	}
+	next := config.Status.PayloadDiff.Time.Add(interval.Duration)
+	if !now.Before(next) {
+		return 0
+	}
+	return next.Sub(now)
+}
+
+// keepPayload leaves the rendered payload in place while rendering is deferred
+// It has the same signature as writeInputData and returns the hash of the most recently rendered payload
+func (r *ClusterConfigReconciler) keepPayload(_ context.Context, config *relocationv1alpha1.ClusterConfig) (string, *relocationv1alpha1.PayloadDiff, bool, error) {
+	return config.Status.PayloadDiff.PayloadHash, nil, false, nil
+}
+
+// setRebuildThrottled records whether rendering is deferred for wait in the RebuildThrottled condition
+// The condition is only set when a MinRebuildInterval is configured
+func (r *ClusterConfigReconciler) setRebuildThrottled(ctx context.Context, config *relocationv1alpha1.ClusterConfig, wait time.Duration) error {
+	if config.Spec.MinRebuildInterval == nil {
+		if meta.FindStatusCondition(config.Status.Conditions, relocationv1alpha1.RebuildThrottledCondition) == nil {
+			return nil
+		}
+		patch := client.MergeFrom(config.DeepCopy())
+		meta.RemoveStatusCondition(&config.Status.Conditions, relocationv1alpha1.RebuildThrottledCondition)
+		return r.Status().Patch(ctx, config, patch)
+	}
+
+	cond := metav1.Condition{
+		Type:               relocationv1alpha1.RebuildThrottledCondition,
+		Status:             metav1.ConditionFalse,
+		Reason:             relocationv1alpha1.RebuildAllowedReason,
+		Message:            "changes are rendered immediately",
+		ObservedGeneration: config.Generation,
+	}
+	if wait > 0 {
+		next := config.Status.PayloadDiff.Time.Add(config.Spec.MinRebuildInterval.Duration)
+		cond.Status = metav1.ConditionTrue
+		cond.Reason = relocationv1alpha1.MinRebuildIntervalReason
+		cond.Message = fmt.Sprintf("the payload was rebuilt at %s, further changes are rendered after %s",
+			config.Status.PayloadDiff.Time.UTC().Format(time.RFC3339), next.UTC().Format(time.RFC3339))
+	}
+	patch := client.MergeFrom(config.DeepCopy())
+	if !report.SetCondition(&config.Status.Conditions, cond) {
+		return nil
+	}
+	return r.Status().Patch(ctx, config, patch)
+}
+
+// clearForceRebuild removes the force rebuild annotation once the configuration has been rendered
+func (r *ClusterConfigReconciler) clearForceRebuild(ctx context.Context, config *relocationv1alpha1.ClusterConfig) error {
+	if _, force := config.Annotations[relocationv1alpha1.ForceRebuildAnnotation]; !force {
+		return nil
+	}
+	patch := client.MergeFrom(config.DeepCopy())
+	delete(config.Annotations, relocationv1alpha1.ForceRebuildAnnotation)
+	return r.Patch(ctx, config, patch)
+}
+
+// shortestRequeue returns the shorter of two requeue delays where zero means no requeue
+func shortestRequeue(a, b time.Duration) time.Duration {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
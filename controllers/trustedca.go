@@ -0,0 +1,266 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	configv1 "github.com/openshift/api/config/v1"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// the ConfigMap the Proxy trustedCA refers to is named user-ca-bundle on OpenShift, IMAGE_CA_CONFIGMAP needs the Role in
+// config/rbac/image_ca_configmap_role.yaml
+//+kubebuilder:rbac:groups="",resources=configmaps,resourceNames=user-ca-bundle,verbs=get;update
+//+kubebuilder:rbac:groups=config.openshift.io,resources=proxies,verbs=get
+
+const (
+	// userCABundleNamespace holds the ConfigMap the cluster Proxy trustedCA refers to
+	userCABundleNamespace = "openshift-config"
+	// caBundleKey is the ConfigMap key holding the PEM bundle, for both the Proxy trustedCA and Metal3
+	caBundleKey = "ca-bundle.crt"
+	// imageCAAnnotation lists the SHA-256 fingerprints of the certificates published to a bundle so they can be
+	// removed once they are no longer in ImageCAFile
+	imageCAAnnotation = "relocation.openshift.io/image-ca-fingerprints"
+)
+
+// TrustedCAPublisher adds the CA certificates of the image server from ImageCAFile to the bundle Ironic trusts so
+// image downloads pass TLS verification. Certificates previously published which are no longer in ImageCAFile are
+// removed when it is rotated, others in the bundle are kept
+// The bundle is published again every Interval in case it was replaced, zero publishes it once
+type TrustedCAPublisher struct {
+	Client   client.Client
+	Log      logrus.FieldLogger
+	Options  *ClusterConfigReconcilerOptions
+	Interval time.Duration
+}
+
+// Start publishes the bundle every Interval until the context is cancelled
+func (p *TrustedCAPublisher) Start(ctx context.Context) error {
+	publish := func(ctx context.Context) {
+		if err := p.Publish(ctx); err != nil {
+			p.Log.WithError(err).Error("failed to publish image server CA")
+		}
+	}
+	if p.Interval == 0 {
+		publish(ctx)
+		return nil
+	}
+	wait.UntilWithContext(ctx, publish, p.Interval)
+	return nil
+}
+
+// Publish makes the certificates in the trusted bundle ConfigMap match ImageCAFile
+// ImageCAConfigMap names the ConfigMap, which is created if needed. Otherwise the existing ConfigMap the cluster
+// Proxy trustedCA refers to is updated, which the cluster-baremetal-operator adds to the trust store of Ironic.
+// The Proxy itself is never changed
+func (p *TrustedCAPublisher) Publish(ctx context.Context) error {
+	content, err := os.ReadFile(p.Options.ImageCAFile)
+	if err != nil {
+		return fmt.Errorf("failed to read image server CA: %w", err)
+	}
+	certs, err := parseCABundle(content)
+	if err != nil {
+		return fmt.Errorf("failed to parse image server CA %s: %w", p.Options.ImageCAFile, err)
+	}
+	if len(certs) == 0 {
+		return fmt.Errorf("no certificates found in image server CA %s", p.Options.ImageCAFile)
+	}
+
+	key, create, err := p.bundleKey(ctx)
+	if err != nil {
+		return err
+	}
+
+	cm := &corev1.ConfigMap{}
+	if err := p.Client.Get(ctx, key, cm); err != nil {
+		if !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to get trusted CA bundle %s: %w", key, err)
+		}
+		if !create {
+			return fmt.Errorf("the ConfigMap %s the cluster Proxy trustedCA refers to doesn't exist", key)
+		}
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        key.Name,
+				Namespace:   key.Namespace,
+				Annotations: map[string]string{imageCAAnnotation: strings.Join(fingerprints(certs), ",")},
+			},
+			Data: map[string]string{caBundleKey: string(encodeCerts(certs))},
+		}
+		if err := p.Client.Create(ctx, cm); err != nil {
+			return fmt.Errorf("failed to create trusted CA bundle %s: %w", key, err)
+		}
+		p.Log.WithField("configmap", key).Info("published image server CA")
+		return nil
+	}
+
+	// certificates published before which aren't in the CA file anymore were rotated out
+	current := fingerprints(certs)
+	stale := map[string]bool{}
+	for _, f := range strings.Split(cm.Annotations[imageCAAnnotation], ",") {
+		stale[f] = f != ""
+	}
+	for _, f := range current {
+		delete(stale, f)
+	}
+	bundle, removed := removeCerts(cm.Data[caBundleKey], stale)
+	existing, err := parseCABundle([]byte(bundle))
+	if err != nil {
+		return fmt.Errorf("failed to parse trusted CA bundle %s: %w", key, err)
+	}
+	missing := missingCerts(certs, existing)
+	published := strings.Join(current, ",")
+	if len(missing) == 0 && removed == 0 && cm.Annotations[imageCAAnnotation] == published {
+		return nil
+	}
+	if len(missing) > 0 && bundle != "" && !strings.HasSuffix(bundle, "\n") {
+		bundle += "\n"
+	}
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[caBundleKey] = bundle + string(encodeCerts(missing))
+	if cm.Annotations == nil {
+		cm.Annotations = map[string]string{}
+	}
+	cm.Annotations[imageCAAnnotation] = published
+	if err := p.Client.Update(ctx, cm); err != nil {
+		return fmt.Errorf("failed to update trusted CA bundle %s: %w", key, err)
+	}
+	p.Log.WithFields(logrus.Fields{"configmap": key, "added": len(missing), "removed": removed}).Info("published image server CA")
+	return nil
+}
+
+// bundleKey returns the ConfigMap the CA is published to and whether it may be created
+// Only ImageCAConfigMap may be created, the ConfigMap the cluster Proxy trustedCA refers to must already exist
+func (p *TrustedCAPublisher) bundleKey(ctx context.Context) (types.NamespacedName, bool, error) {
+	if p.Options.ImageCAConfigMap != "" {
+		namespace, name, ok := strings.Cut(p.Options.ImageCAConfigMap, "/")
+		if !ok || namespace == "" || name == "" {
+			return types.NamespacedName{}, false, fmt.Errorf("invalid IMAGE_CA_CONFIGMAP %q, expected <namespace>/<name>", p.Options.ImageCAConfigMap)
+		}
+		return types.NamespacedName{Namespace: namespace, Name: name}, true, nil
+	}
+
+	proxy := &configv1.Proxy{}
+	if err := p.Client.Get(ctx, types.NamespacedName{Name: "cluster"}, proxy); err != nil {
+		if errors.IsNotFound(err) || meta.IsNoMatchError(err) {
+			return types.NamespacedName{}, false, fmt.Errorf("the cluster has no Proxy configuration, set IMAGE_CA_CONFIGMAP to the ConfigMap Ironic trusts")
+		}
+		return types.NamespacedName{}, false, fmt.Errorf("failed to get cluster proxy: %w", err)
+	}
+	if proxy.Spec.TrustedCA.Name == "" {
+		return types.NamespacedName{}, false, fmt.Errorf("the cluster Proxy has no trustedCA, set IMAGE_CA_CONFIGMAP to the ConfigMap Ironic trusts or set the Proxy trustedCA")
+	}
+	return types.NamespacedName{Namespace: userCABundleNamespace, Name: proxy.Spec.TrustedCA.Name}, false, nil
+}
+
+// fingerprints returns the SHA-256 fingerprints of certs
+func fingerprints(certs []*x509.Certificate) []string {
+	var out []string
+	for _, cert := range certs {
+		out = append(out, fmt.Sprintf("%x", sha256.Sum256(cert.Raw)))
+	}
+	return out
+}
+
+// removeCerts returns bundle without the certificates whose SHA-256 fingerprint is set in stale and how many were
+// removed. The rest of the bundle is kept as is
+func removeCerts(bundle string, stale map[string]bool) (string, int) {
+	if len(stale) == 0 {
+		return bundle, 0
+	}
+	var out strings.Builder
+	removed := 0
+	data := []byte(bundle)
+	for {
+		block, rest := pem.Decode(data)
+		if block == nil {
+			out.Write(data)
+			return out.String(), removed
+		}
+		// the text of the block runs from its header up to the rest of the bundle
+		text := data[:len(data)-len(rest)]
+		if block.Type == "CERTIFICATE" && stale[fmt.Sprintf("%x", sha256.Sum256(block.Bytes))] {
+			text = text[:strings.LastIndex(string(text), "-----BEGIN")]
+			removed++
+		}
+		out.Write(text)
+		data = rest
+	}
+}
+
+// parseCABundle returns the certificates in a PEM bundle, ignoring other blocks
+func parseCABundle(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return certs, nil
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+}
+
+// missingCerts returns the certificates of certs which aren't in existing
+func missingCerts(certs, existing []*x509.Certificate) []*x509.Certificate {
+	var missing []*x509.Certificate
+	for _, cert := range certs {
+		found := false
+		for _, e := range existing {
+			if cert.Equal(e) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, cert)
+		}
+	}
+	return missing
+}
+
+func encodeCerts(certs []*x509.Certificate) []byte {
+	var out []byte
+	for _, cert := range certs {
+		out = append(out, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	return out
+}
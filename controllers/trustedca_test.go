@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	configv1 "github.com/openshift/api/config/v1"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("TrustedCAPublisher", func() {
+	var (
+		ctx     = context.Background()
+		c       client.Client
+		p       *TrustedCAPublisher
+		caDir   string
+		imageCA []byte
+		otherCA []byte
+		userKey = types.NamespacedName{Namespace: "openshift-config", Name: "user-ca-bundle"}
+	)
+
+	BeforeEach(func() {
+		c = fakeclient.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		var err error
+		caDir, err = os.MkdirTemp("", "trustedca_test")
+		Expect(err).NotTo(HaveOccurred())
+
+		notAfter := time.Now().Add(365 * 24 * time.Hour)
+		imageCA = lintTestCert("image-ca", notAfter, ecdsaSigned)
+		otherCA = lintTestCert("other-ca", notAfter, ecdsaSigned)
+		Expect(os.WriteFile(filepath.Join(caDir, "ca.crt"), imageCA, 0600)).To(Succeed())
+
+		p = &TrustedCAPublisher{
+			Client:  c,
+			Log:     logrus.New(),
+			Options: &ClusterConfigReconcilerOptions{ImageCAFile: filepath.Join(caDir, "ca.crt")},
+		}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(caDir)).To(Succeed())
+	})
+
+	getBundle := func(key types.NamespacedName) string {
+		cm := &corev1.ConfigMap{}
+		ExpectWithOffset(1, c.Get(ctx, key, cm)).To(Succeed())
+		return cm.Data[caBundleKey]
+	}
+
+	createProxy := func(trustedCA string) {
+		ExpectWithOffset(1, c.Create(ctx, &configv1.Proxy{
+			ObjectMeta: metav1.ObjectMeta{Name: "cluster"},
+			Spec:       configv1.ProxySpec{TrustedCA: configv1.ConfigMapNameReference{Name: trustedCA}},
+		})).To(Succeed())
+	}
+
+	It("doesn't change a Proxy without a trustedCA or create the ConfigMap it refers to", func() {
+		createProxy("")
+		Expect(p.Publish(ctx)).To(MatchError(ContainSubstring("has no trustedCA")))
+		proxy := &configv1.Proxy{}
+		Expect(c.Get(ctx, types.NamespacedName{Name: "cluster"}, proxy)).To(Succeed())
+		Expect(proxy.Spec.TrustedCA.Name).To(BeEmpty())
+
+		proxy.Spec.TrustedCA.Name = userKey.Name
+		Expect(c.Update(ctx, proxy)).To(Succeed())
+		Expect(p.Publish(ctx)).To(MatchError(ContainSubstring("doesn't exist")))
+		Expect(c.Get(ctx, userKey, &corev1.ConfigMap{})).NotTo(Succeed())
+	})
+
+	It("adds the CA to the bundle the Proxy refers to and keeps its certificates", func() {
+		createProxy("custom-ca")
+		key := types.NamespacedName{Namespace: "openshift-config", Name: "custom-ca"}
+		Expect(c.Create(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+			Data:       map[string]string{caBundleKey: strings.TrimSuffix(string(otherCA), "\n")},
+		})).To(Succeed())
+
+		Expect(p.Publish(ctx)).To(Succeed())
+		Expect(getBundle(key)).To(Equal(string(otherCA) + string(imageCA)))
+
+		// publishing again doesn't add the CA twice
+		Expect(p.Publish(ctx)).To(Succeed())
+		Expect(getBundle(key)).To(Equal(string(otherCA) + string(imageCA)))
+	})
+
+	It("publishes to the configured ConfigMap without a Proxy", func() {
+		p.Options.ImageCAConfigMap = "metal3/ironic-ca"
+		Expect(p.Publish(ctx)).To(Succeed())
+		Expect(getBundle(types.NamespacedName{Namespace: "metal3", Name: "ironic-ca"})).To(Equal(string(imageCA)))
+	})
+
+	It("only adds missing certificates from the CA file", func() {
+		p.Options.ImageCAConfigMap = "metal3/ironic-ca"
+		Expect(c.Create(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "ironic-ca", Namespace: "metal3"},
+			Data:       map[string]string{caBundleKey: string(imageCA)},
+		})).To(Succeed())
+		Expect(os.WriteFile(p.Options.ImageCAFile, append(append([]byte{}, imageCA...), otherCA...), 0600)).To(Succeed())
+
+		Expect(p.Publish(ctx)).To(Succeed())
+		Expect(getBundle(types.NamespacedName{Namespace: "metal3", Name: "ironic-ca"})).To(Equal(string(imageCA) + string(otherCA)))
+	})
+
+	It("replaces the published certificates when the CA is rotated", func() {
+		p.Options.ImageCAConfigMap = "metal3/ironic-ca"
+		key := types.NamespacedName{Namespace: "metal3", Name: "ironic-ca"}
+		userCA := lintTestCert("user-ca", time.Now().Add(365*24*time.Hour), ecdsaSigned)
+		Expect(c.Create(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+			Data:       map[string]string{caBundleKey: "# user CA\n" + string(userCA)},
+		})).To(Succeed())
+		Expect(p.Publish(ctx)).To(Succeed())
+		Expect(getBundle(key)).To(Equal("# user CA\n" + string(userCA) + string(imageCA)))
+
+		Expect(os.WriteFile(p.Options.ImageCAFile, otherCA, 0600)).To(Succeed())
+		Expect(p.Publish(ctx)).To(Succeed())
+		Expect(getBundle(key)).To(Equal("# user CA\n" + string(userCA) + string(otherCA)))
+
+		// publishing again doesn't change the bundle
+		Expect(p.Publish(ctx)).To(Succeed())
+		Expect(getBundle(key)).To(Equal("# user CA\n" + string(userCA) + string(otherCA)))
+	})
+
+	It("fails without a Proxy or a configured ConfigMap", func() {
+		Expect(p.Publish(ctx)).To(MatchError(ContainSubstring("set IMAGE_CA_CONFIGMAP")))
+	})
+
+	It("rejects invalid CA files and ConfigMap names", func() {
+		p.Options.ImageCAConfigMap = "ironic-ca"
+		Expect(p.Publish(ctx)).To(MatchError(ContainSubstring("invalid IMAGE_CA_CONFIGMAP")))
+
+		p.Options.ImageCAConfigMap = "metal3/ironic-ca"
+		Expect(os.WriteFile(p.Options.ImageCAFile, []byte("not a certificate"), 0600)).To(Succeed())
+		Expect(p.Publish(ctx)).To(MatchError(ContainSubstring("no certificates found")))
+	})
+})
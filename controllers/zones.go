@@ -0,0 +1,87 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+)
+
+// ZoneURLs maps network zones to the URL the image service is reachable at from that zone
+type ZoneURLs map[string]string
+
+// Decode implements envconfig.Decoder for a comma separated list of zone=url pairs
+// URLs contain colons so the default map format can't be used
+func (z *ZoneURLs) Decode(value string) error {
+	zones := ZoneURLs{}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		zone, serviceURL, ok := strings.Cut(pair, "=")
+		if !ok || zone == "" {
+			return fmt.Errorf("invalid zone service URL %q, expected zone=url", pair)
+		}
+		u, err := url.Parse(serviceURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("the service URL for zone %s must be an absolute http or https URL", zone)
+		}
+		zones[zone] = serviceURL
+	}
+	*z = zones
+	return nil
+}
+
+// zoneBaseURL returns the URL the image service is reachable at from the zone of config
+// Configs without a zone use the tenant hostname of their namespace if TenantDomain is set, or the service URL
+func (r *ClusterConfigReconciler) zoneBaseURL(config *relocationv1alpha1.ClusterConfig) (string, error) {
+	zone := config.Labels[relocationv1alpha1.ZoneLabel]
+	if zone == "" {
+		if r.Options.TenantDomain != "" {
+			return r.tenantURL(config.Namespace), nil
+		}
+		return r.baseURL(), nil
+	}
+	u, ok := r.Options.ZoneServiceURLs[zone]
+	if !ok {
+		// hosts in zones with a cache download from it so don't need to reach the image service
+		if _, cached := r.Options.ZoneCacheURLs[zone]; cached {
+			return r.baseURL(), nil
+		}
+		return "", fmt.Errorf("no service URL is configured for zone %s", zone)
+	}
+	return u, nil
+}
+
+// tenantURL returns the URL the images of namespace are served from with TenantDomain
+// The image server listens on the same port for every hostname so the port of the base URL is kept
+func (r *ClusterConfigReconciler) tenantURL(namespace string) string {
+	host := namespace + "." + r.Options.TenantDomain
+	if base, err := url.Parse(r.baseURL()); err == nil && base.Port() != "" {
+		host = net.JoinHostPort(host, base.Port())
+	}
+	u := url.URL{
+		Scheme: r.Options.ServiceScheme,
+		Host:   host,
+	}
+	return u.String()
+}
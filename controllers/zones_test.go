@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"os"
+
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+	"github.com/kelseyhightower/envconfig"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("ZoneURLs", func() {
+	It("decodes zone=url pairs", func() {
+		zones := ZoneURLs{}
+		Expect(zones.Decode("edge-a=https://images.edge-a.example.com:8443, edge-b=http://10.0.0.5")).To(Succeed())
+		Expect(zones).To(Equal(ZoneURLs{
+			"edge-a": "https://images.edge-a.example.com:8443",
+			"edge-b": "http://10.0.0.5",
+		}))
+	})
+
+	It("is loaded from the environment", func() {
+		os.Setenv("ZONE_SERVICE_URLS", "edge-a=https://images.edge-a.example.com:8443")
+		defer os.Unsetenv("ZONE_SERVICE_URLS")
+		opts := &ClusterConfigReconcilerOptions{}
+		Expect(envconfig.Process("cluster-relocation-service", opts)).To(Succeed())
+		Expect(opts.ZoneServiceURLs).To(HaveKeyWithValue("edge-a", "https://images.edge-a.example.com:8443"))
+	})
+
+	It("rejects invalid pairs", func() {
+		zones := ZoneURLs{}
+		Expect(zones.Decode("edge-a")).NotTo(Succeed())
+		Expect(zones.Decode("=https://images.example.com")).NotTo(Succeed())
+		Expect(zones.Decode("edge-a=images.example.com")).NotTo(Succeed())
+	})
+})
+
+var _ = Describe("imageURL with zones", func() {
+	var r *ClusterConfigReconciler
+
+	BeforeEach(func() {
+		r = &ClusterConfigReconciler{
+			BaseURL: "http://service.namespace",
+			Options: &ClusterConfigReconcilerOptions{
+				ZoneServiceURLs: ZoneURLs{"edge-a": "https://images.edge-a.example.com:8443"},
+			},
+		}
+	})
+
+	config := func(zone string) *relocationv1alpha1.ClusterConfig {
+		c := &relocationv1alpha1.ClusterConfig{ObjectMeta: metav1.ObjectMeta{Name: "site", Namespace: "sites"}}
+		if zone != "" {
+			c.Labels = map[string]string{relocationv1alpha1.ZoneLabel: zone}
+		}
+		return c
+	}
+
+	It("uses the service URL without a zone", func() {
+		Expect(r.imageURL(config(""))).To(Equal("http://service.namespace/images/sites/site.iso"))
+	})
+
+	It("uses the URL of the zone", func() {
+		Expect(r.imageURL(config("edge-a"))).To(Equal("https://images.edge-a.example.com:8443/images/sites/site.iso"))
+	})
+
+	It("fails for unknown zones", func() {
+		_, err := r.imageURL(config("edge-b"))
+		Expect(err).To(MatchError(ContainSubstring("zone edge-b")))
+	})
+
+	It("uses the service URL for zones with only a cache", func() {
+		r.Options.ZoneCacheURLs = ZoneURLs{"edge-b": "https://cache.edge-b.example.com"}
+		Expect(r.imageURL(config("edge-b"))).To(Equal("http://service.namespace/images/sites/site.iso"))
+	})
+
+	It("uses the tenant hostname of the namespace with a tenant domain", func() {
+		r.Options.ServiceScheme = "https"
+		r.Options.TenantDomain = "images.example.com"
+		Expect(r.imageURL(config(""))).To(Equal("https://sites.images.example.com/images/sites/site.iso"))
+		Expect(r.imageURL(config("edge-a"))).To(Equal("https://images.edge-a.example.com:8443/images/sites/site.iso"))
+	})
+
+	It("keeps the port of the service URL on the tenant hostname", func() {
+		r.BaseURL = "https://service.namespace:8443"
+		r.Options.ServiceScheme = "https"
+		r.Options.TenantDomain = "images.example.com"
+		Expect(r.imageURL(config(""))).To(Equal("https://sites.images.example.com:8443/images/sites/site.iso"))
+	})
+})
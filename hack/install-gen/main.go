@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"os"
+
+	"github.com/carbonin/cluster-relocation-service/internal/install"
+	"github.com/sirupsen/logrus"
+)
+
+func main() {
+	opts := install.DefaultOptions()
+	var servicePort, mirrorReplicas int
+
+	flag.StringVar(&opts.ConfigDir, "config-dir", opts.ConfigDir, "The kubebuilder config directory containing generated manifests.")
+	flag.StringVar(&opts.Namespace, "namespace", opts.Namespace, "The namespace to install into.")
+	flag.StringVar(&opts.Image, "image", opts.Image, "The service container image.")
+	flag.StringVar(&opts.ServiceName, "service-name", opts.ServiceName, "The name of the image server Service.")
+	flag.IntVar(&servicePort, "service-port", int(opts.ServicePort), "The port the image server listens on.")
+	flag.StringVar(&opts.StorageSize, "storage-size", opts.StorageSize, "The size of the data volume.")
+	flag.StringVar(&opts.StorageClassName, "storage-class", opts.StorageClassName, "The storage class of the data volume, defaults to the cluster default.")
+	flag.BoolVar(&opts.Route, "route", opts.Route, "Create a Route exposing the image server.")
+	flag.StringVar(&opts.RouteHost, "route-host", opts.RouteHost, "The host for the image server Route.")
+	flag.IntVar(&mirrorReplicas, "mirror-replicas", int(opts.MirrorReplicas), "The number of read-only image server replicas, requires ReadWriteMany storage.")
+	flag.Parse()
+	opts.ServicePort = int32(servicePort)
+	opts.MirrorReplicas = int32(mirrorReplicas)
+
+	w := bufio.NewWriter(os.Stdout)
+	if err := install.Write(w, opts); err != nil {
+		logrus.Fatalf("Failed to generate install manifest: %s", err)
+	}
+	if err := w.Flush(); err != nil {
+		logrus.Fatalf("Failed to write install manifest: %s", err)
+	}
+}
@@ -0,0 +1,190 @@
+// Package accesslog writes a line for each request served by an http.Handler
+package accesslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Format selects how requests are written to the access log
+type Format string
+
+const (
+	// FormatCommon writes requests in the Common Log Format
+	FormatCommon Format = "clf"
+	// FormatJSON writes each request as a JSON object
+	FormatJSON Format = "json"
+)
+
+// clfTimeFormat is the timestamp layout used by the Common Log Format
+const clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// ParseFormat returns the Format named by s
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case FormatCommon, FormatJSON:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unknown access log format %q, must be %q or %q", s, FormatCommon, FormatJSON)
+	}
+}
+
+// Record describes a served request
+type Record struct {
+	Time       time.Time `json:"time"`
+	RemoteAddr string    `json:"remoteAddr"`
+	User       string    `json:"user,omitempty"`
+	Host       string    `json:"host"`
+	Method     string    `json:"method"`
+	URI        string    `json:"uri"`
+	Proto      string    `json:"proto"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	// Duration is the time taken to serve the request in seconds
+	Duration  float64 `json:"duration"`
+	Referer   string  `json:"referer,omitempty"`
+	UserAgent string  `json:"userAgent,omitempty"`
+}
+
+// Handler wraps Next to write a Record to Out once each request has been served
+// Failures to write are logged to Log and don't affect the response
+type Handler struct {
+	Format Format
+	Out    io.Writer
+	Log    logrus.FieldLogger
+	Next   http.Handler
+
+	mu sync.Mutex
+	// now returns the current time, time.Now is used when it is nil
+	now func() time.Time
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	now := time.Now
+	if h.now != nil {
+		now = h.now
+	}
+	start := now()
+	rw := &responseWriter{ResponseWriter: w}
+	h.Next.ServeHTTP(rw, r)
+
+	status := rw.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+	user, _, _ := r.BasicAuth()
+	h.write(Record{
+		Time:       start,
+		RemoteAddr: remote,
+		User:       user,
+		Host:       r.Host,
+		Method:     r.Method,
+		URI:        r.RequestURI,
+		Proto:      r.Proto,
+		Status:     status,
+		Bytes:      rw.bytes,
+		Duration:   now().Sub(start).Seconds(),
+		Referer:    r.Referer(),
+		UserAgent:  r.UserAgent(),
+	})
+}
+
+func (h *Handler) write(e Record) {
+	var line []byte
+	if h.Format == FormatJSON {
+		var err error
+		line, err = json.Marshal(e)
+		if err != nil {
+			h.Log.WithError(err).Error("failed to encode access log record")
+			return
+		}
+		line = append(line, '\n')
+	} else {
+		line = []byte(commonLogLine(e))
+	}
+
+	// entries are written with a single call so concurrent requests don't interleave
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, err := h.Out.Write(line); err != nil {
+		h.Log.WithError(err).Error("failed to write access log record")
+	}
+}
+
+// commonLogLine formats e in the Common Log Format, including the trailing newline
+func commonLogLine(e Record) string {
+	user := e.User
+	if user == "" {
+		user = "-"
+	}
+	size := "-"
+	if e.Bytes > 0 {
+		size = strconv.FormatInt(e.Bytes, 10)
+	}
+	return fmt.Sprintf("%s - %s [%s] %s %d %s\n",
+		e.RemoteAddr, user, e.Time.Format(clfTimeFormat),
+		strconv.Quote(fmt.Sprintf("%s %s %s", e.Method, e.URI, e.Proto)), e.Status, size)
+}
+
+// responseWriter records the status and size of a response
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// ReadFrom keeps the sendfile path of the wrapped writer available when images are copied to the response
+func (w *responseWriter) ReadFrom(src io.Reader) (int64, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	var n int64
+	var err error
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(src)
+	} else {
+		n, err = io.Copy(struct{ io.Writer }{w.ResponseWriter}, src)
+	}
+	w.bytes += n
+	return n, err
+}
+
+// Flush lets event streams flush through the wrapper
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the wrapped writer for http.ResponseController
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
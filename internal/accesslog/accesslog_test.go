@@ -0,0 +1,105 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+)
+
+func TestAccessLog(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Access Log Suite")
+}
+
+var _ = Describe("Handler", func() {
+	var (
+		out     *bytes.Buffer
+		handler *Handler
+		start   = time.Date(2023, time.June, 1, 12, 30, 0, 0, time.UTC)
+	)
+
+	BeforeEach(func() {
+		out = &bytes.Buffer{}
+		calls := 0
+		handler = &Handler{
+			Format: FormatCommon,
+			Out:    out,
+			Log:    logrus.New(),
+			Next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/missing" {
+					http.NotFound(w, r)
+					return
+				}
+				_, _ = io.Copy(w, strings.NewReader("image contents"))
+			}),
+			now: func() time.Time {
+				calls++
+				return start.Add(time.Duration(calls-1) * 1500 * time.Millisecond)
+			},
+		}
+	})
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "192.0.2.10:51234"
+		req.Header.Set("User-Agent", "ironic")
+		req.SetBasicAuth("tenant", "secret")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	It("writes requests in the Common Log Format", func() {
+		rec := serve("/images/ns/name.iso?version=abc")
+		Expect(rec.Body.String()).To(Equal("image contents"))
+		Expect(out.String()).To(Equal(`192.0.2.10 - tenant [01/Jun/2023:12:30:00 +0000] "GET /images/ns/name.iso?version=abc HTTP/1.1" 200 14` + "\n"))
+	})
+
+	It("records the status set by the wrapped handler", func() {
+		serve("/missing")
+		Expect(out.String()).To(ContainSubstring(`"GET /missing HTTP/1.1" 404 `))
+	})
+
+	It("writes requests as JSON", func() {
+		handler.Format = FormatJSON
+		serve("/images/ns/name.iso")
+
+		var e Record
+		Expect(json.Unmarshal(out.Bytes(), &e)).To(Succeed())
+		Expect(e.Time.Equal(start)).To(BeTrue())
+		Expect(e.RemoteAddr).To(Equal("192.0.2.10"))
+		Expect(e.User).To(Equal("tenant"))
+		Expect(e.Method).To(Equal(http.MethodGet))
+		Expect(e.URI).To(Equal("/images/ns/name.iso"))
+		Expect(e.Status).To(Equal(http.StatusOK))
+		Expect(e.Bytes).To(Equal(int64(14)))
+		Expect(e.Duration).To(Equal(1.5))
+		Expect(e.UserAgent).To(Equal("ironic"))
+		Expect(out.String()).NotTo(ContainSubstring("secret"))
+	})
+
+	It("lets the wrapped handler flush", func() {
+		handler.Next = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, ok := w.(http.Flusher)
+			Expect(ok).To(BeTrue())
+		})
+		serve("/api/v1/events")
+	})
+
+	It("rejects unknown formats", func() {
+		_, err := ParseFormat("xml")
+		Expect(err).To(HaveOccurred())
+		f, err := ParseFormat("json")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(f).To(Equal(FormatJSON))
+	})
+})
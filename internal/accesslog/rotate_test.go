@@ -0,0 +1,74 @@
+package accesslog
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RotatingFile", func() {
+	var (
+		path string
+		f    *RotatingFile
+	)
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "access.log")
+		f = &RotatingFile{Path: path, MaxSize: 10, MaxBackups: 2}
+	})
+
+	AfterEach(func() {
+		Expect(f.Close()).To(Succeed())
+	})
+
+	write := func(s string) {
+		_, err := f.Write([]byte(s))
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	read := func(p string) string {
+		data, err := os.ReadFile(p)
+		Expect(err).NotTo(HaveOccurred())
+		return string(data)
+	}
+
+	It("moves the file aside once it would grow past the maximum size", func() {
+		write("first\n")
+		write("second\n")
+		write("third\n")
+
+		Expect(read(path)).To(Equal("third\n"))
+		Expect(read(path + ".1")).To(Equal("second\n"))
+		Expect(read(path + ".2")).To(Equal("first\n"))
+	})
+
+	It("keeps at most the configured number of backups", func() {
+		for _, s := range []string{"one\n", "two\n", "three\n", "four\n", "five\n", "six\n"} {
+			write(s + "......")
+		}
+
+		Expect(read(path)).To(Equal("six\n......"))
+		Expect(read(path + ".1")).To(Equal("five\n......"))
+		Expect(read(path + ".2")).To(Equal("four\n......"))
+		Expect(path + ".3").NotTo(BeAnExistingFile())
+	})
+
+	It("appends to an existing file", func() {
+		Expect(os.WriteFile(path, []byte("old\n"), 0600)).To(Succeed())
+		write("new\n")
+		Expect(read(path)).To(Equal("old\nnew\n"))
+
+		write("rotated\n")
+		Expect(read(path + ".1")).To(Equal("old\nnew\n"))
+	})
+
+	It("doesn't rotate without a maximum size", func() {
+		f.MaxSize = 0
+		write("first\n")
+		write("second\n")
+		Expect(read(path)).To(Equal("first\nsecond\n"))
+		Expect(path + ".1").NotTo(BeAnExistingFile())
+	})
+})
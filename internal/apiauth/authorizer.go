@@ -0,0 +1,86 @@
+package apiauth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+//+kubebuilder:rbac:groups=authentication.k8s.io,resources=tokenreviews,verbs=create
+//+kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+
+// Authorizer authenticates requests using their bearer token and checks the user's
+// access using the kubernetes API so the same RBAC rules apply as for direct API access
+type Authorizer struct {
+	Client client.Client
+}
+
+// authError is returned when a request is not authenticated or not authorized
+type authError struct {
+	status  int
+	message string
+}
+
+func (e *authError) Error() string {
+	return e.message
+}
+
+// Authenticate returns the user the bearer token of r belongs to
+func (a *Authorizer) Authenticate(ctx context.Context, r *http.Request) (*authenticationv1.UserInfo, error) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return nil, &authError{status: http.StatusUnauthorized, message: "a bearer token is required"}
+	}
+
+	tr := &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: strings.TrimPrefix(auth, "Bearer ")},
+	}
+	if err := a.Client.Create(ctx, tr); err != nil {
+		return nil, fmt.Errorf("failed to review token: %w", err)
+	}
+	if !tr.Status.Authenticated {
+		return nil, &authError{status: http.StatusUnauthorized, message: "invalid bearer token"}
+	}
+	return &tr.Status.User, nil
+}
+
+// Authorize returns an error if user is not allowed to perform the action described by attrs
+func (a *Authorizer) Authorize(ctx context.Context, user *authenticationv1.UserInfo, attrs *authorizationv1.ResourceAttributes) error {
+	extra := make(map[string]authorizationv1.ExtraValue, len(user.Extra))
+	for k, v := range user.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+	sar := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			ResourceAttributes: attrs,
+			User:               user.Username,
+			Groups:             user.Groups,
+			UID:                user.UID,
+			Extra:              extra,
+		},
+	}
+	if err := a.Client.Create(ctx, sar); err != nil {
+		return fmt.Errorf("failed to review access: %w", err)
+	}
+	if !sar.Status.Allowed {
+		return &authError{
+			status:  http.StatusForbidden,
+			message: fmt.Sprintf("user %q cannot %s %s in namespace %s", user.Username, attrs.Verb, resourceName(attrs), attrs.Namespace),
+		}
+	}
+
+	return nil
+}
+
+// resourceName returns the resource and subresource of attrs as they're written in RBAC rules
+func resourceName(attrs *authorizationv1.ResourceAttributes) string {
+	if attrs.Subresource == "" {
+		return attrs.Resource
+	}
+	return attrs.Resource + "/" + attrs.Subresource
+}
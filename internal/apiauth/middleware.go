@@ -0,0 +1,124 @@
+package apiauth
+
+import (
+	"context"
+	goerrors "errors"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+)
+
+// Route is an API endpoint and the access to relocation resources users need to call it
+type Route struct {
+	// Method is the HTTP method of the endpoint
+	Method string
+	// Path matches the request path. If it has namespace and name submatches they identify the object the
+	// endpoint is for, otherwise the namespace query parameter is used and an empty one means all namespaces
+	Path *regexp.Regexp
+	// Verb is checked for Resource and Subresource in the relocation API group
+	Verb        string
+	Resource    string
+	Subresource string
+	// AllNamespaces checks access in all namespaces whatever the namespace parameter is, for endpoints which
+	// aren't about the configs of a namespace
+	AllNamespaces bool
+}
+
+// attributes returns the resource attributes checked for a request to the route
+func (rt *Route) attributes(r *http.Request, match []string) *authorizationv1.ResourceAttributes {
+	attrs := &authorizationv1.ResourceAttributes{
+		Verb:        rt.Verb,
+		Group:       relocationv1alpha1.GroupVersion.Group,
+		Resource:    rt.Resource,
+		Subresource: rt.Subresource,
+	}
+	if i := rt.Path.SubexpIndex("namespace"); i > 0 {
+		attrs.Namespace = match[i]
+	} else if !rt.AllNamespaces {
+		attrs.Namespace = r.URL.Query().Get("namespace")
+	}
+	if i := rt.Path.SubexpIndex("name"); i > 0 {
+		attrs.Name = match[i]
+	}
+	return attrs
+}
+
+// Middleware authenticates each request with a TokenReview and authorizes it with a SubjectAccessReview for the
+// route it matches before passing it to Next
+// Requests which match no route are rejected so an endpoint can't be added without declaring the access it needs
+type Middleware struct {
+	Log        logrus.FieldLogger
+	Authorizer *Authorizer
+	Routes     []Route
+	Next       http.Handler
+}
+
+func (m *Middleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var route *Route
+	var match []string
+	allowed := []string{}
+	for i := range m.Routes {
+		rt := &m.Routes[i]
+		pathMatch := rt.Path.FindStringSubmatch(r.URL.Path)
+		if pathMatch == nil {
+			continue
+		}
+		allowed = append(allowed, rt.Method)
+		if rt.Method == r.Method {
+			route, match = rt, pathMatch
+			break
+		}
+	}
+	if route == nil {
+		if len(allowed) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	attrs := route.attributes(r, match)
+	log := m.Log.WithFields(logrus.Fields{"namespace": attrs.Namespace, "name": attrs.Name})
+	user, err := m.Authorizer.Authenticate(r.Context(), r)
+	if err == nil {
+		log = log.WithField("user", user.Username)
+		err = m.Authorizer.Authorize(r.Context(), user, attrs)
+	}
+	if err != nil {
+		WriteError(w, log, err)
+		return
+	}
+	m.Next.ServeHTTP(w, r.WithContext(withUser(r.Context(), user)))
+}
+
+// WriteError responds to a request that failed authentication or authorization
+// Handlers checking further access with the Authorizer use it to respond the same way as the Middleware
+func WriteError(w http.ResponseWriter, log logrus.FieldLogger, err error) {
+	var authErr *authError
+	if goerrors.As(err, &authErr) {
+		http.Error(w, authErr.message, authErr.status)
+		return
+	}
+	log.WithError(err).Error("failed to authorize request")
+	http.Error(w, "failed to authorize request", http.StatusInternalServerError)
+}
+
+type userKey struct{}
+
+func withUser(ctx context.Context, user *authenticationv1.UserInfo) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+// UserFrom returns the user the Middleware authenticated for the request with ctx, or nil if there is none
+func UserFrom(ctx context.Context) *authenticationv1.UserInfo {
+	user, _ := ctx.Value(userKey{}).(*authenticationv1.UserInfo)
+	return user
+}
@@ -0,0 +1,167 @@
+package apiauth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestAPIAuth(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "API Auth Suite")
+}
+
+var _ = Describe("Middleware", func() {
+	var (
+		m         *Middleware
+		lastSAR   *authorizationv1.SubjectAccessReview
+		allowed   bool
+		reviewErr error
+		nextUser  *authenticationv1.UserInfo
+		reached   bool
+	)
+
+	BeforeEach(func() {
+		lastSAR = nil
+		allowed = true
+		reviewErr = nil
+		nextUser = nil
+		reached = false
+		c := interceptor.NewClient(fake.NewClientBuilder().Build(), interceptor.Funcs{
+			Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+				switch o := obj.(type) {
+				case *authenticationv1.TokenReview:
+					if reviewErr != nil {
+						return reviewErr
+					}
+					o.Status.Authenticated = o.Spec.Token == "valid"
+					o.Status.User = authenticationv1.UserInfo{Username: "alice", Groups: []string{"admins"}}
+					return nil
+				case *authorizationv1.SubjectAccessReview:
+					lastSAR = o
+					o.Status.Allowed = allowed
+					return nil
+				}
+				return c.Create(ctx, obj, opts...)
+			},
+		})
+		m = &Middleware{
+			Log:        logrus.New(),
+			Authorizer: &Authorizer{Client: c},
+			Routes: []Route{
+				{Method: http.MethodGet, Path: regexp.MustCompile(`^/things/(?P<namespace>[^/]+)/(?P<name>[^/]+)$`), Verb: "get", Resource: "clusterconfigs", Subresource: "things"},
+				{Method: http.MethodPost, Path: regexp.MustCompile(`^/things/(?P<namespace>[^/]+)/(?P<name>[^/]+)$`), Verb: "update", Resource: "clusterconfigs", Subresource: "things"},
+				{Method: http.MethodGet, Path: regexp.MustCompile(`^/things$`), Verb: "list", Resource: "clusterconfigs"},
+			},
+			Next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				reached = true
+				nextUser = UserFrom(r.Context())
+			}),
+		}
+	})
+
+	serve := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		m.ServeHTTP(rec, req)
+		return rec
+	}
+
+	It("passes authorized requests on with the user", func() {
+		rec := serve(http.MethodGet, "/things/ns/thing", "valid")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(reached).To(BeTrue())
+		Expect(nextUser).NotTo(BeNil())
+		Expect(nextUser.Username).To(Equal("alice"))
+
+		Expect(lastSAR.Spec.User).To(Equal("alice"))
+		Expect(lastSAR.Spec.Groups).To(Equal([]string{"admins"}))
+		Expect(*lastSAR.Spec.ResourceAttributes).To(Equal(authorizationv1.ResourceAttributes{
+			Namespace:   "ns",
+			Name:        "thing",
+			Verb:        "get",
+			Group:       "relocation.openshift.io",
+			Resource:    "clusterconfigs",
+			Subresource: "things",
+		}))
+	})
+
+	It("checks the verb of the route matching the method", func() {
+		Expect(serve(http.MethodPost, "/things/ns/thing", "valid").Code).To(Equal(http.StatusOK))
+		Expect(lastSAR.Spec.ResourceAttributes.Verb).To(Equal("update"))
+	})
+
+	It("uses the namespace query parameter for routes without a namespace", func() {
+		Expect(serve(http.MethodGet, "/things?namespace=ns", "valid").Code).To(Equal(http.StatusOK))
+		Expect(lastSAR.Spec.ResourceAttributes.Namespace).To(Equal("ns"))
+		Expect(lastSAR.Spec.ResourceAttributes.Name).To(BeEmpty())
+
+		Expect(serve(http.MethodGet, "/things", "valid").Code).To(Equal(http.StatusOK))
+		Expect(lastSAR.Spec.ResourceAttributes.Namespace).To(BeEmpty())
+	})
+
+	It("ignores the namespace query parameter for routes with a namespace", func() {
+		Expect(serve(http.MethodGet, "/things/ns/thing?namespace=other", "valid").Code).To(Equal(http.StatusOK))
+		Expect(lastSAR.Spec.ResourceAttributes.Namespace).To(Equal("ns"))
+	})
+
+	It("rejects requests without a token", func() {
+		Expect(serve(http.MethodGet, "/things/ns/thing", "").Code).To(Equal(http.StatusUnauthorized))
+		Expect(reached).To(BeFalse())
+		Expect(lastSAR).To(BeNil())
+	})
+
+	It("rejects requests with an invalid token", func() {
+		Expect(serve(http.MethodGet, "/things/ns/thing", "invalid").Code).To(Equal(http.StatusUnauthorized))
+		Expect(reached).To(BeFalse())
+		Expect(lastSAR).To(BeNil())
+	})
+
+	It("rejects users without access", func() {
+		allowed = false
+		rec := serve(http.MethodGet, "/things/ns/thing", "valid")
+		Expect(rec.Code).To(Equal(http.StatusForbidden))
+		Expect(rec.Body.String()).To(ContainSubstring(`user "alice" cannot get clusterconfigs/things in namespace ns`))
+		Expect(reached).To(BeFalse())
+	})
+
+	It("fails when the token can't be reviewed", func() {
+		reviewErr = fmt.Errorf("unavailable")
+		rec := serve(http.MethodGet, "/things/ns/thing", "valid")
+		Expect(rec.Code).To(Equal(http.StatusInternalServerError))
+		Expect(rec.Body.String()).NotTo(ContainSubstring("unavailable"))
+		Expect(reached).To(BeFalse())
+	})
+
+	It("rejects paths without a route before authenticating", func() {
+		Expect(serve(http.MethodGet, "/things/ns", "").Code).To(Equal(http.StatusNotFound))
+		Expect(reached).To(BeFalse())
+	})
+
+	It("rejects methods without a route with the allowed ones", func() {
+		rec := serve(http.MethodDelete, "/things/ns/thing", "valid")
+		Expect(rec.Code).To(Equal(http.StatusMethodNotAllowed))
+		Expect(rec.Header().Get("Allow")).To(Equal("GET, POST"))
+		Expect(reached).To(BeFalse())
+		Expect(lastSAR).To(BeNil())
+	})
+
+	It("has no user outside the middleware", func() {
+		Expect(UserFrom(context.Background())).To(BeNil())
+	})
+})
@@ -0,0 +1,114 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/carbonin/cluster-relocation-service/api/apischema"
+	"github.com/carbonin/cluster-relocation-service/internal/datadir"
+	"github.com/sirupsen/logrus"
+)
+
+// ConsoleLogDir is the directory in a config's data directory the manager stores captured host console output in
+const ConsoleLogDir = "consolelogs"
+
+// ConsoleLogHandler serves the host console output the manager captured during each relocation attempt
+// Requests for other paths are passed to Next
+type ConsoleLogHandler struct {
+	Log logrus.FieldLogger
+	// ConfigsDir and ConfigsDirShards are the directories holding the configs of each namespace, as for the image server
+	ConfigsDir       string
+	ConfigsDirShards []string
+	Next             http.Handler
+}
+
+var consoleLogPathRegexp = regexp.MustCompile(`^/api/v1/clusterconfigs/(?P<namespace>[^/]+)/(?P<name>[^/]+)/consolelogs(?:/([^/]+))?$`)
+
+// consoleLogNameRegexp matches the names the manager gives captured console output
+var consoleLogNameRegexp = regexp.MustCompile(`^[0-9]+\.log$`)
+
+func (h *ConsoleLogHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	match := consoleLogPathRegexp.FindStringSubmatch(r.URL.Path)
+	if match == nil {
+		h.Next.ServeHTTP(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	namespace, name, logName := match[1], match[2], match[3]
+	log := h.Log.WithFields(logrus.Fields{"namespace": namespace, "name": name})
+
+	dir := filepath.Join(h.configsDir(namespace), namespace, name, ConsoleLogDir)
+	if logName == "" {
+		h.serveList(w, log, dir)
+		return
+	}
+	if !consoleLogNameRegexp.MatchString(logName) {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := os.Open(filepath.Join(dir, logName))
+	if os.IsNotExist(err) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		log.WithError(err).Error("failed to open console log")
+		http.Error(w, "failed to read console log", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		log.WithError(err).Error("failed to stat console log")
+		http.Error(w, "failed to read console log", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	http.ServeContent(w, r, logName, info.ModTime(), f)
+}
+
+// serveList responds with the console logs in dir, oldest first
+func (h *ConsoleLogHandler) serveList(w http.ResponseWriter, log logrus.FieldLogger, dir string) {
+	logs := []apischema.ConsoleLog{}
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		log.WithError(err).Error("failed to list console logs")
+		http.Error(w, "failed to list console logs", http.StatusInternalServerError)
+		return
+	}
+	for _, entry := range entries {
+		if !consoleLogNameRegexp.MatchString(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			// removed since the directory was read
+			continue
+		}
+		logs = append(logs, apischema.ConsoleLog{Name: entry.Name(), Size: info.Size(), LastCaptured: info.ModTime().UTC()})
+	}
+	sort.Slice(logs, func(i, j int) bool { return logs[i].Name < logs[j].Name })
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(logs); err != nil {
+		log.WithError(err).Error("failed to write console logs")
+	}
+}
+
+// configsDir returns the directory holding the configs in namespace
+func (h *ConsoleLogHandler) configsDir(namespace string) string {
+	if dir := datadir.For(h.ConfigsDirShards, namespace); dir != "" {
+		return dir
+	}
+	return h.ConfigsDir
+}
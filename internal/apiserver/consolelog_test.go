@@ -0,0 +1,135 @@
+package apiserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	"github.com/carbonin/cluster-relocation-service/api/apischema"
+)
+
+var _ = Describe("ConsoleLogHandler", func() {
+	var (
+		handler    http.Handler
+		configsDir string
+		lastSAR    *authorizationv1.SubjectAccessReview
+		allowed    bool
+	)
+
+	const path = "/api/v1/clusterconfigs/test-namespace/test-config/consolelogs"
+
+	BeforeEach(func() {
+		allowed = true
+		lastSAR = nil
+		c := interceptor.NewClient(fake.NewClientBuilder().Build(), interceptor.Funcs{
+			Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+				switch o := obj.(type) {
+				case *authenticationv1.TokenReview:
+					o.Status.Authenticated = o.Spec.Token == "valid"
+					return nil
+				case *authorizationv1.SubjectAccessReview:
+					lastSAR = o
+					o.Status.Allowed = allowed
+					return nil
+				}
+				return c.Create(ctx, obj, opts...)
+			},
+		})
+
+		var err error
+		configsDir, err = os.MkdirTemp("", "consolelog_test")
+		Expect(err).NotTo(HaveOccurred())
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		})
+		handler = authorized(c, &ConsoleLogHandler{Log: logrus.New(), ConfigsDir: configsDir, Next: next})
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(configsDir)).To(Succeed())
+	})
+
+	request := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	writeLog := func(name, content string) {
+		dir := filepath.Join(configsDir, "test-namespace", "test-config", ConsoleLogDir)
+		Expect(os.MkdirAll(dir, 0700)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, name), []byte(content), 0600)).To(Succeed())
+	}
+
+	It("lists and serves captured console output", func() {
+		writeLog("1700000100.log", "second attempt")
+		writeLog("1700000000.log", "first attempt")
+		writeLog(".tmp-1700000100.log123", "partial")
+
+		rec := request(http.MethodGet, path, "valid")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		var logs []apischema.ConsoleLog
+		Expect(json.Unmarshal(rec.Body.Bytes(), &logs)).To(Succeed())
+		Expect(logs).To(HaveLen(2))
+		Expect(logs[0].Name).To(Equal("1700000000.log"))
+		Expect(logs[0].Size).To(Equal(int64(len("first attempt"))))
+		Expect(logs[1].Name).To(Equal("1700000100.log"))
+
+		rec = request(http.MethodGet, path+"/1700000100.log", "valid")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Body.String()).To(Equal("second attempt"))
+		Expect(rec.Header().Get("Content-Type")).To(Equal("text/plain; charset=utf-8"))
+
+		Expect(*lastSAR.Spec.ResourceAttributes).To(Equal(authorizationv1.ResourceAttributes{
+			Namespace:   "test-namespace",
+			Name:        "test-config",
+			Verb:        "get",
+			Group:       "relocation.openshift.io",
+			Resource:    "clusterconfigs",
+			Subresource: "consolelogs",
+		}))
+	})
+
+	It("lists nothing before any output is captured", func() {
+		rec := request(http.MethodGet, path, "valid")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Body.String()).To(MatchJSON("[]"))
+	})
+
+	It("returns not found for missing and invalid log names", func() {
+		writeLog(".tmp-1700000000.log123", "partial")
+		Expect(request(http.MethodGet, path+"/1700000000.log", "valid").Code).To(Equal(http.StatusNotFound))
+		Expect(request(http.MethodGet, path+"/.tmp-1700000000.log123", "valid").Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("requires authorization", func() {
+		writeLog("1700000000.log", "first attempt")
+		Expect(request(http.MethodGet, path+"/1700000000.log", "").Code).To(Equal(http.StatusUnauthorized))
+		allowed = false
+		Expect(request(http.MethodGet, path+"/1700000000.log", "valid").Code).To(Equal(http.StatusForbidden))
+	})
+
+	It("passes other paths on", func() {
+		Expect(request(http.MethodGet, "/api/v1/clusterconfigs/test-namespace/test-config/kubeconfig", "valid").Code).To(Equal(http.StatusTeapot))
+	})
+
+	It("only accepts GET", func() {
+		Expect(request(http.MethodPost, path, "valid").Code).To(Equal(http.StatusMethodNotAllowed))
+	})
+})
@@ -0,0 +1,129 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	toolscache "k8s.io/client-go/tools/cache"
+
+	"github.com/carbonin/cluster-relocation-service/api/apischema"
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+	"github.com/carbonin/cluster-relocation-service/internal/deadline"
+	"github.com/carbonin/cluster-relocation-service/internal/events"
+	"github.com/sirupsen/logrus"
+)
+
+//+kubebuilder:rbac:groups=relocation.openshift.io,resources=clusterconfigs,verbs=list;watch
+
+// heartbeatInterval is how often a comment is sent on idle streams so proxies don't close them
+const heartbeatInterval = 30 * time.Second
+
+// EventsHandler streams relocation lifecycle events as server-sent events
+// Events are for the requested namespace, or across all namespaces if none is given
+type EventsHandler struct {
+	Log    logrus.FieldLogger
+	Broker *events.Broker
+	// MaxSubscribers limits the number of open streams so they can't take the connections image downloads need,
+	// zero means no limit
+	MaxSubscribers int
+
+	subscribers atomic.Int64
+}
+
+func (h *EventsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	namespace := r.URL.Query().Get("namespace")
+	log := h.Log.WithField("namespace", namespace)
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	if n := h.subscribers.Add(1); h.MaxSubscribers > 0 && n > int64(h.MaxSubscribers) {
+		h.subscribers.Add(-1)
+		w.Header().Set("Retry-After", fmt.Sprint(int(heartbeatInterval.Seconds())))
+		http.Error(w, "too many event subscribers", http.StatusServiceUnavailable)
+		return
+	}
+	defer h.subscribers.Add(-1)
+
+	// streams stay open until the client leaves so the write timeout, sized for image downloads, can't apply
+	if err := deadline.Clear(r); err != nil {
+		log.WithError(err).Warn("failed to clear the write deadline of the event stream")
+	}
+
+	ch, unsubscribe := h.Broker.Subscribe(namespace)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				log.WithError(err).Error("failed to marshal event")
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// phaseEvents are the events published when a ClusterConfig enters a phase
+var phaseEvents = map[relocationv1alpha1.ClusterConfigPhase]apischema.EventType{
+	relocationv1alpha1.ClusterConfigPhaseImageAttached: apischema.ImageAttached,
+	relocationv1alpha1.ClusterConfigPhaseCompleted:     apischema.RelocationCompleted,
+	relocationv1alpha1.ClusterConfigPhaseAborted:       apischema.RelocationAborted,
+}
+
+// PhaseEventHandler returns an informer event handler publishing events for ClusterConfig phase changes to broker
+func PhaseEventHandler(broker *events.Broker) toolscache.ResourceEventHandler {
+	return toolscache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			old, ok := oldObj.(*relocationv1alpha1.ClusterConfig)
+			if !ok {
+				return
+			}
+			config, ok := newObj.(*relocationv1alpha1.ClusterConfig)
+			if !ok || config.Status.Phase == old.Status.Phase {
+				return
+			}
+			t, ok := phaseEvents[config.Status.Phase]
+			if !ok {
+				return
+			}
+			e := apischema.Event{Type: t, Namespace: config.Namespace, Name: config.Name}
+			if config.Status.PhaseTransitionTime != nil {
+				e.Time = config.Status.PhaseTransitionTime.Time
+			}
+			broker.Publish(e)
+		},
+	}
+}
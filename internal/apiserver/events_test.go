@@ -0,0 +1,199 @@
+package apiserver
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/carbonin/cluster-relocation-service/api/apischema"
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+	"github.com/carbonin/cluster-relocation-service/internal/deadline"
+	"github.com/carbonin/cluster-relocation-service/internal/events"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+var _ = Describe("EventsHandler", func() {
+	var (
+		server       *httptest.Server
+		handler      *EventsHandler
+		writeTimeout *deadline.WriteTimeout
+		broker       *events.Broker
+		lastSAR      *authorizationv1.SubjectAccessReview
+		allowed      bool
+	)
+
+	BeforeEach(func() {
+		allowed = true
+		lastSAR = nil
+		broker = events.NewBroker()
+		c := interceptor.NewClient(fake.NewClientBuilder().Build(), interceptor.Funcs{
+			Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+				switch o := obj.(type) {
+				case *authenticationv1.TokenReview:
+					o.Status.Authenticated = o.Spec.Token == "valid"
+					o.Status.User = authenticationv1.UserInfo{Username: "dashboard"}
+					return nil
+				case *authorizationv1.SubjectAccessReview:
+					lastSAR = o
+					o.Status.Allowed = allowed
+					return nil
+				}
+				return c.Create(ctx, obj, opts...)
+			},
+		})
+		handler = &EventsHandler{Log: logrus.New(), Broker: broker}
+		// served like the image server, which bounds the time to write each response
+		writeTimeout = &deadline.WriteTimeout{Next: authorized(c, handler)}
+		server = httptest.NewUnstartedServer(writeTimeout)
+		server.Config.ConnContext = deadline.ConnContext
+		server.Start()
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	get := func(ctx context.Context, query, token string) *http.Response {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/api/v1/events"+query, nil)
+		Expect(err).NotTo(HaveOccurred())
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := server.Client().Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		return resp
+	}
+
+	It("streams events for the requested namespace", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		resp := get(ctx, "?namespace=ns", "valid")
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.Header.Get("Content-Type")).To(Equal("text/event-stream"))
+
+		Expect(*lastSAR.Spec.ResourceAttributes).To(Equal(authorizationv1.ResourceAttributes{
+			Namespace: "ns",
+			Verb:      "watch",
+			Group:     "relocation.openshift.io",
+			Resource:  "clusterconfigs",
+		}))
+
+		broker.Publish(apischema.Event{Type: apischema.ImageBuilt, Namespace: "other", Name: "config"})
+		broker.Publish(apischema.Event{Type: apischema.ImageDownloaded, Namespace: "ns", Name: "config"})
+
+		reader := bufio.NewReader(resp.Body)
+		line, err := reader.ReadString('\n')
+		Expect(err).NotTo(HaveOccurred())
+		Expect(line).To(Equal("event: ImageDownloaded\n"))
+		line, err = reader.ReadString('\n')
+		Expect(err).NotTo(HaveOccurred())
+		Expect(line).To(HavePrefix("data: "))
+
+		var e apischema.Event
+		Expect(json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e)).To(Succeed())
+		Expect(e.Namespace).To(Equal("ns"))
+		Expect(e.Name).To(Equal("config"))
+	})
+
+	It("ends the stream when the broker is closed", func() {
+		resp := get(context.Background(), "", "valid")
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(lastSAR.Spec.ResourceAttributes.Namespace).To(BeEmpty())
+
+		broker.Close()
+		_, err := bufio.NewReader(resp.Body).ReadString('\n')
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("keeps streams open past the server write timeout", func() {
+		writeTimeout.Timeout = 100 * time.Millisecond
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		resp := get(ctx, "", "valid")
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		time.Sleep(300 * time.Millisecond)
+		broker.Publish(apischema.Event{Type: apischema.ImageDownloaded, Namespace: "ns", Name: "config"})
+		line, err := bufio.NewReader(resp.Body).ReadString('\n')
+		Expect(err).NotTo(HaveOccurred())
+		Expect(line).To(Equal("event: ImageDownloaded\n"))
+	})
+
+	It("rejects subscribers over the limit until a stream is closed", func() {
+		handler.MaxSubscribers = 1
+		ctx, cancel := context.WithCancel(context.Background())
+		first := get(ctx, "", "valid")
+		Expect(first.StatusCode).To(Equal(http.StatusOK))
+
+		resp := get(context.Background(), "", "valid")
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusServiceUnavailable))
+		Expect(resp.Header.Get("Retry-After")).NotTo(BeEmpty())
+
+		cancel()
+		first.Body.Close()
+		Eventually(func() int {
+			resp := get(context.Background(), "", "valid")
+			defer resp.Body.Close()
+			return resp.StatusCode
+		}).Should(Equal(http.StatusOK))
+	})
+
+	It("requires a valid token", func() {
+		resp := get(context.Background(), "", "")
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("forbids users without access", func() {
+		allowed = false
+		resp := get(context.Background(), "?namespace=ns", "valid")
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusForbidden))
+	})
+})
+
+var _ = Describe("PhaseEventHandler", func() {
+	It("publishes events for phase changes", func() {
+		broker := events.NewBroker()
+		ch, unsubscribe := broker.Subscribe("")
+		defer unsubscribe()
+		handler := PhaseEventHandler(broker)
+
+		config := func(phase relocationv1alpha1.ClusterConfigPhase) *relocationv1alpha1.ClusterConfig {
+			return &relocationv1alpha1.ClusterConfig{
+				ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "ns"},
+				Status:     relocationv1alpha1.ClusterConfigStatus{Phase: phase},
+			}
+		}
+
+		handler.OnUpdate(config(relocationv1alpha1.ClusterConfigPhaseImageAttached), config(relocationv1alpha1.ClusterConfigPhaseImageAttached))
+		Expect(ch).NotTo(Receive())
+
+		handler.OnUpdate(config(relocationv1alpha1.ClusterConfigPhaseImageReady), config(relocationv1alpha1.ClusterConfigPhaseImageAttached))
+		var e apischema.Event
+		Expect(ch).To(Receive(&e))
+		Expect(e.Type).To(Equal(apischema.ImageAttached))
+		Expect(e.Namespace).To(Equal("ns"))
+		Expect(e.Name).To(Equal("config"))
+
+		handler.OnUpdate(config(relocationv1alpha1.ClusterConfigPhaseImageAttached), config(relocationv1alpha1.ClusterConfigPhaseCompleted))
+		Expect(ch).To(Receive(&e))
+		Expect(e.Type).To(Equal(apischema.RelocationCompleted))
+	})
+})
@@ -0,0 +1,102 @@
+package apiserver
+
+import (
+	"net/http"
+	"regexp"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+	"github.com/carbonin/cluster-relocation-service/internal/apiauth"
+	"github.com/sirupsen/logrus"
+)
+
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get
+
+// KubeconfigHandler serves the admin kubeconfig reported by a relocated cluster
+// The secret is named in the ClusterConfig status which users able to update it could point at any secret in the
+// namespace, so the caller must also be allowed to get the secret itself
+type KubeconfigHandler struct {
+	Log        logrus.FieldLogger
+	Client     client.Reader
+	Authorizer *apiauth.Authorizer
+}
+
+var kubeconfigPathRegexp = regexp.MustCompile(`^/api/v1/clusterconfigs/(?P<namespace>[^/]+)/(?P<name>[^/]+)/kubeconfig$`)
+
+func (h *KubeconfigHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	match := kubeconfigPathRegexp.FindStringSubmatch(r.URL.Path)
+	if match == nil {
+		http.NotFound(w, r)
+		return
+	}
+	key := types.NamespacedName{Namespace: match[1], Name: match[2]}
+	log := h.Log.WithFields(logrus.Fields{"namespace": key.Namespace, "name": key.Name})
+
+	user := apiauth.UserFrom(r.Context())
+	if user == nil {
+		http.Error(w, "the request was not authenticated", http.StatusUnauthorized)
+		return
+	}
+	log = log.WithField("user", user.Username)
+
+	config := &relocationv1alpha1.ClusterConfig{}
+	if err := h.Client.Get(r.Context(), key, config); err != nil {
+		if errors.IsNotFound(err) {
+			http.NotFound(w, r)
+			return
+		}
+		log.WithError(err).Error("failed to get ClusterConfig")
+		http.Error(w, "failed to get ClusterConfig", http.StatusInternalServerError)
+		return
+	}
+	ref := config.Status.AdminKubeconfigRef
+	if ref == nil {
+		http.Error(w, "the relocated cluster has not reported a kubeconfig", http.StatusNotFound)
+		return
+	}
+
+	// checked before the secret is read so its existence isn't revealed either
+	err := h.Authorizer.Authorize(r.Context(), user, &authorizationv1.ResourceAttributes{
+		Namespace: key.Namespace,
+		Name:      ref.Name,
+		Verb:      "get",
+		Resource:  "secrets",
+	})
+	if err != nil {
+		apiauth.WriteError(w, log, err)
+		return
+	}
+
+	secret := &corev1.Secret{}
+	if err := h.Client.Get(r.Context(), types.NamespacedName{Namespace: key.Namespace, Name: ref.Name}, secret); err != nil {
+		if errors.IsNotFound(err) {
+			http.Error(w, "the reported kubeconfig secret does not exist", http.StatusNotFound)
+			return
+		}
+		log.WithError(err).Error("failed to get kubeconfig secret")
+		http.Error(w, "failed to get kubeconfig", http.StatusInternalServerError)
+		return
+	}
+	kubeconfig, ok := secret.Data[relocationv1alpha1.AdminKubeconfigKey]
+	if !ok {
+		http.Error(w, "the reported kubeconfig secret does not contain a kubeconfig", http.StatusNotFound)
+		return
+	}
+
+	log.Info("serving admin kubeconfig")
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Header().Set("Cache-Control", "no-store")
+	if _, err := w.Write(kubeconfig); err != nil {
+		log.WithError(err).Error("failed to write kubeconfig")
+	}
+}
@@ -0,0 +1,164 @@
+package apiserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+	"github.com/carbonin/cluster-relocation-service/internal/apiauth"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestAPIServer(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "API Server Suite")
+}
+
+var _ = Describe("KubeconfigHandler", func() {
+	var (
+		handler http.Handler
+		c       client.Client
+		sars    []authorizationv1.ResourceAttributes
+		allowed func(attrs *authorizationv1.ResourceAttributes) bool
+	)
+
+	const path = "/api/v1/clusterconfigs/test-namespace/test-config/kubeconfig"
+
+	BeforeEach(func() {
+		allowed = func(*authorizationv1.ResourceAttributes) bool { return true }
+		sars = nil
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(relocationv1alpha1.AddToScheme(scheme)).To(Succeed())
+
+		c = interceptor.NewClient(fake.NewClientBuilder().WithScheme(scheme).Build(), interceptor.Funcs{
+			Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+				switch o := obj.(type) {
+				case *authenticationv1.TokenReview:
+					if o.Spec.Token == "valid" {
+						o.Status.Authenticated = true
+						o.Status.User = authenticationv1.UserInfo{Username: "automation", Groups: []string{"system:authenticated"}}
+					}
+					return nil
+				case *authorizationv1.SubjectAccessReview:
+					Expect(o.Spec.User).To(Equal("automation"))
+					Expect(o.Spec.Groups).To(ConsistOf("system:authenticated"))
+					sars = append(sars, *o.Spec.ResourceAttributes)
+					o.Status.Allowed = allowed(o.Spec.ResourceAttributes)
+					return nil
+				}
+				return c.Create(ctx, obj, opts...)
+			},
+		})
+		handler = authorized(c, &KubeconfigHandler{Log: logrus.New(), Client: c, Authorizer: &apiauth.Authorizer{Client: c}})
+	})
+
+	request := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	createConfig := func(ref *corev1.LocalObjectReference) {
+		config := &relocationv1alpha1.ClusterConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-config", Namespace: "test-namespace"},
+		}
+		Expect(c.Create(context.Background(), config)).To(Succeed())
+		config.Status.AdminKubeconfigRef = ref
+		Expect(c.Update(context.Background(), config)).To(Succeed())
+	}
+
+	createSecret := func(data map[string][]byte) {
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "admin-kubeconfig", Namespace: "test-namespace"},
+			Data:       data,
+		}
+		Expect(c.Create(context.Background(), secret)).To(Succeed())
+	}
+
+	It("serves the reported kubeconfig", func() {
+		createConfig(&corev1.LocalObjectReference{Name: "admin-kubeconfig"})
+		createSecret(map[string][]byte{relocationv1alpha1.AdminKubeconfigKey: []byte("apiVersion: v1\nkind: Config\n")})
+
+		rec := request(http.MethodGet, path, "valid")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Body.String()).To(Equal("apiVersion: v1\nkind: Config\n"))
+		Expect(rec.Header().Get("Content-Type")).To(Equal("application/yaml"))
+
+		Expect(sars).To(Equal([]authorizationv1.ResourceAttributes{{
+			Namespace:   "test-namespace",
+			Name:        "test-config",
+			Verb:        "get",
+			Group:       "relocation.openshift.io",
+			Resource:    "clusterconfigs",
+			Subresource: "kubeconfig",
+		}, {
+			Namespace: "test-namespace",
+			Name:      "admin-kubeconfig",
+			Verb:      "get",
+			Resource:  "secrets",
+		}}))
+	})
+
+	It("forbids users who can't get the referenced secret", func() {
+		// the status may have been pointed at any secret in the namespace
+		createConfig(&corev1.LocalObjectReference{Name: "admin-kubeconfig"})
+		createSecret(map[string][]byte{relocationv1alpha1.AdminKubeconfigKey: []byte("apiVersion: v1\nkind: Config\n")})
+		allowed = func(attrs *authorizationv1.ResourceAttributes) bool { return attrs.Resource != "secrets" }
+
+		rec := request(http.MethodGet, path, "valid")
+		Expect(rec.Code).To(Equal(http.StatusForbidden))
+		Expect(rec.Body.String()).NotTo(ContainSubstring("kind: Config"))
+	})
+
+	It("requires a valid token", func() {
+		createConfig(&corev1.LocalObjectReference{Name: "admin-kubeconfig"})
+		Expect(request(http.MethodGet, path, "").Code).To(Equal(http.StatusUnauthorized))
+		Expect(request(http.MethodGet, path, "invalid").Code).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("forbids users without access", func() {
+		createConfig(&corev1.LocalObjectReference{Name: "admin-kubeconfig"})
+		allowed = func(*authorizationv1.ResourceAttributes) bool { return false }
+		Expect(request(http.MethodGet, path, "valid").Code).To(Equal(http.StatusForbidden))
+	})
+
+	It("returns not found before the kubeconfig is reported", func() {
+		createConfig(nil)
+		Expect(request(http.MethodGet, path, "valid").Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("returns not found when the secret is missing or incomplete", func() {
+		createConfig(&corev1.LocalObjectReference{Name: "admin-kubeconfig"})
+		Expect(request(http.MethodGet, path, "valid").Code).To(Equal(http.StatusNotFound))
+
+		createSecret(map[string][]byte{"other": []byte("data")})
+		Expect(request(http.MethodGet, path, "valid").Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("returns not found for missing configs and unknown paths", func() {
+		Expect(request(http.MethodGet, path, "valid").Code).To(Equal(http.StatusNotFound))
+		Expect(request(http.MethodGet, "/api/v1/clusterconfigs/test-namespace/test-config", "valid").Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("only accepts GET", func() {
+		Expect(request(http.MethodPost, path, "valid").Code).To(Equal(http.StatusMethodNotAllowed))
+	})
+})
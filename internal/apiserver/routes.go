@@ -0,0 +1,22 @@
+package apiserver
+
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/carbonin/cluster-relocation-service/internal/apiauth"
+)
+
+// clusterConfigs is the resource API endpoints are authorized against
+const clusterConfigs = "clusterconfigs"
+
+// Routes are the API endpoints and the access to ClusterConfigs users need for each
+// They must be served behind an apiauth.Middleware with these routes, the handlers don't authorize requests
+var Routes = []apiauth.Route{
+	{Method: http.MethodGet, Path: consoleLogPathRegexp, Verb: "get", Resource: clusterConfigs, Subresource: "consolelogs"},
+	{Method: http.MethodGet, Path: kubeconfigPathRegexp, Verb: "get", Resource: clusterConfigs, Subresource: "kubeconfig"},
+	{Method: http.MethodGet, Path: regexp.MustCompile(`^/api/v1/events$`), Verb: "watch", Resource: clusterConfigs},
+	{Method: http.MethodGet, Path: regexp.MustCompile(`^/api/v1/summary$`), Verb: "list", Resource: clusterConfigs},
+	// the self test writes to the data volume, so it takes access only administrators of all namespaces have
+	{Method: http.MethodPost, Path: regexp.MustCompile(`^/api/v1/selftest$`), Verb: "create", Resource: clusterConfigs, Subresource: "selftest", AllNamespaces: true},
+}
@@ -0,0 +1,106 @@
+package apiserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	"github.com/carbonin/cluster-relocation-service/internal/apiauth"
+)
+
+// authorized serves next behind the middleware with Routes, reviewing tokens and access with c
+func authorized(c client.Client, next http.Handler) http.Handler {
+	return &apiauth.Middleware{Log: logrus.New(), Authorizer: &apiauth.Authorizer{Client: c}, Routes: Routes, Next: next}
+}
+
+var _ = Describe("Routes", func() {
+	var (
+		handler http.Handler
+		lastSAR *authorizationv1.SubjectAccessReview
+		reached bool
+	)
+
+	BeforeEach(func() {
+		lastSAR = nil
+		reached = false
+		c := interceptor.NewClient(fake.NewClientBuilder().Build(), interceptor.Funcs{
+			Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+				switch o := obj.(type) {
+				case *authenticationv1.TokenReview:
+					o.Status.Authenticated = o.Spec.Token == "valid"
+					return nil
+				case *authorizationv1.SubjectAccessReview:
+					lastSAR = o
+					o.Status.Allowed = true
+					return nil
+				}
+				return c.Create(ctx, obj, opts...)
+			},
+		})
+		handler = authorized(c, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			reached = true
+		}))
+	})
+
+	request := func(method, path string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer valid")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	DescribeTable("authorizes each endpoint against ClusterConfigs",
+		func(path string, attrs authorizationv1.ResourceAttributes) {
+			Expect(request(http.MethodGet, path)).To(Equal(http.StatusOK))
+			Expect(reached).To(BeTrue())
+			Expect(lastSAR).NotTo(BeNil())
+			attrs.Group = "relocation.openshift.io"
+			attrs.Resource = "clusterconfigs"
+			Expect(*lastSAR.Spec.ResourceAttributes).To(Equal(attrs))
+		},
+		Entry("console log list", "/api/v1/clusterconfigs/site-1/config/consolelogs",
+			authorizationv1.ResourceAttributes{Namespace: "site-1", Name: "config", Verb: "get", Subresource: "consolelogs"}),
+		Entry("console log", "/api/v1/clusterconfigs/site-1/config/consolelogs/1700000000.log",
+			authorizationv1.ResourceAttributes{Namespace: "site-1", Name: "config", Verb: "get", Subresource: "consolelogs"}),
+		Entry("kubeconfig", "/api/v1/clusterconfigs/site-1/config/kubeconfig",
+			authorizationv1.ResourceAttributes{Namespace: "site-1", Name: "config", Verb: "get", Subresource: "kubeconfig"}),
+		Entry("events in a namespace", "/api/v1/events?namespace=site-1",
+			authorizationv1.ResourceAttributes{Namespace: "site-1", Verb: "watch"}),
+		Entry("events in all namespaces", "/api/v1/events",
+			authorizationv1.ResourceAttributes{Verb: "watch"}),
+		Entry("summary of a namespace", "/api/v1/summary?namespace=site-1",
+			authorizationv1.ResourceAttributes{Namespace: "site-1", Verb: "list"}),
+		Entry("summary of all namespaces", "/api/v1/summary",
+			authorizationv1.ResourceAttributes{Verb: "list"}),
+	)
+
+	It("authorizes the self test against all namespaces", func() {
+		Expect(request(http.MethodPost, "/api/v1/selftest?namespace=site-1")).To(Equal(http.StatusOK))
+		Expect(*lastSAR.Spec.ResourceAttributes).To(Equal(authorizationv1.ResourceAttributes{
+			Verb: "create", Group: "relocation.openshift.io", Resource: "clusterconfigs", Subresource: "selftest",
+		}))
+	})
+
+	DescribeTable("rejects requests without a route",
+		func(method, path string, status int) {
+			Expect(request(method, path)).To(Equal(status))
+			Expect(reached).To(BeFalse())
+			Expect(lastSAR).To(BeNil())
+		},
+		Entry("unknown endpoints", http.MethodGet, "/api/v1/clusterconfigs/site-1/config/manifest", http.StatusNotFound),
+		Entry("configs themselves", http.MethodGet, "/api/v1/clusterconfigs/site-1/config", http.StatusNotFound),
+		Entry("other versions", http.MethodGet, "/api/v2/summary", http.StatusNotFound),
+		Entry("writes", http.MethodDelete, "/api/v1/clusterconfigs/site-1/config/kubeconfig", http.StatusMethodNotAllowed),
+		Entry("self test reads", http.MethodGet, "/api/v1/selftest", http.StatusMethodNotAllowed),
+	)
+})
@@ -0,0 +1,135 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+
+	cro "github.com/RHsyseng/cluster-relocation-operator/api/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/carbonin/cluster-relocation-service/api/apischema"
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultTopReasons is the number of error reasons returned when the request doesn't set a limit
+	defaultTopReasons = 5
+	// maxTopReasons bounds the limit a request can set
+	maxTopReasons = 50
+)
+
+// problemStatus is the status of each condition type which means something is wrong with the ClusterConfig
+var problemStatus = map[string]metav1.ConditionStatus{
+	cro.ConditionTypeReconciled:                        metav1.ConditionFalse,
+	relocationv1alpha1.PayloadWithinSizeLimitCondition: metav1.ConditionFalse,
+	relocationv1alpha1.ImageReachableCondition:         metav1.ConditionFalse,
+	relocationv1alpha1.HostProvisioningFailedCondition: metav1.ConditionTrue,
+	relocationv1alpha1.HostErrorCondition:              metav1.ConditionTrue,
+	relocationv1alpha1.CertificatesValidCondition:      metav1.ConditionFalse,
+	relocationv1alpha1.ConsistentCondition:             metav1.ConditionFalse,
+}
+
+// phases are the phases counted in every summary, configs without a phase yet are counted as pending
+// Configs being installed are counted as ImageAttached as nothing is reported until the relocation completes
+var phases = []relocationv1alpha1.ClusterConfigPhase{
+	relocationv1alpha1.ClusterConfigPhasePending,
+	relocationv1alpha1.ClusterConfigPhaseImageReady,
+	relocationv1alpha1.ClusterConfigPhaseImageAttached,
+	relocationv1alpha1.ClusterConfigPhaseCompleted,
+	relocationv1alpha1.ClusterConfigPhaseFailed,
+	relocationv1alpha1.ClusterConfigPhaseAborted,
+}
+
+// Summarize counts configs by phase and returns the limit most common problems they report
+func Summarize(configs []relocationv1alpha1.ClusterConfig, limit int) *apischema.Summary {
+	s := &apischema.Summary{
+		Total:           len(configs),
+		Phases:          make(map[relocationv1alpha1.ClusterConfigPhase]int, len(phases)),
+		TopErrorReasons: []apischema.ReasonCount{},
+	}
+	for _, phase := range phases {
+		s.Phases[phase] = 0
+	}
+
+	counts := map[apischema.ReasonCount]int{}
+	for i := range configs {
+		phase := configs[i].Status.Phase
+		if phase == "" {
+			phase = relocationv1alpha1.ClusterConfigPhasePending
+		}
+		s.Phases[phase]++
+		for _, cond := range configs[i].Status.Conditions {
+			if status, ok := problemStatus[cond.Type]; ok && cond.Status == status {
+				counts[apischema.ReasonCount{Condition: cond.Type, Reason: cond.Reason}]++
+			}
+		}
+	}
+
+	for rc, count := range counts {
+		rc.Count = count
+		s.TopErrorReasons = append(s.TopErrorReasons, rc)
+	}
+	sort.Slice(s.TopErrorReasons, func(i, j int) bool {
+		a, b := s.TopErrorReasons[i], s.TopErrorReasons[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.Condition != b.Condition {
+			return a.Condition < b.Condition
+		}
+		return a.Reason < b.Reason
+	})
+	if len(s.TopErrorReasons) > limit {
+		s.TopErrorReasons = s.TopErrorReasons[:limit]
+	}
+	return s
+}
+
+// SummaryHandler serves counts of ClusterConfigs by phase and their most common problems
+// Configs in the requested namespace are summarized, or across all namespaces if none is given
+type SummaryHandler struct {
+	Log    logrus.FieldLogger
+	Client client.Reader
+}
+
+func (h *SummaryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	namespace := r.URL.Query().Get("namespace")
+	log := h.Log.WithField("namespace", namespace)
+
+	limit := defaultTopReasons
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 || parsed > maxTopReasons {
+			http.Error(w, "limit must be a number from 0 to "+strconv.Itoa(maxTopReasons), http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	configs := &relocationv1alpha1.ClusterConfigList{}
+	if err := h.Client.List(r.Context(), configs, client.InNamespace(namespace)); err != nil {
+		log.WithError(err).Error("failed to list ClusterConfigs")
+		http.Error(w, "failed to list ClusterConfigs", http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(Summarize(configs.Items, limit))
+	if err != nil {
+		log.WithError(err).Error("failed to marshal summary")
+		http.Error(w, "failed to marshal summary", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(data); err != nil {
+		log.WithError(err).Error("failed to write summary")
+	}
+}
@@ -0,0 +1,159 @@
+package apiserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	cro "github.com/RHsyseng/cluster-relocation-operator/api/v1beta1"
+	"github.com/carbonin/cluster-relocation-service/api/apischema"
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+var _ = Describe("Summarize", func() {
+	config := func(phase relocationv1alpha1.ClusterConfigPhase, conditions ...metav1.Condition) relocationv1alpha1.ClusterConfig {
+		return relocationv1alpha1.ClusterConfig{Status: relocationv1alpha1.ClusterConfigStatus{Phase: phase, Conditions: conditions}}
+	}
+	hostError := metav1.Condition{Type: relocationv1alpha1.HostErrorCondition, Status: metav1.ConditionTrue, Reason: relocationv1alpha1.HostErrorReportedReason}
+	noHostError := metav1.Condition{Type: relocationv1alpha1.HostErrorCondition, Status: metav1.ConditionFalse, Reason: relocationv1alpha1.NoHostErrorReason}
+	renderFailed := metav1.Condition{Type: cro.ConditionTypeReconciled, Status: metav1.ConditionFalse, Reason: relocationv1alpha1.ReconciliationFailedReason}
+
+	It("counts configs by phase", func() {
+		s := Summarize([]relocationv1alpha1.ClusterConfig{
+			config(""),
+			config(relocationv1alpha1.ClusterConfigPhasePending),
+			config(relocationv1alpha1.ClusterConfigPhaseImageAttached),
+			config(relocationv1alpha1.ClusterConfigPhaseCompleted),
+		}, defaultTopReasons)
+		Expect(s.Total).To(Equal(4))
+		Expect(s.Phases).To(Equal(map[relocationv1alpha1.ClusterConfigPhase]int{
+			relocationv1alpha1.ClusterConfigPhasePending:       2,
+			relocationv1alpha1.ClusterConfigPhaseImageReady:    0,
+			relocationv1alpha1.ClusterConfigPhaseImageAttached: 1,
+			relocationv1alpha1.ClusterConfigPhaseCompleted:     1,
+			relocationv1alpha1.ClusterConfigPhaseFailed:        0,
+			relocationv1alpha1.ClusterConfigPhaseAborted:       0,
+		}))
+		Expect(s.TopErrorReasons).To(BeEmpty())
+	})
+
+	It("returns the most common problems first", func() {
+		s := Summarize([]relocationv1alpha1.ClusterConfig{
+			config(relocationv1alpha1.ClusterConfigPhaseImageAttached, hostError),
+			config(relocationv1alpha1.ClusterConfigPhaseFailed, hostError, renderFailed),
+			config(relocationv1alpha1.ClusterConfigPhaseImageAttached, noHostError),
+			config(relocationv1alpha1.ClusterConfigPhaseImageAttached, hostError),
+		}, defaultTopReasons)
+		Expect(s.TopErrorReasons).To(Equal([]apischema.ReasonCount{
+			{Condition: relocationv1alpha1.HostErrorCondition, Reason: relocationv1alpha1.HostErrorReportedReason, Count: 3},
+			{Condition: cro.ConditionTypeReconciled, Reason: relocationv1alpha1.ReconciliationFailedReason, Count: 1},
+		}))
+
+		s = Summarize([]relocationv1alpha1.ClusterConfig{config("", hostError, renderFailed)}, 1)
+		Expect(s.TopErrorReasons).To(HaveLen(1))
+	})
+})
+
+var _ = Describe("SummaryHandler", func() {
+	var (
+		handler http.Handler
+		c       client.Client
+		lastSAR *authorizationv1.SubjectAccessReview
+		allowed bool
+	)
+
+	BeforeEach(func() {
+		allowed = true
+		lastSAR = nil
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(relocationv1alpha1.AddToScheme(scheme)).To(Succeed())
+
+		c = interceptor.NewClient(fake.NewClientBuilder().WithScheme(scheme).Build(), interceptor.Funcs{
+			Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+				switch o := obj.(type) {
+				case *authenticationv1.TokenReview:
+					if o.Spec.Token == "valid" {
+						o.Status.Authenticated = true
+						o.Status.User = authenticationv1.UserInfo{Username: "automation"}
+					}
+					return nil
+				case *authorizationv1.SubjectAccessReview:
+					lastSAR = o
+					o.Status.Allowed = allowed
+					return nil
+				}
+				return c.Create(ctx, obj, opts...)
+			},
+		})
+		handler = authorized(c, &SummaryHandler{Log: logrus.New(), Client: c})
+
+		for _, key := range []client.ObjectKey{{Namespace: "site-1", Name: "a"}, {Namespace: "site-1", Name: "b"}, {Namespace: "site-2", Name: "a"}} {
+			config := &relocationv1alpha1.ClusterConfig{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}}
+			config.Status.Phase = relocationv1alpha1.ClusterConfigPhaseImageAttached
+			Expect(c.Create(context.Background(), config)).To(Succeed())
+		}
+	})
+
+	request := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	summary := func(rec *httptest.ResponseRecorder) *apischema.Summary {
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Header().Get("Content-Type")).To(Equal("application/json"))
+		s := &apischema.Summary{}
+		Expect(json.Unmarshal(rec.Body.Bytes(), s)).To(Succeed())
+		return s
+	}
+
+	It("summarizes all namespaces for cluster wide users", func() {
+		s := summary(request(http.MethodGet, "/api/v1/summary", "valid"))
+		Expect(s.Total).To(Equal(3))
+		Expect(s.Phases[relocationv1alpha1.ClusterConfigPhaseImageAttached]).To(Equal(3))
+		Expect(*lastSAR.Spec.ResourceAttributes).To(Equal(authorizationv1.ResourceAttributes{
+			Verb:     "list",
+			Group:    "relocation.openshift.io",
+			Resource: "clusterconfigs",
+		}))
+	})
+
+	It("summarizes the requested namespace", func() {
+		s := summary(request(http.MethodGet, "/api/v1/summary?namespace=site-1", "valid"))
+		Expect(s.Total).To(Equal(2))
+		Expect(lastSAR.Spec.ResourceAttributes.Namespace).To(Equal("site-1"))
+	})
+
+	It("rejects invalid limits", func() {
+		Expect(request(http.MethodGet, "/api/v1/summary?limit=-1", "valid").Code).To(Equal(http.StatusBadRequest))
+		Expect(request(http.MethodGet, "/api/v1/summary?limit=many", "valid").Code).To(Equal(http.StatusBadRequest))
+	})
+
+	It("requires access to list ClusterConfigs", func() {
+		Expect(request(http.MethodGet, "/api/v1/summary", "").Code).To(Equal(http.StatusUnauthorized))
+		allowed = false
+		Expect(request(http.MethodGet, "/api/v1/summary", "valid").Code).To(Equal(http.StatusForbidden))
+	})
+
+	It("only accepts GET", func() {
+		Expect(request(http.MethodPost, "/api/v1/summary", "valid").Code).To(Equal(http.StatusMethodNotAllowed))
+	})
+})
@@ -0,0 +1,16 @@
+// Package datadir spreads ClusterConfig data across several volumes
+package datadir
+
+import "hash/fnv"
+
+// For returns the entry of dirs holding the configs in namespace, or an empty string if dirs is empty
+// Namespaces are assigned by hash so both the manager and the image server find the same directory,
+// which means dirs must not be reordered or resized once configs have been written
+func For(dirs []string, namespace string) string {
+	if len(dirs) == 0 {
+		return ""
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(namespace))
+	return dirs[h.Sum32()%uint32(len(dirs))]
+}
@@ -0,0 +1,38 @@
+package datadir
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestDataDir(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "DataDir Suite")
+}
+
+var _ = Describe("For", func() {
+	It("returns nothing without shards", func() {
+		Expect(For(nil, "namespace")).To(BeEmpty())
+	})
+
+	It("always returns the same shard for a namespace", func() {
+		dirs := []string{"/data-0", "/data-1", "/data-2"}
+		Expect(For(dirs, "site-1")).To(Equal(For(dirs, "site-1")))
+		Expect(For([]string{"/data-0"}, "site-1")).To(Equal("/data-0"))
+	})
+
+	It("spreads namespaces across shards", func() {
+		dirs := []string{"/data-0", "/data-1", "/data-2"}
+		counts := map[string]int{}
+		for i := 0; i < 300; i++ {
+			counts[For(dirs, fmt.Sprintf("site-%d", i))]++
+		}
+		Expect(counts).To(HaveLen(3))
+		for _, dir := range dirs {
+			Expect(counts[dir]).To(BeNumerically(">", 50), dir)
+		}
+	})
+})
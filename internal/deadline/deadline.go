@@ -0,0 +1,41 @@
+package deadline
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+type connKey struct{}
+
+// ConnContext stores the connection of each request in its context, it's meant to be used as http.Server.ConnContext
+func ConnContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connKey{}, c)
+}
+
+// WriteTimeout bounds the time to write each HTTP/1 response like http.Server.WriteTimeout does,
+// but lets handlers lift the bound with Clear. HTTP/2 connections are shared between requests so they
+// aren't bounded. The server must use ConnContext
+type WriteTimeout struct {
+	// Timeout is the time allowed to write a response, zero disables the timeout
+	Timeout time.Duration
+	Next    http.Handler
+}
+
+func (h *WriteTimeout) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if c, ok := r.Context().Value(connKey{}).(net.Conn); ok && h.Timeout > 0 && r.ProtoMajor == 1 {
+		_ = c.SetWriteDeadline(time.Now().Add(h.Timeout))
+	}
+	h.Next.ServeHTTP(w, r)
+}
+
+// Clear removes the write deadline WriteTimeout set on the connection serving r so a long lived
+// response isn't cut off
+func Clear(r *http.Request) error {
+	c, ok := r.Context().Value(connKey{}).(net.Conn)
+	if !ok || r.ProtoMajor != 1 {
+		return nil
+	}
+	return c.SetWriteDeadline(time.Time{})
+}
@@ -0,0 +1,65 @@
+package deadline
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestDeadline(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Deadline Suite")
+}
+
+var _ = Describe("WriteTimeout", func() {
+	var (
+		server *httptest.Server
+		lift   bool
+	)
+
+	BeforeEach(func() {
+		lift = false
+		slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if lift {
+				Expect(Clear(r)).To(Succeed())
+			}
+			w.Header().Set("Content-Length", "2")
+			_, _ = w.Write([]byte("a"))
+			w.(http.Flusher).Flush()
+			time.Sleep(300 * time.Millisecond)
+			_, _ = w.Write([]byte("b"))
+		})
+		server = httptest.NewUnstartedServer(&WriteTimeout{Timeout: 100 * time.Millisecond, Next: slow})
+		server.Config.ConnContext = ConnContext
+		server.Start()
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	read := func() (string, error) {
+		resp, err := server.Client().Get(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	It("cuts off responses written past the timeout", func() {
+		_, err := read()
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("lets handlers lift the deadline", func() {
+		lift = true
+		body, err := read()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(body).To(Equal("ab"))
+	})
+})
@@ -0,0 +1,146 @@
+package dedup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Store shares files with identical content between directories by hard linking them to a single
+// content addressed copy. Files linked into the store must only be replaced, never written in place.
+// The store directory must be on the same filesystem as the linked files.
+type Store struct {
+	Dir string
+}
+
+// LinkDir replaces every regular file under dir with a hard link to the stored copy of its content
+// The links are staged in a temporary directory next to dir so nothing else is ever written to dir
+func (s *Store) LinkDir(dir string) error {
+	if err := os.MkdirAll(s.Dir, 0700); err != nil {
+		return err
+	}
+	tmpDir, err := os.MkdirTemp(filepath.Dir(dir), ".dedup")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		return s.link(path, tmpDir)
+	})
+}
+
+func (s *Store) link(path, tmpDir string) error {
+	sum, err := hashFile(path)
+	if err != nil {
+		return err
+	}
+	blob := filepath.Join(s.Dir, sum)
+
+	// a concurrent Prune may remove the blob between the two steps so retry once
+	for attempt := 0; attempt < 2; attempt++ {
+		if same, err := sameFile(path, blob); err != nil || same {
+			return err
+		}
+
+		// no stored copy yet, the file becomes the stored copy
+		err := os.Link(path, blob)
+		if err == nil {
+			return nil
+		}
+		if !os.IsExist(err) {
+			return err
+		}
+
+		// replace the file with a link to the existing copy
+		tmp := filepath.Join(tmpDir, sum)
+		if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := os.Link(blob, tmp); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		return os.Rename(tmp, path)
+	}
+
+	return nil
+}
+
+// Prune removes stored copies which are no longer linked from any directory and returns the number removed
+func (s *Store) Prune() (int, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	removed := 0
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return removed, err
+		}
+		stat, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			return removed, errors.New("unable to determine file link count")
+		}
+		if stat.Nlink > 1 {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.Dir, e.Name())); err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+		removed++
+	}
+
+	return removed, nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// sameFile returns true if a and b are the same file, and false if either doesn't exist
+func sameFile(a, b string) (bool, error) {
+	aInfo, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+	bInfo, err := os.Stat(b)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return os.SameFile(aInfo, bInfo), nil
+}
@@ -0,0 +1,139 @@
+package dedup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestDedup(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Dedup Suite")
+}
+
+var _ = Describe("Store", func() {
+	var (
+		dataDir string
+		store   *Store
+	)
+
+	BeforeEach(func() {
+		var err error
+		dataDir, err = os.MkdirTemp("", "dedup_test")
+		Expect(err).NotTo(HaveOccurred())
+		store = &Store{Dir: filepath.Join(dataDir, "blobs")}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dataDir)).To(Succeed())
+	})
+
+	writeFiles := func(dir string, files map[string]string) {
+		ExpectWithOffset(1, os.MkdirAll(dir, 0700)).To(Succeed())
+		for name, content := range files {
+			ExpectWithOffset(1, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)).To(Succeed())
+		}
+	}
+
+	sameFile := func(a, b string) bool {
+		aInfo, err := os.Stat(a)
+		ExpectWithOffset(1, err).NotTo(HaveOccurred())
+		bInfo, err := os.Stat(b)
+		ExpectWithOffset(1, err).NotTo(HaveOccurred())
+		return os.SameFile(aInfo, bInfo)
+	}
+
+	It("links identical files across directories", func() {
+		one := filepath.Join(dataDir, "one")
+		two := filepath.Join(dataDir, "two")
+		writeFiles(one, map[string]string{"pull-secret.json": "secret", "config.json": "one"})
+		writeFiles(two, map[string]string{"pull-secret.json": "secret", "config.json": "two"})
+
+		Expect(store.LinkDir(one)).To(Succeed())
+		Expect(store.LinkDir(two)).To(Succeed())
+
+		Expect(sameFile(filepath.Join(one, "pull-secret.json"), filepath.Join(two, "pull-secret.json"))).To(BeTrue())
+		Expect(sameFile(filepath.Join(one, "config.json"), filepath.Join(two, "config.json"))).To(BeFalse())
+
+		content, err := os.ReadFile(filepath.Join(two, "pull-secret.json"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(content)).To(Equal("secret"))
+
+		entries, err := os.ReadDir(store.Dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(3))
+	})
+
+	It("is idempotent", func() {
+		dir := filepath.Join(dataDir, "one")
+		writeFiles(dir, map[string]string{"pull-secret.json": "secret"})
+
+		Expect(store.LinkDir(dir)).To(Succeed())
+		Expect(store.LinkDir(dir)).To(Succeed())
+
+		entries, err := os.ReadDir(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+	})
+
+	It("doesn't leave staged links behind", func() {
+		one := filepath.Join(dataDir, "one")
+		two := filepath.Join(dataDir, "two")
+		writeFiles(one, map[string]string{"pull-secret.json": "secret"})
+		writeFiles(two, map[string]string{"pull-secret.json": "secret"})
+
+		Expect(store.LinkDir(one)).To(Succeed())
+		Expect(store.LinkDir(two)).To(Succeed())
+
+		entries, err := os.ReadDir(two)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+		entries, err = os.ReadDir(dataDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(3))
+	})
+
+	It("prunes copies no longer referenced", func() {
+		one := filepath.Join(dataDir, "one")
+		two := filepath.Join(dataDir, "two")
+		writeFiles(one, map[string]string{"pull-secret.json": "secret"})
+		writeFiles(two, map[string]string{"pull-secret.json": "secret", "config.json": "two"})
+		Expect(store.LinkDir(one)).To(Succeed())
+		Expect(store.LinkDir(two)).To(Succeed())
+
+		Expect(os.RemoveAll(two)).To(Succeed())
+		removed, err := store.Prune()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(removed).To(Equal(1))
+
+		Expect(os.RemoveAll(one)).To(Succeed())
+		removed, err = store.Prune()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(removed).To(Equal(1))
+	})
+
+	It("relinks files after their stored copy is pruned", func() {
+		one := filepath.Join(dataDir, "one")
+		two := filepath.Join(dataDir, "two")
+		writeFiles(one, map[string]string{"pull-secret.json": "secret"})
+		Expect(store.LinkDir(one)).To(Succeed())
+		Expect(os.RemoveAll(one)).To(Succeed())
+		_, err := store.Prune()
+		Expect(err).NotTo(HaveOccurred())
+
+		writeFiles(two, map[string]string{"pull-secret.json": "secret"})
+		Expect(store.LinkDir(two)).To(Succeed())
+		entries, err := os.ReadDir(store.Dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+	})
+
+	It("succeeds pruning a missing store", func() {
+		removed, err := store.Prune()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(removed).To(BeZero())
+	})
+})
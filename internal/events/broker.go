@@ -0,0 +1,86 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/carbonin/cluster-relocation-service/api/apischema"
+)
+
+// subscriberBuffer is the number of events held for a subscriber before further events are dropped
+const subscriberBuffer = 100
+
+type subscriber struct {
+	namespace string
+	ch        chan apischema.Event
+}
+
+// Broker fans events out to subscribers
+// Publishing never blocks, events are dropped for subscribers that don't keep up
+// A nil broker discards all events
+type Broker struct {
+	mu          sync.Mutex
+	subscribers map[*subscriber]struct{}
+	closed      bool
+}
+
+// NewBroker returns a broker with no subscribers
+func NewBroker() *Broker {
+	return &Broker{subscribers: map[*subscriber]struct{}{}}
+}
+
+// Publish sends e to every subscriber watching its namespace
+func (b *Broker) Publish(e apischema.Event) {
+	if b == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.subscribers {
+		if s.namespace != "" && s.namespace != e.Namespace {
+			continue
+		}
+		select {
+		case s.ch <- e:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel receiving events in namespace, or all namespaces if it is empty
+// The returned function must be called to stop receiving events
+// The channel is closed once the subscription is stopped or the broker is closed
+func (b *Broker) Subscribe(namespace string) (<-chan apischema.Event, func()) {
+	s := &subscriber{namespace: namespace, ch: make(chan apischema.Event, subscriberBuffer)}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(s.ch)
+		return s.ch, func() {}
+	}
+	b.subscribers[s] = struct{}{}
+
+	return s.ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[s]; ok {
+			delete(b.subscribers, s)
+			close(s.ch)
+		}
+	}
+}
+
+// Close ends all subscriptions so streams can finish when shutting down
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for s := range b.subscribers {
+		close(s.ch)
+	}
+	b.subscribers = map[*subscriber]struct{}{}
+}
@@ -0,0 +1,76 @@
+package events
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/carbonin/cluster-relocation-service/api/apischema"
+)
+
+func TestEvents(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Events Suite")
+}
+
+var _ = Describe("Broker", func() {
+	var broker *Broker
+
+	BeforeEach(func() {
+		broker = NewBroker()
+	})
+
+	It("sends events to subscribers of the namespace", func() {
+		ns, unsubscribeNS := broker.Subscribe("ns")
+		defer unsubscribeNS()
+		other, unsubscribeOther := broker.Subscribe("other")
+		defer unsubscribeOther()
+		all, unsubscribeAll := broker.Subscribe("")
+		defer unsubscribeAll()
+
+		broker.Publish(apischema.Event{Type: apischema.ImageBuilt, Namespace: "ns", Name: "config"})
+
+		var e apischema.Event
+		Expect(ns).To(Receive(&e))
+		Expect(e.Type).To(Equal(apischema.ImageBuilt))
+		Expect(e.Name).To(Equal("config"))
+		Expect(e.Time.IsZero()).To(BeFalse())
+		Expect(all).To(Receive())
+		Expect(other).NotTo(Receive())
+	})
+
+	It("drops events for subscribers that don't keep up", func() {
+		ch, unsubscribe := broker.Subscribe("")
+		defer unsubscribe()
+
+		for i := 0; i < subscriberBuffer+10; i++ {
+			broker.Publish(apischema.Event{Type: apischema.ImageDownloaded, Namespace: "ns", Name: "config"})
+		}
+		Expect(ch).To(HaveLen(subscriberBuffer))
+	})
+
+	It("closes the channel when unsubscribed", func() {
+		ch, unsubscribe := broker.Subscribe("")
+		unsubscribe()
+		unsubscribe()
+		Expect(ch).To(BeClosed())
+
+		broker.Publish(apischema.Event{Type: apischema.ImageBuilt, Namespace: "ns", Name: "config"})
+	})
+
+	It("closes all subscriptions when closed", func() {
+		ch, unsubscribe := broker.Subscribe("ns")
+		broker.Close()
+		Expect(ch).To(BeClosed())
+		unsubscribe()
+
+		ch, _ = broker.Subscribe("ns")
+		Expect(ch).To(BeClosed())
+	})
+
+	It("discards events when nil", func() {
+		var b *Broker
+		Expect(func() { b.Publish(apischema.Event{Type: apischema.ImageBuilt}) }).NotTo(Panic())
+	})
+})
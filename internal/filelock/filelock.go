@@ -1,14 +1,34 @@
 package filelock
 
 import (
+	"context"
+	"errors"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/gofrs/flock"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 const lockFileName = "lock"
 
+// retryDelay is how often a held lock is tried again while waiting for it
+const retryDelay = 50 * time.Millisecond
+
+// WaitSeconds observes the time spent acquiring locks by lock mode and result
+// It must be registered by the binary exposing metrics
+var WaitSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "filelock_wait_seconds",
+	Help:    "Time spent waiting to acquire a data directory lock.",
+	Buckets: []float64{0.001, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30},
+}, []string{"mode", "result"})
+
+const (
+	modeRead  = "read"
+	modeWrite = "write"
+)
+
 func lockForDir(dir string) (*flock.Flock, error) {
 	p := filepath.Join(dir, lockFileName)
 	_, err := os.Stat(p)
@@ -23,40 +43,84 @@ func lockForDir(dir string) (*flock.Flock, error) {
 	return flock.New(p), nil
 }
 
-// WithWriteLock runs the given function while holding a write lock on the directory `dir`
-// It returns a bool indicating whether the lock was acquired and any error that occurred acquiring the lock or running the function
-func WithWriteLock(dir string, f func() error) (bool, error) {
-	lock, err := lockForDir(dir)
+// withLock runs f while holding a lock on dir, retrying a held lock until ctx is done
+// The lock is always tried at least once so an expired ctx behaves like a non-blocking attempt
+func withLock(ctx context.Context, dir string, mode string, f func() error) (bool, error) {
+	start := time.Now()
+	lock, err := acquire(ctx, dir, mode)
+	result := "acquired"
 	if err != nil {
-		return false, err
+		result = "error"
+	} else if lock == nil {
+		result = "timeout"
 	}
-	locked, err := lock.TryLock()
-	if err != nil {
+	WaitSeconds.WithLabelValues(mode, result).Observe(time.Since(start).Seconds())
+	if lock == nil {
 		return false, err
 	}
-	if !locked {
-		return false, nil
-	}
 	defer lock.Unlock()
 
 	return true, f()
 }
 
-// WithReadLock runs the given function while holding a read lock on the directory `dir`
-// It returns a bool indicating whether the lock was acquired and any error that occurred acquiring the lock or running the function
-func WithReadLock(dir string, f func() error) (bool, error) {
+// acquire returns the held lock for dir, or nil if it wasn't acquired before ctx expired
+func acquire(ctx context.Context, dir string, mode string) (*flock.Flock, error) {
 	lock, err := lockForDir(dir)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
-	locked, err := lock.TryRLock()
-	if err != nil {
-		return false, err
+	try := lock.TryLock
+	if mode == modeRead {
+		try = lock.TryRLock
 	}
-	if !locked {
-		return false, nil
+
+	for {
+		ok, err := try()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return lock, nil
+		}
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, nil
+			}
+			return nil, ctx.Err()
+		case <-time.After(retryDelay):
+		}
 	}
-	defer lock.Unlock()
+}
 
-	return true, f()
+// WithWriteLock runs the given function while holding a write lock on the directory `dir`
+// It returns a bool indicating whether the lock was acquired and any error that occurred acquiring the lock or running the function
+func WithWriteLock(dir string, f func() error) (bool, error) {
+	return withLock(expired(), dir, modeWrite, f)
+}
+
+// WithReadLock runs the given function while holding a read lock on the directory `dir`
+// It returns a bool indicating whether the lock was acquired and any error that occurred acquiring the lock or running the function
+func WithReadLock(dir string, f func() error) (bool, error) {
+	return withLock(expired(), dir, modeRead, f)
+}
+
+// WithWriteLockContext is WithWriteLock but waits for a held lock until the ctx deadline
+// Reaching the deadline returns false with no error, cancelling ctx returns the context error
+// A ctx that has already expired tries the lock once
+func WithWriteLockContext(ctx context.Context, dir string, f func() error) (bool, error) {
+	return withLock(ctx, dir, modeWrite, f)
+}
+
+// WithReadLockContext is WithReadLock but waits for a held lock until the ctx deadline
+// Reaching the deadline returns false with no error, cancelling ctx returns the context error
+func WithReadLockContext(ctx context.Context, dir string, f func() error) (bool, error) {
+	return withLock(ctx, dir, modeRead, f)
+}
+
+// expired returns a context which has already reached its deadline so locks are only tried once
+func expired() context.Context {
+	ctx, cancel := context.WithDeadline(context.Background(), time.Time{})
+	cancel()
+	return ctx
 }
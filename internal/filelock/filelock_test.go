@@ -1,12 +1,16 @@
 package filelock
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"testing"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 )
 
 var _ = Describe("WithWriteLock", func() {
@@ -79,6 +83,111 @@ var _ = Describe("WithWriteLock", func() {
 	})
 })
 
+var _ = Describe("WithWriteLockContext", func() {
+	var (
+		dir string
+	)
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "write_lock_context_test_data")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	It("waits for a held lock to be released", func() {
+		held := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			locked, err := WithReadLock(dir, func() error {
+				close(held)
+				time.Sleep(200 * time.Millisecond)
+				return nil
+			})
+			Expect(locked).To(BeTrue())
+			Expect(err).NotTo(HaveOccurred())
+		}()
+		<-held
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		locked, err := WithWriteLockContext(ctx, dir, func() error { return nil })
+		Expect(locked).To(BeTrue())
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("gives up at the deadline", func() {
+		c := make(chan int)
+
+		l1, err := WithWriteLock(dir, func() error {
+			go func() {
+				defer func() { c <- 1 }()
+				ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+				defer cancel()
+				start := time.Now()
+				l2, err := WithWriteLockContext(ctx, dir, func() error { return nil })
+				Expect(l2).To(BeFalse())
+				Expect(err).ToNot(HaveOccurred())
+				Expect(time.Since(start)).To(BeNumerically(">=", 100*time.Millisecond))
+			}()
+			<-c
+			return nil
+		})
+		Expect(l1).To(BeTrue())
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("returns the error when the context is cancelled", func() {
+		c := make(chan int)
+
+		l1, err := WithWriteLock(dir, func() error {
+			go func() {
+				defer func() { c <- 1 }()
+				ctx, cancel := context.WithCancel(context.Background())
+				time.AfterFunc(100*time.Millisecond, cancel)
+				l2, err := WithReadLockContext(ctx, dir, func() error { return nil })
+				Expect(l2).To(BeFalse())
+				Expect(err).To(MatchError(context.Canceled))
+			}()
+			<-c
+			return nil
+		})
+		Expect(l1).To(BeTrue())
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("tries once with an expired context", func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 0)
+		defer cancel()
+		locked, err := WithWriteLockContext(ctx, dir, func() error { return nil })
+		Expect(locked).To(BeTrue())
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("records the wait time", func() {
+		count := func(mode, result string) uint64 {
+			m := &dto.Metric{}
+			Expect(WaitSeconds.WithLabelValues(mode, result).(prometheus.Histogram).Write(m)).To(Succeed())
+			return m.GetHistogram().GetSampleCount()
+		}
+		before := count("write", "acquired")
+
+		_, err := WithWriteLock(dir, func() error { return nil })
+		Expect(err).NotTo(HaveOccurred())
+		Expect(count("write", "acquired")).To(Equal(before + 1))
+
+		before = count("read", "timeout")
+		_, err = WithWriteLock(dir, func() error {
+			_, err := WithReadLock(dir, func() error { return nil })
+			return err
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(count("read", "timeout")).To(Equal(before + 1))
+	})
+})
+
 var _ = Describe("WithReadLock", func() {
 	var (
 		dir string
@@ -0,0 +1,145 @@
+package filelock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofrs/flock"
+)
+
+const (
+	leaseFileName     = "instance-lease"
+	leaseLockFileName = "instance-lease.lock"
+)
+
+// ErrLeaseLost is returned when a write is attempted by an instance whose lease has been taken over
+var ErrLeaseLost = errors.New("instance lease is held by another instance")
+
+// ErrLeaseNotAcquired is returned when a write is attempted before the lease has been acquired
+var ErrLeaseNotAcquired = errors.New("instance lease has not been acquired yet")
+
+type leaseRecord struct {
+	Holder      string    `json:"holder"`
+	Generation  int64     `json:"generation"`
+	AcquireTime time.Time `json:"acquireTime"`
+}
+
+// Lease fences writes to a shared directory so that only the most recent instance to acquire it may write
+type Lease struct {
+	dir    string
+	holder string
+	// generation is zero until the lease is acquired, it is set once Acquire succeeds while writers may be checking it
+	generation atomic.Int64
+}
+
+// NewLease returns a lease for dir on behalf of holder which fails Check until Acquire is called
+// It lets writers share the lease before it is acquired, such as when it is only taken once leader election is won
+func NewLease(dir string, holder string) *Lease {
+	return &Lease{dir: dir, holder: holder}
+}
+
+// AcquireLease takes over the instance lease for dir on behalf of holder
+// Any previous holder will fail subsequent Check calls
+func AcquireLease(dir string, holder string) (*Lease, error) {
+	l := NewLease(dir, holder)
+	if err := l.Acquire(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Acquire takes over the instance lease, any previous holder will fail subsequent Check calls
+func (l *Lease) Acquire() error {
+	dir, holder := l.dir, l.holder
+	lock := flock.New(filepath.Join(dir, leaseLockFileName))
+	if err := lock.Lock(); err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	current, err := readLease(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	next := leaseRecord{
+		Holder:      holder,
+		Generation:  current.Generation + 1,
+		AcquireTime: time.Now(),
+	}
+	data, err := json.Marshal(next)
+	if err != nil {
+		return err
+	}
+
+	// write then rename so readers never see a partial record
+	tmp := filepath.Join(dir, leaseFileName+".tmp")
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, leaseFileName)); err != nil {
+		return err
+	}
+
+	l.generation.Store(next.Generation)
+	return nil
+}
+
+// Check returns ErrLeaseNotAcquired if the lease hasn't been acquired yet and ErrLeaseLost if another instance
+// has acquired it since this one
+func (l *Lease) Check() error {
+	generation := l.generation.Load()
+	if generation == 0 {
+		return ErrLeaseNotAcquired
+	}
+	current, err := readLease(l.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read instance lease: %w", err)
+	}
+	if current.Holder != l.holder || current.Generation != generation {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// Generation returns the fencing generation of the lease
+func (l *Lease) Generation() int64 {
+	return l.generation.Load()
+}
+
+func readLease(dir string) (leaseRecord, error) {
+	rec := leaseRecord{}
+	data, err := os.ReadFile(filepath.Join(dir, leaseFileName))
+	if err != nil {
+		return rec, err
+	}
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return rec, err
+	}
+	return rec, nil
+}
+
+// WithFencedWriteLock runs the given function while holding a write lock on the directory `dir`
+// only if lease is still held. A nil lease disables fencing.
+// It returns a bool indicating whether the lock was acquired and any error that occurred acquiring the lock or running the function
+func WithFencedWriteLock(dir string, lease *Lease, f func() error) (bool, error) {
+	return WithFencedWriteLockContext(expired(), dir, lease, f)
+}
+
+// WithFencedWriteLockContext is WithFencedWriteLock but waits for a held lock until the ctx deadline
+func WithFencedWriteLockContext(ctx context.Context, dir string, lease *Lease, f func() error) (bool, error) {
+	return WithWriteLockContext(ctx, dir, func() error {
+		if lease != nil {
+			if err := lease.Check(); err != nil {
+				return err
+			}
+		}
+		return f()
+	})
+}
@@ -0,0 +1,108 @@
+package filelock
+
+import (
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Lease", func() {
+	var (
+		dir string
+	)
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "lease_test_data")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	It("is valid after acquisition", func() {
+		lease, err := AcquireLease(dir, "pod-1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lease.Generation()).To(Equal(int64(1)))
+		Expect(lease.Check()).To(Succeed())
+	})
+
+	It("fences out the previous holder", func() {
+		old, err := AcquireLease(dir, "pod-1")
+		Expect(err).NotTo(HaveOccurred())
+		current, err := AcquireLease(dir, "pod-2")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(current.Generation()).To(Equal(int64(2)))
+
+		Expect(old.Check()).To(MatchError(ErrLeaseLost))
+		Expect(current.Check()).To(Succeed())
+	})
+
+	It("fences out a restarted instance with the same holder", func() {
+		old, err := AcquireLease(dir, "pod-1")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = AcquireLease(dir, "pod-1")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(old.Check()).To(MatchError(ErrLeaseLost))
+	})
+
+	It("fences writes until a new lease is acquired without disturbing the current holder", func() {
+		current, err := AcquireLease(dir, "pod-1")
+		Expect(err).NotTo(HaveOccurred())
+		standby := NewLease(dir, "pod-2")
+		Expect(standby.Check()).To(MatchError(ErrLeaseNotAcquired))
+		Expect(current.Check()).To(Succeed())
+
+		Expect(standby.Acquire()).To(Succeed())
+		Expect(standby.Check()).To(Succeed())
+		Expect(standby.Generation()).To(Equal(current.Generation() + 1))
+		Expect(current.Check()).To(MatchError(ErrLeaseLost))
+	})
+})
+
+var _ = Describe("WithFencedWriteLock", func() {
+	var (
+		dir string
+	)
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "fenced_lock_test_data")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	It("runs the function while the lease is held", func() {
+		lease, err := AcquireLease(dir, "pod-1")
+		Expect(err).NotTo(HaveOccurred())
+
+		ran := false
+		locked, err := WithFencedWriteLock(dir, lease, func() error { ran = true; return nil })
+		Expect(locked).To(BeTrue())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ran).To(BeTrue())
+	})
+
+	It("does not run the function once the lease is lost", func() {
+		lease, err := AcquireLease(dir, "pod-1")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = AcquireLease(dir, "pod-2")
+		Expect(err).NotTo(HaveOccurred())
+
+		ran := false
+		locked, err := WithFencedWriteLock(dir, lease, func() error { ran = true; return nil })
+		Expect(locked).To(BeTrue())
+		Expect(err).To(MatchError(ErrLeaseLost))
+		Expect(ran).To(BeFalse())
+	})
+
+	It("runs the function without a lease", func() {
+		locked, err := WithFencedWriteLock(dir, nil, func() error { return nil })
+		Expect(locked).To(BeTrue())
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
@@ -0,0 +1,118 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	configv1 "github.com/openshift/api/config/v1"
+	"golang.org/x/net/http/httpproxy"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// proxyName is the name of the cluster-wide Proxy configuration object
+	proxyName = "cluster"
+
+	// trustedCABundleNamespace and trustedCABundleName identify the config map the
+	// cluster network operator populates with the merged system and proxy trust bundle
+	trustedCABundleNamespace = "openshift-config-managed"
+	trustedCABundleName      = "trusted-ca-bundle"
+	trustedCABundleKey       = "ca-bundle.crt"
+
+	defaultTimeout = 30 * time.Second
+)
+
+// Factory creates http clients for outbound requests made from the hub
+// honoring the cluster-wide proxy and trusted CA bundle configuration
+type Factory struct {
+	// Reader is used to read the cluster Proxy and trusted CA bundle
+	// A non-caching reader should be used as these objects are not otherwise watched
+	Reader client.Reader
+}
+
+// Client returns an http client configured with the current cluster proxy settings and trust bundle
+// If the cluster has no Proxy object (e.g. not running on OpenShift) the proxy environment variables are used
+func (f *Factory) Client(ctx context.Context) (*http.Client, error) {
+	transport, err := f.Transport(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: transport, Timeout: defaultTimeout}, nil
+}
+
+// Transport returns an http transport configured with the current cluster proxy settings and trust bundle
+func (f *Factory) Transport(ctx context.Context) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	proxyFunc, err := f.proxyFunc(ctx)
+	if err != nil {
+		return nil, err
+	}
+	transport.Proxy = proxyFunc
+
+	pool, err := f.certPool(ctx)
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		RootCAs:    pool,
+	}
+
+	return transport, nil
+}
+
+func (f *Factory) proxyFunc(ctx context.Context) (func(*http.Request) (*url.URL, error), error) {
+	proxy := &configv1.Proxy{}
+	if err := f.Reader.Get(ctx, types.NamespacedName{Name: proxyName}, proxy); err != nil {
+		if errors.IsNotFound(err) || meta.IsNoMatchError(err) {
+			return http.ProxyFromEnvironment, nil
+		}
+		return nil, fmt.Errorf("failed to get cluster proxy: %w", err)
+	}
+
+	// status contains the values the cluster actually applies (including the computed noProxy list)
+	conf := &httpproxy.Config{
+		HTTPProxy:  proxy.Status.HTTPProxy,
+		HTTPSProxy: proxy.Status.HTTPSProxy,
+		NoProxy:    proxy.Status.NoProxy,
+	}
+	pf := conf.ProxyFunc()
+
+	return func(req *http.Request) (*url.URL, error) {
+		return pf(req.URL)
+	}, nil
+}
+
+func (f *Factory) certPool(ctx context.Context) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+
+	cm := &corev1.ConfigMap{}
+	key := types.NamespacedName{Name: trustedCABundleName, Namespace: trustedCABundleNamespace}
+	if err := f.Reader.Get(ctx, key, cm); err != nil {
+		if errors.IsNotFound(err) {
+			return pool, nil
+		}
+		return nil, fmt.Errorf("failed to get trusted CA bundle: %w", err)
+	}
+
+	if bundle, ok := cm.Data[trustedCABundleKey]; ok && bundle != "" {
+		if !pool.AppendCertsFromPEM([]byte(bundle)) {
+			return nil, fmt.Errorf("failed to parse certificates from %s/%s", trustedCABundleNamespace, trustedCABundleName)
+		}
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,128 @@
+package httpclient
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	configv1 "github.com/openshift/api/config/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestHTTPClient(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "HTTPClient Suite")
+}
+
+var _ = Describe("Factory", func() {
+	var (
+		c   client.Client
+		f   *Factory
+		ctx = context.Background()
+	)
+
+	BeforeEach(func() {
+		s := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(s)).To(Succeed())
+		Expect(configv1.AddToScheme(s)).To(Succeed())
+		c = fakeclient.NewClientBuilder().WithScheme(s).Build()
+		f = &Factory{Reader: c}
+	})
+
+	proxyFor := func(transport *http.Transport, rawURL string) string {
+		req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+		Expect(err).NotTo(HaveOccurred())
+		u, err := transport.Proxy(req)
+		Expect(err).NotTo(HaveOccurred())
+		if u == nil {
+			return ""
+		}
+		return u.String()
+	}
+
+	It("uses the cluster proxy status", func() {
+		proxy := &configv1.Proxy{
+			ObjectMeta: metav1.ObjectMeta{Name: "cluster"},
+			Status: configv1.ProxyStatus{
+				HTTPProxy:  "http://proxy.example.com:3128",
+				HTTPSProxy: "http://secure-proxy.example.com:3128",
+				NoProxy:    ".cluster.local,10.0.0.0/8",
+			},
+		}
+		Expect(c.Create(ctx, proxy)).To(Succeed())
+
+		transport, err := f.Transport(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(proxyFor(transport, "http://mirror.example.com/base.iso")).To(Equal("http://proxy.example.com:3128"))
+		Expect(proxyFor(transport, "https://mirror.example.com/base.iso")).To(Equal("http://secure-proxy.example.com:3128"))
+		Expect(proxyFor(transport, "https://svc.ns.svc.cluster.local/thing")).To(BeEmpty())
+		Expect(proxyFor(transport, "https://10.1.2.3/thing")).To(BeEmpty())
+	})
+
+	It("uses no proxy when the cluster proxy is empty", func() {
+		proxy := &configv1.Proxy{ObjectMeta: metav1.ObjectMeta{Name: "cluster"}}
+		Expect(c.Create(ctx, proxy)).To(Succeed())
+
+		transport, err := f.Transport(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(proxyFor(transport, "https://mirror.example.com/base.iso")).To(BeEmpty())
+	})
+
+	It("falls back to the environment when there is no cluster proxy", func() {
+		transport, err := f.Transport(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(transport.Proxy).NotTo(BeNil())
+	})
+
+	It("trusts the cluster CA bundle", func() {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "trusted-ca-bundle", Namespace: "openshift-config-managed"},
+			Data:       map[string]string{"ca-bundle.crt": string(certPEM)},
+		}
+		Expect(c.Create(ctx, cm)).To(Succeed())
+
+		httpClient, err := f.Client(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		resp, err := httpClient.Get(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+	})
+
+	It("does not trust unknown CAs", func() {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		httpClient, err := f.Client(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = httpClient.Get(server.URL)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("fails for an invalid CA bundle", func() {
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "trusted-ca-bundle", Namespace: "openshift-config-managed"},
+			Data:       map[string]string{"ca-bundle.crt": "not a cert"},
+		}
+		Expect(c.Create(ctx, cm)).To(Succeed())
+
+		_, err := f.Client(ctx)
+		Expect(err).To(HaveOccurred())
+	})
+})
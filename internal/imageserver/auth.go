@@ -0,0 +1,48 @@
+package imageserver
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+)
+
+// BasicAuth checks requests use the image credentials of the namespace the image is in
+type BasicAuth struct {
+	// Client reads the image credentials secrets, it should read from a cache as every image request is checked
+	Client client.Reader
+}
+
+// authorized returns true if r has the credentials stored in namespace's image credentials secret
+// Requests are never authorized for namespaces without credentials
+func (a *BasicAuth) authorized(ctx context.Context, r *http.Request, namespace string) (bool, error) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return false, nil
+	}
+
+	s := &corev1.Secret{}
+	key := types.NamespacedName{Name: relocationv1alpha1.ImageCredentialsSecretName, Namespace: namespace}
+	if err := a.Client.Get(ctx, key, s); err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	wantUser := s.Data[relocationv1alpha1.ImageCredentialsUsernameKey]
+	wantPassword := s.Data[relocationv1alpha1.ImageCredentialsPasswordKey]
+	if len(wantUser) == 0 || len(wantPassword) == 0 {
+		return false, nil
+	}
+
+	// compare both so the time taken doesn't reveal which is wrong
+	userMatch := subtle.ConstantTimeCompare([]byte(username), wantUser)
+	passwordMatch := subtle.ConstantTimeCompare([]byte(password), wantPassword)
+	return userMatch&passwordMatch == 1, nil
+}
@@ -0,0 +1,89 @@
+package imageserver
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+	"github.com/carbonin/cluster-relocation-service/internal/metrics"
+)
+
+// BuildStats describes an image built from the files of a config
+type BuildStats struct {
+	// Size is the size of the image in bytes
+	Size int64
+	// Files is the number of payload files in the image
+	Files int
+	// Duration is how long the image took to build, not counting waiting for the config to be written
+	Duration time.Duration
+}
+
+// BuildRecorder records images built for ClusterConfigs in the build metrics and the ClusterConfig status
+// All methods are safe to call on a nil recorder
+type BuildRecorder struct {
+	// Client patches the ClusterConfig status, nil only records the metrics
+	Client client.Client
+	Log    logrus.FieldLogger
+
+	mu sync.Mutex
+	// recorded is the payload key of the last build recorded for each ClusterConfig
+	recorded map[types.NamespacedName]string
+}
+
+// Record observes stats in the build metrics and sets the ImageBuild status of the ClusterConfig key
+// Only the first build of each payload is recorded so images built again for the same payload, for example when
+// they don't fit in the cache, don't patch the status on every download. Payloads without a key are always recorded
+// Failing to update the status doesn't fail the build so errors are only logged
+func (b *BuildRecorder) Record(ctx context.Context, key types.NamespacedName, payload string, stats BuildStats) {
+	if b == nil || !b.changed(key, payload) {
+		return
+	}
+	metrics.ImageBuildSize.Observe(float64(stats.Size))
+	metrics.ImageBuildDuration.Observe(stats.Duration.Seconds())
+	metrics.ImageBuildFiles.Observe(float64(stats.Files))
+	if b.Client == nil {
+		return
+	}
+
+	// a merge patch only sets the build so it doesn't need a read or conflict with the manager's status updates
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			"imageBuild": relocationv1alpha1.ImageBuildStatus{
+				Time:      metav1.Now(),
+				SizeBytes: stats.Size,
+				Duration:  metav1.Duration{Duration: stats.Duration},
+				FileCount: int32(stats.Files),
+			},
+		},
+	})
+	if err != nil {
+		b.Log.WithError(err).Error("failed to encode image build status")
+		return
+	}
+	config := &relocationv1alpha1.ClusterConfig{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}}
+	if err := b.Client.Status().Patch(ctx, config, client.RawPatch(types.MergePatchType, patch)); err != nil && !errors.IsNotFound(err) {
+		b.Log.WithError(err).WithFields(logrus.Fields{"namespace": key.Namespace, "name": key.Name}).Error("failed to record image build status")
+	}
+}
+
+// changed records payload as the last payload built for key and returns true if it differs from the previous one
+func (b *BuildRecorder) changed(key types.NamespacedName, payload string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if payload != "" && b.recorded[key] == payload {
+		return false
+	}
+	if b.recorded == nil {
+		b.recorded = map[types.NamespacedName]string{}
+	}
+	b.recorded[key] = payload
+	return true
+}
@@ -0,0 +1,131 @@
+package imageserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/carbonin/cluster-relocation-service/api/isoschema"
+	"github.com/sirupsen/logrus"
+)
+
+const cachedImageSuffix = ".iso"
+
+// ISOCache keeps built images by the hash of their payload manifest so identical payloads are only built once
+// Images are kept on disk so a restart doesn't require every image to be built again
+// A nil cache disables caching
+type ISOCache struct {
+	Log logrus.FieldLogger
+	Dir string
+	// MaxSize is the total size in bytes of the cached images before the oldest are removed, zero means no limit
+	MaxSize int64
+
+	mu sync.Mutex
+}
+
+// payloadKey returns the cache key for the payload in filesDir
+// An empty key is returned if the payload can't be identified by its content
+func payloadKey(filesDir string) string {
+	data, err := os.ReadFile(filepath.Join(filesDir, isoschema.ManifestFileName))
+	if err != nil {
+		return ""
+	}
+	m := &isoschema.Manifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return ""
+	}
+	// manifests written before checksums were recorded don't change with the content
+	for _, f := range m.Files {
+		if f.Checksum == "" {
+			return ""
+		}
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *ISOCache) path(key string) string {
+	return filepath.Join(c.Dir, key+cachedImageSuffix)
+}
+
+// Get returns the path to the cached image for key if there is one
+func (c *ISOCache) Get(key string) (string, bool) {
+	if c == nil || key == "" {
+		return "", false
+	}
+	p := c.path(key)
+	if _, err := os.Stat(p); err != nil {
+		return "", false
+	}
+	return p, true
+}
+
+// Put moves the image at isoPath into the cache under key and returns its new path
+// If the image can't be cached the original path is returned with false
+func (c *ISOCache) Put(key, isoPath string) (string, bool) {
+	if c == nil || key == "" {
+		return isoPath, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := os.MkdirAll(c.Dir, 0700); err != nil {
+		c.Log.WithError(err).Warn("failed to create image cache dir")
+		return isoPath, false
+	}
+	p := c.path(key)
+	if err := os.Rename(isoPath, p); err != nil {
+		c.Log.WithError(err).Warn("failed to cache image")
+		return isoPath, false
+	}
+	c.evict(p)
+	return p, true
+}
+
+// evict removes the oldest images until the cache is within MaxSize, the image at keep is never removed
+func (c *ISOCache) evict(keep string) {
+	if c.MaxSize <= 0 {
+		return
+	}
+	entries, err := os.ReadDir(c.Dir)
+	if err != nil {
+		c.Log.WithError(err).Warn("failed to read image cache dir")
+		return
+	}
+
+	var images []os.FileInfo
+	var total int64
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), cachedImageSuffix) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		images = append(images, info)
+		total += info.Size()
+	}
+	sort.Slice(images, func(i, j int) bool { return images[i].ModTime().Before(images[j].ModTime()) })
+
+	for _, info := range images {
+		if total <= c.MaxSize {
+			return
+		}
+		p := filepath.Join(c.Dir, info.Name())
+		if p == keep {
+			continue
+		}
+		// images being served remain readable until they are closed
+		if err := os.Remove(p); err != nil {
+			c.Log.WithError(err).Warnf("failed to remove cached image %s", info.Name())
+			continue
+		}
+		total -= info.Size()
+	}
+}
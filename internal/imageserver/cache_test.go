@@ -0,0 +1,190 @@
+package imageserver
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/carbonin/cluster-relocation-service/api/isoschema"
+)
+
+var _ = Describe("ISOCache", func() {
+	var (
+		dir   string
+		cache *ISOCache
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "iso_cache_test")
+		Expect(err).NotTo(HaveOccurred())
+		cache = &ISOCache{Log: logrus.New(), Dir: filepath.Join(dir, "cache")}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	image := func(name string, size int) string {
+		p := filepath.Join(dir, name)
+		Expect(os.WriteFile(p, make([]byte, size), 0600)).To(Succeed())
+		return p
+	}
+
+	It("returns cached images", func() {
+		_, ok := cache.Get("key")
+		Expect(ok).To(BeFalse())
+
+		p, ok := cache.Put("key", image("built", 10))
+		Expect(ok).To(BeTrue())
+		Expect(filepath.Join(dir, "built")).NotTo(BeAnExistingFile())
+
+		cached, ok := cache.Get("key")
+		Expect(ok).To(BeTrue())
+		Expect(cached).To(Equal(p))
+	})
+
+	It("removes the oldest images beyond the size limit", func() {
+		cache.MaxSize = 25
+		first, _ := cache.Put("first", image("first", 10))
+		Expect(os.Chtimes(first, time.Now().Add(-time.Hour), time.Now().Add(-time.Hour))).To(Succeed())
+		_, _ = cache.Put("second", image("second", 10))
+		_, ok := cache.Get("first")
+		Expect(ok).To(BeTrue())
+
+		_, _ = cache.Put("third", image("third", 10))
+		_, ok = cache.Get("first")
+		Expect(ok).To(BeFalse())
+		_, ok = cache.Get("second")
+		Expect(ok).To(BeTrue())
+		_, ok = cache.Get("third")
+		Expect(ok).To(BeTrue())
+	})
+
+	It("never removes the image just added", func() {
+		cache.MaxSize = 5
+		_, ok := cache.Put("big", image("big", 10))
+		Expect(ok).To(BeTrue())
+		_, ok = cache.Get("big")
+		Expect(ok).To(BeTrue())
+	})
+
+	It("does nothing when nil", func() {
+		var c *ISOCache
+		_, ok := c.Get("key")
+		Expect(ok).To(BeFalse())
+		p := image("built", 10)
+		cached, ok := c.Put("key", p)
+		Expect(ok).To(BeFalse())
+		Expect(cached).To(Equal(p))
+	})
+
+	Context("payloadKey", func() {
+		write := func(data string) {
+			w := isoschema.NewWriter(dir)
+			Expect(w.WriteObject(isoschema.PullSecretFileType, &corev1.Secret{StringData: map[string]string{"a": data}})).To(Succeed())
+			Expect(w.WriteManifest()).To(Succeed())
+		}
+
+		It("changes with the payload content", func() {
+			write("1")
+			first := payloadKey(dir)
+			Expect(first).NotTo(BeEmpty())
+			write("1")
+			Expect(payloadKey(dir)).To(Equal(first))
+			write("2")
+			Expect(payloadKey(dir)).NotTo(Equal(first))
+		})
+
+		It("is empty without a manifest identifying the content", func() {
+			Expect(payloadKey(dir)).To(BeEmpty())
+			Expect(os.WriteFile(filepath.Join(dir, isoschema.ManifestFileName), []byte(`{"version": "v1", "files": [{"type": "PullSecret", "path": "pull-secret-secret.json"}]}`), 0600)).To(Succeed())
+			Expect(payloadKey(dir)).To(BeEmpty())
+		})
+	})
+})
+
+var _ = Describe("ServeHTTP with a cache", func() {
+	var (
+		tempDir   string
+		handler   *Handler
+		configDir string
+		filesDir  string
+	)
+
+	BeforeEach(func() {
+		var err error
+		tempDir, err = os.MkdirTemp("", "imageserver_cache_test")
+		Expect(err).NotTo(HaveOccurred())
+		workDir := filepath.Join(tempDir, "workdir")
+		Expect(os.MkdirAll(workDir, 0700)).To(Succeed())
+		handler = &Handler{
+			Log:        logrus.New(),
+			WorkDir:    workDir,
+			ConfigsDir: filepath.Join(tempDir, "namespaces"),
+			Cache:      &ISOCache{Log: logrus.New(), Dir: filepath.Join(tempDir, "cache")},
+		}
+
+		configDir = filepath.Join(tempDir, "namespaces", "ns", "config")
+		filesDir = filepath.Join(configDir, "files")
+		Expect(os.MkdirAll(filesDir, 0700)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tempDir)).To(Succeed())
+	})
+
+	write := func(data string) {
+		w := isoschema.NewWriter(filesDir)
+		Expect(w.WriteObject(isoschema.PullSecretFileType, &corev1.Secret{StringData: map[string]string{"a": data}})).To(Succeed())
+		Expect(w.WriteManifest()).To(Succeed())
+	}
+
+	get := func() {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/images/%s/%s.iso", "ns", "config"), nil))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+	}
+
+	cached := func() []string {
+		entries, err := os.ReadDir(handler.Cache.Dir)
+		Expect(err).NotTo(HaveOccurred())
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		return names
+	}
+
+	It("builds each payload once", func() {
+		write("1")
+		get()
+		Expect(cached()).To(HaveLen(1))
+		first := cached()[0]
+		info, err := os.Stat(filepath.Join(handler.Cache.Dir, first))
+		Expect(err).NotTo(HaveOccurred())
+
+		get()
+		Expect(cached()).To(Equal([]string{first}))
+		again, err := os.Stat(filepath.Join(handler.Cache.Dir, first))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.SameFile(info, again)).To(BeTrue())
+
+		write("2")
+		get()
+		Expect(cached()).To(HaveLen(2))
+
+		// nothing is left in the work dir
+		entries, err := os.ReadDir(handler.WorkDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(BeEmpty())
+	})
+})
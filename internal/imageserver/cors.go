@@ -0,0 +1,52 @@
+package imageserver
+
+import (
+	"net/http"
+	"strings"
+)
+
+const allowedMethods = "GET, HEAD, OPTIONS"
+
+// CORS wraps next to allow cross-origin requests from the given origins
+// An origin of "*" allows requests from any origin
+type CORS struct {
+	AllowedOrigins []string
+	Next           http.Handler
+}
+
+func (c *CORS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	origin := r.Header.Get("Origin")
+	if origin == "" || !c.allowed(origin) {
+		c.Next.ServeHTTP(w, r)
+		return
+	}
+
+	h := w.Header()
+	h.Add("Vary", "Origin")
+	h.Set("Access-Control-Allow-Origin", origin)
+	// let tooling read the image size and modification time from HEAD requests
+	h.Set("Access-Control-Expose-Headers", "Content-Length, Content-Type, Last-Modified")
+
+	// preflight requests are answered here rather than by the wrapped handler
+	if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+		h.Set("Access-Control-Allow-Methods", allowedMethods)
+		if reqHeaders := r.Header.Get("Access-Control-Request-Headers"); reqHeaders != "" {
+			h.Set("Access-Control-Allow-Headers", reqHeaders)
+		}
+		h.Set("Access-Control-Max-Age", "3600")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	c.Next.ServeHTTP(w, r)
+}
+
+func (c *CORS) allowed(origin string) bool {
+	for _, o := range c.AllowedOrigins {
+		o = strings.TrimSpace(o)
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
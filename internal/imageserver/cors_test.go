@@ -0,0 +1,84 @@
+package imageserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CORS", func() {
+	var (
+		handler *CORS
+		called  bool
+	)
+
+	BeforeEach(func() {
+		called = false
+		handler = &CORS{
+			AllowedOrigins: []string{"https://console.example.com"},
+			Next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				w.WriteHeader(http.StatusOK)
+			}),
+		}
+	})
+
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	It("adds headers for allowed origins", func() {
+		req := httptest.NewRequest(http.MethodHead, "/images/ns/name.iso", nil)
+		req.Header.Set("Origin", "https://console.example.com")
+		rec := serve(req)
+
+		Expect(called).To(BeTrue())
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Header().Get("Access-Control-Allow-Origin")).To(Equal("https://console.example.com"))
+		Expect(rec.Header().Get("Access-Control-Expose-Headers")).To(ContainSubstring("Content-Length"))
+		Expect(rec.Header().Values("Vary")).To(ContainElement("Origin"))
+	})
+
+	It("does not add headers for other origins", func() {
+		req := httptest.NewRequest(http.MethodGet, "/images/ns/name.iso", nil)
+		req.Header.Set("Origin", "https://evil.example.com")
+		rec := serve(req)
+
+		Expect(called).To(BeTrue())
+		Expect(rec.Header().Get("Access-Control-Allow-Origin")).To(BeEmpty())
+	})
+
+	It("does not add headers for same-origin requests", func() {
+		rec := serve(httptest.NewRequest(http.MethodGet, "/images/ns/name.iso", nil))
+
+		Expect(called).To(BeTrue())
+		Expect(rec.Header().Get("Access-Control-Allow-Origin")).To(BeEmpty())
+	})
+
+	It("answers preflight requests without calling the wrapped handler", func() {
+		req := httptest.NewRequest(http.MethodOptions, "/images/ns/name.iso", nil)
+		req.Header.Set("Origin", "https://console.example.com")
+		req.Header.Set("Access-Control-Request-Method", http.MethodHead)
+		req.Header.Set("Access-Control-Request-Headers", "Authorization")
+		rec := serve(req)
+
+		Expect(called).To(BeFalse())
+		Expect(rec.Code).To(Equal(http.StatusNoContent))
+		Expect(rec.Header().Get("Access-Control-Allow-Origin")).To(Equal("https://console.example.com"))
+		Expect(rec.Header().Get("Access-Control-Allow-Methods")).To(Equal("GET, HEAD, OPTIONS"))
+		Expect(rec.Header().Get("Access-Control-Allow-Headers")).To(Equal("Authorization"))
+	})
+
+	It("allows any origin with a wildcard", func() {
+		handler.AllowedOrigins = []string{"*"}
+		req := httptest.NewRequest(http.MethodGet, "/images/ns/name.iso", nil)
+		req.Header.Set("Origin", "https://tools.example.com")
+		rec := serve(req)
+
+		Expect(rec.Header().Get("Access-Control-Allow-Origin")).To(Equal("https://tools.example.com"))
+	})
+})
@@ -1,6 +1,8 @@
 package imageserver
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
@@ -9,8 +11,19 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
 
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/carbonin/cluster-relocation-service/api/apischema"
+	"github.com/carbonin/cluster-relocation-service/api/isoschema"
+	"github.com/carbonin/cluster-relocation-service/internal/datadir"
+	"github.com/carbonin/cluster-relocation-service/internal/events"
 	"github.com/carbonin/cluster-relocation-service/internal/filelock"
+	"github.com/carbonin/cluster-relocation-service/internal/metrics"
+	"github.com/carbonin/cluster-relocation-service/internal/tracing"
 	"github.com/diskfs/go-diskfs"
 	"github.com/diskfs/go-diskfs/disk"
 	"github.com/diskfs/go-diskfs/filesystem"
@@ -22,11 +35,67 @@ type Handler struct {
 	Log        logrus.FieldLogger
 	WorkDir    string
 	ConfigsDir string
+	// ConfigsDirShards, if set, hold the configs instead of ConfigsDir
+	// They must be in the same order as the manager's data dir shards
+	ConfigsDirShards []string
+	// Metrics records per-ClusterConfig image size and download samples
+	Metrics *metrics.ClusterConfigCollector
+	// LockTimeout is how long to wait for the manager to finish writing a config before failing the request
+	LockTimeout time.Duration
+	// Cache keeps built images for reuse by identical payloads, nil builds an image for every request
+	Cache *ISOCache
+	// Events receives image lifecycle events, nil discards them
+	Events *events.Broker
+	// Auth, if set, requires requests to use the image credentials of the config namespace
+	Auth *BasicAuth
+	// Stream generates images into the responses from the files of each config instead of building them in WorkDir,
+	// trading CPU for disk on small volumes. Cache isn't used for streamed images
+	Stream bool
+	// Builds records each image built in the ClusterConfig status and build metrics, nil records nothing
+	Builds *BuildRecorder
+
+	mu sync.Mutex
+	// streamed is the payload key of the last image streamed for each config
+	streamed map[types.NamespacedName]string
+}
+
+// configsDir returns the directory holding the configs in namespace
+func (h *Handler) configsDir(namespace string) string {
+	if dir := datadir.For(h.ConfigsDirShards, namespace); dir != "" {
+		return dir
+	}
+	return h.ConfigsDir
+}
+
+// PruneMetrics removes the samples of configs whose directory was removed every interval until ctx is done
+// The image server doesn't see ClusterConfig deletions so the manager removing the directory is the signal
+func (h *Handler) PruneMetrics(ctx context.Context, interval time.Duration) {
+	wait.UntilWithContext(ctx, func(context.Context) {
+		h.Metrics.Prune(func(key types.NamespacedName) bool {
+			_, err := os.Stat(filepath.Join(h.configsDir(key.Namespace), key.Namespace, key.Name))
+			return !errors.Is(err, fs.ErrNotExist)
+		})
+	}, interval)
 }
 
+// errLockTimeout is returned when a config is being written for longer than the lock timeout
+var errLockTimeout = errors.New("timed out waiting for config file lock")
+
 var pathRegexp = regexp.MustCompile(`^/images/(.+)/(.+)\.iso$`)
 
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodOptions:
+		w.Header().Set("Allow", allowedMethods)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		w.Header().Set("Allow", allowedMethods)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
 	match := pathRegexp.FindStringSubmatch(r.URL.Path)
 	if match == nil || len(match) != 3 {
 		h.Log.Errorf("failed to parse image path '%s'\n", r.URL.Path)
@@ -36,57 +105,186 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	namespace := match[1]
 	name := match[2]
-	configDir := filepath.Join(h.ConfigsDir, namespace, name)
+	if h.Auth != nil {
+		ok, err := h.Auth.authorized(r.Context(), r, namespace)
+		if err != nil {
+			h.Log.WithError(err).Error("failed to check image credentials")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="images", charset="UTF-8"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+	configDir := filepath.Join(h.configsDir(namespace), namespace, name)
 	filesDir := filepath.Join(configDir, "files")
-	if _, err := os.Stat(configDir); err != nil {
-		h.Log.WithError(err).Error("failed to stat config dir")
+	// the files dir is removed if the config can't currently be served
+	if _, err := os.Stat(filesDir); err != nil {
+		h.Log.WithError(err).Error("failed to stat config files dir")
 		http.NotFound(w, r)
 		return
 	}
 	h.Log.Infof("Serving image for ClusterConfig %s/%s", namespace, name)
 
-	isoWorkDir, err := os.MkdirTemp(h.WorkDir, "build")
+	key := types.NamespacedName{Namespace: namespace, Name: name}
+	if h.Stream {
+		h.serveStream(w, r, key, configDir, filesDir)
+		return
+	}
+	ctx, span := tracing.Start(tracing.ExtractHTTP(r), "BuildISO", tracing.ClusterConfigAttributes(namespace, name)...)
+	outPath, cleanup, err := h.image(ctx, key, configDir, filesDir, r.Method == http.MethodGet)
+	tracing.End(span, err)
 	if err != nil {
-		h.Log.WithError(err).Error("failed to create iso work dir")
-		w.WriteHeader(http.StatusInternalServerError)
+		h.buildFailed(w, err)
 		return
 	}
+	defer cleanup()
+
+	if info, err := os.Stat(outPath); err == nil {
+		h.Metrics.SetImageSize(key, info.Size())
+	}
+
+	http.ServeFile(w, r, outPath)
+	if r.Method == http.MethodGet {
+		h.downloaded(r, key)
+	}
+}
+
+// buildFailed responds to a request for an image which couldn't be built
+func (h *Handler) buildFailed(w http.ResponseWriter, err error) {
+	if errors.Is(err, errLockTimeout) {
+		h.Log.WithError(err).Warn("config is being updated")
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, "image is being updated, retry later", http.StatusServiceUnavailable)
+		return
+	}
+	h.Log.WithError(err).Error("failed to build iso")
+	w.WriteHeader(http.StatusInternalServerError)
+}
+
+// downloaded records a served image
+func (h *Handler) downloaded(r *http.Request, key types.NamespacedName) {
+	h.Metrics.SetLastDownload(key, time.Now())
+	h.Events.Publish(apischema.Event{Type: apischema.ImageDownloaded, Namespace: key.Namespace, Name: key.Name, Message: fmt.Sprintf("image downloaded by %s", r.RemoteAddr)})
+}
+
+// image returns the path to an iso for the files in filesDir, using a cached image of the same payload if there is one
+// A built image is only recorded if record is set, as HEAD requests don't download it
+// The returned function must be called once the image has been served
+func (h *Handler) image(ctx context.Context, key types.NamespacedName, configDir, filesDir string, record bool) (string, func(), error) {
+	if h.Cache != nil {
+		var payload string
+		lockCtx, cancel := context.WithTimeout(ctx, h.LockTimeout)
+		defer cancel()
+		locked, err := filelock.WithReadLockContext(lockCtx, configDir, func() error {
+			payload = payloadKey(filesDir)
+			return nil
+		})
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to acquire file lock: %w", err)
+		}
+		if !locked {
+			return "", nil, errLockTimeout
+		}
+		if p, ok := h.Cache.Get(payload); ok {
+			return p, func() {}, nil
+		}
+	}
+
+	iso, err := h.buildISO(ctx, configDir, filesDir)
+	if err != nil {
+		return "", nil, err
+	}
+	h.Events.Publish(apischema.Event{Type: apischema.ImageBuilt, Namespace: key.Namespace, Name: key.Name})
+	if record {
+		h.Builds.Record(ctx, key, iso.Key, iso.Stats)
+	}
+	if p, ok := h.Cache.Put(iso.Key, iso.Path); ok {
+		return p, func() {}, nil
+	}
+	return iso.Path, func() { os.Remove(iso.Path) }, nil
+}
+
+// buildISO creates an iso from the files in filesDir
+// The caller is responsible for removing the file
+func (h *Handler) buildISO(ctx context.Context, configDir, filesDir string) (*BuiltISO, error) {
+	return BuildISO(ctx, h.WorkDir, configDir, filesDir, h.LockTimeout)
+}
+
+// BuiltISO is an image built on disk by BuildISO
+type BuiltISO struct {
+	// Path is the image file
+	Path string
+	// Key is the cache key of the payload the image was built from
+	Key   string
+	Stats BuildStats
+}
+
+// BuildISO creates an iso in workDir from the files in filesDir, waiting up to lockTimeout for the config in
+// configDir to be written. The caller is responsible for removing the file
+func BuildISO(ctx context.Context, workDir, configDir, filesDir string, lockTimeout time.Duration) (*BuiltISO, error) {
+	isoWorkDir, err := os.MkdirTemp(workDir, "build")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create iso work dir: %w", err)
+	}
 	// if anything fails remove the workdir, if create succeeds it will remove the workdir so this will be a noop
 	defer os.RemoveAll(isoWorkDir)
 
-	// TODO: carbonin improve this to wait for some timout (use ctx?) instead of erroring on a lock failure immediately
-	locked, err := filelock.WithReadLock(configDir, func() error {
-		return copyDir(isoWorkDir, filesDir)
+	lockCtx, cancel := context.WithTimeout(ctx, lockTimeout)
+	defer cancel()
+	iso := &BuiltISO{}
+	// the build is timed from when the lock is held so waiting for the manager isn't counted
+	var start time.Time
+	locked, err := filelock.WithReadLockContext(lockCtx, configDir, func() error {
+		start = time.Now()
+		// the key is taken with the copy so it always matches the image content
+		iso.Key = payloadKey(filesDir)
+		var err error
+		iso.Stats.Files, err = copyDir(isoWorkDir, filesDir)
+		return err
 	})
 	if err != nil {
-		h.Log.WithError(err).Error("failed to acquire file lock")
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+		return nil, fmt.Errorf("failed to acquire file lock: %w", err)
 	}
 	if !locked {
-		h.Log.Error("failed to acquire file lock")
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+		return nil, errLockTimeout
 	}
 
-	outPath, err := tempFileName(h.WorkDir)
+	iso.Path, err = tempFileName(workDir)
 	if err != nil {
-		h.Log.WithError(err).Error("failed to create iso output file")
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+		return nil, fmt.Errorf("failed to create iso output file: %w", err)
 	}
-	if err := create(outPath, isoWorkDir, "relocation-config"); err != nil {
-		h.Log.WithError(err).Error("failed to create iso")
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+	if err := create(iso.Path, isoWorkDir, volumeLabel(isoWorkDir)); err != nil {
+		os.Remove(iso.Path)
+		return nil, fmt.Errorf("failed to create iso: %w", err)
 	}
-	defer os.Remove(outPath)
+	info, err := os.Stat(iso.Path)
+	if err != nil {
+		os.Remove(iso.Path)
+		return nil, fmt.Errorf("failed to stat iso: %w", err)
+	}
+	iso.Stats.Size = info.Size()
+	iso.Stats.Duration = time.Since(start)
 
-	http.ServeFile(w, r, outPath)
+	return iso, nil
+}
+
+// volumeLabel returns the volume label recorded in the manifest in dir
+// Content without a readable manifest is served on the default label
+func volumeLabel(dir string) string {
+	r, err := isoschema.NewReader(os.DirFS(dir))
+	if err != nil {
+		return isoschema.VolumeLabel
+	}
+	return r.Manifest().Label()
 }
 
-func copyDir(dst, src string) error {
-	return filepath.Walk(src, func(path string, info fs.FileInfo, err error) error {
+// copyDir copies the files in src to dst and returns the number of files copied
+func copyDir(dst, src string) (int, error) {
+	files := 0
+	err := filepath.Walk(src, func(path string, info fs.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -96,6 +294,7 @@ func copyDir(dst, src string) error {
 		if info.IsDir() {
 			return os.MkdirAll(targetPath, info.Mode())
 		}
+		files++
 
 		dest, err := os.OpenFile(targetPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, info.Mode())
 		if err != nil {
@@ -112,6 +311,7 @@ func copyDir(dst, src string) error {
 		_, err = io.Copy(dest, src)
 		return err
 	})
+	return files, err
 }
 
 func tempFileName(dir string) (string, error) {
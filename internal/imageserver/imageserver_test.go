@@ -1,6 +1,7 @@
 package imageserver
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -8,12 +9,28 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/carbonin/cluster-relocation-service/api/apischema"
+	"github.com/carbonin/cluster-relocation-service/api/isoschema"
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+	"github.com/carbonin/cluster-relocation-service/internal/datadir"
+	"github.com/carbonin/cluster-relocation-service/internal/events"
+	"github.com/carbonin/cluster-relocation-service/internal/filelock"
+	"github.com/carbonin/cluster-relocation-service/internal/metrics"
 	"github.com/diskfs/go-diskfs"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
 func TestImageServer(t *testing.T) {
@@ -25,6 +42,7 @@ var _ = Describe("ServeHttp", func() {
 	var (
 		server *httptest.Server
 		client *http.Client
+		broker *events.Broker
 
 		tempDir    string
 		workDir    string
@@ -45,10 +63,12 @@ var _ = Describe("ServeHttp", func() {
 		Expect(os.MkdirAll(configsDir, 0700)).To(Succeed())
 
 		// create http server
+		broker = events.NewBroker()
 		s := &Handler{
 			Log:        logrus.New(),
 			WorkDir:    workDir,
 			ConfigsDir: configsDir,
+			Events:     broker,
 		}
 		server = httptest.NewServer(s)
 		client = server.Client()
@@ -82,6 +102,17 @@ var _ = Describe("ServeHttp", func() {
 		Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
 	})
 
+	It("fails for configs without rendered files", func() {
+		Expect(os.RemoveAll(filepath.Join(configsDir, namespace, name, "files"))).To(Succeed())
+
+		url, err := url.JoinPath(server.URL, fmt.Sprintf("images/%s/%s.iso", namespace, name))
+		Expect(err).NotTo(HaveOccurred())
+		resp, err := client.Get(url)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+	})
+
 	It("contains the correct content for existing configs", func() {
 		url, err := url.JoinPath(server.URL, fmt.Sprintf("images/%s/%s.iso", namespace, name))
 		Expect(err).NotTo(HaveOccurred())
@@ -114,4 +145,447 @@ var _ = Describe("ServeHttp", func() {
 		Expect(err).NotTo(HaveOccurred())
 		Expect(content).To(Equal([]byte("content2")))
 	})
+
+	It("uses the volume label from the manifest", func() {
+		openLabel := func() string {
+			url, err := url.JoinPath(server.URL, fmt.Sprintf("images/%s/%s.iso", namespace, name))
+			Expect(err).NotTo(HaveOccurred())
+			resp, err := client.Get(url)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+			f, err := os.CreateTemp("", "imageserver_test_iso")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.Remove(f.Name())
+			_, err = io.Copy(f, resp.Body)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(f.Close()).To(Succeed())
+
+			d, err := diskfs.Open(f.Name(), diskfs.WithOpenMode(diskfs.ReadOnly))
+			Expect(err).NotTo(HaveOccurred())
+			defer d.File.Close()
+			fs, err := d.GetFilesystem(0)
+			Expect(err).NotTo(HaveOccurred())
+			return strings.TrimRight(fs.Label(), "\x00 ")
+		}
+
+		Expect(openLabel()).To(Equal(isoschema.VolumeLabel))
+
+		w := isoschema.NewWriter(filepath.Join(configsDir, namespace, name, "files"))
+		Expect(w.SetVolume("site-1-config", map[string]string{"site": "site-1"})).To(Succeed())
+		Expect(w.WriteManifest()).To(Succeed())
+		Expect(openLabel()).To(Equal("site-1-config"))
+	})
+
+	It("prunes the metrics of configs whose directory was removed", func() {
+		collector := metrics.NewClusterConfigCollector(0)
+		registry := prometheus.NewRegistry()
+		Expect(registry.Register(collector)).To(Succeed())
+		collector.SetImageSize(types.NamespacedName{Namespace: namespace, Name: name}, 1)
+		collector.SetImageSize(types.NamespacedName{Namespace: namespace, Name: "deleted"}, 1)
+		samples := func() int {
+			families, err := registry.Gather()
+			Expect(err).NotTo(HaveOccurred())
+			for _, f := range families {
+				if f.GetName() == "clusterconfig_image_size_bytes" {
+					return len(f.GetMetric())
+				}
+			}
+			return 0
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		h := &Handler{ConfigsDir: configsDir, Metrics: collector}
+		go h.PruneMetrics(ctx, 10*time.Millisecond)
+		Eventually(samples).Should(Equal(1))
+		Consistently(samples, 50*time.Millisecond).Should(Equal(1))
+	})
+
+	It("publishes events when the image is built and downloaded", func() {
+		ch, unsubscribe := broker.Subscribe(namespace)
+		defer unsubscribe()
+
+		url, err := url.JoinPath(server.URL, fmt.Sprintf("images/%s/%s.iso", namespace, name))
+		Expect(err).NotTo(HaveOccurred())
+		resp, err := client.Get(url)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		_, err = io.Copy(io.Discard, resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Body.Close()).To(Succeed())
+
+		var e apischema.Event
+		Eventually(ch).Should(Receive(&e))
+		Expect(e.Type).To(Equal(apischema.ImageBuilt))
+		Expect(e.Namespace).To(Equal(namespace))
+		Expect(e.Name).To(Equal(name))
+		Eventually(ch).Should(Receive(&e))
+		Expect(e.Type).To(Equal(apischema.ImageDownloaded))
+		Expect(e.Message).To(HavePrefix("image downloaded by "))
+	})
+
+	It("serves configs from the namespace's shard", func() {
+		shards := []string{filepath.Join(tempDir, "shard-0"), filepath.Join(tempDir, "shard-1")}
+		shard := datadir.For(shards, namespace)
+		Expect(os.MkdirAll(shard, 0700)).To(Succeed())
+		Expect(os.Rename(filepath.Join(configsDir, namespace), filepath.Join(shard, namespace))).To(Succeed())
+
+		server.Close()
+		server = httptest.NewServer(&Handler{
+			Log:              logrus.New(),
+			WorkDir:          workDir,
+			ConfigsDir:       configsDir,
+			ConfigsDirShards: shards,
+		})
+		client = server.Client()
+
+		url, err := url.JoinPath(server.URL, fmt.Sprintf("images/%s/%s.iso", namespace, name))
+		Expect(err).NotTo(HaveOccurred())
+		resp, err := client.Get(url)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+	})
+
+	Context("streaming images", func() {
+		var imageURL string
+
+		BeforeEach(func() {
+			server.Close()
+			server = httptest.NewServer(&Handler{
+				Log:        logrus.New(),
+				WorkDir:    workDir,
+				ConfigsDir: configsDir,
+				Stream:     true,
+				Events:     broker,
+			})
+			client = server.Client()
+
+			var err error
+			imageURL, err = url.JoinPath(server.URL, fmt.Sprintf("images/%s/%s.iso", namespace, name))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		get := func(header http.Header) (*http.Response, []byte) {
+			req, err := http.NewRequest(http.MethodGet, imageURL, nil)
+			Expect(err).NotTo(HaveOccurred())
+			for k, v := range header {
+				req.Header[k] = v
+			}
+			resp, err := client.Do(req)
+			Expect(err).NotTo(HaveOccurred())
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			Expect(err).NotTo(HaveOccurred())
+			return resp, body
+		}
+
+		It("contains the correct content without writing to the work dir", func() {
+			resp, body := get(nil)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(resp.ContentLength).To(Equal(int64(len(body))))
+			entries, err := os.ReadDir(workDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(BeEmpty())
+
+			isoPath := filepath.Join(tempDir, "streamed.iso")
+			Expect(os.WriteFile(isoPath, body, 0600)).To(Succeed())
+			d, err := diskfs.Open(isoPath, diskfs.WithOpenMode(diskfs.ReadOnly))
+			Expect(err).NotTo(HaveOccurred())
+			defer d.File.Close()
+			fs, err := d.GetFilesystem(0)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strings.TrimRight(fs.Label(), "\x00 ")).To(Equal(isoschema.VolumeLabel))
+			isoFile, err := fs.OpenFile("/testDir/file2", os.O_RDONLY)
+			Expect(err).NotTo(HaveOccurred())
+			content, err := io.ReadAll(isoFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(content).To(Equal([]byte("content2")))
+		})
+
+		It("serves ranges of the same image", func() {
+			_, whole := get(nil)
+			resp, part := get(http.Header{"Range": {"bytes=32768-36863"}})
+			Expect(resp.StatusCode).To(Equal(http.StatusPartialContent))
+			Expect(part).To(Equal(whole[32768:36864]))
+		})
+
+		It("only publishes ImageBuilt when the payload changes", func() {
+			ch, unsubscribe := broker.Subscribe(namespace)
+			defer unsubscribe()
+			built := func() int {
+				n := 0
+				for {
+					select {
+					case e := <-ch:
+						if e.Type == apischema.ImageBuilt {
+							n++
+						}
+					default:
+						return n
+					}
+				}
+			}
+			writePayload := func(value string) {
+				w := isoschema.NewWriter(filepath.Join(configsDir, namespace, name, "files"))
+				ExpectWithOffset(1, w.WriteObject(isoschema.PullSecretFileType, &corev1.Secret{StringData: map[string]string{"a": value}})).To(Succeed())
+				ExpectWithOffset(1, w.WriteManifest()).To(Succeed())
+			}
+
+			writePayload("b")
+			get(nil)
+			get(http.Header{"Range": {"bytes=0-1023"}})
+			Expect(built()).To(Equal(1))
+
+			writePayload("c")
+			get(nil)
+			Expect(built()).To(Equal(1))
+		})
+
+		It("keeps the content the image was opened with when files are replaced", func() {
+			configDir := filepath.Join(configsDir, namespace, name)
+			filesDir := filepath.Join(configDir, "files")
+			img, err := OpenISO(context.Background(), configDir, filesDir, time.Second)
+			Expect(err).NotTo(HaveOccurred())
+			defer img.Close()
+
+			replacement := filepath.Join(tempDir, "file1")
+			Expect(os.WriteFile(replacement, []byte("replaced"), 0600)).To(Succeed())
+			Expect(os.Rename(replacement, filepath.Join(filesDir, "file1"))).To(Succeed())
+
+			content, err := io.ReadAll(img)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(content)).To(ContainSubstring("content1"))
+			Expect(string(content)).NotTo(ContainSubstring("replaced"))
+		})
+	})
+
+	Context("recording builds", func() {
+		var (
+			c   ctrlclient.Client
+			key = types.NamespacedName{Namespace: namespace, Name: name}
+		)
+
+		BeforeEach(func() {
+			scheme := runtime.NewScheme()
+			Expect(relocationv1alpha1.AddToScheme(scheme)).To(Succeed())
+			c = fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithStatusSubresource(&relocationv1alpha1.ClusterConfig{}).
+				WithObjects(&relocationv1alpha1.ClusterConfig{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}).
+				Build()
+		})
+
+		newHandler := func() *Handler {
+			return &Handler{
+				Log:        logrus.New(),
+				WorkDir:    workDir,
+				ConfigsDir: configsDir,
+				Builds:     &BuildRecorder{Client: c, Log: logrus.New()},
+			}
+		}
+
+		serveMethod := func(h *Handler, method string) int {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(method, fmt.Sprintf("/images/%s/%s.iso", namespace, name), nil))
+			ExpectWithOffset(1, rec.Code).To(Equal(http.StatusOK))
+			return rec.Body.Len()
+		}
+		serve := func(h *Handler) int {
+			return serveMethod(h, http.MethodGet)
+		}
+
+		writePayload := func(value string) {
+			w := isoschema.NewWriter(filepath.Join(configsDir, namespace, name, "files"))
+			ExpectWithOffset(1, w.WriteObject(isoschema.PullSecretFileType, &corev1.Secret{StringData: map[string]string{"a": value}})).To(Succeed())
+			ExpectWithOffset(1, w.WriteManifest()).To(Succeed())
+		}
+
+		getBuild := func() *relocationv1alpha1.ImageBuildStatus {
+			config := &relocationv1alpha1.ClusterConfig{}
+			ExpectWithOffset(1, c.Get(context.Background(), key, config)).To(Succeed())
+			return config.Status.ImageBuild
+		}
+
+		It("records built images in the status", func() {
+			size := serve(newHandler())
+
+			build := getBuild()
+			Expect(build).NotTo(BeNil())
+			Expect(build.SizeBytes).To(Equal(int64(size)))
+			Expect(build.FileCount).To(Equal(int32(2)))
+			Expect(build.Duration.Duration).To(BeNumerically(">", 0))
+			Expect(build.Time.IsZero()).To(BeFalse())
+		})
+
+		It("doesn't record streamed images or HEAD requests", func() {
+			h := newHandler()
+			h.Stream = true
+			serve(h)
+			Expect(getBuild()).To(BeNil())
+
+			serveMethod(newHandler(), http.MethodHead)
+			Expect(getBuild()).To(BeNil())
+		})
+
+		It("only records the first build of each payload", func() {
+			clearBuild := func() {
+				config := &relocationv1alpha1.ClusterConfig{}
+				ExpectWithOffset(1, c.Get(context.Background(), key, config)).To(Succeed())
+				config.Status.ImageBuild = nil
+				ExpectWithOffset(1, c.Status().Update(context.Background(), config)).To(Succeed())
+			}
+
+			h := newHandler()
+			writePayload("b")
+			serve(h)
+			Expect(getBuild()).NotTo(BeNil())
+
+			clearBuild()
+			serve(h)
+			Expect(getBuild()).To(BeNil())
+
+			writePayload("c")
+			serve(h)
+			Expect(getBuild()).NotTo(BeNil())
+		})
+
+		It("doesn't record images served from the cache", func() {
+			h := newHandler()
+			h.Cache = &ISOCache{Log: logrus.New(), Dir: filepath.Join(tempDir, "cache")}
+			writePayload("b")
+
+			serve(h)
+			first := getBuild()
+			Expect(first).NotTo(BeNil())
+
+			serve(h)
+			Expect(getBuild()).To(Equal(first))
+		})
+
+		It("serves images of ClusterConfigs which no longer exist", func() {
+			Expect(c.Delete(context.Background(), &relocationv1alpha1.ClusterConfig{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}})).To(Succeed())
+			serve(newHandler())
+		})
+	})
+
+	Context("with basic auth", func() {
+		var imageURL string
+
+		BeforeEach(func() {
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: relocationv1alpha1.ImageCredentialsSecretName, Namespace: namespace},
+				Data: map[string][]byte{
+					relocationv1alpha1.ImageCredentialsUsernameKey: []byte("relocation"),
+					relocationv1alpha1.ImageCredentialsPasswordKey: []byte("password"),
+				},
+			}
+			other := secret.DeepCopy()
+			other.Namespace = "other"
+			other.Data[relocationv1alpha1.ImageCredentialsPasswordKey] = []byte("other-password")
+
+			server.Close()
+			server = httptest.NewServer(&Handler{
+				Log:        logrus.New(),
+				WorkDir:    workDir,
+				ConfigsDir: configsDir,
+				Auth:       &BasicAuth{Client: fake.NewClientBuilder().WithObjects(secret, other).Build()},
+			})
+			client = server.Client()
+
+			var err error
+			imageURL, err = url.JoinPath(server.URL, fmt.Sprintf("images/%s/%s.iso", namespace, name))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		get := func(user, password string) *http.Response {
+			req, err := http.NewRequest(http.MethodGet, imageURL, nil)
+			Expect(err).NotTo(HaveOccurred())
+			if user != "" {
+				req.SetBasicAuth(user, password)
+			}
+			resp, err := client.Do(req)
+			Expect(err).NotTo(HaveOccurred())
+			resp.Body.Close()
+			return resp
+		}
+
+		It("serves images with the namespace credentials", func() {
+			Expect(get("relocation", "password").StatusCode).To(Equal(http.StatusOK))
+		})
+
+		It("rejects missing or wrong credentials", func() {
+			resp := get("", "")
+			Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+			Expect(resp.Header.Get("WWW-Authenticate")).To(HavePrefix("Basic"))
+			Expect(get("relocation", "wrong").StatusCode).To(Equal(http.StatusUnauthorized))
+			Expect(get("admin", "password").StatusCode).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("rejects credentials from another namespace", func() {
+			Expect(get("relocation", "other-password").StatusCode).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("rejects requests for namespaces without credentials", func() {
+			Expect(os.Rename(filepath.Join(configsDir, namespace), filepath.Join(configsDir, "no-credentials"))).To(Succeed())
+			imageURL = strings.Replace(imageURL, namespace, "no-credentials", 1)
+			Expect(get("relocation", "password").StatusCode).To(Equal(http.StatusUnauthorized))
+		})
+	})
+
+	It("returns headers without a body for HEAD requests", func() {
+		url, err := url.JoinPath(server.URL, fmt.Sprintf("images/%s/%s.iso", namespace, name))
+		Expect(err).NotTo(HaveOccurred())
+		resp, err := client.Head(url)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.ContentLength).To(BeNumerically(">", 0))
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(body).To(BeEmpty())
+	})
+
+	It("answers OPTIONS requests with the allowed methods", func() {
+		req, err := http.NewRequest(http.MethodOptions, fmt.Sprintf("%s/images/%s/%s.iso", server.URL, namespace, name), nil)
+		Expect(err).NotTo(HaveOccurred())
+		resp, err := client.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(resp.StatusCode).To(Equal(http.StatusNoContent))
+		Expect(resp.Header.Get("Allow")).To(Equal("GET, HEAD, OPTIONS"))
+	})
+
+	It("rejects other methods", func() {
+		resp, err := client.Post(fmt.Sprintf("%s/images/%s/%s.iso", server.URL, namespace, name), "text/plain", nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(resp.StatusCode).To(Equal(http.StatusMethodNotAllowed))
+		Expect(resp.Header.Get("Allow")).To(Equal("GET, HEAD, OPTIONS"))
+	})
+
+	It("returns service unavailable while the config is being written", func() {
+		c := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_, _ = filelock.WithWriteLock(filepath.Join(configsDir, namespace, name), func() error {
+				c <- struct{}{}
+				<-c
+				return nil
+			})
+		}()
+		<-c
+		defer func() {
+			c <- struct{}{}
+			<-done
+		}()
+
+		resp, err := client.Get(fmt.Sprintf("%s/images/%s/%s.iso", server.URL, namespace, name))
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(resp.StatusCode).To(Equal(http.StatusServiceUnavailable))
+		Expect(resp.Header.Get("Retry-After")).NotTo(BeEmpty())
+	})
 })
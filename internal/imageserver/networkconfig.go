@@ -0,0 +1,131 @@
+package imageserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/carbonin/cluster-relocation-service/api/isoschema"
+	"github.com/carbonin/cluster-relocation-service/internal/filelock"
+)
+
+// networkConfigPathRegexp matches /networkconfig/<namespace>/<name> and /networkconfig/<namespace>/<name>/<file>
+var networkConfigPathRegexp = regexp.MustCompile(`^/networkconfig/([^/]+)/([^/]+?)(?:/([^/]+))?$`)
+
+// errNoNetworkConfig is returned for configs without a network config in their payload
+var errNoNetworkConfig = errors.New("the config has no network configuration")
+
+// NetworkConfigHandler serves only the nmstate files of a config's payload for flows which deliver the network
+// configuration separately from the image. All files are served as a JSON object of file name to content, or a
+// single file as YAML when its name is included in the path. It uses the data dir and credentials of Handler
+type NetworkConfigHandler struct {
+	Handler *Handler
+}
+
+func (n *NetworkConfigHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h := n.Handler
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodOptions:
+		w.Header().Set("Allow", allowedMethods)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		w.Header().Set("Allow", allowedMethods)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	match := networkConfigPathRegexp.FindStringSubmatch(r.URL.Path)
+	if match == nil {
+		http.NotFound(w, r)
+		return
+	}
+	namespace, name, file := match[1], match[2], match[3]
+	if h.Auth != nil {
+		ok, err := h.Auth.authorized(r.Context(), r, namespace)
+		if err != nil {
+			h.Log.WithError(err).Error("failed to check image credentials")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="images", charset="UTF-8"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	configDir := filepath.Join(h.configsDir(namespace), namespace, name)
+	files, err := h.networkConfig(r.Context(), configDir)
+	switch {
+	case errors.Is(err, os.ErrNotExist), errors.Is(err, errNoNetworkConfig):
+		http.NotFound(w, r)
+		return
+	case errors.Is(err, errLockTimeout):
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, "network config is being updated, retry later", http.StatusServiceUnavailable)
+		return
+	case err != nil:
+		h.Log.WithError(err).Error("failed to read network config")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	h.Log.Infof("Serving network config for ClusterConfig %s/%s", namespace, name)
+
+	w.Header().Set("Cache-Control", "no-store")
+	if file != "" {
+		content, ok := files[file]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/yaml")
+		if _, err := w.Write([]byte(content)); err != nil {
+			h.Log.WithError(err).Error("failed to write network config")
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(files); err != nil {
+		h.Log.WithError(err).Error("failed to write network config")
+	}
+}
+
+// networkConfig returns the nmstate files in the payload of the config in configDir by name
+func (h *Handler) networkConfig(ctx context.Context, configDir string) (map[string]string, error) {
+	filesDir := filepath.Join(configDir, "files")
+	// the files dir is removed if the config can't currently be served
+	if _, err := os.Stat(filesDir); err != nil {
+		return nil, err
+	}
+	cm := &corev1.ConfigMap{}
+	found := false
+	lockCtx, cancel := context.WithTimeout(ctx, h.LockTimeout)
+	defer cancel()
+	locked, err := filelock.WithReadLockContext(lockCtx, configDir, func() error {
+		reader, err := isoschema.NewReader(os.DirFS(filesDir))
+		if err != nil {
+			return err
+		}
+		found, err = reader.ReadObject(isoschema.NetworkConfigFileType, cm)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read network config: %w", err)
+	}
+	if !locked {
+		return nil, errLockTimeout
+	}
+	if !found {
+		return nil, errNoNetworkConfig
+	}
+	return cm.Data, nil
+}
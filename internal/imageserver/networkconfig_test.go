@@ -0,0 +1,106 @@
+package imageserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	"github.com/carbonin/cluster-relocation-service/api/isoschema"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("NetworkConfigHandler", func() {
+	var (
+		server     *httptest.Server
+		tempDir    string
+		configsDir string
+		filesDir   string
+
+		namespace = "cluster-relocation"
+		name      = "config"
+	)
+
+	BeforeEach(func() {
+		var err error
+		tempDir, err = os.MkdirTemp("", "networkconfig_test")
+		Expect(err).NotTo(HaveOccurred())
+		configsDir = filepath.Join(tempDir, "configdir")
+		filesDir = filepath.Join(configsDir, namespace, name, "files")
+		Expect(os.MkdirAll(filesDir, 0700)).To(Succeed())
+
+		h := &Handler{Log: logrus.New(), WorkDir: tempDir, ConfigsDir: configsDir}
+		server = httptest.NewServer(&NetworkConfigHandler{Handler: h})
+	})
+
+	AfterEach(func() {
+		server.Close()
+		Expect(os.RemoveAll(tempDir)).To(Succeed())
+	})
+
+	writeNetworkConfig := func(data map[string]string) {
+		w := isoschema.NewWriter(filesDir)
+		cm := &corev1.ConfigMap{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+			ObjectMeta: metav1.ObjectMeta{Name: "network", Namespace: namespace},
+			Data:       data,
+		}
+		Expect(w.WriteObject(isoschema.NetworkConfigFileType, cm)).To(Succeed())
+		Expect(w.WriteManifest()).To(Succeed())
+	}
+
+	get := func(path string) (*http.Response, string) {
+		resp, err := server.Client().Get(server.URL + path)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		return resp, string(body)
+	}
+
+	It("serves all network config files as JSON", func() {
+		writeNetworkConfig(map[string]string{"host-1.yaml": "interfaces: []\n", "host-2.yaml": "routes: {}\n"})
+
+		resp, body := get(fmt.Sprintf("/networkconfig/%s/%s", namespace, name))
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.Header.Get("Content-Type")).To(Equal("application/json"))
+		files := map[string]string{}
+		Expect(json.Unmarshal([]byte(body), &files)).To(Succeed())
+		Expect(files).To(Equal(map[string]string{"host-1.yaml": "interfaces: []\n", "host-2.yaml": "routes: {}\n"}))
+	})
+
+	It("serves a single network config file as YAML", func() {
+		writeNetworkConfig(map[string]string{"host-1.yaml": "interfaces: []\n"})
+
+		resp, body := get(fmt.Sprintf("/networkconfig/%s/%s/host-1.yaml", namespace, name))
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.Header.Get("Content-Type")).To(Equal("application/yaml"))
+		Expect(body).To(Equal("interfaces: []\n"))
+
+		resp, _ = get(fmt.Sprintf("/networkconfig/%s/%s/host-2.yaml", namespace, name))
+		Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+	})
+
+	It("returns not found for configs without a network config", func() {
+		w := isoschema.NewWriter(filesDir)
+		Expect(w.WriteManifest()).To(Succeed())
+
+		resp, _ := get(fmt.Sprintf("/networkconfig/%s/%s", namespace, name))
+		Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+		resp, _ = get(fmt.Sprintf("/networkconfig/%s/other", namespace))
+		Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+	})
+
+	It("rejects other methods", func() {
+		resp, err := server.Client().Post(fmt.Sprintf("%s/networkconfig/%s/%s", server.URL, namespace, name), "text/plain", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusMethodNotAllowed))
+	})
+})
@@ -0,0 +1,185 @@
+package imageserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	cro "github.com/RHsyseng/cluster-relocation-operator/api/v1beta1"
+	"github.com/carbonin/cluster-relocation-service/api/isoschema"
+	"github.com/diskfs/go-diskfs"
+	"github.com/diskfs/go-diskfs/filesystem"
+	"github.com/diskfs/go-diskfs/filesystem/iso9660"
+)
+
+// SelfTest renders a synthetic configuration, builds it into an ISO, and reads it back
+// to validate the storage and image building path of a deployment
+// It doesn't authorize requests, it must be served behind an apiauth.Middleware with the apiserver routes
+type SelfTest struct {
+	Handler *Handler
+}
+
+// SelfTestResult is the response to a self test request
+type SelfTestResult struct {
+	Success        bool   `json:"success"`
+	Error          string `json:"error,omitempty"`
+	RenderDuration string `json:"renderDuration,omitempty"`
+	BuildDuration  string `json:"buildDuration,omitempty"`
+	VerifyDuration string `json:"verifyDuration,omitempty"`
+	ImageSize      int64  `json:"imageSize,omitempty"`
+}
+
+func (s *SelfTest) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	result := s.run(r.Context())
+	status := http.StatusOK
+	if !result.Success {
+		s.Handler.Log.Errorf("self test failed: %s", result.Error)
+		status = http.StatusInternalServerError
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		s.Handler.Log.WithError(err).Error("failed to write self test result")
+	}
+}
+
+func (s *SelfTest) run(ctx context.Context) *SelfTestResult {
+	result := &SelfTestResult{}
+	fail := func(format string, args ...interface{}) *SelfTestResult {
+		result.Error = fmt.Sprintf(format, args...)
+		return result
+	}
+
+	configDir, err := os.MkdirTemp(s.Handler.WorkDir, "selftest")
+	if err != nil {
+		return fail("failed to create config dir: %s", err)
+	}
+	defer os.RemoveAll(configDir)
+	filesDir := filepath.Join(configDir, "files")
+	if err := os.MkdirAll(filesDir, 0700); err != nil {
+		return fail("failed to create files dir: %s", err)
+	}
+
+	start := time.Now()
+	expected, err := renderSelfTest(filesDir)
+	if err != nil {
+		return fail("failed to render configuration: %s", err)
+	}
+	result.RenderDuration = time.Since(start).String()
+
+	if s.Handler.Stream {
+		start = time.Now()
+		img, err := OpenISO(ctx, configDir, filesDir, s.Handler.LockTimeout)
+		if err != nil {
+			return fail("failed to open iso: %s", err)
+		}
+		defer img.Close()
+		result.BuildDuration = time.Since(start).String()
+
+		start = time.Now()
+		result.ImageSize = img.Size()
+		fsys, err := iso9660.Read(img, img.Size(), 0, 0)
+		if err != nil {
+			return fail("failed to verify iso: %s", err)
+		}
+		if err := verifySelfTestFilesystem(fsys, expected); err != nil {
+			return fail("failed to verify iso: %s", err)
+		}
+		result.VerifyDuration = time.Since(start).String()
+
+		result.Success = true
+		return result
+	}
+
+	start = time.Now()
+	iso, err := s.Handler.buildISO(ctx, configDir, filesDir)
+	if err != nil {
+		return fail("failed to build iso: %s", err)
+	}
+	defer os.Remove(iso.Path)
+	result.BuildDuration = time.Since(start).String()
+	result.ImageSize = iso.Stats.Size
+
+	start = time.Now()
+	if err := verifySelfTest(iso.Path, expected); err != nil {
+		return fail("failed to verify iso: %s", err)
+	}
+	result.VerifyDuration = time.Since(start).String()
+
+	result.Success = true
+	return result
+}
+
+// renderSelfTest writes a sample configuration to dir and returns the content of each file by name
+func renderSelfTest(dir string) (map[string][]byte, error) {
+	cr := &cro.ClusterRelocation{
+		TypeMeta:   metav1.TypeMeta{APIVersion: cro.GroupVersion.String(), Kind: "ClusterRelocation"},
+		ObjectMeta: metav1.ObjectMeta{Name: "selftest", Namespace: "selftest"},
+		Spec:       cro.ClusterRelocationSpec{Domain: "selftest.example.com"},
+	}
+
+	w := isoschema.NewWriter(dir)
+	if err := w.WriteObject(isoschema.ClusterRelocationFileType, cr); err != nil {
+		return nil, err
+	}
+	if err := w.WriteManifest(); err != nil {
+		return nil, err
+	}
+
+	expected := map[string][]byte{}
+	for _, name := range []string{isoschema.ManifestFileName, isoschema.FileName(isoschema.ClusterRelocationFileType)} {
+		content, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		expected[name] = content
+	}
+	return expected, nil
+}
+
+// verifySelfTest checks that the iso at path contains the expected files
+func verifySelfTest(path string, expected map[string][]byte) error {
+	d, err := diskfs.Open(path, diskfs.WithOpenMode(diskfs.ReadOnly))
+	if err != nil {
+		return err
+	}
+	defer d.File.Close()
+	fsys, err := d.GetFilesystem(0)
+	if err != nil {
+		return err
+	}
+	return verifySelfTestFilesystem(fsys, expected)
+}
+
+// verifySelfTestFilesystem checks that the filesystem of an iso contains the expected files
+func verifySelfTestFilesystem(fsys filesystem.FileSystem, expected map[string][]byte) error {
+	// the label is padded to the fixed size of the volume descriptor field
+	if label := strings.TrimRight(fsys.Label(), "\x00 "); label != isoschema.VolumeLabel {
+		return fmt.Errorf("unexpected volume label %q", label)
+	}
+
+	for name, want := range expected {
+		f, err := fsys.OpenFile("/"+name, os.O_RDONLY)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", name, err)
+		}
+		got, err := io.ReadAll(f)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		if !bytes.Equal(got, want) {
+			return fmt.Errorf("content of %s does not match", name)
+		}
+	}
+	return nil
+}
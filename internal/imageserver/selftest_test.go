@@ -0,0 +1,77 @@
+package imageserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+)
+
+var _ = Describe("SelfTest", func() {
+	var (
+		workDir string
+		handler *SelfTest
+	)
+
+	BeforeEach(func() {
+		var err error
+		workDir, err = os.MkdirTemp("", "selftest_test")
+		Expect(err).NotTo(HaveOccurred())
+		handler = &SelfTest{
+			Handler: &Handler{Log: logrus.New(), WorkDir: workDir},
+		}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(workDir)).To(Succeed())
+	})
+
+	request := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/selftest", nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	It("builds and verifies an image", func() {
+		rec := request()
+		Expect(rec.Code).To(Equal(http.StatusOK))
+
+		result := &SelfTestResult{}
+		Expect(json.Unmarshal(rec.Body.Bytes(), result)).To(Succeed())
+		Expect(result.Success).To(BeTrue(), result.Error)
+		Expect(result.ImageSize).To(BeNumerically(">", 0))
+		Expect(result.BuildDuration).NotTo(BeEmpty())
+
+		// nothing is left behind
+		entries, err := os.ReadDir(workDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(BeEmpty())
+	})
+
+	It("verifies a streamed image", func() {
+		handler.Handler.Stream = true
+		rec := request()
+		Expect(rec.Code).To(Equal(http.StatusOK))
+
+		result := &SelfTestResult{}
+		Expect(json.Unmarshal(rec.Body.Bytes(), result)).To(Succeed())
+		Expect(result.Success).To(BeTrue(), result.Error)
+		Expect(result.ImageSize).To(BeNumerically(">", 0))
+	})
+
+	It("reports failures", func() {
+		handler.Handler.WorkDir = "/nonexistent/workdir"
+		rec := request()
+		Expect(rec.Code).To(Equal(http.StatusInternalServerError))
+
+		result := &SelfTestResult{}
+		Expect(json.Unmarshal(rec.Body.Bytes(), result)).To(Succeed())
+		Expect(result.Success).To(BeFalse())
+		Expect(result.Error).NotTo(BeEmpty())
+	})
+})
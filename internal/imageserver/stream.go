@@ -0,0 +1,147 @@
+package imageserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/carbonin/cluster-relocation-service/api/apischema"
+	"github.com/carbonin/cluster-relocation-service/internal/filelock"
+	"github.com/carbonin/cluster-relocation-service/internal/isostream"
+	"github.com/carbonin/cluster-relocation-service/internal/tracing"
+)
+
+// StreamedISO is an image generated from the files of a config as it is read
+// The files are opened when the image is created, they stay readable when the manager replaces them so the image
+// keeps the content of the payload at that time
+type StreamedISO struct {
+	*isostream.Image
+	// Key is the cache key of the payload the image is generated from
+	Key string
+	// ModTime is the latest modification time of the files
+	ModTime time.Time
+
+	files []*os.File
+}
+
+// Close closes the files of the image
+func (s *StreamedISO) Close() error {
+	var err error
+	for _, f := range s.files {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// WriteAt fails as the image can't be changed, it lets the image be opened as a read only disk
+func (s *StreamedISO) WriteAt([]byte, int64) (int, error) {
+	return 0, errors.New("streamed images are read only")
+}
+
+// OpenISO opens the files in filesDir, waiting up to lockTimeout for the config in configDir to be written,
+// and returns an image generated from them as it is read. Unlike BuildISO nothing is written to disk
+// The caller is responsible for closing the image
+func OpenISO(ctx context.Context, configDir, filesDir string, lockTimeout time.Duration) (*StreamedISO, error) {
+	s := &StreamedISO{}
+	var files []isostream.File
+	var label string
+	lockCtx, cancel := context.WithTimeout(ctx, lockTimeout)
+	defer cancel()
+	locked, err := filelock.WithReadLockContext(lockCtx, configDir, func() error {
+		s.Key = payloadKey(filesDir)
+		label = volumeLabel(filesDir)
+		return filepath.WalkDir(filesDir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			f, err := os.Open(p)
+			if err != nil {
+				return err
+			}
+			s.files = append(s.files, f)
+			info, err := f.Stat()
+			if err != nil {
+				return err
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+			rel, err := filepath.Rel(filesDir, p)
+			if err != nil {
+				return err
+			}
+			files = append(files, isostream.File{Path: filepath.ToSlash(rel), Size: info.Size(), Mode: info.Mode(), Content: f})
+			if info.ModTime().After(s.ModTime) {
+				s.ModTime = info.ModTime()
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		s.Close()
+		return nil, fmt.Errorf("failed to open config files: %w", err)
+	}
+	if !locked {
+		s.Close()
+		return nil, errLockTimeout
+	}
+
+	s.Image, err = isostream.New(label, s.ModTime, files)
+	if err != nil {
+		s.Close()
+		return nil, fmt.Errorf("failed to lay out iso: %w", err)
+	}
+	return s, nil
+}
+
+// serveStream writes an image generated from the files in filesDir to the response
+// Images are the same for the same payload so range requests split across connections get consistent content
+func (h *Handler) serveStream(w http.ResponseWriter, r *http.Request, key types.NamespacedName, configDir, filesDir string) {
+	ctx, span := tracing.Start(tracing.ExtractHTTP(r), "StreamISO", tracing.ClusterConfigAttributes(key.Namespace, key.Name)...)
+	img, err := OpenISO(ctx, configDir, filesDir, h.LockTimeout)
+	tracing.End(span, err)
+	if err != nil {
+		h.buildFailed(w, err)
+		return
+	}
+	defer img.Close()
+	// streamed images are generated for every request so they are only reported as built for a new payload
+	// They aren't recorded as builds either as nothing is built before the download starts
+	if h.streamedChanged(key, img.Key) {
+		h.Events.Publish(apischema.Event{Type: apischema.ImageBuilt, Namespace: key.Namespace, Name: key.Name})
+	}
+	h.Metrics.SetImageSize(key, img.Size())
+
+	if img.Key != "" {
+		w.Header().Set("ETag", `"`+img.Key+`"`)
+	}
+	http.ServeContent(w, r, path.Base(r.URL.Path), img.ModTime, img)
+	if r.Method == http.MethodGet {
+		h.downloaded(r, key)
+	}
+}
+
+// streamedChanged records payload as the last payload streamed for key and returns true if it differs from the
+// previous one. Payloads without a key can't be compared so they are always reported as changed
+func (h *Handler) streamedChanged(key types.NamespacedName, payload string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if payload != "" && h.streamed[key] == payload {
+		return false
+	}
+	if h.streamed == nil {
+		h.streamed = map[types.NamespacedName]string{}
+	}
+	h.streamed[key] = payload
+	return true
+}
@@ -0,0 +1,111 @@
+package imageserver
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TenantNamespace returns the namespace a per-tenant hostname of the form <namespace>.<domain> is for
+func TenantNamespace(host, domain string) (string, bool) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	suffix := "." + strings.TrimSuffix(domain, ".")
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if domain == "" || !strings.HasSuffix(host, suffix) {
+		return "", false
+	}
+	ns := strings.TrimSuffix(host, suffix)
+	if ns == "" || strings.Contains(ns, ".") {
+		return "", false
+	}
+	return ns, true
+}
+
+// TenantHosts wraps next so requests to a per-tenant hostname can only download the images and network configs of its namespace
+// Other endpoints aren't served on tenant hostnames, requests to any other hostname are passed through
+type TenantHosts struct {
+	Domain string
+	Next   http.Handler
+}
+
+func (t *TenantHosts) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := TenantNamespace(r.Host, t.Domain)
+	if !ok {
+		t.Next.ServeHTTP(w, r)
+		return
+	}
+
+	match := pathRegexp.FindStringSubmatch(r.URL.Path)
+	if match == nil {
+		match = networkConfigPathRegexp.FindStringSubmatch(r.URL.Path)
+	}
+	if match == nil || match[1] != tenant {
+		http.NotFound(w, r)
+		return
+	}
+	t.Next.ServeHTTP(w, r)
+}
+
+type tenantCert struct {
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// TenantCertificates selects the serving certificate for each TLS connection by SNI
+// The certificate for <namespace>.<domain> is read from Dir/<namespace>/tls.crt and tls.key, which is the layout
+// of a mounted cert-manager certificate secret, and is reloaded when renewed. Other hostnames use Default
+type TenantCertificates struct {
+	Domain  string
+	Dir     string
+	Default *tls.Certificate
+
+	mu    sync.Mutex
+	certs map[string]*tenantCert
+}
+
+// GetCertificate implements tls.Config.GetCertificate
+func (t *TenantCertificates) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	ns, ok := TenantNamespace(hello.ServerName, t.Domain)
+	if !ok {
+		return t.defaultCert()
+	}
+
+	dir := filepath.Join(t.Dir, ns)
+	certFile := filepath.Join(dir, "tls.crt")
+	info, err := os.Stat(certFile)
+	if os.IsNotExist(err) {
+		return t.defaultCert()
+	} else if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if c, ok := t.certs[ns]; ok && c.modTime.Equal(info.ModTime()) {
+		return c.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, filepath.Join(dir, "tls.key"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load certificate for tenant %s: %w", ns, err)
+	}
+	if t.certs == nil {
+		t.certs = map[string]*tenantCert{}
+	}
+	t.certs[ns] = &tenantCert{cert: &cert, modTime: info.ModTime()}
+	return &cert, nil
+}
+
+func (t *TenantCertificates) defaultCert() (*tls.Certificate, error) {
+	if t.Default == nil {
+		return nil, fmt.Errorf("no certificate is available for the requested hostname")
+	}
+	return t.Default, nil
+}
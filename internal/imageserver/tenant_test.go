@@ -0,0 +1,152 @@
+package imageserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TenantNamespace", func() {
+	It("returns the namespace of tenant hostnames", func() {
+		for _, host := range []string{"site-1.images.example.com", "Site-1.images.example.com:8443"} {
+			ns, ok := TenantNamespace(host, "images.example.com")
+			Expect(ok).To(BeTrue(), host)
+			Expect(ns).To(Equal("site-1"))
+		}
+	})
+
+	It("rejects other hostnames", func() {
+		for _, host := range []string{"images.example.com", "a.b.images.example.com", "site-1.other.example.com", "service.namespace"} {
+			_, ok := TenantNamespace(host, "images.example.com")
+			Expect(ok).To(BeFalse(), host)
+		}
+		_, ok := TenantNamespace("site-1.images.example.com", "")
+		Expect(ok).To(BeFalse())
+	})
+})
+
+var _ = Describe("TenantHosts", func() {
+	var handler *TenantHosts
+
+	BeforeEach(func() {
+		handler = &TenantHosts{
+			Domain: "images.example.com",
+			Next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}),
+		}
+	})
+
+	serve := func(host, path string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Host = host
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	It("serves images of the tenant namespace", func() {
+		Expect(serve("site-1.images.example.com", "/images/site-1/config.iso")).To(Equal(http.StatusOK))
+		Expect(serve("site-1.images.example.com", "/networkconfig/site-1/config")).To(Equal(http.StatusOK))
+	})
+
+	It("doesn't serve images of other namespaces or other endpoints on tenant hostnames", func() {
+		Expect(serve("site-1.images.example.com", "/images/site-2/config.iso")).To(Equal(http.StatusNotFound))
+		Expect(serve("site-1.images.example.com", "/networkconfig/site-2/config")).To(Equal(http.StatusNotFound))
+		Expect(serve("site-1.images.example.com", "/metrics")).To(Equal(http.StatusNotFound))
+	})
+
+	It("passes through requests to other hostnames", func() {
+		Expect(serve("service.namespace", "/images/site-2/config.iso")).To(Equal(http.StatusOK))
+		Expect(serve("service.namespace", "/metrics")).To(Equal(http.StatusOK))
+	})
+})
+
+var _ = Describe("TenantCertificates", func() {
+	var (
+		dir   string
+		certs *TenantCertificates
+	)
+
+	writeCert := func(dir, commonName string) {
+		priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: commonName},
+			DNSNames:     []string{commonName},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &priv.PublicKey, priv)
+		Expect(err).NotTo(HaveOccurred())
+		key, err := x509.MarshalECPrivateKey(priv)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(os.MkdirAll(dir, 0700)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "tls.crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "tls.key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: key}), 0600)).To(Succeed())
+	}
+
+	commonName := func(cert *tls.Certificate) string {
+		parsed, err := x509.ParseCertificate(cert.Certificate[0])
+		Expect(err).NotTo(HaveOccurred())
+		return parsed.Subject.CommonName
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "tenant_certs")
+		Expect(err).NotTo(HaveOccurred())
+
+		writeCert(filepath.Join(dir, "default"), "images.example.com")
+		def, err := tls.LoadX509KeyPair(filepath.Join(dir, "default", "tls.crt"), filepath.Join(dir, "default", "tls.key"))
+		Expect(err).NotTo(HaveOccurred())
+		certs = &TenantCertificates{Domain: "images.example.com", Dir: dir, Default: &def}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	It("selects the certificate of the tenant", func() {
+		writeCert(filepath.Join(dir, "site-1"), "site-1.images.example.com")
+		cert, err := certs.GetCertificate(&tls.ClientHelloInfo{ServerName: "site-1.images.example.com"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(commonName(cert)).To(Equal("site-1.images.example.com"))
+	})
+
+	It("uses the default certificate for other hostnames and tenants without one", func() {
+		for _, name := range []string{"site-2.images.example.com", "service.namespace", ""} {
+			cert, err := certs.GetCertificate(&tls.ClientHelloInfo{ServerName: name})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(commonName(cert)).To(Equal("images.example.com"))
+		}
+	})
+
+	It("reloads renewed certificates", func() {
+		writeCert(filepath.Join(dir, "site-1"), "site-1.images.example.com")
+		_, err := certs.GetCertificate(&tls.ClientHelloInfo{ServerName: "site-1.images.example.com"})
+		Expect(err).NotTo(HaveOccurred())
+
+		writeCert(filepath.Join(dir, "site-1"), "renewed.images.example.com")
+		future := time.Now().Add(time.Minute)
+		Expect(os.Chtimes(filepath.Join(dir, "site-1", "tls.crt"), future, future)).To(Succeed())
+		cert, err := certs.GetCertificate(&tls.ClientHelloInfo{ServerName: "site-1.images.example.com"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(commonName(cert)).To(Equal("renewed.images.example.com"))
+	})
+})
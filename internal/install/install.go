@@ -0,0 +1,522 @@
+package install
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	routev1 "github.com/openshift/api/route/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	appLabel               = "cluster-relocation"
+	deploymentName         = "cluster-relocation-service"
+	mirrorDeploymentName   = "cluster-relocation-service-mirror"
+	mirrorAppLabel         = "cluster-relocation-mirror"
+	imageServerLabel       = "relocation.openshift.io/image-server"
+	serviceAccountName     = "controller-manager"
+	managerRoleName        = "cluster-config-manager"
+	leaderElectionRoleName = "leader-election"
+	webhookServiceName     = "webhook-service"
+	webhookCertSecretName  = "webhook-server-cert"
+	dataPVCName            = "cluster-relocation-data"
+	serverPortName         = "config-server"
+)
+
+// Options configures the generated install manifest
+type Options struct {
+	// ConfigDir is the kubebuilder config directory containing the generated CRDs, RBAC, and webhook configuration
+	ConfigDir string
+	// Namespace is the namespace the service is installed into
+	Namespace string
+	// Image is the container image containing the manager and server binaries
+	Image string
+	// ServiceName is the name of the Service exposing the image server
+	ServiceName string
+	// ServicePort is the port the image server listens on
+	ServicePort int32
+	// StorageSize is the requested size of the data volume
+	StorageSize string
+	// StorageClassName is the storage class used for the data volume, the cluster default is used if unset
+	StorageClassName string
+	// Route creates an OpenShift Route exposing the image server outside the cluster
+	Route bool
+	// RouteHost is the host for the Route, a host is generated if unset
+	RouteHost string
+	// MirrorReplicas adds a Deployment of image servers which mount the data volume read-only so download
+	// bandwidth scales separately from the manager. The data volume must then support ReadWriteMany
+	MirrorReplicas int32
+}
+
+// DefaultOptions returns the options matching the kustomize deployment in ConfigDir
+func DefaultOptions() Options {
+	return Options{
+		ConfigDir:   "config",
+		Namespace:   "cluster-relocation",
+		Image:       "quay.io/carbonin/cluster-relocation-service:latest",
+		ServiceName: "cluster-relocation-config",
+		ServicePort: 8000,
+		StorageSize: "10Gi",
+	}
+}
+
+// Write renders the complete install manifest as a multi-document YAML stream
+func Write(w io.Writer, opts Options) error {
+	objs, err := Objects(opts)
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range objs {
+		u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			return fmt.Errorf("failed to convert %T: %w", obj, err)
+		}
+		// drop the empty fields typed objects always serialize
+		unstructured.RemoveNestedField(u, "metadata", "creationTimestamp")
+		unstructured.RemoveNestedField(u, "spec", "template", "metadata", "creationTimestamp")
+		delete(u, "status")
+
+		data, err := yaml.Marshal(u)
+		if err != nil {
+			return fmt.Errorf("failed to marshal %T: %w", obj, err)
+		}
+		if _, err := fmt.Fprintf(w, "---\n%s", data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Objects returns all the objects required to install the service in the order they should be applied
+func Objects(opts Options) ([]runtime.Object, error) {
+	if opts.Namespace == "" || opts.Image == "" || opts.ServiceName == "" || opts.ServicePort == 0 {
+		return nil, errors.New("namespace, image, service name, and service port must be set")
+	}
+	storageSize, err := resource.ParseQuantity(opts.StorageSize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid storage size %q: %w", opts.StorageSize, err)
+	}
+
+	crds, err := readManifests(filepath.Join(opts.ConfigDir, "crd", "bases", "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	roles, err := readManifests(filepath.Join(opts.ConfigDir, "rbac", "role.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	webhooks, err := readManifests(filepath.Join(opts.ConfigDir, "webhook", "manifests.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	for _, wh := range webhooks {
+		if err := configureWebhooks(wh, opts.Namespace); err != nil {
+			return nil, err
+		}
+	}
+
+	objs := []runtime.Object{namespace(opts)}
+	objs = append(objs, crds...)
+	objs = append(objs, serviceAccount(opts))
+	objs = append(objs, roles...)
+	objs = append(objs, managerRoleBinding(opts), leaderElectionRole(opts), leaderElectionRoleBinding(opts))
+	objs = append(objs, dataPVC(opts, storageSize), deployment(opts))
+	if opts.MirrorReplicas > 0 {
+		objs = append(objs, mirrorDeployment(opts))
+	}
+	objs = append(objs, imageService(opts), webhookService(opts))
+	if opts.Route {
+		objs = append(objs, route(opts))
+	}
+	objs = append(objs, webhooks...)
+
+	return objs, nil
+}
+
+// readManifests reads every object from the files matching pattern
+func readManifests(pattern string) ([]runtime.Object, error) {
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no manifests found matching %s, run make manifests first", pattern)
+	}
+	sort.Strings(files)
+
+	var objs []runtime.Object
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+		for {
+			obj := &unstructured.Unstructured{}
+			if err := decoder.Decode(&obj.Object); err != nil {
+				if err == io.EOF {
+					break
+				}
+				return nil, fmt.Errorf("failed to decode %s: %w", f, err)
+			}
+			if len(obj.Object) == 0 {
+				continue
+			}
+			objs = append(objs, obj)
+		}
+	}
+
+	return objs, nil
+}
+
+// configureWebhooks points the generated webhook configuration at the webhook service
+// and requests the OpenShift service CA inject its bundle
+func configureWebhooks(obj runtime.Object, namespace string) error {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return fmt.Errorf("unexpected webhook configuration type %T", obj)
+	}
+	u.SetAnnotations(map[string]string{"service.beta.openshift.io/inject-cabundle": "true"})
+
+	webhooks, _, err := unstructured.NestedSlice(u.Object, "webhooks")
+	if err != nil {
+		return err
+	}
+	for _, wh := range webhooks {
+		m, ok := wh.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("unexpected webhook format in %s", u.GetName())
+		}
+		if err := unstructured.SetNestedField(m, webhookServiceName, "clientConfig", "service", "name"); err != nil {
+			return err
+		}
+		if err := unstructured.SetNestedField(m, namespace, "clientConfig", "service", "namespace"); err != nil {
+			return err
+		}
+	}
+	return unstructured.SetNestedSlice(u.Object, webhooks, "webhooks")
+}
+
+func labels() map[string]string {
+	return map[string]string{"app": appLabel}
+}
+
+// imageServerLabels are set on every pod running an image server so the image Service includes mirrors
+func imageServerLabels(app string) map[string]string {
+	return map[string]string{"app": app, imageServerLabel: "true"}
+}
+
+func namespace(opts Options) *corev1.Namespace {
+	return &corev1.Namespace{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Namespace"},
+		ObjectMeta: metav1.ObjectMeta{Name: opts.Namespace},
+	}
+}
+
+func serviceAccount(opts Options) *corev1.ServiceAccount {
+	return &corev1.ServiceAccount{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ServiceAccount"},
+		ObjectMeta: metav1.ObjectMeta{Name: serviceAccountName, Namespace: opts.Namespace},
+	}
+}
+
+func serviceAccountSubject(opts Options) []rbacv1.Subject {
+	return []rbacv1.Subject{{
+		Kind:      rbacv1.ServiceAccountKind,
+		Name:      serviceAccountName,
+		Namespace: opts.Namespace,
+	}}
+}
+
+func managerRoleBinding(opts Options) *rbacv1.ClusterRoleBinding {
+	return &rbacv1.ClusterRoleBinding{
+		TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "ClusterRoleBinding"},
+		ObjectMeta: metav1.ObjectMeta{Name: managerRoleName},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "ClusterRole",
+			Name:     managerRoleName,
+		},
+		Subjects: serviceAccountSubject(opts),
+	}
+}
+
+func leaderElectionRole(opts Options) *rbacv1.Role {
+	verbs := []string{"get", "list", "watch", "create", "update", "patch", "delete"}
+	return &rbacv1.Role{
+		TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "Role"},
+		ObjectMeta: metav1.ObjectMeta{Name: leaderElectionRoleName, Namespace: opts.Namespace},
+		Rules: []rbacv1.PolicyRule{
+			{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: verbs},
+			{APIGroups: []string{"coordination.k8s.io"}, Resources: []string{"leases"}, Verbs: verbs},
+			{APIGroups: []string{""}, Resources: []string{"events"}, Verbs: []string{"create", "patch"}},
+		},
+	}
+}
+
+func leaderElectionRoleBinding(opts Options) *rbacv1.RoleBinding {
+	return &rbacv1.RoleBinding{
+		TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "RoleBinding"},
+		ObjectMeta: metav1.ObjectMeta{Name: leaderElectionRoleName, Namespace: opts.Namespace},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "Role",
+			Name:     leaderElectionRoleName,
+		},
+		Subjects: serviceAccountSubject(opts),
+	}
+}
+
+func dataPVC(opts Options, size resource.Quantity) *corev1.PersistentVolumeClaim {
+	pvc := &corev1.PersistentVolumeClaim{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "PersistentVolumeClaim"},
+		ObjectMeta: metav1.ObjectMeta{Name: dataPVCName, Namespace: opts.Namespace},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			// the manager and server share the volume from the same pod
+			AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: size},
+			},
+		},
+	}
+	// mirrors mount the volume from other nodes
+	if opts.MirrorReplicas > 0 {
+		pvc.Spec.AccessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany}
+	}
+	if opts.StorageClassName != "" {
+		pvc.Spec.StorageClassName = &opts.StorageClassName
+	}
+	return pvc
+}
+
+func containerSecurityContext() *corev1.SecurityContext {
+	f := false
+	return &corev1.SecurityContext{
+		AllowPrivilegeEscalation: &f,
+		Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+	}
+}
+
+func containerResources() corev1.ResourceRequirements {
+	return corev1.ResourceRequirements{
+		Limits: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("500m"),
+			corev1.ResourceMemory: resource.MustParse("128Mi"),
+		},
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("10m"),
+			corev1.ResourceMemory: resource.MustParse("64Mi"),
+		},
+	}
+}
+
+func deployment(opts Options) *appsv1.Deployment {
+	replicas := int32(1)
+	gracePeriod := int64(10)
+	port := strconv.Itoa(int(opts.ServicePort))
+	dataMount := corev1.VolumeMount{Name: "data", MountPath: "/data"}
+
+	manager := corev1.Container{
+		Name:    "manager",
+		Image:   opts.Image,
+		Command: []string{"/manager"},
+		Args:    []string{"--leader-elect"},
+		// these must match the image Service so the URLs set on hosts resolve to the server
+		Env: []corev1.EnvVar{
+			{Name: "SERVICE_NAMESPACE", ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.namespace"}}},
+			{Name: "SERVICE_NAME", Value: opts.ServiceName},
+			{Name: "SERVICE_PORT", Value: port},
+			{Name: "SERVICE_SCHEME", Value: "http"},
+		},
+		Ports: []corev1.ContainerPort{{Name: "webhook-server", ContainerPort: 9443, Protocol: corev1.ProtocolTCP}},
+		LivenessProbe: &corev1.Probe{
+			ProbeHandler:        corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{Path: "/healthz", Port: intstr.FromInt(8081)}},
+			InitialDelaySeconds: 15,
+			PeriodSeconds:       20,
+		},
+		ReadinessProbe: &corev1.Probe{
+			ProbeHandler:        corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{Path: "/readyz", Port: intstr.FromInt(8081)}},
+			InitialDelaySeconds: 5,
+			PeriodSeconds:       10,
+		},
+		SecurityContext: containerSecurityContext(),
+		Resources:       containerResources(),
+		VolumeMounts: []corev1.VolumeMount{
+			dataMount,
+			{Name: "cert", MountPath: "/tmp/k8s-webhook-server/serving-certs", ReadOnly: true},
+		},
+	}
+
+	server := serverContainer(opts, dataMount)
+
+	return &appsv1.Deployment{
+		TypeMeta: metav1.TypeMeta{APIVersion: appsv1.SchemeGroupVersion.String(), Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      deploymentName,
+			Namespace: opts.Namespace,
+			Labels:    labels(),
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: labels()},
+			// the data volume can only be mounted by one pod at a time
+			Strategy: appsv1.DeploymentStrategy{Type: appsv1.RecreateDeploymentStrategyType},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: imageServerLabels(appLabel)},
+				Spec: corev1.PodSpec{
+					SecurityContext: podSecurityContext(),
+					Containers:      []corev1.Container{manager, server},
+					Volumes: []corev1.Volume{
+						{Name: "data", VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: dataPVCName}}},
+						{Name: "cert", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: webhookCertSecretName}}},
+					},
+					ServiceAccountName:            serviceAccountName,
+					TerminationGracePeriodSeconds: &gracePeriod,
+				},
+			},
+		},
+	}
+}
+
+func podSecurityContext() *corev1.PodSecurityContext {
+	nonRoot := true
+	return &corev1.PodSecurityContext{
+		RunAsNonRoot:   &nonRoot,
+		SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+	}
+}
+
+func serverContainer(opts Options, mounts ...corev1.VolumeMount) corev1.Container {
+	return corev1.Container{
+		Name:            "server",
+		Image:           opts.Image,
+		Command:         []string{"/server"},
+		Env:             []corev1.EnvVar{{Name: "FILESERVER_PORT", Value: strconv.Itoa(int(opts.ServicePort))}},
+		Ports:           []corev1.ContainerPort{{Name: serverPortName, ContainerPort: opts.ServicePort}},
+		SecurityContext: containerSecurityContext(),
+		Resources:       containerResources(),
+		VolumeMounts:    mounts,
+	}
+}
+
+// mirrorDeployment runs image servers without a manager which only read the data volume
+// Images are built in an emptyDir as nothing can be written to the volume
+func mirrorDeployment(opts Options) *appsv1.Deployment {
+	gracePeriod := int64(10)
+	server := serverContainer(opts,
+		corev1.VolumeMount{Name: "data", MountPath: "/data", ReadOnly: true},
+		corev1.VolumeMount{Name: "work", MountPath: "/tmp"},
+	)
+	server.Env = append(server.Env, corev1.EnvVar{Name: "FILESERVER_READ_ONLY", Value: "true"})
+	podLabels := imageServerLabels(mirrorAppLabel)
+
+	return &appsv1.Deployment{
+		TypeMeta: metav1.TypeMeta{APIVersion: appsv1.SchemeGroupVersion.String(), Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      mirrorDeploymentName,
+			Namespace: opts.Namespace,
+			Labels:    map[string]string{"app": mirrorAppLabel},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &opts.MirrorReplicas,
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": mirrorAppLabel}},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: podLabels},
+				Spec: corev1.PodSpec{
+					SecurityContext: podSecurityContext(),
+					Containers:      []corev1.Container{server},
+					// spread mirrors so each adds the bandwidth of another node
+					Affinity: &corev1.Affinity{PodAntiAffinity: &corev1.PodAntiAffinity{
+						PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{{
+							Weight: 100,
+							PodAffinityTerm: corev1.PodAffinityTerm{
+								LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": mirrorAppLabel}},
+								TopologyKey:   corev1.LabelHostname,
+							},
+						}},
+					}},
+					Volumes: []corev1.Volume{
+						{Name: "data", VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: dataPVCName, ReadOnly: true}}},
+						{Name: "work", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+					},
+					ServiceAccountName:            serviceAccountName,
+					TerminationGracePeriodSeconds: &gracePeriod,
+				},
+			},
+		},
+	}
+}
+
+func imageService(opts Options) *corev1.Service {
+	return &corev1.Service{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Service"},
+		ObjectMeta: metav1.ObjectMeta{Name: opts.ServiceName, Namespace: opts.Namespace},
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{{
+				Name:       serverPortName,
+				Port:       opts.ServicePort,
+				Protocol:   corev1.ProtocolTCP,
+				TargetPort: intstr.FromString(serverPortName),
+			}},
+			Selector: map[string]string{imageServerLabel: "true"},
+		},
+	}
+}
+
+func webhookService(opts Options) *corev1.Service {
+	return &corev1.Service{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Service"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      webhookServiceName,
+			Namespace: opts.Namespace,
+			Annotations: map[string]string{
+				"service.beta.openshift.io/serving-cert-secret-name": webhookCertSecretName,
+			},
+		},
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{{
+				Port:       443,
+				Protocol:   corev1.ProtocolTCP,
+				TargetPort: intstr.FromInt(9443),
+			}},
+			Selector: labels(),
+		},
+	}
+}
+
+func route(opts Options) *routev1.Route {
+	weight := int32(100)
+	return &routev1.Route{
+		TypeMeta:   metav1.TypeMeta{APIVersion: routev1.GroupVersion.String(), Kind: "Route"},
+		ObjectMeta: metav1.ObjectMeta{Name: opts.ServiceName, Namespace: opts.Namespace},
+		Spec: routev1.RouteSpec{
+			Host: opts.RouteHost,
+			To: routev1.RouteTargetReference{
+				Kind:   "Service",
+				Name:   opts.ServiceName,
+				Weight: &weight,
+			},
+			Port: &routev1.RoutePort{TargetPort: intstr.FromString(serverPortName)},
+			TLS: &routev1.TLSConfig{
+				Termination:                   routev1.TLSTerminationEdge,
+				InsecureEdgeTerminationPolicy: routev1.InsecureEdgeTerminationPolicyAllow,
+			},
+		},
+	}
+}
@@ -0,0 +1,194 @@
+package install
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	k8slabels "k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestInstall(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Install Suite")
+}
+
+var _ = Describe("Objects", func() {
+	var opts Options
+
+	BeforeEach(func() {
+		opts = DefaultOptions()
+		opts.ConfigDir = "../../config"
+		opts.Namespace = "relocation"
+		opts.Image = "registry.example.com/relocation:v1"
+	})
+
+	kinds := func(objs []runtime.Object) []string {
+		var res []string
+		for _, obj := range objs {
+			res = append(res, obj.GetObjectKind().GroupVersionKind().Kind)
+		}
+		return res
+	}
+
+	find := func(objs []runtime.Object, kind string) []runtime.Object {
+		var res []runtime.Object
+		for _, obj := range objs {
+			if obj.GetObjectKind().GroupVersionKind().Kind == kind {
+				res = append(res, obj)
+			}
+		}
+		return res
+	}
+
+	It("includes everything required to run the service", func() {
+		objs, err := Objects(opts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(kinds(objs)).To(ContainElements(
+			"Namespace", "CustomResourceDefinition", "ServiceAccount", "ClusterRole", "ClusterRoleBinding",
+			"Role", "RoleBinding", "PersistentVolumeClaim", "Deployment", "Service",
+			"MutatingWebhookConfiguration", "ValidatingWebhookConfiguration",
+		))
+		Expect(kinds(objs)).NotTo(ContainElement("Route"))
+		Expect(kinds(objs)[0]).To(Equal("Namespace"))
+
+		for _, obj := range objs {
+			o := obj.(client.Object)
+			switch o.GetObjectKind().GroupVersionKind().Kind {
+			case "Namespace", "CustomResourceDefinition", "ClusterRole", "ClusterRoleBinding",
+				"MutatingWebhookConfiguration", "ValidatingWebhookConfiguration":
+				Expect(o.GetNamespace()).To(BeEmpty())
+			default:
+				Expect(o.GetNamespace()).To(Equal("relocation"), o.GetName())
+			}
+		}
+	})
+
+	It("wires the service options into the manager", func() {
+		opts.ServiceName = "images"
+		opts.ServicePort = 8080
+		objs, err := Objects(opts)
+		Expect(err).NotTo(HaveOccurred())
+
+		deployments := find(objs, "Deployment")
+		Expect(deployments).To(HaveLen(1))
+		d := deployments[0].(*appsv1.Deployment)
+		Expect(d.Spec.Template.Spec.Containers).To(HaveLen(2))
+
+		manager := d.Spec.Template.Spec.Containers[0]
+		Expect(manager.Image).To(Equal(opts.Image))
+		Expect(manager.Env).To(ContainElements(
+			corev1.EnvVar{Name: "SERVICE_NAME", Value: "images"},
+			corev1.EnvVar{Name: "SERVICE_PORT", Value: "8080"},
+		))
+		server := d.Spec.Template.Spec.Containers[1]
+		Expect(server.Env).To(ContainElement(corev1.EnvVar{Name: "FILESERVER_PORT", Value: "8080"}))
+
+		var serviceNames []string
+		for _, s := range find(objs, "Service") {
+			serviceNames = append(serviceNames, s.(*corev1.Service).Name)
+		}
+		Expect(serviceNames).To(ConsistOf("images", "webhook-service"))
+	})
+
+	It("points the webhooks at the webhook service in the install namespace", func() {
+		objs, err := Objects(opts)
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, obj := range append(find(objs, "MutatingWebhookConfiguration"), find(objs, "ValidatingWebhookConfiguration")...) {
+			u := obj.(*unstructured.Unstructured)
+			Expect(u.GetAnnotations()).To(HaveKeyWithValue("service.beta.openshift.io/inject-cabundle", "true"))
+			webhooks, _, err := unstructured.NestedSlice(u.Object, "webhooks")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(webhooks).NotTo(BeEmpty())
+			for _, wh := range webhooks {
+				ns, _, err := unstructured.NestedString(wh.(map[string]interface{}), "clientConfig", "service", "namespace")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ns).To(Equal("relocation"))
+			}
+		}
+	})
+
+	It("optionally creates a route and sets the storage class", func() {
+		opts.Route = true
+		opts.StorageClassName = "fast"
+		objs, err := Objects(opts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(find(objs, "Route")).To(HaveLen(1))
+
+		pvc := find(objs, "PersistentVolumeClaim")[0].(*corev1.PersistentVolumeClaim)
+		Expect(pvc.Spec.StorageClassName).To(HaveValue(Equal("fast")))
+	})
+
+	It("optionally adds read-only image server mirrors", func() {
+		opts.MirrorReplicas = 3
+		objs, err := Objects(opts)
+		Expect(err).NotTo(HaveOccurred())
+
+		deployments := find(objs, "Deployment")
+		Expect(deployments).To(HaveLen(2))
+		primary := deployments[0].(*appsv1.Deployment)
+		mirror := deployments[1].(*appsv1.Deployment)
+		Expect(mirror.Spec.Replicas).To(HaveValue(Equal(int32(3))))
+		Expect(mirror.Spec.Template.Spec.Containers).To(HaveLen(1))
+		server := mirror.Spec.Template.Spec.Containers[0]
+		Expect(server.Command).To(Equal([]string{"/server"}))
+		Expect(server.Env).To(ContainElement(corev1.EnvVar{Name: "FILESERVER_READ_ONLY", Value: "true"}))
+		Expect(server.VolumeMounts).To(ContainElement(corev1.VolumeMount{Name: "data", MountPath: "/data", ReadOnly: true}))
+
+		// the deployments must not select each other's pods
+		for _, d := range []*appsv1.Deployment{primary, mirror} {
+			for _, other := range []*appsv1.Deployment{primary, mirror} {
+				selector, err := metav1.LabelSelectorAsSelector(d.Spec.Selector)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(selector.Matches(k8slabels.Set(other.Spec.Template.Labels))).To(Equal(d == other))
+			}
+		}
+
+		// both serve images but only the manager serves webhooks
+		for _, obj := range find(objs, "Service") {
+			svc := obj.(*corev1.Service)
+			selector := k8slabels.SelectorFromSet(svc.Spec.Selector)
+			Expect(selector.Matches(k8slabels.Set(primary.Spec.Template.Labels))).To(BeTrue(), svc.Name)
+			Expect(selector.Matches(k8slabels.Set(mirror.Spec.Template.Labels))).To(Equal(svc.Name == opts.ServiceName), svc.Name)
+		}
+
+		pvc := find(objs, "PersistentVolumeClaim")[0].(*corev1.PersistentVolumeClaim)
+		Expect(pvc.Spec.AccessModes).To(ConsistOf(corev1.ReadWriteMany))
+	})
+
+	It("rejects missing options", func() {
+		opts.Image = ""
+		_, err := Objects(opts)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("fails when the generated manifests are missing", func() {
+		opts.ConfigDir = GinkgoT().TempDir()
+		_, err := Objects(opts)
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("Write", func() {
+	It("writes a document for each object without empty status", func() {
+		opts := DefaultOptions()
+		opts.ConfigDir = "../../config"
+
+		objs, err := Objects(opts)
+		Expect(err).NotTo(HaveOccurred())
+
+		out := &bytes.Buffer{}
+		Expect(Write(out, opts)).To(Succeed())
+		Expect(bytes.Count(out.Bytes(), []byte("---\n"))).To(Equal(len(objs)))
+		Expect(out.String()).NotTo(MatchRegexp(`(?m)^\s*creationTimestamp:`))
+		Expect(out.String()).NotTo(MatchRegexp("(?m)^status:"))
+	})
+})
@@ -0,0 +1,536 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package isostream generates ISO 9660 images from a set of files as they are read, without writing the image
+//
+// The layout of an image is computed from the size of each file up front so an Image has a known size and can be
+// read at any offset, which lets it be served with ranges or uploaded like a file. Only the volume descriptors,
+// path tables and directories are kept in memory, file content is read from the files while the image is read.
+// Files are named with Rock Ridge entries, the plain ISO 9660 names are mangled to 8.3 upper case names.
+package isostream
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	sectorSize = 2048
+	// systemAreaSectors are left empty at the start of the image
+	systemAreaSectors = 16
+	// maxNameLength keeps a directory record with its Rock Ridge entries under the 255 byte record limit
+	maxNameLength = 150
+
+	rockRidgeID          = "RRIP_1991A"
+	rockRidgeDescription = "THE ROCK RIDGE INTERCHANGE PROTOCOL PROVIDES SUPPORT FOR POSIX FILE SYSTEM SEMANTICS"
+)
+
+// File is a file added to an image
+type File struct {
+	// Path is the slash separated path of the file in the image
+	Path string
+	// Size is the number of bytes of Content in the image
+	Size int64
+	// Mode holds the permission bits recorded for the file
+	Mode fs.FileMode
+	// Content is read while the image is read and must not change until then
+	Content io.ReaderAt
+}
+
+// Image is an ISO 9660 image read from its files on demand
+// An Image is not safe for concurrent use through Read and Seek, ReadAt may be called concurrently
+type Image struct {
+	// head holds everything before the first file
+	head  []byte
+	files []extent
+	size  int64
+
+	offset int64
+}
+
+// extent is the content of a file at an offset in the image
+type extent struct {
+	offset  int64
+	size    int64
+	content io.ReaderAt
+}
+
+// node is a directory or file of the image being laid out
+type node struct {
+	name     string
+	isoName  string
+	file     *File
+	children []*node
+	parent   *node
+	// number is the position of a directory in the path table, starting at 1 for the root
+	number int
+	// sector and length locate the directory records or file content
+	sector int64
+	length int64
+}
+
+func (n *node) isDir() bool {
+	return n.file == nil
+}
+
+// New lays out an image labeled label holding files, modTime is recorded as the time of every file and directory
+func New(label string, modTime time.Time, files []File) (*Image, error) {
+	root := &node{}
+	for i := range files {
+		if err := root.add(&files[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	// directories are numbered breadth first with the children of each in name order, as the path table requires
+	dirs := []*node{root}
+	for i := 0; i < len(dirs); i++ {
+		dir := dirs[i]
+		dir.number = i + 1
+		assignISONames(dir.children)
+		for _, c := range dir.children {
+			if c.isDir() {
+				dirs = append(dirs, c)
+			}
+		}
+	}
+
+	pathTableSize := 0
+	for _, d := range dirs {
+		pathTableSize += len(pathTableRecord(d, binary.LittleEndian))
+	}
+	pathTableSectors := sectors(int64(pathTableSize))
+	lPathTable := int64(systemAreaSectors + 2)
+	mPathTable := lPathTable + pathTableSectors
+
+	sector := mPathTable + pathTableSectors
+	for _, d := range dirs {
+		d.sector = sector
+		d.length = sectors(d.recordsSize()) * sectorSize
+		sector += d.length / sectorSize
+	}
+	img := &Image{}
+	for _, d := range dirs {
+		for _, c := range d.children {
+			if c.isDir() {
+				continue
+			}
+			c.sector = sector
+			c.length = c.file.Size
+			img.files = append(img.files, extent{offset: sector * sectorSize, size: c.file.Size, content: c.file.Content})
+			sector += sectors(c.file.Size)
+		}
+	}
+	// a volume always has at least one sector after its directories
+	if len(img.files) == 0 {
+		sector++
+	}
+	img.size = sector * sectorSize
+
+	head := make([]byte, systemAreaSectors*sectorSize, dirs[0].sector*sectorSize)
+	head = append(head, primaryVolumeDescriptor(label, modTime, sector, pathTableSize, lPathTable, mPathTable, root)...)
+	head = append(head, terminator()...)
+	head = append(head, pathTable(dirs, binary.LittleEndian, pathTableSectors)...)
+	head = append(head, pathTable(dirs, binary.BigEndian, pathTableSectors)...)
+	for _, d := range dirs {
+		head = append(head, d.records(modTime)...)
+	}
+	img.head = head
+	return img, nil
+}
+
+// add places f in the tree below n
+func (n *node) add(f *File) error {
+	if !fs.ValidPath(f.Path) || f.Path == "." {
+		return fmt.Errorf("invalid file path %q", f.Path)
+	}
+	if f.Size < 0 {
+		return fmt.Errorf("invalid size %d for %s", f.Size, f.Path)
+	}
+	parts := strings.Split(f.Path, "/")
+	dir := n
+	for i, part := range parts {
+		if len(part) > maxNameLength {
+			return fmt.Errorf("name %q in %s is longer than %d bytes", part, f.Path, maxNameLength)
+		}
+		child := dir.child(part)
+		if i == len(parts)-1 {
+			if child != nil {
+				return fmt.Errorf("%s was added more than once", f.Path)
+			}
+			dir.children = append(dir.children, &node{name: part, file: f, parent: dir})
+			return nil
+		}
+		if child == nil {
+			child = &node{name: part, parent: dir}
+			dir.children = append(dir.children, child)
+		} else if !child.isDir() {
+			return fmt.Errorf("%s is both a file and a directory", path.Join(parts[:i+1]...))
+		}
+		dir = child
+	}
+	return nil
+}
+
+func (n *node) child(name string) *node {
+	for _, c := range n.children {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// assignISONames gives each node a unique 8.3 name and sorts them by it
+func assignISONames(nodes []*node) {
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].name < nodes[j].name })
+	used := map[string]bool{}
+	for _, n := range nodes {
+		base, ext := n.name, ""
+		if !n.isDir() {
+			if i := strings.LastIndex(n.name, "."); i > 0 {
+				base, ext = n.name[:i], n.name[i+1:]
+			}
+		}
+		base, ext = dChars(base, 8), dChars(ext, 3)
+		if base == "" {
+			base = "_"
+		}
+		name := isoIdentifier(base, ext, n.isDir())
+		for i := 1; used[name]; i++ {
+			suffix := strconv.Itoa(i)
+			b := base
+			if len(b)+len(suffix) > 8 {
+				b = b[:8-len(suffix)]
+			}
+			name = isoIdentifier(b+suffix, ext, n.isDir())
+		}
+		used[name] = true
+		n.isoName = name
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].isoName < nodes[j].isoName })
+}
+
+func isoIdentifier(base, ext string, dir bool) string {
+	if dir {
+		return base
+	}
+	return base + "." + ext + ";1"
+}
+
+// dChars returns s in upper case with characters ISO 9660 doesn't allow in names replaced, cut to max characters
+func dChars(s string, max int) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(s) {
+		if b.Len() == max {
+			break
+		}
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+// recordsSize returns the size of the records of a directory, records don't cross sector boundaries
+func (n *node) recordsSize() int64 {
+	var size int64
+	add := func(l int) {
+		if size%sectorSize+int64(l) > sectorSize {
+			size += sectorSize - size%sectorSize
+		}
+		size += int64(l)
+	}
+	add(len(n.record(n, "\x00", time.Time{})))
+	add(len(n.record(n.parentDir(), "\x01", time.Time{})))
+	for _, c := range n.children {
+		add(len(n.record(c, c.isoName, time.Time{})))
+	}
+	return size
+}
+
+// records returns the sectors holding the records of a directory
+func (n *node) records(modTime time.Time) []byte {
+	b := make([]byte, 0, n.length)
+	add := func(r []byte) {
+		if len(b)%sectorSize+len(r) > sectorSize {
+			b = append(b, make([]byte, sectorSize-len(b)%sectorSize)...)
+		}
+		b = append(b, r...)
+	}
+	add(n.record(n, "\x00", modTime))
+	add(n.record(n.parentDir(), "\x01", modTime))
+	for _, c := range n.children {
+		add(n.record(c, c.isoName, modTime))
+	}
+	return append(b, make([]byte, int(n.length)-len(b))...)
+}
+
+func (n *node) parentDir() *node {
+	if n.parent == nil {
+		return n
+	}
+	return n.parent
+}
+
+// record returns the directory record of target in n with the ISO 9660 identifier id
+func (n *node) record(target *node, id string, modTime time.Time) []byte {
+	r := make([]byte, 33, 255)
+	bothUint32(r[2:10], uint32(target.sector))
+	bothUint32(r[10:18], uint32(target.length))
+	copy(r[18:25], recordTime(modTime))
+	if target.isDir() {
+		r[25] = 0x02
+	}
+	bothUint16(r[28:32], 1)
+	r[32] = byte(len(id))
+	r = append(r, id...)
+	if len(id)%2 == 0 {
+		r = append(r, 0)
+	}
+
+	// the root's own record announces the Rock Ridge entries
+	self := id == "\x00"
+	if self && n.parent == nil {
+		r = append(r, 'S', 'P', 7, 1, 0xBE, 0xEF, 0)
+		er := []byte{'E', 'R', 0, 1, byte(len(rockRidgeID)), byte(len(rockRidgeDescription)), 0, 1}
+		er = append(append(er, rockRidgeID...), rockRidgeDescription...)
+		er[2] = byte(len(er))
+		r = append(r, er...)
+	}
+	mode := uint32(0o100000) | uint32(0o444)
+	links := uint32(1)
+	if target.isDir() {
+		mode = 0o040000 | 0o555
+		links = 2
+	} else if target.file.Mode&0o111 != 0 {
+		mode |= 0o111
+	}
+	px := make([]byte, 36)
+	copy(px, []byte{'P', 'X', 36, 1})
+	bothUint32(px[4:12], mode)
+	bothUint32(px[12:20], links)
+	r = append(r, px...)
+	if id != "\x00" && id != "\x01" {
+		r = append(r, 'N', 'M', byte(5+len(target.name)), 1, 0)
+		r = append(r, target.name...)
+	}
+	r[0] = byte(len(r))
+	return r
+}
+
+// pathTableRecord returns the path table record of directory d with numbers in order
+func pathTableRecord(d *node, order binary.ByteOrder) []byte {
+	id := d.isoName
+	parent := 1
+	if d.parent == nil {
+		id = "\x00"
+	} else {
+		parent = d.parent.number
+	}
+	r := make([]byte, 8, 8+len(id)+1)
+	r[0] = byte(len(id))
+	order.PutUint32(r[2:6], uint32(d.sector))
+	order.PutUint16(r[6:8], uint16(parent))
+	r = append(r, id...)
+	if len(id)%2 == 1 {
+		r = append(r, 0)
+	}
+	return r
+}
+
+func pathTable(dirs []*node, order binary.ByteOrder, sectorCount int64) []byte {
+	b := make([]byte, 0, sectorCount*sectorSize)
+	for _, d := range dirs {
+		b = append(b, pathTableRecord(d, order)...)
+	}
+	return append(b, make([]byte, int(sectorCount*sectorSize)-len(b))...)
+}
+
+func primaryVolumeDescriptor(label string, modTime time.Time, volumeSectors int64, pathTableSize int, lPathTable, mPathTable int64, root *node) []byte {
+	b := make([]byte, sectorSize)
+	b[0] = 1
+	copy(b[1:6], "CD001")
+	b[6] = 1
+	padded(b[8:40], "")
+	padded(b[40:72], label)
+	bothUint32(b[80:88], uint32(volumeSectors))
+	bothUint16(b[120:124], 1)
+	bothUint16(b[124:128], 1)
+	bothUint16(b[128:132], sectorSize)
+	bothUint32(b[132:140], uint32(pathTableSize))
+	binary.LittleEndian.PutUint32(b[140:144], uint32(lPathTable))
+	binary.BigEndian.PutUint32(b[148:152], uint32(mPathTable))
+	rootRecord := make([]byte, 34)
+	rootRecord[0] = 34
+	bothUint32(rootRecord[2:10], uint32(root.sector))
+	bothUint32(rootRecord[10:18], uint32(root.length))
+	copy(rootRecord[18:25], recordTime(modTime))
+	rootRecord[25] = 0x02
+	bothUint16(rootRecord[28:32], 1)
+	rootRecord[32] = 1
+	copy(b[156:190], rootRecord)
+	padded(b[190:813], "")
+	created := descriptorTime(modTime)
+	copy(b[813:830], created)
+	copy(b[830:847], created)
+	copy(b[847:864], descriptorTime(time.Time{}))
+	copy(b[864:881], created)
+	b[881] = 1
+	return b
+}
+
+func terminator() []byte {
+	b := make([]byte, sectorSize)
+	b[0] = 255
+	copy(b[1:6], "CD001")
+	b[6] = 1
+	return b
+}
+
+// padded copies s into b and fills the rest with spaces
+func padded(b []byte, s string) {
+	n := copy(b, s)
+	for i := n; i < len(b); i++ {
+		b[i] = ' '
+	}
+}
+
+func bothUint16(b []byte, v uint16) {
+	binary.LittleEndian.PutUint16(b[0:2], v)
+	binary.BigEndian.PutUint16(b[2:4], v)
+}
+
+func bothUint32(b []byte, v uint32) {
+	binary.LittleEndian.PutUint32(b[0:4], v)
+	binary.BigEndian.PutUint32(b[4:8], v)
+}
+
+// recordTime returns t in the 7 byte format of directory records
+func recordTime(t time.Time) []byte {
+	if t.IsZero() {
+		return make([]byte, 7)
+	}
+	t = t.UTC()
+	return []byte{byte(t.Year() - 1900), byte(t.Month()), byte(t.Day()), byte(t.Hour()), byte(t.Minute()), byte(t.Second()), 0}
+}
+
+// descriptorTime returns t in the 17 byte format of volume descriptors, the zero time is recorded as unset
+func descriptorTime(t time.Time) []byte {
+	if t.IsZero() {
+		return append([]byte("0000000000000000"), 0)
+	}
+	return append([]byte(t.UTC().Format("20060102150405")+"00"), 0)
+}
+
+func sectors(size int64) int64 {
+	return (size + sectorSize - 1) / sectorSize
+}
+
+// Size returns the size of the image in bytes
+func (img *Image) Size() int64 {
+	return img.size
+}
+
+// ReadAt reads len(p) bytes of the image at off
+func (img *Image) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if off >= img.size {
+		return 0, io.EOF
+	}
+	n := len(p)
+	var err error
+	if rest := img.size - off; int64(n) > rest {
+		n = int(rest)
+		err = io.EOF
+	}
+	p = p[:n]
+	for i := range p {
+		p[i] = 0
+	}
+
+	if off < int64(len(img.head)) {
+		copy(p, img.head[off:])
+	}
+	// the first extent ending after off
+	i := sort.Search(len(img.files), func(i int) bool { return img.files[i].offset+img.files[i].size > off })
+	for ; i < len(img.files) && img.files[i].offset < off+int64(n); i++ {
+		e := img.files[i]
+		start, end := max64(e.offset, off), min64(e.offset+e.size, off+int64(n))
+		read, readErr := e.content.ReadAt(p[start-off:end-off], start-e.offset)
+		if int64(read) < end-start {
+			if readErr == nil || readErr == io.EOF {
+				readErr = io.ErrUnexpectedEOF
+			}
+			return int(start - off), fmt.Errorf("failed to read file content: %w", readErr)
+		}
+	}
+	return n, err
+}
+
+// Read reads the image from the current offset
+func (img *Image) Read(p []byte) (int, error) {
+	n, err := img.ReadAt(p, img.offset)
+	img.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek sets the offset of the next Read
+func (img *Image) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += img.offset
+	case io.SeekEnd:
+		offset += img.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative offset")
+	}
+	img.offset = offset
+	return offset, nil
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
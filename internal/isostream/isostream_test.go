@@ -0,0 +1,160 @@
+package isostream
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/diskfs/go-diskfs"
+	"github.com/diskfs/go-diskfs/filesystem"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestIsostream(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Isostream Suite")
+}
+
+var _ = Describe("Image", func() {
+	modTime := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	file := func(path, content string) File {
+		return File{Path: path, Size: int64(len(content)), Mode: 0600, Content: strings.NewReader(content)}
+	}
+
+	// open writes img to a file and opens its filesystem with diskfs
+	open := func(img *Image) filesystem.FileSystem {
+		f, err := os.CreateTemp("", "isostream_test")
+		ExpectWithOffset(1, err).NotTo(HaveOccurred())
+		DeferCleanup(os.Remove, f.Name())
+		n, err := io.Copy(f, img)
+		ExpectWithOffset(1, err).NotTo(HaveOccurred())
+		ExpectWithOffset(1, n).To(Equal(img.Size()))
+		ExpectWithOffset(1, f.Close()).To(Succeed())
+
+		d, err := diskfs.Open(f.Name(), diskfs.WithOpenMode(diskfs.ReadOnly))
+		ExpectWithOffset(1, err).NotTo(HaveOccurred())
+		DeferCleanup(d.File.Close)
+		fsys, err := d.GetFilesystem(0)
+		ExpectWithOffset(1, err).NotTo(HaveOccurred())
+		return fsys
+	}
+
+	readFile := func(fsys filesystem.FileSystem, path string) string {
+		f, err := fsys.OpenFile(path, os.O_RDONLY)
+		ExpectWithOffset(1, err).NotTo(HaveOccurred())
+		content, err := io.ReadAll(f)
+		ExpectWithOffset(1, err).NotTo(HaveOccurred())
+		return string(content)
+	}
+
+	It("holds the files with their names and the label", func() {
+		large := strings.Repeat("0123456789", 1000)
+		img, err := New("relocation-config", modTime, []File{
+			file("cluster-relocation.json", `{"domain":"example.com"}`),
+			file("extra-manifests/config-map-one.yaml", "one"),
+			file("extra-manifests/config-map-two.yaml", "two"),
+			file("extra-manifests/nested/deep/large.bin", large),
+			file("empty", ""),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(img.Size() % sectorSize).To(BeZero())
+
+		fsys := open(img)
+		Expect(strings.TrimRight(fsys.Label(), "\x00 ")).To(Equal("relocation-config"))
+		Expect(readFile(fsys, "/cluster-relocation.json")).To(Equal(`{"domain":"example.com"}`))
+		Expect(readFile(fsys, "/extra-manifests/config-map-one.yaml")).To(Equal("one"))
+		Expect(readFile(fsys, "/extra-manifests/config-map-two.yaml")).To(Equal("two"))
+		Expect(readFile(fsys, "/extra-manifests/nested/deep/large.bin")).To(Equal(large))
+		Expect(readFile(fsys, "/empty")).To(BeEmpty())
+
+		entries, err := fsys.ReadDir("/extra-manifests")
+		Expect(err).NotTo(HaveOccurred())
+		names := []string{}
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		Expect(names).To(ConsistOf("config-map-one.yaml", "config-map-two.yaml", "nested"))
+	})
+
+	It("splits directories with many entries across sectors", func() {
+		files := []File{}
+		for i := 0; i < 100; i++ {
+			files = append(files, file(fmt.Sprintf("extra-manifest-with-a-long-name-%03d.yaml", i), "content"))
+		}
+		img, err := New("many", modTime, files)
+		Expect(err).NotTo(HaveOccurred())
+
+		fsys := open(img)
+		entries, err := fsys.ReadDir("/")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(len(files)))
+		Expect(readFile(fsys, "/"+files[99].Path)).To(Equal("content"))
+	})
+
+	It("reads the same bytes at any offset", func() {
+		img, err := New("offsets", modTime, []File{
+			file("a.json", strings.Repeat("a", 3000)),
+			file("b.json", strings.Repeat("b", 10)),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		whole, err := io.ReadAll(img)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(int64(len(whole))).To(Equal(img.Size()))
+
+		for _, off := range []int64{0, 1, sectorSize - 1, 20 * sectorSize, img.Size() - 5000, img.Size() - 1} {
+			p := make([]byte, 4096)
+			n, err := img.ReadAt(p, off)
+			if off+int64(len(p)) > img.Size() {
+				Expect(err).To(Equal(io.EOF))
+			} else {
+				Expect(err).NotTo(HaveOccurred())
+			}
+			Expect(p[:n]).To(Equal(whole[off : off+int64(n)]))
+		}
+
+		_, err = img.Seek(-10, io.SeekEnd)
+		Expect(err).NotTo(HaveOccurred())
+		rest, err := io.ReadAll(img)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rest).To(Equal(whole[len(whole)-10:]))
+	})
+
+	It("is the same for the same files", func() {
+		files := []File{file("a.json", "a"), file("dir/b.json", "b")}
+		first, err := New("same", modTime, files)
+		Expect(err).NotTo(HaveOccurred())
+		second, err := New("same", modTime, []File{file("dir/b.json", "b"), file("a.json", "a")})
+		Expect(err).NotTo(HaveOccurred())
+
+		a, err := io.ReadAll(first)
+		Expect(err).NotTo(HaveOccurred())
+		b, err := io.ReadAll(second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bytes.Equal(a, b)).To(BeTrue())
+	})
+
+	It("fails for content shorter than its size", func() {
+		img, err := New("short", modTime, []File{{Path: "a.json", Size: 10, Content: strings.NewReader("a")}})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = io.ReadAll(img)
+		Expect(err).To(MatchError(io.ErrUnexpectedEOF))
+	})
+
+	DescribeTable("rejects invalid files",
+		func(files []File, message string) {
+			_, err := New("invalid", modTime, files)
+			Expect(err).To(MatchError(ContainSubstring(message)))
+		},
+		Entry("absolute paths", []File{file("/etc/passwd", "")}, "invalid file path"),
+		Entry("paths outside the image", []File{file("../a", "")}, "invalid file path"),
+		Entry("duplicates", []File{file("a", ""), file("a", "")}, "more than once"),
+		Entry("files used as directories", []File{file("a", ""), file("a/b", "")}, "both a file and a directory"),
+		Entry("long names", []File{file(strings.Repeat("a", 200), "")}, "longer than"),
+	)
+})
@@ -0,0 +1,16 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	// AuditDiscrepancies is the number of discrepancies of each kind found by the last consistency audit
+	AuditDiscrepancies = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "clusterconfig_audit_discrepancies",
+		Help: "Number of discrepancies of each kind found by the last consistency audit",
+	}, []string{"reason"})
+	// AuditLastRun is the time the last consistency audit completed
+	AuditLastRun = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "clusterconfig_audit_last_run_timestamp_seconds",
+		Help: "Unix time the last consistency audit completed",
+	})
+)
@@ -0,0 +1,27 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Image builds are observed without per-ClusterConfig labels, the latest build of each is in its status
+var (
+	// ImageBuildSize is the size of each image built for a ClusterConfig
+	ImageBuildSize = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name: "clusterconfig_image_build_size_bytes",
+		Help: "Size of the images built for ClusterConfigs",
+		// 64KiB to 16GiB
+		Buckets: prometheus.ExponentialBuckets(64*1024, 4, 10),
+	})
+	// ImageBuildDuration is how long each image built for a ClusterConfig took to build
+	ImageBuildDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name: "clusterconfig_image_build_duration_seconds",
+		Help: "Time taken to build the images for ClusterConfigs",
+		// 10ms to about 5 minutes
+		Buckets: prometheus.ExponentialBuckets(0.01, 2.5, 12),
+	})
+	// ImageBuildFiles is the number of payload files in each image built for a ClusterConfig
+	ImageBuildFiles = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "clusterconfig_image_build_files",
+		Help:    "Number of payload files in the images built for ClusterConfigs",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 10),
+	})
+)
@@ -0,0 +1,191 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var (
+	phaseDesc = prometheus.NewDesc(
+		"clusterconfig_phase",
+		"The current phase of the ClusterConfig, 1 for the current phase",
+		[]string{"namespace", "name", "phase"}, nil,
+	)
+	timeInPhaseDesc = prometheus.NewDesc(
+		"clusterconfig_time_in_phase_seconds",
+		"Time the ClusterConfig has spent in its current phase",
+		[]string{"namespace", "name", "phase"}, nil,
+	)
+	imageSizeDesc = prometheus.NewDesc(
+		"clusterconfig_image_size_bytes",
+		"Size of the most recently built image for the ClusterConfig",
+		[]string{"namespace", "name"}, nil,
+	)
+	lastDownloadDesc = prometheus.NewDesc(
+		"clusterconfig_image_last_download_timestamp_seconds",
+		"Unix time the image for the ClusterConfig was last downloaded",
+		[]string{"namespace", "name"}, nil,
+	)
+)
+
+type configSample struct {
+	phase        string
+	phaseSince   time.Time
+	imageSize    int64
+	lastDownload time.Time
+}
+
+// ClusterConfigCollector exports per-ClusterConfig samples labeled by namespace and name
+// At most maxConfigs ClusterConfigs are tracked to bound the metric cardinality, samples for any others are dropped
+// and counted in clusterconfig_metrics_samples_dropped_total
+// All methods are safe to call on a nil collector
+type ClusterConfigCollector struct {
+	// Log warns when samples start being dropped, nil doesn't log
+	Log logrus.FieldLogger
+
+	mu         sync.Mutex
+	maxConfigs int
+	configs    map[types.NamespacedName]*configSample
+	dropped    prometheus.Counter
+	// dropping is set once a sample has been dropped so the warning is only logged again after a config is deleted
+	dropping bool
+	now      func() time.Time
+}
+
+// NewClusterConfigCollector creates a collector tracking at most maxConfigs ClusterConfigs
+// A maxConfigs value of zero or less disables the limit
+func NewClusterConfigCollector(maxConfigs int) *ClusterConfigCollector {
+	return &ClusterConfigCollector{
+		maxConfigs: maxConfigs,
+		configs:    make(map[types.NamespacedName]*configSample),
+		dropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "clusterconfig_metrics_samples_dropped_total",
+			Help: "Number of ClusterConfig samples dropped because the cardinality limit was reached",
+		}),
+		now: time.Now,
+	}
+}
+
+// sample returns the stored sample for key, creating it if the limit allows
+// The caller must hold c.mu
+func (c *ClusterConfigCollector) sample(key types.NamespacedName) *configSample {
+	if s, ok := c.configs[key]; ok {
+		return s
+	}
+	if c.maxConfigs > 0 && len(c.configs) >= c.maxConfigs {
+		c.dropped.Inc()
+		if !c.dropping && c.Log != nil {
+			c.Log.WithFields(logrus.Fields{"namespace": key.Namespace, "name": key.Name}).Warnf(
+				"dropping samples of ClusterConfigs beyond the limit of %d, raise METRICS_MAX_CLUSTER_CONFIGS to export them", c.maxConfigs)
+		}
+		c.dropping = true
+		return nil
+	}
+	s := &configSample{}
+	c.configs[key] = s
+	return s
+}
+
+// SetPhase records the current phase of a ClusterConfig and when it was entered
+func (c *ClusterConfigCollector) SetPhase(key types.NamespacedName, phase string, since time.Time) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s := c.sample(key); s != nil {
+		s.phase = phase
+		s.phaseSince = since
+	}
+}
+
+// SetImageSize records the size of the most recently built image for a ClusterConfig
+func (c *ClusterConfigCollector) SetImageSize(key types.NamespacedName, size int64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s := c.sample(key); s != nil {
+		s.imageSize = size
+	}
+}
+
+// SetLastDownload records the time the image for a ClusterConfig was downloaded
+func (c *ClusterConfigCollector) SetLastDownload(key types.NamespacedName, t time.Time) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s := c.sample(key); s != nil {
+		s.lastDownload = t
+	}
+}
+
+// Delete removes all samples for a ClusterConfig
+func (c *ClusterConfigCollector) Delete(key types.NamespacedName) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.configs[key]; ok {
+		delete(c.configs, key)
+		c.dropping = false
+	}
+}
+
+// Prune removes the samples of the ClusterConfigs exists returns false for, for processes which don't see deletions
+// exists is called without holding the collector lock so it may be slow
+func (c *ClusterConfigCollector) Prune(exists func(key types.NamespacedName) bool) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	keys := make([]types.NamespacedName, 0, len(c.configs))
+	for key := range c.configs {
+		keys = append(keys, key)
+	}
+	c.mu.Unlock()
+
+	for _, key := range keys {
+		if !exists(key) {
+			c.Delete(key)
+		}
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *ClusterConfigCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- phaseDesc
+	ch <- timeInPhaseDesc
+	ch <- imageSizeDesc
+	ch <- lastDownloadDesc
+	c.dropped.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (c *ClusterConfigCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	for key, s := range c.configs {
+		if s.phase != "" {
+			ch <- prometheus.MustNewConstMetric(phaseDesc, prometheus.GaugeValue, 1, key.Namespace, key.Name, s.phase)
+			ch <- prometheus.MustNewConstMetric(timeInPhaseDesc, prometheus.GaugeValue, now.Sub(s.phaseSince).Seconds(), key.Namespace, key.Name, s.phase)
+		}
+		if s.imageSize != 0 {
+			ch <- prometheus.MustNewConstMetric(imageSizeDesc, prometheus.GaugeValue, float64(s.imageSize), key.Namespace, key.Name)
+		}
+		if !s.lastDownload.IsZero() {
+			ch <- prometheus.MustNewConstMetric(lastDownloadDesc, prometheus.GaugeValue, float64(s.lastDownload.Unix()), key.Namespace, key.Name)
+		}
+	}
+	c.dropped.Collect(ch)
+}
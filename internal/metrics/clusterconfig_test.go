@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestMetrics(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Metrics Suite")
+}
+
+func gather(c *ClusterConfigCollector) map[string]*dto.MetricFamily {
+	registry := prometheus.NewRegistry()
+	ExpectWithOffset(1, registry.Register(c)).To(Succeed())
+	families, err := registry.Gather()
+	ExpectWithOffset(1, err).NotTo(HaveOccurred())
+
+	res := make(map[string]*dto.MetricFamily)
+	for _, f := range families {
+		res[f.GetName()] = f
+	}
+	return res
+}
+
+func labels(m *dto.Metric) map[string]string {
+	res := make(map[string]string)
+	for _, l := range m.GetLabel() {
+		res[l.GetName()] = l.GetValue()
+	}
+	return res
+}
+
+var _ = Describe("ClusterConfigCollector", func() {
+	var (
+		c   *ClusterConfigCollector
+		now time.Time
+		key = types.NamespacedName{Namespace: "site-1", Name: "config"}
+	)
+
+	BeforeEach(func() {
+		c = NewClusterConfigCollector(2)
+		now = time.Unix(1700000000, 0)
+		c.now = func() time.Time { return now }
+	})
+
+	It("exports the phase and time in phase", func() {
+		c.SetPhase(key, "ImageReady", now.Add(-90*time.Second))
+
+		families := gather(c)
+		phase := families["clusterconfig_phase"].GetMetric()
+		Expect(phase).To(HaveLen(1))
+		Expect(labels(phase[0])).To(Equal(map[string]string{"namespace": "site-1", "name": "config", "phase": "ImageReady"}))
+		Expect(phase[0].GetGauge().GetValue()).To(Equal(float64(1)))
+
+		timeInPhase := families["clusterconfig_time_in_phase_seconds"].GetMetric()
+		Expect(timeInPhase).To(HaveLen(1))
+		Expect(timeInPhase[0].GetGauge().GetValue()).To(Equal(float64(90)))
+	})
+
+	It("exports the image size and last download time", func() {
+		c.SetImageSize(key, 4096)
+		c.SetLastDownload(key, now)
+
+		families := gather(c)
+		Expect(families).NotTo(HaveKey("clusterconfig_phase"))
+		Expect(families["clusterconfig_image_size_bytes"].GetMetric()[0].GetGauge().GetValue()).To(Equal(float64(4096)))
+		Expect(families["clusterconfig_image_last_download_timestamp_seconds"].GetMetric()[0].GetGauge().GetValue()).To(Equal(float64(now.Unix())))
+	})
+
+	It("drops samples beyond the cardinality limit", func() {
+		c.SetPhase(types.NamespacedName{Namespace: "site-1", Name: "a"}, "Pending", now)
+		c.SetPhase(types.NamespacedName{Namespace: "site-2", Name: "b"}, "Pending", now)
+		c.SetPhase(types.NamespacedName{Namespace: "site-3", Name: "c"}, "Pending", now)
+		// updates to tracked configs are still recorded
+		c.SetPhase(types.NamespacedName{Namespace: "site-1", Name: "a"}, "ImageReady", now)
+
+		families := gather(c)
+		Expect(families["clusterconfig_phase"].GetMetric()).To(HaveLen(2))
+		Expect(families["clusterconfig_metrics_samples_dropped_total"].GetMetric()[0].GetCounter().GetValue()).To(Equal(float64(1)))
+	})
+
+	It("removes samples for deleted configs", func() {
+		c.SetPhase(key, "Pending", now)
+		c.Delete(key)
+
+		families := gather(c)
+		Expect(families).NotTo(HaveKey("clusterconfig_phase"))
+
+		// the freed slot is available to other configs
+		c.SetPhase(types.NamespacedName{Namespace: "site-2", Name: "b"}, "Pending", now)
+		c.SetPhase(types.NamespacedName{Namespace: "site-3", Name: "c"}, "Pending", now)
+		Expect(gather(c)["clusterconfig_phase"].GetMetric()).To(HaveLen(2))
+	})
+
+	It("prunes samples for configs which no longer exist", func() {
+		other := types.NamespacedName{Namespace: "site-2", Name: "b"}
+		c.SetPhase(key, "Pending", now)
+		c.SetImageSize(other, 1)
+		c.Prune(func(k types.NamespacedName) bool { return k == other })
+
+		families := gather(c)
+		Expect(families).NotTo(HaveKey("clusterconfig_phase"))
+		Expect(families["clusterconfig_image_size_bytes"].GetMetric()).To(HaveLen(1))
+	})
+
+	It("is safe to use when nil", func() {
+		var nilCollector *ClusterConfigCollector
+		nilCollector.SetPhase(key, "Pending", now)
+		nilCollector.SetImageSize(key, 1)
+		nilCollector.SetLastDownload(key, now)
+		nilCollector.Delete(key)
+		nilCollector.Prune(func(types.NamespacedName) bool { return false })
+	})
+})
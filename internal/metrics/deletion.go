@@ -0,0 +1,10 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// DeletionCleanups is the number of deleted ClusterConfigs processed by the deletion queue by result
+// The queue depth and latency are reported by the workqueue metrics of the clusterconfig_deletion queue
+var DeletionCleanups = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "clusterconfig_deletion_cleanups_total",
+	Help: "Number of deleted ClusterConfigs processed by the deletion queue by result",
+}, []string{"result"})
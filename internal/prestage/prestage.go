@@ -0,0 +1,84 @@
+package prestage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// Publisher uploads built images to remote HTTP caches
+// Images are uploaded with a basic auth PUT, which WebDAV servers accept. S3 object stores require signed requests
+// so they need a proxy accepting basic auth in front of them
+// Credentials in the cache URL are sent as basic auth and are never part of the URL images are downloaded from
+type Publisher struct {
+	Client *http.Client
+}
+
+// Exists returns true if the cache already holds an image at dest
+func (p *Publisher) Exists(ctx context.Context, dest string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, dest, nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("unexpected status checking %s for an image: %s", DownloadURL(dest), resp.Status)
+	}
+}
+
+// Upload writes the file at path to dest
+func (p *Publisher) Upload(ctx context.Context, path, dest string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return p.UploadContent(ctx, f, info.Size(), dest)
+}
+
+// UploadContent writes size bytes read from content to dest
+func (p *Publisher) UploadContent(ctx context.Context, content io.Reader, size int64, dest string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, dest, content)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("failed to upload image to %s: %s", DownloadURL(dest), resp.Status)
+	}
+	return nil
+}
+
+// DownloadURL returns dest without the credentials used to upload to it
+func DownloadURL(dest string) string {
+	u, err := url.Parse(dest)
+	if err != nil {
+		return dest
+	}
+	u.User = nil
+	return u.String()
+}
@@ -0,0 +1,97 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var deferredDesc = prometheus.NewDesc(
+	"clusterconfig_bmh_patches_deferred_total",
+	"Number of BareMetalHost patches deferred by the patch rate limit",
+	nil, nil,
+)
+
+// KeyedLimiter limits the rate of writes to a set of objects
+// A deferred object holds its place in line, so repeated changes to it while it waits are coalesced
+// into a single write when its turn comes instead of each consuming a token
+// All methods are safe to call on a nil limiter which never defers
+type KeyedLimiter struct {
+	mu       sync.Mutex
+	limiter  *rate.Limiter
+	reserved map[types.NamespacedName]time.Time
+	deferred uint64
+	now      func() time.Time
+}
+
+// NewKeyedLimiter creates a limiter allowing qps writes per second with bursts of up to burst writes
+// A qps value of zero or less disables the limit and returns nil
+func NewKeyedLimiter(qps float64, burst int) *KeyedLimiter {
+	if qps <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &KeyedLimiter{
+		limiter:  rate.NewLimiter(rate.Limit(qps), burst),
+		reserved: make(map[types.NamespacedName]time.Time),
+		now:      time.Now,
+	}
+}
+
+// Delay returns how long the caller must wait before writing key, zero means the write can happen now
+// Callers that are told to wait should call Delay again once the time has passed
+func (l *KeyedLimiter) Delay(key types.NamespacedName) time.Duration {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if at, ok := l.reserved[key]; ok {
+		if now.Before(at) {
+			return at.Sub(now)
+		}
+		delete(l.reserved, key)
+		return 0
+	}
+
+	d := l.limiter.ReserveN(now, 1).DelayFrom(now)
+	if d <= 0 {
+		return 0
+	}
+	l.reserved[key] = now.Add(d)
+	l.deferred++
+	return d
+}
+
+// Forget releases any place in line held by key if it no longer needs to be written
+func (l *KeyedLimiter) Forget(key types.NamespacedName) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.reserved, key)
+}
+
+// Describe implements prometheus.Collector
+func (l *KeyedLimiter) Describe(ch chan<- *prometheus.Desc) {
+	ch <- deferredDesc
+}
+
+// Collect implements prometheus.Collector
+func (l *KeyedLimiter) Collect(ch chan<- prometheus.Metric) {
+	var deferred uint64
+	if l != nil {
+		l.mu.Lock()
+		deferred = l.deferred
+		l.mu.Unlock()
+	}
+	ch <- prometheus.MustNewConstMetric(deferredDesc, prometheus.CounterValue, float64(deferred))
+}
@@ -0,0 +1,84 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestRateLimit(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Rate Limit Suite")
+}
+
+var _ = Describe("KeyedLimiter", func() {
+	var (
+		l   *KeyedLimiter
+		now time.Time
+		a   = types.NamespacedName{Namespace: "ns", Name: "a"}
+		b   = types.NamespacedName{Namespace: "ns", Name: "b"}
+		c   = types.NamespacedName{Namespace: "ns", Name: "c"}
+	)
+
+	BeforeEach(func() {
+		now = time.Date(2023, time.June, 14, 12, 0, 0, 0, time.UTC)
+		l = NewKeyedLimiter(1, 1)
+		l.now = func() time.Time { return now }
+	})
+
+	deferred := func() float64 {
+		registry := prometheus.NewRegistry()
+		Expect(registry.Register(l)).To(Succeed())
+		families, err := registry.Gather()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(families).To(HaveLen(1))
+		return families[0].GetMetric()[0].GetCounter().GetValue()
+	}
+
+	It("allows writes within the burst", func() {
+		Expect(l.Delay(a)).To(BeZero())
+		Expect(deferred()).To(BeZero())
+	})
+
+	It("defers writes beyond the burst in order", func() {
+		Expect(l.Delay(a)).To(BeZero())
+		Expect(l.Delay(b)).To(Equal(time.Second))
+		Expect(l.Delay(c)).To(Equal(2 * time.Second))
+		Expect(deferred()).To(Equal(float64(2)))
+	})
+
+	It("coalesces repeated writes to a deferred key", func() {
+		Expect(l.Delay(a)).To(BeZero())
+		Expect(l.Delay(b)).To(Equal(time.Second))
+
+		now = now.Add(500 * time.Millisecond)
+		Expect(l.Delay(b)).To(Equal(500 * time.Millisecond))
+		Expect(deferred()).To(Equal(float64(1)))
+
+		now = now.Add(500 * time.Millisecond)
+		Expect(l.Delay(b)).To(BeZero())
+	})
+
+	It("releases the place of forgotten keys", func() {
+		Expect(l.Delay(a)).To(BeZero())
+		Expect(l.Delay(b)).To(Equal(time.Second))
+		l.Forget(b)
+
+		now = now.Add(time.Hour)
+		Expect(l.Delay(b)).To(BeZero())
+	})
+
+	It("never defers when disabled", func() {
+		l = NewKeyedLimiter(0, 0)
+		Expect(l).To(BeNil())
+		for i := 0; i < 10; i++ {
+			Expect(l.Delay(a)).To(BeZero())
+		}
+		l.Forget(a)
+		Expect(deferred()).To(BeZero())
+	})
+})
@@ -0,0 +1,120 @@
+// Package redact removes secret material from errors and log entries
+package redact
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"regexp"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Placeholder replaces redacted content
+const Placeholder = "[REDACTED]"
+
+// minValueLength is the shortest value redacted from errors
+// Shorter values are likely to match unrelated text and leak little when they don't
+const minValueLength = 4
+
+// redactedError has a message with secret values removed
+// The original error remains available to errors.Is and errors.As
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string { return e.msg }
+func (e *redactedError) Unwrap() error { return e.err }
+
+// Error returns err with each of values removed from its message
+// A nil error is returned unchanged
+func Error(err error, values ...[]byte) error {
+	if err == nil {
+		return nil
+	}
+	msg := []byte(err.Error())
+	redacted := Bytes(msg, values...)
+	if bytes.Equal(msg, redacted) {
+		return err
+	}
+	return &redactedError{msg: string(redacted), err: err}
+}
+
+// SecretError returns err with the values of s removed from its message
+func SecretError(err error, s *corev1.Secret) error {
+	if err == nil || s == nil {
+		return err
+	}
+	return Error(err, SecretValues(s)...)
+}
+
+// SecretValues returns the values of s in the forms they may appear in messages
+func SecretValues(s *corev1.Secret) [][]byte {
+	var values [][]byte
+	for _, v := range s.Data {
+		values = append(values, v, []byte(base64.StdEncoding.EncodeToString(v)))
+	}
+	for _, v := range s.StringData {
+		values = append(values, []byte(v), []byte(base64.StdEncoding.EncodeToString([]byte(v))))
+	}
+	return values
+}
+
+// Bytes replaces each of values in b with the placeholder
+func Bytes(b []byte, values ...[]byte) []byte {
+	// replace the longest values first so a value containing another is removed entirely
+	sorted := make([][]byte, len(values))
+	copy(sorted, values)
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+	for _, v := range sorted {
+		if len(v) < minValueLength {
+			continue
+		}
+		b = bytes.ReplaceAll(b, v, []byte(Placeholder))
+	}
+	return b
+}
+
+var (
+	// privateKeyPattern matches PEM encoded private keys, including those cut off by truncated messages
+	privateKeyPattern = regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?(-----END [A-Z ]*PRIVATE KEY-----|$)`)
+	// credentialPattern matches credentials in pull secrets and similar JSON documents, including escaped JSON
+	credentialPattern = regexp.MustCompile(`(\\?"(?:auth|password|token)\\?"\s*:\s*\\?")[^"\\]*`)
+	// urlPasswordPattern matches the password in URLs with user info
+	urlPasswordPattern = regexp.MustCompile(`(://[^/\s:@]*:)[^/\s@]+@`)
+)
+
+// String removes content which looks like secret material from s
+func String(s string) string {
+	s = privateKeyPattern.ReplaceAllString(s, Placeholder)
+	s = urlPasswordPattern.ReplaceAllString(s, "${1}"+Placeholder+"@")
+	return credentialPattern.ReplaceAllString(s, "${1}"+Placeholder)
+}
+
+// Hook is a logrus hook removing content which looks like secret material from log entries
+// It guards against secrets reaching the logs through errors which weren't redacted where they were created
+type Hook struct{}
+
+// Levels implements logrus.Hook
+func (Hook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire implements logrus.Hook
+func (Hook) Fire(entry *logrus.Entry) error {
+	entry.Message = String(entry.Message)
+	for k, v := range entry.Data {
+		switch val := v.(type) {
+		case string:
+			entry.Data[k] = String(val)
+		case error:
+			if msg := String(val.Error()); msg != val.Error() {
+				entry.Data[k] = errors.New(msg)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+// Package report sends problems found while reconciling to the log, Events and status conditions
+// in the same form so every feature reports them consistently
+package report
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// MaxMessageLength is the longest message accepted in a metav1.Condition
+const MaxMessageLength = 32768
+
+// maxSeen bounds the number of recently reported problems remembered for deduplication
+const maxSeen = 1024
+
+// SetCondition sets cond in conditions and returns false if it was already present
+// Only the status, reason, message and observed generation are compared so an unchanged condition isn't rewritten.
+// The message is summarized to fit in a condition
+func SetCondition(conditions *[]metav1.Condition, cond metav1.Condition) bool {
+	cond.Message = Summarize(cond.Message, MaxMessageLength)
+	existing := meta.FindStatusCondition(*conditions, cond.Type)
+	if existing != nil && existing.Status == cond.Status && existing.Reason == cond.Reason &&
+		existing.Message == cond.Message && existing.ObservedGeneration == cond.ObservedGeneration {
+		return false
+	}
+	meta.SetStatusCondition(conditions, cond)
+	return true
+}
+
+// Summarize collapses whitespace in message and truncates it to at most max bytes, ending with "..." if it was cut
+func Summarize(message string, max int) string {
+	message = strings.Join(strings.Fields(message), " ")
+	if len(message) <= max {
+		return message
+	}
+	// don't split a multi-byte character
+	end := max - len("...")
+	for end > 0 && (message[end]&0xC0) == 0x80 {
+		end--
+	}
+	return message[:end] + "..."
+}
+
+// Notifier logs problems and records them as Events on the object they concern
+// A problem reported again for the same object within Window is dropped so watches firing repeatedly
+// don't flood the log or the API server. All methods are safe to call on a nil Notifier which reports nothing
+type Notifier struct {
+	Log logrus.FieldLogger
+	// Recorder records the Events, nil only logs
+	Recorder record.EventRecorder
+	// Window is how long a repeated problem is suppressed, zero reports every time
+	Window time.Duration
+
+	mu   sync.Mutex
+	seen map[problem]time.Time
+	// now returns the current time, time.Now is used when it is nil
+	now func() time.Time
+}
+
+// problem identifies a reported problem for deduplication
+type problem struct {
+	kind, namespace, name, reason, message string
+}
+
+// Warningf logs a warning and records a Warning Event on obj with reason
+func (r *Notifier) Warningf(obj client.Object, reason, format string, args ...interface{}) {
+	r.report(obj, corev1.EventTypeWarning, reason, fmt.Sprintf(format, args...), nil)
+}
+
+// Normalf logs an informational message and records a Normal Event on obj with reason
+func (r *Notifier) Normalf(obj client.Object, reason, format string, args ...interface{}) {
+	r.report(obj, corev1.EventTypeNormal, reason, fmt.Sprintf(format, args...), nil)
+}
+
+// Error logs err as a warning and records a Warning Event on obj with reason and msg followed by the error
+func (r *Notifier) Error(obj client.Object, reason string, err error, msg string) {
+	r.report(obj, corev1.EventTypeWarning, reason, fmt.Sprintf("%s: %s", msg, err), err)
+}
+
+func (r *Notifier) report(obj client.Object, eventType, reason, message string, err error) {
+	if r == nil || r.duplicate(obj, reason, message) {
+		return
+	}
+
+	if r.Log != nil {
+		log := r.Log.WithFields(logrus.Fields{
+			"kind":      fmt.Sprintf("%T", obj),
+			"namespace": obj.GetNamespace(),
+			"name":      obj.GetName(),
+			"reason":    reason,
+		})
+		if err != nil {
+			log = log.WithError(err)
+		}
+		if eventType == corev1.EventTypeWarning {
+			log.Warn(message)
+		} else {
+			log.Info(message)
+		}
+	}
+	if r.Recorder != nil {
+		r.Recorder.Event(obj, eventType, reason, Summarize(message, MaxMessageLength))
+	}
+}
+
+// duplicate returns true if the same problem was reported for obj within the window and otherwise remembers it
+func (r *Notifier) duplicate(obj client.Object, reason, message string) bool {
+	if r.Window <= 0 {
+		return false
+	}
+	now := time.Now
+	if r.now != nil {
+		now = r.now
+	}
+	t := now()
+	key := problem{kind: fmt.Sprintf("%T", obj), namespace: obj.GetNamespace(), name: obj.GetName(), reason: reason, message: message}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if last, ok := r.seen[key]; ok && t.Sub(last) < r.Window {
+		return true
+	}
+	if r.seen == nil {
+		r.seen = map[problem]time.Time{}
+	}
+	if len(r.seen) >= maxSeen {
+		for k, last := range r.seen {
+			if t.Sub(last) >= r.Window {
+				delete(r.seen, k)
+			}
+		}
+	}
+	// remembering too many problems costs more than the occasional repeat
+	if len(r.seen) < maxSeen {
+		r.seen[key] = t
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package report
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestReport(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Report Suite")
+}
+
+var _ = Describe("SetCondition", func() {
+	cond := metav1.Condition{Type: "Ready", Status: metav1.ConditionTrue, Reason: "Done", Message: "all  good", ObservedGeneration: 1}
+
+	It("only reports a change when the condition differs", func() {
+		var conditions []metav1.Condition
+		Expect(SetCondition(&conditions, cond)).To(BeTrue())
+		Expect(conditions).To(HaveLen(1))
+		Expect(conditions[0].Message).To(Equal("all good"))
+		Expect(SetCondition(&conditions, cond)).To(BeFalse())
+
+		cond.ObservedGeneration = 2
+		Expect(SetCondition(&conditions, cond)).To(BeTrue())
+		Expect(conditions[0].ObservedGeneration).To(Equal(int64(2)))
+	})
+
+	It("truncates messages too long for a condition", func() {
+		var conditions []metav1.Condition
+		long := cond
+		long.Message = strings.Repeat("x", MaxMessageLength+10)
+		Expect(SetCondition(&conditions, long)).To(BeTrue())
+		Expect(conditions[0].Message).To(HaveLen(MaxMessageLength))
+		Expect(conditions[0].Message).To(HaveSuffix("..."))
+	})
+})
+
+var _ = Describe("Summarize", func() {
+	It("collapses whitespace", func() {
+		Expect(Summarize("failed:\n\tboom  ", 100)).To(Equal("failed: boom"))
+	})
+
+	It("doesn't split multi-byte characters", func() {
+		Expect(Summarize("aé"+strings.Repeat("é", 10), 5)).To(Equal("a..."))
+	})
+})
+
+var _ = Describe("Notifier", func() {
+	var (
+		recorder *record.FakeRecorder
+		hook     *test.Hook
+		r        *Notifier
+		now      time.Time
+		obj      = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "cm"}}
+	)
+
+	BeforeEach(func() {
+		recorder = record.NewFakeRecorder(10)
+		var log *logrus.Logger
+		log, hook = test.NewNullLogger()
+		now = time.Date(2023, time.June, 1, 12, 0, 0, 0, time.UTC)
+		r = &Notifier{Log: log, Recorder: recorder, Window: time.Minute, now: func() time.Time { return now }}
+	})
+
+	It("logs and records formatted problems", func() {
+		r.Warningf(obj, "Broken", "found %d problems", 2)
+		Expect(recorder.Events).To(Receive(Equal("Warning Broken found 2 problems")))
+		Expect(hook.LastEntry().Level).To(Equal(logrus.WarnLevel))
+		Expect(hook.LastEntry().Message).To(Equal("found 2 problems"))
+		Expect(hook.LastEntry().Data).To(HaveKeyWithValue("name", "cm"))
+
+		r.Normalf(obj, "Fixed", "fixed")
+		Expect(recorder.Events).To(Receive(Equal("Normal Fixed fixed")))
+		Expect(hook.LastEntry().Level).To(Equal(logrus.InfoLevel))
+	})
+
+	It("wraps errors", func() {
+		r.Error(obj, "Failed", errors.New("boom"), "failed to render")
+		Expect(recorder.Events).To(Receive(Equal("Warning Failed failed to render: boom")))
+		Expect(hook.LastEntry().Data).To(HaveKey(logrus.ErrorKey))
+	})
+
+	It("drops repeats within the window", func() {
+		r.Warningf(obj, "Broken", "broken")
+		r.Warningf(obj, "Broken", "broken")
+		Expect(recorder.Events).To(HaveLen(1))
+		Expect(hook.AllEntries()).To(HaveLen(1))
+
+		// other objects and messages are reported
+		r.Warningf(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "other"}}, "Broken", "broken")
+		r.Warningf(obj, "Broken", "still broken")
+		Expect(recorder.Events).To(HaveLen(3))
+
+		now = now.Add(time.Minute)
+		r.Warningf(obj, "Broken", "broken")
+		Expect(recorder.Events).To(HaveLen(4))
+	})
+
+	It("does nothing when nil", func() {
+		var nilNotifier *Notifier
+		nilNotifier.Warningf(obj, "Broken", "broken")
+	})
+})
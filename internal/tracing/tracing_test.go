@@ -0,0 +1,90 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Tracing Suite")
+}
+
+var _ = Describe("spans", func() {
+	var exporter *tracetest.InMemoryExporter
+
+	BeforeEach(func() {
+		exporter = tracetest.NewInMemoryExporter()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+	})
+
+	It("records the ClusterConfig attributes", func() {
+		_, span := Start(context.Background(), "Reconcile", ClusterConfigAttributes("ns", "name")...)
+		End(span, nil)
+
+		spans := exporter.GetSpans()
+		Expect(spans).To(HaveLen(1))
+		Expect(spans[0].Name).To(Equal("Reconcile"))
+		Expect(spans[0].Attributes).To(ContainElements(
+			attribute.String("clusterconfig.namespace", "ns"),
+			attribute.String("clusterconfig.name", "name"),
+		))
+		Expect(spans[0].Status.Code).To(Equal(codes.Unset))
+	})
+
+	It("records errors", func() {
+		_, span := Start(context.Background(), "writeInputData")
+		End(span, errors.New("failed"))
+
+		spans := exporter.GetSpans()
+		Expect(spans).To(HaveLen(1))
+		Expect(spans[0].Status.Code).To(Equal(codes.Error))
+		Expect(spans[0].Status.Description).To(Equal("failed"))
+	})
+
+	It("nests child spans", func() {
+		ctx, parent := Start(context.Background(), "Reconcile")
+		_, child := Start(ctx, "setBMHImage")
+		End(child, nil)
+		End(parent, nil)
+
+		spans := exporter.GetSpans()
+		Expect(spans).To(HaveLen(2))
+		Expect(spans[0].Parent.SpanID()).To(Equal(spans[1].SpanContext.SpanID()))
+	})
+
+	It("continues traces propagated in http headers", func() {
+		ctx, parent := Start(context.Background(), "client")
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com/images/ns/name.iso", nil)
+		Expect(err).NotTo(HaveOccurred())
+		otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+		End(parent, nil)
+
+		_, span := Start(ExtractHTTP(req), "BuildISO")
+		End(span, nil)
+
+		spans := exporter.GetSpans()
+		Expect(spans).To(HaveLen(2))
+		Expect(spans[1].SpanContext.TraceID()).To(Equal(spans[0].SpanContext.TraceID()))
+	})
+})
+
+var _ = Describe("Setup", func() {
+	It("is a noop without a configured endpoint", func() {
+		shutdown, err := Setup(context.Background(), "test")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shutdown(context.Background())).To(Succeed())
+	})
+})
@@ -0,0 +1,295 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package txfs applies a set of file writes and removals in a directory together
+//
+// Writes are staged as temporary files in a work directory, which must be on the same filesystem as the
+// directory, and renamed into place on commit. A journal listing the changes and hard links to the replaced
+// files are kept in the work directory while they are applied, so changes interrupted by an error or a crash
+// are rolled back, the latter the next time a transaction begins in the directory.
+// Files are always replaced rather than written through so content shared with hard links is never modified.
+// Directories created for new files are not removed on rollback.
+package txfs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// journalFileName is the name of the journal in the work directory
+const journalFileName = "journal.json"
+
+// crashPoint is called at each step of a commit, tests replace it to simulate a crash at that step
+var crashPoint = func(step string) {}
+
+// op is a single staged change
+type op struct {
+	// Name is the slash separated path of the file relative to the directory
+	Name string `json:"name"`
+	// Staged is the name of the new content in the work directory, empty for removals
+	Staged string `json:"staged,omitempty"`
+	// Backup is the name of the link to the replaced file in the work directory, empty if there was none
+	Backup string `json:"backup,omitempty"`
+}
+
+// Tx stages changes to the files in a directory until they are committed or rolled back
+// A Tx is not safe for concurrent use and concurrent transactions in the same directory must be prevented
+// by the caller, usually with a lock
+type Tx struct {
+	dir     string
+	workDir string
+	ops     []op
+	staged  int
+	done    bool
+}
+
+// Begin rolls back any interrupted transaction in dir and starts a new one with workDir holding staged changes
+func Begin(dir, workDir string) (*Tx, error) {
+	if _, err := Recover(dir, workDir); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(workDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create transaction work dir: %w", err)
+	}
+	return &Tx{dir: dir, workDir: workDir}, nil
+}
+
+// WriteFile stages replacing the file at name with data
+func (tx *Tx) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if err := tx.check(name); err != nil {
+		return err
+	}
+	tx.staged++
+	staged := fmt.Sprintf("staged-%d", tx.staged)
+	if err := writeFileSync(filepath.Join(tx.workDir, staged), data, perm); err != nil {
+		return fmt.Errorf("failed to stage %s: %w", name, err)
+	}
+	return tx.add(op{Name: name, Staged: staged})
+}
+
+// Remove stages removing the file at name, removing a file which doesn't exist isn't an error
+func (tx *Tx) Remove(name string) error {
+	if err := tx.check(name); err != nil {
+		return err
+	}
+	return tx.add(op{Name: name})
+}
+
+// ReadFile returns the content of the file at name including the staged changes
+func (tx *Tx) ReadFile(name string) ([]byte, error) {
+	for i := len(tx.ops) - 1; i >= 0; i-- {
+		if tx.ops[i].Name != name {
+			continue
+		}
+		if tx.ops[i].Staged == "" {
+			return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrNotExist}
+		}
+		return os.ReadFile(filepath.Join(tx.workDir, tx.ops[i].Staged))
+	}
+	return os.ReadFile(filepath.Join(tx.dir, filepath.FromSlash(name)))
+}
+
+// Commit applies the staged changes, either all of them are applied or none are
+func (tx *Tx) Commit() error {
+	if tx.done {
+		return errors.New("transaction already finished")
+	}
+	tx.done = true
+	if len(tx.ops) == 0 {
+		return os.RemoveAll(tx.workDir)
+	}
+
+	crashPoint("staged")
+	for i := range tx.ops {
+		target := tx.target(tx.ops[i].Name)
+		if _, err := os.Lstat(target); err == nil {
+			backup := fmt.Sprintf("backup-%d", i)
+			if err := os.Link(target, filepath.Join(tx.workDir, backup)); err != nil {
+				return tx.discard(fmt.Errorf("failed to back up %s: %w", tx.ops[i].Name, err))
+			}
+			tx.ops[i].Backup = backup
+		} else if !os.IsNotExist(err) {
+			return tx.discard(err)
+		}
+	}
+	data, err := json.Marshal(tx.ops)
+	if err != nil {
+		return tx.discard(err)
+	}
+	// nothing is applied until the complete journal is in place
+	journal := filepath.Join(tx.workDir, journalFileName)
+	if err := writeFileSync(journal+".tmp", data, 0600); err != nil {
+		return tx.discard(fmt.Errorf("failed to write transaction journal: %w", err))
+	}
+	if err := os.Rename(journal+".tmp", journal); err != nil {
+		return tx.discard(fmt.Errorf("failed to write transaction journal: %w", err))
+	}
+
+	crashPoint("journaled")
+	for _, o := range tx.ops {
+		if err := tx.apply(o); err != nil {
+			return tx.abort(fmt.Errorf("failed to apply %s: %w", o.Name, err))
+		}
+		crashPoint("applied " + o.Name)
+	}
+
+	// the transaction is committed once the journal is gone
+	if err := os.Remove(journal); err != nil {
+		return tx.abort(fmt.Errorf("failed to remove transaction journal: %w", err))
+	}
+	crashPoint("committed")
+	return os.RemoveAll(tx.workDir)
+}
+
+// Rollback discards the staged changes, it does nothing once the transaction is finished
+// so it can be deferred right after Begin
+func (tx *Tx) Rollback() error {
+	if tx.done {
+		return nil
+	}
+	tx.done = true
+	return os.RemoveAll(tx.workDir)
+}
+
+// Recover rolls back a transaction in dir interrupted while its changes were applied and removes the staged
+// changes of any unfinished transaction. It returns true if changes were rolled back
+func Recover(dir, workDir string) (bool, error) {
+	data, err := os.ReadFile(filepath.Join(workDir, journalFileName))
+	if os.IsNotExist(err) {
+		return false, os.RemoveAll(workDir)
+	} else if err != nil {
+		return false, fmt.Errorf("failed to read transaction journal: %w", err)
+	}
+	var ops []op
+	if err := json.Unmarshal(data, &ops); err != nil {
+		// the journal is renamed into place once complete so this isn't the result of a crash
+		return false, fmt.Errorf("failed to parse transaction journal: %w", err)
+	}
+	tx := &Tx{dir: dir, workDir: workDir, ops: ops}
+	if err := tx.restore(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// check ensures name is a file in the directory and the transaction can still be changed
+func (tx *Tx) check(name string) error {
+	if tx.done {
+		return errors.New("transaction already finished")
+	}
+	if !fs.ValidPath(name) || name == "." {
+		return fmt.Errorf("invalid file path %q", name)
+	}
+	return nil
+}
+
+// add records o replacing any earlier change to the same file
+func (tx *Tx) add(o op) error {
+	for i := range tx.ops {
+		if tx.ops[i].Name != o.Name {
+			continue
+		}
+		if tx.ops[i].Staged != "" {
+			if err := os.Remove(filepath.Join(tx.workDir, tx.ops[i].Staged)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		tx.ops[i] = o
+		return nil
+	}
+	tx.ops = append(tx.ops, o)
+	return nil
+}
+
+func (tx *Tx) target(name string) string {
+	return filepath.Join(tx.dir, filepath.FromSlash(name))
+}
+
+// apply makes a single staged change
+func (tx *Tx) apply(o op) error {
+	target := tx.target(o.Name)
+	if o.Staged == "" {
+		if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return err
+	}
+	return os.Rename(filepath.Join(tx.workDir, o.Staged), target)
+}
+
+// discard removes the staged changes before any were applied and returns err
+func (tx *Tx) discard(err error) error {
+	if removeErr := os.RemoveAll(tx.workDir); removeErr != nil {
+		return fmt.Errorf("%w, removing the staged changes also failed: %s", err, removeErr)
+	}
+	return err
+}
+
+// abort rolls back the changes applied so far and returns err
+func (tx *Tx) abort(err error) error {
+	if restoreErr := tx.restore(); restoreErr != nil {
+		return fmt.Errorf("%w, rolling back also failed: %s", err, restoreErr)
+	}
+	return err
+}
+
+// restore puts back the files replaced or removed by the changes and removes the files they created
+// Changes which weren't applied yet are left as they are
+func (tx *Tx) restore() error {
+	for i := len(tx.ops) - 1; i >= 0; i-- {
+		o := tx.ops[i]
+		target := tx.target(o.Name)
+		if o.Backup == "" {
+			if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to roll back %s: %w", o.Name, err)
+			}
+			continue
+		}
+		// a backup which was already restored is no longer in the work dir
+		if err := os.Rename(filepath.Join(tx.workDir, o.Backup), target); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to roll back %s: %w", o.Name, err)
+		}
+	}
+	return os.RemoveAll(tx.workDir)
+}
+
+// writeFileSync writes data to a new file at path and flushes it to disk
+func writeFileSync(path string, data []byte, perm fs.FileMode) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,195 @@
+package txfs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestTxfs(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Txfs Suite")
+}
+
+// errCrash is panicked with by crashPoint to abandon a commit the way a crash would
+type errCrash struct{}
+
+var _ = Describe("Tx", func() {
+	var (
+		tempDir string
+		dir     string
+		workDir string
+	)
+
+	BeforeEach(func() {
+		var err error
+		tempDir, err = os.MkdirTemp("", "txfs_test")
+		Expect(err).NotTo(HaveOccurred())
+		dir = filepath.Join(tempDir, "files")
+		workDir = filepath.Join(tempDir, ".tx")
+		Expect(os.MkdirAll(dir, 0700)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		crashPoint = func(string) {}
+		Expect(os.RemoveAll(tempDir)).To(Succeed())
+	})
+
+	writeFiles := func(files map[string]string) {
+		for name, content := range files {
+			path := filepath.Join(dir, name)
+			ExpectWithOffset(1, os.MkdirAll(filepath.Dir(path), 0700)).To(Succeed())
+			ExpectWithOffset(1, os.WriteFile(path, []byte(content), 0644)).To(Succeed())
+		}
+	}
+
+	readFiles := func() map[string]string {
+		files := map[string]string{}
+		ExpectWithOffset(1, filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(dir, path)
+			files[filepath.ToSlash(rel)] = string(data)
+			return err
+		})).To(Succeed())
+		return files
+	}
+
+	old := map[string]string{"a.json": "old a", "b.json": "old b", "c.json": "old c"}
+	updated := map[string]string{"a.json": "new a", "c.json": "old c", "sub/d.json": "new d"}
+
+	// stage changes old into updated
+	stage := func() *Tx {
+		tx, err := Begin(dir, workDir)
+		ExpectWithOffset(1, err).NotTo(HaveOccurred())
+		ExpectWithOffset(1, tx.WriteFile("a.json", []byte("new a"), 0644)).To(Succeed())
+		ExpectWithOffset(1, tx.Remove("b.json")).To(Succeed())
+		ExpectWithOffset(1, tx.WriteFile("sub/d.json", []byte("new d"), 0644)).To(Succeed())
+		return tx
+	}
+
+	It("applies all changes on commit", func() {
+		writeFiles(old)
+		tx := stage()
+		Expect(readFiles()).To(Equal(old))
+		Expect(tx.Commit()).To(Succeed())
+		Expect(tx.Rollback()).To(Succeed())
+
+		Expect(readFiles()).To(Equal(updated))
+		Expect(workDir).NotTo(BeADirectory())
+		info, err := os.Stat(filepath.Join(dir, "a.json"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0644)))
+	})
+
+	It("discards the changes on rollback", func() {
+		writeFiles(old)
+		tx := stage()
+		Expect(tx.Rollback()).To(Succeed())
+		Expect(readFiles()).To(Equal(old))
+		Expect(workDir).NotTo(BeADirectory())
+		Expect(tx.Commit()).NotTo(Succeed())
+	})
+
+	It("reads staged content and keeps the last change to a file", func() {
+		writeFiles(old)
+		tx := stage()
+		data, err := tx.ReadFile("a.json")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(Equal("new a"))
+		_, err = tx.ReadFile("b.json")
+		Expect(os.IsNotExist(err)).To(BeTrue())
+		data, err = tx.ReadFile("c.json")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(Equal("old c"))
+
+		Expect(tx.WriteFile("b.json", []byte("newer b"), 0644)).To(Succeed())
+		Expect(tx.Remove("a.json")).To(Succeed())
+		Expect(tx.Commit()).To(Succeed())
+		Expect(readFiles()).To(Equal(map[string]string{"b.json": "newer b", "c.json": "old c", "sub/d.json": "new d"}))
+	})
+
+	It("rejects paths outside the directory", func() {
+		tx, err := Begin(dir, workDir)
+		Expect(err).NotTo(HaveOccurred())
+		defer tx.Rollback()
+		Expect(tx.WriteFile("../escape", []byte("x"), 0644)).NotTo(Succeed())
+		Expect(tx.Remove("/etc/passwd")).NotTo(Succeed())
+	})
+
+	It("rolls back the applied changes when one fails", func() {
+		writeFiles(old)
+		tx := stage()
+		// the last change fails once the others were applied
+		Expect(os.Remove(filepath.Join(workDir, "staged-2"))).To(Succeed())
+		Expect(tx.Commit()).To(MatchError(ContainSubstring("failed to apply sub/d.json")))
+		Expect(readFiles()).To(Equal(old))
+		Expect(workDir).NotTo(BeADirectory())
+	})
+
+	It("doesn't modify files shared with hard links", func() {
+		writeFiles(old)
+		shared := filepath.Join(tempDir, "shared")
+		Expect(os.Link(filepath.Join(dir, "a.json"), shared)).To(Succeed())
+		Expect(stage().Commit()).To(Succeed())
+		data, err := os.ReadFile(shared)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(Equal("old a"))
+	})
+
+	DescribeTable("recovers from a crash during commit",
+		func(step string, expected map[string]string, rolledBack bool) {
+			writeFiles(old)
+			tx := stage()
+			crashPoint = func(s string) {
+				if s == step {
+					panic(errCrash{})
+				}
+			}
+			Expect(func() { _ = tx.Commit() }).To(PanicWith(errCrash{}))
+			crashPoint = func(string) {}
+
+			recovered, err := Recover(dir, workDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(recovered).To(Equal(rolledBack))
+			Expect(readFiles()).To(Equal(expected))
+			Expect(workDir).NotTo(BeADirectory())
+
+			// the next transaction starts from a consistent directory
+			tx = stage()
+			Expect(tx.Commit()).To(Succeed())
+			Expect(readFiles()).To(Equal(updated))
+		},
+		Entry("before the journal is written", "staged", old, false),
+		Entry("before any change is applied", "journaled", old, true),
+		Entry("after the first change", "applied a.json", old, true),
+		Entry("after a removal", "applied b.json", old, true),
+		Entry("after all changes", "applied sub/d.json", old, true),
+		Entry("after the journal is removed", "committed", updated, false),
+	)
+
+	It("recovers an interrupted transaction when the next one begins", func() {
+		writeFiles(old)
+		tx := stage()
+		crashPoint = func(s string) {
+			if s == "applied b.json" {
+				panic(errCrash{})
+			}
+		}
+		Expect(func() { _ = tx.Commit() }).To(PanicWith(errCrash{}))
+		crashPoint = func(string) {}
+
+		tx, err := Begin(dir, workDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(readFiles()).To(Equal(old))
+		Expect(tx.Rollback()).To(Succeed())
+	})
+})
@@ -0,0 +1,28 @@
+// Package version identifies the build of the running binary
+package version
+
+import "runtime/debug"
+
+// Version and GitCommit are set at build time with
+// -ldflags "-X github.com/carbonin/cluster-relocation-service/internal/version.Version=<version>"
+var (
+	Version   = "unknown"
+	GitCommit = ""
+)
+
+// Commit returns GitCommit, or the revision recorded by the go toolchain when built from a checkout
+func Commit() string {
+	if GitCommit != "" {
+		return GitCommit
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" {
+			return s.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,223 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/carbonin/cluster-relocation-service/api/apischema"
+)
+
+// maxEventSize is the largest event accepted from the events stream
+const maxEventSize = 1024 * 1024
+
+// StatusError is returned when the image service responds with an unexpected status
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d: %s", e.StatusCode, e.Message)
+}
+
+// IsNotFound returns true if err is a StatusError for a missing resource
+func IsNotFound(err error) bool {
+	statusErr, ok := err.(*StatusError)
+	return ok && statusErr.StatusCode == http.StatusNotFound
+}
+
+// APIClient calls the image service HTTP API
+// The API endpoints are only served when the image server has FILESERVER_API_ENABLED set
+type APIClient struct {
+	// BaseURL is the URL of the image service, such as the status.imageURL of a ClusterConfig without its path
+	BaseURL string
+	// Token is sent as a bearer token to the API endpoints, the user it belongs to must be authorized for each request
+	Token string
+	// Username and Password are sent to download images from a server requiring basic auth
+	Username string
+	Password string
+	// HTTPClient sends the requests, http.DefaultClient is used if it is nil
+	HTTPClient *http.Client
+}
+
+// ImageURL returns the URL the image of the ClusterConfig with name in namespace is served from
+func (c *APIClient) ImageURL(namespace, name string) (string, error) {
+	return url.JoinPath(c.BaseURL, "images", namespace, name+".iso")
+}
+
+// GetImage downloads the image of the ClusterConfig with name in namespace, the caller must close it
+func (c *APIClient) GetImage(ctx context.Context, namespace, name string) (io.ReadCloser, error) {
+	u, err := c.ImageURL(namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Kubeconfig returns the admin kubeconfig reported by the cluster relocated with the ClusterConfig
+func (c *APIClient) Kubeconfig(ctx context.Context, namespace, name string) ([]byte, error) {
+	resp, err := c.get(ctx, fmt.Sprintf("/api/v1/clusterconfigs/%s/%s/kubeconfig", url.PathEscape(namespace), url.PathEscape(name)), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// ConsoleLogs lists the host console output captured during the relocation attempts of the ClusterConfig, oldest first
+func (c *APIClient) ConsoleLogs(ctx context.Context, namespace, name string) ([]apischema.ConsoleLog, error) {
+	resp, err := c.get(ctx, fmt.Sprintf("/api/v1/clusterconfigs/%s/%s/consolelogs", url.PathEscape(namespace), url.PathEscape(name)), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	logs := []apischema.ConsoleLog{}
+	if err := json.NewDecoder(resp.Body).Decode(&logs); err != nil {
+		return nil, fmt.Errorf("failed to decode console logs: %w", err)
+	}
+	return logs, nil
+}
+
+// ConsoleLog returns the host console output with logName captured during a relocation attempt of the ClusterConfig
+// The names are listed by ConsoleLogs and recorded in the consoleLog of each attempt in the ClusterConfig status
+func (c *APIClient) ConsoleLog(ctx context.Context, namespace, name, logName string) ([]byte, error) {
+	resp, err := c.get(ctx, fmt.Sprintf("/api/v1/clusterconfigs/%s/%s/consolelogs/%s", url.PathEscape(namespace), url.PathEscape(name), url.PathEscape(logName)), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// Summary returns the phases and most common problems of the ClusterConfigs in namespace, or in all namespaces
+// if it is empty. Limit is the number of problems returned, the server default is used if it is zero
+func (c *APIClient) Summary(ctx context.Context, namespace string, limit int) (*apischema.Summary, error) {
+	query := url.Values{}
+	if namespace != "" {
+		query.Set("namespace", namespace)
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	resp, err := c.get(ctx, "/api/v1/summary", query)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	summary := &apischema.Summary{}
+	if err := json.NewDecoder(resp.Body).Decode(summary); err != nil {
+		return nil, fmt.Errorf("failed to decode summary: %w", err)
+	}
+	return summary, nil
+}
+
+// WatchEvents calls handler with each relocation event for the ClusterConfigs in namespace, or in all namespaces
+// if it is empty, until the context is cancelled, the server closes the stream, or handler returns an error
+func (c *APIClient) WatchEvents(ctx context.Context, namespace string, handler func(apischema.Event) error) error {
+	query := url.Values{}
+	if namespace != "" {
+		query.Set("namespace", namespace)
+	}
+	resp, err := c.get(ctx, "/api/v1/events", query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 4096), maxEventSize)
+	var data strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if data.Len() == 0 {
+				continue
+			}
+			e := apischema.Event{}
+			if err := json.Unmarshal([]byte(data.String()), &e); err != nil {
+				return fmt.Errorf("failed to decode event: %w", err)
+			}
+			data.Reset()
+			if err := handler(e); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "data:"):
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return scanner.Err()
+}
+
+func (c *APIClient) get(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	u, err := url.JoinPath(c.BaseURL, path)
+	if err != nil {
+		return nil, err
+	}
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	return c.do(req)
+}
+
+// do sends req and returns a StatusError for responses other than 200
+func (c *APIClient) do(req *http.Request) (*http.Response, error) {
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &StatusError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+	}
+	return resp, nil
+}
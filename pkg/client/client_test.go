@@ -0,0 +1,205 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/carbonin/cluster-relocation-service/api/apischema"
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestClient(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Client Suite")
+}
+
+var _ = Describe("Clientset", func() {
+	var (
+		ctx = context.Background()
+		cs  *Clientset
+	)
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(relocationv1alpha1.AddToScheme(scheme)).To(Succeed())
+		cs = New(fake.NewClientBuilder().WithScheme(scheme).WithStatusSubresource(&relocationv1alpha1.ClusterConfig{}).Build())
+	})
+
+	It("creates, reads, and deletes ClusterConfigs", func() {
+		configs := cs.ClusterConfigs("sites")
+		created, err := configs.Create(ctx, &relocationv1alpha1.ClusterConfig{ObjectMeta: metav1.ObjectMeta{Name: "site"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(created.Namespace).To(Equal("sites"))
+
+		config, err := configs.Get(ctx, "site")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.Name).To(Equal("site"))
+
+		config.Status.Phase = relocationv1alpha1.ClusterConfigPhaseImageReady
+		_, err = configs.UpdateStatus(ctx, config)
+		Expect(err).NotTo(HaveOccurred())
+
+		patched, err := configs.Patch(ctx, "site", types.MergePatchType, []byte(`{"metadata":{"labels":{"zone":"edge-a"}}}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(patched.Labels).To(HaveKeyWithValue("zone", "edge-a"))
+		Expect(patched.Status.Phase).To(Equal(relocationv1alpha1.ClusterConfigPhaseImageReady))
+
+		_, err = cs.ClusterConfigs("other").Create(ctx, &relocationv1alpha1.ClusterConfig{ObjectMeta: metav1.ObjectMeta{Name: "site"}})
+		Expect(err).NotTo(HaveOccurred())
+		list, err := configs.List(ctx, metav1.ListOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(list.Items).To(HaveLen(1))
+		list, err = cs.ClusterConfigs("").List(ctx, metav1.ListOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(list.Items).To(HaveLen(2))
+
+		Expect(configs.Delete(ctx, "site")).To(Succeed())
+		_, err = configs.Get(ctx, "site")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("lists ClusterConfigs from an informer", func() {
+		_, err := cs.ClusterConfigs("sites").Create(ctx, &relocationv1alpha1.ClusterConfig{ObjectMeta: metav1.ObjectMeta{Name: "site"}})
+		Expect(err).NotTo(HaveOccurred())
+
+		informer := NewClusterConfigInformer(cs, "", 0)
+		stop := make(chan struct{})
+		defer close(stop)
+		go informer.Run(stop)
+		Eventually(informer.HasSynced).Should(BeTrue())
+
+		lister := NewClusterConfigLister(informer)
+		configs, err := lister.List("sites")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(configs).To(HaveLen(1))
+		config, found, err := lister.Get("sites", "site")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found).To(BeTrue())
+		Expect(config.Name).To(Equal("site"))
+	})
+})
+
+var _ = Describe("APIClient", func() {
+	var (
+		ctx    = context.Background()
+		mux    *http.ServeMux
+		server *httptest.Server
+		c      *APIClient
+	)
+
+	BeforeEach(func() {
+		mux = http.NewServeMux()
+		server = httptest.NewServer(mux)
+		c = &APIClient{BaseURL: server.URL, Token: "token"}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("downloads images with basic auth", func() {
+		mux.HandleFunc("/images/sites/site.iso", func(w http.ResponseWriter, r *http.Request) {
+			user, pass, ok := r.BasicAuth()
+			if !ok || user != "user" || pass != "pass" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, "iso")
+		})
+
+		_, err := c.GetImage(ctx, "sites", "site")
+		Expect(err).To(MatchError(&StatusError{StatusCode: http.StatusUnauthorized, Message: "unauthorized"}))
+
+		c.Username, c.Password = "user", "pass"
+		body, err := c.GetImage(ctx, "sites", "site")
+		Expect(err).NotTo(HaveOccurred())
+		defer body.Close()
+		Expect(io.ReadAll(body)).To(Equal([]byte("iso")))
+	})
+
+	It("gets the kubeconfig with the bearer token", func() {
+		mux.HandleFunc("/api/v1/clusterconfigs/sites/site/kubeconfig", func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.Header.Get("Authorization")).To(Equal("Bearer token"))
+			fmt.Fprint(w, "kubeconfig")
+		})
+		Expect(c.Kubeconfig(ctx, "sites", "site")).To(Equal([]byte("kubeconfig")))
+
+		_, err := c.Kubeconfig(ctx, "sites", "missing")
+		Expect(IsNotFound(err)).To(BeTrue())
+	})
+
+	It("gets console logs", func() {
+		mux.HandleFunc("/api/v1/clusterconfigs/sites/site/consolelogs", func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.Header.Get("Authorization")).To(Equal("Bearer token"))
+			fmt.Fprint(w, `[{"name":"1700000000.log","size":7,"lastCaptured":"2023-11-14T22:20:00Z"}]`)
+		})
+		mux.HandleFunc("/api/v1/clusterconfigs/sites/site/consolelogs/1700000000.log", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "booting")
+		})
+		logs, err := c.ConsoleLogs(ctx, "sites", "site")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(logs).To(HaveLen(1))
+		Expect(logs[0].Name).To(Equal("1700000000.log"))
+		Expect(logs[0].Size).To(Equal(int64(7)))
+		Expect(c.ConsoleLog(ctx, "sites", "site", logs[0].Name)).To(Equal([]byte("booting")))
+	})
+
+	It("gets the summary", func() {
+		mux.HandleFunc("/api/v1/summary", func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.URL.Query().Get("namespace")).To(Equal("sites"))
+			Expect(r.URL.Query().Get("limit")).To(Equal("3"))
+			fmt.Fprint(w, `{"total":2,"phases":{"ImageReady":2},"topErrorReasons":[{"condition":"HostError","reason":"ErrorReported","count":1}]}`)
+		})
+		summary, err := c.Summary(ctx, "sites", 3)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(summary.Total).To(Equal(2))
+		Expect(summary.Phases).To(HaveKeyWithValue(relocationv1alpha1.ClusterConfigPhaseImageReady, 2))
+		Expect(summary.TopErrorReasons).To(Equal([]apischema.ReasonCount{{Condition: "HostError", Reason: "ErrorReported", Count: 1}}))
+	})
+
+	It("streams events until the handler returns an error", func() {
+		mux.HandleFunc("/api/v1/events", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, ": heartbeat\n\n")
+			fmt.Fprint(w, "event: ImageAttached\ndata: {\"type\":\"ImageAttached\",\"namespace\":\"sites\",\"name\":\"a\"}\n\n")
+			fmt.Fprint(w, "event: RelocationCompleted\ndata: {\"type\":\"RelocationCompleted\",\"namespace\":\"sites\",\"name\":\"b\"}\n\n")
+			fmt.Fprint(w, "event: RelocationCompleted\ndata: {\"type\":\"RelocationCompleted\",\"namespace\":\"sites\",\"name\":\"c\"}\n\n")
+		})
+
+		stop := errors.New("stop")
+		var received []apischema.Event
+		err := c.WatchEvents(ctx, "sites", func(e apischema.Event) error {
+			received = append(received, e)
+			if len(received) == 2 {
+				return stop
+			}
+			return nil
+		})
+		Expect(err).To(Equal(stop))
+		Expect(received).To(HaveLen(2))
+		Expect(received[0].Type).To(Equal(apischema.ImageAttached))
+		Expect(received[1].Name).To(Equal("b"))
+	})
+
+	It("returns once the context is cancelled", func() {
+		mux.HandleFunc("/api/v1/events", func(w http.ResponseWriter, r *http.Request) {
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		})
+		ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		Expect(c.WatchEvents(ctx, "", func(apischema.Event) error { return nil })).To(MatchError(context.DeadlineExceeded))
+	})
+})
@@ -0,0 +1,142 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package client provides typed access to the relocation.openshift.io resources and the image service HTTP API
+// for integrators such as ZTP pipelines and test harnesses
+package client
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/rest"
+	crclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+)
+
+// Clientset is a typed client for the relocation.openshift.io resources
+type Clientset struct {
+	client crclient.WithWatch
+}
+
+// NewForConfig returns a Clientset using config
+func NewForConfig(config *rest.Config) (*Clientset, error) {
+	scheme := runtime.NewScheme()
+	if err := relocationv1alpha1.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	c, err := crclient.NewWithWatch(config, crclient.Options{Scheme: scheme})
+	if err != nil {
+		return nil, err
+	}
+	return New(c), nil
+}
+
+// New returns a Clientset using c, whose scheme must include the relocation.openshift.io types
+func New(c crclient.WithWatch) *Clientset {
+	return &Clientset{client: c}
+}
+
+// ClusterConfigs returns a client for the ClusterConfigs in namespace, or in all namespaces if it is empty
+func (c *Clientset) ClusterConfigs(namespace string) ClusterConfigInterface {
+	return &clusterConfigs{client: c.client, namespace: namespace}
+}
+
+// ClusterConfigInterface reads and writes ClusterConfigs in a single namespace
+type ClusterConfigInterface interface {
+	Get(ctx context.Context, name string) (*relocationv1alpha1.ClusterConfig, error)
+	List(ctx context.Context, opts metav1.ListOptions) (*relocationv1alpha1.ClusterConfigList, error)
+	Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error)
+	Create(ctx context.Context, config *relocationv1alpha1.ClusterConfig) (*relocationv1alpha1.ClusterConfig, error)
+	Update(ctx context.Context, config *relocationv1alpha1.ClusterConfig) (*relocationv1alpha1.ClusterConfig, error)
+	UpdateStatus(ctx context.Context, config *relocationv1alpha1.ClusterConfig) (*relocationv1alpha1.ClusterConfig, error)
+	Patch(ctx context.Context, name string, pt types.PatchType, data []byte) (*relocationv1alpha1.ClusterConfig, error)
+	Delete(ctx context.Context, name string) error
+}
+
+type clusterConfigs struct {
+	client    crclient.WithWatch
+	namespace string
+}
+
+func (c *clusterConfigs) Get(ctx context.Context, name string) (*relocationv1alpha1.ClusterConfig, error) {
+	config := &relocationv1alpha1.ClusterConfig{}
+	if err := c.client.Get(ctx, types.NamespacedName{Namespace: c.namespace, Name: name}, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func (c *clusterConfigs) List(ctx context.Context, opts metav1.ListOptions) (*relocationv1alpha1.ClusterConfigList, error) {
+	list := &relocationv1alpha1.ClusterConfigList{}
+	if err := c.client.List(ctx, list, &crclient.ListOptions{Namespace: c.namespace, Raw: &opts}); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (c *clusterConfigs) Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+	return c.client.Watch(ctx, &relocationv1alpha1.ClusterConfigList{}, &crclient.ListOptions{Namespace: c.namespace, Raw: &opts})
+}
+
+func (c *clusterConfigs) Create(ctx context.Context, config *relocationv1alpha1.ClusterConfig) (*relocationv1alpha1.ClusterConfig, error) {
+	out := c.inNamespace(config)
+	if err := c.client.Create(ctx, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterConfigs) Update(ctx context.Context, config *relocationv1alpha1.ClusterConfig) (*relocationv1alpha1.ClusterConfig, error) {
+	out := c.inNamespace(config)
+	if err := c.client.Update(ctx, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterConfigs) UpdateStatus(ctx context.Context, config *relocationv1alpha1.ClusterConfig) (*relocationv1alpha1.ClusterConfig, error) {
+	out := c.inNamespace(config)
+	if err := c.client.Status().Update(ctx, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterConfigs) Patch(ctx context.Context, name string, pt types.PatchType, data []byte) (*relocationv1alpha1.ClusterConfig, error) {
+	out := &relocationv1alpha1.ClusterConfig{ObjectMeta: metav1.ObjectMeta{Namespace: c.namespace, Name: name}}
+	if err := c.client.Patch(ctx, out, crclient.RawPatch(pt, data)); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clusterConfigs) Delete(ctx context.Context, name string) error {
+	return c.client.Delete(ctx, &relocationv1alpha1.ClusterConfig{ObjectMeta: metav1.ObjectMeta{Namespace: c.namespace, Name: name}})
+}
+
+// inNamespace returns a copy of config in the client namespace so the caller's object isn't modified
+func (c *clusterConfigs) inNamespace(config *relocationv1alpha1.ClusterConfig) *relocationv1alpha1.ClusterConfig {
+	out := config.DeepCopy()
+	if c.namespace != "" {
+		out.Namespace = c.namespace
+	}
+	return out
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+
+	relocationv1alpha1 "github.com/carbonin/cluster-relocation-service/api/v1alpha1"
+)
+
+// NewClusterConfigInformer returns an informer for the ClusterConfigs in namespace, or in all namespaces if it is
+// empty, indexed by namespace. Objects from its store are shared and must not be modified
+func NewClusterConfigInformer(c *Clientset, namespace string, resync time.Duration) cache.SharedIndexInformer {
+	configs := c.ClusterConfigs(namespace)
+	lw := &cache.ListWatch{
+		ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+			return configs.List(context.Background(), opts)
+		},
+		WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+			return configs.Watch(context.Background(), opts)
+		},
+	}
+	return cache.NewSharedIndexInformer(lw, &relocationv1alpha1.ClusterConfig{}, resync,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+}
+
+// NewClusterConfigLister returns a lister reading ClusterConfigs from the store of informer
+func NewClusterConfigLister(informer cache.SharedIndexInformer) *ClusterConfigLister {
+	return &ClusterConfigLister{indexer: informer.GetIndexer()}
+}
+
+// ClusterConfigLister reads ClusterConfigs from an informer store
+type ClusterConfigLister struct {
+	indexer cache.Indexer
+}
+
+// List returns the ClusterConfigs in namespace, or in all namespaces if it is empty
+func (l *ClusterConfigLister) List(namespace string) ([]*relocationv1alpha1.ClusterConfig, error) {
+	var configs []*relocationv1alpha1.ClusterConfig
+	appendConfig := func(obj interface{}) {
+		if config, ok := obj.(*relocationv1alpha1.ClusterConfig); ok {
+			configs = append(configs, config)
+		}
+	}
+	if namespace == "" {
+		for _, obj := range l.indexer.List() {
+			appendConfig(obj)
+		}
+		return configs, nil
+	}
+	objs, err := l.indexer.ByIndex(cache.NamespaceIndex, namespace)
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range objs {
+		appendConfig(obj)
+	}
+	return configs, nil
+}
+
+// Get returns the ClusterConfig with name in namespace and false if it is not in the store
+func (l *ClusterConfigLister) Get(namespace, name string) (*relocationv1alpha1.ClusterConfig, bool, error) {
+	obj, exists, err := l.indexer.GetByKey(namespace + "/" + name)
+	if err != nil || !exists {
+		return nil, false, err
+	}
+	config, ok := obj.(*relocationv1alpha1.ClusterConfig)
+	return config, ok, nil
+}